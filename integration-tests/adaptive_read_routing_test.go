@@ -0,0 +1,187 @@
+package integration_tests
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/datastax/zdm-proxy/proxy/pkg/admin"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Origin is consistently slower than Target so reads should move to Target once both clusters have latency samples.
+func TestAdaptiveReadRouting(t *testing.T) {
+	tests := []struct {
+		name                  string
+		adaptiveRoutingEnable bool
+		expectedOriginReads   int64
+		expectedTargetReads   int64
+	}{
+		{
+			name:                  "enabled",
+			adaptiveRoutingEnable: true,
+			expectedOriginReads:   0,
+			expectedTargetReads:   10,
+		},
+		{
+			name:                  "disabled",
+			adaptiveRoutingEnable: false,
+			expectedOriginReads:   10,
+			expectedTargetReads:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+			conf.AdaptiveReadRoutingEnabled = tt.adaptiveRoutingEnable
+			testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+			require.Nil(t, err)
+			defer testSetup.Cleanup()
+
+			queryHandler := func(delay time.Duration, reads *int64) client.RequestHandler {
+				return func(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+					query, ok := request.Body.Message.(*message.Query)
+					if !ok {
+						return nil
+					}
+					time.Sleep(delay)
+					if strings.HasPrefix(query.Query, "SELECT") {
+						atomic.AddInt64(reads, 1)
+						return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.RowsResult{
+							Metadata: &message.RowsMetadata{ColumnCount: 0},
+							Data:     message.RowSet{},
+						})
+					}
+					return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.VoidResult{})
+				}
+			}
+			var originReads, targetReads int64
+			testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+				queryHandler(50*time.Millisecond, &originReads)}
+			testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}),
+				queryHandler(0, &targetReads)}
+
+			err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+			require.Nil(t, err)
+
+			// writes are sent to both clusters so they provide latency samples for both
+			for i := 0; i < 5; i++ {
+				response, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+					primitive.ProtocolVersion4, client.ManagedStreamId,
+					&message.Query{Query: "INSERT INTO ks1.tb1 (key, value) VALUES ('key', 'value')"}))
+				require.Nil(t, err)
+				require.IsType(t, &message.VoidResult{}, response.Body.Message)
+			}
+
+			for i := 0; i < 10; i++ {
+				response, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+					primitive.ProtocolVersion4, client.ManagedStreamId,
+					&message.Query{Query: "SELECT * FROM ks1.tb1"}))
+				require.Nil(t, err)
+				require.IsType(t, &message.RowsResult{}, response.Body.Message)
+			}
+
+			require.Equal(t, tt.expectedOriginReads, atomic.LoadInt64(&originReads))
+			require.Equal(t, tt.expectedTargetReads, atomic.LoadInt64(&targetReads))
+		})
+	}
+}
+
+// Responses from Target are artificially delayed so writes (which wait for both clusters) are slow while reads
+// (which are only sent to Origin) are not.
+func TestInjectedLatency(t *testing.T) {
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	conf.TargetInjectedLatencyMs = 300
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	queryHandler := func(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+		query, ok := request.Body.Message.(*message.Query)
+		if !ok {
+			return nil
+		}
+		if strings.HasPrefix(query.Query, "SELECT") {
+			return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.RowsResult{
+				Metadata: &message.RowsMetadata{ColumnCount: 0},
+				Data:     message.RowSet{},
+			})
+		}
+		return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.VoidResult{})
+	}
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}), queryHandler}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}), queryHandler}
+
+	err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	sendQuery := func(query string) time.Duration {
+		start := time.Now()
+		_, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+			primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: query}))
+		require.Nil(t, err)
+		return time.Since(start)
+	}
+
+	require.GreaterOrEqual(t, sendQuery("INSERT INTO ks1.tb1 (key, value) VALUES ('key', 'value')"), 300*time.Millisecond)
+	require.Less(t, sendQuery("SELECT * FROM ks1.tb1"), 300*time.Millisecond)
+
+	report, err := testSetup.Proxy.SetInjectedLatency("origin", 500*time.Millisecond)
+	require.Nil(t, err)
+	require.Equal(t, int64(500), report.OriginMs)
+	require.Equal(t, int64(300), report.TargetMs)
+	require.GreaterOrEqual(t, sendQuery("SELECT * FROM ks1.tb1"), 500*time.Millisecond)
+
+	_, err = testSetup.Proxy.SetInjectedLatency("ORIGIN", 0)
+	require.Nil(t, err)
+	_, err = testSetup.Proxy.SetInjectedLatency("TARGET", 0)
+	require.Nil(t, err)
+	require.Less(t, sendQuery("INSERT INTO ks1.tb1 (key, value) VALUES ('key', 'value')"), 300*time.Millisecond)
+
+	_, err = testSetup.Proxy.SetInjectedLatency("TARGET", -time.Millisecond)
+	require.NotNil(t, err)
+	_, err = testSetup.Proxy.SetInjectedLatency("BOTH", time.Millisecond)
+	require.NotNil(t, err)
+	_, err = testSetup.Proxy.SetInjectedLatency("TARGET", time.Duration(conf.InjectedLatencyMaxMs+1)*time.Millisecond)
+	require.NotNil(t, err)
+}
+
+// The injected latency can only be changed with the admin endpoint if ZDM_INJECTED_LATENCY_ADMIN_ENABLED is set.
+func TestInjectedLatencyAdminEndpoint(t *testing.T) {
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, true, true, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	postDelay := func(body string) int {
+		rsp := httptest.NewRecorder()
+		admin.Handler(testSetup.Proxy).ServeHTTP(rsp, httptest.NewRequest(
+			http.MethodPost, "/admin/injectedlatency", strings.NewReader(body)))
+		return rsp.Code
+	}
+
+	rsp := httptest.NewRecorder()
+	admin.Handler(testSetup.Proxy).ServeHTTP(rsp, httptest.NewRequest(http.MethodGet, "/admin/injectedlatency", nil))
+	require.Equal(t, http.StatusOK, rsp.Code)
+
+	require.Equal(t, http.StatusNotFound, postDelay(`{"Cluster": "TARGET", "DelayMs": 200}`))
+	require.Equal(t, int64(0), testSetup.Proxy.GetInjectedLatency().TargetMs)
+
+	testSetup.Proxy.Conf.InjectedLatencyAdminEnabled = true
+	require.Equal(t, http.StatusOK, postDelay(`{"Cluster": "TARGET", "DelayMs": 200}`))
+	require.Equal(t, int64(200), testSetup.Proxy.GetInjectedLatency().TargetMs)
+	require.Equal(t, http.StatusBadRequest, postDelay(`{"Cluster": "TARGET", "DelayMs": 10001}`))
+	require.Equal(t, int64(200), testSetup.Proxy.GetInjectedLatency().TargetMs)
+}
@@ -0,0 +1,170 @@
+package integration_tests
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/datastax/zdm-proxy/integration-tests/utils"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Reads that are out of the configured scope are only sent to the primary cluster.
+func TestAsyncReadsScope(t *testing.T) {
+	tests := []struct {
+		name            string
+		opcodes         string
+		samplePercent   int
+		expectedQuery   int64
+		expectedExecute int64
+	}{
+		{name: "all reads", opcodes: "", samplePercent: 100, expectedQuery: 1, expectedExecute: 1},
+		{name: "query only", opcodes: config.AsyncReadsOpcodeQuery, samplePercent: 100, expectedQuery: 1, expectedExecute: 0},
+		{name: "execute only", opcodes: config.AsyncReadsOpcodeExecute, samplePercent: 100, expectedQuery: 0, expectedExecute: 1},
+		{name: "no sampling", opcodes: "", samplePercent: 0, expectedQuery: 0, expectedExecute: 0},
+	}
+
+	preparedId := []byte{1, 2, 3, 4}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+			conf.ReadMode = config.ReadModeDualAsyncOnSecondary
+			conf.AsyncReadsOpcodes = tt.opcodes
+			conf.AsyncReadsSamplePercent = tt.samplePercent
+			testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+			require.Nil(t, err)
+			defer testSetup.Cleanup()
+
+			readsHandler := func(queries *int64, executes *int64) client.RequestHandler {
+				return func(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+					switch request.Body.Message.(type) {
+					case *message.Prepare:
+						return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.PreparedResult{
+							PreparedQueryId:   preparedId,
+							VariablesMetadata: &message.VariablesMetadata{},
+							ResultMetadata:    &message.RowsMetadata{ColumnCount: 0},
+						})
+					case *message.Query:
+						atomic.AddInt64(queries, 1)
+					case *message.Execute:
+						atomic.AddInt64(executes, 1)
+					default:
+						return nil
+					}
+					return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.RowsResult{
+						Metadata: &message.RowsMetadata{ColumnCount: 0},
+						Data:     message.RowSet{},
+					})
+				}
+			}
+			var originQueries, originExecutes, targetQueries, targetExecutes int64
+			testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+				readsHandler(&originQueries, &originExecutes)}
+			testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}),
+				readsHandler(&targetQueries, &targetExecutes)}
+
+			err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+			require.Nil(t, err)
+
+			response, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+				primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: "SELECT * FROM ks1.tb1"}))
+			require.Nil(t, err)
+			require.IsType(t, &message.RowsResult{}, response.Body.Message)
+
+			response, err = testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+				primitive.ProtocolVersion4, client.ManagedStreamId, &message.Prepare{Query: "SELECT * FROM ks1.tb1 WHERE key = 1"}))
+			require.Nil(t, err)
+			require.IsType(t, &message.PreparedResult{}, response.Body.Message)
+
+			response, err = testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+				primitive.ProtocolVersion4, client.ManagedStreamId, &message.Execute{QueryId: preparedId}))
+			require.Nil(t, err)
+			require.IsType(t, &message.RowsResult{}, response.Body.Message)
+
+			require.Equal(t, int64(1), atomic.LoadInt64(&originQueries))
+			require.Equal(t, int64(1), atomic.LoadInt64(&originExecutes))
+
+			// async reads are fire and forget so the client response does not wait for them
+			utils.RequireWithRetries(t, func() (err error, fatal bool) {
+				if queries := atomic.LoadInt64(&targetQueries); queries != tt.expectedQuery {
+					return fmt.Errorf("expected %v QUERY requests on target but got %v", tt.expectedQuery, queries), false
+				}
+				if executes := atomic.LoadInt64(&targetExecutes); executes != tt.expectedExecute {
+					return fmt.Errorf("expected %v EXECUTE requests on target but got %v", tt.expectedExecute, executes), false
+				}
+				return nil, false
+			}, 10, 100*time.Millisecond)
+
+			time.Sleep(200 * time.Millisecond)
+			require.Equal(t, tt.expectedQuery, atomic.LoadInt64(&targetQueries))
+			require.Equal(t, tt.expectedExecute, atomic.LoadInt64(&targetExecutes))
+		})
+	}
+}
+
+// The client gets the primary response right away and the async read is given up after the max wait
+// when the secondary cluster never responds.
+func TestAsyncReadsMaxWait(t *testing.T) {
+	buffer := utils.CreateLogHooks(log.WarnLevel)
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	conf.ReadMode = config.ReadModeDualAsyncOnSecondary
+	conf.AsyncReadsMaxWaitMs = 200
+	conf.ProxyRequestTimeoutMs = 10000
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	var targetQueries int64
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+		func(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+			if _, ok := request.Body.Message.(*message.Query); !ok {
+				return nil
+			}
+			return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.RowsResult{
+				Metadata: &message.RowsMetadata{ColumnCount: 0},
+				Data:     message.RowSet{},
+			})
+		}}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}),
+		func(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+			// the secondary cluster never responds
+			if _, ok := request.Body.Message.(*message.Query); ok {
+				atomic.AddInt64(&targetQueries, 1)
+			}
+			return nil
+		}}
+
+	err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	start := time.Now()
+	response, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+		primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: "SELECT * FROM ks1.tb1"}))
+	require.Nil(t, err)
+	require.IsType(t, &message.RowsResult{}, response.Body.Message)
+	require.Less(t, time.Since(start).Milliseconds(), int64(conf.AsyncReadsMaxWaitMs))
+
+	utils.RequireWithRetries(t, func() (err error, fatal bool) {
+		if queries := atomic.LoadInt64(&targetQueries); queries != 1 {
+			return fmt.Errorf("expected 1 QUERY request on target but got %v", queries), false
+		}
+		if logMessages := buffer.String(); !strings.Contains(logMessages, "timed out after 200 ms.") {
+			return fmt.Errorf("async request did not time out after the max wait: %v", logMessages), false
+		}
+		return nil, false
+	}, 20, 100*time.Millisecond)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/datastax/zdm-proxy/integration-tests/setup"
 	"github.com/datastax/zdm-proxy/proxy/pkg/config"
 	"github.com/datastax/zdm-proxy/proxy/pkg/health"
+	"github.com/datastax/zdm-proxy/proxy/pkg/zdmproxy"
 	"github.com/stretchr/testify/require"
 	"strings"
 	"sync"
@@ -1037,6 +1038,121 @@ func TestProxyStartupAndHealthCheckWithAuth(t *testing.T) {
 	}
 }
 
+func TestCustomTargetAuthenticator(t *testing.T) {
+	originAddress := "127.0.1.1"
+	targetAddress := "127.0.1.2"
+
+	serverConf := setup.NewTestConfig(originAddress, targetAddress)
+	serverConf.OriginUsername = "origin_username"
+	serverConf.OriginPassword = "originPassword"
+	serverConf.TargetUsername = ""
+	serverConf.TargetPassword = ""
+
+	proxyConf := setup.NewTestConfig(originAddress, targetAddress)
+	proxyConf.OriginUsername = "origin_username"
+	proxyConf.OriginPassword = "originPassword"
+	proxyConf.TargetUsername = "token"
+	proxyConf.TargetPassword = "target-token"
+	proxyConf.ForwardClientCredentialsToOrigin = true
+
+	testSetup, err := setup.NewCqlServerTestSetup(t, serverConf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	targetRequestHandler := NewFakeRequestHandler()
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+	}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		targetRequestHandler.HandleRequest,
+		client.HeartbeatHandler,
+		newTokenAuthHandler("target-token"),
+		client.NewSetKeyspaceHandler(func(_ string) {}),
+		client.RegisterHandler,
+		client.NewSystemTablesHandler("target", "dc2"),
+	}
+
+	err = testSetup.Start(nil, false, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	proxy, err := zdmproxy.NewZdmProxy(proxyConf)
+	require.Nil(t, err)
+	proxy.TargetAuthenticatorProvider = func(credentials *zdmproxy.AuthCredentials) (zdmproxy.Authenticator, error) {
+		return &tokenAuthenticator{token: credentials.Password}, nil
+	}
+	err = proxy.Start(context.Background())
+	defer proxy.Shutdown()
+	require.Nil(t, err)
+
+	testClient := client.NewCqlClient(
+		fmt.Sprintf("%s:%d", proxyConf.ProxyListenAddress, proxyConf.ProxyListenPort),
+		&client.AuthCredentials{Username: "origin_username", Password: "originPassword"})
+	cqlConn, err := testClient.ConnectAndInit(context.Background(), primitive.ProtocolVersion4, 0)
+	require.Nil(t, err, "client connection failed: %v", err)
+	defer cqlConn.Close()
+
+	query := &message.Query{
+		Query:   "SELECT * FROM system.peers",
+		Options: &message.QueryOptions{Consistency: primitive.ConsistencyLevelOne},
+	}
+	response, err := cqlConn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 0, query))
+	require.Nil(t, err)
+	require.Equal(t, primitive.OpCodeResult, response.Body.Message.GetOpCode(), response.Body.Message)
+
+	// the control connection and the client connection authenticated with the custom authenticator
+	targetRequestsByConn := targetRequestHandler.GetRequests()
+	require.Equal(t, 2, len(targetRequestsByConn))
+	for _, requests := range targetRequestsByConn {
+		require.GreaterOrEqual(t, len(requests), 2)
+		require.Equal(t, primitive.OpCodeStartup, requests[0].Header.OpCode)
+		authResponse, ok := requests[1].Body.Message.(*message.AuthResponse)
+		require.True(t, ok, requests[1].Body.Message)
+		require.Equal(t, []byte("target-token"), authResponse.Token)
+	}
+}
+
+const tokenAuthenticatorClass = "com.example.TokenAuthenticator"
+
+type tokenAuthenticator struct {
+	token string
+}
+
+func (recv *tokenAuthenticator) InitialResponse(authenticator string) ([]byte, error) {
+	if authenticator != tokenAuthenticatorClass {
+		return nil, fmt.Errorf("unexpected authenticator: %v", authenticator)
+	}
+	return []byte(recv.token), nil
+}
+
+func (recv *tokenAuthenticator) EvaluateChallenge(challenge []byte) ([]byte, error) {
+	return nil, fmt.Errorf("unexpected challenge: %v", string(challenge))
+}
+
+// newTokenAuthHandler returns a handshake handler that requires an AUTH_RESPONSE with the provided token.
+func newTokenAuthHandler(token string) client.RequestHandler {
+	return func(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+		if ctx.GetAttribute("authenticated") != nil {
+			return nil
+		}
+		version := request.Header.Version
+		id := request.Header.StreamId
+		switch msg := request.Body.Message.(type) {
+		case *message.Options:
+			return frame.NewFrame(version, id, &message.Supported{})
+		case *message.Startup:
+			return frame.NewFrame(version, id, &message.Authenticate{Authenticator: tokenAuthenticatorClass})
+		case *message.AuthResponse:
+			if string(msg.Token) != token {
+				return frame.NewFrame(version, id, &message.AuthenticationError{ErrorMessage: "invalid token"})
+			}
+			ctx.PutAttribute("authenticated", true)
+			return frame.NewFrame(version, id, &message.AuthSuccess{})
+		default:
+			return frame.NewFrame(version, id, &message.ProtocolError{ErrorMessage: "handshake failed"})
+		}
+	}
+}
+
 type FakeRequestHandler struct {
 	lock         *sync.Mutex
 	contexts     map[*client.CqlServerConnection]client.RequestHandlerContext
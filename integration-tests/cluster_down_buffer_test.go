@@ -0,0 +1,135 @@
+package integration_tests
+
+import (
+	"context"
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/datastax/zdm-proxy/integration-tests/utils"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// While the control connection of ORIGIN is DOWN (it is dropped and ORIGIN fails every request until it is back) the
+// reads of the clients are held back and forwarded once the control connection is reconnected. The connection of the
+// client handler to ORIGIN stays open, the client connection would be closed if it was dropped too.
+func TestClusterDownBufferHoldsReadsWhileControlConnectionIsDown(t *testing.T) {
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	conf.ClusterDownBufferTimeoutMs = 10000
+	conf.HeartbeatIntervalMs = 100
+	conf.HeartbeatRetryIntervalMinMs = 50
+	conf.HeartbeatRetryIntervalMaxMs = 100
+	conf.HeartbeatFailureThreshold = 1
+	conf.HeartbeatFailureGracePeriodMs = 0
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	blip := &clusterBlip{lock: &sync.Mutex{}}
+	originReads := int32(0)
+	targetReads := int32(0)
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		blip.handleRequest,
+		client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+		newReadFailoverTestHandler([]byte("origin-id"), &originReads, nil)}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}),
+		newReadFailoverTestHandler([]byte("target-id"), &targetReads, nil)}
+
+	err = testSetup.Start(conf, false, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	testClient := client.NewCqlClient(
+		fmt.Sprintf("%s:%d", conf.ProxyListenAddress, conf.ProxyListenPort),
+		&client.AuthCredentials{Username: conf.OriginUsername, Password: conf.OriginPassword})
+	cqlConn, err := testClient.ConnectAndInit(context.Background(), primitive.ProtocolVersion4, 0)
+	require.Nil(t, err)
+	defer cqlConn.Close()
+
+	read := func(streamId int16) *frame.Frame {
+		return frame.NewFrame(primitive.ProtocolVersion4, streamId,
+			&message.Query{Query: "SELECT * FROM ks1.tb1", Options: &message.QueryOptions{}})
+	}
+	response, err := cqlConn.SendAndReceive(read(10))
+	require.Nil(t, err)
+	require.IsType(t, &message.RowsResult{}, response.Body.Message)
+
+	blip.start()
+	utils.RequireWithRetries(t, func() (err error, fatal bool) {
+		if !testSetup.Proxy.GetOriginControlConn().IsDown(conf.HeartbeatFailureThreshold, 0) {
+			return fmt.Errorf("ORIGIN is not DOWN yet"), false
+		}
+		return nil, false
+	}, 50, 100*time.Millisecond)
+
+	// writes are not safe to forward later, the client has to decide whether to retry them
+	response, err = cqlConn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 20,
+		&message.Query{Query: "INSERT INTO ks1.tb1 (a) VALUES (1)", Options: &message.QueryOptions{}}))
+	require.Nil(t, err)
+	require.IsType(t, &message.Overloaded{}, response.Body.Message)
+
+	// the read would fail with the SERVER_ERROR of ORIGIN if it wasn't held back
+	inFlightRead, err := cqlConn.Send(read(30))
+	require.Nil(t, err)
+	select {
+	case response = <-inFlightRead.Incoming():
+		require.Fail(t, "read was not held back while ORIGIN is DOWN", "response: %v", response)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	blip.stop()
+	select {
+	case response = <-inFlightRead.Incoming():
+		require.IsType(t, &message.RowsResult{}, response.Body.Message)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "read was not forwarded after ORIGIN reconnected")
+	}
+	require.Equal(t, int32(2), atomic.LoadInt32(&originReads))
+}
+
+// clusterBlip simulates a short outage of a cluster: once it is started the control connection of the proxy is
+// closed and every request (including the STARTUP requests of the new connections) fails until it is stopped.
+type clusterBlip struct {
+	lock         *sync.Mutex
+	blipping     bool
+	controlConns []*client.CqlServerConnection
+}
+
+func (recv *clusterBlip) handleRequest(
+	request *frame.Frame, conn *client.CqlServerConnection, _ client.RequestHandlerContext) *frame.Frame {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	if recv.blipping {
+		return frame.NewFrame(request.Header.Version, request.Header.StreamId,
+			&message.ServerError{ErrorMessage: "blip"})
+	}
+	// only the control connection of the proxy queries the system tables in this test
+	if query, ok := request.Body.Message.(*message.Query); ok && strings.Contains(query.Query, "system.local") {
+		recv.controlConns = append(recv.controlConns, conn)
+	}
+	return nil
+}
+
+func (recv *clusterBlip) start() {
+	recv.lock.Lock()
+	recv.blipping = true
+	controlConns := recv.controlConns
+	recv.controlConns = nil
+	recv.lock.Unlock()
+	for _, conn := range controlConns {
+		_ = conn.Close()
+	}
+}
+
+func (recv *clusterBlip) stop() {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	recv.blipping = false
+}
@@ -0,0 +1,152 @@
+package integration_tests
+
+import (
+	"context"
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// Clusters that don't support compression fail the STARTUP request of a client that negotiates it, the proxy has to
+// bridge the compression so that these clusters only see uncompressed frames.
+func TestCompressionBridge(t *testing.T) {
+	tests := []struct {
+		name           string
+		bridgeEnabled  bool
+		expectedFailed bool
+	}{
+		{name: "enabled", bridgeEnabled: true, expectedFailed: false},
+		{name: "disabled", bridgeEnabled: false, expectedFailed: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+			conf.OriginCompressionBridgeEnabled = test.bridgeEnabled
+			conf.TargetCompressionBridgeEnabled = test.bridgeEnabled
+			testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+			require.Nil(t, err)
+			defer testSetup.Cleanup()
+
+			originRequestHandler := NewFakeRequestHandler()
+			targetRequestHandler := NewFakeRequestHandler()
+			testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+				originRequestHandler.HandleRequest, compressionUnsupportedHandler, client.RegisterHandler,
+				client.HeartbeatHandler, client.HandshakeHandler, client.NewSystemTablesHandler("cluster1", "dc1"),
+				insertHandler}
+			testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+				targetRequestHandler.HandleRequest, compressionUnsupportedHandler, client.RegisterHandler,
+				client.HeartbeatHandler, client.HandshakeHandler, client.NewSystemTablesHandler("cluster2", "dc2"),
+				insertHandler}
+
+			err = testSetup.Start(conf, false, primitive.ProtocolVersion4)
+			require.Nil(t, err)
+
+			testClient := client.NewCqlClient(
+				fmt.Sprintf("%s:%d", conf.ProxyListenAddress, conf.ProxyListenPort),
+				&client.AuthCredentials{Username: conf.OriginUsername, Password: conf.OriginPassword})
+			testClient.Compression = primitive.CompressionLz4
+			cqlConn, err := testClient.ConnectAndInit(context.Background(), primitive.ProtocolVersion4, 0)
+			if test.expectedFailed {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			defer cqlConn.Close()
+
+			response, err := cqlConn.SendAndReceive(
+				frame.NewFrame(primitive.ProtocolVersion4, 0, &message.Query{Query: "INSERT INTO ks1.t1 (a) VALUES (1)"}))
+			require.Nil(t, err)
+			require.IsType(t, &message.VoidResult{}, response.Body.Message)
+			require.True(t, response.Header.Flags.Contains(primitive.HeaderFlagCompressed))
+
+			for _, requestsByConn := range [][][]*frame.Frame{originRequestHandler.GetRequests(), targetRequestHandler.GetRequests()} {
+				inserts := 0
+				for _, requests := range requestsByConn {
+					for _, request := range requests {
+						require.False(t, request.Header.Flags.Contains(primitive.HeaderFlagCompressed), request.Header)
+						if startup, ok := request.Body.Message.(*message.Startup); ok {
+							require.Equal(t, primitive.CompressionNone, startup.GetCompression())
+						}
+						if query, ok := request.Body.Message.(*message.Query); ok && query.Query == "INSERT INTO ks1.t1 (a) VALUES (1)" {
+							inserts++
+						}
+					}
+				}
+				require.Equal(t, 1, inserts)
+			}
+		})
+	}
+}
+
+func compressionUnsupportedHandler(request *frame.Frame, _ *client.CqlServerConnection, _ client.RequestHandlerContext) *frame.Frame {
+	if startup, ok := request.Body.Message.(*message.Startup); ok && startup.GetCompression() != primitive.CompressionNone {
+		return frame.NewFrame(request.Header.Version, request.Header.StreamId,
+			&message.ProtocolError{ErrorMessage: fmt.Sprintf("Unsupported compression %v", startup.GetCompression())})
+	}
+	return nil
+}
+
+func insertHandler(request *frame.Frame, _ *client.CqlServerConnection, _ client.RequestHandlerContext) *frame.Frame {
+	if _, ok := request.Body.Message.(*message.Query); ok {
+		return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.VoidResult{})
+	}
+	return nil
+}
+
+// The proxy doesn't compress segments so a v5 STARTUP request that negotiates compression is rejected instead of being
+// forwarded, even if the compression bridge is enabled.
+func TestCompressionRejectedWithProtocolV5(t *testing.T) {
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	conf.ProtocolV5Enabled = true
+	conf.OriginCompressionBridgeEnabled = true
+	conf.TargetCompressionBridgeEnabled = true
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	originRequestHandler := NewFakeRequestHandler()
+	targetRequestHandler := NewFakeRequestHandler()
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		originRequestHandler.HandleRequest, client.RegisterHandler, client.HeartbeatHandler, client.HandshakeHandler,
+		client.NewSystemTablesHandler("cluster1", "dc1"), insertHandler}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		targetRequestHandler.HandleRequest, client.RegisterHandler, client.HeartbeatHandler, client.HandshakeHandler,
+		client.NewSystemTablesHandler("cluster2", "dc2"), insertHandler}
+
+	err = testSetup.Start(conf, false, primitive.ProtocolVersion5)
+	require.Nil(t, err)
+
+	testClient := client.NewCqlClient(
+		fmt.Sprintf("%s:%d", conf.ProxyListenAddress, conf.ProxyListenPort),
+		&client.AuthCredentials{Username: conf.OriginUsername, Password: conf.OriginPassword})
+	testClient.Compression = primitive.CompressionLz4
+	_, err = testClient.ConnectAndInit(context.Background(), primitive.ProtocolVersion5, 0)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "Compression LZ4 is not supported by the proxy with protocol version ProtocolVersion OSS 5")
+
+	// the client can connect without compression
+	testClient.Compression = primitive.CompressionNone
+	cqlConn, err := testClient.ConnectAndInit(context.Background(), primitive.ProtocolVersion5, 0)
+	require.Nil(t, err)
+	defer cqlConn.Close()
+	response, err := cqlConn.SendAndReceive(
+		frame.NewFrame(primitive.ProtocolVersion5, 0, &message.Query{Query: "INSERT INTO ks1.t1 (a) VALUES (1)"}))
+	require.Nil(t, err)
+	require.IsType(t, &message.VoidResult{}, response.Body.Message)
+
+	for _, requestsByConn := range [][][]*frame.Frame{originRequestHandler.GetRequests(), targetRequestHandler.GetRequests()} {
+		for _, requests := range requestsByConn {
+			for _, request := range requests {
+				if startup, ok := request.Body.Message.(*message.Startup); ok {
+					require.Equal(t, primitive.CompressionNone, startup.GetCompression())
+				}
+			}
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	client2 "github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
 	"github.com/datastax/go-cassandra-native-protocol/frame"
 	"github.com/datastax/go-cassandra-native-protocol/message"
 	"github.com/datastax/go-cassandra-native-protocol/primitive"
@@ -14,8 +15,10 @@ import (
 	"github.com/rs/zerolog"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestGoCqlConnect(t *testing.T) {
@@ -80,6 +83,51 @@ func TestMaxClientsThreshold(t *testing.T) {
 	require.FailNow(t, "Expected failure in last session connection but it was successful.")
 }
 
+func TestMaxClientsPerIpThreshold(t *testing.T) {
+	maxClientsPerIp := 3
+	cfg := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	cfg.ProxyMaxClientConnectionsPerIp = maxClientsPerIp
+	testSetup, err := setup.NewCqlServerTestSetup(t, cfg, true, true, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	testClient := client2.NewCqlClient("127.0.0.1:14002", &client2.AuthCredentials{
+		Username: cfg.TargetUsername,
+		Password: cfg.TargetPassword,
+	})
+	var conns []*client2.CqlClientConnection
+	defer func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+	for i := 0; i < maxClientsPerIp; i++ {
+		cqlConn, err := testClient.ConnectAndInit(context.Background(), primitive.ProtocolVersion4, 0)
+		require.Nil(t, err)
+		conns = append(conns, cqlConn)
+	}
+
+	// all the following connections from the same IP are closed by the proxy right after being accepted
+	for i := 0; i < 5; i++ {
+		cqlConn, err := testClient.ConnectAndInit(context.Background(), primitive.ProtocolVersion4, 0)
+		if err == nil {
+			_ = cqlConn.Close()
+		}
+		require.NotNil(t, err)
+	}
+
+	// closing a connection allows a new one from the same IP
+	require.Nil(t, conns[0].Close())
+	require.Eventually(t, func() bool {
+		cqlConn, err := testClient.ConnectAndInit(context.Background(), primitive.ProtocolVersion4, 0)
+		if err != nil {
+			return false
+		}
+		conns = append(conns, cqlConn)
+		return true
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
 func TestRequestedProtocolVersionUnsupportedByProxy(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -250,3 +298,197 @@ func createFrameWithUnsupportedVersion(version primitive.ProtocolVersion, stream
 	encoded[1] = 0
 	return encoded, nil
 }
+
+func TestClientHandshakeTimeout(t *testing.T) {
+	cfg := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	cfg.ClientHandshakeTimeoutMs = 500
+	testSetup, err := setup.NewCqlServerTestSetup(t, cfg, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	testSetup.Origin.CqlServer.RequestHandlers = []client2.RequestHandler{client2.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {})}
+	testSetup.Target.CqlServer.RequestHandlers = []client2.RequestHandler{client2.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {})}
+
+	err = testSetup.Start(cfg, false, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	testClient := client2.NewCqlClient("127.0.0.1:14002", nil)
+	cqlConn, err := testClient.Connect(context.Background())
+	require.Nil(t, err)
+	defer cqlConn.Close()
+
+	// client stalls after the first step of the handshake and never sends the AUTH_RESPONSE
+	rsp, err := cqlConn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 0, message.NewStartup()))
+	require.Nil(t, err)
+	require.IsType(t, &message.Authenticate{}, rsp.Body.Message)
+	require.False(t, cqlConn.IsClosed())
+
+	require.Eventually(t, cqlConn.IsClosed, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestClientAuthIdleTimeout(t *testing.T) {
+	cfg := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	cfg.ClientHandshakeTimeoutMs = 60000
+	cfg.ClientAuthIdleTimeoutMs = 500
+	testSetup, err := setup.NewCqlServerTestSetup(t, cfg, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	testSetup.Origin.CqlServer.RequestHandlers = []client2.RequestHandler{client2.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {})}
+	testSetup.Target.CqlServer.RequestHandlers = []client2.RequestHandler{client2.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {})}
+
+	err = testSetup.Start(cfg, false, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	testClient := client2.NewCqlClient("127.0.0.1:14002", nil)
+	cqlConn, err := testClient.Connect(context.Background())
+	require.Nil(t, err)
+	defer cqlConn.Close()
+
+	// client receives AUTHENTICATE and stalls, the connection is closed long before the handshake timeout
+	rsp, err := cqlConn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 0, message.NewStartup()))
+	require.Nil(t, err)
+	require.IsType(t, &message.Authenticate{}, rsp.Body.Message)
+	require.False(t, cqlConn.IsClosed())
+
+	require.Eventually(t, cqlConn.IsClosed, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestClientResetDuringTargetHandshake(t *testing.T) {
+	cfg := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	cfg.MaxConcurrentHandshakes = 1
+	cfg.HandshakeQueueTimeoutMs = 5000
+	// the target handshake would be stuck for this long if the client disconnect was not observed
+	cfg.ProxyRequestTimeoutMs = 60000
+	testSetup, err := setup.NewCqlServerTestSetup(t, cfg, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	// once armed, target doesn't respond to the first AUTH_RESPONSE until the test ends
+	armed := int32(0)
+	targetAuthResponses := make(chan bool, 1)
+	release := make(chan bool)
+	defer close(release)
+	stalledAuthResponseHandler := func(request *frame.Frame, _ *client2.CqlServerConnection, _ client2.RequestHandlerContext) *frame.Frame {
+		if request.Header.OpCode == primitive.OpCodeAuthResponse && atomic.CompareAndSwapInt32(&armed, 1, 2) {
+			targetAuthResponses <- true
+			<-release
+		}
+		return nil
+	}
+	testSetup.Origin.CqlServer.RequestHandlers = []client2.RequestHandler{
+		client2.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {})}
+	testSetup.Target.CqlServer.RequestHandlers = []client2.RequestHandler{
+		stalledAuthResponseHandler, client2.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {})}
+
+	err = testSetup.Start(cfg, false, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+	atomic.StoreInt32(&armed, 1)
+
+	testClient := client2.NewCqlClient("127.0.0.1:14002", nil)
+	cqlConn, err := testClient.Connect(context.Background())
+	require.Nil(t, err)
+
+	rsp, err := cqlConn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 0, message.NewStartup()))
+	require.Nil(t, err)
+	require.IsType(t, &message.Authenticate{}, rsp.Body.Message)
+
+	// ORIGIN accepts the credentials and the proxy starts the TARGET handshake which never completes
+	creds := &client2.AuthCredentials{Username: cfg.OriginUsername, Password: cfg.OriginPassword}
+	_, err = cqlConn.Send(frame.NewFrame(primitive.ProtocolVersion4, 0, &message.AuthResponse{Token: creds.Marshal()}))
+	require.Nil(t, err)
+	select {
+	case <-targetAuthResponses:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "target handshake did not start")
+	}
+
+	require.Nil(t, cqlConn.Close())
+
+	// the handshake slot is only released once the aborted handshake has been cleaned up
+	authClient := client2.NewCqlClient("127.0.0.1:14002", creds)
+	start := time.Now()
+	otherConn, err := authClient.ConnectAndInit(context.Background(), primitive.ProtocolVersion4, 0)
+	require.Nil(t, err)
+	defer otherConn.Close()
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestAuthResponseWithoutAuthenticate(t *testing.T) {
+	cfg := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	testSetup, err := setup.NewCqlServerTestSetup(t, cfg, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	authResponses := int32(0)
+	authResponseCounter := func(request *frame.Frame, _ *client2.CqlServerConnection, _ client2.RequestHandlerContext) *frame.Frame {
+		if request.Header.OpCode == primitive.OpCodeAuthResponse {
+			atomic.AddInt32(&authResponses, 1)
+		}
+		return nil
+	}
+	testSetup.Origin.CqlServer.RequestHandlers = []client2.RequestHandler{
+		authResponseCounter, client2.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {})}
+	testSetup.Target.CqlServer.RequestHandlers = []client2.RequestHandler{
+		authResponseCounter, client2.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {})}
+
+	err = testSetup.Start(cfg, false, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	testClient := client2.NewCqlClient("127.0.0.1:14002", nil)
+	cqlConn, err := testClient.Connect(context.Background())
+	require.Nil(t, err)
+	defer cqlConn.Close()
+
+	// the proxy sends AUTH_RESPONSE to the clusters when it opens its own connections
+	authResponsesBefore := atomic.LoadInt32(&authResponses)
+
+	// client sends AUTH_RESPONSE before STARTUP
+	rsp, err := cqlConn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 0, &message.AuthResponse{Token: []byte("token")}))
+	require.Nil(t, err)
+	protocolErr, ok := rsp.Body.Message.(*message.ProtocolError)
+	require.True(t, ok, rsp.Body.Message)
+	require.Contains(t, protocolErr.ErrorMessage, "Unexpected AUTH_RESPONSE")
+	require.Equal(t, authResponsesBefore, atomic.LoadInt32(&authResponses))
+}
+
+func TestProtocolV5Framing(t *testing.T) {
+	cfg := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	cfg.ProtocolV5Enabled = true
+	testSetup, err := setup.NewCqlServerTestSetup(t, cfg, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	queryHandler := func(request *frame.Frame, _ *client2.CqlServerConnection, _ client2.RequestHandlerContext) *frame.Frame {
+		query, ok := request.Body.Message.(*message.Query)
+		if !ok {
+			return nil
+		}
+		return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.RowsResult{
+			Metadata: &message.RowsMetadata{
+				ColumnCount: 1,
+				Columns: []*message.ColumnMetadata{
+					{Keyspace: "ks1", Table: "tb1", Name: "query", Index: 0, Type: datatype.Varchar},
+				},
+			},
+			Data: message.RowSet{{[]byte(query.Query)}},
+		})
+	}
+	testSetup.Origin.CqlServer.RequestHandlers = []client2.RequestHandler{
+		client2.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}), queryHandler}
+	testSetup.Target.CqlServer.RequestHandlers = []client2.RequestHandler{
+		client2.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}), queryHandler}
+
+	err = testSetup.Start(cfg, true, primitive.ProtocolVersion5)
+	require.Nil(t, err)
+
+	for _, query := range []string{"SELECT * FROM ks1.tb1", "SELECT * FROM ks1.tb1 WHERE key = '" + strings.Repeat("a", 1000) + "'"} {
+		response, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+			primitive.ProtocolVersion5, client2.ManagedStreamId, &message.Query{Query: query}))
+		require.Nil(t, err)
+		require.Equal(t, primitive.ProtocolVersion5, response.Header.Version)
+		rowsResult, ok := response.Body.Message.(*message.RowsResult)
+		require.True(t, ok, response.Body.Message)
+		require.Equal(t, []byte(query), rowsResult.Data[0][0])
+	}
+}
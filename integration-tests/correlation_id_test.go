@@ -0,0 +1,65 @@
+package integration_tests
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestRequestCorrelationIdInLogs(t *testing.T) {
+	oldLevel := log.GetLevel()
+	log.SetLevel(log.TraceLevel)
+	defer log.SetLevel(oldLevel)
+
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}), insertHandler}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}), insertHandler}
+
+	err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	correlationIds := make([]interface{}, 0)
+	for i := 0; i < 2; i++ {
+		hook.Reset()
+		query := frame.NewFrame(primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: "INSERT INTO ks.t (a) VALUES (1)"})
+		response, err := testSetup.Client.CqlConnection.SendAndReceive(query)
+		require.Nil(t, err)
+		require.IsType(t, &message.VoidResult{}, response.Body.Message)
+
+		var correlationId interface{}
+		var messages []string
+		for _, entry := range hook.AllEntries() {
+			id, ok := entry.Data["correlation_id"]
+			if !ok {
+				continue
+			}
+			if correlationId == nil {
+				correlationId = id
+			}
+			require.Equal(t, correlationId, id, entry.Message)
+			messages = append(messages, entry.Message)
+		}
+
+		allMessages := strings.Join(messages, "\n")
+		require.Contains(t, allMessages, "Request frame")
+		require.Contains(t, allMessages, "Forwarding request")
+		require.Contains(t, allMessages, "Aggregating responses")
+		correlationIds = append(correlationIds, correlationId)
+	}
+	require.NotEqual(t, correlationIds[0], correlationIds[1])
+}
@@ -0,0 +1,147 @@
+package integration_tests
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCustomPayloadRoundTrip(t *testing.T) {
+	requestPayload := map[string][]byte{"request_key": []byte("request_value")}
+
+	tests := []struct {
+		name                    string
+		primaryCluster          string
+		replaceCqlFunctions     bool
+		query                   string
+		expectedOnOrigin        bool
+		expectedOnTarget        bool
+		expectedResponsePayload map[string][]byte
+	}{
+		{
+			name:                    "write, origin primary",
+			primaryCluster:          config.PrimaryClusterOrigin,
+			query:                   "INSERT INTO ks.t (a) VALUES (1)",
+			expectedOnOrigin:        true,
+			expectedOnTarget:        true,
+			expectedResponsePayload: map[string][]byte{"from": []byte("origin")},
+		},
+		{
+			name:                    "write, target primary, origin payload is preferred",
+			primaryCluster:          config.PrimaryClusterTarget,
+			query:                   "INSERT INTO ks.t (a) VALUES (1)",
+			expectedOnOrigin:        true,
+			expectedOnTarget:        true,
+			expectedResponsePayload: map[string][]byte{"from": []byte("origin")},
+		},
+		{
+			name:                    "write modified by the proxy",
+			primaryCluster:          config.PrimaryClusterOrigin,
+			replaceCqlFunctions:     true,
+			query:                   "INSERT INTO ks.t (a, b) VALUES (1, now())",
+			expectedOnOrigin:        true,
+			expectedOnTarget:        true,
+			expectedResponsePayload: map[string][]byte{"from": []byte("origin")},
+		},
+		{
+			name:                    "read, origin primary",
+			primaryCluster:          config.PrimaryClusterOrigin,
+			query:                   "SELECT * FROM ks.t",
+			expectedOnOrigin:        true,
+			expectedOnTarget:        false,
+			expectedResponsePayload: map[string][]byte{"from": []byte("origin")},
+		},
+		{
+			name:                    "read, target primary",
+			primaryCluster:          config.PrimaryClusterTarget,
+			query:                   "SELECT * FROM ks.t",
+			expectedOnOrigin:        false,
+			expectedOnTarget:        true,
+			expectedResponsePayload: map[string][]byte{"from": []byte("target")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+			conf.PrimaryCluster = tt.primaryCluster
+			conf.ReplaceCqlFunctions = tt.replaceCqlFunctions
+			testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+			require.Nil(t, err)
+			defer testSetup.Cleanup()
+
+			originRecorder := &customPayloadRecorder{}
+			targetRecorder := &customPayloadRecorder{}
+			testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.RegisterHandler, client.HeartbeatHandler, client.HandshakeHandler,
+				client.NewSystemTablesHandler("cluster1", "dc1"), originRecorder.newHandler("origin")}
+			testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.RegisterHandler, client.HeartbeatHandler, client.HandshakeHandler,
+				client.NewSystemTablesHandler("cluster2", "dc2"), targetRecorder.newHandler("target")}
+
+			err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+			require.Nil(t, err)
+
+			request := frame.NewFrame(primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: tt.query})
+			request.SetCustomPayload(requestPayload)
+			response, err := testSetup.Client.CqlConnection.SendAndReceive(request)
+			require.Nil(t, err)
+			require.Equal(t, primitive.OpCodeResult, response.Header.OpCode)
+			require.True(t, response.Header.Flags.Contains(primitive.HeaderFlagCustomPayload))
+			require.Equal(t, tt.expectedResponsePayload, response.Body.CustomPayload)
+
+			if tt.expectedOnOrigin {
+				require.Equal(t, []map[string][]byte{requestPayload}, originRecorder.get())
+			} else {
+				require.Empty(t, originRecorder.get())
+			}
+			if tt.expectedOnTarget {
+				require.Equal(t, []map[string][]byte{requestPayload}, targetRecorder.get())
+			} else {
+				require.Empty(t, targetRecorder.get())
+			}
+		})
+	}
+}
+
+type customPayloadRecorder struct {
+	lock     sync.Mutex
+	payloads []map[string][]byte
+}
+
+func (recv *customPayloadRecorder) get() []map[string][]byte {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	return recv.payloads
+}
+
+func (recv *customPayloadRecorder) newHandler(from string) client.RequestHandler {
+	return func(request *frame.Frame, _ *client.CqlServerConnection, _ client.RequestHandlerContext) (response *frame.Frame) {
+		query, ok := request.Body.Message.(*message.Query)
+		if !ok || !strings.HasPrefix(query.Query, "INSERT") && !strings.HasPrefix(query.Query, "SELECT") {
+			return nil
+		}
+
+		recv.lock.Lock()
+		recv.payloads = append(recv.payloads, request.Body.CustomPayload)
+		recv.lock.Unlock()
+
+		var result message.Message = &message.VoidResult{}
+		if strings.HasPrefix(query.Query, "SELECT") {
+			result = &message.RowsResult{
+				Metadata: &message.RowsMetadata{ColumnCount: 1},
+				Data:     message.RowSet{message.Row{message.Column{0, 0, 0, 4, 1, 2, 3, 4}}},
+			}
+		}
+		response = frame.NewFrame(request.Header.Version, request.Header.StreamId, result)
+		response.SetCustomPayload(map[string][]byte{"from": []byte(from)})
+		return response
+	}
+}
@@ -0,0 +1,93 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/cqlserver"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/datastax/zdm-proxy/proxy/pkg/admin"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/zdmproxy"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCutoverAppliesToExistingAndNewConnections(t *testing.T) {
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	conf.PrimaryCluster = config.PrimaryClusterOrigin
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	originRecorder := &customPayloadRecorder{}
+	targetRecorder := &customPayloadRecorder{}
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.RegisterHandler, client.HeartbeatHandler, client.HandshakeHandler,
+		client.NewSystemTablesHandler("cluster1", "dc1"), originRecorder.newHandler("origin")}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.RegisterHandler, client.HeartbeatHandler, client.HandshakeHandler,
+		client.NewSystemTablesHandler("cluster2", "dc2"), targetRecorder.newHandler("target")}
+
+	err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	selectQuery := frame.NewFrame(primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: "SELECT * FROM ks.t"})
+	_, err = testSetup.Client.CqlConnection.SendAndReceive(selectQuery)
+	require.Nil(t, err)
+	require.Len(t, originRecorder.get(), 1)
+	require.Len(t, targetRecorder.get(), 0)
+
+	// POST is not served unless ZDM_ADMIN_WRITE_ENABLED is set
+	rsp := httptest.NewRecorder()
+	admin.Handler(testSetup.Proxy).ServeHTTP(rsp, httptest.NewRequest(http.MethodPost, "/admin/cutover",
+		strings.NewReader(`{"PrimaryCluster": "TARGET"}`)))
+	require.Equal(t, http.StatusNotFound, rsp.Code)
+	require.Equal(t, &zdmproxy.CutoverState{PrimaryCluster: common.ClusterTypeOrigin, ReadMode: common.ReadModePrimaryOnly},
+		testSetup.Proxy.GetCutoverState())
+
+	testSetup.Proxy.Conf.AdminWriteEnabled = true
+	cutoverHandler := admin.Handler(testSetup.Proxy)
+	rsp = httptest.NewRecorder()
+	cutoverHandler.ServeHTTP(rsp, httptest.NewRequest(http.MethodPost, "/admin/cutover",
+		strings.NewReader(`{"PrimaryCluster": "TARGET"}`)))
+	require.Equal(t, http.StatusOK, rsp.Code)
+	report := &admin.CutoverReport{}
+	require.Nil(t, json.Unmarshal(rsp.Body.Bytes(), report))
+	require.Equal(t, &admin.CutoverStateReport{PrimaryCluster: config.PrimaryClusterOrigin, ReadMode: config.ReadModePrimaryOnly}, report.Previous)
+	require.Equal(t, &admin.CutoverStateReport{PrimaryCluster: config.PrimaryClusterTarget, ReadMode: config.ReadModePrimaryOnly}, report.Current)
+
+	rsp = httptest.NewRecorder()
+	cutoverHandler.ServeHTTP(rsp, httptest.NewRequest(http.MethodPost, "/admin/cutover",
+		strings.NewReader(`{"PrimaryCluster": "NEITHER"}`)))
+	require.Equal(t, http.StatusBadRequest, rsp.Code)
+
+	rsp = httptest.NewRecorder()
+	cutoverHandler.ServeHTTP(rsp, httptest.NewRequest(http.MethodGet, "/admin/cutover", nil))
+	require.Equal(t, http.StatusOK, rsp.Code)
+	state := &admin.CutoverStateReport{}
+	require.Nil(t, json.Unmarshal(rsp.Body.Bytes(), state))
+	require.Equal(t, &admin.CutoverStateReport{PrimaryCluster: config.PrimaryClusterTarget, ReadMode: config.ReadModePrimaryOnly}, state)
+
+	// the next read of the existing connection is routed to the new primary cluster
+	_, err = testSetup.Client.CqlConnection.SendAndReceive(selectQuery)
+	require.Nil(t, err)
+	require.Len(t, originRecorder.get(), 1)
+	require.Len(t, targetRecorder.get(), 1)
+
+	newClient, err := cqlserver.NewCqlClient(conf.ProxyListenAddress, conf.ProxyListenPort, conf.OriginUsername, conf.OriginPassword, false)
+	require.Nil(t, err)
+	require.Nil(t, newClient.Connect(primitive.ProtocolVersion4))
+	defer newClient.Close()
+
+	_, err = newClient.CqlConnection.SendAndReceive(selectQuery)
+	require.Nil(t, err)
+	require.Len(t, originRecorder.get(), 1)
+	require.Len(t, targetRecorder.get(), 2)
+}
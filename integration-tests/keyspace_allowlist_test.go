@@ -0,0 +1,55 @@
+package integration_tests
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestKeyspaceAllowlist(t *testing.T) {
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	conf.KeyspaceAllowlist = "ks1"
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	originRecorder := &customPayloadRecorder{}
+	targetRecorder := &customPayloadRecorder{}
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}), originRecorder.newHandler("origin")}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}), targetRecorder.newHandler("target")}
+
+	err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	sendQuery := func(query string) *frame.Frame {
+		response, err := testSetup.Client.CqlConnection.SendAndReceive(
+			frame.NewFrame(primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: query}))
+		require.Nil(t, err)
+		return response
+	}
+
+	response := sendQuery("INSERT INTO ks1.t (a) VALUES (1)")
+	require.IsType(t, &message.VoidResult{}, response.Body.Message)
+
+	response = sendQuery("INSERT INTO ks2.t (a) VALUES (1)")
+	require.IsType(t, &message.Unauthorized{}, response.Body.Message)
+
+	response = sendQuery("USE ks2")
+	require.IsType(t, &message.Unauthorized{}, response.Body.Message)
+
+	response = sendQuery("USE ks1")
+	require.IsType(t, &message.SetKeyspaceResult{}, response.Body.Message)
+
+	response = sendQuery("SELECT * FROM t")
+	require.IsType(t, &message.RowsResult{}, response.Body.Message)
+
+	// rejected requests are not forwarded
+	require.Len(t, originRecorder.get(), 2)
+	require.Len(t, targetRecorder.get(), 1)
+}
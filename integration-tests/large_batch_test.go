@@ -0,0 +1,77 @@
+package integration_tests
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLargeBatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		mode           string
+		expectRejected bool
+	}{
+		{"warn", config.LargeBatchModeWarn, false},
+		{"reject", config.LargeBatchModeReject, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+			conf.BatchMaxStatements = 3
+			conf.LargeBatchMode = tt.mode
+			testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+			require.Nil(t, err)
+			defer testSetup.Cleanup()
+
+			originBatches := int32(0)
+			targetBatches := int32(0)
+			testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+				newBatchHandler(&originBatches)}
+			testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}),
+				newBatchHandler(&targetBatches)}
+
+			err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+			require.Nil(t, err)
+
+			children := make([]*message.BatchChild, 0)
+			for i := 0; i < 5; i++ {
+				children = append(children, &message.BatchChild{QueryOrId: "INSERT INTO ks1.tb1 (key, value) VALUES ('key', 'value')"})
+			}
+			response, err := testSetup.Client.CqlConnection.SendAndReceive(
+				frame.NewFrame(primitive.ProtocolVersion4, 10, &message.Batch{Children: children}))
+			require.Nil(t, err)
+
+			if tt.expectRejected {
+				invalid, ok := response.Body.Message.(*message.Invalid)
+				require.True(t, ok, "expected INVALID but got %v", response.Body.Message)
+				require.Contains(t, invalid.ErrorMessage, "Batch too large")
+				require.Equal(t, int32(0), atomic.LoadInt32(&originBatches))
+				require.Equal(t, int32(0), atomic.LoadInt32(&targetBatches))
+			} else {
+				require.IsType(t, &message.VoidResult{}, response.Body.Message)
+				require.Equal(t, int32(1), atomic.LoadInt32(&originBatches))
+				require.Equal(t, int32(1), atomic.LoadInt32(&targetBatches))
+			}
+		})
+	}
+}
+
+func newBatchHandler(batches *int32) client.RequestHandler {
+	return func(request *frame.Frame, _ *client.CqlServerConnection, _ client.RequestHandlerContext) *frame.Frame {
+		if _, ok := request.Body.Message.(*message.Batch); ok {
+			atomic.AddInt32(batches, 1)
+			return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.VoidResult{})
+		}
+		return nil
+	}
+}
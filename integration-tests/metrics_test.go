@@ -31,12 +31,18 @@ var nodeMetrics = []metrics.Metric{
 	metrics.OriginWriteTimeouts,
 	metrics.OriginReadTimeouts,
 	metrics.OriginUnpreparedErrors,
+	metrics.OriginUnauthorizedErrors,
+	metrics.OriginTruncateErrors,
+	metrics.OriginFunctionFailures,
 	metrics.OriginOtherErrors,
 
 	metrics.TargetClientTimeouts,
 	metrics.TargetWriteTimeouts,
 	metrics.TargetReadTimeouts,
 	metrics.TargetUnpreparedErrors,
+	metrics.TargetUnauthorizedErrors,
+	metrics.TargetTruncateErrors,
+	metrics.TargetFunctionFailures,
 	metrics.TargetOtherErrors,
 
 	metrics.OpenOriginConnections,
@@ -50,18 +56,87 @@ var proxyMetrics = []metrics.Metric{
 	metrics.FailedReadsOrigin,
 	metrics.FailedReadsTarget,
 
+	metrics.ToleratedAlreadyExistsOrigin,
+	metrics.ToleratedAlreadyExistsTarget,
+
+	metrics.BackendProtocolErrorsOrigin,
+	metrics.BackendProtocolErrorsTarget,
+
 	metrics.PSCacheSize,
 	metrics.PSCacheMissCount,
 
 	metrics.ProxyReadsTargetDuration,
 	metrics.ProxyReadsOriginDuration,
 	metrics.ProxyWritesDuration,
+	metrics.SloBreachesReadsOrigin,
+	metrics.SloBreachesReadsTarget,
+	metrics.SloBreachesWrites,
 
 	metrics.InFlightReadsTarget,
 	metrics.InFlightReadsOrigin,
 	metrics.InFlightWrites,
 
 	metrics.OpenClientConnections,
+
+	metrics.ClientConnectionsV2,
+	metrics.ClientConnectionsV3,
+	metrics.ClientConnectionsV4,
+	metrics.ClientConnectionsV5,
+	metrics.ClientConnectionsDseV1,
+	metrics.ClientConnectionsDseV2,
+
+	metrics.Cutovers,
+	metrics.LastCutoverTimestamp,
+	metrics.CutoverClientEvents,
+
+	metrics.DroppedLateResponses,
+	metrics.UnknownStreamIdResponses,
+
+	metrics.ClientHandshakeTimeouts,
+	metrics.ClientAuthIdleTimeouts,
+	metrics.UnexpectedResponses,
+	metrics.UnknownForwardDecisions,
+	metrics.RejectedClientConnections,
+	metrics.RejectedKeyspaceRequests,
+	metrics.RejectedRegisterRequests,
+	metrics.ClusterDownBufferedRequests,
+	metrics.ClusterDownRejectedRequests,
+	metrics.CqlVersionMismatches,
+	metrics.MalformedFrames,
+	metrics.WrongDirectionFrames,
+	metrics.DroppedEvents,
+	metrics.LikelyRetries,
+	metrics.AsyncReadsMaxWaitExceeded,
+	metrics.TargetUnpreparedWriteRetries,
+	metrics.UnloggedBatchPartialDivergences,
+	metrics.BatchWarningDivergences,
+	metrics.ReadMismatchesTargetExtraRows,
+	metrics.ReadMismatchesOriginExtraRows,
+	metrics.ReadMismatchesValuesDiffer,
+	metrics.ReadMismatchesMetadataOnly,
+	metrics.MismatchReports,
+	metrics.HandshakesInProgress,
+	metrics.Goroutines,
+	metrics.ClientHandlers,
+	metrics.ClientHandlerInFlightGoroutines,
+	metrics.ClientHandlerMaxInFlightGoroutines,
+	metrics.RequestQueueDepth,
+	metrics.ResponseQueueDepth,
+	metrics.EventQueueDepth,
+	metrics.OriginRequestErrorRate,
+	metrics.TargetRequestErrorRate,
+	metrics.ReadRoutingBias,
+	metrics.OriginControlConnectionsEstablished,
+	metrics.TargetControlConnectionsEstablished,
+	metrics.OriginControlConnectionAge,
+	metrics.TargetControlConnectionAge,
+
+	metrics.RequestsQuery,
+	metrics.RequestsExecute,
+	metrics.RequestsPrepare,
+	metrics.RequestsBatch,
+	metrics.RequestsRegister,
+	metrics.RequestsOther,
 }
 
 var allMetrics = append(proxyMetrics, nodeMetrics...)
@@ -139,6 +214,7 @@ func testMetrics(t *testing.T, metricsHandler *httpzdmproxy.HandlerWithFallback)
 
 			lines := gatherMetrics(t, conf, false)
 			checkMetrics(t, false, lines, conf.ReadMode, 0, 0, 0, 0, 0, 0, 0, 0, true, true, originEndpoint, targetEndpoint, asyncEndpoint)
+			require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusName("zdm", metrics.ClientConnectionsV4)))
 
 			err = testSetup.Client.Connect(primitive.ProtocolVersion4)
 			require.Nil(t, err)
@@ -162,6 +238,10 @@ func testMetrics(t *testing.T, metricsHandler *httpzdmproxy.HandlerWithFallback)
 			// 2 on async: AUTH_RESPONSE and STARTUP
 			// only QUERY is tracked
 			checkMetrics(t, true, lines, conf.ReadMode, 1, 1, 1, expectedAsyncConnections, 1, 0, 0, 0, true, true, originEndpoint, targetEndpoint, asyncEndpoint)
+			// handshake is done at this point so the negotiated protocol version is tracked
+			require.Contains(t, lines, fmt.Sprintf("%v 1", getPrometheusName("zdm", metrics.ClientConnectionsV4)))
+			require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusName("zdm", metrics.ClientConnectionsV3)))
+			require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusName("zdm", metrics.ClientConnectionsDseV2)))
 
 			_, err = clientConn.SendAndReceive(selectQuery)
 			require.Nil(t, err)
@@ -271,6 +351,7 @@ func checkMetrics(
 	asyncEnabled := readMode == config.ReadModeDualAsyncOnSecondary
 	prefix := "zdm"
 	require.Contains(t, lines, fmt.Sprintf("%v %v", getPrometheusName(prefix, metrics.OpenClientConnections), openClientConns))
+	require.Contains(t, lines, fmt.Sprintf("%v %v", getPrometheusName(prefix, metrics.ClientHandlers), openClientConns))
 
 	require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusName(prefix, metrics.FailedWritesOnBoth)))
 	require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusName(prefix, metrics.FailedWritesOnOrigin)))
@@ -335,6 +416,9 @@ func checkMetrics(
 			requireEventuallyContainsLine(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.AsyncWriteFailures, asyncHost)))
 			requireEventuallyContainsLine(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.AsyncOverloadedErrors, asyncHost)))
 			requireEventuallyContainsLine(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.AsyncUnpreparedErrors, asyncHost)))
+			requireEventuallyContainsLine(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.AsyncUnauthorizedErrors, asyncHost)))
+			requireEventuallyContainsLine(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.AsyncTruncateErrors, asyncHost)))
+			requireEventuallyContainsLine(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.AsyncFunctionFailures, asyncHost)))
 		} else {
 			require.NotContains(t, lines, fmt.Sprintf("%v", getPrometheusName(prefix, metrics.OpenAsyncConnections)))
 			require.NotContains(t, lines, fmt.Sprintf("%v", getPrometheusName(prefix, metrics.AsyncReadTimeouts)))
@@ -346,6 +430,9 @@ func checkMetrics(
 			require.NotContains(t, lines, fmt.Sprintf("%v", getPrometheusName(prefix, metrics.AsyncWriteFailures)))
 			require.NotContains(t, lines, fmt.Sprintf("%v", getPrometheusName(prefix, metrics.AsyncOverloadedErrors)))
 			require.NotContains(t, lines, fmt.Sprintf("%v", getPrometheusName(prefix, metrics.AsyncUnpreparedErrors)))
+			require.NotContains(t, lines, fmt.Sprintf("%v", getPrometheusName(prefix, metrics.AsyncUnauthorizedErrors)))
+			require.NotContains(t, lines, fmt.Sprintf("%v", getPrometheusName(prefix, metrics.AsyncTruncateErrors)))
+			require.NotContains(t, lines, fmt.Sprintf("%v", getPrometheusName(prefix, metrics.AsyncFunctionFailures)))
 		}
 
 		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.OriginReadTimeouts, originHost)))
@@ -356,6 +443,9 @@ func checkMetrics(
 		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.OriginReadFailures, originHost)))
 		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.OriginWriteFailures, originHost)))
 		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.OriginOverloadedErrors, originHost)))
+		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.OriginUnauthorizedErrors, originHost)))
+		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.OriginTruncateErrors, originHost)))
+		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.OriginFunctionFailures, originHost)))
 
 		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.TargetReadTimeouts, targetHost)))
 		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.TargetWriteTimeouts, targetHost)))
@@ -365,6 +455,9 @@ func checkMetrics(
 		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.TargetReadFailures, targetHost)))
 		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.TargetWriteFailures, targetHost)))
 		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.TargetOverloadedErrors, targetHost)))
+		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.TargetUnauthorizedErrors, targetHost)))
+		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.TargetTruncateErrors, targetHost)))
+		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.TargetFunctionFailures, targetHost)))
 
 		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.OriginUnpreparedErrors, originHost)))
 		require.Contains(t, lines, fmt.Sprintf("%v 0", getPrometheusNameWithNodeLabel(prefix, metrics.TargetUnpreparedErrors, targetHost)))
@@ -1,12 +1,15 @@
 package integration_tests
 
 import (
+	"context"
+	"fmt"
 	"github.com/datastax/go-cassandra-native-protocol/client"
 	"github.com/datastax/go-cassandra-native-protocol/frame"
 	"github.com/datastax/go-cassandra-native-protocol/message"
 	"github.com/datastax/go-cassandra-native-protocol/primitive"
 	"github.com/datastax/zdm-proxy/integration-tests/setup"
 	"github.com/stretchr/testify/require"
+	"sync/atomic"
 	"testing"
 )
 
@@ -31,6 +34,73 @@ func TestOptionsShouldComeFromTarget(t *testing.T) {
 
 }
 
+func TestOptionsCache(t *testing.T) {
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	conf.OptionsCacheEnabled = true
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	originOptions, targetOptions := new(int32), new(int32)
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.RegisterHandler, newCountingOptionsHandler(originOptions, map[string][]string{
+			"COMPRESSION": {"lz4"}, "CQL_VERSION": {"3.4.4"}}),
+		client.HandshakeHandler, client.NewSystemTablesHandler("cluster1", "dc1")}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.RegisterHandler, newCountingOptionsHandler(targetOptions, map[string][]string{
+			"COMPRESSION": {"lz4", "snappy"}, "CQL_VERSION": {"3.4.5"}}),
+		client.HandshakeHandler, client.NewSystemTablesHandler("cluster2", "dc2")}
+
+	err = testSetup.Start(conf, false, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	proxyAddress := fmt.Sprintf("%s:%d", conf.ProxyListenAddress, conf.ProxyListenPort)
+	sendOptions := func(cqlConn *client.CqlClientConnection) *message.Supported {
+		response, err := cqlConn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 0, &message.Options{}))
+		require.Nil(t, err)
+		require.IsType(t, &message.Supported{}, response.Body.Message)
+		return response.Body.Message.(*message.Supported)
+	}
+	expectedSupported := map[string][]string{"COMPRESSION": {"lz4"}, "CQL_VERSION": {"3.4.5"}}
+
+	// the first OPTIONS request is forwarded to both clusters, the following ones are served from the cache
+	var originCount, targetCount int32
+	for i := 0; i < 3; i++ {
+		cqlConn, err := client.NewCqlClient(proxyAddress, nil).Connect(context.Background())
+		require.Nil(t, err)
+		require.Equal(t, expectedSupported, sendOptions(cqlConn).Options)
+		cqlConn.Close()
+		if i == 0 {
+			// the control connections send OPTIONS requests as well
+			originCount, targetCount = atomic.LoadInt32(originOptions), atomic.LoadInt32(targetOptions)
+			require.Greater(t, originCount, int32(0))
+			require.Greater(t, targetCount, int32(0))
+		}
+	}
+	require.Equal(t, originCount, atomic.LoadInt32(originOptions))
+	require.Equal(t, targetCount, atomic.LoadInt32(targetOptions))
+
+	// OPTIONS requests that are sent after the handshake are always forwarded
+	cqlConn, err := client.NewCqlClient(
+		proxyAddress, &client.AuthCredentials{Username: conf.OriginUsername, Password: conf.OriginPassword}).
+		ConnectAndInit(context.Background(), primitive.ProtocolVersion4, 0)
+	require.Nil(t, err)
+	defer cqlConn.Close()
+	require.Equal(t, expectedSupported, sendOptions(cqlConn).Options)
+	require.Equal(t, originCount+1, atomic.LoadInt32(originOptions))
+	require.Equal(t, targetCount+1, atomic.LoadInt32(targetOptions))
+}
+
+func newCountingOptionsHandler(count *int32, options map[string][]string) client.RequestHandler {
+	return func(request *frame.Frame, _ *client.CqlServerConnection, _ client.RequestHandlerContext) *frame.Frame {
+		if _, ok := request.Body.Message.(*message.Options); ok {
+			atomic.AddInt32(count, 1)
+			return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.Supported{Options: options})
+		}
+		return nil
+	}
+}
+
 func newOptionsHandler(from string) client.RequestHandler {
 	return func(
 		request *frame.Frame,
@@ -935,6 +935,86 @@ func TestUnpreparedIdReplacement(t *testing.T) {
 	}
 }
 
+// A write that returns UNPREPARED on TARGET only is retried on TARGET after preparing the statement again
+// so the client doesn't have to retry a write that already succeeded on ORIGIN.
+func TestTargetUnpreparedWriteReprepare(t *testing.T) {
+	tests := []struct {
+		name               string
+		reprepareEnabled   bool
+		expectedUnprepared bool
+	}{
+		{name: "enabled", reprepareEnabled: true, expectedUnprepared: false},
+		{name: "disabled", reprepareEnabled: false, expectedUnprepared: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+			conf.TargetUnpreparedWriteReprepareEnabled = test.reprepareEnabled
+			testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+			require.Nil(t, err)
+			defer testSetup.Cleanup()
+
+			originPreparedId := []byte{153, 7, 36, 50, 225, 104, 157, 89, 199, 177, 239, 231, 82, 201, 142, 253}
+			targetPreparedId := []byte{162, 8, 36, 51, 225, 104, 157, 89, 199, 177, 239, 231, 82, 201, 142, 253}
+
+			originLock := &sync.Mutex{}
+			originExecuteMessages := make([]*message.Execute, 0)
+			originPrepareMessages := make([]*message.Prepare, 0)
+			targetLock := &sync.Mutex{}
+			targetExecuteMessages := make([]*message.Execute, 0)
+			targetPrepareMessages := make([]*message.Prepare, 0)
+
+			testSetup.Origin.CqlServer.RequestHandlers = []client2.RequestHandler{
+				client2.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+				NewPreparedTestHandler(originLock, &originPrepareMessages, &originExecuteMessages, &[]*message.Batch{},
+					"", originPreparedId, nil, message.Column{0, 1}, message.Column{24, 51, 2}, map[string]interface{}{}, false,
+					nil, nil, false)}
+			// target returns UNPREPARED until the statement is prepared a second time
+			testSetup.Target.CqlServer.RequestHandlers = []client2.RequestHandler{
+				client2.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}),
+				NewPreparedTestHandler(targetLock, &targetPrepareMessages, &targetExecuteMessages, &[]*message.Batch{},
+					"", targetPreparedId, nil, message.Column{2, 3, 4}, message.Column{6, 121, 23}, map[string]interface{}{}, true,
+					nil, nil, false)}
+
+			err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+			require.Nil(t, err)
+
+			prepareMsg := &message.Prepare{Query: "INSERT INTO ks1.tb1 (key, value) VALUES ('key', 'value')"}
+			prepareResp, err := testSetup.Client.CqlConnection.SendAndReceive(
+				frame.NewFrame(primitive.ProtocolVersion4, 10, prepareMsg))
+			require.Nil(t, err)
+			preparedResult, ok := prepareResp.Body.Message.(*message.PreparedResult)
+			require.True(t, ok, "prepared result was type %T", prepareResp.Body.Message)
+			require.Equal(t, originPreparedId, preparedResult.PreparedQueryId)
+
+			executeResp, err := testSetup.Client.CqlConnection.SendAndReceive(
+				frame.NewFrame(primitive.ProtocolVersion4, 20, &message.Execute{QueryId: originPreparedId, Options: &message.QueryOptions{}}))
+			require.Nil(t, err)
+
+			targetLock.Lock()
+			defer targetLock.Unlock()
+			originLock.Lock()
+			defer originLock.Unlock()
+			require.Len(t, originPrepareMessages, 1)
+			require.Len(t, originExecuteMessages, 1)
+			if test.expectedUnprepared {
+				unpreparedResult, ok := executeResp.Body.Message.(*message.Unprepared)
+				require.True(t, ok, "unprepared result was type %T", executeResp.Body.Message)
+				require.Equal(t, originPreparedId, unpreparedResult.Id)
+				require.Len(t, targetPrepareMessages, 1)
+				require.Len(t, targetExecuteMessages, 1)
+			} else {
+				require.IsType(t, &message.RowsResult{}, executeResp.Body.Message)
+				require.Len(t, targetPrepareMessages, 2)
+				require.Equal(t, prepareMsg.Query, targetPrepareMessages[1].Query)
+				require.Len(t, targetExecuteMessages, 2)
+				require.Equal(t, targetPreparedId, targetExecuteMessages[1].QueryId)
+			}
+		})
+	}
+}
+
 func NewPreparedTestHandler(
 	lock *sync.Mutex, preparedMessages *[]*message.Prepare, executeMessages *[]*message.Execute, batchMessages *[]*message.Batch,
 	batchQuery string, preparedId []byte, batchPreparedId []byte, key message.Column, value message.Column, context map[string]interface{}, unpreparedTest bool,
@@ -0,0 +1,86 @@
+package integration_tests
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPreparedStatementQuarantine(t *testing.T) {
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	conf.PsQuarantineFailureThreshold = 2
+	conf.PsQuarantineCooldownMs = 500
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	originPreparedId := []byte("origin-id")
+	targetPreparedId := []byte("target-id")
+	originExecutes := int32(0)
+	targetExecutes := int32(0)
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+		newQuarantineTestHandler(originPreparedId, &originExecutes, false)}
+	// target fails every EXECUTE, e.g. because its schema is different
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}),
+		newQuarantineTestHandler(targetPreparedId, &targetExecutes, true)}
+
+	err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	prepareResp, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+		primitive.ProtocolVersion4, 10, &message.Prepare{Query: "INSERT INTO ks1.tb1 (key, value) VALUES (?, ?)"}))
+	require.Nil(t, err)
+	require.IsType(t, &message.PreparedResult{}, prepareResp.Body.Message)
+
+	execute := func() message.Message {
+		executeResp, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+			primitive.ProtocolVersion4, 20, &message.Execute{QueryId: originPreparedId, Options: &message.QueryOptions{}}))
+		require.Nil(t, err)
+		return executeResp.Body.Message
+	}
+
+	require.IsType(t, &message.Invalid{}, execute())
+	require.IsType(t, &message.Invalid{}, execute())
+	require.Equal(t, int32(2), atomic.LoadInt32(&targetExecutes))
+
+	// the statement is quarantined so it is only forwarded to origin
+	require.IsType(t, &message.VoidResult{}, execute())
+	require.IsType(t, &message.VoidResult{}, execute())
+	require.Equal(t, int32(4), atomic.LoadInt32(&originExecutes))
+	require.Equal(t, int32(2), atomic.LoadInt32(&targetExecutes))
+
+	// the statement is forwarded to target again after the cooldown
+	time.Sleep(600 * time.Millisecond)
+	require.IsType(t, &message.Invalid{}, execute())
+	require.Equal(t, int32(5), atomic.LoadInt32(&originExecutes))
+	require.Equal(t, int32(3), atomic.LoadInt32(&targetExecutes))
+}
+
+func newQuarantineTestHandler(preparedId []byte, executes *int32, failExecutes bool) client.RequestHandler {
+	return func(request *frame.Frame, _ *client.CqlServerConnection, _ client.RequestHandlerContext) *frame.Frame {
+		switch request.Body.Message.(type) {
+		case *message.Prepare:
+			return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.PreparedResult{
+				PreparedQueryId:   preparedId,
+				VariablesMetadata: &message.VariablesMetadata{},
+				ResultMetadata:    &message.RowsMetadata{},
+			})
+		case *message.Execute:
+			atomic.AddInt32(executes, 1)
+			if failExecutes {
+				return frame.NewFrame(request.Header.Version, request.Header.StreamId,
+					&message.Invalid{ErrorMessage: "Undefined column name value"})
+			}
+			return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.VoidResult{})
+		}
+		return nil
+	}
+}
@@ -0,0 +1,122 @@
+package integration_tests
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReadFailover(t *testing.T) {
+	tests := []struct {
+		name             string
+		failoverEnabled  bool
+		originError      message.Error
+		expectedResponse message.Message
+		expectedReads    int32
+	}{
+		{
+			name:             "failover",
+			failoverEnabled:  true,
+			originError:      &message.ReadTimeout{ErrorMessage: "read timeout", Consistency: primitive.ConsistencyLevelLocalQuorum},
+			expectedResponse: &message.RowsResult{},
+			expectedReads:    2,
+		},
+		{
+			name:             "disabled",
+			failoverEnabled:  false,
+			originError:      &message.ReadTimeout{ErrorMessage: "read timeout", Consistency: primitive.ConsistencyLevelLocalQuorum},
+			expectedResponse: &message.ReadTimeout{},
+			expectedReads:    0,
+		},
+		{
+			name:             "not an availability error",
+			failoverEnabled:  true,
+			originError:      &message.Invalid{ErrorMessage: "Undefined column name value"},
+			expectedResponse: &message.Invalid{},
+			expectedReads:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+			conf.ReadFailoverEnabled = tt.failoverEnabled
+			testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+			require.Nil(t, err)
+			defer testSetup.Cleanup()
+
+			originReads := int32(0)
+			targetReads := int32(0)
+			testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+				newReadFailoverTestHandler([]byte("origin-id"), &originReads, tt.originError)}
+			testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}),
+				newReadFailoverTestHandler([]byte("target-id"), &targetReads, nil)}
+
+			err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+			require.Nil(t, err)
+
+			queryResp, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+				primitive.ProtocolVersion4, 10, &message.Query{Query: "SELECT * FROM ks1.tb1", Options: &message.QueryOptions{}}))
+			require.Nil(t, err)
+			require.IsType(t, tt.expectedResponse, queryResp.Body.Message)
+
+			prepareResp, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+				primitive.ProtocolVersion4, 20, &message.Prepare{Query: "SELECT * FROM ks1.tb1 WHERE key = ?"}))
+			require.Nil(t, err)
+			require.IsType(t, &message.PreparedResult{}, prepareResp.Body.Message)
+
+			executeResp, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+				primitive.ProtocolVersion4, 30, &message.Execute{QueryId: []byte("origin-id"), Options: &message.QueryOptions{}}))
+			require.Nil(t, err)
+			require.IsType(t, tt.expectedResponse, executeResp.Body.Message)
+
+			require.Equal(t, int32(2), atomic.LoadInt32(&originReads))
+			// the handler of target only accepts EXECUTE requests with the prepared id of target
+			require.Equal(t, tt.expectedReads, atomic.LoadInt32(&targetReads))
+		})
+	}
+}
+
+// newReadFailoverTestHandler returns a handler that responds to reads of ks1.tb1 with the provided error or
+// with an empty result if the error is nil.
+func newReadFailoverTestHandler(preparedId []byte, reads *int32, readError message.Error) client.RequestHandler {
+	return func(request *frame.Frame, _ *client.CqlServerConnection, _ client.RequestHandlerContext) *frame.Frame {
+		read := false
+		switch msg := request.Body.Message.(type) {
+		case *message.Prepare:
+			return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.PreparedResult{
+				PreparedQueryId:   preparedId,
+				VariablesMetadata: &message.VariablesMetadata{},
+				ResultMetadata:    &message.RowsMetadata{},
+			})
+		case *message.Query:
+			read = strings.Contains(msg.Query, "ks1.tb1")
+		case *message.Execute:
+			if string(msg.QueryId) != string(preparedId) {
+				return frame.NewFrame(request.Header.Version, request.Header.StreamId,
+					&message.Unprepared{ErrorMessage: "unprepared", Id: msg.QueryId})
+			}
+			read = true
+		}
+		if !read {
+			return nil
+		}
+
+		atomic.AddInt32(reads, 1)
+		if readError != nil {
+			return frame.NewFrame(request.Header.Version, request.Header.StreamId, readError)
+		}
+		return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.RowsResult{
+			Metadata: &message.RowsMetadata{},
+			Data:     message.RowSet{},
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package integration_tests
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadRace(t *testing.T) {
+	readTimeout := &message.ReadTimeout{ErrorMessage: "read timeout", Consistency: primitive.ConsistencyLevelLocalQuorum}
+	tests := []struct {
+		name             string
+		originError      message.Error
+		originDelay      time.Duration
+		targetError      message.Error
+		targetDelay      time.Duration
+		expectedResponse message.Message
+	}{
+		{
+			name:             "faster cluster fails",
+			originError:      readTimeout,
+			targetDelay:      200 * time.Millisecond,
+			expectedResponse: &message.RowsResult{},
+		},
+		{
+			name:             "faster cluster succeeds",
+			originDelay:      200 * time.Millisecond,
+			expectedResponse: &message.RowsResult{},
+		},
+		{
+			name:             "both clusters fail",
+			originError:      readTimeout,
+			targetError:      &message.Unavailable{ErrorMessage: "unavailable", Consistency: primitive.ConsistencyLevelLocalQuorum},
+			expectedResponse: &message.ReadTimeout{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+			conf.ReadRaceEnabled = true
+			testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+			require.Nil(t, err)
+			defer testSetup.Cleanup()
+
+			originReads := int32(0)
+			targetReads := int32(0)
+			testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+				newDelayedReadTestHandler(tt.originDelay, newReadFailoverTestHandler([]byte("origin-id"), &originReads, tt.originError))}
+			testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}),
+				newDelayedReadTestHandler(tt.targetDelay, newReadFailoverTestHandler([]byte("target-id"), &targetReads, tt.targetError))}
+
+			err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+			require.Nil(t, err)
+
+			// the same stream id is reused right away, before the slower cluster responded to the previous read
+			for i := 0; i < 2; i++ {
+				queryResp, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+					primitive.ProtocolVersion4, 10, &message.Query{Query: "SELECT * FROM ks1.tb1", Options: &message.QueryOptions{}}))
+				require.Nil(t, err)
+				require.IsType(t, tt.expectedResponse, queryResp.Body.Message)
+			}
+
+			prepareResp, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+				primitive.ProtocolVersion4, 20, &message.Prepare{Query: "SELECT * FROM ks1.tb1 WHERE key = ?"}))
+			require.Nil(t, err)
+			require.IsType(t, &message.PreparedResult{}, prepareResp.Body.Message)
+
+			executeResp, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+				primitive.ProtocolVersion4, 30, &message.Execute{QueryId: []byte("origin-id"), Options: &message.QueryOptions{}}))
+			require.Nil(t, err)
+			require.IsType(t, tt.expectedResponse, executeResp.Body.Message)
+
+			require.Eventually(t, func() bool {
+				return atomic.LoadInt32(&originReads) == 3 && atomic.LoadInt32(&targetReads) == 3
+			}, 5*time.Second, 50*time.Millisecond)
+		})
+	}
+}
+
+// newDelayedReadTestHandler returns a handler that delays the responses of the provided handler.
+func newDelayedReadTestHandler(delay time.Duration, handler client.RequestHandler) client.RequestHandler {
+	return func(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+		response := handler(request, conn, ctx)
+		if response != nil && delay > 0 {
+			time.Sleep(delay)
+		}
+		return response
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/datastax/zdm-proxy/proxy/pkg/httpzdmproxy"
 	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
 	"github.com/datastax/zdm-proxy/proxy/pkg/runner"
+	"github.com/datastax/zdm-proxy/proxy/pkg/zdmproxy"
 	"github.com/stretchr/testify/require"
 	"net/http"
 	"sync"
@@ -23,7 +24,7 @@ they are registered separately on the parent test.
 */
 
 func TestWithHttpHandlers(t *testing.T) {
-	metricsHandler, readinessHandler := runner.SetupHandlers()
+	metricsHandler, readinessHandler, adminHandler := runner.SetupHandlers()
 
 	t.Run("testMetrics", func(t *testing.T) {
 		testMetrics(t, metricsHandler)
@@ -32,20 +33,21 @@ func TestWithHttpHandlers(t *testing.T) {
 	metricsHandler.SetHandler(metrics.DefaultHttpHandler())
 
 	t.Run("testHttpEndpointsWithProxyNotInitialized", func(t *testing.T) {
-		testHttpEndpointsWithProxyNotInitialized(t, metricsHandler, readinessHandler)
+		testHttpEndpointsWithProxyNotInitialized(t, metricsHandler, readinessHandler, adminHandler)
 	})
 
 	t.Run("testHttpEndpointsWithProxyInitialized", func(t *testing.T) {
-		testHttpEndpointsWithProxyInitialized(t, metricsHandler, readinessHandler)
+		testHttpEndpointsWithProxyInitialized(t, metricsHandler, readinessHandler, adminHandler)
 	})
 
 	t.Run("testHttpEndpointsWithUnavailableNode", func(t *testing.T) {
-		testHttpEndpointsWithUnavailableNode(t, metricsHandler, readinessHandler)
+		testHttpEndpointsWithUnavailableNode(t, metricsHandler, readinessHandler, adminHandler)
 	})
 }
 
 func testHttpEndpointsWithProxyNotInitialized(
-	t *testing.T, metricsHandler *httpzdmproxy.HandlerWithFallback, healthHandler *httpzdmproxy.HandlerWithFallback) {
+	t *testing.T, metricsHandler *httpzdmproxy.HandlerWithFallback, healthHandler *httpzdmproxy.HandlerWithFallback,
+	adminHandler *httpzdmproxy.HandlerWithFallback) {
 
 	simulacronSetup, err := setup.NewSimulacronTestSetupWithSession(t, false, false)
 	require.Nil(t, err)
@@ -69,7 +71,7 @@ func testHttpEndpointsWithProxyNotInitialized(
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		runner.RunMain(conf, ctx, metricsHandler, healthHandler)
+		runner.RunMain(conf, ctx, metricsHandler, healthHandler, adminHandler)
 	}()
 
 	time.Sleep(500 * time.Millisecond)
@@ -83,11 +85,13 @@ func testHttpEndpointsWithProxyNotInitialized(
 	require.Nil(t, err, "failed to get readiness response: %v", err)
 	require.Nil(t, report.OriginStatus)
 	require.Nil(t, report.TargetStatus)
+	require.Nil(t, report.DualWriteAgreement)
 	require.Equal(t, health.STARTUP, report.Status)
 }
 
 func testHttpEndpointsWithProxyInitialized(
-	t *testing.T, metricsHandler *httpzdmproxy.HandlerWithFallback, healthHandler *httpzdmproxy.HandlerWithFallback) {
+	t *testing.T, metricsHandler *httpzdmproxy.HandlerWithFallback, healthHandler *httpzdmproxy.HandlerWithFallback,
+	adminHandler *httpzdmproxy.HandlerWithFallback) {
 
 	simulacronSetup, err := setup.NewSimulacronTestSetupWithSession(t, false, false)
 	require.Nil(t, err)
@@ -106,7 +110,7 @@ func testHttpEndpointsWithProxyInitialized(
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		runner.RunMain(conf, ctx, metricsHandler, healthHandler)
+		runner.RunMain(conf, ctx, metricsHandler, healthHandler, adminHandler)
 	}()
 
 	httpAddr := fmt.Sprintf("%s:%d", conf.MetricsAddress, conf.MetricsPort)
@@ -126,19 +130,23 @@ func testHttpEndpointsWithProxyInitialized(
 		Addr:                  fmt.Sprintf("%s:%d", simulacronSetup.Origin.GetInitialContactPoint(), 9042),
 		CurrentFailureCount:   0,
 		FailureCountThreshold: conf.HeartbeatFailureThreshold,
+		FailureGracePeriodMs:  conf.HeartbeatFailureGracePeriodMs,
 		Status:                health.UP,
 	}, report.OriginStatus)
 	require.Equal(t, &health.ControlConnStatus{
 		Addr:                  fmt.Sprintf("%s:%d", simulacronSetup.Target.GetInitialContactPoint(), 9042),
 		CurrentFailureCount:   0,
 		FailureCountThreshold: conf.HeartbeatFailureThreshold,
+		FailureGracePeriodMs:  conf.HeartbeatFailureGracePeriodMs,
 		Status:                health.UP,
 	}, report.TargetStatus)
+	require.Equal(t, &zdmproxy.DualWriteAgreement{WindowMs: conf.MetricsDualWriteAgreementWindowMs}, report.DualWriteAgreement)
 	require.Equal(t, health.UP, report.Status)
 }
 
 func testHttpEndpointsWithUnavailableNode(
-	t *testing.T, metricsHandler *httpzdmproxy.HandlerWithFallback, healthHandler *httpzdmproxy.HandlerWithFallback) {
+	t *testing.T, metricsHandler *httpzdmproxy.HandlerWithFallback, healthHandler *httpzdmproxy.HandlerWithFallback,
+	adminHandler *httpzdmproxy.HandlerWithFallback) {
 
 	simulacronSetup, err := setup.NewSimulacronTestSetupWithSession(t, false, false)
 	require.Nil(t, err)
@@ -157,7 +165,7 @@ func testHttpEndpointsWithUnavailableNode(
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		runner.RunMain(conf, ctx, metricsHandler, healthHandler)
+		runner.RunMain(conf, ctx, metricsHandler, healthHandler, adminHandler)
 	}()
 
 	httpAddr := fmt.Sprintf("%s:%d", conf.MetricsAddress, conf.MetricsPort)
@@ -0,0 +1,85 @@
+package integration_tests
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestSchemaQueriesRouting(t *testing.T) {
+	tests := []struct {
+		name                  string
+		systemQueriesMode     string
+		schemaQueriesMode     string
+		expectedSchemaCluster string
+		expectedSystemCluster string
+	}{
+		{"default", config.SystemQueriesModeOrigin, "", "origin", "origin"},
+		{"follows system queries mode", config.SystemQueriesModeTarget, "", "target", "target"},
+		{"schema queries on target", config.SystemQueriesModeOrigin, config.SystemQueriesModeTarget, "target", "origin"},
+		{"schema queries on origin", config.SystemQueriesModeTarget, config.SystemQueriesModeOrigin, "origin", "target"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+			conf.SystemQueriesMode = tt.systemQueriesMode
+			conf.SchemaQueriesMode = tt.schemaQueriesMode
+			testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+			require.Nil(t, err)
+			defer testSetup.Cleanup()
+			testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+				newClusterNameHandler("origin")}
+			testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}),
+				newClusterNameHandler("target")}
+
+			err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+			require.Nil(t, err)
+
+			require.Equal(t, tt.expectedSchemaCluster,
+				queryClusterName(t, testSetup, "SELECT table_name FROM system_schema.tables"))
+			require.Equal(t, tt.expectedSchemaCluster,
+				queryClusterName(t, testSetup, "SELECT columnfamily_name FROM system.schema_columnfamilies"))
+			require.Equal(t, tt.expectedSystemCluster,
+				queryClusterName(t, testSetup, "SELECT role FROM system_auth.roles"))
+		})
+	}
+}
+
+// newClusterNameHandler returns a single row with the cluster name for the queries of the test.
+func newClusterNameHandler(clusterName string) client.RequestHandler {
+	return func(request *frame.Frame, _ *client.CqlServerConnection, _ client.RequestHandlerContext) *frame.Frame {
+		query, ok := request.Body.Message.(*message.Query)
+		if !ok || !strings.HasPrefix(query.Query, "SELECT") {
+			return nil
+		}
+		return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.RowsResult{
+			Metadata: &message.RowsMetadata{
+				ColumnCount: 1,
+				Columns: []*message.ColumnMetadata{
+					{Keyspace: "ks", Table: "t", Name: "cluster_name", Type: datatype.Varchar},
+				},
+			},
+			Data: message.RowSet{message.Row{[]byte(clusterName)}},
+		})
+	}
+}
+
+func queryClusterName(t *testing.T, testSetup *setup.CqlServerTestSetup, query string) string {
+	request := frame.NewFrame(primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: query})
+	response, err := testSetup.Client.CqlConnection.SendAndReceive(request)
+	require.Nil(t, err)
+	rows, ok := response.Body.Message.(*message.RowsResult)
+	require.True(t, ok, "expected rows result but got %v", response.Body.Message)
+	require.Len(t, rows.Data, 1)
+	return string(rows.Data[0][0])
+}
@@ -425,6 +425,9 @@ func NewTestConfig(originHost string, targetHost string) *config.Config {
 	conf.MetricsAsyncReadLatencyBucketsMs = "1, 4, 7, 10, 25, 40, 60, 80, 100, 150, 250, 500, 1000, 2500, 5000, 10000, 15000"
 
 	conf.MetricsEnabled = true
+	conf.MetricsStatsdSampleRate = 1
+	conf.MetricsErrorRateWindowMs = 60000
+	conf.MetricsDualWriteAgreementWindowMs = 300000
 
 	conf.RequestWriteQueueSizeFrames = 128
 	conf.RequestWriteBufferSizeBytes = 4096
@@ -446,10 +449,32 @@ func NewTestConfig(originHost string, targetHost string) *config.Config {
 	conf.AsyncConnectorWriteQueueSizeFrames = 2048
 	conf.AsyncConnectorWriteBufferSizeBytes = 4096
 
+	conf.ClientTcpNoDelay = true
+	conf.ClusterTcpNoDelay = true
+
 	conf.PrimaryCluster = config.PrimaryClusterOrigin
 	conf.ReadMode = config.ReadModePrimaryOnly
 	conf.SystemQueriesMode = config.SystemQueriesModeOrigin
 	conf.AsyncHandshakeTimeoutMs = 4000
+	conf.ClientHandshakeTimeoutMs = 60000
+	conf.UnexpectedResponseMode = config.UnexpectedResponseModeError
+	conf.EventDeliveryMode = config.EventDeliveryModeBlock
+	conf.RetryDetectionWindowMs = 1000
+	conf.PsCacheMissMode = config.PsCacheMissModeUnprepared
+	conf.LargeBatchMode = config.LargeBatchModeWarn
+	conf.ReadComparisonTargetAheadMode = config.ReadComparisonTargetAheadModeMismatch
+	conf.ReadComparisonMetadataMode = config.ReadComparisonMetadataModeNormalize
+	conf.DualWriteConfirmation = config.DualWriteConfirmationBoth
+	conf.TracingMode = config.TracingModeBoth
+	conf.QueryNormalizationLevel = config.QueryNormalizationLevelWhitespace
+	conf.TrackingMapMaxEntries = 10000
+	conf.TrackingMapMaxAgeMs = 600000
+	conf.PsReprepareStatementsPerSecond = 50
+	conf.SchemaVersionMode = config.SchemaVersionModeHost
+	conf.AdaptiveReadRoutingHysteresisPercent = 20
+	conf.AsyncReadsSamplePercent = 100
+	conf.OptionsCacheRefreshIntervalMs = 60000
+	conf.InjectedLatencyMaxMs = 10000
 
 	conf.ProxyRequestTimeoutMs = 10000
 
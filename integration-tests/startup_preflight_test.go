@@ -0,0 +1,71 @@
+package integration_tests
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestStartupPreflight(t *testing.T) {
+	tests := []struct {
+		name             string
+		keyspaces        string
+		expectedErrorMsg string
+	}{
+		{name: "no configured keyspaces", keyspaces: "", expectedErrorMsg: ""},
+		{name: "keyspace on both clusters", keyspaces: "ks1", expectedErrorMsg: ""},
+		{name: "keyspace missing on target", keyspaces: "ks1,ks2", expectedErrorMsg: "keyspace ks2 does not exist on TARGET"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+			conf.StartupPreflightEnabled = true
+			conf.StartupPreflightKeyspaces = tt.keyspaces
+			testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+			require.Nil(t, err)
+			defer testSetup.Cleanup()
+
+			testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+				newKeyspacesHandler("ks1", "ks2"), client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {})}
+			testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+				newKeyspacesHandler("ks1"), client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {})}
+
+			err = testSetup.Start(conf, false, primitive.ProtocolVersion4)
+			if tt.expectedErrorMsg == "" {
+				require.Nil(t, err)
+			} else {
+				require.NotNil(t, err)
+				require.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+		})
+	}
+}
+
+func newKeyspacesHandler(keyspaces ...string) client.RequestHandler {
+	return func(request *frame.Frame, _ *client.CqlServerConnection, _ client.RequestHandlerContext) *frame.Frame {
+		query, ok := request.Body.Message.(*message.Query)
+		if !ok || !strings.Contains(query.Query, "system_schema.keyspaces") {
+			return nil
+		}
+		rows := make(message.RowSet, 0, len(keyspaces))
+		for _, keyspace := range keyspaces {
+			rows = append(rows, message.Row{[]byte(keyspace)})
+		}
+		return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.RowsResult{
+			Metadata: &message.RowsMetadata{
+				ColumnCount: 1,
+				Columns: []*message.ColumnMetadata{
+					{Keyspace: "system_schema", Table: "keyspaces", Name: "keyspace_name", Type: datatype.Varchar},
+				},
+			},
+			Data: rows,
+		})
+	}
+}
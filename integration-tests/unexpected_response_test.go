@@ -0,0 +1,76 @@
+package integration_tests
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+// Target returns UNPREPARED with a prepared id that the proxy never saw so the proxy can not translate it
+// to the corresponding origin prepared id.
+func TestUnexpectedResponseMode(t *testing.T) {
+	unknownPreparedId := []byte{1, 2, 3, 4}
+
+	tests := []struct {
+		name                   string
+		unexpectedResponseMode string
+		expectedResponse       message.Message
+	}{
+		{
+			name:                   "error",
+			unexpectedResponseMode: config.UnexpectedResponseModeError,
+			expectedResponse:       &message.ServerError{},
+		},
+		{
+			name:                   "passthrough",
+			unexpectedResponseMode: config.UnexpectedResponseModePassthrough,
+			expectedResponse:       &message.Unprepared{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+			conf.UnexpectedResponseMode = tt.unexpectedResponseMode
+			testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+			require.Nil(t, err)
+			defer testSetup.Cleanup()
+
+			insertHandler := func(unprepared bool) client.RequestHandler {
+				return func(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+					query, ok := request.Body.Message.(*message.Query)
+					if !ok || !strings.HasPrefix(query.Query, "INSERT") {
+						return nil
+					}
+					if unprepared {
+						return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.Unprepared{
+							ErrorMessage: "unknown prepared id", Id: unknownPreparedId})
+					}
+					return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.VoidResult{})
+				}
+			}
+			testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}), insertHandler(false)}
+			testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}), insertHandler(true)}
+
+			err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+			require.Nil(t, err)
+
+			response, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+				primitive.ProtocolVersion4, client.ManagedStreamId,
+				&message.Query{Query: "INSERT INTO ks1.tb1 (key, value) VALUES ('key', 'value')"}))
+			require.Nil(t, err)
+			require.IsType(t, tt.expectedResponse, response.Body.Message)
+			if unprepared, ok := response.Body.Message.(*message.Unprepared); ok {
+				require.Equal(t, unknownPreparedId, unprepared.Id)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package integration_tests
+
+import (
+	"context"
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Pipelines two USE statements where the response to the first one is delayed. The keyspace of the second USE
+// statement must be the current keyspace afterwards which is verified by sending a query that is routed
+// to TARGET (primary cluster) only if the current keyspace is not a system keyspace.
+func TestPipelinedUseStatements(t *testing.T) {
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	conf.PrimaryCluster = config.PrimaryClusterTarget
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	useLock := &sync.Mutex{}
+	var originUseStatements []string
+	delayedSetKeyspaceHandler := func(request *frame.Frame, conn *client.CqlServerConnection, ctx client.RequestHandlerContext) *frame.Frame {
+		query, ok := request.Body.Message.(*message.Query)
+		if !ok || !strings.HasPrefix(query.Query, "USE") {
+			return nil
+		}
+		useLock.Lock()
+		originUseStatements = append(originUseStatements, query.Query)
+		useLock.Unlock()
+		if strings.Contains(query.Query, "system_auth") {
+			time.Sleep(300 * time.Millisecond)
+		}
+		return client.NewSetKeyspaceHandler(func(string) {})(request, conn, ctx)
+	}
+
+	originRecorder := &customPayloadRecorder{}
+	targetRecorder := &customPayloadRecorder{}
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.RegisterHandler, client.HeartbeatHandler, client.HandshakeHandler,
+		client.NewSystemTablesHandler("cluster1", "dc1"), delayedSetKeyspaceHandler, originRecorder.newHandler("origin")}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.RegisterHandler, client.HeartbeatHandler, client.HandshakeHandler,
+		client.NewSystemTablesHandler("cluster2", "dc2"), client.NewSetKeyspaceHandler(func(string) {}),
+		targetRecorder.newHandler("target")}
+
+	err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	firstUse, err := testSetup.Client.CqlConnection.Send(
+		frame.NewFrame(primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: "USE system_auth"}))
+	require.Nil(t, err)
+	secondUse, err := testSetup.Client.CqlConnection.Send(
+		frame.NewFrame(primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: "USE ks1"}))
+	require.Nil(t, err)
+
+	for _, inFlight := range []client.InFlightRequest{firstUse, secondUse} {
+		response, err := testSetup.Client.CqlConnection.Receive(inFlight)
+		require.Nil(t, err)
+		require.IsType(t, &message.SetKeyspaceResult{}, response.Body.Message)
+	}
+
+	useLock.Lock()
+	require.Equal(t, []string{"USE system_auth", "USE ks1"}, originUseStatements)
+	useLock.Unlock()
+
+	_, err = testSetup.Client.CqlConnection.SendAndReceive(
+		frame.NewFrame(primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: "SELECT * FROM users"}))
+	require.Nil(t, err)
+	require.Len(t, originRecorder.get(), 0)
+	require.Len(t, targetRecorder.get(), 1)
+}
+
+// The keyspace set in the STARTUP options is the current keyspace from the first request, it is verified by sending
+// a query that is routed to ORIGIN instead of TARGET (primary cluster) because the current keyspace is a system keyspace.
+func TestStartupKeyspace(t *testing.T) {
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	conf.PrimaryCluster = config.PrimaryClusterTarget
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	originRequestHandler := NewFakeRequestHandler()
+	targetRequestHandler := NewFakeRequestHandler()
+	originRecorder := &customPayloadRecorder{}
+	targetRecorder := &customPayloadRecorder{}
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		originRequestHandler.HandleRequest, client.RegisterHandler, client.HeartbeatHandler, client.HandshakeHandler,
+		client.NewSystemTablesHandler("cluster1", "dc1"), originRecorder.newHandler("origin")}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		targetRequestHandler.HandleRequest, client.RegisterHandler, client.HeartbeatHandler, client.HandshakeHandler,
+		client.NewSystemTablesHandler("cluster2", "dc2"), targetRecorder.newHandler("target")}
+
+	err = testSetup.Start(conf, false, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	testClient := client.NewCqlClient(fmt.Sprintf("%s:%d", conf.ProxyListenAddress, conf.ProxyListenPort), nil)
+	cqlConn, err := testClient.Connect(context.Background())
+	require.Nil(t, err)
+	defer cqlConn.Close()
+
+	startup := message.NewStartup()
+	startup.Options["KEYSPACE"] = "system_auth"
+	response, err := cqlConn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 0, startup))
+	require.Nil(t, err)
+	authenticate, ok := response.Body.Message.(*message.Authenticate)
+	require.True(t, ok, response.Body.Message)
+
+	authenticator := &client.PlainTextAuthenticator{
+		Credentials: &client.AuthCredentials{Username: conf.OriginUsername, Password: conf.OriginPassword}}
+	token, err := authenticator.InitialResponse(authenticate.Authenticator)
+	require.Nil(t, err)
+	response, err = cqlConn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 0, &message.AuthResponse{Token: token}))
+	require.Nil(t, err)
+	require.IsType(t, &message.AuthSuccess{}, response.Body.Message)
+
+	_, err = cqlConn.SendAndReceive(
+		frame.NewFrame(primitive.ProtocolVersion4, 0, &message.Query{Query: "SELECT * FROM users"}))
+	require.Nil(t, err)
+	require.Len(t, originRecorder.get(), 1)
+	require.Len(t, targetRecorder.get(), 0)
+
+	// both clusters received the keyspace in the STARTUP request of the client connection
+	for _, requestsByConn := range [][][]*frame.Frame{originRequestHandler.GetRequests(), targetRequestHandler.GetRequests()} {
+		var keyspaces []string
+		for _, requests := range requestsByConn {
+			for _, request := range requests {
+				if startupRequest, ok := request.Body.Message.(*message.Startup); ok {
+					if keyspace, ok := startupRequest.Options["KEYSPACE"]; ok {
+						keyspaces = append(keyspaces, keyspace)
+					}
+				}
+			}
+		}
+		require.Equal(t, []string{"system_auth"}, keyspaces)
+	}
+}
+
+// Pipelines reads before a USE statement. The reads were received before the USE statement so they must be forwarded
+// with the previous current keyspace (none), which is verified by checking that they are routed to TARGET (primary
+// cluster) instead of ORIGIN (system keyspace).
+func TestRequestsPipelinedBeforeUseStatement(t *testing.T) {
+	conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+	conf.PrimaryCluster = config.PrimaryClusterTarget
+	testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	originRecorder := &customPayloadRecorder{}
+	targetRecorder := &customPayloadRecorder{}
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.RegisterHandler, client.HeartbeatHandler, client.HandshakeHandler,
+		client.NewSystemTablesHandler("cluster1", "dc1"), client.NewSetKeyspaceHandler(func(string) {}),
+		originRecorder.newHandler("origin")}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		client.RegisterHandler, client.HeartbeatHandler, client.HandshakeHandler,
+		client.NewSystemTablesHandler("cluster2", "dc2"), client.NewSetKeyspaceHandler(func(string) {}),
+		targetRecorder.newHandler("target")}
+
+	err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	var inFlightRequests []client.InFlightRequest
+	for i := 0; i < 20; i++ {
+		inFlight, err := testSetup.Client.CqlConnection.Send(
+			frame.NewFrame(primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: "SELECT * FROM users"}))
+		require.Nil(t, err)
+		inFlightRequests = append(inFlightRequests, inFlight)
+	}
+	use, err := testSetup.Client.CqlConnection.Send(
+		frame.NewFrame(primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: "USE system_auth"}))
+	require.Nil(t, err)
+
+	for _, inFlight := range inFlightRequests {
+		_, err := testSetup.Client.CqlConnection.Receive(inFlight)
+		require.Nil(t, err)
+	}
+	response, err := testSetup.Client.CqlConnection.Receive(use)
+	require.Nil(t, err)
+	require.IsType(t, &message.SetKeyspaceResult{}, response.Body.Message)
+	require.Len(t, originRecorder.get(), 0)
+	require.Len(t, targetRecorder.get(), 20)
+
+	// requests received after the USE statement use the new current keyspace
+	_, err = testSetup.Client.CqlConnection.SendAndReceive(
+		frame.NewFrame(primitive.ProtocolVersion4, client.ManagedStreamId, &message.Query{Query: "SELECT * FROM users"}))
+	require.Nil(t, err)
+	require.Len(t, originRecorder.get(), 1)
+	require.Len(t, targetRecorder.get(), 20)
+}
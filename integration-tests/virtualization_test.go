@@ -905,6 +905,160 @@ func TestVirtualizationPartitioner(t *testing.T) {
 
 }
 
+func TestVirtualizationSchemaVersion(t *testing.T) {
+	originAddress := "127.0.1.1"
+	targetAddress := "127.0.1.2"
+
+	credentials := &client.AuthCredentials{
+		Username: "cassandra",
+		Password: "cassandra",
+	}
+
+	runTest := func(t *testing.T, schemaVersionMode string) []primitive.UUID {
+		serverConf := setup.NewTestConfig(originAddress, targetAddress)
+		testSetup, err := setup.NewCqlServerTestSetup(t, serverConf, false, false, false)
+		require.Nil(t, err)
+		defer testSetup.Cleanup()
+
+		testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+			NewCustomSystemTablesHandler("origin", "dc1", originAddress, map[string]int{"dc1": 0}, ""),
+			client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+		}
+		testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+			NewCustomSystemTablesHandler("target", "dc2", targetAddress, map[string]int{"dc2": 0}, ""),
+			client.NewDriverConnectionInitializationHandler("target", "dc2", func(_ string) {}),
+		}
+
+		err = testSetup.Start(nil, false, primitive.ProtocolVersion4)
+		require.Nil(t, err)
+
+		proxyConfig := setup.NewTestConfig(originAddress, targetAddress)
+		proxyConfig.ProxyTopologyAddresses = "127.0.0.1,127.0.0.2"
+		proxyConfig.SchemaVersionMode = schemaVersionMode
+		proxy, err := setup.NewProxyInstanceWithConfig(proxyConfig)
+		require.Nil(t, err)
+		defer proxy.Shutdown()
+
+		querySchemaVersion := func(cqlConn *client.CqlClientConnection, query string) primitive.UUID {
+			response, err := cqlConn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 0, &message.Query{
+				Query:   query,
+				Options: &message.QueryOptions{Consistency: primitive.ConsistencyLevelOne},
+			}))
+			require.Nil(t, err)
+			rowsResult, ok := response.Body.Message.(*message.RowsResult)
+			require.True(t, ok, "The response is of an unexpected result type: %v", response.Body.Message)
+			require.Len(t, rowsResult.Data, 1)
+
+			var schemaVersion primitive.UUID
+			wasNull, err := datacodec.Uuid.Decode(rowsResult.Data[0][0], &schemaVersion, response.Header.Version)
+			require.Nil(t, err)
+			require.False(t, wasNull)
+			return schemaVersion
+		}
+
+		schemaVersions := make([]primitive.UUID, 0)
+		for i := 0; i < 2; i++ {
+			cqlConn, err := client.NewCqlClient("127.0.0.1:14002", credentials).ConnectAndInit(
+				context.Background(), primitive.ProtocolVersion4, 1)
+			require.Nil(t, err)
+			schemaVersions = append(schemaVersions,
+				querySchemaVersion(cqlConn, "SELECT schema_version FROM system.local"),
+				querySchemaVersion(cqlConn, "SELECT schema_version FROM system.peers"))
+			_ = cqlConn.Close()
+		}
+		return schemaVersions
+	}
+
+	t.Run("HOST", func(t *testing.T) {
+		for _, schemaVersion := range runTest(t, config.SchemaVersionModeHost) {
+			require.Equal(t, []byte(schemaVersionValue), schemaVersion[:])
+		}
+	})
+
+	t.Run("SYNTHETIC", func(t *testing.T) {
+		schemaVersions := runTest(t, config.SchemaVersionModeSynthetic)
+		require.NotEqual(t, []byte(schemaVersionValue), schemaVersions[0][:])
+		for _, schemaVersion := range schemaVersions {
+			require.Equal(t, schemaVersions[0], schemaVersion)
+		}
+		// the synthetic schema version is the same on every proxy instance and across restarts
+		require.Equal(t, schemaVersions, runTest(t, config.SchemaVersionModeSynthetic))
+	})
+}
+
+func TestVirtualizationSpoofedIdentity(t *testing.T) {
+	originAddress := "127.0.1.1"
+	targetAddress := "127.0.1.2"
+
+	serverConf := setup.NewTestConfig(originAddress, targetAddress)
+	testSetup, err := setup.NewCqlServerTestSetup(t, serverConf, false, false, false)
+	require.Nil(t, err)
+	defer testSetup.Cleanup()
+
+	testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+		NewCustomSystemTablesHandler("origin", "dc1", originAddress, map[string]int{"dc1": 0}, ""),
+		newOptionsHandler("origin"),
+		client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+	}
+	testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+		NewCustomSystemTablesHandler("target", "dc2", targetAddress, map[string]int{"dc2": 0}, ""),
+		newOptionsHandler("target"),
+		client.NewDriverConnectionInitializationHandler("target", "dc2", func(_ string) {}),
+	}
+
+	err = testSetup.Start(nil, false, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+
+	proxyConfig := setup.NewTestConfig(originAddress, targetAddress)
+	proxyConfig.ProxyTopologyAddresses = "127.0.0.1,127.0.0.2"
+	proxyConfig.SpoofedClusterName = "virtual-cluster"
+	proxyConfig.SpoofedReleaseVersion = "4.0.11"
+	proxyConfig.SpoofedCqlVersion = "3.4.5"
+	proxyConfig.SpoofedProductType = "DATASTAX_APOLLO"
+	proxy, err := setup.NewProxyInstanceWithConfig(proxyConfig)
+	require.Nil(t, err)
+	defer proxy.Shutdown()
+
+	cqlConn, err := client.NewCqlClient("127.0.0.1:14002", &client.AuthCredentials{
+		Username: "cassandra",
+		Password: "cassandra",
+	}).ConnectAndInit(context.Background(), primitive.ProtocolVersion4, 1)
+	require.Nil(t, err)
+	defer cqlConn.Close()
+
+	queryStrings := func(query string) []string {
+		response, err := cqlConn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 0, &message.Query{
+			Query:   query,
+			Options: &message.QueryOptions{Consistency: primitive.ConsistencyLevelOne},
+		}))
+		require.Nil(t, err)
+		rowsResult, ok := response.Body.Message.(*message.RowsResult)
+		require.True(t, ok, "The response is of an unexpected result type: %v", response.Body.Message)
+		require.Len(t, rowsResult.Data, 1)
+
+		values := make([]string, 0, len(rowsResult.Data[0]))
+		for _, column := range rowsResult.Data[0] {
+			var value string
+			_, err := datacodec.Varchar.Decode(column, &value, response.Header.Version)
+			require.Nil(t, err)
+			values = append(values, value)
+		}
+		return values
+	}
+
+	require.Equal(t, []string{"virtual-cluster", "4.0.11", "3.4.5"},
+		queryStrings("SELECT cluster_name, release_version, cql_version FROM system.local"))
+	require.Equal(t, []string{"4.0.11"}, queryStrings("SELECT release_version FROM system.peers"))
+
+	response, err := cqlConn.SendAndReceive(frame.NewFrame(primitive.ProtocolVersion4, 0, &message.Options{}))
+	require.Nil(t, err)
+	require.IsType(t, &message.Supported{}, response.Body.Message)
+	supported := response.Body.Message.(*message.Supported)
+	require.Equal(t, []string{"3.4.5"}, supported.Options["CQL_VERSION"])
+	require.Equal(t, []string{"DATASTAX_APOLLO"}, supported.Options["PRODUCT_TYPE"])
+	require.Equal(t, []string{"target"}, supported.Options["FROM"])
+}
+
 func LaunchProxyWithTopologyConfig(
 	proxyAddresses string, proxyIndex int, listenAddress string, numTokens int,
 	origin setup.TestCluster, target setup.TestCluster) (*zdmproxy.ZdmProxy, error) {
@@ -0,0 +1,163 @@
+package integration_tests
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/client"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/integration-tests/setup"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDualWriteConfirmation(t *testing.T) {
+	writeTimeout := &message.WriteTimeout{
+		ErrorMessage: "write timeout", Consistency: primitive.ConsistencyLevelLocalQuorum, WriteType: primitive.WriteTypeSimple}
+	overloaded := &message.Overloaded{ErrorMessage: "overloaded"}
+	slow := 500 * time.Millisecond
+	tests := []struct {
+		name             string
+		confirmation     string
+		primaryCluster   string
+		originError      message.Error
+		originDelay      time.Duration
+		targetError      message.Error
+		targetDelay      time.Duration
+		expectedResponse message.Message
+		expectFast       bool
+		expectSlow       bool
+	}{
+		{
+			name:             "both waits for the slower cluster",
+			confirmation:     config.DualWriteConfirmationBoth,
+			targetDelay:      slow,
+			expectedResponse: &message.VoidResult{},
+			expectSlow:       true,
+		},
+		{
+			name:             "both returns the error of either cluster",
+			confirmation:     config.DualWriteConfirmationBoth,
+			targetError:      writeTimeout,
+			expectedResponse: &message.WriteTimeout{},
+		},
+		{
+			name:             "primary doesn't wait for the other cluster",
+			confirmation:     config.DualWriteConfirmationPrimary,
+			targetDelay:      slow,
+			expectedResponse: &message.VoidResult{},
+			expectFast:       true,
+		},
+		{
+			name:             "primary ignores the error of the other cluster",
+			confirmation:     config.DualWriteConfirmationPrimary,
+			targetError:      writeTimeout,
+			targetDelay:      slow,
+			expectedResponse: &message.VoidResult{},
+			expectFast:       true,
+		},
+		{
+			name:             "primary returns the error of the primary cluster right away",
+			confirmation:     config.DualWriteConfirmationPrimary,
+			originError:      overloaded,
+			targetDelay:      slow,
+			expectedResponse: &message.Overloaded{},
+			expectFast:       true,
+		},
+		{
+			name:             "primary waits for the primary cluster",
+			confirmation:     config.DualWriteConfirmationPrimary,
+			primaryCluster:   config.PrimaryClusterTarget,
+			targetDelay:      slow,
+			originError:      writeTimeout,
+			expectedResponse: &message.VoidResult{},
+			expectSlow:       true,
+		},
+		{
+			name:             "either returns the first successful response",
+			confirmation:     config.DualWriteConfirmationEither,
+			originDelay:      slow,
+			expectedResponse: &message.VoidResult{},
+			expectFast:       true,
+		},
+		{
+			name:             "either waits for a successful response",
+			confirmation:     config.DualWriteConfirmationEither,
+			originError:      writeTimeout,
+			targetDelay:      slow,
+			expectedResponse: &message.VoidResult{},
+			expectSlow:       true,
+		},
+		{
+			name:             "either returns an error if both clusters fail",
+			confirmation:     config.DualWriteConfirmationEither,
+			originError:      writeTimeout,
+			targetError:      overloaded,
+			expectedResponse: &message.WriteTimeout{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := setup.NewTestConfig("127.0.1.1", "127.0.1.2")
+			conf.DualWriteConfirmation = tt.confirmation
+			if tt.primaryCluster != "" {
+				conf.PrimaryCluster = tt.primaryCluster
+			}
+			testSetup, err := setup.NewCqlServerTestSetup(t, conf, false, false, false)
+			require.Nil(t, err)
+			defer testSetup.Cleanup()
+
+			originWrites := int32(0)
+			targetWrites := int32(0)
+			testSetup.Origin.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("origin", "dc1", func(_ string) {}),
+				newDelayedReadTestHandler(tt.originDelay, newWriteConfirmationTestHandler(&originWrites, tt.originError))}
+			testSetup.Target.CqlServer.RequestHandlers = []client.RequestHandler{
+				client.NewDriverConnectionInitializationHandler("target", "dc1", func(_ string) {}),
+				newDelayedReadTestHandler(tt.targetDelay, newWriteConfirmationTestHandler(&targetWrites, tt.targetError))}
+
+			err = testSetup.Start(conf, true, primitive.ProtocolVersion4)
+			require.Nil(t, err)
+
+			for i := 0; i < 2; i++ {
+				start := time.Now()
+				response, err := testSetup.Client.CqlConnection.SendAndReceive(frame.NewFrame(
+					primitive.ProtocolVersion4, int16(10+i), &message.Query{Query: "INSERT INTO ks1.tb1 (key) VALUES (1)", Options: &message.QueryOptions{}}))
+				require.Nil(t, err)
+				require.IsType(t, tt.expectedResponse, response.Body.Message)
+				if tt.expectFast {
+					require.Less(t, int64(time.Since(start)), int64(slow/2))
+				}
+				if tt.expectSlow {
+					require.GreaterOrEqual(t, int64(time.Since(start)), int64(slow/2))
+				}
+			}
+
+			// writes are always applied to both clusters
+			require.Eventually(t, func() bool {
+				return atomic.LoadInt32(&originWrites) == 2 && atomic.LoadInt32(&targetWrites) == 2
+			}, 5*time.Second, 50*time.Millisecond)
+		})
+	}
+}
+
+// newWriteConfirmationTestHandler returns a handler that counts the INSERT requests and responds with the provided
+// error, or with a VOID result if the error is nil.
+func newWriteConfirmationTestHandler(writes *int32, writeError message.Error) client.RequestHandler {
+	return func(request *frame.Frame, _ *client.CqlServerConnection, _ client.RequestHandlerContext) *frame.Frame {
+		query, ok := request.Body.Message.(*message.Query)
+		if !ok || !strings.HasPrefix(query.Query, "INSERT") {
+			return nil
+		}
+
+		atomic.AddInt32(writes, 1)
+		if writeError != nil {
+			return frame.NewFrame(request.Header.Version, request.Header.StreamId, writeError)
+		}
+		return frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.VoidResult{})
+	}
+}
@@ -47,6 +47,6 @@ func launchProxy(profilingSupported bool) {
 	runSignalListener(cancelFunc)
 	log.Info("SIGINT/SIGTERM listener started.")
 
-	metricsHandler, readinessHandler := runner.SetupHandlers()
-	runner.RunMain(conf, ctx, metricsHandler, readinessHandler)
+	metricsHandler, readinessHandler, adminHandler := runner.SetupHandlers()
+	runner.RunMain(conf, ctx, metricsHandler, readinessHandler, adminHandler)
 }
@@ -0,0 +1,23 @@
+package admin
+
+import (
+	"github.com/datastax/zdm-proxy/proxy/pkg/zdmproxy"
+	"net/http"
+)
+
+func DefaultHandler() http.Handler {
+	return Handler(nil)
+}
+
+// Handler serves all the admin endpoints, it should be registered on the /admin/ path.
+func Handler(proxy *zdmproxy.ZdmProxy) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/admin/pscache", PreparedStatementCacheHandler(proxy))
+	mux.Handle("/admin/pscache/reprepare", PreparedStatementCacheReprepareHandler(
+		proxy, proxy != nil && proxy.Conf.AdminWriteEnabled))
+	mux.Handle("/admin/cutover", CutoverHandler(proxy, proxy != nil && proxy.Conf.AdminWriteEnabled))
+	mux.Handle("/admin/connectionmetrics", ConnectionMetricsHandler(proxy, proxy != nil && proxy.Conf.AdminWriteEnabled))
+	mux.Handle("/admin/injectedlatency", InjectedLatencyHandler(
+		proxy, proxy != nil && proxy.Conf.InjectedLatencyAdminEnabled))
+	return mux
+}
@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/datastax/zdm-proxy/proxy/pkg/zdmproxy"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+type EnableConnectionMetricsRequest struct {
+	ClientAddress string
+	DurationMs    int
+}
+
+// ConnectionMetricsHandler returns the per connection metrics of every client address that has them enabled on GET
+// and enables per connection metrics for a client address on POST. The POST body is a JSON object with the
+// ClientAddress (host or host:port) and DurationMs fields, e.g.
+//
+//	{"ClientAddress": "10.0.0.12", "DurationMs": 300000}
+//
+// Per connection metrics stop being recorded once the duration elapses.
+// POST is only served if writeEnabled is true, see ZDM_ADMIN_WRITE_ENABLED.
+func ConnectionMetricsHandler(proxy *zdmproxy.ZdmProxy, writeEnabled bool) http.Handler {
+	return http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && (req.Method != http.MethodPost || !writeEnabled) {
+			http.NotFound(rsp, req)
+			return
+		}
+
+		if proxy == nil {
+			http.Error(rsp, "proxy is not initialized", http.StatusServiceUnavailable)
+			return
+		}
+
+		var report interface{}
+		if req.Method == http.MethodGet {
+			report = proxy.GetConnectionMetrics()
+		} else {
+			enableRequest := &EnableConnectionMetricsRequest{}
+			err := json.NewDecoder(req.Body).Decode(enableRequest)
+			if err != nil {
+				http.Error(rsp, fmt.Sprintf("invalid connection metrics request: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			report, err = proxy.EnableConnectionMetrics(
+				enableRequest.ClientAddress, time.Duration(enableRequest.DurationMs)*time.Millisecond)
+			if err != nil {
+				http.Error(rsp, fmt.Sprintf("invalid connection metrics request: %v", err), http.StatusBadRequest)
+				return
+			}
+			log.Infof("Enabled per connection metrics for client %v for %v ms.",
+				enableRequest.ClientAddress, enableRequest.DurationMs)
+		}
+
+		bytes, err := json.Marshal(report)
+		if err != nil {
+			uid := uuid.New()
+			msg := fmt.Sprintf("Internal server error with code %v", uid)
+			log.Errorf("Could not serialize connection metrics report (code: %v): %v", uid, err)
+
+			http.Error(rsp, msg, http.StatusInternalServerError)
+			return
+		}
+
+		header := rsp.Header()
+		header.Set("Content-Type", "application/json")
+		rsp.WriteHeader(http.StatusOK)
+		rsp.Write(bytes)
+	})
+}
@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/datastax/zdm-proxy/proxy/pkg/zdmproxy"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type CutoverStateReport struct {
+	PrimaryCluster string
+	ReadMode       string
+}
+
+type CutoverReport struct {
+	Previous *CutoverStateReport
+	Current  *CutoverStateReport
+}
+
+// CutoverHandler returns the current cutover state on GET and applies a cutover on POST.
+// The POST body is a JSON object with the optional PrimaryCluster and ReadMode fields, e.g.
+//
+//	{"PrimaryCluster": "TARGET", "ReadMode": "PRIMARY_ONLY"}
+//
+// The new settings apply to the next request of every client connection.
+// POST is only served if writeEnabled is true, see ZDM_ADMIN_WRITE_ENABLED.
+func CutoverHandler(proxy *zdmproxy.ZdmProxy, writeEnabled bool) http.Handler {
+	return http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && (req.Method != http.MethodPost || !writeEnabled) {
+			http.NotFound(rsp, req)
+			return
+		}
+
+		if proxy == nil {
+			http.Error(rsp, "proxy is not initialized", http.StatusServiceUnavailable)
+			return
+		}
+
+		var report interface{}
+		if req.Method == http.MethodGet {
+			report = newCutoverStateReport(proxy.GetCutoverState())
+		} else {
+			cutoverRequest := &zdmproxy.CutoverRequest{}
+			err := json.NewDecoder(req.Body).Decode(cutoverRequest)
+			if err != nil {
+				http.Error(rsp, fmt.Sprintf("invalid cutover request: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			previous, current, err := proxy.Cutover(cutoverRequest)
+			if err != nil {
+				http.Error(rsp, fmt.Sprintf("invalid cutover request: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			report = &CutoverReport{
+				Previous: newCutoverStateReport(previous),
+				Current:  newCutoverStateReport(current),
+			}
+		}
+
+		bytes, err := json.Marshal(report)
+		if err != nil {
+			uid := uuid.New()
+			msg := fmt.Sprintf("Internal server error with code %v", uid)
+			log.Errorf("Could not serialize cutover report (code: %v): %v", uid, err)
+
+			http.Error(rsp, msg, http.StatusInternalServerError)
+			return
+		}
+
+		header := rsp.Header()
+		header.Set("Content-Type", "application/json")
+		rsp.WriteHeader(http.StatusOK)
+		rsp.Write(bytes)
+	})
+}
+
+func newCutoverStateReport(state *zdmproxy.CutoverState) *CutoverStateReport {
+	return &CutoverStateReport{
+		PrimaryCluster: string(state.PrimaryCluster),
+		ReadMode:       state.ReadMode.String(),
+	}
+}
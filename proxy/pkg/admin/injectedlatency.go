@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/datastax/zdm-proxy/proxy/pkg/zdmproxy"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+type SetInjectedLatencyRequest struct {
+	Cluster string
+	DelayMs int
+}
+
+// InjectedLatencyHandler returns the artificial delay that is added to the responses of each cluster on GET
+// and changes it for one cluster on POST. The POST body is a JSON object with the Cluster (ORIGIN or TARGET)
+// and DelayMs fields, e.g.
+//
+//	{"Cluster": "TARGET", "DelayMs": 200}
+//
+// A DelayMs of 0 disables it. The new delay applies to existing client connections too.
+// POST is only served if setEnabled is true, see ZDM_INJECTED_LATENCY_ADMIN_ENABLED.
+func InjectedLatencyHandler(proxy *zdmproxy.ZdmProxy, setEnabled bool) http.Handler {
+	return http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && (req.Method != http.MethodPost || !setEnabled) {
+			http.NotFound(rsp, req)
+			return
+		}
+
+		if proxy == nil {
+			http.Error(rsp, "proxy is not initialized", http.StatusServiceUnavailable)
+			return
+		}
+
+		var report interface{}
+		if req.Method == http.MethodGet {
+			report = proxy.GetInjectedLatency()
+		} else {
+			setRequest := &SetInjectedLatencyRequest{}
+			err := json.NewDecoder(req.Body).Decode(setRequest)
+			if err != nil {
+				http.Error(rsp, fmt.Sprintf("invalid injected latency request: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			report, err = proxy.SetInjectedLatency(setRequest.Cluster, time.Duration(setRequest.DelayMs)*time.Millisecond)
+			if err != nil {
+				http.Error(rsp, fmt.Sprintf("invalid injected latency request: %v", err), http.StatusBadRequest)
+				return
+			}
+			log.Warnf("Injected latency of %v is set to %v ms, responses from this cluster are artificially delayed.",
+				setRequest.Cluster, setRequest.DelayMs)
+		}
+
+		bytes, err := json.Marshal(report)
+		if err != nil {
+			uid := uuid.New()
+			msg := fmt.Sprintf("Internal server error with code %v", uid)
+			log.Errorf("Could not serialize injected latency report (code: %v): %v", uid, err)
+
+			http.Error(rsp, msg, http.StatusInternalServerError)
+			return
+		}
+
+		header := rsp.Header()
+		header.Set("Content-Type", "application/json")
+		rsp.WriteHeader(http.StatusOK)
+		rsp.Write(bytes)
+	})
+}
@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/datastax/zdm-proxy/proxy/pkg/zdmproxy"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type PreparedStatementCacheReport struct {
+	Size    int
+	Entries []*zdmproxy.PreparedStatementCacheEntry
+}
+
+// PreparedStatementCacheHandler dumps the contents of the prepared statement cache as JSON.
+// This is meant to help diagnosing mismatched prepared ids (e.g. a high number of UNPREPARED responses).
+func PreparedStatementCacheHandler(proxy *zdmproxy.ZdmProxy) http.Handler {
+	return http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.NotFound(rsp, req)
+			return
+		}
+
+		if proxy == nil {
+			http.Error(rsp, "proxy is not initialized", http.StatusServiceUnavailable)
+			return
+		}
+
+		entries := proxy.PreparedStatementCache.Snapshot(proxy.Conf.PsCacheDumpRedactQueries)
+		bytes, err := json.Marshal(&PreparedStatementCacheReport{
+			Size:    len(entries),
+			Entries: entries,
+		})
+		if err != nil {
+			uid := uuid.New()
+			msg := fmt.Sprintf("Internal server error with code %v", uid)
+			log.Errorf("Could not dump prepared statement cache (code: %v): %v", uid, err)
+
+			http.Error(rsp, msg, http.StatusInternalServerError)
+			return
+		}
+
+		header := rsp.Header()
+		header.Set("Content-Type", "application/json")
+		rsp.WriteHeader(http.StatusOK)
+		rsp.Write(bytes)
+	})
+}
+
+// PreparedStatementCacheReprepareHandler starts re-preparing every statement of the prepared statement cache on both
+// clusters on POST and returns the progress of the current (or last) re-preparation on GET.
+// Statements are re-prepared in the background at the rate set by ZDM_PS_REPREPARE_STATEMENTS_PER_SECOND.
+// POST is only served if writeEnabled is true, see ZDM_ADMIN_WRITE_ENABLED.
+func PreparedStatementCacheReprepareHandler(proxy *zdmproxy.ZdmProxy, writeEnabled bool) http.Handler {
+	return http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && (req.Method != http.MethodPost || !writeEnabled) {
+			http.NotFound(rsp, req)
+			return
+		}
+
+		if proxy == nil {
+			http.Error(rsp, "proxy is not initialized", http.StatusServiceUnavailable)
+			return
+		}
+
+		var report *zdmproxy.PreparedStatementReprepareReport
+		status := http.StatusOK
+		if req.Method == http.MethodGet {
+			report = proxy.GetReprepareStatementsReport()
+			if report == nil {
+				http.Error(rsp, "the prepared statement cache was not re-prepared yet", http.StatusNotFound)
+				return
+			}
+		} else {
+			var err error
+			report, err = proxy.ReprepareStatements()
+			if errors.Is(err, zdmproxy.ReprepareAlreadyRunningErr) {
+				http.Error(rsp, err.Error(), http.StatusConflict)
+				return
+			} else if err != nil {
+				http.Error(rsp, fmt.Sprintf("could not re-prepare the prepared statement cache: %v", err),
+					http.StatusServiceUnavailable)
+				return
+			}
+			status = http.StatusAccepted
+		}
+
+		bytes, err := json.Marshal(report)
+		if err != nil {
+			uid := uuid.New()
+			msg := fmt.Sprintf("Internal server error with code %v", uid)
+			log.Errorf("Could not serialize re-prepare report (code: %v): %v", uid, err)
+
+			http.Error(rsp, msg, http.StatusInternalServerError)
+			return
+		}
+
+		header := rsp.Header()
+		header.Set("Content-Type", "application/json")
+		rsp.WriteHeader(status)
+		rsp.Write(bytes)
+	})
+}
@@ -83,6 +83,164 @@ var (
 	SystemQueriesModeTarget    = SystemQueriesMode{"TARGET"}
 )
 
+type UnexpectedResponseMode struct {
+	slug string
+}
+
+func (r UnexpectedResponseMode) String() string {
+	return r.slug
+}
+
+var (
+	UnexpectedResponseModeUndefined   = UnexpectedResponseMode{""}
+	UnexpectedResponseModeError       = UnexpectedResponseMode{"ERROR"}
+	UnexpectedResponseModePassthrough = UnexpectedResponseMode{"PASSTHROUGH"}
+)
+
+type EventDeliveryMode struct {
+	slug string
+}
+
+func (r EventDeliveryMode) String() string {
+	return r.slug
+}
+
+var (
+	EventDeliveryModeUndefined = EventDeliveryMode{""}
+	EventDeliveryModeDrop      = EventDeliveryMode{"DROP"}
+	EventDeliveryModeBlock     = EventDeliveryMode{"BLOCK"}
+)
+
+type PsCacheMissMode struct {
+	slug string
+}
+
+func (r PsCacheMissMode) String() string {
+	return r.slug
+}
+
+var (
+	PsCacheMissModeUndefined  = PsCacheMissMode{""}
+	PsCacheMissModeUnprepared = PsCacheMissMode{"UNPREPARED"}
+	PsCacheMissModeForward    = PsCacheMissMode{"FORWARD"}
+)
+
+type SchemaVersionMode struct {
+	slug string
+}
+
+func (r SchemaVersionMode) String() string {
+	return r.slug
+}
+
+var (
+	SchemaVersionModeUndefined = SchemaVersionMode{""}
+	SchemaVersionModeHost      = SchemaVersionMode{"HOST"}
+	SchemaVersionModeSynthetic = SchemaVersionMode{"SYNTHETIC"}
+)
+
+type LargeBatchMode struct {
+	slug string
+}
+
+func (r LargeBatchMode) String() string {
+	return r.slug
+}
+
+var (
+	LargeBatchModeUndefined = LargeBatchMode{""}
+	LargeBatchModeWarn      = LargeBatchMode{"WARN"}
+	LargeBatchModeReject    = LargeBatchMode{"REJECT"}
+)
+
+type DualWriteConfirmation struct {
+	slug string
+}
+
+func (r DualWriteConfirmation) String() string {
+	return r.slug
+}
+
+var (
+	DualWriteConfirmationUndefined = DualWriteConfirmation{""}
+	DualWriteConfirmationBoth      = DualWriteConfirmation{"BOTH"}
+	DualWriteConfirmationPrimary   = DualWriteConfirmation{"PRIMARY"}
+	DualWriteConfirmationEither    = DualWriteConfirmation{"EITHER"}
+)
+
+type TracingMode struct {
+	slug string
+}
+
+func (r TracingMode) String() string {
+	return r.slug
+}
+
+var (
+	TracingModeUndefined = TracingMode{""}
+	TracingModeBoth      = TracingMode{"BOTH"}
+	TracingModePrimary   = TracingMode{"PRIMARY"}
+	TracingModeOrigin    = TracingMode{"ORIGIN"}
+	TracingModeTarget    = TracingMode{"TARGET"}
+)
+
+type ReadComparisonTargetAheadMode struct {
+	slug string
+}
+
+func (r ReadComparisonTargetAheadMode) String() string {
+	return r.slug
+}
+
+var (
+	ReadComparisonTargetAheadModeUndefined = ReadComparisonTargetAheadMode{""}
+	ReadComparisonTargetAheadModeMismatch  = ReadComparisonTargetAheadMode{"MISMATCH"}
+	ReadComparisonTargetAheadModeExpected  = ReadComparisonTargetAheadMode{"EXPECTED"}
+)
+
+type ReadComparisonMetadataMode struct {
+	slug string
+}
+
+func (r ReadComparisonMetadataMode) String() string {
+	return r.slug
+}
+
+var (
+	ReadComparisonMetadataModeUndefined = ReadComparisonMetadataMode{""}
+	ReadComparisonMetadataModeNormalize = ReadComparisonMetadataMode{"NORMALIZE"}
+	ReadComparisonMetadataModeStrict    = ReadComparisonMetadataMode{"STRICT"}
+	ReadComparisonMetadataModeIgnore    = ReadComparisonMetadataMode{"IGNORE"}
+)
+
+type QueryNormalizationLevel struct {
+	slug string
+}
+
+func (r QueryNormalizationLevel) String() string {
+	return r.slug
+}
+
+var (
+	QueryNormalizationLevelUndefined  = QueryNormalizationLevel{""}
+	QueryNormalizationLevelWhitespace = QueryNormalizationLevel{"WHITESPACE"}
+	QueryNormalizationLevelCase       = QueryNormalizationLevel{"CASE"}
+	QueryNormalizationLevelLiterals   = QueryNormalizationLevel{"LITERALS"}
+)
+
+// KeyspaceRoutingRule forwards the requests that access the keyspaces matching Pattern to Cluster only. The pattern
+// is either a keyspace name or a keyspace prefix (e.g. "tenantA_*") or suffix (e.g. "*_new").
+type KeyspaceRoutingRule struct {
+	Pattern string
+	Cluster ClusterType
+}
+
+// ClientGroup labels the client connections whose address is in Network with Name in the client group metrics.
+type ClientGroup struct {
+	Name    string
+	Network *net.IPNet
+}
+
 type ClusterType string
 
 const (
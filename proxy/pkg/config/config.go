@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
 	"github.com/datastax/zdm-proxy/proxy/pkg/common"
 	"github.com/kelseyhightower/envconfig"
 	log "github.com/sirupsen/logrus"
@@ -37,6 +38,7 @@ type Config struct {
 	OriginUsername                string `required:"true" split_words:"true"`
 	OriginPassword                string `required:"true" split_words:"true" json:"-"`
 	OriginConnectionTimeoutMs     int    `default:"30000" split_words:"true"`
+	OriginConnectTimeoutMs        int    `default:"0" split_words:"true"` // request connections of each client connection, 0 uses ZDM_ORIGIN_CONNECTION_TIMEOUT_MS
 
 	OriginTlsServerCaPath   string `split_words:"true"`
 	OriginTlsClientCertPath string `split_words:"true"`
@@ -51,6 +53,7 @@ type Config struct {
 	TargetUsername                string `required:"true" split_words:"true"`
 	TargetPassword                string `required:"true" split_words:"true" json:"-"`
 	TargetConnectionTimeoutMs     int    `default:"30000" split_words:"true"`
+	TargetConnectTimeoutMs        int    `default:"0" split_words:"true"` // request connections of each client connection, 0 uses ZDM_TARGET_CONNECTION_TIMEOUT_MS
 
 	TargetTlsServerCaPath   string `split_words:"true"`
 	TargetTlsClientCertPath string `split_words:"true"`
@@ -60,9 +63,13 @@ type Config struct {
 
 	ProxyListenAddress        string `default:"localhost" split_words:"true"`
 	ProxyListenPort           int    `default:"14002" split_words:"true"`
-	ProxyRequestTimeoutMs     int    `default:"10000" split_words:"true"`
+	ProxyRequestTimeoutMs     int    `default:"10000" split_words:"true"` // also bounds how long a slow USE request holds back the requests received after it
 	ProxyMaxClientConnections int    `default:"1000" split_words:"true"`
 
+	// Maximum number of client connections from a single IP address so that a misbehaving client host can't use up
+	// all of ZDM_PROXY_MAX_CLIENT_CONNECTIONS, 0 means no limit.
+	ProxyMaxClientConnectionsPerIp int `default:"0" split_words:"true"`
+
 	ProxyTlsCaPath            string `split_words:"true"`
 	ProxyTlsCertPath          string `split_words:"true"`
 	ProxyTlsKeyPath           string `split_words:"true"`
@@ -74,10 +81,47 @@ type Config struct {
 	MetricsAddress string `default:"localhost" split_words:"true"`
 	MetricsPort    int    `default:"14001" split_words:"true"`
 
+	// When set (host:port), metrics are sent to this StatsD/DogStatsD endpoint over UDP instead of being exposed
+	// on the Prometheus endpoint. Tags is a comma separated list of key:value pairs that are added to every metric.
+	MetricsStatsdAddress    string  `split_words:"true"`
+	MetricsStatsdTags       string  `split_words:"true"`
+	MetricsStatsdSampleRate float64 `default:"1" split_words:"true"`
+
 	MetricsOriginLatencyBucketsMs    string `default:"1, 4, 7, 10, 25, 40, 60, 80, 100, 150, 250, 500, 1000, 2500, 5000, 10000, 15000" split_words:"true"`
 	MetricsTargetLatencyBucketsMs    string `default:"1, 4, 7, 10, 25, 40, 60, 80, 100, 150, 250, 500, 1000, 2500, 5000, 10000, 15000" split_words:"true"`
 	MetricsAsyncReadLatencyBucketsMs string `default:"1, 4, 7, 10, 25, 40, 60, 80, 100, 150, 250, 500, 1000, 2500, 5000, 10000, 15000" split_words:"true"`
 
+	MetricsOpcodeLogIntervalMs int `default:"0" split_words:"true"` // 0 disables the periodic opcode distribution log
+
+	MetricsErrorRateWindowMs int `default:"60000" split_words:"true"`
+
+	// Window of the dual write agreement rate (ratio of writes that either succeeded or failed on both clusters)
+	// reported by the readiness endpoint, see ZdmProxy.GetDualWriteAgreement.
+	MetricsDualWriteAgreementWindowMs int `default:"300000" split_words:"true"`
+
+	// Writes that succeeded on one cluster and failed on the other are counted per table in
+	// proxy_dual_write_divergences_total. This is the maximum number of tables that get their own label, divergences
+	// on tables that are seen once the limit is reached are counted under the "other" table. 0 disables the metric.
+	MetricsTableDivergenceMaxTables int `default:"0" split_words:"true"`
+
+	// EXECUTE requests are counted per keyspace in proxy_ps_cache_executes_total depending on whether their prepared
+	// statement was found in the prepared statement cache so that the hit ratio of the cache can be computed. This is
+	// the maximum number of keyspaces that get their own label, requests on keyspaces that are seen once the limit is
+	// reached are counted under the "other" keyspace. 0 disables the metric.
+	MetricsPsCacheMaxKeyspaces int `default:"0" split_words:"true"`
+
+	// Client connections are counted in proxy_client_group_connections and their requests in
+	// proxy_client_group_requests_total labeled with the group of the client address. Comma separated list of
+	// group=address entries where the address is an IP or a subnet in CIDR notation (e.g. "app=10.0.1.0/24,
+	// reports=10.0.2.15"), the first matching entry is used. Clients that don't match any entry are not counted so the
+	// number of labels is bounded by the configured groups. Empty disables the metrics.
+	MetricsClientGroups string `split_words:"true"`
+
+	// Requests that take longer than these thresholds are counted in proxy_slo_breaches_total so that the rate of SLO
+	// breaches can be tracked without computing it from the latency histograms. 0 disables the counter.
+	MetricsSloReadLatencyThresholdMs  int `default:"0" split_words:"true"`
+	MetricsSloWriteLatencyThresholdMs int `default:"0" split_words:"true"`
+
 	// Heartbeat bucket
 
 	HeartbeatIntervalMs int `default:"30000" split_words:"true"`
@@ -87,14 +131,309 @@ type Config struct {
 	HeartbeatRetryBackoffFactor float64 `default:"2" split_words:"true"`
 	HeartbeatFailureThreshold   int     `default:"1" split_words:"true"`
 
+	// HeartbeatFailureGracePeriodMs is how long the heartbeats of a cluster have to keep failing, in addition to
+	// reaching ZDM_HEARTBEAT_FAILURE_THRESHOLD, before the cluster is reported as DOWN by the readiness endpoint so
+	// that isolated failures do not make it flap. 0 reports the cluster as DOWN as soon as the threshold is reached.
+	HeartbeatFailureGracePeriodMs int `default:"0" split_words:"true"`
+
 	//////////////////////////////////////////////////////////////////////
 	/// THE SETTINGS BELOW AREN'T SUPPORTED AND MAY CHANGE AT ANY TIME ///
 	//////////////////////////////////////////////////////////////////////
 
 	SystemQueriesMode string `default:"ORIGIN" split_words:"true"`
 
+	// Cluster that receives the schema introspection reads of the drivers (system_schema, system_virtual_schema and
+	// the legacy system.schema_* tables) so that the schema metadata of the drivers is built from a single cluster,
+	// possible values are ORIGIN and TARGET. Empty means that ZDM_SYSTEM_QUERIES_MODE is used.
+	SchemaQueriesMode string `split_words:"true"`
+
 	ForwardClientCredentialsToOrigin bool `default:"false" split_words:"true"` // only takes effect if both clusters have auth enabled
 
+	CredentialsMapFile             string `split_words:"true"`             // JSON file mapping client usernames to origin / target credentials
+	CredentialsMapReloadIntervalMs int    `default:"0" split_words:"true"` // 0 means that the file is only read at startup
+
+	ForwardCountersToOriginOnly     bool `default:"false" split_words:"true"` // EXECUTE of counter writes (statements prepared against counter tables) is only sent to ORIGIN
+	ForwardCounterReadsToOriginOnly bool `default:"false" split_words:"true"` // EXECUTE of counter reads is only sent to ORIGIN instead of the read cluster
+
+	TreatAlreadyExistsAsSuccess bool `default:"false" split_words:"true"` // AlreadyExists on one cluster is ignored if the other cluster succeeded
+
+	// When the response of a write that is sent to both clusters is returned to the client:
+	//   BOTH:    after both clusters responded, an error is returned if the write failed on either cluster. The clusters
+	//            only diverge if the client doesn't retry a failed write.
+	//   PRIMARY: as soon as the primary cluster (see ZDM_PRIMARY_CLUSTER) responded, the write completes on the other
+	//            cluster in the background. Failures on the other cluster are only tracked in the metrics so the
+	//            clusters diverge silently, the write latency is the latency of the primary cluster.
+	//   EITHER:  as soon as a cluster responded successfully, an error is only returned if the write failed on both
+	//            clusters. Failures on either cluster are only tracked in the metrics and the client may read its
+	//            own write from a cluster that didn't apply it yet. Lightweight transactions return the result of the
+	//            cluster that responded first.
+	// USE statements and PREPARE requests always wait for both clusters. With PRIMARY and EITHER, writes that return
+	// UNPREPARED on TARGET are not retried (see ZDM_TARGET_UNPREPARED_WRITE_REPREPARE_ENABLED).
+	DualWriteConfirmation string `default:"BOTH" split_words:"true"`
+
+	// Clusters on which the requests that the client sends with the tracing flag are traced: BOTH, PRIMARY, ORIGIN or
+	// TARGET. The tracing flag is removed from the requests that are forwarded to the other cluster so that the tracing
+	// overhead is only paid once. The client only gets a tracing id if the response comes from a traced cluster.
+	TracingMode string `default:"BOTH" split_words:"true"`
+
+	PsCacheDumpRedactQueries bool `default:"false" split_words:"true"` // omit the CQL text from the /admin/pscache endpoint
+
+	// Allow changing the proxy at runtime with POST requests to the admin endpoints (e.g. a cutover with
+	// /admin/cutover), only GET requests are served otherwise. The admin endpoints are not authenticated so anyone that
+	// can reach them could change how every request is routed.
+	AdminWriteEnabled bool `default:"false" split_words:"true"`
+
+	ClientHandshakeTimeoutMs int `default:"60000" split_words:"true"` // covers the whole handshake including auth, 0 disables it
+	ClientAuthIdleTimeoutMs  int `default:"0" split_words:"true"`     // how long the client can take to answer AUTHENTICATE or AUTH_CHALLENGE, 0 disables it
+
+	MaxConcurrentHandshakes int `default:"0" split_words:"true"`    // handshakes in progress across all clients, 0 means no limit
+	HandshakeQueueTimeoutMs int `default:"1000" split_words:"true"` // how long STARTUP waits for a handshake to finish before OVERLOADED is returned
+
+	UnexpectedResponseMode string `default:"ERROR" split_words:"true"` // what to send to the client when a cluster response can not be processed
+
+	// Error responses with an error code that is not part of the protocol specification (e.g. vendor specific error
+	// codes) are forwarded to the client as is instead of being handled as unexpected responses (see
+	// ZDM_UNEXPECTED_RESPONSE_MODE). They are counted in proxy_unknown_error_codes_total either way.
+	ForwardUnknownErrorCodes bool `default:"false" split_words:"true"`
+
+	// Comma separated list of keyspaces that clients can access, other keyspaces are rejected (empty allows all keyspaces).
+	// Only SELECT, INSERT, UPDATE, DELETE, BATCH and USE statements are checked. Keyspace names are case sensitive.
+	KeyspaceAllowlist string `split_words:"true"`
+
+	// Reads are routed to the cluster with the lowest recent latency instead of the primary cluster, only enable it if
+	// both clusters are valid read sources. It only applies to connections that were opened with ZDM_READ_MODE=PRIMARY_ONLY.
+	AdaptiveReadRoutingEnabled           bool `default:"false" split_words:"true"`
+	AdaptiveReadRoutingHysteresisPercent int  `default:"20" split_words:"true"` // how much faster the other cluster must be before reads switch to it
+
+	// Scope of the reads that are also sent to the secondary cluster when ZDM_READ_MODE=DUAL_ASYNC_ON_SECONDARY.
+	// AsyncReadsOpcodes is a comma separated list of QUERY and EXECUTE (empty includes both), only SELECT statements
+	// are affected because they are the only reads that are sent asynchronously. Reads that are in scope are then sampled.
+	AsyncReadsOpcodes       string `split_words:"true"`
+	AsyncReadsSamplePercent int    `default:"100" split_words:"true"`
+
+	// How long the async connector waits for the response of an async read before it gives up on it, 0 means that
+	// ZDM_PROXY_REQUEST_TIMEOUT_MS is used. The client response never waits for the secondary cluster but a slow
+	// secondary cluster keeps async reads pending (and their stream ids in use) until they time out, async reads are
+	// skipped when the async connector runs out of stream ids.
+	AsyncReadsMaxWaitMs int `default:"0" split_words:"true"`
+
+	// What happens to protocol events when the client is not reading responses fast enough: BLOCK waits until the client
+	// catches up, DROP discards them so that the events from the clusters keep being consumed. Dropped events are not
+	// resent so drivers may miss topology, status or schema changes with DROP.
+	EventDeliveryMode string `default:"BLOCK" split_words:"true"`
+
+	// Pushes a SCHEMA_CHANGE event (UPDATED KEYSPACE system) to the client connections that registered for schema change
+	// events when a cutover is applied so that drivers refresh their metadata and tools that record events can mark the
+	// moment. The clusters never send this event. Cutovers are always logged and tracked in proxy_cutovers_total and
+	// proxy_last_cutover_timestamp_seconds.
+	CutoverClientEventEnabled bool `default:"false" split_words:"true"`
+
+	// How long a client connection that is shutting down waits for the events and responses that are still queued
+	// to be written to the client before the connection is closed. Events that can not be queued within this time
+	// are dropped and counted in proxy_dropped_events_on_shutdown_total, 0 means that the connection is closed right away.
+	ShutdownFlushTimeoutMs int `default:"1000" split_words:"true"`
+
+	// Requests with the same normalized query (or prepared id) and bound values that are received on the same connection
+	// within the window are counted as likely client retries. Disabled by default because requests need to be decoded.
+	RetryDetectionEnabled  bool `default:"false" split_words:"true"`
+	RetryDetectionWindowMs int  `default:"1000" split_words:"true"`
+
+	// How queries are normalized before they are compared (e.g. by the retry detection): WHITESPACE removes comments
+	// and collapses whitespace, CASE also lower cases everything except string literals and quoted identifiers,
+	// LITERALS also replaces literal values with ? so that queries that only differ in inline values are the same.
+	QueryNormalizationLevel string `default:"WHITESPACE" split_words:"true"`
+
+	// Bounds of each in-memory map that tracks recent requests (the retry detection of a client connection and the
+	// prepared statement quarantine). Entries that were not updated within ZDM_TRACKING_MAP_MAX_AGE_MS expire and the
+	// least recently updated entry is evicted when a map is full. The retry detection expires its entries after
+	// ZDM_RETRY_DETECTION_WINDOW_MS if that is shorter and the quarantine keeps its entries for at least
+	// ZDM_PS_QUARANTINE_COOLDOWN_MS.
+	TrackingMapMaxEntries int `default:"10000" split_words:"true"`
+	TrackingMapMaxAgeMs   int `default:"600000" split_words:"true"`
+
+	// What happens to an EXECUTE (or BATCH) with a prepared id that is not in the prepared statement cache: UNPREPARED
+	// returns UNPREPARED to the client so that it prepares the statement again, FORWARD sends the request unmodified
+	// to both clusters and lets them return UNPREPARED if they don't know the prepared id either.
+	PsCacheMissMode string `default:"UNPREPARED" split_words:"true"`
+
+	// Prepared statements with more bound variables than this are stored in the prepared statement cache without the
+	// column metadata of their variables to bound the memory used by pathological schemas, only the prepared ids and
+	// the query that are needed to route and prepare them again are kept. Bind value routing doesn't apply to these
+	// statements and their mismatch reports don't include the partition key. Statements with CQL functions that are
+	// replaced by the proxy always keep their metadata because it is needed to add the generated values.
+	// 0 disables the limit.
+	PsCacheMaxMetadataColumns int `default:"0" split_words:"true"`
+
+	// BATCH requests with more child statements than ZDM_BATCH_MAX_STATEMENTS or a body larger than
+	// ZDM_BATCH_MAX_SIZE_BYTES (bound values included) are handled according to ZDM_LARGE_BATCH_MODE: WARN logs
+	// a warning and forwards them, REJECT returns an INVALID error to the client without forwarding them.
+	// 0 disables the threshold.
+	BatchMaxStatements int    `default:"0" split_words:"true"`
+	BatchMaxSizeBytes  int    `default:"0" split_words:"true"`
+	LargeBatchMode     string `default:"WARN" split_words:"true"`
+
+	// Responses with a body larger than this are logged as a warning (with the query of the request when it is
+	// known) so that the expensive queries can be found, 0 disables the threshold.
+	LargeResponseThresholdBytes int `default:"0" split_words:"true"`
+
+	// How many event types a client connection can register for across all of its REGISTER requests, a REGISTER
+	// request that exceeds it is rejected with a PROTOCOL_ERROR. 0 means no limit.
+	MaxRegisteredEventTypes int `default:"0" split_words:"true"`
+
+	// How long a read (or PREPARE) request is held back while a cluster that it is forwarded to is DOWN (see
+	// ZDM_HEARTBEAT_FAILURE_THRESHOLD and ZDM_HEARTBEAT_FAILURE_GRACE_PERIOD_MS), it is forwarded once the control
+	// connection of the cluster is reconnected or when the timeout expires. The requests of a client connection that
+	// are held back are forwarded in the order in which they were received. Other requests are rejected with
+	// OVERLOADED while the cluster is DOWN because they are not safe to replay. The connections of the client
+	// connection to the clusters are not re-established, the client connection is closed if one of them is closed
+	// while the requests are held back. 0 disables it.
+	ClusterDownBufferTimeoutMs int `default:"0" split_words:"true"`
+	// How many requests are held back at most across all client connections while a cluster is DOWN, the
+	// requests that don't fit are rejected with OVERLOADED. 0 means no limit.
+	ClusterDownBufferMaxRequests int `default:"1000" split_words:"true"`
+
+	// How many statements per second are prepared again when the prepared statement cache is re-prepared with the
+	// /admin/pscache/reprepare endpoint (see ZDM_ADMIN_WRITE_ENABLED), each statement is prepared on every assigned
+	// host of both clusters.
+	PsReprepareStatementsPerSecond int `default:"50" split_words:"true"`
+
+	// Accept protocol v5 connections instead of returning a protocol error that makes the client downgrade to v4.
+	// Both clusters must support v5 and segment compression is not supported: a v5 STARTUP request that negotiates
+	// compression is rejected with a protocol error.
+	ProtocolV5Enabled bool `default:"false" split_words:"true"`
+
+	// Artificial delay added to every response from each cluster, only meant for testing how clients behave when
+	// a cluster is slow. It can also be changed at runtime with the /admin/injectedlatency endpoint, see
+	// ZDM_INJECTED_LATENCY_ADMIN_ENABLED.
+	OriginInjectedLatencyMs int `default:"0" split_words:"true"`
+	TargetInjectedLatencyMs int `default:"0" split_words:"true"`
+
+	// Upper bound of the injected latency of each cluster, whether it is configured or changed at runtime.
+	InjectedLatencyMaxMs int `default:"10000" split_words:"true"`
+
+	// Allow changing the injected latency at runtime with a POST to the /admin/injectedlatency endpoint. The admin
+	// endpoints are not authenticated so anyone that can reach them could slow down every request.
+	InjectedLatencyAdminEnabled bool `default:"false" split_words:"true"`
+
+	// Prefix the message of UNAUTHORIZED errors returned to the client with the cluster that returned them so that
+	// permissions that are missing (or were revoked) on a single cluster are easy to tell apart.
+	UnauthorizedErrorsIncludeCluster bool `default:"false" split_words:"true"`
+
+	// Bound EXECUTE requests with a value for this column (the name of the bound variable in the prepared metadata)
+	// are forwarded only to the cluster that ZDM_BIND_VALUE_ROUTING_RULES assigns to that value, e.g. to move tenants
+	// to TARGET one at a time. Disabled by default because the bound values of every EXECUTE need to be decoded.
+	// QUERY requests are not routed because their bound values are sent without type information.
+	BindValueRoutingColumn string `split_words:"true"`
+
+	// Comma separated list of value:CLUSTER pairs (e.g. "tenant1:TARGET,tenant2:ORIGIN"), values are compared with
+	// the text representation of the decoded bound value. Requests with other values are forwarded as usual.
+	BindValueRoutingRules string `split_words:"true"`
+
+	// Comma separated list of keyspace:CLUSTER rules (e.g. "*_new:TARGET,tenantA_*:ORIGIN"), the requests that access a
+	// keyspace that matches a rule are forwarded to that cluster only, reads and writes alike. The keyspace can be an exact
+	// name, a prefix (ending with *) or a suffix (starting with *), the first matching rule is used. Keyspace names are
+	// case-sensitive and compared in their internal form (i.e. lower case unless they are quoted in the query).
+	// QUERY, PREPARE and EXECUTE requests are routed, requests that access keyspaces of different clusters are forwarded as usual.
+	KeyspaceRoutingRules string `split_words:"true"`
+
+	// Comma separated list of keyspace:CLUSTER rules with the same format as ZDM_KEYSPACE_ROUTING_RULES, the reads of a
+	// keyspace that matches a rule are forwarded to that cluster instead of the primary cluster so that reads can be cut
+	// over one keyspace at a time. Writes are still forwarded to both clusters. Reads that access keyspaces of different
+	// clusters, system queries and schema queries are forwarded as usual.
+	KeyspaceReadRoutingRules string `split_words:"true"`
+
+	// schema_version that the intercepted system.local and system.peers queries return when virtualization is enabled:
+	// HOST returns the schema version of the host that each proxy instance is mapped to, SYNTHETIC returns the same
+	// fixed schema version for every proxy instance so that drivers always see schema agreement even though the hosts
+	// of both clusters have different schema versions. Note that with SYNTHETIC drivers also see schema agreement right
+	// after a schema change, before the hosts actually agree on the new schema.
+	SchemaVersionMode string `default:"HOST" split_words:"true"`
+
+	// Identity that the proxy presents to the clients so that the clients that validate the server identity during
+	// the handshake see the same virtual cluster regardless of the cluster that answered, empty values keep the values
+	// of the clusters. The cluster name and the release, DSE and CQL versions are returned by the intercepted
+	// system.local and system.peers queries, the CQL version and the product type (e.g. DATASTAX_APOLLO) also replace
+	// the CQL_VERSION and PRODUCT_TYPE options of the SUPPORTED responses to OPTIONS requests.
+	SpoofedClusterName    string `split_words:"true"`
+	SpoofedReleaseVersion string `split_words:"true"`
+	SpoofedDseVersion     string `split_words:"true"`
+	SpoofedCqlVersion     string `split_words:"true"`
+	SpoofedProductType    string `split_words:"true"`
+
+	// Comma separated lists of the client's STARTUP options that are not forwarded to ORIGIN and TARGET respectively
+	// (empty forwards every option), e.g. APPLICATION_NAME,APPLICATION_VERSION to mask the application or
+	// DRIVER_NAME,DRIVER_VERSION to hide the driver identity from a cluster. Option names are case insensitive.
+	// CQL_VERSION, COMPRESSION and KEYSPACE can not be stripped because the connection depends on them.
+	OriginStartupOptionsStripped string `split_words:"true"`
+	TargetStartupOptionsStripped string `split_words:"true"`
+
+	// When a bound write succeeds on ORIGIN but TARGET returns UNPREPARED (e.g. a TARGET node was restarted), the
+	// statement is prepared again on TARGET and the write is retried on TARGET only instead of returning UNPREPARED to
+	// the client, which would make the client prepare the statement again and retry the write on both clusters.
+	TargetUnpreparedWriteReprepareEnabled bool `default:"false" split_words:"true"`
+
+	// When a read fails on the cluster it was forwarded to with an error that is caused by the availability of that
+	// cluster (e.g. read timeout, unavailable or overloaded), the read is retried on the other cluster and its response
+	// is returned to the client if it succeeds, otherwise the original error is returned. Reads that are routed to a
+	// single cluster by the bind value or keyspace routers are never failed over.
+	ReadFailoverEnabled bool `default:"false" split_words:"true"`
+
+	// Reads that would be forwarded to a single cluster are sent to both clusters and the first successful response
+	// is returned to the client, the error of the cluster the read would have been forwarded to is only returned when
+	// both clusters fail. Only enable this when both clusters contain the same data. Reads that are routed to a single
+	// cluster by the bind value or keyspace routers are not affected, this can not be used with ZDM_READ_MODE
+	// DUAL_ASYNC_ON_SECONDARY.
+	ReadRaceEnabled bool `default:"false" split_words:"true"`
+
+	// Compare the rows that both clusters returned for the reads that ZDM_READ_RACE_ENABLED sends to both clusters and
+	// count the differences by category: TARGET returned rows that ORIGIN didn't return (target_extra_rows), ORIGIN
+	// returned rows that TARGET didn't return (origin_extra_rows) or both clusters returned rows that the other one
+	// didn't return, e.g. because a column has different values (values_differ). Results with more pages are not
+	// compared. ZDM_READ_COMPARISON_TARGET_AHEAD_MODE tells how target_extra_rows differences are handled: MISMATCH
+	// logs them as a warning like the other categories, EXPECTED only counts them because TARGET legitimately has rows
+	// that ORIGIN doesn't have yet (e.g. while a backfill is in progress).
+	// ZDM_READ_COMPARISON_METADATA_MODE tells how the column metadata of results with equal rows is compared, the
+	// results whose metadata differs are counted separately (metadata_only): NORMALIZE ignores the differences that
+	// don't change how the values are encoded (types described by their Cassandra class name, frozen and reversed
+	// types, keyspace and table names), STRICT compares the metadata as it is returned and IGNORE doesn't compare it.
+	ReadComparisonEnabled         bool   `default:"false" split_words:"true"`
+	ReadComparisonTargetAheadMode string `default:"MISMATCH" split_words:"true"`
+	ReadComparisonMetadataMode    string `default:"NORMALIZE" split_words:"true"`
+
+	// A prepared statement that fails on TARGET (e.g. because of a schema difference) this many consecutive times
+	// while it succeeds on ORIGIN is quarantined: its EXECUTE requests are only forwarded to ORIGIN until the cooldown
+	// expires. UNPREPARED errors are not counted. 0 disables the quarantine.
+	PsQuarantineFailureThreshold int `default:"0" split_words:"true"`
+	PsQuarantineCooldownMs       int `default:"60000" split_words:"true"`
+
+	// Bridges the compression that clients negotiate (LZ4 or Snappy) with ORIGIN and TARGET respectively when the
+	// cluster doesn't support it: the COMPRESSION option is not forwarded to the cluster, the requests that are
+	// forwarded to it are decompressed by the proxy and its responses are compressed before they are returned to the
+	// client. This only applies to protocol versions up to v4 because segment compression (v5) is not supported.
+	OriginCompressionBridgeEnabled bool `default:"false" split_words:"true"`
+	TargetCompressionBridgeEnabled bool `default:"false" split_words:"true"`
+
+	// Responses with a body smaller than this are returned uncompressed by the compression bridge because compressing
+	// tiny frames wastes CPU, this is valid because compression is flagged per frame. Requests are never compressed by
+	// the proxy: they are forwarded to the clusters as the client sent them or uncompressed by the bridge.
+	// 0 compresses every response.
+	CompressionBridgeMinBodySizeBytes int `default:"0" split_words:"true"`
+
+	// Serves the OPTIONS requests that clients send during the handshake from a SUPPORTED response that is cached by
+	// the proxy instead of forwarding them to both clusters. The cached response is built from the responses of both
+	// clusters (TARGET options restricted to the values that ORIGIN supports as well) and it is refreshed by the next
+	// OPTIONS request after the refresh interval elapses. OPTIONS requests that are sent after the handshake (e.g.
+	// driver heartbeats) are always forwarded because they keep the connections to the clusters alive.
+	OptionsCacheEnabled           bool `default:"false" split_words:"true"`
+	OptionsCacheRefreshIntervalMs int  `default:"60000" split_words:"true"`
+
+	// Before accepting client connections, check that both clusters are reachable, that their native protocol versions
+	// are compatible with the proxy configuration and that the keyspaces of ZDM_STARTUP_PREFLIGHT_KEYSPACES (or of
+	// ZDM_KEYSPACE_ALLOWLIST if it is empty) exist on both clusters. The proxy fails to start with a report of every
+	// problem that was found. If no keyspaces are configured, the keyspaces that only exist on one cluster are logged.
+	StartupPreflightEnabled   bool   `default:"false" split_words:"true"`
+	StartupPreflightKeyspaces string `split_words:"true"`
+
 	OriginEnableHostAssignment bool `default:"true" split_words:"true"`
 	TargetEnableHostAssignment bool `default:"true" split_words:"true"`
 
@@ -119,6 +458,19 @@ type Config struct {
 
 	AsyncConnectorWriteQueueSizeFrames int `default:"2048" split_words:"true"`
 	AsyncConnectorWriteBufferSizeBytes int `default:"4096" split_words:"true"`
+
+	// Socket (SO_RCVBUF / SO_SNDBUF) buffer sizes, 0 means that the OS default is used
+
+	ClientSocketReadBufferSizeBytes   int `default:"0" split_words:"true"`
+	ClientSocketWriteBufferSizeBytes  int `default:"0" split_words:"true"`
+	ClusterSocketReadBufferSizeBytes  int `default:"0" split_words:"true"`
+	ClusterSocketWriteBufferSizeBytes int `default:"0" split_words:"true"`
+
+	// TCP_NODELAY on client and cluster sockets. The write coalescers already batch frames into larger writes
+	// (see the *WriteBufferSizeBytes settings) so enabling Nagle's algorithm on top of that (false) only adds latency
+	// and should only be considered when the network is saturated with small packets.
+	ClientTcpNoDelay  bool `default:"true" split_words:"true"`
+	ClusterTcpNoDelay bool `default:"true" split_words:"true"`
 }
 
 func (c *Config) String() string {
@@ -275,11 +627,270 @@ func (c *Config) Validate() error {
 		return err
 	}
 
-	_, err = c.ParseReadMode()
+	_, err = c.ParseSchemaQueriesMode()
+	if err != nil {
+		return err
+	}
+
+	readMode, err := c.ParseReadMode()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParseDualWriteConfirmation()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParseTracingMode()
+	if err != nil {
+		return err
+	}
+
+	if c.ReadComparisonEnabled && !c.ReadRaceEnabled {
+		return fmt.Errorf("invalid ZDM_READ_COMPARISON_ENABLED (%v), it requires ZDM_READ_RACE_ENABLED", c.ReadComparisonEnabled)
+	}
+
+	_, err = c.ParseReadComparisonTargetAheadMode()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParseReadComparisonMetadataMode()
+	if err != nil {
+		return err
+	}
+
+	if c.ReadRaceEnabled && readMode == common.ReadModeDualAsyncOnSecondary {
+		return fmt.Errorf("invalid ZDM_READ_RACE_ENABLED (%v), it can not be used with ZDM_READ_MODE %v",
+			c.ReadRaceEnabled, ReadModeDualAsyncOnSecondary)
+	}
+
+	_, err = c.ParseUnexpectedResponseMode()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParseEventDeliveryMode()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParsePsCacheMissMode()
+	if err != nil {
+		return err
+	}
+
+	if c.MetricsErrorRateWindowMs <= 0 {
+		return fmt.Errorf("invalid ZDM_METRICS_ERROR_RATE_WINDOW_MS (%v), it must be positive", c.MetricsErrorRateWindowMs)
+	}
+
+	if c.MetricsDualWriteAgreementWindowMs <= 0 {
+		return fmt.Errorf("invalid ZDM_METRICS_DUAL_WRITE_AGREEMENT_WINDOW_MS (%v), it must be positive", c.MetricsDualWriteAgreementWindowMs)
+	}
+
+	if c.MetricsTableDivergenceMaxTables < 0 {
+		return fmt.Errorf("invalid ZDM_METRICS_TABLE_DIVERGENCE_MAX_TABLES (%v), it must not be negative", c.MetricsTableDivergenceMaxTables)
+	}
+
+	if c.MetricsPsCacheMaxKeyspaces < 0 {
+		return fmt.Errorf("invalid ZDM_METRICS_PS_CACHE_MAX_KEYSPACES (%v), it must not be negative", c.MetricsPsCacheMaxKeyspaces)
+	}
+
+	if c.MetricsSloReadLatencyThresholdMs < 0 {
+		return fmt.Errorf("invalid ZDM_METRICS_SLO_READ_LATENCY_THRESHOLD_MS (%v), it must not be negative", c.MetricsSloReadLatencyThresholdMs)
+	}
+
+	if c.MetricsSloWriteLatencyThresholdMs < 0 {
+		return fmt.Errorf("invalid ZDM_METRICS_SLO_WRITE_LATENCY_THRESHOLD_MS (%v), it must not be negative", c.MetricsSloWriteLatencyThresholdMs)
+	}
+
+	if c.CompressionBridgeMinBodySizeBytes < 0 {
+		return fmt.Errorf("invalid ZDM_COMPRESSION_BRIDGE_MIN_BODY_SIZE_BYTES (%v), it must not be negative", c.CompressionBridgeMinBodySizeBytes)
+	}
+
+	if c.MetricsStatsdSampleRate <= 0 || c.MetricsStatsdSampleRate > 1 {
+		return fmt.Errorf("invalid ZDM_METRICS_STATSD_SAMPLE_RATE (%v), it must be greater than 0 and at most 1", c.MetricsStatsdSampleRate)
+	}
+
+	_, err = c.ParseMetricsStatsdTags()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParseAsyncReadsOpcodes()
 	if err != nil {
 		return err
 	}
 
+	if c.AsyncReadsSamplePercent < 0 || c.AsyncReadsSamplePercent > 100 {
+		return fmt.Errorf("invalid ZDM_ASYNC_READS_SAMPLE_PERCENT (%v), it must be between 0 and 100", c.AsyncReadsSamplePercent)
+	}
+
+	if c.AsyncReadsMaxWaitMs < 0 {
+		return fmt.Errorf("invalid ZDM_ASYNC_READS_MAX_WAIT_MS (%v), it must not be negative", c.AsyncReadsMaxWaitMs)
+	}
+
+	if c.OriginConnectTimeoutMs < 0 {
+		return fmt.Errorf("invalid ZDM_ORIGIN_CONNECT_TIMEOUT_MS (%v), it must not be negative", c.OriginConnectTimeoutMs)
+	}
+
+	if c.TargetConnectTimeoutMs < 0 {
+		return fmt.Errorf("invalid ZDM_TARGET_CONNECT_TIMEOUT_MS (%v), it must not be negative", c.TargetConnectTimeoutMs)
+	}
+
+	if c.ShutdownFlushTimeoutMs < 0 {
+		return fmt.Errorf("invalid ZDM_SHUTDOWN_FLUSH_TIMEOUT_MS (%v), it must not be negative", c.ShutdownFlushTimeoutMs)
+	}
+
+	if c.ProxyMaxClientConnectionsPerIp < 0 {
+		return fmt.Errorf("invalid ZDM_PROXY_MAX_CLIENT_CONNECTIONS_PER_IP (%v), it must not be negative", c.ProxyMaxClientConnectionsPerIp)
+	}
+
+	if c.ClientAuthIdleTimeoutMs < 0 {
+		return fmt.Errorf("invalid ZDM_CLIENT_AUTH_IDLE_TIMEOUT_MS (%v), it must not be negative", c.ClientAuthIdleTimeoutMs)
+	}
+
+	if c.MaxRegisteredEventTypes < 0 {
+		return fmt.Errorf("invalid ZDM_MAX_REGISTERED_EVENT_TYPES (%v), it must not be negative", c.MaxRegisteredEventTypes)
+	}
+
+	if c.ClusterDownBufferTimeoutMs < 0 {
+		return fmt.Errorf("invalid ZDM_CLUSTER_DOWN_BUFFER_TIMEOUT_MS (%v), it must not be negative", c.ClusterDownBufferTimeoutMs)
+	}
+
+	if c.ClusterDownBufferMaxRequests < 0 {
+		return fmt.Errorf("invalid ZDM_CLUSTER_DOWN_BUFFER_MAX_REQUESTS (%v), it must not be negative", c.ClusterDownBufferMaxRequests)
+	}
+
+	if c.MaxConcurrentHandshakes < 0 {
+		return fmt.Errorf("invalid ZDM_MAX_CONCURRENT_HANDSHAKES (%v), it must not be negative", c.MaxConcurrentHandshakes)
+	}
+
+	if c.HandshakeQueueTimeoutMs < 0 {
+		return fmt.Errorf("invalid ZDM_HANDSHAKE_QUEUE_TIMEOUT_MS (%v), it must not be negative", c.HandshakeQueueTimeoutMs)
+	}
+
+	if c.PsQuarantineFailureThreshold < 0 {
+		return fmt.Errorf("invalid ZDM_PS_QUARANTINE_FAILURE_THRESHOLD (%v), it must not be negative", c.PsQuarantineFailureThreshold)
+	}
+
+	if c.PsQuarantineFailureThreshold > 0 && c.PsQuarantineCooldownMs <= 0 {
+		return fmt.Errorf("invalid ZDM_PS_QUARANTINE_COOLDOWN_MS (%v), it must be positive", c.PsQuarantineCooldownMs)
+	}
+
+	if c.HeartbeatFailureGracePeriodMs < 0 {
+		return fmt.Errorf("invalid ZDM_HEARTBEAT_FAILURE_GRACE_PERIOD_MS (%v), it must not be negative", c.HeartbeatFailureGracePeriodMs)
+	}
+
+	if c.PsCacheMaxMetadataColumns < 0 {
+		return fmt.Errorf("invalid ZDM_PS_CACHE_MAX_METADATA_COLUMNS (%v), it must not be negative", c.PsCacheMaxMetadataColumns)
+	}
+
+	if c.PsReprepareStatementsPerSecond <= 0 {
+		return fmt.Errorf("invalid ZDM_PS_REPREPARE_STATEMENTS_PER_SECOND (%v), it must be positive", c.PsReprepareStatementsPerSecond)
+	}
+
+	if c.OriginInjectedLatencyMs < 0 {
+		return fmt.Errorf("invalid ZDM_ORIGIN_INJECTED_LATENCY_MS (%v), it must not be negative", c.OriginInjectedLatencyMs)
+	}
+
+	if c.TargetInjectedLatencyMs < 0 {
+		return fmt.Errorf("invalid ZDM_TARGET_INJECTED_LATENCY_MS (%v), it must not be negative", c.TargetInjectedLatencyMs)
+	}
+
+	if c.InjectedLatencyMaxMs <= 0 {
+		return fmt.Errorf("invalid ZDM_INJECTED_LATENCY_MAX_MS (%v), it must be positive", c.InjectedLatencyMaxMs)
+	}
+
+	if c.OriginInjectedLatencyMs > c.InjectedLatencyMaxMs {
+		return fmt.Errorf("invalid ZDM_ORIGIN_INJECTED_LATENCY_MS (%v), it must not be greater than ZDM_INJECTED_LATENCY_MAX_MS (%v)",
+			c.OriginInjectedLatencyMs, c.InjectedLatencyMaxMs)
+	}
+
+	if c.TargetInjectedLatencyMs > c.InjectedLatencyMaxMs {
+		return fmt.Errorf("invalid ZDM_TARGET_INJECTED_LATENCY_MS (%v), it must not be greater than ZDM_INJECTED_LATENCY_MAX_MS (%v)",
+			c.TargetInjectedLatencyMs, c.InjectedLatencyMaxMs)
+	}
+
+	_, err = c.ParseSchemaVersionMode()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParseLargeBatchMode()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParseQueryNormalizationLevel()
+	if err != nil {
+		return err
+	}
+
+	if c.BatchMaxStatements < 0 {
+		return fmt.Errorf("invalid ZDM_BATCH_MAX_STATEMENTS (%v), it must not be negative", c.BatchMaxStatements)
+	}
+
+	if c.BatchMaxSizeBytes < 0 {
+		return fmt.Errorf("invalid ZDM_BATCH_MAX_SIZE_BYTES (%v), it must not be negative", c.BatchMaxSizeBytes)
+	}
+
+	if c.LargeResponseThresholdBytes < 0 {
+		return fmt.Errorf("invalid ZDM_LARGE_RESPONSE_THRESHOLD_BYTES (%v), it must not be negative", c.LargeResponseThresholdBytes)
+	}
+
+	_, err = c.ParseBindValueRoutingRules()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParseMetricsClientGroups()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParseKeyspaceRoutingRules()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParseKeyspaceReadRoutingRules()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParseOriginStartupOptionsStripped()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ParseTargetStartupOptionsStripped()
+	if err != nil {
+		return err
+	}
+
+	if c.RetryDetectionEnabled && c.RetryDetectionWindowMs <= 0 {
+		return fmt.Errorf("invalid ZDM_RETRY_DETECTION_WINDOW_MS (%v), it must be positive", c.RetryDetectionWindowMs)
+	}
+
+	if c.TrackingMapMaxEntries <= 0 {
+		return fmt.Errorf("invalid ZDM_TRACKING_MAP_MAX_ENTRIES (%v), it must be positive", c.TrackingMapMaxEntries)
+	}
+
+	if c.TrackingMapMaxAgeMs <= 0 {
+		return fmt.Errorf("invalid ZDM_TRACKING_MAP_MAX_AGE_MS (%v), it must be positive", c.TrackingMapMaxAgeMs)
+	}
+
+	if c.OptionsCacheEnabled && c.OptionsCacheRefreshIntervalMs <= 0 {
+		return fmt.Errorf("invalid ZDM_OPTIONS_CACHE_REFRESH_INTERVAL_MS (%v), it must be positive", c.OptionsCacheRefreshIntervalMs)
+	}
+
+	if c.AdaptiveReadRoutingHysteresisPercent < 0 || c.AdaptiveReadRoutingHysteresisPercent >= 100 {
+		return fmt.Errorf("invalid ZDM_ADAPTIVE_READ_ROUTING_HYSTERESIS_PERCENT (%v), it must be between 0 and 99",
+			c.AdaptiveReadRoutingHysteresisPercent)
+	}
+
 	return nil
 }
 
@@ -300,13 +911,34 @@ func (c *Config) ParseSystemQueriesMode() (common.SystemQueriesMode, error) {
 	}
 }
 
+// ParseSchemaQueriesMode returns the cluster that receives the schema introspection reads, see ZDM_SCHEMA_QUERIES_MODE.
+func (c *Config) ParseSchemaQueriesMode() (common.SystemQueriesMode, error) {
+	switch strings.ToUpper(c.SchemaQueriesMode) {
+	case "":
+		return c.ParseSystemQueriesMode()
+	case SystemQueriesModeTarget:
+		return common.SystemQueriesModeTarget, nil
+	case SystemQueriesModeOrigin:
+		return common.SystemQueriesModeOrigin, nil
+	default:
+		return common.SystemQueriesModeUndefined, fmt.Errorf("invalid value for ZDM_SCHEMA_QUERIES_MODE; possible values are: %v and %v",
+			SystemQueriesModeTarget, SystemQueriesModeOrigin)
+	}
+}
+
 const (
 	PrimaryClusterOrigin = "ORIGIN"
 	PrimaryClusterTarget = "TARGET"
 )
 
 func (c *Config) ParsePrimaryCluster() (common.ClusterType, error) {
-	switch strings.ToUpper(c.PrimaryCluster) {
+	return ParsePrimaryClusterValue(c.PrimaryCluster)
+}
+
+// ParsePrimaryClusterValue parses a value of ZDM_PRIMARY_CLUSTER, it is also used for the settings that are changed at
+// runtime (e.g. with a cutover).
+func ParsePrimaryClusterValue(value string) (common.ClusterType, error) {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
 	case PrimaryClusterOrigin:
 		return common.ClusterTypeOrigin, nil
 	case PrimaryClusterTarget:
@@ -323,7 +955,13 @@ const (
 )
 
 func (c *Config) ParseReadMode() (common.ReadMode, error) {
-	switch strings.ToUpper(c.ReadMode) {
+	return ParseReadModeValue(c.ReadMode)
+}
+
+// ParseReadModeValue parses a value of ZDM_READ_MODE, it is also used for the settings that are changed at runtime
+// (e.g. with a cutover).
+func ParseReadModeValue(value string) (common.ReadMode, error) {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
 	case ReadModePrimaryOnly:
 		return common.ReadModePrimaryOnly, nil
 	case ReadModeDualAsyncOnSecondary:
@@ -334,6 +972,391 @@ func (c *Config) ParseReadMode() (common.ReadMode, error) {
 	}
 }
 
+const (
+	AsyncReadsOpcodeQuery   = "QUERY"
+	AsyncReadsOpcodeExecute = "EXECUTE"
+)
+
+// ParseAsyncReadsOpcodes returns the opcodes of the reads that can be sent to the secondary cluster,
+// an empty slice means that reads of every opcode can be sent.
+func (c *Config) ParseAsyncReadsOpcodes() ([]primitive.OpCode, error) {
+	opCodes := make([]primitive.OpCode, 0)
+	for _, opCode := range strings.Split(c.AsyncReadsOpcodes, ",") {
+		switch strings.ToUpper(strings.TrimSpace(opCode)) {
+		case "":
+		case AsyncReadsOpcodeQuery:
+			opCodes = append(opCodes, primitive.OpCodeQuery)
+		case AsyncReadsOpcodeExecute:
+			opCodes = append(opCodes, primitive.OpCodeExecute)
+		default:
+			return nil, fmt.Errorf("invalid value for ZDM_ASYNC_READS_OPCODES (%v); possible values are: %v and %v",
+				strings.TrimSpace(opCode), AsyncReadsOpcodeQuery, AsyncReadsOpcodeExecute)
+		}
+	}
+	return opCodes, nil
+}
+
+func (c *Config) ParseKeyspaceAllowlist() []string {
+	return parseKeyspaces(c.KeyspaceAllowlist)
+}
+
+// ParseStartupPreflightKeyspaces returns the keyspaces that the startup preflight checks on both clusters,
+// ZDM_KEYSPACE_ALLOWLIST is used if ZDM_STARTUP_PREFLIGHT_KEYSPACES is empty.
+func (c *Config) ParseStartupPreflightKeyspaces() []string {
+	keyspaces := parseKeyspaces(c.StartupPreflightKeyspaces)
+	if len(keyspaces) == 0 {
+		return c.ParseKeyspaceAllowlist()
+	}
+	return keyspaces
+}
+
+func parseKeyspaces(setting string) []string {
+	keyspaces := make([]string, 0)
+	for _, keyspace := range strings.Split(setting, ",") {
+		keyspace = strings.TrimSpace(keyspace)
+		if keyspace != "" {
+			keyspaces = append(keyspaces, keyspace)
+		}
+	}
+	return keyspaces
+}
+
+// ParseBindValueRoutingRules returns the cluster that requests are forwarded to for each bound value of
+// ZDM_BIND_VALUE_ROUTING_COLUMN, an empty map means that bind value routing is disabled.
+func (c *Config) ParseBindValueRoutingRules() (map[string]common.ClusterType, error) {
+	rules := make(map[string]common.ClusterType)
+	for _, rule := range strings.Split(c.BindValueRoutingRules, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		separatorIdx := strings.LastIndex(rule, ":")
+		if separatorIdx <= 0 {
+			return nil, fmt.Errorf("invalid value for ZDM_BIND_VALUE_ROUTING_RULES (%v); rules must have the format value:CLUSTER", rule)
+		}
+		value := strings.TrimSpace(rule[:separatorIdx])
+		switch strings.ToUpper(strings.TrimSpace(rule[separatorIdx+1:])) {
+		case PrimaryClusterOrigin:
+			rules[value] = common.ClusterTypeOrigin
+		case PrimaryClusterTarget:
+			rules[value] = common.ClusterTypeTarget
+		default:
+			return nil, fmt.Errorf("invalid value for ZDM_BIND_VALUE_ROUTING_RULES (%v); possible clusters are: %v and %v",
+				rule, PrimaryClusterOrigin, PrimaryClusterTarget)
+		}
+	}
+
+	column := strings.TrimSpace(c.BindValueRoutingColumn)
+	if column == "" && len(rules) > 0 {
+		return nil, fmt.Errorf("ZDM_BIND_VALUE_ROUTING_RULES is set but ZDM_BIND_VALUE_ROUTING_COLUMN is not")
+	}
+	if column != "" && len(rules) == 0 {
+		return nil, fmt.Errorf("ZDM_BIND_VALUE_ROUTING_COLUMN is set but ZDM_BIND_VALUE_ROUTING_RULES is not")
+	}
+	return rules, nil
+}
+
+// ParseKeyspaceRoutingRules returns the rules of ZDM_KEYSPACE_ROUTING_RULES in the order that they were configured,
+// an empty slice means that keyspace routing is disabled.
+func (c *Config) ParseKeyspaceRoutingRules() ([]*common.KeyspaceRoutingRule, error) {
+	return parseKeyspaceRoutingRules(c.KeyspaceRoutingRules, "ZDM_KEYSPACE_ROUTING_RULES")
+}
+
+// ParseKeyspaceReadRoutingRules returns the rules of ZDM_KEYSPACE_READ_ROUTING_RULES in the order that they were
+// configured, an empty slice means that reads are forwarded to the primary cluster regardless of their keyspace.
+func (c *Config) ParseKeyspaceReadRoutingRules() ([]*common.KeyspaceRoutingRule, error) {
+	return parseKeyspaceRoutingRules(c.KeyspaceReadRoutingRules, "ZDM_KEYSPACE_READ_ROUTING_RULES")
+}
+
+func parseKeyspaceRoutingRules(setting string, settingName string) ([]*common.KeyspaceRoutingRule, error) {
+	rules := make([]*common.KeyspaceRoutingRule, 0)
+	for _, rule := range strings.Split(setting, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		separatorIdx := strings.LastIndex(rule, ":")
+		if separatorIdx <= 0 {
+			return nil, fmt.Errorf("invalid value for %v (%v); rules must have the format keyspace:CLUSTER", settingName, rule)
+		}
+		pattern := strings.TrimSpace(rule[:separatorIdx])
+		if strings.Trim(pattern, "*") == "" || strings.Contains(strings.TrimSuffix(strings.TrimPrefix(pattern, "*"), "*"), "*") ||
+			(strings.HasPrefix(pattern, "*") && strings.HasSuffix(pattern, "*")) {
+			return nil, fmt.Errorf("invalid value for %v (%v); the keyspace can only have a * wildcard at the start or at the end", settingName, rule)
+		}
+		var cluster common.ClusterType
+		switch strings.ToUpper(strings.TrimSpace(rule[separatorIdx+1:])) {
+		case PrimaryClusterOrigin:
+			cluster = common.ClusterTypeOrigin
+		case PrimaryClusterTarget:
+			cluster = common.ClusterTypeTarget
+		default:
+			return nil, fmt.Errorf("invalid value for %v (%v); possible clusters are: %v and %v",
+				settingName, rule, PrimaryClusterOrigin, PrimaryClusterTarget)
+		}
+		rules = append(rules, &common.KeyspaceRoutingRule{Pattern: pattern, Cluster: cluster})
+	}
+	return rules, nil
+}
+
+// ParseMetricsClientGroups returns the groups of ZDM_METRICS_CLIENT_GROUPS in the order that they were configured,
+// an empty slice means that the client group metrics are disabled.
+func (c *Config) ParseMetricsClientGroups() ([]*common.ClientGroup, error) {
+	groups := make([]*common.ClientGroup, 0)
+	for _, entry := range strings.Split(c.MetricsClientGroups, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		separatorIdx := strings.Index(entry, "=")
+		if separatorIdx <= 0 {
+			return nil, fmt.Errorf("invalid value for ZDM_METRICS_CLIENT_GROUPS (%v); entries must have the format group=address", entry)
+		}
+		name := strings.TrimSpace(entry[:separatorIdx])
+		address := strings.TrimSpace(entry[separatorIdx+1:])
+		var network *net.IPNet
+		if strings.Contains(address, "/") {
+			_, parsedNetwork, err := net.ParseCIDR(address)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for ZDM_METRICS_CLIENT_GROUPS (%v); %v is not a valid subnet", entry, address)
+			}
+			network = parsedNetwork
+		} else {
+			ip := net.ParseIP(address)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid value for ZDM_METRICS_CLIENT_GROUPS (%v); %v is not a valid IP", entry, address)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		}
+		groups = append(groups, &common.ClientGroup{Name: name, Network: network})
+	}
+	return groups, nil
+}
+
+const (
+	UnexpectedResponseModeError       = "ERROR"
+	UnexpectedResponseModePassthrough = "PASSTHROUGH"
+)
+
+func (c *Config) ParseUnexpectedResponseMode() (common.UnexpectedResponseMode, error) {
+	switch strings.ToUpper(c.UnexpectedResponseMode) {
+	case UnexpectedResponseModeError:
+		return common.UnexpectedResponseModeError, nil
+	case UnexpectedResponseModePassthrough:
+		return common.UnexpectedResponseModePassthrough, nil
+	default:
+		return common.UnexpectedResponseModeUndefined, fmt.Errorf("invalid value for ZDM_UNEXPECTED_RESPONSE_MODE; possible values are: %v and %v",
+			UnexpectedResponseModeError, UnexpectedResponseModePassthrough)
+	}
+}
+
+const (
+	EventDeliveryModeDrop  = "DROP"
+	EventDeliveryModeBlock = "BLOCK"
+)
+
+func (c *Config) ParseEventDeliveryMode() (common.EventDeliveryMode, error) {
+	switch strings.ToUpper(c.EventDeliveryMode) {
+	case EventDeliveryModeDrop:
+		return common.EventDeliveryModeDrop, nil
+	case EventDeliveryModeBlock:
+		return common.EventDeliveryModeBlock, nil
+	default:
+		return common.EventDeliveryModeUndefined, fmt.Errorf("invalid value for ZDM_EVENT_DELIVERY_MODE; possible values are: %v and %v",
+			EventDeliveryModeDrop, EventDeliveryModeBlock)
+	}
+}
+
+const (
+	PsCacheMissModeUnprepared = "UNPREPARED"
+	PsCacheMissModeForward    = "FORWARD"
+)
+
+func (c *Config) ParsePsCacheMissMode() (common.PsCacheMissMode, error) {
+	switch strings.ToUpper(c.PsCacheMissMode) {
+	case PsCacheMissModeUnprepared:
+		return common.PsCacheMissModeUnprepared, nil
+	case PsCacheMissModeForward:
+		return common.PsCacheMissModeForward, nil
+	default:
+		return common.PsCacheMissModeUndefined, fmt.Errorf("invalid value for ZDM_PS_CACHE_MISS_MODE; possible values are: %v and %v",
+			PsCacheMissModeUnprepared, PsCacheMissModeForward)
+	}
+}
+
+const (
+	SchemaVersionModeHost      = "HOST"
+	SchemaVersionModeSynthetic = "SYNTHETIC"
+)
+
+func (c *Config) ParseSchemaVersionMode() (common.SchemaVersionMode, error) {
+	switch strings.ToUpper(c.SchemaVersionMode) {
+	case SchemaVersionModeHost:
+		return common.SchemaVersionModeHost, nil
+	case SchemaVersionModeSynthetic:
+		return common.SchemaVersionModeSynthetic, nil
+	default:
+		return common.SchemaVersionModeUndefined, fmt.Errorf("invalid value for ZDM_SCHEMA_VERSION_MODE; possible values are: %v and %v",
+			SchemaVersionModeHost, SchemaVersionModeSynthetic)
+	}
+}
+
+const (
+	LargeBatchModeWarn   = "WARN"
+	LargeBatchModeReject = "REJECT"
+)
+
+func (c *Config) ParseLargeBatchMode() (common.LargeBatchMode, error) {
+	switch strings.ToUpper(c.LargeBatchMode) {
+	case LargeBatchModeWarn:
+		return common.LargeBatchModeWarn, nil
+	case LargeBatchModeReject:
+		return common.LargeBatchModeReject, nil
+	default:
+		return common.LargeBatchModeUndefined, fmt.Errorf("invalid value for ZDM_LARGE_BATCH_MODE; possible values are: %v and %v",
+			LargeBatchModeWarn, LargeBatchModeReject)
+	}
+}
+
+const (
+	DualWriteConfirmationBoth    = "BOTH"
+	DualWriteConfirmationPrimary = "PRIMARY"
+	DualWriteConfirmationEither  = "EITHER"
+)
+
+func (c *Config) ParseDualWriteConfirmation() (common.DualWriteConfirmation, error) {
+	switch strings.ToUpper(c.DualWriteConfirmation) {
+	case DualWriteConfirmationBoth:
+		return common.DualWriteConfirmationBoth, nil
+	case DualWriteConfirmationPrimary:
+		return common.DualWriteConfirmationPrimary, nil
+	case DualWriteConfirmationEither:
+		return common.DualWriteConfirmationEither, nil
+	default:
+		return common.DualWriteConfirmationUndefined, fmt.Errorf(
+			"invalid value for ZDM_DUAL_WRITE_CONFIRMATION; possible values are: %v, %v and %v",
+			DualWriteConfirmationBoth, DualWriteConfirmationPrimary, DualWriteConfirmationEither)
+	}
+}
+
+const (
+	TracingModeBoth    = "BOTH"
+	TracingModePrimary = "PRIMARY"
+	TracingModeOrigin  = "ORIGIN"
+	TracingModeTarget  = "TARGET"
+)
+
+func (c *Config) ParseTracingMode() (common.TracingMode, error) {
+	switch strings.ToUpper(c.TracingMode) {
+	case TracingModeBoth:
+		return common.TracingModeBoth, nil
+	case TracingModePrimary:
+		return common.TracingModePrimary, nil
+	case TracingModeOrigin:
+		return common.TracingModeOrigin, nil
+	case TracingModeTarget:
+		return common.TracingModeTarget, nil
+	default:
+		return common.TracingModeUndefined, fmt.Errorf(
+			"invalid value for ZDM_TRACING_MODE; possible values are: %v, %v, %v and %v",
+			TracingModeBoth, TracingModePrimary, TracingModeOrigin, TracingModeTarget)
+	}
+}
+
+const (
+	ReadComparisonTargetAheadModeMismatch = "MISMATCH"
+	ReadComparisonTargetAheadModeExpected = "EXPECTED"
+)
+
+func (c *Config) ParseReadComparisonTargetAheadMode() (common.ReadComparisonTargetAheadMode, error) {
+	switch strings.ToUpper(c.ReadComparisonTargetAheadMode) {
+	case ReadComparisonTargetAheadModeMismatch:
+		return common.ReadComparisonTargetAheadModeMismatch, nil
+	case ReadComparisonTargetAheadModeExpected:
+		return common.ReadComparisonTargetAheadModeExpected, nil
+	default:
+		return common.ReadComparisonTargetAheadModeUndefined, fmt.Errorf(
+			"invalid value for ZDM_READ_COMPARISON_TARGET_AHEAD_MODE; possible values are: %v and %v",
+			ReadComparisonTargetAheadModeMismatch, ReadComparisonTargetAheadModeExpected)
+	}
+}
+
+const (
+	ReadComparisonMetadataModeNormalize = "NORMALIZE"
+	ReadComparisonMetadataModeStrict    = "STRICT"
+	ReadComparisonMetadataModeIgnore    = "IGNORE"
+)
+
+func (c *Config) ParseReadComparisonMetadataMode() (common.ReadComparisonMetadataMode, error) {
+	switch strings.ToUpper(c.ReadComparisonMetadataMode) {
+	case ReadComparisonMetadataModeNormalize:
+		return common.ReadComparisonMetadataModeNormalize, nil
+	case ReadComparisonMetadataModeStrict:
+		return common.ReadComparisonMetadataModeStrict, nil
+	case ReadComparisonMetadataModeIgnore:
+		return common.ReadComparisonMetadataModeIgnore, nil
+	default:
+		return common.ReadComparisonMetadataModeUndefined, fmt.Errorf(
+			"invalid value for ZDM_READ_COMPARISON_METADATA_MODE; possible values are: %v, %v and %v",
+			ReadComparisonMetadataModeNormalize, ReadComparisonMetadataModeStrict, ReadComparisonMetadataModeIgnore)
+	}
+}
+
+const (
+	QueryNormalizationLevelWhitespace = "WHITESPACE"
+	QueryNormalizationLevelCase       = "CASE"
+	QueryNormalizationLevelLiterals   = "LITERALS"
+)
+
+func (c *Config) ParseQueryNormalizationLevel() (common.QueryNormalizationLevel, error) {
+	switch strings.ToUpper(c.QueryNormalizationLevel) {
+	case QueryNormalizationLevelWhitespace:
+		return common.QueryNormalizationLevelWhitespace, nil
+	case QueryNormalizationLevelCase:
+		return common.QueryNormalizationLevelCase, nil
+	case QueryNormalizationLevelLiterals:
+		return common.QueryNormalizationLevelLiterals, nil
+	default:
+		return common.QueryNormalizationLevelUndefined, fmt.Errorf(
+			"invalid value for ZDM_QUERY_NORMALIZATION_LEVEL; possible values are: %v, %v and %v",
+			QueryNormalizationLevelWhitespace, QueryNormalizationLevelCase, QueryNormalizationLevelLiterals)
+	}
+}
+
+// STARTUP options that the connection depends on, they are always forwarded.
+var functionalStartupOptions = []string{"CQL_VERSION", "COMPRESSION", "KEYSPACE"}
+
+// ParseOriginStartupOptionsStripped returns the upper case names of the STARTUP options that are not forwarded to ORIGIN.
+func (c *Config) ParseOriginStartupOptionsStripped() ([]string, error) {
+	return parseStartupOptionsStripped(c.OriginStartupOptionsStripped, "ZDM_ORIGIN_STARTUP_OPTIONS_STRIPPED")
+}
+
+// ParseTargetStartupOptionsStripped returns the upper case names of the STARTUP options that are not forwarded to TARGET.
+func (c *Config) ParseTargetStartupOptionsStripped() ([]string, error) {
+	return parseStartupOptionsStripped(c.TargetStartupOptionsStripped, "ZDM_TARGET_STARTUP_OPTIONS_STRIPPED")
+}
+
+func parseStartupOptionsStripped(setting string, envVarName string) ([]string, error) {
+	options := make([]string, 0)
+	for _, option := range strings.Split(setting, ",") {
+		option = strings.ToUpper(strings.TrimSpace(option))
+		if option == "" {
+			continue
+		}
+		for _, functionalOption := range functionalStartupOptions {
+			if option == functionalOption {
+				return nil, fmt.Errorf("invalid value for %v (%v); %v can not be stripped", envVarName, option, strings.Join(functionalStartupOptions, ", "))
+			}
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
 func (c *Config) ParseLogLevel() (log.Level, error) {
 	level, err := log.ParseLevel(strings.TrimSpace(c.LogLevel))
 	if err != nil {
@@ -357,6 +1380,23 @@ func (c *Config) ParseAsyncBuckets() ([]float64, error) {
 	return c.parseBuckets(c.MetricsAsyncReadLatencyBucketsMs)
 }
 
+// ParseMetricsStatsdTags returns the tags of ZDM_METRICS_STATSD_TAGS in the key:value format.
+func (c *Config) ParseMetricsStatsdTags() ([]string, error) {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(c.MetricsStatsdTags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		separatorIdx := strings.Index(tag, ":")
+		if separatorIdx <= 0 || separatorIdx == len(tag)-1 || strings.ContainsAny(tag, "|#") {
+			return nil, fmt.Errorf("invalid value for ZDM_METRICS_STATSD_TAGS (%v); tags must have the format key:value", tag)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
 func (c *Config) parseBuckets(bucketsConfigStr string) ([]float64, error) {
 	var bucketsArr []float64
 	bucketsStrArr := strings.Split(bucketsConfigStr, ",")
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
 	"github.com/datastax/zdm-proxy/proxy/pkg/common"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -82,3 +83,84 @@ func TestConfig_ParseReadMode(t *testing.T) {
 	}
 
 }
+
+func TestConfig_ParseAsyncReadsScope(t *testing.T) {
+
+	type test struct {
+		name            string
+		envVars         []envVar
+		expectedOpCodes []primitive.OpCode
+		errExpected     bool
+		errMsg          string
+	}
+
+	tests := []test{
+		{
+			name:            "Valid: Async reads scope unset",
+			envVars:         []envVar{},
+			expectedOpCodes: []primitive.OpCode{},
+			errExpected:     false,
+			errMsg:          "",
+		},
+		{
+			name:            "Valid: Async reads of QUERY only",
+			envVars:         []envVar{{"ZDM_ASYNC_READS_OPCODES", "query"}},
+			expectedOpCodes: []primitive.OpCode{primitive.OpCodeQuery},
+			errExpected:     false,
+			errMsg:          "",
+		},
+		{
+			name:            "Valid: Async reads of QUERY and EXECUTE",
+			envVars:         []envVar{{"ZDM_ASYNC_READS_OPCODES", "QUERY, EXECUTE"}},
+			expectedOpCodes: []primitive.OpCode{primitive.OpCodeQuery, primitive.OpCodeExecute},
+			errExpected:     false,
+			errMsg:          "",
+		},
+		{
+			name:            "Invalid: Async reads of BATCH",
+			envVars:         []envVar{{"ZDM_ASYNC_READS_OPCODES", "QUERY,BATCH"}},
+			expectedOpCodes: nil,
+			errExpected:     true,
+			errMsg:          "invalid value for ZDM_ASYNC_READS_OPCODES (BATCH); possible values are: QUERY and EXECUTE",
+		},
+		{
+			name:            "Invalid: Async reads sample percent out of range",
+			envVars:         []envVar{{"ZDM_ASYNC_READS_SAMPLE_PERCENT", "101"}},
+			expectedOpCodes: nil,
+			errExpected:     true,
+			errMsg:          "invalid ZDM_ASYNC_READS_SAMPLE_PERCENT (101), it must be between 0 and 100",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearAllEnvVars()
+
+			// set test-specific env vars
+			for _, envVar := range tt.envVars {
+				setEnvVar(envVar.vName, envVar.vValue)
+			}
+
+			// set other general env vars
+			setOriginCredentialsEnvVars()
+			setTargetCredentialsEnvVars()
+			setOriginContactPointsAndPortEnvVars()
+			setTargetContactPointsAndPortEnvVars()
+
+			conf, err := New().ParseEnvVars()
+			if err != nil {
+				if tt.errExpected {
+					require.Equal(t, tt.errMsg, err.Error())
+					return
+				} else {
+					t.Fatal("Unexpected configuration validation error, stopping test here")
+				}
+			}
+			require.False(t, tt.errExpected, "expected configuration validation error")
+
+			actualOpCodes, err := conf.ParseAsyncReadsOpcodes()
+			require.Nil(t, err)
+			require.Equal(t, tt.expectedOpCodes, actualOpCodes)
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
 	"github.com/stretchr/testify/require"
+	"net"
 	"testing"
 )
 
@@ -93,3 +95,283 @@ func TestTargetConfig_WithHostnameButWithoutPort(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, 9042, c.TargetPort)
 }
+
+func TestConfig_BindValueRoutingRules(t *testing.T) {
+	defer clearAllEnvVars()
+
+	// general setup
+	clearAllEnvVars()
+	setOriginCredentialsEnvVars()
+	setTargetCredentialsEnvVars()
+	setOriginContactPointsAndPortEnvVars()
+	setTargetContactPointsAndPortEnvVars()
+
+	//test-specific setup
+	setEnvVar("ZDM_BIND_VALUE_ROUTING_COLUMN", "tenant_id")
+	setEnvVar("ZDM_BIND_VALUE_ROUTING_RULES", "tenant1:TARGET, tenant:2:origin")
+
+	c, err := New().ParseEnvVars()
+	require.Nil(t, err)
+	rules, err := c.ParseBindValueRoutingRules()
+	require.Nil(t, err)
+	require.Equal(t, map[string]common.ClusterType{
+		"tenant1":  common.ClusterTypeTarget,
+		"tenant:2": common.ClusterTypeOrigin,
+	}, rules)
+
+	setEnvVar("ZDM_BIND_VALUE_ROUTING_RULES", "tenant1")
+	_, err = New().ParseEnvVars()
+	require.Error(t, err, "invalid value for ZDM_BIND_VALUE_ROUTING_RULES (tenant1); rules must have the format value:CLUSTER")
+
+	setEnvVar("ZDM_BIND_VALUE_ROUTING_RULES", "")
+	_, err = New().ParseEnvVars()
+	require.Error(t, err, "ZDM_BIND_VALUE_ROUTING_COLUMN is set but ZDM_BIND_VALUE_ROUTING_RULES is not")
+}
+
+func TestConfig_StartupOptionsStripped(t *testing.T) {
+	defer clearAllEnvVars()
+
+	// general setup
+	clearAllEnvVars()
+	setOriginCredentialsEnvVars()
+	setTargetCredentialsEnvVars()
+	setOriginContactPointsAndPortEnvVars()
+	setTargetContactPointsAndPortEnvVars()
+
+	//test-specific setup
+	setEnvVar("ZDM_TARGET_STARTUP_OPTIONS_STRIPPED", "application_name, APPLICATION_VERSION,")
+
+	c, err := New().ParseEnvVars()
+	require.Nil(t, err)
+	originOptions, err := c.ParseOriginStartupOptionsStripped()
+	require.Nil(t, err)
+	require.Empty(t, originOptions)
+	targetOptions, err := c.ParseTargetStartupOptionsStripped()
+	require.Nil(t, err)
+	require.Equal(t, []string{"APPLICATION_NAME", "APPLICATION_VERSION"}, targetOptions)
+
+	setEnvVar("ZDM_ORIGIN_STARTUP_OPTIONS_STRIPPED", "DRIVER_NAME,compression")
+	_, err = New().ParseEnvVars()
+	require.Error(t, err, "invalid value for ZDM_ORIGIN_STARTUP_OPTIONS_STRIPPED (COMPRESSION); CQL_VERSION, COMPRESSION, KEYSPACE can not be stripped")
+}
+
+func TestConfig_StartupPreflightKeyspaces(t *testing.T) {
+	defer clearAllEnvVars()
+
+	// general setup
+	clearAllEnvVars()
+	setOriginCredentialsEnvVars()
+	setTargetCredentialsEnvVars()
+	setOriginContactPointsAndPortEnvVars()
+	setTargetContactPointsAndPortEnvVars()
+
+	//test-specific setup
+	setEnvVar("ZDM_KEYSPACE_ALLOWLIST", "ks1, ks2")
+
+	c, err := New().ParseEnvVars()
+	require.Nil(t, err)
+	require.Equal(t, []string{"ks1", "ks2"}, c.ParseStartupPreflightKeyspaces())
+
+	setEnvVar("ZDM_STARTUP_PREFLIGHT_KEYSPACES", "ks3,")
+	c, err = New().ParseEnvVars()
+	require.Nil(t, err)
+	require.Equal(t, []string{"ks3"}, c.ParseStartupPreflightKeyspaces())
+}
+
+func TestConfig_MetricsStatsd(t *testing.T) {
+	defer clearAllEnvVars()
+
+	// general setup
+	clearAllEnvVars()
+	setOriginCredentialsEnvVars()
+	setTargetCredentialsEnvVars()
+	setOriginContactPointsAndPortEnvVars()
+	setTargetContactPointsAndPortEnvVars()
+
+	c, err := New().ParseEnvVars()
+	require.Nil(t, err)
+	require.Equal(t, "", c.MetricsStatsdAddress)
+	require.Equal(t, 1.0, c.MetricsStatsdSampleRate)
+	tags, err := c.ParseMetricsStatsdTags()
+	require.Nil(t, err)
+	require.Empty(t, tags)
+
+	//test-specific setup
+	setEnvVar("ZDM_METRICS_STATSD_ADDRESS", "localhost:8125")
+	setEnvVar("ZDM_METRICS_STATSD_TAGS", "env:prod, dc:us-east-1:a,")
+	setEnvVar("ZDM_METRICS_STATSD_SAMPLE_RATE", "0.5")
+
+	c, err = New().ParseEnvVars()
+	require.Nil(t, err)
+	require.Equal(t, "localhost:8125", c.MetricsStatsdAddress)
+	require.Equal(t, 0.5, c.MetricsStatsdSampleRate)
+	tags, err = c.ParseMetricsStatsdTags()
+	require.Nil(t, err)
+	require.Equal(t, []string{"env:prod", "dc:us-east-1:a"}, tags)
+
+	setEnvVar("ZDM_METRICS_STATSD_TAGS", "env")
+	_, err = New().ParseEnvVars()
+	require.Error(t, err, "invalid value for ZDM_METRICS_STATSD_TAGS (env); tags must have the format key:value")
+
+	setEnvVar("ZDM_METRICS_STATSD_TAGS", "")
+	setEnvVar("ZDM_METRICS_STATSD_SAMPLE_RATE", "0")
+	_, err = New().ParseEnvVars()
+	require.Error(t, err, "invalid ZDM_METRICS_STATSD_SAMPLE_RATE (0), it must be greater than 0 and at most 1")
+}
+
+func TestConfig_KeyspaceRoutingRules(t *testing.T) {
+	defer clearAllEnvVars()
+
+	// general setup
+	clearAllEnvVars()
+	setOriginCredentialsEnvVars()
+	setTargetCredentialsEnvVars()
+	setOriginContactPointsAndPortEnvVars()
+	setTargetContactPointsAndPortEnvVars()
+
+	//test-specific setup
+	setEnvVar("ZDM_KEYSPACE_ROUTING_RULES", "*_new:TARGET, tenantA_*:origin, ks1:target")
+
+	c, err := New().ParseEnvVars()
+	require.Nil(t, err)
+	rules, err := c.ParseKeyspaceRoutingRules()
+	require.Nil(t, err)
+	require.Equal(t, []*common.KeyspaceRoutingRule{
+		{Pattern: "*_new", Cluster: common.ClusterTypeTarget},
+		{Pattern: "tenantA_*", Cluster: common.ClusterTypeOrigin},
+		{Pattern: "ks1", Cluster: common.ClusterTypeTarget},
+	}, rules)
+
+	for _, invalidRule := range []string{"ks1", "*:TARGET", "*ks*:TARGET", "k*s:TARGET", "ks1:BOTH"} {
+		setEnvVar("ZDM_KEYSPACE_ROUTING_RULES", invalidRule)
+		_, err = New().ParseEnvVars()
+		require.NotNil(t, err, invalidRule)
+		require.Contains(t, err.Error(), "invalid value for ZDM_KEYSPACE_ROUTING_RULES")
+	}
+}
+
+func TestConfig_MetricsClientGroups(t *testing.T) {
+	defer clearAllEnvVars()
+
+	// general setup
+	clearAllEnvVars()
+	setOriginCredentialsEnvVars()
+	setTargetCredentialsEnvVars()
+	setOriginContactPointsAndPortEnvVars()
+	setTargetContactPointsAndPortEnvVars()
+
+	//test-specific setup
+	setEnvVar("ZDM_METRICS_CLIENT_GROUPS", "app=10.0.1.0/24, reports = 10.0.2.15,ipv6=fd00::1")
+
+	c, err := New().ParseEnvVars()
+	require.Nil(t, err)
+	groups, err := c.ParseMetricsClientGroups()
+	require.Nil(t, err)
+	require.Equal(t, []*common.ClientGroup{
+		{Name: "app", Network: &net.IPNet{IP: net.IP{10, 0, 1, 0}, Mask: net.CIDRMask(24, 32)}},
+		{Name: "reports", Network: &net.IPNet{IP: net.IP{10, 0, 2, 15}, Mask: net.CIDRMask(32, 32)}},
+		{Name: "ipv6", Network: &net.IPNet{IP: net.ParseIP("fd00::1"), Mask: net.CIDRMask(128, 128)}},
+	}, groups)
+
+	for _, invalidEntry := range []string{"10.0.1.0/24", "=10.0.1.0/24", "app=10.0.1.0/33", "app=host1"} {
+		setEnvVar("ZDM_METRICS_CLIENT_GROUPS", invalidEntry)
+		_, err = New().ParseEnvVars()
+		require.NotNil(t, err, invalidEntry)
+		require.Contains(t, err.Error(), "invalid value for ZDM_METRICS_CLIENT_GROUPS")
+	}
+}
+
+func TestConfig_KeyspaceReadRoutingRules(t *testing.T) {
+	defer clearAllEnvVars()
+
+	// general setup
+	clearAllEnvVars()
+	setOriginCredentialsEnvVars()
+	setTargetCredentialsEnvVars()
+	setOriginContactPointsAndPortEnvVars()
+	setTargetContactPointsAndPortEnvVars()
+
+	//test-specific setup
+	setEnvVar("ZDM_KEYSPACE_READ_ROUTING_RULES", "ks1:TARGET, tenantA_*:origin")
+
+	c, err := New().ParseEnvVars()
+	require.Nil(t, err)
+	rules, err := c.ParseKeyspaceReadRoutingRules()
+	require.Nil(t, err)
+	require.Equal(t, []*common.KeyspaceRoutingRule{
+		{Pattern: "ks1", Cluster: common.ClusterTypeTarget},
+		{Pattern: "tenantA_*", Cluster: common.ClusterTypeOrigin},
+	}, rules)
+	rules, err = c.ParseKeyspaceRoutingRules()
+	require.Nil(t, err)
+	require.Empty(t, rules)
+
+	setEnvVar("ZDM_KEYSPACE_READ_ROUTING_RULES", "ks1:BOTH")
+	_, err = New().ParseEnvVars()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "invalid value for ZDM_KEYSPACE_READ_ROUTING_RULES")
+}
+
+func TestConfig_EventDeliveryMode(t *testing.T) {
+	defer clearAllEnvVars()
+
+	// general setup
+	clearAllEnvVars()
+	setOriginCredentialsEnvVars()
+	setTargetCredentialsEnvVars()
+	setOriginContactPointsAndPortEnvVars()
+	setTargetContactPointsAndPortEnvVars()
+
+	// events are never dropped unless DROP is configured
+	c, err := New().ParseEnvVars()
+	require.Nil(t, err)
+	mode, err := c.ParseEventDeliveryMode()
+	require.Nil(t, err)
+	require.Equal(t, common.EventDeliveryModeBlock, mode)
+
+	//test-specific setup
+	setEnvVar("ZDM_EVENT_DELIVERY_MODE", "drop")
+
+	c, err = New().ParseEnvVars()
+	require.Nil(t, err)
+	mode, err = c.ParseEventDeliveryMode()
+	require.Nil(t, err)
+	require.Equal(t, common.EventDeliveryModeDrop, mode)
+
+	setEnvVar("ZDM_EVENT_DELIVERY_MODE", "QUEUE")
+	_, err = New().ParseEnvVars()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "invalid value for ZDM_EVENT_DELIVERY_MODE")
+}
+
+func TestConfig_ReadComparisonMetadataMode(t *testing.T) {
+	defer clearAllEnvVars()
+
+	// general setup
+	clearAllEnvVars()
+	setOriginCredentialsEnvVars()
+	setTargetCredentialsEnvVars()
+	setOriginContactPointsAndPortEnvVars()
+	setTargetContactPointsAndPortEnvVars()
+
+	// metadata differences that don't change how the values are encoded are ignored unless STRICT is configured
+	c, err := New().ParseEnvVars()
+	require.Nil(t, err)
+	mode, err := c.ParseReadComparisonMetadataMode()
+	require.Nil(t, err)
+	require.Equal(t, common.ReadComparisonMetadataModeNormalize, mode)
+
+	//test-specific setup
+	setEnvVar("ZDM_READ_COMPARISON_METADATA_MODE", "strict")
+
+	c, err = New().ParseEnvVars()
+	require.Nil(t, err)
+	mode, err = c.ParseReadComparisonMetadataMode()
+	require.Nil(t, err)
+	require.Equal(t, common.ReadComparisonMetadataModeStrict, mode)
+
+	setEnvVar("ZDM_READ_COMPARISON_METADATA_MODE", "LENIENT")
+	_, err = New().ParseEnvVars()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "invalid value for ZDM_READ_COMPARISON_METADATA_MODE")
+}
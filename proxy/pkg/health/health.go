@@ -7,6 +7,7 @@ import (
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"time"
 )
 
 func DefaultReadinessHandler() http.Handler {
@@ -16,13 +17,16 @@ func DefaultReadinessHandler() http.Handler {
 type StatusReport struct {
 	OriginStatus *ControlConnStatus
 	TargetStatus *ControlConnStatus
-	Status       Status
+	// DualWriteAgreement doesn't affect Status, it is reported so that automation can gate cutovers on it
+	DualWriteAgreement *zdmproxy.DualWriteAgreement
+	Status             Status
 }
 
 type ControlConnStatus struct {
 	Addr                  string
 	CurrentFailureCount   int
 	FailureCountThreshold int
+	FailureGracePeriodMs  int
 	Status                Status
 }
 
@@ -82,20 +86,23 @@ func PerformHealthCheck(proxy *zdmproxy.ZdmProxy) *StatusReport {
 	originControlConn := proxy.GetOriginControlConn()
 	targetControlConn := proxy.GetTargetControlConn()
 
-	originControlConnStatus := newControlConnStatus(originControlConn, proxy.Conf.HeartbeatFailureThreshold)
-	targetControlConnStatus := newControlConnStatus(targetControlConn, proxy.Conf.HeartbeatFailureThreshold)
+	originControlConnStatus := newControlConnStatus(
+		originControlConn, proxy.Conf.HeartbeatFailureThreshold, proxy.Conf.HeartbeatFailureGracePeriodMs)
+	targetControlConnStatus := newControlConnStatus(
+		targetControlConn, proxy.Conf.HeartbeatFailureThreshold, proxy.Conf.HeartbeatFailureGracePeriodMs)
 	status := UP
 	if originControlConnStatus.Status != UP || targetControlConnStatus.Status != UP {
 		status = DOWN
 	}
 	return &StatusReport{
-		OriginStatus: originControlConnStatus,
-		TargetStatus: targetControlConnStatus,
-		Status:       status,
+		OriginStatus:       originControlConnStatus,
+		TargetStatus:       targetControlConnStatus,
+		DualWriteAgreement: proxy.GetDualWriteAgreement(),
+		Status:             status,
 	}
 }
 
-func newControlConnStatus(controlConn *zdmproxy.ControlConn, failureThreshold int) *ControlConnStatus {
+func newControlConnStatus(controlConn *zdmproxy.ControlConn, failureThreshold int, failureGracePeriodMs int) *ControlConnStatus {
 	currentEndpoint := controlConn.GetCurrentContactPoint()
 	var addr string
 	if currentEndpoint == nil {
@@ -108,10 +115,11 @@ func newControlConnStatus(controlConn *zdmproxy.ControlConn, failureThreshold in
 		Addr:                  addr,
 		CurrentFailureCount:   controlConn.ReadFailureCounter(),
 		FailureCountThreshold: failureThreshold,
+		FailureGracePeriodMs:  failureGracePeriodMs,
 		Status:                UP,
 	}
 
-	if controlConnReport.CurrentFailureCount >= controlConnReport.FailureCountThreshold {
+	if controlConn.IsDown(failureThreshold, time.Duration(failureGracePeriodMs)*time.Millisecond) {
 		controlConnReport.Status = DOWN
 	}
 
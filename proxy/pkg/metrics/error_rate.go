@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+const errorRateWindowBuckets = 10
+
+// ErrorRateWindow tracks the ratio of failed requests to total requests over a rolling time window.
+// The window is split in buckets so that old requests expire gradually instead of all at once.
+type ErrorRateWindow struct {
+	lock        *sync.Mutex
+	buckets     []errorRateBucket
+	bucketWidth time.Duration
+	now         func() time.Time
+}
+
+type errorRateBucket struct {
+	index  int64
+	total  int64
+	failed int64
+}
+
+func NewErrorRateWindow(window time.Duration) *ErrorRateWindow {
+	return newErrorRateWindow(window, errorRateWindowBuckets, time.Now)
+}
+
+func newErrorRateWindow(window time.Duration, buckets int, now func() time.Time) *ErrorRateWindow {
+	bucketWidth := window / time.Duration(buckets)
+	if bucketWidth <= 0 {
+		bucketWidth = 1
+	}
+	return &ErrorRateWindow{
+		lock:        &sync.Mutex{},
+		buckets:     make([]errorRateBucket, buckets),
+		bucketWidth: bucketWidth,
+		now:         now,
+	}
+}
+
+func (recv *ErrorRateWindow) currentIndex() int64 {
+	return recv.now().UnixNano() / int64(recv.bucketWidth)
+}
+
+// Track records the outcome of a request.
+func (recv *ErrorRateWindow) Track(failed bool) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	index := recv.currentIndex()
+	bucket := &recv.buckets[index%int64(len(recv.buckets))]
+	if bucket.index != index {
+		*bucket = errorRateBucket{index: index}
+	}
+	bucket.total++
+	if failed {
+		bucket.failed++
+	}
+}
+
+// Rate returns the ratio of failed requests to total requests that were tracked in the window,
+// 0 is returned if no request was tracked.
+func (recv *ErrorRateWindow) Rate() float64 {
+	failed, total := recv.Counts()
+	if total == 0 {
+		return 0
+	}
+	return float64(failed) / float64(total)
+}
+
+// Counts returns the number of failed requests and the total number of requests that were tracked in the window.
+func (recv *ErrorRateWindow) Counts() (failed int64, total int64) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	index := recv.currentIndex()
+	for _, bucket := range recv.buckets {
+		if age := index - bucket.index; age >= 0 && age < int64(len(recv.buckets)) {
+			total += bucket.total
+			failed += bucket.failed
+		}
+	}
+	return failed, total
+}
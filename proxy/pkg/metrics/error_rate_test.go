@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestErrorRateWindow_Rate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	window := newErrorRateWindow(10*time.Second, 10, func() time.Time {
+		return now
+	})
+	require.Equal(t, 0.0, window.Rate())
+
+	// 1 failure out of 4 requests
+	window.Track(false)
+	window.Track(true)
+	window.Track(false)
+	window.Track(false)
+	require.Equal(t, 0.25, window.Rate())
+
+	// 3 failures out of 4 requests, 5 seconds later
+	now = now.Add(5 * time.Second)
+	window.Track(true)
+	window.Track(true)
+	window.Track(true)
+	window.Track(false)
+	require.Equal(t, 0.5, window.Rate())
+
+	// first requests expire once they are older than the window
+	now = now.Add(5 * time.Second)
+	require.Equal(t, 0.75, window.Rate())
+
+	now = now.Add(4 * time.Second)
+	window.Track(false)
+	require.Equal(t, 0.6, window.Rate())
+
+	// all requests expire
+	now = now.Add(20 * time.Second)
+	require.Equal(t, 0.0, window.Rate())
+
+	// buckets are reused after the window moves forward
+	window.Track(true)
+	require.Equal(t, 1.0, window.Rate())
+}
+
+func TestErrorRateWindow_Counts(t *testing.T) {
+	now := time.Unix(1000, 0)
+	window := newErrorRateWindow(10*time.Second, 10, func() time.Time {
+		return now
+	})
+	failed, total := window.Counts()
+	require.Equal(t, int64(0), failed)
+	require.Equal(t, int64(0), total)
+
+	window.Track(true)
+	window.Track(false)
+	now = now.Add(5 * time.Second)
+	window.Track(false)
+	failed, total = window.Counts()
+	require.Equal(t, int64(1), failed)
+	require.Equal(t, int64(3), total)
+
+	now = now.Add(5 * time.Second)
+	failed, total = window.Counts()
+	require.Equal(t, int64(0), failed)
+	require.Equal(t, int64(1), total)
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// LatencyEwma tracks an exponentially weighted moving average of request latencies,
+// recent requests have a bigger weight than older ones.
+type LatencyEwma struct {
+	lock        *sync.Mutex
+	alpha       float64
+	value       float64
+	initialized bool
+}
+
+// NewLatencyEwma creates a LatencyEwma where each new sample has a weight of alpha (between 0 and 1).
+func NewLatencyEwma(alpha float64) *LatencyEwma {
+	return &LatencyEwma{
+		lock:  &sync.Mutex{},
+		alpha: alpha,
+	}
+}
+
+// Track records the latency of a request that started at the provided time.
+func (recv *LatencyEwma) Track(begin time.Time) {
+	recv.Update(time.Since(begin))
+}
+
+func (recv *LatencyEwma) Update(latency time.Duration) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	if !recv.initialized {
+		recv.value = float64(latency)
+		recv.initialized = true
+		return
+	}
+	recv.value = recv.alpha*float64(latency) + (1-recv.alpha)*recv.value
+}
+
+// Value returns the current average, the second return value is false if no latency was recorded yet.
+func (recv *LatencyEwma) Value() (time.Duration, bool) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	return time.Duration(recv.value), recv.initialized
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLatencyEwma_Value(t *testing.T) {
+	ewma := NewLatencyEwma(0.5)
+	_, ok := ewma.Value()
+	require.False(t, ok)
+
+	// first sample initializes the average
+	ewma.Update(100 * time.Millisecond)
+	value, ok := ewma.Value()
+	require.True(t, ok)
+	require.Equal(t, 100*time.Millisecond, value)
+
+	ewma.Update(200 * time.Millisecond)
+	value, _ = ewma.Value()
+	require.Equal(t, 150*time.Millisecond, value)
+
+	ewma.Update(50 * time.Millisecond)
+	value, _ = ewma.Value()
+	require.Equal(t, 100*time.Millisecond, value)
+
+	// converges to the latest latency
+	for i := 0; i < 50; i++ {
+		ewma.Update(10 * time.Millisecond)
+	}
+	value, _ = ewma.Value()
+	require.InDelta(t, float64(10*time.Millisecond), float64(value), float64(time.Microsecond))
+}
@@ -180,6 +180,97 @@ func (recv *MetricHandler) GetNodeMetrics(
 	return &NodeMetrics{OriginMetrics: originMetrics, TargetMetrics: targetMetrics, AsyncMetrics: asyncMetrics}, nil
 }
 
+// GetClusterAuthenticatorCounter returns the counter of AUTHENTICATE responses received from the given cluster with
+// the given authenticator class. Authenticator classes are only known at runtime so the counter is created on demand.
+func (recv *MetricHandler) GetClusterAuthenticatorCounter(cluster string, authenticator string) (Counter, error) {
+	return recv.metricFactory.GetOrCreateCounter(NewMetricWithLabels(
+		clusterAuthenticatorsName,
+		clusterAuthenticatorsDescription,
+		map[string]string{
+			clusterAuthenticatorsClusterLabel:       cluster,
+			clusterAuthenticatorsAuthenticatorLabel: authenticator,
+		},
+	))
+}
+
+// GetMismatchedWriteErrorsCounter returns the counter of writes that failed with the given error code on ORIGIN and
+// a different error code on TARGET. The error codes are a fixed set so the number of label combinations is bounded.
+func (recv *MetricHandler) GetMismatchedWriteErrorsCounter(originError string, targetError string) (Counter, error) {
+	return recv.metricFactory.GetOrCreateCounter(NewMetricWithLabels(
+		mismatchedWriteErrorsName,
+		mismatchedWriteErrorsDescription,
+		map[string]string{
+			mismatchedWriteErrorsOriginErrorLabel: originError,
+			mismatchedWriteErrorsTargetErrorLabel: targetError,
+		},
+	))
+}
+
+// GetDualWriteDivergenceCounter returns the counter of writes on the given table that failed on the given cluster
+// and succeeded on the other one. The caller is responsible for bounding the number of tables.
+func (recv *MetricHandler) GetDualWriteDivergenceCounter(keyspace string, table string, failedOn string) (Counter, error) {
+	return recv.metricFactory.GetOrCreateCounter(NewMetricWithLabels(
+		dualWriteDivergencesName,
+		dualWriteDivergencesDescription,
+		map[string]string{
+			dualWriteDivergencesKeyspaceLabel: keyspace,
+			dualWriteDivergencesTableLabel:    table,
+			dualWriteDivergencesFailedOnLabel: failedOn,
+		},
+	))
+}
+
+// GetPsCacheExecutesCounter returns the counter of EXECUTE requests on the given keyspace with the given prepared
+// statement cache result (hit or miss). The caller is responsible for bounding the number of keyspaces.
+func (recv *MetricHandler) GetPsCacheExecutesCounter(keyspace string, result string) (Counter, error) {
+	return recv.metricFactory.GetOrCreateCounter(NewMetricWithLabels(
+		psCacheExecutesName,
+		psCacheExecutesDescription,
+		map[string]string{
+			psCacheExecutesKeyspaceLabel: keyspace,
+			psCacheExecutesResultLabel:   result,
+		},
+	))
+}
+
+// GetUnknownErrorCodesCounter returns the counter of error responses received from the given cluster with the given
+// error code that is not defined by the protocol. Vendor specific error codes are only known at runtime so the counter
+// is created on demand.
+func (recv *MetricHandler) GetUnknownErrorCodesCounter(cluster string, errorCode string) (Counter, error) {
+	return recv.metricFactory.GetOrCreateCounter(NewMetricWithLabels(
+		unknownErrorCodesName,
+		unknownErrorCodesDescription,
+		map[string]string{
+			unknownErrorCodesClusterLabel:   cluster,
+			unknownErrorCodesErrorCodeLabel: errorCode,
+		},
+	))
+}
+
+// GetClientGroupRequestsCounter returns the counter of requests received from the clients of the given client group.
+// The client groups are configured so the number of labels is bounded.
+func (recv *MetricHandler) GetClientGroupRequestsCounter(clientGroup string) (Counter, error) {
+	return recv.metricFactory.GetOrCreateCounter(NewMetricWithLabels(
+		clientGroupRequestsName,
+		clientGroupRequestsDescription,
+		map[string]string{
+			clientGroupLabel: clientGroup,
+		},
+	))
+}
+
+// GetClientGroupConnectionsGauge returns the gauge of client connections that are open from the clients of the given
+// client group.
+func (recv *MetricHandler) GetClientGroupConnectionsGauge(clientGroup string) (Gauge, error) {
+	return recv.metricFactory.GetOrCreateGauge(NewMetricWithLabels(
+		clientGroupConnectionsName,
+		clientGroupConnectionsDescription,
+		map[string]string{
+			clientGroupLabel: clientGroup,
+		},
+	))
+}
+
 func (recv *MetricHandler) UnregisterAllMetrics() error {
 	return recv.metricFactory.UnregisterAllMetrics()
 }
@@ -13,15 +13,18 @@ const (
 	asyncFailedRequestsErrorLabel  = "error"
 	asyncFailedRequestsDescription = "Running total of requests that failed on Async Connector"
 
-	errorClientTimeout = "client_timeout"
-	errorReadTimeout   = "read_timeout"
-	errorReadFailure   = "read_failure"
-	errorWriteTimeout  = "write_timeout"
-	errorWriteFailure  = "write_failure"
-	errorOverloaded    = "overloaded"
-	errorUnavailable   = "unavailable"
-	errorUnprepared    = "unprepared"
-	errorOther         = "other"
+	errorClientTimeout   = "client_timeout"
+	errorReadTimeout     = "read_timeout"
+	errorReadFailure     = "read_failure"
+	errorWriteTimeout    = "write_timeout"
+	errorWriteFailure    = "write_failure"
+	errorOverloaded      = "overloaded"
+	errorUnavailable     = "unavailable"
+	errorUnprepared      = "unprepared"
+	errorUnauthorized    = "unauthorized"
+	errorTruncateError   = "truncate_error"
+	errorFunctionFailure = "function_failure"
+	errorOther           = "other"
 
 	nodeLabel = "node"
 )
@@ -83,6 +86,27 @@ var (
 			originFailedRequestsErrorLabel: errorUnavailable,
 		},
 	)
+	OriginUnauthorizedErrors = NewMetricWithLabels(
+		originFailedRequestsName,
+		originFailedRequestsDescription,
+		map[string]string{
+			originFailedRequestsErrorLabel: errorUnauthorized,
+		},
+	)
+	OriginTruncateErrors = NewMetricWithLabels(
+		originFailedRequestsName,
+		originFailedRequestsDescription,
+		map[string]string{
+			originFailedRequestsErrorLabel: errorTruncateError,
+		},
+	)
+	OriginFunctionFailures = NewMetricWithLabels(
+		originFailedRequestsName,
+		originFailedRequestsDescription,
+		map[string]string{
+			originFailedRequestsErrorLabel: errorFunctionFailure,
+		},
+	)
 	OriginOtherErrors = NewMetricWithLabels(
 		originFailedRequestsName,
 		originFailedRequestsDescription,
@@ -147,6 +171,27 @@ var (
 			targetFailedRequestsErrorLabel: errorUnavailable,
 		},
 	)
+	TargetUnauthorizedErrors = NewMetricWithLabels(
+		targetFailedRequestsName,
+		targetFailedRequestsDescription,
+		map[string]string{
+			targetFailedRequestsErrorLabel: errorUnauthorized,
+		},
+	)
+	TargetTruncateErrors = NewMetricWithLabels(
+		targetFailedRequestsName,
+		targetFailedRequestsDescription,
+		map[string]string{
+			targetFailedRequestsErrorLabel: errorTruncateError,
+		},
+	)
+	TargetFunctionFailures = NewMetricWithLabels(
+		targetFailedRequestsName,
+		targetFailedRequestsDescription,
+		map[string]string{
+			targetFailedRequestsErrorLabel: errorFunctionFailure,
+		},
+	)
 	TargetOtherErrors = NewMetricWithLabels(
 		targetFailedRequestsName,
 		targetFailedRequestsDescription,
@@ -211,6 +256,27 @@ var (
 			asyncFailedRequestsErrorLabel: errorUnavailable,
 		},
 	)
+	AsyncUnauthorizedErrors = NewMetricWithLabels(
+		asyncFailedRequestsName,
+		asyncFailedRequestsDescription,
+		map[string]string{
+			asyncFailedRequestsErrorLabel: errorUnauthorized,
+		},
+	)
+	AsyncTruncateErrors = NewMetricWithLabels(
+		asyncFailedRequestsName,
+		asyncFailedRequestsDescription,
+		map[string]string{
+			asyncFailedRequestsErrorLabel: errorTruncateError,
+		},
+	)
+	AsyncFunctionFailures = NewMetricWithLabels(
+		asyncFailedRequestsName,
+		asyncFailedRequestsDescription,
+		map[string]string{
+			asyncFailedRequestsErrorLabel: errorFunctionFailure,
+		},
+	)
 	AsyncOtherErrors = NewMetricWithLabels(
 		asyncFailedRequestsName,
 		asyncFailedRequestsDescription,
@@ -258,21 +324,30 @@ type NodeMetrics struct {
 }
 
 type NodeMetricsInstance struct {
-	ClientTimeouts    Counter
-	ReadTimeouts      Counter
-	ReadFailures      Counter
-	WriteTimeouts     Counter
-	WriteFailures     Counter
-	UnpreparedErrors  Counter
-	OverloadedErrors  Counter
-	UnavailableErrors Counter
-	OtherErrors       Counter
+	ClientTimeouts     Counter
+	ReadTimeouts       Counter
+	ReadFailures       Counter
+	WriteTimeouts      Counter
+	WriteFailures      Counter
+	UnpreparedErrors   Counter
+	OverloadedErrors   Counter
+	UnavailableErrors  Counter
+	UnauthorizedErrors Counter
+	TruncateErrors     Counter
+	FunctionFailures   Counter
+	OtherErrors        Counter
 
 	RequestDuration Histogram
 
 	OpenConnections Gauge
 
 	InFlightRequests Gauge
+
+	// ErrorRate is shared by all nodes of the same cluster, it is nil for async node metrics.
+	ErrorRate *ErrorRateWindow
+
+	// Latency is shared by all nodes of the same cluster, it is nil for async node metrics.
+	Latency *LatencyEwma
 }
 
 func CreateCounterNodeMetric(metricFactory MetricFactory, nodeDescription string, mn Metric) (Counter, error) {
@@ -21,9 +21,94 @@ const (
 	requestDurationTypeLabel   = "type"
 	requestDurationDescription = "Histogram that tracks the latency of requests at proxy entry point"
 
+	sloBreachesName        = "proxy_slo_breaches_total"
+	sloBreachesTypeLabel   = "type"
+	sloBreachesDescription = "Running total of requests that took longer than the latency threshold of their type, see ZDM_METRICS_SLO_READ_LATENCY_THRESHOLD_MS and ZDM_METRICS_SLO_WRITE_LATENCY_THRESHOLD_MS"
+
 	inFlightRequestsName        = "proxy_inflight_requests_total"
 	inFlightRequestsTypeLabel   = "type"
 	inFlightRequestsDescription = "Number of requests currently in flight in the proxy"
+
+	toleratedAlreadyExistsName         = "proxy_tolerated_already_exists_total"
+	toleratedAlreadyExistsDescription  = "Running total of AlreadyExists errors on one cluster that were ignored because the other cluster succeeded"
+	toleratedAlreadyExistsClusterLabel = "cluster"
+
+	backendProtocolErrorsName         = "proxy_backend_protocol_errors_total"
+	backendProtocolErrorsDescription  = "Running total of protocol errors returned by each cluster after the client handshake, they usually mean that the proxy sent a malformed frame or that the protocol versions are misconfigured"
+	backendProtocolErrorsClusterLabel = "cluster"
+
+	requestsByOpCodeName        = "proxy_requests_by_opcode_total"
+	requestsByOpCodeLabel       = "opcode"
+	requestsByOpCodeDescription = "Running total of requests received by the proxy grouped by protocol opcode"
+
+	clientConnectionsByVersionName        = "client_connections_by_protocol_version_total"
+	clientConnectionsByVersionLabel       = "protocol_version"
+	clientConnectionsByVersionDescription = "Number of client connections currently open grouped by negotiated protocol version"
+
+	protocolVersion2    = "v2"
+	protocolVersion3    = "v3"
+	protocolVersion4    = "v4"
+	protocolVersion5    = "v5"
+	protocolVersionDse1 = "dse_v1"
+	protocolVersionDse2 = "dse_v2"
+
+	opCodeQuery    = "query"
+	opCodeExecute  = "execute"
+	opCodePrepare  = "prepare"
+	opCodeBatch    = "batch"
+	opCodeRegister = "register"
+	opCodeOther    = "other"
+
+	clusterAuthenticatorsName               = "proxy_cluster_authenticators_total"
+	clusterAuthenticatorsClusterLabel       = "cluster"
+	clusterAuthenticatorsAuthenticatorLabel = "authenticator"
+	clusterAuthenticatorsDescription        = "Running total of AUTHENTICATE responses received from each cluster during client handshakes grouped by authenticator class"
+
+	framesSentName         = "proxy_frames_sent_total"
+	framesSentClusterLabel = "cluster"
+	framesSentTypeLabel    = "type"
+	framesSentDescription  = "Running total of request frames sent to each cluster grouped by type: control (STARTUP, OPTIONS, REGISTER, AUTH_RESPONSE) or data (QUERY, EXECUTE, BATCH, PREPARE)"
+
+	frameTypeControl = "control"
+	frameTypeData    = "data"
+
+	mismatchedWriteErrorsName             = "proxy_mismatched_write_errors_total"
+	mismatchedWriteErrorsOriginErrorLabel = "origin_error"
+	mismatchedWriteErrorsTargetErrorLabel = "target_error"
+	mismatchedWriteErrorsDescription      = "Running total of writes that failed on both clusters with different error codes grouped by the error code of each cluster"
+
+	readMismatchesName        = "proxy_read_mismatches_total"
+	readMismatchesTypeLabel   = "type"
+	readMismatchesDescription = "Running total of reads on which the rows returned by both clusters differ grouped by category (metadata_only if the rows are equal but their column metadata differs), see ZDM_READ_COMPARISON_ENABLED"
+
+	readMismatchTargetExtraRows = "target_extra_rows"
+	readMismatchOriginExtraRows = "origin_extra_rows"
+	readMismatchValuesDiffer    = "values_differ"
+	readMismatchMetadataOnly    = "metadata_only"
+
+	dualWriteDivergencesName          = "proxy_dual_write_divergences_total"
+	dualWriteDivergencesKeyspaceLabel = "keyspace"
+	dualWriteDivergencesTableLabel    = "table"
+	dualWriteDivergencesFailedOnLabel = "failed_on"
+	dualWriteDivergencesDescription   = "Running total of writes that succeeded on one cluster and failed on the other grouped by table and by the cluster that the write failed on, see ZDM_METRICS_TABLE_DIVERGENCE_MAX_TABLES"
+
+	psCacheExecutesName          = "proxy_ps_cache_executes_total"
+	psCacheExecutesKeyspaceLabel = "keyspace"
+	psCacheExecutesResultLabel   = "result"
+	psCacheExecutesDescription   = "Running total of EXECUTE requests grouped by keyspace and by whether their prepared statement was found in the prepared statement cache (hit or miss), see ZDM_METRICS_PS_CACHE_MAX_KEYSPACES"
+
+	unknownErrorCodesName           = "proxy_unknown_error_codes_total"
+	unknownErrorCodesClusterLabel   = "cluster"
+	unknownErrorCodesErrorCodeLabel = "error_code"
+	unknownErrorCodesDescription    = "Running total of error responses with an error code that is not part of the protocol specification (e.g. vendor specific) grouped by cluster and error code, see ZDM_FORWARD_UNKNOWN_ERROR_CODES"
+
+	clientGroupLabel = "client_group"
+
+	clientGroupRequestsName        = "proxy_client_group_requests_total"
+	clientGroupRequestsDescription = "Running total of requests received from the clients of each client group, see ZDM_METRICS_CLIENT_GROUPS"
+
+	clientGroupConnectionsName        = "proxy_client_group_connections"
+	clientGroupConnectionsDescription = "Number of client connections currently open from the clients of each client group, see ZDM_METRICS_CLIENT_GROUPS"
 )
 
 var (
@@ -63,6 +148,36 @@ var (
 		},
 	)
 
+	ToleratedAlreadyExistsOrigin = NewMetricWithLabels(
+		toleratedAlreadyExistsName,
+		toleratedAlreadyExistsDescription,
+		map[string]string{
+			toleratedAlreadyExistsClusterLabel: failedRequestsClusterOrigin,
+		},
+	)
+	ToleratedAlreadyExistsTarget = NewMetricWithLabels(
+		toleratedAlreadyExistsName,
+		toleratedAlreadyExistsDescription,
+		map[string]string{
+			toleratedAlreadyExistsClusterLabel: failedRequestsClusterTarget,
+		},
+	)
+
+	BackendProtocolErrorsOrigin = NewMetricWithLabels(
+		backendProtocolErrorsName,
+		backendProtocolErrorsDescription,
+		map[string]string{
+			backendProtocolErrorsClusterLabel: failedRequestsClusterOrigin,
+		},
+	)
+	BackendProtocolErrorsTarget = NewMetricWithLabels(
+		backendProtocolErrorsName,
+		backendProtocolErrorsDescription,
+		map[string]string{
+			backendProtocolErrorsClusterLabel: failedRequestsClusterTarget,
+		},
+	)
+
 	PSCacheSize = NewMetric(
 		"pscache_entries_total",
 		"Number of entries currently in the prepared statement cache",
@@ -94,6 +209,28 @@ var (
 		},
 	)
 
+	SloBreachesReadsOrigin = NewMetricWithLabels(
+		sloBreachesName,
+		sloBreachesDescription,
+		map[string]string{
+			sloBreachesTypeLabel: typeReadsOrigin,
+		},
+	)
+	SloBreachesReadsTarget = NewMetricWithLabels(
+		sloBreachesName,
+		sloBreachesDescription,
+		map[string]string{
+			sloBreachesTypeLabel: typeReadsTarget,
+		},
+	)
+	SloBreachesWrites = NewMetricWithLabels(
+		sloBreachesName,
+		sloBreachesDescription,
+		map[string]string{
+			sloBreachesTypeLabel: typeWrites,
+		},
+	)
+
 	InFlightReadsOrigin = NewMetricWithLabels(
 		inFlightRequestsName,
 		inFlightRequestsDescription,
@@ -120,6 +257,389 @@ var (
 		"client_connections_total",
 		"Number of client connections currently open",
 	)
+
+	ClientConnectionsV2 = NewMetricWithLabels(
+		clientConnectionsByVersionName,
+		clientConnectionsByVersionDescription,
+		map[string]string{
+			clientConnectionsByVersionLabel: protocolVersion2,
+		},
+	)
+	ClientConnectionsV3 = NewMetricWithLabels(
+		clientConnectionsByVersionName,
+		clientConnectionsByVersionDescription,
+		map[string]string{
+			clientConnectionsByVersionLabel: protocolVersion3,
+		},
+	)
+	ClientConnectionsV4 = NewMetricWithLabels(
+		clientConnectionsByVersionName,
+		clientConnectionsByVersionDescription,
+		map[string]string{
+			clientConnectionsByVersionLabel: protocolVersion4,
+		},
+	)
+	ClientConnectionsV5 = NewMetricWithLabels(
+		clientConnectionsByVersionName,
+		clientConnectionsByVersionDescription,
+		map[string]string{
+			clientConnectionsByVersionLabel: protocolVersion5,
+		},
+	)
+	ClientConnectionsDseV1 = NewMetricWithLabels(
+		clientConnectionsByVersionName,
+		clientConnectionsByVersionDescription,
+		map[string]string{
+			clientConnectionsByVersionLabel: protocolVersionDse1,
+		},
+	)
+	ClientConnectionsDseV2 = NewMetricWithLabels(
+		clientConnectionsByVersionName,
+		clientConnectionsByVersionDescription,
+		map[string]string{
+			clientConnectionsByVersionLabel: protocolVersionDse2,
+		},
+	)
+
+	Cutovers = NewMetric(
+		"proxy_cutovers_total",
+		"Running total of cutovers (runtime changes of primary cluster and / or read mode) applied to the proxy",
+	)
+	LastCutoverTimestamp = NewMetric(
+		"proxy_last_cutover_timestamp_seconds",
+		"Unix timestamp of the last cutover applied to the proxy, 0 if no cutover was applied since the proxy started",
+	)
+	CutoverClientEvents = NewMetric(
+		"proxy_cutover_client_events_total",
+		"Running total of the events pushed to client connections when a cutover was applied (see ZDM_CUTOVER_CLIENT_EVENT_ENABLED)",
+	)
+
+	DroppedLateResponses = NewMetric(
+		"proxy_dropped_late_responses_total",
+		"Running total of cluster responses that were dropped because they were received after the client connection was closed",
+	)
+
+	UnknownStreamIdResponses = NewMetric(
+		"proxy_unknown_stream_id_responses_total",
+		"Running total of cluster responses that were dropped because no request was waiting for their stream id",
+	)
+
+	UnregisteredEvents = NewMetric(
+		"proxy_unregistered_events_total",
+		"Running total of events that were dropped because they were received from a cluster connection that no REGISTER request was sent to",
+	)
+
+	AbortedHandshakes = NewMetric(
+		"proxy_aborted_handshakes_total",
+		"Running total of client connections that were closed by the client while the handshake was in progress",
+	)
+
+	ClientHandshakeTimeouts = NewMetric(
+		"proxy_client_handshake_timeouts_total",
+		"Running total of client connections that were closed because the handshake was not completed in time",
+	)
+
+	ClientAuthIdleTimeouts = NewMetric(
+		"proxy_client_auth_idle_timeouts_total",
+		"Running total of client connections that were closed because the client did not answer AUTHENTICATE or AUTH_CHALLENGE in time",
+	)
+
+	UnexpectedResponses = NewMetric(
+		"proxy_unexpected_responses_total",
+		"Running total of cluster responses that the proxy could not process, see ZDM_UNEXPECTED_RESPONSE_MODE",
+	)
+
+	UnknownForwardDecisions = NewMetric(
+		"proxy_unknown_forward_decisions_total",
+		"Running total of requests that were not forwarded because the proxy could not determine where to send them, the client receives a SERVER_ERROR",
+	)
+
+	RejectedClientConnections = NewMetric(
+		"proxy_rejected_client_connections_total",
+		"Running total of client connections that were closed right after being accepted because of ZDM_PROXY_MAX_CLIENT_CONNECTIONS or ZDM_PROXY_MAX_CLIENT_CONNECTIONS_PER_IP",
+	)
+
+	RejectedKeyspaceRequests = NewMetric(
+		"proxy_rejected_keyspace_requests_total",
+		"Running total of requests that were rejected because their keyspace is not in ZDM_KEYSPACE_ALLOWLIST",
+	)
+
+	MalformedFrames = NewMetric(
+		"proxy_malformed_frames_total",
+		"Running total of client requests that were rejected with a protocol error because their body was missing",
+	)
+
+	WrongDirectionFrames = NewMetric(
+		"proxy_wrong_direction_frames_total",
+		"Running total of frames that were dropped because their opcode is not valid in the direction they were received in, e.g. a response received from a client",
+	)
+
+	LikelyRetries = NewMetric(
+		"proxy_likely_retries_total",
+		"Running total of requests that are likely client retries of a previous request, see ZDM_RETRY_DETECTION_ENABLED",
+	)
+
+	AsyncReadsMaxWaitExceeded = NewMetric(
+		"proxy_async_reads_max_wait_exceeded_total",
+		"Running total of async reads that were abandoned because the secondary cluster did not respond within ZDM_ASYNC_READS_MAX_WAIT_MS",
+	)
+
+	TargetUnpreparedWriteRetries = NewMetric(
+		"proxy_target_unprepared_write_retries_total",
+		"Running total of writes that were retried on TARGET after preparing the statement again because TARGET returned UNPREPARED",
+	)
+
+	ReadFailovers = NewMetric(
+		"proxy_read_failovers_total",
+		"Running total of reads that failed on a cluster and returned the successful response of the other cluster, see ZDM_READ_FAILOVER_ENABLED",
+	)
+
+	ReadRacesWonBySecondary = NewMetric(
+		"proxy_read_races_won_by_secondary_total",
+		"Running total of reads that were sent to both clusters and returned the response of the secondary cluster, see ZDM_READ_RACE_ENABLED",
+	)
+
+	ReadMismatchesTargetExtraRows = NewMetricWithLabels(
+		readMismatchesName,
+		readMismatchesDescription,
+		map[string]string{
+			readMismatchesTypeLabel: readMismatchTargetExtraRows,
+		},
+	)
+	ReadMismatchesOriginExtraRows = NewMetricWithLabels(
+		readMismatchesName,
+		readMismatchesDescription,
+		map[string]string{
+			readMismatchesTypeLabel: readMismatchOriginExtraRows,
+		},
+	)
+	ReadMismatchesValuesDiffer = NewMetricWithLabels(
+		readMismatchesName,
+		readMismatchesDescription,
+		map[string]string{
+			readMismatchesTypeLabel: readMismatchValuesDiffer,
+		},
+	)
+	ReadMismatchesMetadataOnly = NewMetricWithLabels(
+		readMismatchesName,
+		readMismatchesDescription,
+		map[string]string{
+			readMismatchesTypeLabel: readMismatchMetadataOnly,
+		},
+	)
+
+	MismatchReports = NewMetric(
+		"proxy_mismatch_reports_total",
+		"Running total of requests on which the clusters diverged (dual writes that failed on a single cluster and read mismatches), their details are sent to the mismatch reporter if one is configured",
+	)
+
+	LargeBatches = NewMetric(
+		"proxy_large_batches_total",
+		"Running total of BATCH requests that exceeded ZDM_BATCH_MAX_STATEMENTS or ZDM_BATCH_MAX_SIZE_BYTES, see ZDM_LARGE_BATCH_MODE",
+	)
+
+	LargeResponses = NewMetric(
+		"proxy_large_responses_total",
+		"Running total of responses with a body larger than ZDM_LARGE_RESPONSE_THRESHOLD_BYTES",
+	)
+
+	RejectedRegisterRequests = NewMetric(
+		"proxy_rejected_register_requests_total",
+		"Running total of REGISTER requests that were rejected because the client connection would exceed ZDM_MAX_REGISTERED_EVENT_TYPES",
+	)
+
+	ClusterDownBufferedRequests = NewMetric(
+		"proxy_cluster_down_buffered_requests_total",
+		"Running total of requests that were held back because a cluster that they are forwarded to was DOWN, see ZDM_CLUSTER_DOWN_BUFFER_TIMEOUT_MS",
+	)
+
+	ClusterDownRejectedRequests = NewMetric(
+		"proxy_cluster_down_rejected_requests_total",
+		"Running total of requests that were rejected with OVERLOADED because a cluster that they are forwarded to was DOWN and they could not be held back",
+	)
+
+	CqlVersionMismatches = NewMetric(
+		"proxy_cql_version_mismatches_total",
+		"Running total of client STARTUP requests with a CQL_VERSION that is not supported by both clusters, they are forwarded with a CQL_VERSION that both clusters support if there is one",
+	)
+
+	QuarantinedPreparedStatements = NewMetric(
+		"proxy_quarantined_prepared_statements_total",
+		"Running total of prepared statements that were quarantined (only forwarded to ORIGIN) because they kept failing on TARGET, see ZDM_PS_QUARANTINE_FAILURE_THRESHOLD",
+	)
+
+	TrackingMapEntries = NewMetric(
+		"proxy_tracking_map_entries",
+		"Number of entries in the in-memory maps that track recent requests (e.g. the retry detection), see ZDM_TRACKING_MAP_MAX_ENTRIES",
+	)
+
+	TrackingMapEvictions = NewMetric(
+		"proxy_tracking_map_evictions_total",
+		"Running total of entries that were evicted from the in-memory maps that track recent requests because they expired or the map was full, see ZDM_TRACKING_MAP_MAX_AGE_MS",
+	)
+
+	UnloggedBatchPartialDivergences = NewMetric(
+		"proxy_unlogged_batch_partial_divergences_total",
+		"Running total of UNLOGGED batches that may have been partially applied on at least one cluster (write timeout or write failure) so the clusters may now contain different data",
+	)
+
+	BatchWarningDivergences = NewMetric(
+		"proxy_batch_warning_divergences_total",
+		"Running total of dual-written batches that succeeded on both clusters with different warnings (e.g. \"Batch too large\" on only one cluster)",
+	)
+
+	HandshakesInProgress = NewMetric(
+		"proxy_handshakes_in_progress",
+		"Number of client handshakes that are in progress, see ZDM_MAX_CONCURRENT_HANDSHAKES",
+	)
+
+	Goroutines = NewMetric(
+		"proxy_goroutines",
+		"Number of goroutines that currently exist in the proxy process",
+	)
+	ClientHandlers = NewMetric(
+		"proxy_client_handlers",
+		"Number of client handlers that are running, a handler is counted until its client connection is released",
+	)
+	ClientHandlerInFlightGoroutines = NewMetric(
+		"proxy_client_handler_inflight_goroutines",
+		"Number of goroutines that are processing requests and responses on behalf of all client handlers",
+	)
+	ClientHandlerMaxInFlightGoroutines = NewMetric(
+		"proxy_client_handler_max_inflight_goroutines",
+		"Number of goroutines that are processing requests and responses on behalf of the busiest client handler",
+	)
+
+	RequestQueueDepth = NewMetric(
+		"proxy_request_queue_depth",
+		"Number of requests that were read from the client connections and are waiting to be processed by the client handlers",
+	)
+	ResponseQueueDepth = NewMetric(
+		"proxy_response_queue_depth",
+		"Number of responses that were read from the cluster connections and are waiting to be processed by the client handlers",
+	)
+	EventQueueDepth = NewMetric(
+		"proxy_event_queue_depth",
+		"Number of protocol events that were read from the cluster connections and are waiting to be forwarded to the clients",
+	)
+
+	DroppedEvents = NewMetric(
+		"proxy_dropped_events_total",
+		"Running total of protocol events that were not sent to clients because they were not reading them fast enough, see ZDM_EVENT_DELIVERY_MODE",
+	)
+
+	DroppedEventsOnShutdown = NewMetric(
+		"proxy_dropped_events_on_shutdown_total",
+		"Running total of protocol events that were not sent to clients because the client connection was shutting down, see ZDM_SHUTDOWN_FLUSH_TIMEOUT_MS",
+	)
+
+	OriginRequestErrorRate = NewMetric(
+		"origin_requests_error_rate",
+		"Ratio of failed requests to total requests sent to Origin Cluster over the last ZDM_METRICS_ERROR_RATE_WINDOW_MS",
+	)
+	TargetRequestErrorRate = NewMetric(
+		"target_requests_error_rate",
+		"Ratio of failed requests to total requests sent to Target Cluster over the last ZDM_METRICS_ERROR_RATE_WINDOW_MS",
+	)
+
+	ReadRoutingBias = NewMetric(
+		"proxy_read_routing_bias",
+		"Cluster that reads are routed to by ZDM_ADAPTIVE_READ_ROUTING_ENABLED: 1 for Target, -1 for Origin and 0 if adaptive read routing is disabled",
+	)
+
+	OriginControlConnectionsEstablished = NewMetric(
+		"origin_control_connections_established",
+		"Number of times the control connection to Origin Cluster was established, including reconnections",
+	)
+	TargetControlConnectionsEstablished = NewMetric(
+		"target_control_connections_established",
+		"Number of times the control connection to Target Cluster was established, including reconnections",
+	)
+
+	OriginControlConnectionAge = NewMetric(
+		"origin_control_connection_age_seconds",
+		"Number of seconds since the current control connection to Origin Cluster was established",
+	)
+	TargetControlConnectionAge = NewMetric(
+		"target_control_connection_age_seconds",
+		"Number of seconds since the current control connection to Target Cluster was established",
+	)
+
+	OriginControlFrames = NewMetricWithLabels(
+		framesSentName,
+		framesSentDescription,
+		map[string]string{
+			framesSentClusterLabel: failedRequestsClusterOrigin,
+			framesSentTypeLabel:    frameTypeControl,
+		},
+	)
+	OriginDataFrames = NewMetricWithLabels(
+		framesSentName,
+		framesSentDescription,
+		map[string]string{
+			framesSentClusterLabel: failedRequestsClusterOrigin,
+			framesSentTypeLabel:    frameTypeData,
+		},
+	)
+	TargetControlFrames = NewMetricWithLabels(
+		framesSentName,
+		framesSentDescription,
+		map[string]string{
+			framesSentClusterLabel: failedRequestsClusterTarget,
+			framesSentTypeLabel:    frameTypeControl,
+		},
+	)
+	TargetDataFrames = NewMetricWithLabels(
+		framesSentName,
+		framesSentDescription,
+		map[string]string{
+			framesSentClusterLabel: failedRequestsClusterTarget,
+			framesSentTypeLabel:    frameTypeData,
+		},
+	)
+
+	RequestsQuery = NewMetricWithLabels(
+		requestsByOpCodeName,
+		requestsByOpCodeDescription,
+		map[string]string{
+			requestsByOpCodeLabel: opCodeQuery,
+		},
+	)
+	RequestsExecute = NewMetricWithLabels(
+		requestsByOpCodeName,
+		requestsByOpCodeDescription,
+		map[string]string{
+			requestsByOpCodeLabel: opCodeExecute,
+		},
+	)
+	RequestsPrepare = NewMetricWithLabels(
+		requestsByOpCodeName,
+		requestsByOpCodeDescription,
+		map[string]string{
+			requestsByOpCodeLabel: opCodePrepare,
+		},
+	)
+	RequestsBatch = NewMetricWithLabels(
+		requestsByOpCodeName,
+		requestsByOpCodeDescription,
+		map[string]string{
+			requestsByOpCodeLabel: opCodeBatch,
+		},
+	)
+	RequestsRegister = NewMetricWithLabels(
+		requestsByOpCodeName,
+		requestsByOpCodeDescription,
+		map[string]string{
+			requestsByOpCodeLabel: opCodeRegister,
+		},
+	)
+	RequestsOther = NewMetricWithLabels(
+		requestsByOpCodeName,
+		requestsByOpCodeDescription,
+		map[string]string{
+			requestsByOpCodeLabel: opCodeOther,
+		},
+	)
 )
 
 type ProxyMetrics struct {
@@ -129,6 +649,12 @@ type ProxyMetrics struct {
 	FailedWritesOnTarget Counter
 	FailedWritesOnBoth   Counter
 
+	ToleratedAlreadyExistsOrigin Counter
+	ToleratedAlreadyExistsTarget Counter
+
+	BackendProtocolErrorsOrigin Counter
+	BackendProtocolErrorsTarget Counter
+
 	PSCacheSize      GaugeFunc
 	PSCacheMissCount Counter
 
@@ -136,9 +662,103 @@ type ProxyMetrics struct {
 	ProxyReadsTargetDuration Histogram
 	ProxyWritesDuration      Histogram
 
+	SloBreachesReadsOrigin Counter
+	SloBreachesReadsTarget Counter
+	SloBreachesWrites      Counter
+
 	InFlightReadsOrigin Gauge
 	InFlightReadsTarget Gauge
 	InFlightWrites      Gauge
 
 	OpenClientConnections GaugeFunc
+
+	ClientConnectionsV2    Gauge
+	ClientConnectionsV3    Gauge
+	ClientConnectionsV4    Gauge
+	ClientConnectionsV5    Gauge
+	ClientConnectionsDseV1 Gauge
+	ClientConnectionsDseV2 Gauge
+
+	Cutovers             Counter
+	LastCutoverTimestamp GaugeFunc
+	CutoverClientEvents  Counter
+
+	DroppedLateResponses     Counter
+	UnknownStreamIdResponses Counter
+	UnregisteredEvents       Counter
+
+	ClientHandshakeTimeouts Counter
+	ClientAuthIdleTimeouts  Counter
+	AbortedHandshakes       Counter
+
+	UnexpectedResponses     Counter
+	UnknownForwardDecisions Counter
+
+	RejectedClientConnections Counter
+	RejectedKeyspaceRequests  Counter
+
+	MalformedFrames      Counter
+	WrongDirectionFrames Counter
+
+	DroppedEvents           Counter
+	DroppedEventsOnShutdown Counter
+
+	LikelyRetries Counter
+
+	AsyncReadsMaxWaitExceeded Counter
+
+	TargetUnpreparedWriteRetries    Counter
+	ReadFailovers                   Counter
+	ReadRacesWonBySecondary         Counter
+	ReadMismatchesTargetExtraRows   Counter
+	ReadMismatchesOriginExtraRows   Counter
+	ReadMismatchesValuesDiffer      Counter
+	ReadMismatchesMetadataOnly      Counter
+	MismatchReports                 Counter
+	UnloggedBatchPartialDivergences Counter
+	BatchWarningDivergences         Counter
+	QuarantinedPreparedStatements   Counter
+	LargeBatches                    Counter
+	LargeResponses                  Counter
+	RejectedRegisterRequests        Counter
+	ClusterDownBufferedRequests     Counter
+	ClusterDownRejectedRequests     Counter
+	CqlVersionMismatches            Counter
+
+	HandshakesInProgress Gauge
+
+	Goroutines                         GaugeFunc
+	ClientHandlers                     GaugeFunc
+	ClientHandlerInFlightGoroutines    GaugeFunc
+	ClientHandlerMaxInFlightGoroutines GaugeFunc
+
+	RequestQueueDepth  GaugeFunc
+	ResponseQueueDepth GaugeFunc
+	EventQueueDepth    GaugeFunc
+
+	TrackingMapEntries   Gauge
+	TrackingMapEvictions Counter
+
+	OriginRequestErrorRate GaugeFunc
+	TargetRequestErrorRate GaugeFunc
+
+	ReadRoutingBias GaugeFunc
+
+	OriginControlConnectionsEstablished GaugeFunc
+	TargetControlConnectionsEstablished GaugeFunc
+
+	OriginControlConnectionAge GaugeFunc
+	TargetControlConnectionAge GaugeFunc
+
+	RequestsQuery    Counter
+	RequestsExecute  Counter
+	RequestsPrepare  Counter
+	RequestsBatch    Counter
+	RequestsRegister Counter
+	RequestsOther    Counter
+
+	OriginControlFrames Counter
+	OriginDataFrames    Counter
+	TargetControlFrames Counter
+	TargetDataFrames    Counter
 }
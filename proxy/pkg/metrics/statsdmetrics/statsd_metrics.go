@@ -0,0 +1,87 @@
+package statsdmetrics
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+type StatsdCounter struct {
+	f      *StatsdMetricFactory
+	name   string
+	suffix string
+}
+
+func (recv *StatsdCounter) Add(valueToAdd int) {
+	if !recv.f.sample() {
+		return
+	}
+	recv.f.send(fmt.Sprintf("%v:%d|c%v", recv.name, valueToAdd, recv.suffix))
+}
+
+// StatsdGauge keeps the absolute value of the gauge, it is sent every time the factory flushes its buffer so that the
+// value kept by the StatsD server doesn't drift when a line is dropped (see StatsdMetricFactory.send) or lost.
+type StatsdGauge struct {
+	value  int64
+	name   string
+	suffix string
+}
+
+func (recv *StatsdGauge) Add(valueToAdd int) {
+	atomic.AddInt64(&recv.value, int64(valueToAdd))
+}
+
+func (recv *StatsdGauge) Subtract(valueToSubtract int) {
+	atomic.AddInt64(&recv.value, -int64(valueToSubtract))
+}
+
+func (recv *StatsdGauge) lines() []string {
+	return formatGauge(recv.name, float64(atomic.LoadInt64(&recv.value)), recv.suffix)
+}
+
+// StatsdGaugeFunc is sent with its absolute value every time the factory flushes its buffer.
+type StatsdGaugeFunc struct {
+	name   string
+	suffix string
+	mf     func() float64
+}
+
+func (recv *StatsdGaugeFunc) lines() []string {
+	return formatGauge(recv.name, recv.mf(), recv.suffix)
+}
+
+func formatGauge(name string, value float64, suffix string) []string {
+	if value < 0 {
+		// a value with a sign is a relative update so the gauge has to be reset before a negative value is set
+		return []string{
+			fmt.Sprintf("%v:0|g%v", name, suffix),
+			fmt.Sprintf("%v:%v|g%v", name, formatFloat(value), suffix)}
+	}
+	return []string{fmt.Sprintf("%v:%v|g%v", name, formatFloat(value), suffix)}
+}
+
+// StatsdHistogram is sent as a StatsD timer so the elapsed time is in milliseconds.
+type StatsdHistogram struct {
+	f      *StatsdMetricFactory
+	name   string
+	suffix string
+}
+
+func (recv *StatsdHistogram) Track(begin time.Time) {
+	if !recv.f.sample() {
+		return
+	}
+	elapsedTimeInMs := float64(time.Since(begin)) / float64(time.Millisecond)
+	recv.f.send(fmt.Sprintf("%v:%v|ms%v", recv.name, formatFloat(elapsedTimeInMs), recv.suffix))
+}
+
+// formatFloat doesn't use the exponent format because StatsD servers don't support it.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (f *StatsdMetricFactory) sample() bool {
+	return f.sampleRate >= 1 || rand.Float64() < f.sampleRate
+}
@@ -0,0 +1,245 @@
+package statsdmetrics
+
+import (
+	"fmt"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metricsPrefix = "zdm."
+
+	// Metric lines are buffered and sent in packets of at most this size to avoid IP fragmentation.
+	maxPacketSize = 1432
+
+	// Number of metric lines that can be buffered before new lines are dropped.
+	bufferedLines = 8192
+
+	defaultFlushInterval = time.Second
+)
+
+// StatsdMetricFactory sends metrics to a StatsD/DogStatsD endpoint over UDP. Labels and the configured tags are sent
+// as DogStatsD tags, counters and histograms are sampled according to the sample rate.
+// Metric updates never block: they are buffered and sent by a background goroutine, they are dropped if the buffer is full.
+// Gauges are not affected because their absolute values are sent every flush interval.
+type StatsdMetricFactory struct {
+	conn          net.Conn
+	tags          []string
+	sampleRate    float64
+	flushInterval time.Duration
+
+	lines chan string
+
+	lock       *sync.Mutex
+	gauges     map[string]*StatsdGauge
+	gaugeFuncs map[string]*StatsdGaugeFunc
+	closed     bool
+	shutdown   chan struct{}
+	done       chan struct{}
+}
+
+/***
+	Instantiation and initialization
+ ***/
+
+func NewStatsdMetricFactory(address string, tags []string, sampleRate float64) (*StatsdMetricFactory, error) {
+	return newStatsdMetricFactory(address, tags, sampleRate, defaultFlushInterval)
+}
+
+func newStatsdMetricFactory(
+	address string, tags []string, sampleRate float64, flushInterval time.Duration) (*StatsdMetricFactory, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open StatsD connection to %v: %w", address, err)
+	}
+
+	f := &StatsdMetricFactory{
+		conn:          conn,
+		tags:          tags,
+		sampleRate:    sampleRate,
+		flushInterval: flushInterval,
+		lines:         make(chan string, bufferedLines),
+		lock:          &sync.Mutex{},
+		gauges:        make(map[string]*StatsdGauge),
+		gaugeFuncs:    make(map[string]*StatsdGaugeFunc),
+		shutdown:      make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go f.run()
+	log.Infof("Sending metrics to StatsD endpoint %v.", address)
+	return f, nil
+}
+
+/***
+	Methods for adding metrics
+ ***/
+
+func (f *StatsdMetricFactory) GetOrCreateCounter(mn metrics.Metric) (metrics.Counter, error) {
+	return &StatsdCounter{f: f, name: getName(mn), suffix: f.getSuffix(mn, true)}, nil
+}
+
+func (f *StatsdMetricFactory) GetOrCreateGauge(mn metrics.Metric) (metrics.Gauge, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if g, ok := f.gauges[mn.String()]; ok {
+		return g, nil
+	}
+	g := &StatsdGauge{name: getName(mn), suffix: f.getSuffix(mn, false)}
+	f.gauges[mn.String()] = g
+	return g, nil
+}
+
+func (f *StatsdMetricFactory) GetOrCreateGaugeFunc(mn metrics.Metric, mf func() float64) (metrics.GaugeFunc, error) {
+	gf := &StatsdGaugeFunc{name: getName(mn), suffix: f.getSuffix(mn, false), mf: mf}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.gaugeFuncs[mn.String()] = gf
+	return gf, nil
+}
+
+// GetOrCreateHistogram ignores the buckets, StatsD servers compute their own aggregations of timers.
+func (f *StatsdMetricFactory) GetOrCreateHistogram(mn metrics.Metric, buckets []float64) (metrics.Histogram, error) {
+	return &StatsdHistogram{f: f, name: getName(mn), suffix: f.getSuffix(mn, true)}, nil
+}
+
+// UnregisterAllMetrics sends the buffered metrics and the last values of the gauges and gauge functions, then it stops
+// them and closes the connection.
+// Metrics that are updated afterwards are dropped.
+func (f *StatsdMetricFactory) UnregisterAllMetrics() error {
+	f.lock.Lock()
+	if f.closed {
+		f.lock.Unlock()
+		return nil
+	}
+	f.closed = true
+	f.lock.Unlock()
+
+	close(f.shutdown)
+	<-f.done
+
+	f.lock.Lock()
+	f.gauges = make(map[string]*StatsdGauge)
+	f.gaugeFuncs = make(map[string]*StatsdGaugeFunc)
+	f.lock.Unlock()
+	return f.conn.Close()
+}
+
+// HttpHandler returns the http handler implementation for the metrics endpoint.
+func (f *StatsdMetricFactory) HttpHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.Error(writer, "Metrics are sent to StatsD on this proxy instance.", http.StatusNotFound)
+	})
+}
+
+func (f *StatsdMetricFactory) send(line string) {
+	select {
+	case f.lines <- line:
+	default:
+		// dropping the metric is better than slowing down requests
+	}
+}
+
+func (f *StatsdMetricFactory) run() {
+	defer close(f.done)
+	ticker := time.NewTicker(f.flushInterval)
+	defer ticker.Stop()
+
+	packet := make([]byte, 0, maxPacketSize)
+	write := func(line string) {
+		if len(packet) > 0 && len(packet)+1+len(line) > maxPacketSize {
+			packet = f.flush(packet)
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+
+	for {
+		select {
+		case line := <-f.lines:
+			write(line)
+		case <-ticker.C:
+			for _, line := range f.getGaugeLines() {
+				write(line)
+			}
+			packet = f.flush(packet)
+		case <-f.shutdown:
+			for {
+				select {
+				case line := <-f.lines:
+					write(line)
+				default:
+					for _, line := range f.getGaugeLines() {
+						write(line)
+					}
+					f.flush(packet)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (f *StatsdMetricFactory) flush(packet []byte) []byte {
+	if len(packet) == 0 {
+		return packet
+	}
+	_, err := f.conn.Write(packet)
+	if err != nil {
+		log.Debugf("Failed to send metrics to StatsD: %v.", err)
+	}
+	return packet[:0]
+}
+
+func (f *StatsdMetricFactory) getGaugeLines() []string {
+	f.lock.Lock()
+	gauges := make([]*StatsdGauge, 0, len(f.gauges))
+	for _, g := range f.gauges {
+		gauges = append(gauges, g)
+	}
+	gaugeFuncs := make([]*StatsdGaugeFunc, 0, len(f.gaugeFuncs))
+	for _, gf := range f.gaugeFuncs {
+		gaugeFuncs = append(gaugeFuncs, gf)
+	}
+	f.lock.Unlock()
+
+	lines := make([]string, 0, len(gauges)+len(gaugeFuncs))
+	for _, g := range gauges {
+		lines = append(lines, g.lines()...)
+	}
+	for _, gf := range gaugeFuncs {
+		lines = append(lines, gf.lines()...)
+	}
+	return lines
+}
+
+// getSuffix returns the sample rate (only for sampled metric types) and the tags that are appended to every line of the metric.
+func (f *StatsdMetricFactory) getSuffix(mn metrics.Metric, sampled bool) string {
+	sb := strings.Builder{}
+	if sampled && f.sampleRate < 1 {
+		sb.WriteString(fmt.Sprintf("|@%v", f.sampleRate))
+	}
+
+	tags := make([]string, 0, len(mn.GetLabels())+len(f.tags))
+	for key, value := range mn.GetLabels() {
+		tags = append(tags, key+":"+value)
+	}
+	sort.Strings(tags)
+	tags = append(tags, f.tags...)
+	if len(tags) > 0 {
+		sb.WriteString("|#")
+		sb.WriteString(strings.Join(tags, ","))
+	}
+	return sb.String()
+}
+
+func getName(mn metrics.Metric) string {
+	return metricsPrefix + mn.GetName()
+}
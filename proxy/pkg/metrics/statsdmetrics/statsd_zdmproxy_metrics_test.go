@@ -0,0 +1,166 @@
+package statsdmetrics
+
+import (
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockStatsdServer struct {
+	conn  net.PacketConn
+	lines chan string
+}
+
+func newMockStatsdServer(t *testing.T) *mockStatsdServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	server := &mockStatsdServer{conn: conn, lines: make(chan string, 1000)}
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, line := range strings.Split(string(buf[:n]), "\n") {
+				server.lines <- line
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return server
+}
+
+func (recv *mockStatsdServer) nextLine(t *testing.T) string {
+	select {
+	case line := <-recv.lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a StatsD packet")
+		return ""
+	}
+}
+
+// nextLineWithPrefix skips the lines of the gauges that are sent every flush interval.
+func (recv *mockStatsdServer) nextLineWithPrefix(t *testing.T, prefix string) string {
+	for {
+		if line := recv.nextLine(t); strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+}
+
+// remainingLines returns the lines that are received until the server doesn't receive anything for a while.
+func (recv *mockStatsdServer) remainingLines() []string {
+	var lines []string
+	for {
+		select {
+		case line := <-recv.lines:
+			lines = append(lines, line)
+		case <-time.After(200 * time.Millisecond):
+			return lines
+		}
+	}
+}
+
+func TestStatsdMetricFactory(t *testing.T) {
+	server := newMockStatsdServer(t)
+	f, err := newStatsdMetricFactory(server.conn.LocalAddr().String(), []string{"env:test"}, 1, 50*time.Millisecond)
+	require.Nil(t, err)
+	defer f.UnregisterAllMetrics()
+
+	counter, err := f.GetOrCreateCounter(metrics.NewMetricWithLabels("requests_total", "", map[string]string{"cluster": "origin", "type": "read"}))
+	require.Nil(t, err)
+	counter.Add(3)
+	require.Equal(t, "zdm.requests_total:3|c|#cluster:origin,type:read,env:test", server.nextLine(t))
+
+	gauge, err := f.GetOrCreateGauge(metrics.NewMetric("open_connections", ""))
+	require.Nil(t, err)
+	gauge.Add(2)
+	gauge.Subtract(1)
+	require.Equal(t, "zdm.open_connections:1|g|#env:test", server.nextLineWithPrefix(t, "zdm.open_connections"))
+	// the same gauge is returned for the same metric so that its absolute value is shared
+	sameGauge, err := f.GetOrCreateGauge(metrics.NewMetric("open_connections", ""))
+	require.Nil(t, err)
+	require.Same(t, gauge, sameGauge)
+	sameGauge.Subtract(3)
+	require.Equal(t, "zdm.open_connections:0|g|#env:test", server.nextLineWithPrefix(t, "zdm.open_connections"))
+	require.Equal(t, "zdm.open_connections:-2|g|#env:test", server.nextLine(t))
+
+	histogram, err := f.GetOrCreateHistogram(metrics.NewMetric("request_duration_seconds", ""), []float64{0.1, 1})
+	require.Nil(t, err)
+	histogram.Track(time.Now().Add(-15 * time.Millisecond))
+	require.Regexp(t, regexp.MustCompile(`^zdm\.request_duration_seconds:1[5-9](\.\d+)?\|ms\|#env:test$`),
+		server.nextLineWithPrefix(t, "zdm.request_duration_seconds"))
+
+	_, err = f.GetOrCreateGaugeFunc(metrics.NewMetric("cache_size", ""), func() float64 { return 1.5 })
+	require.Nil(t, err)
+	require.Equal(t, "zdm.cache_size:1.5|g|#env:test", server.nextLineWithPrefix(t, "zdm.cache_size"))
+
+	require.Nil(t, f.UnregisterAllMetrics())
+	// metrics that are updated after the factory is closed are dropped
+	counter.Add(1)
+}
+
+func TestStatsdMetricFactory_SampleRate(t *testing.T) {
+	server := newMockStatsdServer(t)
+	f, err := newStatsdMetricFactory(server.conn.LocalAddr().String(), nil, 0.5, 50*time.Millisecond)
+	require.Nil(t, err)
+	defer f.UnregisterAllMetrics()
+
+	counter, err := f.GetOrCreateCounter(metrics.NewMetric("requests_total", ""))
+	require.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		counter.Add(1)
+	}
+	// gauges are never sampled
+	gauge, err := f.GetOrCreateGauge(metrics.NewMetric("open_connections", ""))
+	require.Nil(t, err)
+	gauge.Add(1)
+	require.Nil(t, f.UnregisterAllMetrics())
+
+	sampled := 0
+	gaugeSent := false
+	for _, line := range server.remainingLines() {
+		if line == "zdm.open_connections:1|g" {
+			gaugeSent = true
+			continue
+		}
+		require.Equal(t, "zdm.requests_total:1|c|@0.5", line)
+		sampled++
+	}
+	require.True(t, gaugeSent)
+	require.Greater(t, sampled, 350)
+	require.Less(t, sampled, 650)
+}
+
+func TestStatsdGaugeFunc_NegativeValue(t *testing.T) {
+	gf := &StatsdGaugeFunc{name: "zdm.gauge", mf: func() float64 { return -2 }}
+	require.Equal(t, []string{"zdm.gauge:0|g", "zdm.gauge:-2|g"}, gf.lines())
+}
+
+// The absolute value is sent every flush interval so the StatsD server gets the right value even if the lines of
+// other metrics are dropped because the buffer is full.
+func TestStatsdGauge_BufferFull(t *testing.T) {
+	server := newMockStatsdServer(t)
+	f, err := newStatsdMetricFactory(server.conn.LocalAddr().String(), nil, 1, 50*time.Millisecond)
+	require.Nil(t, err)
+	defer f.UnregisterAllMetrics()
+
+	for len(f.lines) < cap(f.lines) {
+		f.lines <- "zdm.filler:1|c"
+	}
+	gauge, err := f.GetOrCreateGauge(metrics.NewMetric("open_connections", ""))
+	require.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		gauge.Add(1)
+	}
+	gauge.Subtract(3)
+	require.Equal(t, "zdm.open_connections:7|g", server.nextLineWithPrefix(t, "zdm.open_connections"))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/datastax/zdm-proxy/proxy/pkg/admin"
 	"github.com/datastax/zdm-proxy/proxy/pkg/config"
 	"github.com/datastax/zdm-proxy/proxy/pkg/health"
 	"github.com/datastax/zdm-proxy/proxy/pkg/httpzdmproxy"
@@ -16,21 +17,27 @@ import (
 	"time"
 )
 
-func SetupHandlers() (metricsHandler *httpzdmproxy.HandlerWithFallback, readinessHandler *httpzdmproxy.HandlerWithFallback) {
+func SetupHandlers() (
+	metricsHandler *httpzdmproxy.HandlerWithFallback,
+	readinessHandler *httpzdmproxy.HandlerWithFallback,
+	adminHandler *httpzdmproxy.HandlerWithFallback) {
 	metricsHandler = httpzdmproxy.NewHandlerWithFallback(metrics.DefaultHttpHandler())
 	readinessHandler = httpzdmproxy.NewHandlerWithFallback(health.DefaultReadinessHandler())
+	adminHandler = httpzdmproxy.NewHandlerWithFallback(admin.DefaultHandler())
 
 	http.Handle("/metrics", metricsHandler.Handler())
 	http.Handle("/health/readiness", readinessHandler.Handler())
 	http.Handle("/health/liveness", health.LivenessHandler())
-	return metricsHandler, readinessHandler
+	http.Handle("/admin/", adminHandler.Handler())
+	return metricsHandler, readinessHandler, adminHandler
 }
 
 func RunMain(
 	conf *config.Config,
 	ctx context.Context,
 	metricsHandler *httpzdmproxy.HandlerWithFallback,
-	readinessHandler *httpzdmproxy.HandlerWithFallback) {
+	readinessHandler *httpzdmproxy.HandlerWithFallback,
+	adminHandler *httpzdmproxy.HandlerWithFallback) {
 
 	log.Infof("Starting http server (metrics and health checks) on %v:%d", conf.MetricsAddress, conf.MetricsPort)
 	wg := &sync.WaitGroup{}
@@ -48,6 +55,7 @@ func RunMain(
 	if err == nil {
 		metricsHandler.SetHandler(zdmProxy.GetMetricHandler().GetHttpHandler())
 		readinessHandler.SetHandler(health.ReadinessHandler(zdmProxy))
+		adminHandler.SetHandler(admin.Handler(zdmProxy))
 
 		log.Info("Proxy started. Waiting for SIGINT/SIGTERM to shutdown.")
 		<-ctx.Done()
@@ -55,6 +63,7 @@ func RunMain(
 		zdmProxy.Shutdown()
 		metricsHandler.ClearHandler()
 		readinessHandler.ClearHandler()
+		adminHandler.ClearHandler()
 	} else if !errors.Is(err, zdmproxy.ShutdownErr) {
 		log.Errorf("Error launching proxy: %v", err)
 	}
@@ -0,0 +1,40 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"math/rand"
+)
+
+// asyncReadScope selects the reads that are also sent to the async connector, reads are first filtered by opcode
+// and then sampled. A nil asyncReadScope selects every read.
+type asyncReadScope struct {
+	opCodes       map[primitive.OpCode]bool
+	samplePercent int
+	rand          *rand.Rand
+}
+
+func newAsyncReadScope(opCodes []primitive.OpCode, samplePercent int, rnd *rand.Rand) *asyncReadScope {
+	if len(opCodes) == 0 && samplePercent >= 100 {
+		return nil
+	}
+
+	scope := &asyncReadScope{samplePercent: samplePercent, rand: rnd}
+	if len(opCodes) > 0 {
+		scope.opCodes = make(map[primitive.OpCode]bool)
+		for _, opCode := range opCodes {
+			scope.opCodes[opCode] = true
+		}
+	}
+	return scope
+}
+
+// includes returns true if a read with the provided opcode should also be sent to the async connector.
+func (recv *asyncReadScope) includes(opCode primitive.OpCode) bool {
+	if recv == nil {
+		return true
+	}
+	if recv.opCodes != nil && !recv.opCodes[opCode] {
+		return false
+	}
+	return recv.samplePercent >= 100 || recv.rand.Intn(100) < recv.samplePercent
+}
@@ -0,0 +1,57 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAsyncReadScope_Includes(t *testing.T) {
+	rnd := NewThreadSafeRand()
+	require.Nil(t, newAsyncReadScope(nil, 100, rnd))
+
+	tests := []struct {
+		name            string
+		opCodes         []primitive.OpCode
+		samplePercent   int
+		expectedQuery   int
+		expectedExecute int
+	}{
+		{"disabled", nil, 100, 1000, 1000},
+		{"query only", []primitive.OpCode{primitive.OpCodeQuery}, 100, 1000, 0},
+		{"execute only", []primitive.OpCode{primitive.OpCodeExecute}, 100, 0, 1000},
+		{"both opcodes", []primitive.OpCode{primitive.OpCodeQuery, primitive.OpCodeExecute}, 100, 1000, 1000},
+		{"no sampling", nil, 0, 0, 0},
+		{"query only no sampling", []primitive.OpCode{primitive.OpCodeQuery}, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope := newAsyncReadScope(tt.opCodes, tt.samplePercent, rnd)
+			query, execute := 0, 0
+			for i := 0; i < 1000; i++ {
+				if scope.includes(primitive.OpCodeQuery) {
+					query++
+				}
+				if scope.includes(primitive.OpCodeExecute) {
+					execute++
+				}
+			}
+			require.Equal(t, tt.expectedQuery, query)
+			require.Equal(t, tt.expectedExecute, execute)
+		})
+	}
+
+	// sampling is applied to the reads with the selected opcodes
+	scope := newAsyncReadScope([]primitive.OpCode{primitive.OpCodeExecute}, 50, rnd)
+	query, execute := 0, 0
+	for i := 0; i < 10000; i++ {
+		if scope.includes(primitive.OpCodeQuery) {
+			query++
+		}
+		if scope.includes(primitive.OpCodeExecute) {
+			execute++
+		}
+	}
+	require.Equal(t, 0, query)
+	require.InDelta(t, 5000, execute, 500)
+}
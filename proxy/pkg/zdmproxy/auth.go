@@ -11,7 +11,7 @@ import (
 // Returns a proper response frame to authenticate using passed in username and password
 // Utilizes the users request frame to maintain the correct version & stream id.
 func performHandshakeStep(
-	authenticator *DsePlainTextAuthenticator,
+	authenticator Authenticator,
 	version primitive.ProtocolVersion,
 	streamId int16,
 	lastResponse *frame.Frame) (*frame.Frame, error) {
@@ -85,6 +85,41 @@ func (c *AuthCredentials) Unmarshal(token []byte) error {
 	}
 }
 
+// Authenticator produces the tokens of the AUTH_RESPONSE requests that the proxy sends when it performs a handshake
+// with a cluster, e.g. the secondary handshake or the handshake of a control connection.
+// A new Authenticator is created for every handshake so implementations can keep the state of a multi step
+// authentication (like SASL mechanisms).
+type Authenticator interface {
+	// InitialResponse returns the token of the first AUTH_RESPONSE, authenticator is the class name that the cluster
+	// sent in the AUTHENTICATE response.
+	InitialResponse(authenticator string) ([]byte, error)
+
+	// EvaluateChallenge returns the token of the AUTH_RESPONSE that answers an AUTH_CHALLENGE sent by the cluster.
+	EvaluateChallenge(challenge []byte) ([]byte, error)
+}
+
+// AuthenticatorProvider creates the Authenticator of a handshake with a cluster, credentials are the credentials
+// that the proxy would use for that handshake (see CredentialsProvider).
+type AuthenticatorProvider func(credentials *AuthCredentials) (Authenticator, error)
+
+// NewDsePlainTextAuthenticator is the default AuthenticatorProvider, it performs PLAIN authentications.
+func NewDsePlainTextAuthenticator(credentials *AuthCredentials) (Authenticator, error) {
+	return &DsePlainTextAuthenticator{Credentials: credentials}, nil
+}
+
+// newAuthenticator creates an Authenticator with the provided AuthenticatorProvider,
+// NewDsePlainTextAuthenticator is used if the provider is nil.
+func newAuthenticator(provider AuthenticatorProvider, credentials *AuthCredentials) (Authenticator, error) {
+	if provider == nil {
+		provider = NewDsePlainTextAuthenticator
+	}
+	authenticator, err := provider(credentials)
+	if err != nil {
+		return nil, fmt.Errorf("could not create authenticator: %w", err)
+	}
+	return authenticator, nil
+}
+
 // DsePlainTextAuthenticator is a simple authenticator to perform plain-text authentications for CQL clients.
 type DsePlainTextAuthenticator struct {
 	Credentials *AuthCredentials
@@ -0,0 +1,102 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+)
+
+// batchLimit detects the BATCH requests that exceed ZDM_BATCH_MAX_STATEMENTS or ZDM_BATCH_MAX_SIZE_BYTES,
+// a nil batchLimit doesn't check any request.
+type batchLimit struct {
+	maxStatements int
+	maxSizeBytes  int
+	mode          common.LargeBatchMode
+}
+
+func newBatchLimit(maxStatements int, maxSizeBytes int, mode common.LargeBatchMode) *batchLimit {
+	if maxStatements <= 0 && maxSizeBytes <= 0 {
+		return nil
+	}
+	return &batchLimit{
+		maxStatements: maxStatements,
+		maxSizeBytes:  maxSizeBytes,
+		mode:          mode,
+	}
+}
+
+// check returns a LargeBatchError if the request is a BATCH that exceeds one of the thresholds.
+// The size of the batch is estimated with the size of the frame body so it includes the bound values.
+func (recv *batchLimit) check(frameContext *frameDecodeContext) error {
+	f := frameContext.GetRawFrame()
+	if recv == nil || f.Header.OpCode != primitive.OpCodeBatch {
+		return nil
+	}
+
+	if recv.maxSizeBytes > 0 && len(f.Body) > recv.maxSizeBytes {
+		return &LargeBatchError{
+			Header: f.Header, reason: fmt.Sprintf("%v bytes, the limit is %v bytes", len(f.Body), recv.maxSizeBytes)}
+	}
+
+	if recv.maxStatements <= 0 {
+		return nil
+	}
+	decodedFrame, err := frameContext.GetOrDecodeFrame()
+	if err != nil {
+		return fmt.Errorf("could not decode batch raw frame: %w", err)
+	}
+	batchMsg, ok := decodedFrame.Body.Message.(*message.Batch)
+	if !ok {
+		return fmt.Errorf("could not convert message with batch op code to batch type, got %v instead", decodedFrame.Body.Message)
+	}
+	if len(batchMsg.Children) > recv.maxStatements {
+		return &LargeBatchError{
+			Header: f.Header, reason: fmt.Sprintf("%v statements, the limit is %v statements", len(batchMsg.Children), recv.maxStatements)}
+	}
+	return nil
+}
+
+type LargeBatchError struct {
+	Header *frame.Header
+	reason string
+}
+
+func (e *LargeBatchError) Error() string {
+	return fmt.Sprintf("Batch too large (%v)", e.reason)
+}
+
+// handleLargeBatch returns true if the request is a large BATCH that was rejected, i.e. it must not be forwarded.
+// The batch is rejected with an INVALID error like the clusters do when a batch exceeds batch_size_fail_threshold.
+func (ch *ClientHandler) handleLargeBatch(frameContext *frameDecodeContext, customResponseChannel chan *customResponse) (bool, error) {
+	err := ch.batchLimit.check(frameContext)
+	if err == nil {
+		return false, nil
+	}
+	errVal, ok := err.(*LargeBatchError)
+	if !ok {
+		return false, err
+	}
+
+	ch.metricHandler.GetProxyMetrics().LargeBatches.Add(1)
+	if ch.batchLimit.mode != common.LargeBatchModeReject {
+		frameContext.logger().Warnf("Forwarding BATCH with stream id %v from %v: %v.",
+			errVal.Header.StreamId, ch.clientConnector.connection.RemoteAddr(), errVal)
+		return false, nil
+	}
+
+	invalidFrame, err := ch.codec.get().ConvertToRawFrame(
+		frame.NewFrame(errVal.Header.Version, errVal.Header.StreamId, &message.Invalid{ErrorMessage: errVal.Error()}))
+	if err != nil {
+		return false, fmt.Errorf("could not convert invalid response frame to rawframe: %w", err)
+	}
+	frameContext.logger().Debugf("Rejecting BATCH with stream id %v: %v", errVal.Header.StreamId, errVal)
+
+	if customResponseChannel != nil {
+		customResponseChannel <- &customResponse{aggregatedResponse: invalidFrame}
+	} else {
+		ch.clientConnector.sendResponseToClient(invalidFrame)
+	}
+	return true, nil
+}
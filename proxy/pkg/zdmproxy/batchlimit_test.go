@@ -0,0 +1,103 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+)
+
+func mockBatchWithInserts(t *testing.T, count int) *frame.RawFrame {
+	children := make([]*message.BatchChild, 0, count)
+	for i := 0; i < count; i++ {
+		children = append(children, &message.BatchChild{QueryOrId: "INSERT INTO ks1.t (a, b) VALUES (1, 'some value')"})
+	}
+	return mockBatchWithChildren(t, children)
+}
+
+func TestBatchLimit_Check(t *testing.T) {
+	smallBatch := mockBatchWithInserts(t, 2)
+	largeBatch := mockBatchWithInserts(t, 10)
+
+	tests := []struct {
+		name          string
+		limit         *batchLimit
+		f             *frame.RawFrame
+		expectedError string
+	}{
+		{"disabled", newBatchLimit(0, 0, common.LargeBatchModeReject), largeBatch, ""},
+		{"below limits", newBatchLimit(5, 1024, common.LargeBatchModeReject), smallBatch, ""},
+		{"too many statements", newBatchLimit(5, 0, common.LargeBatchModeReject), largeBatch,
+			"Batch too large (10 statements, the limit is 5 statements)"},
+		{"too large", newBatchLimit(0, 200, common.LargeBatchModeReject), largeBatch,
+			fmt.Sprintf("Batch too large (%v bytes, the limit is 200 bytes)", len(largeBatch.Body))},
+		{"not a batch", newBatchLimit(1, 1, common.LargeBatchModeReject), mockQueryFrame(t, "SELECT * FROM ks1.t"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limit.check(NewFrameDecodeContext(tt.f))
+			if tt.expectedError == "" {
+				require.Nil(t, err)
+			} else {
+				require.IsType(t, &LargeBatchError{}, err)
+				require.Equal(t, tt.expectedError, err.Error())
+			}
+		})
+	}
+}
+
+func TestClientHandler_HandleLargeBatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		mode           common.LargeBatchMode
+		expectRejected bool
+	}{
+		{"warn", common.LargeBatchModeWarn, false},
+		{"reject", common.LargeBatchModeReject, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConn, otherConn := net.Pipe()
+			defer clientConn.Close()
+			defer otherConn.Close()
+			proxyMetrics := newFakeProxyMetrics()
+			largeBatches := &countingCounter{}
+			proxyMetrics.LargeBatches = largeBatches
+			ch := &ClientHandler{
+				clientConnector: &ClientConnector{connection: clientConn},
+				batchLimit:      newBatchLimit(5, 0, tt.mode),
+				metricHandler: metrics.NewMetricHandler(
+					noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+			}
+
+			responseChannel := make(chan *customResponse, 1)
+			rejected, err := ch.handleLargeBatch(NewFrameDecodeContext(mockBatchWithInserts(t, 2)), responseChannel)
+			require.Nil(t, err)
+			require.False(t, rejected)
+			require.Equal(t, int64(0), largeBatches.get())
+
+			batch := mockBatchWithInserts(t, 10)
+			rejected, err = ch.handleLargeBatch(NewFrameDecodeContext(batch), responseChannel)
+			require.Nil(t, err)
+			require.Equal(t, tt.expectRejected, rejected)
+			require.Equal(t, int64(1), largeBatches.get())
+			if !tt.expectRejected {
+				require.Len(t, responseChannel, 0)
+				return
+			}
+
+			response := <-responseChannel
+			decodedResponse, err := defaultCodec.ConvertFromRawFrame(response.aggregatedResponse)
+			require.Nil(t, err)
+			require.Equal(t, batch.Header.StreamId, decodedResponse.Header.StreamId)
+			invalid, ok := decodedResponse.Body.Message.(*message.Invalid)
+			require.True(t, ok, "expected INVALID but got %v", decodedResponse.Body.Message)
+			require.Equal(t, "Batch too large (10 statements, the limit is 5 statements)", invalid.ErrorMessage)
+		})
+	}
+}
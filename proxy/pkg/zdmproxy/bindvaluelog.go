@@ -0,0 +1,78 @@
+package zdmproxy
+
+import (
+	"encoding/hex"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	log "github.com/sirupsen/logrus"
+	"sort"
+)
+
+const unknownBindValueType = "unknown"
+
+// logBindValues logs the number and the CQL types of the bind values of an EXECUTE request if the DEBUG level is
+// enabled, this helps with errors like "expected N values but got M". The values themselves are never logged
+// because they can contain sensitive data.
+func logBindValues(frameContext *frameDecodeContext, preparedData PreparedData) {
+	logger := frameContext.logger()
+	if !logger.Logger.IsLevelEnabled(log.DebugLevel) {
+		return
+	}
+
+	decodedFrame, err := frameContext.GetOrDecodeFrame()
+	if err != nil {
+		logger.Debugf("Could not decode EXECUTE to log its bind values: %v", err)
+		return
+	}
+	executeMsg, ok := decodedFrame.Body.Message.(*message.Execute)
+	if !ok {
+		return
+	}
+
+	variablesMetadata := preparedData.GetOriginVariablesMetadata()
+	variables := 0
+	if variablesMetadata != nil {
+		variables = len(variablesMetadata.Columns)
+	}
+	types := getBindValueTypes(executeMsg.Options, variablesMetadata)
+	logger.Debugf("EXECUTE with prepared-id = '%s' has %d bind values (the statement has %d variables) with types %v.",
+		hex.EncodeToString(executeMsg.QueryId), len(types), variables, types)
+}
+
+// getBindValueTypes returns the CQL type of each bind value according to the variables metadata of the prepared
+// statement, named values are returned as name:type and sorted by name.
+func getBindValueTypes(options *message.QueryOptions, variablesMetadata *message.VariablesMetadata) []string {
+	if options == nil {
+		return []string{}
+	}
+
+	var columns []*message.ColumnMetadata
+	if variablesMetadata != nil {
+		columns = variablesMetadata.Columns
+	}
+
+	types := make([]string, 0, len(options.PositionalValues)+len(options.NamedValues))
+	for i := range options.PositionalValues {
+		if i < len(columns) && columns[i].Type != nil {
+			types = append(types, columns[i].Type.String())
+		} else {
+			types = append(types, unknownBindValueType)
+		}
+	}
+
+	names := make([]string, 0, len(options.NamedValues))
+	for name := range options.NamedValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		valueType := unknownBindValueType
+		for _, column := range columns {
+			if column.Name == name && column.Type != nil {
+				valueType = column.Type.String()
+				break
+			}
+		}
+		types = append(types, name+":"+valueType)
+	}
+	return types
+}
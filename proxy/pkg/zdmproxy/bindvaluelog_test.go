@@ -0,0 +1,70 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLogBindValues(t *testing.T) {
+	preparedData := NewPreparedData(
+		&message.PreparedResult{
+			PreparedQueryId: []byte("origin"),
+			VariablesMetadata: &message.VariablesMetadata{
+				Columns: []*message.ColumnMetadata{
+					{Keyspace: "ks1", Table: "t", Name: "a", Type: datatype.Int},
+					{Keyspace: "ks1", Table: "t", Name: "b", Type: datatype.Varchar},
+					{Keyspace: "ks1", Table: "t", Name: "c", Type: datatype.NewListType(datatype.Uuid)},
+				},
+			},
+		},
+		&message.PreparedResult{PreparedQueryId: []byte("target")},
+		NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "INSERT INTO ks1.t (a, b, c) VALUES (?, ?, ?)", ""))
+
+	execute := mustEncodeFrame(t, &message.Execute{
+		QueryId: []byte("origin"),
+		Options: &message.QueryOptions{
+			PositionalValues: []*primitive.Value{
+				primitive.NewValue([]byte{0, 0, 0, 42}),
+				primitive.NewValue([]byte("secret-value")),
+			},
+		},
+	})
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	level := log.GetLevel()
+	defer log.SetLevel(level)
+
+	// nothing is logged unless the DEBUG level is enabled
+	log.SetLevel(log.InfoLevel)
+	logBindValues(NewFrameDecodeContext(execute), preparedData)
+	require.Nil(t, hook.LastEntry())
+
+	log.SetLevel(log.DebugLevel)
+	logBindValues(NewFrameDecodeContext(execute), preparedData)
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	require.Equal(t, log.DebugLevel, entry.Level)
+	require.Contains(t, entry.Message, "has 2 bind values (the statement has 3 variables) with types [int varchar]")
+	require.NotContains(t, entry.Message, "secret-value")
+	require.NotContains(t, entry.Message, "42")
+
+	namedExecute := mustEncodeFrame(t, &message.Execute{
+		QueryId: []byte("origin"),
+		Options: &message.QueryOptions{
+			NamedValues: map[string]*primitive.Value{
+				"c": primitive.NewValue([]byte("secret-value")),
+				"d": primitive.NewValue([]byte("secret-value")),
+				"a": primitive.NewValue([]byte{0, 0, 0, 42}),
+			},
+		},
+	})
+	logBindValues(NewFrameDecodeContext(namedExecute), preparedData)
+	require.Contains(t, hook.LastEntry().Message, "with types [a:int c:list<uuid> d:unknown]")
+	require.NotContains(t, hook.LastEntry().Message, "secret-value")
+}
@@ -0,0 +1,109 @@
+package zdmproxy
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// bindValueRouter forwards bound statements to a single cluster based on the value that is bound to a specific column,
+// e.g. to route the requests of the tenants that were already migrated to TARGET only (see ZDM_BIND_VALUE_ROUTING_COLUMN).
+// A nil bindValueRouter doesn't route any requests.
+type bindValueRouter struct {
+	column         string
+	clusterByValue map[string]common.ClusterType
+}
+
+func newBindValueRouter(column string, clusterByValue map[string]common.ClusterType) *bindValueRouter {
+	column = strings.TrimSpace(column)
+	if column == "" || len(clusterByValue) == 0 {
+		return nil
+	}
+
+	return &bindValueRouter{
+		column:         column,
+		clusterByValue: clusterByValue,
+	}
+}
+
+// getCluster decodes the value that is bound to the routing column and returns the cluster that it is assigned to,
+// false is returned if the statement doesn't bind the routing column or the value doesn't match any rule.
+func (recv *bindValueRouter) getCluster(
+	version primitive.ProtocolVersion, options *message.QueryOptions,
+	variablesMetadata *message.VariablesMetadata) (common.ClusterType, bool, error) {
+	if recv == nil || options == nil || variablesMetadata == nil {
+		return common.ClusterTypeNone, false, nil
+	}
+
+	for idx, column := range variablesMetadata.Columns {
+		if column == nil || column.Name != recv.column {
+			continue
+		}
+
+		var value *primitive.Value
+		if len(options.NamedValues) > 0 {
+			value = options.NamedValues[column.Name]
+		} else if idx < len(options.PositionalValues) {
+			value = options.PositionalValues[idx]
+		}
+		if value == nil || value.Type != primitive.ValueTypeRegular {
+			return common.ClusterTypeNone, false, nil
+		}
+
+		decodedValue, err := GetDefaultGenericTypeCodec().Decode(column.Type, value.Contents, version)
+		if err != nil {
+			return common.ClusterTypeNone, false, fmt.Errorf("could not decode value of column %v: %w", column.Name, err)
+		}
+		cluster, ok := recv.clusterByValue[fmt.Sprintf("%v", decodedValue)]
+		return cluster, ok, nil
+	}
+	return common.ClusterTypeNone, false, nil
+}
+
+// routeByBindValue returns a request info that forwards the EXECUTE request only to the cluster that is assigned to
+// its bound value by the bind value router, other requests are returned unchanged.
+func (ch *ClientHandler) routeByBindValue(context *frameDecodeContext, requestInfo RequestInfo) RequestInfo {
+	if ch.bindValueRouter == nil {
+		return requestInfo
+	}
+
+	executeRequestInfo, ok := requestInfo.(*ExecuteRequestInfo)
+	if !ok || executeRequestInfo.counterToOrigin {
+		return requestInfo
+	}
+
+	decodedFrame, err := context.GetOrDecodeFrame()
+	if err != nil {
+		log.Debugf("Could not decode request with stream id %v for bind value routing: %v", context.GetRawFrame().Header.StreamId, err)
+		return requestInfo
+	}
+	executeMsg, ok := decodedFrame.Body.Message.(*message.Execute)
+	if !ok {
+		return requestInfo
+	}
+
+	preparedData := executeRequestInfo.GetPreparedData()
+	variablesMetadata := preparedData.GetOriginVariablesMetadata()
+	if variablesMetadata == nil {
+		variablesMetadata = preparedData.GetTargetVariablesMetadata()
+	}
+	cluster, ok, err := ch.bindValueRouter.getCluster(decodedFrame.Header.Version, executeMsg.Options, variablesMetadata)
+	if err != nil {
+		log.Warnf("Could not route EXECUTE with prepared-id = '%s' by bind value: %v", hex.EncodeToString(executeMsg.QueryId), err)
+		return requestInfo
+	}
+	if !ok {
+		return requestInfo
+	}
+
+	decision := forwardToOrigin
+	if cluster == common.ClusterTypeTarget {
+		decision = forwardToTarget
+	}
+	log.Tracef("EXECUTE with prepared-id = '%s' is routed to %v by bind value.", hex.EncodeToString(executeMsg.QueryId), cluster)
+	return NewBindValueRoutedExecuteRequestInfo(preparedData, decision)
+}
@@ -0,0 +1,77 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func mustEncodeValue(t *testing.T, dt datatype.DataType, value interface{}) *primitive.Value {
+	encoded, err := GetDefaultGenericTypeCodec().Encode(dt, value, primitive.ProtocolVersion4)
+	require.Nil(t, err)
+	return primitive.NewValue(encoded)
+}
+
+func TestRouteByBindValue(t *testing.T) {
+	variablesMetadata := &message.VariablesMetadata{
+		Columns: []*message.ColumnMetadata{
+			{Keyspace: "ks", Table: "t", Name: "tenant_id", Type: datatype.Varchar},
+			{Keyspace: "ks", Table: "t", Name: "id", Type: datatype.Int},
+		},
+	}
+	preparedQueryId := []byte("prepared")
+	prepareRequestInfo := NewPrepareRequestInfo(
+		NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "INSERT INTO ks.t (tenant_id, id) VALUES (?, ?)", "")
+	preparedData := NewPreparedData(
+		&message.PreparedResult{PreparedQueryId: preparedQueryId, VariablesMetadata: variablesMetadata},
+		&message.PreparedResult{PreparedQueryId: preparedQueryId, VariablesMetadata: variablesMetadata},
+		prepareRequestInfo)
+
+	ch := &ClientHandler{
+		bindValueRouter: newBindValueRouter("tenant_id", map[string]common.ClusterType{
+			"migrated":     common.ClusterTypeTarget,
+			"not_migrated": common.ClusterTypeOrigin,
+		}),
+	}
+
+	tests := []struct {
+		name             string
+		options          *message.QueryOptions
+		expectedDecision forwardDecision
+	}{
+		{"positional target", &message.QueryOptions{PositionalValues: []*primitive.Value{
+			mustEncodeValue(t, datatype.Varchar, "migrated"), mustEncodeValue(t, datatype.Int, int32(1))}}, forwardToTarget},
+		{"positional origin", &message.QueryOptions{PositionalValues: []*primitive.Value{
+			mustEncodeValue(t, datatype.Varchar, "not_migrated"), mustEncodeValue(t, datatype.Int, int32(1))}}, forwardToOrigin},
+		{"named target", &message.QueryOptions{NamedValues: map[string]*primitive.Value{
+			"id": mustEncodeValue(t, datatype.Int, int32(1)), "tenant_id": mustEncodeValue(t, datatype.Varchar, "migrated")}}, forwardToTarget},
+		{"no rule", &message.QueryOptions{PositionalValues: []*primitive.Value{
+			mustEncodeValue(t, datatype.Varchar, "other"), mustEncodeValue(t, datatype.Int, int32(1))}}, forwardToBoth},
+		{"null value", &message.QueryOptions{PositionalValues: []*primitive.Value{
+			primitive.NewNullValue(), mustEncodeValue(t, datatype.Int, int32(1))}}, forwardToBoth},
+		{"no values", nil, forwardToBoth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := mustEncodeFrame(t, &message.Execute{QueryId: preparedQueryId, Options: tt.options})
+			requestInfo := ch.routeByBindValue(NewFrameDecodeContext(f), NewExecuteRequestInfo(preparedData))
+			require.Equal(t, tt.expectedDecision, requestInfo.GetForwardDecision())
+			require.False(t, requestInfo.ShouldAlsoBeSentAsync())
+		})
+	}
+
+	// counter statements are always forwarded to ORIGIN
+	f := mustEncodeFrame(t, &message.Execute{QueryId: preparedQueryId, Options: &message.QueryOptions{PositionalValues: []*primitive.Value{
+		mustEncodeValue(t, datatype.Varchar, "migrated"), mustEncodeValue(t, datatype.Int, int32(1))}}})
+	requestInfo := ch.routeByBindValue(NewFrameDecodeContext(f), NewCounterExecuteRequestInfo(preparedData))
+	require.Equal(t, forwardToOrigin, requestInfo.GetForwardDecision())
+
+	// requests are not routed when bind value routing is disabled
+	require.Nil(t, newBindValueRouter("", map[string]common.ClusterType{}))
+	disabledCh := &ClientHandler{}
+	requestInfo = disabledCh.routeByBindValue(NewFrameDecodeContext(f), NewExecuteRequestInfo(preparedData))
+	require.Equal(t, forwardToBoth, requestInfo.GetForwardDecision())
+}
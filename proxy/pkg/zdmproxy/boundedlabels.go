@@ -0,0 +1,59 @@
+package zdmproxy
+
+import (
+	"sync"
+)
+
+// boundedLabelOther is the label value that the values seen once a boundedLabelSet is full are grouped under.
+const boundedLabelOther = "other"
+
+// boundedLabelSet bounds the number of distinct values of a metric label whose values are only known at runtime
+// (keyspaces, tables, vendor specific error codes, etc.) so that clients or clusters can't create an unbounded number
+// of time series. Values that are seen for the first time after the limit was reached are grouped under "other".
+// It is safe for concurrent use and it is shared by all client connections.
+type boundedLabelSet struct {
+	maxValues int
+	lock      *sync.RWMutex
+	values    map[string]bool
+}
+
+// newBoundedLabelSet returns nil if maxValues is not positive, the metric is disabled in that case.
+func newBoundedLabelSet(maxValues int) *boundedLabelSet {
+	if maxValues <= 0 {
+		return nil
+	}
+	return &boundedLabelSet{
+		maxValues: maxValues,
+		lock:      &sync.RWMutex{},
+		values:    make(map[string]bool),
+	}
+}
+
+// track returns true if the value gets its own label, i.e. it was seen before or the limit is not reached yet.
+func (recv *boundedLabelSet) track(value string) bool {
+	recv.lock.RLock()
+	known, full := recv.values[value], len(recv.values) >= recv.maxValues
+	recv.lock.RUnlock()
+	if known {
+		return true
+	}
+	if full {
+		return false
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	if !recv.values[value] && len(recv.values) >= recv.maxValues {
+		return false
+	}
+	recv.values[value] = true
+	return true
+}
+
+// getLabel returns the value if it gets its own label, "other" otherwise.
+func (recv *boundedLabelSet) getLabel(value string) string {
+	if recv.track(value) {
+		return value
+	}
+	return boundedLabelOther
+}
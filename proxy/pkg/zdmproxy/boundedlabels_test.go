@@ -0,0 +1,35 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func TestBoundedLabelSet(t *testing.T) {
+	require.Nil(t, newBoundedLabelSet(0))
+
+	labels := newBoundedLabelSet(2)
+	require.Equal(t, "ks1", labels.getLabel("ks1"))
+	require.Equal(t, "ks2", labels.getLabel("ks2"))
+	require.Equal(t, boundedLabelOther, labels.getLabel("ks3"))
+	// values that were tracked before the limit was reached keep their own label
+	require.Equal(t, "ks1", labels.getLabel("ks1"))
+	require.True(t, labels.track("ks2"))
+	require.False(t, labels.track("ks3"))
+}
+
+func TestBoundedLabelSet_Concurrent(t *testing.T) {
+	labels := newBoundedLabelSet(10)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			labels.track(fmt.Sprintf("value%v", i))
+		}(i)
+	}
+	wg.Wait()
+	require.Len(t, labels.values, 10)
+}
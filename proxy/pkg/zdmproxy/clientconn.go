@@ -3,15 +3,17 @@ package zdmproxy
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/datastax/go-cassandra-native-protocol/frame"
 	"github.com/datastax/go-cassandra-native-protocol/message"
 	"github.com/datastax/go-cassandra-native-protocol/primitive"
 	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
 	log "github.com/sirupsen/logrus"
 	"net"
 	"sync"
-	"sync/atomic"
+	"time"
 )
 
 const ClientConnectorLogPrefix = "CLIENT-CONNECTOR"
@@ -41,6 +43,8 @@ type ClientConnector struct {
 	clientHandlerShutdownRequestCancelFn context.CancelFunc
 
 	writeCoalescer *writeCoalescer
+	framing        *connectionFraming
+	codec          *connectionCodec
 
 	responsesDoneChan <-chan bool
 	requestsDoneCtx   context.Context
@@ -51,6 +55,9 @@ type ClientConnector struct {
 	readScheduler *Scheduler
 
 	shutdownRequestCtx context.Context
+
+	malformedFrames      metrics.Counter
+	wrongDirectionFrames metrics.Counter
 }
 
 func NewClientConnector(
@@ -66,7 +73,11 @@ func NewClientConnector(
 	readScheduler *Scheduler,
 	writeScheduler *Scheduler,
 	shutdownRequestCtx context.Context,
-	clientHandlerShutdownRequestCancelFn context.CancelFunc) *ClientConnector {
+	clientHandlerShutdownRequestCancelFn context.CancelFunc,
+	malformedFrames metrics.Counter,
+	wrongDirectionFrames metrics.Counter,
+	codec *connectionCodec) *ClientConnector {
+	framing := newConnectionFraming(true)
 	return &ClientConnector{
 		connection:              connection,
 		conf:                    conf,
@@ -83,7 +94,11 @@ func NewClientConnector(
 			ClientConnectorLogPrefix,
 			false,
 			false,
-			writeScheduler),
+			writeScheduler,
+			framing,
+			codec),
+		framing:                              framing,
+		codec:                                codec,
 		responsesDoneChan:                    responsesDoneChan,
 		requestsDoneCtx:                      requestsDoneCtx,
 		eventsDoneChan:                       eventsDoneChan,
@@ -91,13 +106,16 @@ func NewClientConnector(
 		readScheduler:                        readScheduler,
 		shutdownRequestCtx:                   shutdownRequestCtx,
 		clientHandlerShutdownRequestCancelFn: clientHandlerShutdownRequestCancelFn,
+		malformedFrames:                      malformedFrames,
+		wrongDirectionFrames:                 wrongDirectionFrames,
 	}
 }
 
 /**
- *	Starts two listening loops: one for receiving requests from the client, one for the responses that must be sent to the client
+ *	Starts two listening loops: one for receiving requests from the client, one for the responses that must be sent to the client.
+ *	releaseClient is called once the client connection is closed.
  */
-func (cc *ClientConnector) run(activeClients *int32) {
+func (cc *ClientConnector) run(releaseClient func()) {
 	cc.listenForRequests()
 	cc.writeCoalescer.RunWriteQueueLoop()
 	cc.clientHandlerWg.Add(1)
@@ -111,6 +129,12 @@ func (cc *ClientConnector) run(activeClients *int32) {
 			"to be terminated.", ClientConnectorLogPrefix, cc.connection.RemoteAddr())
 		cc.clientHandlerCancelFunc()
 
+		flushTimeout := time.Duration(cc.conf.ShutdownFlushTimeoutMs) * time.Millisecond
+		if !cc.writeCoalescer.WaitUntilFlushed(flushTimeout) {
+			log.Debugf("[%s] Timed out after %v waiting for queued frames to be written to %v.",
+				ClientConnectorLogPrefix, flushTimeout, cc.connection.RemoteAddr())
+		}
+
 		log.Infof("[%s] Shutting down client connection to %v", ClientConnectorLogPrefix, cc.connection.RemoteAddr())
 		err := cc.connection.Close()
 		if err != nil {
@@ -122,7 +146,7 @@ func (cc *ClientConnector) run(activeClients *int32) {
 		log.Debugf("[%s] Shutting down write coalescer.", ClientConnectorLogPrefix)
 		cc.writeCoalescer.Close()
 
-		atomic.AddInt32(activeClients, -1)
+		releaseClient()
 	}()
 }
 
@@ -163,14 +187,29 @@ func (cc *ClientConnector) listenForRequests() {
 			setDrainModeNowFunc()
 		}()
 
+		sendRequestFunc := func(f *frame.RawFrame) {
+			log.Tracef("[%s] Received request on client connector: %v", ClientConnectorLogPrefix, f.Header)
+			lock.RLock()
+			if closed {
+				lock.RUnlock()
+				cc.sendOverloadedToClient(f)
+				return
+			}
+			cc.requestChannel <- f
+			lock.RUnlock()
+			log.Tracef("[%s] Request sent to client connector's request channel: %v", ClientConnectorLogPrefix, f.Header)
+		}
+
 		bufferedReader := bufio.NewReaderSize(cc.connection, cc.conf.RequestWriteBufferSizeBytes)
 		connectionAddr := cc.connection.RemoteAddr().String()
 		protocolErrOccurred := false
 		var alreadySentProtocolErr *frame.RawFrame
+		reader := newFrameReader(bufferedReader, connectionAddr, cc.clientHandlerContext, cc.framing)
 		for cc.clientHandlerContext.Err() == nil {
-			f, err := readRawFrame(bufferedReader, connectionAddr, cc.clientHandlerContext)
+			f, err := reader.read()
 
-			protocolErrResponseFrame, err := checkProtocolError(f, err, protocolErrOccurred, ClientConnectorLogPrefix)
+			protocolErrResponseFrame, err := checkProtocolError(
+				cc.codec.get(), f, err, protocolErrOccurred, cc.conf.ProtocolV5Enabled, ClientConnectorLogPrefix)
 			if err != nil {
 				handleConnectionError(
 					err, cc.clientHandlerContext, cc.clientHandlerCancelFunc, ClientConnectorLogPrefix, "reading", connectionAddr)
@@ -187,30 +226,42 @@ func (cc *ClientConnector) listenForRequests() {
 				continue
 			}
 
+			if cc.isWrongDirectionFrame(f) {
+				continue
+			}
+
+			if malformedFrameResponse := cc.checkMalformedFrame(f); malformedFrameResponse != nil {
+				cc.sendResponseToClient(malformedFrameResponse)
+				continue
+			}
+
+			if isUseQueryFrame(f) {
+				// USE requests must reach the client handler after every request that was received before them
+				// and before every request that is received after them
+				wg.Wait()
+				sendRequestFunc(f)
+				continue
+			}
+
 			wg.Add(1)
 			cc.readScheduler.Schedule(func() {
 				defer wg.Done()
-				log.Tracef("[%s] Received request on client connector: %v", ClientConnectorLogPrefix, f.Header)
-				lock.RLock()
-				if closed {
-					lock.RUnlock()
-					cc.sendOverloadedToClient(f)
-					return
-				}
-				cc.requestChannel <- f
-				lock.RUnlock()
-				log.Tracef("[%s] Request sent to client connector's request channel: %v", ClientConnectorLogPrefix, f.Header)
+				sendRequestFunc(f)
 			})
 		}
 	}()
 }
 
 func (cc *ClientConnector) sendOverloadedToClient(request *frame.RawFrame) {
+	cc.sendOverloadedWithMessageToClient(request, "Shutting down, please retry on next host.")
+}
+
+func (cc *ClientConnector) sendOverloadedWithMessageToClient(request *frame.RawFrame, errorMessage string) {
 	msg := &message.Overloaded{
-		ErrorMessage: "Shutting down, please retry on next host.",
+		ErrorMessage: errorMessage,
 	}
 	response := frame.NewFrame(request.Header.Version, request.Header.StreamId, msg)
-	rawResponse, err := defaultCodec.ConvertToRawFrame(response)
+	rawResponse, err := cc.codec.get().ConvertToRawFrame(response)
 	if err != nil {
 		log.Errorf("[%s] Could not convert frame (%v) to raw frame: %v", ClientConnectorLogPrefix, response, err)
 	} else {
@@ -218,16 +269,25 @@ func (cc *ClientConnector) sendOverloadedToClient(request *frame.RawFrame) {
 	}
 }
 
-func checkProtocolError(f *frame.RawFrame, connErr error, protocolErrorOccurred bool, prefix string) (protocolErrResponse *frame.RawFrame, fatalErr error) {
+func checkProtocolError(
+	codec frame.RawCodec, f *frame.RawFrame, connErr error, protocolErrorOccurred bool, protocolV5Enabled bool,
+	prefix string) (protocolErrResponse *frame.RawFrame, fatalErr error) {
 	var protocolErrMsg *message.ProtocolError
 	var streamId int16
 	var logMsg string
+	// ideally we would use the maximum version between the versions used by both control connections if
+	// control connections implemented protocol version negotiation
+	version := primitive.ProtocolVersion4
 	if connErr != nil {
 		protocolErrMsg = checkUnsupportedProtocolError(connErr)
 		logMsg = fmt.Sprintf("Protocol error detected while decoding a frame: %v.", connErr)
 		streamId = 0
+		if errors.As(connErr, new(*segmentError)) {
+			// segments are only used after v5 was negotiated
+			version = primitive.ProtocolVersion5
+		}
 	} else {
-		protocolErrMsg = checkProtocolVersion(f.Header.Version)
+		protocolErrMsg = checkProtocolVersion(f.Header.Version, protocolV5Enabled)
 		logMsg = "Protocol v5 detected while decoding a frame."
 		streamId = f.Header.StreamId
 	}
@@ -236,7 +296,7 @@ func checkProtocolError(f *frame.RawFrame, connErr error, protocolErrorOccurred
 		if !protocolErrorOccurred {
 			log.Debugf("[%v] %v Returning a protocol error to the client to force a downgrade: %v.", prefix, logMsg, protocolErrMsg)
 		}
-		rawProtocolErrResponse, err := generateProtocolErrorResponseFrame(streamId, protocolErrMsg)
+		rawProtocolErrResponse, err := generateProtocolErrorResponseFrame(codec, streamId, version, protocolErrMsg)
 		if err != nil {
 			return nil, fmt.Errorf("could not generate protocol error response raw frame (%v): %v", protocolErrMsg, err)
 		} else {
@@ -247,11 +307,49 @@ func checkProtocolError(f *frame.RawFrame, connErr error, protocolErrorOccurred
 	}
 }
 
-func generateProtocolErrorResponseFrame(streamId int16, protocolErrMsg *message.ProtocolError) (*frame.RawFrame, error) {
-	// ideally we would use the maximum version between the versions used by both control connections if
-	// control connections implemented protocol version negotiation
-	response := frame.NewFrame(primitive.ProtocolVersion4, streamId, protocolErrMsg)
-	rawResponse, err := defaultCodec.ConvertToRawFrame(response)
+// isWrongDirectionFrame returns true (and drops the frame) if the client sent a frame with a response opcode, this
+// means that the client or the connection is broken so the frame can not be handled as a request.
+func (cc *ClientConnector) isWrongDirectionFrame(f *frame.RawFrame) bool {
+	if !f.Header.OpCode.IsResponse() {
+		return false
+	}
+
+	log.Warnf("[%s] Dropping %v frame received from %v because it is not a request: %v",
+		ClientConnectorLogPrefix, f.Header.OpCode, cc.connection.RemoteAddr(), f.Header)
+	if cc.wrongDirectionFrames != nil {
+		cc.wrongDirectionFrames.Add(1)
+	}
+	return true
+}
+
+// checkMalformedFrame returns a protocol error response if the request has an empty body but its opcode requires one,
+// these requests can not be decoded so they are rejected before reaching the client handler.
+func (cc *ClientConnector) checkMalformedFrame(f *frame.RawFrame) *frame.RawFrame {
+	if len(f.Body) > 0 || f.Header.OpCode == primitive.OpCodeOptions {
+		return nil
+	}
+
+	log.Warnf("[%s] Received %v request with an empty body from %v, returning a protocol error.",
+		ClientConnectorLogPrefix, f.Header.OpCode, cc.connection.RemoteAddr())
+	if cc.malformedFrames != nil {
+		cc.malformedFrames.Add(1)
+	}
+
+	protocolErrMsg := &message.ProtocolError{
+		ErrorMessage: fmt.Sprintf("Invalid %v request: frame body is empty", f.Header.OpCode)}
+	response := frame.NewFrame(f.Header.Version, f.Header.StreamId, protocolErrMsg)
+	rawResponse, err := cc.codec.get().ConvertToRawFrame(response)
+	if err != nil {
+		log.Errorf("[%s] Could not convert frame (%v) to raw frame: %v", ClientConnectorLogPrefix, response, err)
+		return nil
+	}
+	return rawResponse
+}
+
+func generateProtocolErrorResponseFrame(
+	codec frame.RawCodec, streamId int16, version primitive.ProtocolVersion, protocolErrMsg *message.ProtocolError) (*frame.RawFrame, error) {
+	response := frame.NewFrame(version, streamId, protocolErrMsg)
+	rawResponse, err := codec.ConvertToRawFrame(response)
 	if err != nil {
 		return nil, err
 	}
@@ -262,3 +360,13 @@ func generateProtocolErrorResponseFrame(streamId int16, protocolErrMsg *message.
 func (cc *ClientConnector) sendResponseToClient(frame *frame.RawFrame) {
 	cc.writeCoalescer.Enqueue(frame)
 }
+
+// sendResponseToClientAsync returns false without sending the frame if the write queue is full.
+func (cc *ClientConnector) sendResponseToClientAsync(frame *frame.RawFrame) bool {
+	return cc.writeCoalescer.EnqueueAsync(frame)
+}
+
+// sendResponseToClientWithTimeout returns false without sending the frame if the write queue is still full after the timeout.
+func (cc *ClientConnector) sendResponseToClientWithTimeout(frame *frame.RawFrame, timeout time.Duration) bool {
+	return cc.writeCoalescer.EnqueueWithTimeout(frame, timeout)
+}
@@ -0,0 +1,143 @@
+package zdmproxy
+
+import (
+	"context"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientConnector_MalformedFrames(t *testing.T) {
+	proxySide, clientSide := net.Pipe()
+	defer clientSide.Close()
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	conf := config.New()
+	conf.RequestReadBufferSizeBytes = 1024
+	conf.ResponseWriteBufferSizeBytes = 1024
+	conf.ResponseWriteQueueSizeFrames = 16
+
+	readScheduler := NewScheduler(1)
+	defer readScheduler.Shutdown()
+	writeScheduler := NewScheduler(1)
+	defer writeScheduler.Shutdown()
+
+	wg := &sync.WaitGroup{}
+	requestChan := make(chan *frame.RawFrame, 16)
+	malformedFrames := &countingCounter{}
+	cc := NewClientConnector(
+		proxySide, conf, wg, requestChan, ctx, cancelFn, nil, nil, nil,
+		readScheduler, writeScheduler, context.Background(), func() {}, malformedFrames, nil, nil)
+	cc.listenForRequests()
+	cc.writeCoalescer.RunWriteQueueLoop()
+
+	emptyFrame := func(opCode primitive.OpCode, streamId int16) *frame.RawFrame {
+		return &frame.RawFrame{
+			Header: &frame.Header{Version: primitive.ProtocolVersion4, StreamId: streamId, OpCode: opCode},
+			Body:   []byte{},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		opCode   primitive.OpCode
+		streamId int16
+	}{
+		{"empty QUERY", primitive.OpCodeQuery, 1},
+		{"empty PREPARE", primitive.OpCodePrepare, 2},
+		{"empty EXECUTE", primitive.OpCodeExecute, 3},
+		{"empty BATCH", primitive.OpCodeBatch, 4},
+		{"empty STARTUP", primitive.OpCodeStartup, 5},
+		{"empty REGISTER", primitive.OpCodeRegister, 6},
+		{"empty AUTH_RESPONSE", primitive.OpCodeAuthResponse, 7},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Nil(t, writeRawFrame(clientSide, defaultCodec, "proxy", context.Background(), emptyFrame(tt.opCode, tt.streamId)))
+
+			response, err := decodeFrame(clientSide, defaultCodec)
+			require.Nil(t, err)
+			require.Equal(t, tt.streamId, response.Header.StreamId)
+			require.Equal(t, primitive.ProtocolVersion4, response.Header.Version)
+			protocolErr, ok := response.Body.Message.(*message.ProtocolError)
+			require.True(t, ok, response.Body.Message)
+			require.Contains(t, protocolErr.ErrorMessage, "frame body is empty")
+			require.Equal(t, int64(i+1), malformedFrames.get())
+		})
+	}
+
+	// OPTIONS requests don't have a body
+	require.Nil(t, writeRawFrame(clientSide, defaultCodec, "proxy", context.Background(), emptyFrame(primitive.OpCodeOptions, 8)))
+	select {
+	case request := <-requestChan:
+		require.Equal(t, int16(8), request.Header.StreamId)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "options request was not forwarded to the client handler")
+	}
+	require.Equal(t, int64(len(tests)), malformedFrames.get())
+
+	// an incomplete frame followed by the connection being closed stops the request listener without a response
+	_, err := clientSide.Write([]byte{byte(primitive.ProtocolVersion4), 0, 0, 9})
+	require.Nil(t, err)
+	_ = clientSide.Close()
+
+	select {
+	case <-cc.clientConnectorRequestsDoneChan:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "request listener did not finish after the connection was closed")
+	}
+	require.Equal(t, int64(len(tests)), malformedFrames.get())
+}
+
+func TestClientConnector_WrongDirectionFrames(t *testing.T) {
+	proxySide, clientSide := net.Pipe()
+	defer clientSide.Close()
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	conf := config.New()
+	conf.RequestReadBufferSizeBytes = 1024
+	conf.ResponseWriteBufferSizeBytes = 1024
+	conf.ResponseWriteQueueSizeFrames = 16
+
+	readScheduler := NewScheduler(1)
+	defer readScheduler.Shutdown()
+	writeScheduler := NewScheduler(1)
+	defer writeScheduler.Shutdown()
+
+	requestChan := make(chan *frame.RawFrame, 16)
+	wrongDirectionFrames := &countingCounter{}
+	cc := NewClientConnector(
+		proxySide, conf, &sync.WaitGroup{}, requestChan, ctx, cancelFn, nil, nil, nil,
+		readScheduler, writeScheduler, context.Background(), func() {}, nil, wrongDirectionFrames, nil)
+	cc.listenForRequests()
+	cc.writeCoalescer.RunWriteQueueLoop()
+
+	writeFrame := func(streamId int16, msg message.Message) {
+		f, err := defaultCodec.ConvertToRawFrame(frame.NewFrame(primitive.ProtocolVersion4, streamId, msg))
+		require.Nil(t, err)
+		require.Nil(t, writeRawFrame(clientSide, defaultCodec, "client", context.Background(), f))
+	}
+	writeFrame(1, &message.VoidResult{})
+	writeFrame(2, &message.Ready{})
+	writeFrame(3, &message.Options{})
+
+	select {
+	case request := <-requestChan:
+		require.Equal(t, int16(3), request.Header.StreamId)
+		require.Equal(t, primitive.OpCodeOptions, request.Header.OpCode)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "options request was not forwarded to the client handler")
+	}
+	require.Len(t, requestChan, 0)
+	require.Equal(t, int64(2), wrongDirectionFrames.get())
+}
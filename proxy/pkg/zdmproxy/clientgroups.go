@@ -0,0 +1,99 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"net"
+)
+
+// clientGroups labels the metrics of the client connections whose address belongs to one of the groups of
+// ZDM_METRICS_CLIENT_GROUPS, the other clients are not counted so that the number of labels stays bounded.
+// A nil clientGroups doesn't label any client.
+type clientGroups struct {
+	groups []*common.ClientGroup
+}
+
+func newClientGroups(groups []*common.ClientGroup) *clientGroups {
+	if len(groups) == 0 {
+		return nil
+	}
+	return &clientGroups{groups: groups}
+}
+
+// getGroup returns the name of the first group that contains the client address, false is returned if no group does.
+func (recv *clientGroups) getGroup(clientAddr net.Addr) (string, bool) {
+	if recv == nil || clientAddr == nil {
+		return "", false
+	}
+
+	var ip net.IP
+	if tcpAddr, ok := clientAddr.(*net.TCPAddr); ok {
+		ip = tcpAddr.IP
+	} else if host, _, err := net.SplitHostPort(clientAddr.String()); err == nil {
+		ip = net.ParseIP(host)
+	}
+	if ip == nil {
+		return "", false
+	}
+
+	for _, group := range recv.groups {
+		if group.Network.Contains(ip) {
+			return group.Name, true
+		}
+	}
+	return "", false
+}
+
+// newConnection returns the metrics of the group that the client connection belongs to,
+// nil is returned if the client doesn't belong to any group.
+func (recv *clientGroups) newConnection(metricHandler *metrics.MetricHandler, clientAddr net.Addr) *clientGroupConnection {
+	group, ok := recv.getGroup(clientAddr)
+	if !ok {
+		return nil
+	}
+
+	requests, err := metricHandler.GetClientGroupRequestsCounter(group)
+	if err != nil {
+		log.Errorf("Could not create the requests metric of client group %v: %v", group, err)
+		return nil
+	}
+	connections, err := metricHandler.GetClientGroupConnectionsGauge(group)
+	if err != nil {
+		log.Errorf("Could not create the connections metric of client group %v: %v", group, err)
+		return nil
+	}
+	return &clientGroupConnection{requests: requests, connections: connections}
+}
+
+// clientGroupConnection tracks a client connection in the metrics of its client group.
+// It is used by the request listener of the client handler only. A nil clientGroupConnection doesn't track anything.
+type clientGroupConnection struct {
+	requests    metrics.Counter
+	connections metrics.Gauge
+	open        bool
+}
+
+func (recv *clientGroupConnection) trackRequest() {
+	if recv == nil {
+		return
+	}
+	recv.requests.Add(1)
+}
+
+// trackOpened counts the connection once its handshake is done, like client_connections_by_protocol_version_total.
+func (recv *clientGroupConnection) trackOpened() {
+	if recv == nil || recv.open {
+		return
+	}
+	recv.open = true
+	recv.connections.Add(1)
+}
+
+func (recv *clientGroupConnection) trackClosed() {
+	if recv == nil || !recv.open {
+		return
+	}
+	recv.open = false
+	recv.connections.Subtract(1)
+}
@@ -0,0 +1,86 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/prommetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+)
+
+func TestClientGroups(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metricHandler := metrics.NewMetricHandler(
+		prommetrics.NewPrometheusMetricFactory(registry), nil, nil, nil, newFakeProxyMetrics(), nil, nil, nil)
+	_, appNetwork, err := net.ParseCIDR("10.0.1.0/24")
+	require.Nil(t, err)
+	_, reportsNetwork, err := net.ParseCIDR("10.0.2.15/32")
+	require.Nil(t, err)
+	groups := newClientGroups([]*common.ClientGroup{
+		{Name: "app", Network: appNetwork},
+		{Name: "reports", Network: reportsNetwork},
+	})
+
+	app1 := groups.newConnection(metricHandler, &net.TCPAddr{IP: net.ParseIP("10.0.1.10"), Port: 40001})
+	app2 := groups.newConnection(metricHandler, &net.TCPAddr{IP: net.ParseIP("10.0.1.11"), Port: 40002})
+	reports := groups.newConnection(metricHandler, &net.TCPAddr{IP: net.ParseIP("10.0.2.15"), Port: 40003})
+	unknown := groups.newConnection(metricHandler, &net.TCPAddr{IP: net.ParseIP("10.0.2.16"), Port: 40004})
+	require.Nil(t, unknown)
+
+	for _, conn := range []*clientGroupConnection{app1, app2, reports, unknown} {
+		conn.trackOpened()
+		conn.trackRequest()
+	}
+	app1.trackRequest()
+	app2.trackClosed()
+	app2.trackClosed()
+	unknown.trackClosed()
+
+	requests, connections := gatherClientGroupMetrics(t, registry)
+	require.Equal(t, map[string]float64{"app": 3, "reports": 1}, requests)
+	require.Equal(t, map[string]float64{"app": 1, "reports": 1}, connections)
+}
+
+func TestClientGroups_Disabled(t *testing.T) {
+	require.Nil(t, newClientGroups([]*common.ClientGroup{}))
+
+	registry := prometheus.NewRegistry()
+	metricHandler := metrics.NewMetricHandler(
+		prommetrics.NewPrometheusMetricFactory(registry), nil, nil, nil, newFakeProxyMetrics(), nil, nil, nil)
+	var groups *clientGroups
+	conn := groups.newConnection(metricHandler, &net.TCPAddr{IP: net.ParseIP("10.0.1.10"), Port: 40001})
+	require.Nil(t, conn)
+	conn.trackOpened()
+	conn.trackRequest()
+	conn.trackClosed()
+
+	requests, connections := gatherClientGroupMetrics(t, registry)
+	require.Empty(t, requests)
+	require.Empty(t, connections)
+}
+
+func gatherClientGroupMetrics(t *testing.T, registry *prometheus.Registry) (map[string]float64, map[string]float64) {
+	metricFamilies, err := registry.Gather()
+	require.Nil(t, err)
+	requests := map[string]float64{}
+	connections := map[string]float64{}
+	for _, metricFamily := range metricFamilies {
+		for _, m := range metricFamily.GetMetric() {
+			clientGroup := ""
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "client_group" {
+					clientGroup = label.GetValue()
+				}
+			}
+			switch metricFamily.GetName() {
+			case "zdm_proxy_client_group_requests_total":
+				requests[clientGroup] = m.GetCounter().GetValue()
+			case "zdm_proxy_client_group_connections":
+				connections[clientGroup] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	return requests, connections
+}
@@ -16,6 +16,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"net"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -46,28 +47,55 @@ type ClientHandler struct {
 
 	preparedStatementCache *PreparedStatementCache
 
-	metricHandler *metrics.MetricHandler
-	nodeMetrics   *metrics.NodeMetrics
+	metricHandler      *metrics.MetricHandler
+	nodeMetrics        *metrics.NodeMetrics
+	opCodeDistribution *opCodeDistribution
 
 	clientHandlerContext    context.Context
 	clientHandlerCancelFunc context.CancelFunc
 
 	currentKeyspaceName *atomic.Value
 	handshakeDone       *atomic.Value
+	handshakeTimer      *time.Timer
+	authIdleTimer       *time.Timer
+	handshakeTimedOut   int32
+
+	// codec of the protocol version that was negotiated with the client, shared with the connectors
+	codec *connectionCodec
 
 	authErrorMessage *message.AuthenticationError
 
+	// true if the last handshake response sent to the client was AUTHENTICATE or AUTH_CHALLENGE
+	expectingAuthResponse bool
+
 	startupRequest           *frame.RawFrame
 	secondaryStartupResponse *frame.RawFrame
 	secondaryHandshakeCreds  *AuthCredentials
 	asyncHandshakeCreds      *AuthCredentials
 
+	// authenticator classes advertised in the AUTHENTICATE responses to the client's STARTUP request
+	originAuthenticator string
+	targetAuthenticator string
+
 	targetUsername string
 	targetPassword string
 
 	originUsername string
 	originPassword string
 
+	credentialsProvider CredentialsProvider
+
+	originAuthenticatorProvider AuthenticatorProvider
+	targetAuthenticatorProvider AuthenticatorProvider
+
+	// gauge of client connections for the protocol version that was negotiated in the handshake,
+	// only accessed by the request loop goroutine
+	protocolVersionGauge metrics.Gauge
+
+	// metrics of the client group of the client address (see ZDM_METRICS_CLIENT_GROUPS), nil if the client doesn't
+	// belong to a group, only accessed by the request loop goroutine
+	clientGroup *clientGroupConnection
+
 	// map of request context holders that store the contexts for the active requests, keyed on streamID
 	requestContextHolders *sync.Map
 
@@ -80,7 +108,7 @@ type ClientHandler struct {
 	reqChannel  <-chan *frame.RawFrame
 	respChannel chan *Response
 
-	clientHandlerRequestWaitGroup *sync.WaitGroup
+	clientHandlerRequestWaitGroup *requestWaitGroup
 
 	closedRespChannel     bool
 	closedRespChannelLock *sync.RWMutex
@@ -106,7 +134,45 @@ type ClientHandler struct {
 	targetObserver *protocolEventObserverImpl
 
 	primaryCluster               common.ClusterType
+	readMode                     common.ReadMode
+	cutoverManager               *cutoverManager
 	forwardSystemQueriesToTarget bool
+	forwardSchemaQueriesToTarget bool
+	unexpectedResponseMode       common.UnexpectedResponseMode
+	keyspaceAllowlist            *keyspaceAllowlist
+	startupOptionsFilter         *startupOptionsFilter
+	compressionBridge            *compressionBridge
+	readRouter                   *adaptiveReadRouter
+	bindValueRouter              *bindValueRouter
+	keyspaceRouter               *keyspaceRouter
+	keyspaceReadRouter           *keyspaceRouter
+	psQuarantine                 *preparedStatementQuarantine
+	dualWriteDisagreements       *metrics.ErrorRateWindow
+	tableDivergence              *boundedLabelSet
+	psCacheExecutes              *psCacheExecuteTracker
+	unknownErrorCodes            *boundedLabelSet
+	mismatchReporter             MismatchReporter
+	batchLimit                   *batchLimit
+	targetAheadMode              common.ReadComparisonTargetAheadMode
+	metadataMode                 common.ReadComparisonMetadataMode
+	writeConfirmation            common.DualWriteConfirmation
+	tracingMode                  common.TracingMode
+	asyncReadScope               *asyncReadScope
+	eventDeliveryMode            common.EventDeliveryMode
+	cutoverEventsChan            chan *frame.RawFrame
+	schemaEventsVersion          int32
+	registeredEventTypes         int32
+	psCacheMissMode              common.PsCacheMissMode
+	schemaVersionMode            common.SchemaVersionMode
+	retryDetector                *retryDetector
+	clientAddress                string
+	connectionMetrics            *connectionMetricsRegistry
+	supportedCache               *supportedCache
+	supportedCqlVersions         *supportedCqlVersions
+	clusterDownBuffer            *clusterDownBuffer
+	heldRequests                 *heldRequests
+	handshakeLimiter             *handshakeLimiter
+	handshakeSlotAcquired        bool // only accessed by the request loop
 	forwardAuthToTarget          bool
 	targetCredsOnClientRequest   bool
 
@@ -120,6 +186,65 @@ type ClientHandler struct {
 	clientHandlerShutdownRequestContext context.Context
 }
 
+// clientHandlerShared contains the structures that are created once by ZdmProxy and shared by all of its client
+// handlers (and their cluster connectors). Most of them are nil when the feature that they belong to is disabled.
+type clientHandlerShared struct {
+	credentialsProvider         CredentialsProvider
+	originAuthenticatorProvider AuthenticatorProvider
+	targetAuthenticatorProvider AuthenticatorProvider
+	mismatchReporter            MismatchReporter
+
+	cutoverManager         *cutoverManager
+	schemaQueriesMode      common.SystemQueriesMode
+	unexpectedResponseMode common.UnexpectedResponseMode
+	eventDeliveryMode      common.EventDeliveryMode
+	psCacheMissMode        common.PsCacheMissMode
+	schemaVersionMode      common.SchemaVersionMode
+
+	opCodeDistribution *opCodeDistribution
+
+	// parsed from the configuration once instead of on every client connection
+	keyspaceAllowlist       *keyspaceAllowlist
+	startupOptionsFilter    *startupOptionsFilter
+	batchLimit              *batchLimit
+	targetAheadMode         common.ReadComparisonTargetAheadMode
+	metadataMode            common.ReadComparisonMetadataMode
+	writeConfirmation       common.DualWriteConfirmation
+	tracingMode             common.TracingMode
+	queryNormalizationLevel common.QueryNormalizationLevel
+
+	// dual writes on which the clusters disagreed are tracked as failures, see GetDualWriteAgreement
+	dualWriteDisagreements *metrics.ErrorRateWindow
+
+	// bounds the tables of proxy_dual_write_divergences_total, nil if ZDM_METRICS_TABLE_DIVERGENCE_MAX_TABLES is 0
+	tableDivergence *boundedLabelSet
+	psCacheExecutes *psCacheExecuteTracker
+
+	// bounds the error codes of proxy_unknown_error_codes_total, see maxUnknownErrorCodeLabels
+	unknownErrorCodes *boundedLabelSet
+
+	// labels the metrics of the clients of ZDM_METRICS_CLIENT_GROUPS, nil if no group is configured
+	clientGroups *clientGroups
+
+	readRouter         *adaptiveReadRouter
+	bindValueRouter    *bindValueRouter
+	keyspaceRouter     *keyspaceRouter
+	keyspaceReadRouter *keyspaceRouter
+	psQuarantine       *preparedStatementQuarantine
+	asyncReadScope     *asyncReadScope
+	connectionMetrics  *connectionMetricsRegistry
+	supportedCache     *supportedCache
+
+	// CQL versions of the clusters that the CQL_VERSION of the clients' STARTUP requests is negotiated with
+	supportedCqlVersions *supportedCqlVersions
+
+	// holds back read requests while a cluster is DOWN, nil if ZDM_CLUSTER_DOWN_BUFFER_TIMEOUT_MS is 0
+	clusterDownBuffer *clusterDownBuffer
+
+	handshakeLimiter *handshakeLimiter
+	injectedLatency  *injectedLatency
+}
+
 func NewClientHandler(
 	clientTcpConn net.Conn,
 	originCassandraConnInfo *ClusterConnectionInfo,
@@ -145,7 +270,8 @@ func NewClientHandler(
 	timeUuidGenerator TimeUuidGenerator,
 	readMode common.ReadMode,
 	primaryCluster common.ClusterType,
-	systemQueriesMode common.SystemQueriesMode) (*ClientHandler, error) {
+	systemQueriesMode common.SystemQueriesMode,
+	shared *clientHandlerShared) (*ClientHandler, error) {
 
 	originEndpointId := originCassandraConnInfo.endpoint.GetEndpointIdentifier()
 	targetEndpointId := targetCassandraConnInfo.endpoint.GetEndpointIdentifier()
@@ -179,22 +305,23 @@ func NewClientHandler(
 	}()
 
 	respChannel := make(chan *Response, numWorkers)
-	clientHandlerRequestWg := &sync.WaitGroup{}
+	clientHandlerRequestWg := &requestWaitGroup{}
 	handshakeDone := &atomic.Value{}
+	codec := newConnectionCodec()
 
 	originConnector, err := NewClusterConnector(
-		originCassandraConnInfo, conf, psCache, nodeMetrics, localClientHandlerWg, clientHandlerRequestWg,
+		originCassandraConnInfo, conf, psCache, nodeMetrics, metricHandler.GetProxyMetrics(), localClientHandlerWg, clientHandlerRequestWg,
 		clientHandlerContext, clientHandlerCancelFunc, respChannel, readScheduler, writeScheduler, requestsDoneCtx,
-		false, nil, handshakeDone)
+		false, nil, handshakeDone, codec, shared)
 	if err != nil {
 		clientHandlerCancelFunc()
 		return nil, err
 	}
 
 	targetConnector, err := NewClusterConnector(
-		targetCassandraConnInfo, conf, psCache, nodeMetrics, localClientHandlerWg, clientHandlerRequestWg,
+		targetCassandraConnInfo, conf, psCache, nodeMetrics, metricHandler.GetProxyMetrics(), localClientHandlerWg, clientHandlerRequestWg,
 		clientHandlerContext, clientHandlerCancelFunc, respChannel, readScheduler, writeScheduler, requestsDoneCtx,
-		false, nil, handshakeDone)
+		false, nil, handshakeDone, codec, shared)
 	if err != nil {
 		clientHandlerCancelFunc()
 		return nil, err
@@ -210,9 +337,9 @@ func NewClientHandler(
 			asyncConnInfo = targetCassandraConnInfo
 		}
 		asyncConnector, err = NewClusterConnector(
-			asyncConnInfo, conf, psCache, nodeMetrics, localClientHandlerWg, clientHandlerRequestWg,
+			asyncConnInfo, conf, psCache, nodeMetrics, metricHandler.GetProxyMetrics(), localClientHandlerWg, clientHandlerRequestWg,
 			clientHandlerContext, clientHandlerCancelFunc, respChannel, readScheduler, writeScheduler, requestsDoneCtx,
-			true, asyncPendingRequests, handshakeDone)
+			true, asyncPendingRequests, handshakeDone, codec, shared)
 		if err != nil {
 			log.Errorf("Could not create async cluster connector to %s, async requests will not be forwarded: %s", asyncConnInfo.connConfig.GetClusterType(), err.Error())
 			asyncConnector = nil
@@ -234,6 +361,16 @@ func NewClientHandler(
 	forwardAuthToTarget, targetCredsOnClientRequest := forwardAuthToTarget(
 		originControlConn, targetControlConn, conf.ForwardClientCredentialsToOrigin)
 
+	var heldClusterDownRequests *heldRequests
+	if shared.clusterDownBuffer != nil {
+		heldClusterDownRequests = newHeldRequests()
+	}
+
+	retryDetector := newRetryDetector(
+		conf.RetryDetectionEnabled, time.Duration(conf.RetryDetectionWindowMs)*time.Millisecond, shared.queryNormalizationLevel,
+		conf.TrackingMapMaxEntries, time.Duration(conf.TrackingMapMaxAgeMs)*time.Millisecond,
+		metricHandler.GetProxyMetrics().TrackingMapEntries, metricHandler.GetProxyMetrics().TrackingMapEvictions)
+
 	return &ClientHandler{
 		clientConnector: NewClientConnector(
 			clientTcpConn,
@@ -248,7 +385,10 @@ func NewClientHandler(
 			readScheduler,
 			writeScheduler,
 			clientHandlerShutdownRequestContext,
-			clientHandlerShutdownRequestCancelFn),
+			clientHandlerShutdownRequestCancelFn,
+			metricHandler.GetProxyMetrics().MalformedFrames,
+			metricHandler.GetProxyMetrics().WrongDirectionFrames,
+			codec),
 
 		asyncConnector:                       asyncConnector,
 		originCassandraConnector:             originConnector,
@@ -258,16 +398,22 @@ func NewClientHandler(
 		preparedStatementCache:               psCache,
 		metricHandler:                        metricHandler,
 		nodeMetrics:                          nodeMetrics,
+		opCodeDistribution:                   shared.opCodeDistribution,
+		clientGroup:                          shared.clientGroups.newConnection(metricHandler, clientTcpConn.RemoteAddr()),
 		clientHandlerContext:                 clientHandlerContext,
 		clientHandlerCancelFunc:              clientHandlerCancelFunc,
 		currentKeyspaceName:                  &atomic.Value{},
 		handshakeDone:                        handshakeDone,
+		codec:                                codec,
 		authErrorMessage:                     nil,
 		startupRequest:                       nil,
 		targetUsername:                       targetUsername,
 		targetPassword:                       targetPassword,
 		originUsername:                       originUsername,
 		originPassword:                       originPassword,
+		credentialsProvider:                  shared.credentialsProvider,
+		originAuthenticatorProvider:          shared.originAuthenticatorProvider,
+		targetAuthenticatorProvider:          shared.targetAuthenticatorProvider,
 		requestContextHolders:                &sync.Map{},
 		asyncRequestContextHolders:           &sync.Map{},
 		asyncPendingRequests:                 asyncPendingRequests,
@@ -288,7 +434,42 @@ func NewClientHandler(
 		originObserver:                       originObserver,
 		targetObserver:                       targetObserver,
 		primaryCluster:                       primaryCluster,
+		readMode:                             readMode,
+		cutoverManager:                       shared.cutoverManager,
 		forwardSystemQueriesToTarget:         systemQueriesMode == common.SystemQueriesModeTarget,
+		forwardSchemaQueriesToTarget:         shared.schemaQueriesMode == common.SystemQueriesModeTarget,
+		unexpectedResponseMode:               shared.unexpectedResponseMode,
+		keyspaceAllowlist:                    shared.keyspaceAllowlist,
+		startupOptionsFilter:                 shared.startupOptionsFilter,
+		compressionBridge:                    newCompressionBridge(conf.OriginCompressionBridgeEnabled, conf.TargetCompressionBridgeEnabled, conf.CompressionBridgeMinBodySizeBytes),
+		readRouter:                           shared.readRouter,
+		bindValueRouter:                      shared.bindValueRouter,
+		keyspaceRouter:                       shared.keyspaceRouter,
+		keyspaceReadRouter:                   shared.keyspaceReadRouter,
+		psQuarantine:                         shared.psQuarantine,
+		dualWriteDisagreements:               shared.dualWriteDisagreements,
+		tableDivergence:                      shared.tableDivergence,
+		psCacheExecutes:                      shared.psCacheExecutes,
+		unknownErrorCodes:                    shared.unknownErrorCodes,
+		mismatchReporter:                     shared.mismatchReporter,
+		batchLimit:                           shared.batchLimit,
+		targetAheadMode:                      shared.targetAheadMode,
+		metadataMode:                         shared.metadataMode,
+		writeConfirmation:                    shared.writeConfirmation,
+		tracingMode:                          shared.tracingMode,
+		asyncReadScope:                       shared.asyncReadScope,
+		eventDeliveryMode:                    shared.eventDeliveryMode,
+		cutoverEventsChan:                    make(chan *frame.RawFrame, 1),
+		psCacheMissMode:                      shared.psCacheMissMode,
+		schemaVersionMode:                    shared.schemaVersionMode,
+		retryDetector:                        retryDetector,
+		clientAddress:                        clientTcpConn.RemoteAddr().String(),
+		connectionMetrics:                    shared.connectionMetrics,
+		supportedCache:                       shared.supportedCache,
+		supportedCqlVersions:                 shared.supportedCqlVersions,
+		clusterDownBuffer:                    shared.clusterDownBuffer,
+		heldRequests:                         heldClusterDownRequests,
+		handshakeLimiter:                     shared.handshakeLimiter,
 		forwardAuthToTarget:                  forwardAuthToTarget,
 		targetCredsOnClientRequest:           targetCredsOnClientRequest,
 		queryModifier:                        NewQueryModifier(timeUuidGenerator),
@@ -302,8 +483,9 @@ func NewClientHandler(
 /**
  *	Initialises all components and launches all listening loops that they have.
  */
-func (ch *ClientHandler) run(activeClients *int32) {
-	ch.clientConnector.run(activeClients)
+func (ch *ClientHandler) run(releaseClient func()) {
+	ch.startHandshakeTimer()
+	ch.clientConnector.run(releaseClient)
 	ch.originCassandraConnector.run()
 	ch.targetCassandraConnector.run()
 	if ch.asyncConnector != nil {
@@ -352,6 +534,62 @@ func removeObserver(observer *protocolEventObserverImpl, controlConn *ControlCon
 	}
 }
 
+// startHandshakeTimer shuts down the client handler if the client does not complete the handshake
+// (every step of the authentication flow included) within the configured timeout.
+func (ch *ClientHandler) startHandshakeTimer() {
+	timeout := time.Duration(ch.conf.ClientHandshakeTimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		return
+	}
+	ch.handshakeTimer = time.AfterFunc(timeout, func() {
+		if ch.handshakeDone.Load() != nil || ch.clientHandlerContext.Err() != nil {
+			return
+		}
+		log.Warnf("Client %v did not complete the handshake within %v, closing the connection.",
+			ch.clientConnector.connection.RemoteAddr(), timeout)
+		atomic.StoreInt32(&ch.handshakeTimedOut, 1)
+		ch.metricHandler.GetProxyMetrics().ClientHandshakeTimeouts.Add(1)
+		ch.clientHandlerCancelFunc()
+	})
+}
+
+// startAuthIdleTimer shuts down the client handler if the client does not answer the AUTHENTICATE or AUTH_CHALLENGE
+// response that was just sent to it within the configured timeout. Unlike the handshake timer it only covers the time
+// the client spends on its side of the authentication flow so that half-authenticated connections are released early.
+func (ch *ClientHandler) startAuthIdleTimer() {
+	timeout := time.Duration(ch.conf.ClientAuthIdleTimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		return
+	}
+	ch.authIdleTimer = time.AfterFunc(timeout, func() {
+		if ch.handshakeDone.Load() != nil || ch.clientHandlerContext.Err() != nil {
+			return
+		}
+		log.Warnf("Client %v did not answer the authentication challenge within %v, closing the connection.",
+			ch.clientConnector.connection.RemoteAddr(), timeout)
+		atomic.StoreInt32(&ch.handshakeTimedOut, 1)
+		ch.metricHandler.GetProxyMetrics().ClientAuthIdleTimeouts.Add(1)
+		ch.clientHandlerCancelFunc()
+	})
+}
+
+func (ch *ClientHandler) stopAuthIdleTimer() {
+	if ch.authIdleTimer != nil {
+		ch.authIdleTimer.Stop()
+		ch.authIdleTimer = nil
+	}
+}
+
+// trackAbortedHandshake logs and meters a handshake request that was interrupted because the client disconnected,
+// e.g. when a connection pool resets connections. Handshake timeouts and proxy shutdowns are not counted.
+func (ch *ClientHandler) trackAbortedHandshake() {
+	if atomic.LoadInt32(&ch.handshakeTimedOut) == 1 || ch.clientHandlerShutdownRequestContext.Err() != nil {
+		return
+	}
+	log.Debugf("Client %v disconnected while the handshake was in progress.", ch.clientConnector.connection.RemoteAddr())
+	ch.metricHandler.GetProxyMetrics().AbortedHandshakes.Add(1)
+}
+
 // Infinite loop that blocks on receiving from the requests channel.
 func (ch *ClientHandler) requestLoop() {
 	ready := false
@@ -379,6 +617,9 @@ func (ch *ClientHandler) requestLoop() {
 				break
 			}
 
+			ch.opCodeDistribution.track(f.Header.OpCode)
+			ch.clientGroup.trackRequest()
+
 			if ch.clientHandlerShutdownRequestContext.Err() != nil {
 				ch.clientConnector.sendOverloadedToClient(f)
 				continue
@@ -387,17 +628,45 @@ func (ch *ClientHandler) requestLoop() {
 			log.Tracef("Request received on client handler: %v", f.Header)
 			if !ready {
 				log.Tracef("not ready")
+				if !ch.acquireHandshakeSlot(f) {
+					continue
+				}
 				// Handle client authentication
 				ready, err = ch.handleHandshakeRequest(f, wg)
-				if err != nil && !errors.Is(err, ShutdownErr) {
+				if err == ShutdownErr {
+					// failed secondary handshakes wrap ShutdownErr, it is only returned as is when the
+					// client handler context was canceled while the handshake request was in progress
+					ch.trackAbortedHandshake()
+				} else if err != nil && !errors.Is(err, ShutdownErr) {
 					log.Error(err)
 				}
 				if ready {
+					ch.codec.setVersion(f.Header.Version)
 					ch.handshakeDone.Store(true)
+					if ch.handshakeTimer != nil {
+						ch.handshakeTimer.Stop()
+					}
+					ch.releaseHandshakeSlot()
 					log.Infof(
 						"Handshake successful with client %s", connectionAddr)
+					ch.protocolVersionGauge = getClientConnectionsByVersionGauge(
+						ch.metricHandler.GetProxyMetrics(), f.Header.Version)
+					if ch.protocolVersionGauge != nil {
+						ch.protocolVersionGauge.Add(1)
+					}
+					ch.clientGroup.trackOpened()
 				}
 				log.Tracef("ready? %t", ready)
+			} else if f.Header.OpCode == primitive.OpCodeStartup {
+				err = ch.sendDuplicateStartupErrorToClient(f)
+				if err != nil {
+					log.Error(err)
+				}
+			} else if isUseQueryFrame(f) {
+				// USE requests are not processed concurrently with the requests that precede or follow them
+				// so that the current keyspace is always updated in request order
+				wg.Wait()
+				ch.handleUseRequest(f)
 			} else {
 				wg.Add(1)
 				ch.requestResponseScheduler.Schedule(func() {
@@ -410,6 +679,13 @@ func (ch *ClientHandler) requestLoop() {
 		log.Debugf("Shutting down client handler request listener %v.", connectionAddr)
 
 		wg.Wait()
+		ch.releaseHandshakeSlot()
+
+		if ch.protocolVersionGauge != nil {
+			ch.protocolVersionGauge.Subtract(1)
+		}
+		ch.clientGroup.trackClosed()
+		ch.retryDetector.close()
 
 		go func() {
 			<-ch.clientHandlerContext.Done()
@@ -460,6 +736,7 @@ func (ch *ClientHandler) clearRequestContexts(contextHoldersMap *sync.Map) {
 //
 // Event messages that come through will only be routed if
 //   - it's a schema change from origin
+//   - it's the event that is pushed when a cutover is applied, see ZDM_CUTOVER_CLIENT_EVENT_ENABLED
 func (ch *ClientHandler) listenForEventMessages() {
 	ch.localClientHandlerWg.Add(1)
 	log.Debugf("listenForEventMessages loop starting now")
@@ -467,6 +744,7 @@ func (ch *ClientHandler) listenForEventMessages() {
 		defer ch.localClientHandlerWg.Done()
 		defer close(ch.eventsDoneChan)
 		shutDownChannels := 0
+		var shutdownDeadline time.Time
 		targetChannel := ch.targetCassandraConnector.clusterConnEventsChan
 		originChannel := ch.originCassandraConnector.clusterConnEventsChan
 		for {
@@ -485,6 +763,9 @@ func (ch *ClientHandler) listenForEventMessages() {
 					log.Debugf("Target event channel closed")
 					shutDownChannels++
 					targetChannel = nil
+					if shutdownDeadline.IsZero() {
+						shutdownDeadline = time.Now().Add(time.Duration(ch.conf.ShutdownFlushTimeoutMs) * time.Millisecond)
+					}
 					continue
 				}
 				fromTarget = true
@@ -493,14 +774,22 @@ func (ch *ClientHandler) listenForEventMessages() {
 					log.Debugf("Origin event channel closed")
 					shutDownChannels++
 					originChannel = nil
+					if shutdownDeadline.IsZero() {
+						shutdownDeadline = time.Now().Add(time.Duration(ch.conf.ShutdownFlushTimeoutMs) * time.Millisecond)
+					}
 					continue
 				}
 				fromTarget = false
+			case event = <-ch.cutoverEventsChan:
+				if shutdownDeadline.IsZero() {
+					ch.sendEventToClient(event)
+				}
+				continue
 			}
 
 			log.Debugf("Message received (fromTarget: %v) on event listener of the client handler: %v", fromTarget, event.Header)
 
-			body, err := defaultCodec.DecodeBody(event.Header, bytes.NewReader(event.Body))
+			body, err := ch.codec.get().DecodeBody(event.Header, bytes.NewReader(event.Body))
 			if err != nil {
 				log.Warnf("Error decoding event response: %v", err)
 				continue
@@ -537,13 +826,43 @@ func (ch *ClientHandler) listenForEventMessages() {
 				continue
 			}
 
-			ch.clientConnector.sendResponseToClient(event)
+			if shutdownDeadline.IsZero() {
+				ch.sendEventToClient(event)
+			} else {
+				ch.sendEventToClientOnShutdown(event, shutdownDeadline)
+			}
 		}
 
 		log.Debugf("Shutting down client event messages listener.")
 	}()
 }
 
+// sendEventToClient forwards the event to the client according to ZDM_EVENT_DELIVERY_MODE. With DROP, events are dropped
+// if the client is not reading fast enough so that the cluster connectors never block on their event channels.
+func (ch *ClientHandler) sendEventToClient(event *frame.RawFrame) {
+	if ch.eventDeliveryMode == common.EventDeliveryModeBlock {
+		ch.clientConnector.sendResponseToClient(event)
+		return
+	}
+
+	if !ch.clientConnector.sendResponseToClientAsync(event) {
+		log.Debugf("Dropped event %v because client %v is not reading fast enough.",
+			event.Header, ch.clientConnector.connection.RemoteAddr())
+		ch.metricHandler.GetProxyMetrics().DroppedEvents.Add(1)
+	}
+}
+
+// sendEventToClientOnShutdown is used for the events that are still buffered after a cluster connection was closed,
+// they are queued until ZDM_SHUTDOWN_FLUSH_TIMEOUT_MS expires regardless of ZDM_EVENT_DELIVERY_MODE
+// so that the shutdown never blocks on a client that is not reading.
+func (ch *ClientHandler) sendEventToClientOnShutdown(event *frame.RawFrame, deadline time.Time) {
+	if !ch.clientConnector.sendResponseToClientWithTimeout(event, time.Until(deadline)) {
+		log.Debugf("Dropped event %v because client %v is shutting down and not reading fast enough.",
+			event.Header, ch.clientConnector.connection.RemoteAddr())
+		ch.metricHandler.GetProxyMetrics().DroppedEventsOnShutdown.Add(1)
+	}
+}
+
 // Infinite loop that blocks on receiving from the response channel
 // (which is written by both cluster connectors).
 func (ch *ClientHandler) responseLoop() {
@@ -579,7 +898,7 @@ func (ch *ClientHandler) responseLoop() {
 				}
 
 				if response.connectorType != ClusterConnectorTypeAsync {
-					if ch.tryProcessProtocolError(response, &protocolErrOccurred) {
+					if ch.tryProcessProtocolError(response, responseClusterType, &protocolErrOccurred) {
 						return
 					}
 				}
@@ -597,6 +916,12 @@ func (ch *ClientHandler) responseLoop() {
 					if ch.clientHandlerContext.Err() == nil {
 						log.Warnf("Could not find request context for stream id %d received from %v. "+
 							"It either timed out or a protocol error occurred.", streamId, response.connectorType)
+						if response.responseFrame != nil {
+							ch.metricHandler.GetProxyMetrics().UnknownStreamIdResponses.Add(1)
+						}
+					} else if response.responseFrame != nil {
+						// request was canceled because the client handler is shutting down
+						ch.metricHandler.GetProxyMetrics().DroppedLateResponses.Add(1)
 					}
 					return
 				}
@@ -604,10 +929,14 @@ func (ch *ClientHandler) responseLoop() {
 				finished := false
 				if response.responseFrame == nil {
 					finished = reqCtx.SetTimeout(ch.nodeMetrics, response.requestFrame)
+					if typedReqCtx, ok := reqCtx.(*requestContextImpl); ok && finished {
+						ch.expireStreamIds(typedReqCtx)
+					}
 				} else {
 					finished = reqCtx.SetResponse(ch.nodeMetrics, response.responseFrame, responseClusterType, response.connectorType)
+					ch.trackUnknownErrorCode(response.responseFrame, responseClusterType)
 					if reqCtx.GetRequestInfo().ShouldBeTrackedInMetrics() {
-						trackClusterErrorMetrics(response.responseFrame, response.connectorType, ch.nodeMetrics)
+						trackClusterErrorMetrics(ch.codec.get(), response.responseFrame, response.connectorType, ch.nodeMetrics)
 					}
 				}
 
@@ -619,6 +948,8 @@ func (ch *ClientHandler) responseLoop() {
 					} else {
 						ch.finishRequest(holder, typedReqCtx)
 					}
+				} else if typedReqCtx, ok := reqCtx.(*requestContextImpl); ok && typedReqCtx.setRaceWinner(responseClusterType) {
+					ch.sendClientResponse(typedReqCtx)
 				}
 			})
 		}
@@ -629,17 +960,21 @@ func (ch *ClientHandler) responseLoop() {
 
 // Checks if response is a protocol error. Returns true if it processes this response. If it returns false,
 // then the response wasn't processed and it should be processed by another function.
-func (ch *ClientHandler) tryProcessProtocolError(response *Response, protocolErrOccurred *int32) bool {
-	errMsg, err := decodeError(response.responseFrame)
+func (ch *ClientHandler) tryProcessProtocolError(
+	response *Response, responseClusterType common.ClusterType, protocolErrOccurred *int32) bool {
+	errMsg, err := decodeError(ch.codec.get(), response.responseFrame)
 	if err != nil {
 		log.Errorf("Could not check if error from %v was protocol error: %v, skipping it.",
 			response.connectorType, response.responseFrame.Header)
 		return false
 	} else if errMsg != nil && errMsg.GetErrorCode() == primitive.ErrorCodeProtocolError {
+		handshakeDone := ch.handshakeDone.Load() != nil
+		if handshakeDone {
+			ch.trackBackendProtocolError(response.responseFrame, responseClusterType, errMsg)
+		}
 		if atomic.CompareAndSwapInt32(protocolErrOccurred, 0, 1) {
-			if ch.handshakeDone.Load() != nil {
-				log.Errorf("[ClientHandler] Protocol error detected (%v) on %v, forwarding it to the client.",
-					errMsg, response.connectorType)
+			if handshakeDone {
+				log.Debugf("[ClientHandler] Forwarding protocol error from %v to the client.", response.connectorType)
 			} else {
 				log.Debugf("[ClientHandler] Protocol version downgrade detected (%v) on %v, forwarding it to the client.",
 					errMsg, response.connectorType)
@@ -652,10 +987,40 @@ func (ch *ClientHandler) tryProcessProtocolError(response *Response, protocolErr
 	return false
 }
 
-func decodeError(responseFrame *frame.RawFrame) (message.Error, error) {
+// trackBackendProtocolError counts a protocol error that a cluster returned after the handshake and logs the request
+// that caused it. Unlike other errors these usually mean that the proxy sent a malformed frame (a bug) or that the
+// protocol versions are misconfigured.
+func (ch *ClientHandler) trackBackendProtocolError(
+	responseFrame *frame.RawFrame, clusterType common.ClusterType, errMsg message.Error) {
+	proxyMetrics := ch.metricHandler.GetProxyMetrics()
+	switch clusterType {
+	case common.ClusterTypeOrigin:
+		proxyMetrics.BackendProtocolErrorsOrigin.Add(1)
+	case common.ClusterTypeTarget:
+		proxyMetrics.BackendProtocolErrorsTarget.Add(1)
+	}
+
+	streamId := responseFrame.Header.StreamId
+	reqCtx, ok := getOrCreateRequestContextHolder(ch.requestContextHolders, streamId).Get().(*requestContextImpl)
+	if !ok {
+		log.Errorf("%v returned a protocol error for stream id %d (%v) but the request is no longer in flight: %v.",
+			clusterType, streamId, responseFrame.Header.Version, errMsg)
+		return
+	}
+
+	bothClusters := ""
+	if reqCtx.requestInfo.GetForwardDecision() == forwardToBoth {
+		bothClusters = ", sent to both clusters"
+	}
+	reqCtx.logger().Errorf("%v returned a protocol error for stream id %d (request: %v, %v%v), this usually means "+
+		"that the proxy sent a malformed frame or that the protocol versions are misconfigured: %v.",
+		clusterType, streamId, reqCtx.request.Header.OpCode, reqCtx.request.Header.Version, bothClusters, errMsg)
+}
+
+func decodeError(codec frame.RawCodec, responseFrame *frame.RawFrame) (message.Error, error) {
 	if responseFrame != nil &&
 		responseFrame.Header.OpCode == primitive.OpCodeError {
-		body, err := defaultCodec.DecodeBody(
+		body, err := codec.DecodeBody(
 			responseFrame.Header, bytes.NewReader(responseFrame.Body))
 
 		if err != nil {
@@ -678,47 +1043,121 @@ func (ch *ClientHandler) finishRequest(holder *requestContextHolder, reqCtx *req
 
 	err := holder.Clear(reqCtx)
 	if err != nil {
-		log.Debugf("Could not free stream id: %v", err)
+		reqCtx.logger().Debugf("Could not free stream id: %v", err)
+	}
+	deferredRequest, responseSent := reqCtx.releaseRace()
+	if deferredRequest != nil {
+		defer deferredRequest()
+	}
+	ch.compareRaceRead(reqCtx)
+	if responseSent {
+		ch.trackConfirmedWrite(reqCtx)
 	}
 
 	if reqCtx.requestInfo.ShouldBeTrackedInMetrics() {
 		proxyMetrics := ch.metricHandler.GetProxyMetrics()
-		switch reqCtx.requestInfo.GetForwardDecision() {
+		switch getMetricsForwardDecision(reqCtx.requestInfo, reqCtx.primaryCluster) {
 		case forwardToBoth:
 			proxyMetrics.ProxyWritesDuration.Track(reqCtx.startTime)
+			trackSloBreach(proxyMetrics.SloBreachesWrites, ch.conf.MetricsSloWriteLatencyThresholdMs, reqCtx.startTime)
 			proxyMetrics.InFlightWrites.Subtract(1)
 		case forwardToOrigin:
 			proxyMetrics.ProxyReadsOriginDuration.Track(reqCtx.startTime)
+			trackSloBreach(proxyMetrics.SloBreachesReadsOrigin, ch.conf.MetricsSloReadLatencyThresholdMs, reqCtx.startTime)
 			proxyMetrics.InFlightReadsOrigin.Subtract(1)
 		case forwardToTarget:
 			proxyMetrics.ProxyReadsTargetDuration.Track(reqCtx.startTime)
+			trackSloBreach(proxyMetrics.SloBreachesReadsTarget, ch.conf.MetricsSloReadLatencyThresholdMs, reqCtx.startTime)
 			proxyMetrics.InFlightReadsTarget.Subtract(1)
 		case forwardToAsyncOnly, forwardToNone:
 		default:
-			log.Errorf("unexpected forwardDecision %v, unable to track proxy level metrics", reqCtx.requestInfo.GetForwardDecision())
+			reqCtx.logger().Errorf("unexpected forwardDecision %v, unable to track proxy level metrics", reqCtx.requestInfo.GetForwardDecision())
 		}
 	}
 
+	ch.trackQuarantine(reqCtx)
+
+	if preparedData, ok := ch.shouldReprepareTargetWrite(reqCtx); ok {
+		// the retry blocks until TARGET responds so it can't run on the request response scheduler
+		ch.clientHandlerRequestWaitGroup.Add(1)
+		go func() {
+			defer ch.clientHandlerRequestWaitGroup.Done()
+			ch.reprepareTargetWrite(reqCtx, preparedData)
+			ch.sendClientResponse(reqCtx)
+		}()
+		return
+	}
+
+	if failoverDecision, ok := ch.shouldFailoverRead(reqCtx); ok {
+		// the retry blocks until the other cluster responds so it can't run on the request response scheduler
+		ch.clientHandlerRequestWaitGroup.Add(1)
+		go func() {
+			defer ch.clientHandlerRequestWaitGroup.Done()
+			ch.failoverRead(reqCtx, failoverDecision)
+		}()
+		return
+	}
+
+	if responseSent {
+		// the race read or the dual write was already answered by the faster cluster
+		return
+	}
+	ch.sendClientResponse(reqCtx)
+}
+
+// trackSloBreach counts a request that took longer than the latency threshold of its type, see
+// ZDM_METRICS_SLO_READ_LATENCY_THRESHOLD_MS and ZDM_METRICS_SLO_WRITE_LATENCY_THRESHOLD_MS.
+func trackSloBreach(sloBreaches metrics.Counter, thresholdMs int, startTime time.Time) {
+	if thresholdMs > 0 && nowFunc().Sub(startTime) > time.Duration(thresholdMs)*time.Millisecond {
+		sloBreaches.Add(1)
+	}
+}
+
+// sendClientResponse computes the response of a finished request and sends it to the client
+// (or to the custom response channel of the request).
+func (ch *ClientHandler) sendClientResponse(reqCtx *requestContextImpl) {
 	aggregatedResponse, responseClusterType, err := ch.computeClientResponse(reqCtx)
+	ch.trackConnectionMetrics(reqCtx, err != nil || aggregatedResponse.Header.OpCode == primitive.OpCodeError)
+	if err == nil {
+		ch.checkResponseSize(reqCtx, aggregatedResponse)
+	}
 	finalResponse := aggregatedResponse
-	if err == nil && reqCtx.requestInfo.GetForwardDecision() != forwardToAsyncOnly {
+	_, internalRequest := reqCtx.requestInfo.(*TargetReprepareRequestInfo)
+	if err == nil && reqCtx.requestInfo.GetForwardDecision() != forwardToAsyncOnly && !internalRequest {
 		// async only requests can't have "PREPARED", "SETKEYSPACE" or "UNPREPARED" responses so skip this
 		finalResponse, err = ch.processClientResponse(aggregatedResponse, responseClusterType, reqCtx)
+		if err != nil {
+			finalResponse, err = ch.handleUnexpectedResponse(aggregatedResponse, responseClusterType, err)
+		}
 	}
 
 	if err != nil {
 		if reqCtx.customResponseChannel != nil {
 			close(reqCtx.customResponseChannel)
 		}
-		log.Errorf("Error handling request (%v): %v", reqCtx.request.Header, err)
+		reqCtx.logger().Errorf("Error handling request (%v): %v", reqCtx.request.Header, err)
 		return
 	}
 
-	reqCtx.request = nil
-	originResponse := reqCtx.originResponse
-	reqCtx.originResponse = nil
-	targetResponse := reqCtx.targetResponse
-	reqCtx.targetResponse = nil
+	if reqCtx.customResponseChannel == nil {
+		// responses sent through the custom response channel are handled by the proxy so they are not compressed
+		finalResponse, err = ch.compressionBridge.compressResponse(finalResponse)
+		if err != nil {
+			reqCtx.logger().Errorf("Error handling request (%v): %v", reqCtx.request.Header, err)
+			return
+		}
+	}
+
+	var originResponse, targetResponse *frame.RawFrame
+	if !reqCtx.isConfirmedEarly() {
+		// the request context of a race read still receives the response of the slower cluster, see setRaceWinner
+		reqCtx.request = nil
+		reqCtx.targetRequest = nil
+		originResponse = reqCtx.originResponse
+		reqCtx.originResponse = nil
+		targetResponse = reqCtx.targetResponse
+		reqCtx.targetResponse = nil
+	}
 
 	if reqCtx.customResponseChannel != nil {
 		reqCtx.customResponseChannel <- &customResponse{
@@ -737,12 +1176,15 @@ func (ch *ClientHandler) cancelRequest(holder *requestContextHolder, reqCtx *req
 
 	err := holder.Clear(reqCtx)
 	if err != nil {
-		log.Debugf("Could not free stream id: %v", err)
+		reqCtx.logger().Debugf("Could not free stream id: %v", err)
+	}
+	if deferredRequest, _ := reqCtx.releaseRace(); deferredRequest != nil {
+		defer deferredRequest()
 	}
 
 	if reqCtx.requestInfo.ShouldBeTrackedInMetrics() {
 		proxyMetrics := ch.metricHandler.GetProxyMetrics()
-		switch reqCtx.requestInfo.GetForwardDecision() {
+		switch getMetricsForwardDecision(reqCtx.requestInfo, reqCtx.primaryCluster) {
 		case forwardToBoth:
 			proxyMetrics.InFlightWrites.Subtract(1)
 		case forwardToOrigin:
@@ -751,7 +1193,7 @@ func (ch *ClientHandler) cancelRequest(holder *requestContextHolder, reqCtx *req
 			proxyMetrics.InFlightReadsTarget.Subtract(1)
 		case forwardToAsyncOnly, forwardToNone:
 		default:
-			log.Errorf("unexpected forwardDecision %v, unable to track proxy level metrics", reqCtx.requestInfo.GetForwardDecision())
+			reqCtx.logger().Errorf("unexpected forwardDecision %v, unable to track proxy level metrics", reqCtx.requestInfo.GetForwardDecision())
 		}
 	}
 
@@ -759,12 +1201,20 @@ func (ch *ClientHandler) cancelRequest(holder *requestContextHolder, reqCtx *req
 		close(reqCtx.customResponseChannel)
 	}
 
-	log.Tracef("Canceled request %v.", reqCtx.request.Header)
+	reqCtx.logger().Tracef("Canceled request %v.", reqCtx.request.Header)
 }
 
 // Computes the response to be sent to the client based on the forward decision of the request.
 func (ch *ClientHandler) computeClientResponse(requestContext *requestContextImpl) (*frame.RawFrame, common.ClusterType, error) {
+	if isRaceRead(requestContext.requestInfo) {
+		return ch.computeRaceResponse(requestContext)
+	}
+	if requestContext.writeConfirmation != common.DualWriteConfirmationUndefined {
+		return ch.computeConfirmedWriteResponse(requestContext)
+	}
+
 	fwdDecision := requestContext.requestInfo.GetForwardDecision()
+	logger := requestContext.logger()
 	switch fwdDecision {
 	case forwardToOrigin:
 		if requestContext.originResponse == nil {
@@ -772,7 +1222,7 @@ func (ch *ClientHandler) computeClientResponse(requestContext *requestContextImp
 				"did not receive response from origin cassandra channel, stream: %d",
 				requestContext.request.Header.StreamId)
 		}
-		log.Tracef("Forward to origin: just returning the response received from %v: %d",
+		logger.Tracef("Forward to origin: just returning the response received from %v: %d",
 			common.ClusterTypeOrigin, requestContext.originResponse.Header.OpCode)
 
 		if requestContext.requestInfo.ShouldBeTrackedInMetrics() && !isResponseSuccessful(requestContext.originResponse) {
@@ -785,7 +1235,7 @@ func (ch *ClientHandler) computeClientResponse(requestContext *requestContextImp
 				"did not receive response from target cassandra channel, stream: %d",
 				requestContext.request.Header.StreamId)
 		}
-		log.Tracef("Forward to target: just returning the response received from %v: %d",
+		logger.Tracef("Forward to target: just returning the response received from %v: %d",
 			common.ClusterTypeTarget, requestContext.targetResponse.Header.OpCode)
 
 		if requestContext.requestInfo.ShouldBeTrackedInMetrics() && !isResponseSuccessful(requestContext.targetResponse) {
@@ -793,18 +1243,15 @@ func (ch *ClientHandler) computeClientResponse(requestContext *requestContextImp
 		}
 		return requestContext.targetResponse, common.ClusterTypeTarget, nil
 	case forwardToBoth:
-		if requestContext.originResponse == nil {
-			return nil, common.ClusterTypeNone, fmt.Errorf(
-				"did not receive response from original cassandra channel, stream: %d",
-				requestContext.request.Header.StreamId)
-		}
-		if requestContext.targetResponse == nil {
+		// a cluster that did not respond (e.g. because the request timed out) is handled as a failure of that cluster
+		aggregatedResponse, responseClusterType := ch.aggregateAndTrackResponses(
+			logger, requestContext.primaryCluster, requestContext.requestInfo, requestContext.request,
+			requestContext.originResponse, requestContext.targetResponse)
+		if aggregatedResponse == nil {
 			return nil, common.ClusterTypeNone, fmt.Errorf(
-				"did not receive response from target cassandra channel, stream: %d",
-				requestContext.request.Header.StreamId)
+				"could not aggregate responses from %v and %v cassandra channels, stream: %d",
+				common.ClusterTypeOrigin, common.ClusterTypeTarget, requestContext.request.Header.StreamId)
 		}
-		aggregatedResponse, responseClusterType := ch.aggregateAndTrackResponses(
-			requestContext.requestInfo, requestContext.request, requestContext.originResponse, requestContext.targetResponse)
 		return aggregatedResponse, responseClusterType, nil
 	case forwardToAsyncOnly:
 		switch ch.asyncConnector.clusterType {
@@ -814,7 +1261,7 @@ func (ch *ClientHandler) computeClientResponse(requestContext *requestContextImp
 					"did not receive response from async target cassandra channel, stream: %d",
 					requestContext.request.Header.StreamId)
 			}
-			log.Tracef("Forward to async: just returning the response received from %v: %d",
+			logger.Tracef("Forward to async: just returning the response received from %v: %d",
 				common.ClusterTypeTarget, requestContext.targetResponse.Header.OpCode)
 			return requestContext.targetResponse, common.ClusterTypeTarget, nil
 		case common.ClusterTypeOrigin:
@@ -823,11 +1270,11 @@ func (ch *ClientHandler) computeClientResponse(requestContext *requestContextImp
 					"did not receive response from async origin cassandra channel, stream: %d",
 					requestContext.request.Header.StreamId)
 			}
-			log.Tracef("Forward to async: just returning the response received from %v: %d",
+			logger.Tracef("Forward to async: just returning the response received from %v: %d",
 				common.ClusterTypeOrigin, requestContext.originResponse.Header.OpCode)
 			return requestContext.originResponse, common.ClusterTypeOrigin, nil
 		default:
-			log.Errorf("Unknown cluster type: %v. This is a bug, please report.", ch.asyncConnector.clusterType)
+			logger.Errorf("Unknown cluster type: %v. This is a bug, please report.", ch.asyncConnector.clusterType)
 			return nil, common.ClusterTypeNone, fmt.Errorf("unknown cluster type: %v; this is a bug, please report", ch.asyncConnector.clusterType)
 		}
 	case forwardToNone:
@@ -840,6 +1287,29 @@ func (ch *ClientHandler) computeClientResponse(requestContext *requestContextImp
 	}
 }
 
+// handleUnexpectedResponse is called when a response can not be processed (e.g. an UNPREPARED response with a
+// prepared id that is not in the cache). Depending on the configuration either the response is sent to the client
+// as is or it is replaced with a SERVER_ERROR so the client doesn't wait for a response that never arrives.
+func (ch *ClientHandler) handleUnexpectedResponse(
+	response *frame.RawFrame, responseClusterType common.ClusterType, processErr error) (*frame.RawFrame, error) {
+	ch.metricHandler.GetProxyMetrics().UnexpectedResponses.Add(1)
+
+	if ch.unexpectedResponseMode == common.UnexpectedResponseModePassthrough {
+		log.Warnf("Could not process response from %v, sending it to the client unmodified: %v", responseClusterType, processErr)
+		return response, nil
+	}
+
+	log.Warnf("Could not process response from %v, sending SERVER_ERROR to the client: %v", responseClusterType, processErr)
+	errorFrame := frame.NewFrame(response.Header.Version, response.Header.StreamId, &message.ServerError{
+		ErrorMessage: fmt.Sprintf("Proxy could not process the response from %v: %v", responseClusterType, processErr),
+	})
+	errorRawFrame, err := ch.codec.get().ConvertToRawFrame(errorFrame)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert server error response to raw frame: %w", err)
+	}
+	return errorRawFrame, nil
+}
+
 // Modifies internal state based on the provided aggregated response (e.g. storing prepared IDs)
 func (ch *ClientHandler) processClientResponse(
 	response *frame.RawFrame, responseClusterType common.ClusterType, reqCtx *requestContextImpl) (*frame.RawFrame, error) {
@@ -847,8 +1317,11 @@ func (ch *ClientHandler) processClientResponse(
 	var newFrame *frame.Frame
 	switch response.Header.OpCode {
 	case primitive.OpCodeResult, primitive.OpCodeError:
-		decodedFrame, err := defaultCodec.ConvertFromRawFrame(response)
+		decodedFrame, err := ch.codec.get().ConvertFromRawFrame(response)
 		if err != nil {
+			if ch.conf.ForwardUnknownErrorCodes && decodeUnknownError(response) != nil {
+				return response, nil
+			}
 			return nil, fmt.Errorf("error decoding response: %w", err)
 		}
 
@@ -871,10 +1344,14 @@ func (ch *ClientHandler) processClientResponse(
 				unpreparedId = bodyMsg.Id
 			case common.ClusterTypeTarget:
 				preparedData, ok := ch.preparedStatementCache.GetByTargetPreparedId(bodyMsg.Id)
-				if !ok {
+				if ok {
+					unpreparedId = preparedData.GetOriginPreparedId()
+				} else if ch.psCacheMissMode == common.PsCacheMissModeForward {
+					// the request was forwarded with the prepared id that the client sent after a PS cache miss
+					unpreparedId = bodyMsg.Id
+				} else {
 					return nil, fmt.Errorf("could not get PreparedData by TargetPreparedId: %v", hex.EncodeToString(bodyMsg.Id))
 				}
-				unpreparedId = preparedData.GetOriginPreparedId()
 			default:
 				return nil, fmt.Errorf("invalid cluster type: %v", responseClusterType)
 			}
@@ -892,6 +1369,26 @@ func (ch *ClientHandler) processClientResponse(
 				"Prepared ID in response from %v: %v. Original error: %v",
 				responseClusterType, hex.EncodeToString(unpreparedId),
 				responseClusterType, hex.EncodeToString(bodyMsg.Id), bodyMsg.ErrorMessage)
+		case *message.Unauthorized:
+			if ch.conf.UnauthorizedErrorsIncludeCluster {
+				// lets the client tell which cluster rejected the request, e.g. a permission that only exists on ORIGIN
+				newFrame = decodedFrame.Clone()
+				newFrame.Body.Message = &message.Unauthorized{
+					ErrorMessage: fmt.Sprintf("[%v] %v", responseClusterType, bodyMsg.ErrorMessage),
+				}
+			}
+		}
+	case primitive.OpCodeSupported:
+		decodedFrame, err := ch.codec.get().ConvertFromRawFrame(response)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding response: %w", err)
+		}
+
+		if supported, ok := decodedFrame.Body.Message.(*message.Supported); ok {
+			if spoofedSupported := spoofSupportedOptions(ch.conf, supported); spoofedSupported != nil {
+				newFrame = decodedFrame.Clone()
+				newFrame.Body.Message = spoofedSupported
+			}
 		}
 	}
 
@@ -899,7 +1396,7 @@ func (ch *ClientHandler) processClientResponse(
 		return response, nil
 	}
 
-	newRawFrame, err := defaultCodec.ConvertToRawFrame(newFrame)
+	newRawFrame, err := ch.codec.get().ConvertToRawFrame(newFrame)
 	if err != nil {
 		return nil, fmt.Errorf("could not convert new response: %w", err)
 	}
@@ -917,7 +1414,7 @@ func (ch *ClientHandler) processPreparedResponse(
 	} else if reqCtx.targetResponse == nil {
 		return nil, errors.New("unexpected target response nil")
 	} else {
-		targetBody, err := defaultCodec.DecodeBody(reqCtx.targetResponse.Header, bytes.NewReader(reqCtx.targetResponse.Body))
+		targetBody, err := ch.codec.get().DecodeBody(reqCtx.targetResponse.Header, bytes.NewReader(reqCtx.targetResponse.Body))
 		if err != nil {
 			return nil, fmt.Errorf("error decoding target result response: %w", err)
 		}
@@ -1034,6 +1531,7 @@ type handshakeRequestResult struct {
 // When the Origin handshake ends, this function blocks, waiting until Target handshake is done.
 // This ensures that the client connection is Ready only when both Cluster Connector connections are ready.
 func (ch *ClientHandler) handleHandshakeRequest(request *frame.RawFrame, wg *sync.WaitGroup) (bool, error) {
+	ch.stopAuthIdleTimer()
 	scheduledTaskChannel := make(chan *handshakeRequestResult, 1)
 	wg.Add(1)
 	ch.requestResponseScheduler.Schedule(func() {
@@ -1051,6 +1549,25 @@ func (ch *ClientHandler) handleHandshakeRequest(request *frame.RawFrame, wg *syn
 			return
 		}
 
+		if request.Header.OpCode == primitive.OpCodeAuthResponse && !ch.expectingAuthResponse {
+			scheduledTaskChannel <- &handshakeRequestResult{
+				authSuccess: false,
+				err:         ch.sendUnexpectedAuthResponseErrorToClient(request),
+			}
+			return
+		}
+
+		if cachedResponse := ch.getCachedSupportedResponse(request); cachedResponse != nil {
+			ch.clientConnector.sendResponseToClient(cachedResponse)
+			scheduledTaskChannel <- &handshakeRequestResult{authSuccess: false}
+			return
+		}
+
+		if rejected, err := ch.rejectUnsupportedStartupCompression(request); rejected || err != nil {
+			scheduledTaskChannel <- &handshakeRequestResult{authSuccess: false, err: err}
+			return
+		}
+
 		if request.Header.OpCode == primitive.OpCodeAuthResponse {
 			newAuthFrame, err := ch.handleClientCredentials(request)
 			if err != nil {
@@ -1066,6 +1583,10 @@ func (ch *ClientHandler) handleHandshakeRequest(request *frame.RawFrame, wg *syn
 			}
 		}
 
+		if request.Header.OpCode == primitive.OpCodeStartup {
+			request = ch.negotiateStartupCqlVersion(request)
+		}
+
 		responseChan := make(chan *customResponse, 1)
 		err := ch.forwardRequest(request, responseChan)
 		if err != nil {
@@ -1128,13 +1649,20 @@ func (ch *ClientHandler) handleHandshakeRequest(request *frame.RawFrame, wg *syn
 			secondaryCluster = common.ClusterTypeTarget
 		}
 
-		ch.secondaryStartupResponse = secondaryResponse
-		ch.startupRequest = request
+		ch.trackClusterAuthenticator(response.originResponse, common.ClusterTypeOrigin)
+		ch.trackClusterAuthenticator(response.targetResponse, common.ClusterTypeTarget)
 
 		err := validateSecondaryStartupResponse(secondaryResponse, secondaryCluster)
 		if err != nil {
+			ch.clearStartupRequest()
 			return false, fmt.Errorf("unsuccessful startup on %v: %w", secondaryCluster, err)
 		}
+
+		// the same STARTUP request is sent to both clusters so the keyspace is the same on both connections
+		err = ch.setStartupRequest(request, secondaryResponse)
+		if err != nil {
+			return false, err
+		}
 	}
 
 	scheduledTaskChannel = make(chan *handshakeRequestResult, 1)
@@ -1159,7 +1687,7 @@ func (ch *ClientHandler) handleHandshakeRequest(request *frame.RawFrame, wg *syn
 			if ch.forwardAuthToTarget {
 				secondaryClusterType = common.ClusterTypeOrigin
 			}
-			secondaryHandshakeChannel, err := ch.startSecondaryHandshake(false)
+			secondaryHandshakeChannel, err := ch.startSecondaryHandshake(request.Header.Version, false)
 			if err != nil {
 				tempResult.err = err
 				scheduledTaskChannel <- tempResult
@@ -1167,7 +1695,7 @@ func (ch *ClientHandler) handleHandshakeRequest(request *frame.RawFrame, wg *syn
 			}
 			var asyncConnectorHandshakeChannel chan error
 			if ch.asyncConnector != nil {
-				asyncConnectorHandshakeChannel, err = ch.startSecondaryHandshake(true)
+				asyncConnectorHandshakeChannel, err = ch.startSecondaryHandshake(request.Header.Version, true)
 				if err != nil {
 					log.Errorf("Error occured in async connector (%v) handshake: %v. "+
 						"Async requests will not be forwarded.", ch.asyncConnector.clusterType, err.Error())
@@ -1182,6 +1710,12 @@ func (ch *ClientHandler) handleHandshakeRequest(request *frame.RawFrame, wg *syn
 					asyncConnectorHandshakeChannel = nil
 				case err, _ = <-secondaryHandshakeChannel:
 					secondaryHandshakeChannel = nil
+				case <-ch.clientHandlerContext.Done():
+					// the client disconnected (or the handler is shutting down), the handshake goroutines observe
+					// the same context and their channels are buffered so they can finish without a reader
+					tempResult.err = ShutdownErr
+					scheduledTaskChannel <- tempResult
+					return
 				}
 			}
 
@@ -1191,6 +1725,12 @@ func (ch *ClientHandler) handleHandshakeRequest(request *frame.RawFrame, wg *syn
 				ch.asyncConnector.Shutdown()
 			}
 
+			if err == ShutdownErr {
+				tempResult.err = err
+				scheduledTaskChannel <- tempResult
+				return
+			}
+
 			if err != nil {
 				var authError *AuthError
 				if errors.As(err, &authError) {
@@ -1208,12 +1748,18 @@ func (ch *ClientHandler) handleHandshakeRequest(request *frame.RawFrame, wg *syn
 			}
 
 			tempResult.authSuccess = true
+			ch.expectingAuthResponse = false
 			ch.clientConnector.sendResponseToClient(aggregatedResponse)
 			scheduledTaskChannel <- tempResult
 			return
 		}
 
 		// send overall response back to client
+		ch.expectingAuthResponse = aggregatedResponse.Header.OpCode == primitive.OpCodeAuthenticate ||
+			aggregatedResponse.Header.OpCode == primitive.OpCodeAuthChallenge
+		if ch.expectingAuthResponse {
+			ch.startAuthIdleTimer()
+		}
 		ch.clientConnector.sendResponseToClient(aggregatedResponse)
 		scheduledTaskChannel <- tempResult
 	})
@@ -1237,6 +1783,21 @@ func (ch *ClientHandler) sendAuthErrorToClient(requestFrame *frame.RawFrame, sec
 	}
 }
 
+// sendUnexpectedAuthResponseErrorToClient rejects an AUTH_RESPONSE that was not preceded by AUTHENTICATE or AUTH_CHALLENGE,
+// it is not forwarded because the clusters would not be expecting it either.
+func (ch *ClientHandler) sendUnexpectedAuthResponseErrorToClient(requestFrame *frame.RawFrame) error {
+	log.Warnf("Client %v sent AUTH_RESPONSE without a preceding AUTHENTICATE, returning a protocol error.",
+		ch.clientConnector.connection.RemoteAddr())
+	f := frame.NewFrame(requestFrame.Header.Version, requestFrame.Header.StreamId, &message.ProtocolError{
+		ErrorMessage: "Unexpected AUTH_RESPONSE message, the server did not request authentication"})
+	protocolErrorResponse, err := ch.codec.get().ConvertToRawFrame(f)
+	if err != nil {
+		return fmt.Errorf("could not create protocol error response for unexpected AUTH_RESPONSE: %w", err)
+	}
+	ch.clientConnector.sendResponseToClient(protocolErrorResponse)
+	return nil
+}
+
 // Build authentication error response to return to client
 func (ch *ClientHandler) buildAuthErrorResponse(
 	requestFrame *frame.RawFrame, authenticationError *message.AuthenticationError) (*frame.RawFrame, error) {
@@ -1245,7 +1806,7 @@ func (ch *ClientHandler) buildAuthErrorResponse(
 		f.SetCompress(true)
 	}
 
-	return defaultCodec.ConvertToRawFrame(f)
+	return ch.codec.get().ConvertToRawFrame(f)
 }
 
 // Starts the secondary handshake in the background (goroutine).
@@ -1257,17 +1818,16 @@ func (ch *ClientHandler) buildAuthErrorResponse(
 // If the returned channel is closed before a value could be read, then the handshake has failed as well.
 //
 // The handshake was successful if the returned channel contains a "nil" value.
-func (ch *ClientHandler) startSecondaryHandshake(asyncConnector bool) (chan error, error) {
-	startupFrame := ch.startupRequest
-	if startupFrame == nil {
-		return nil, errors.New("can not start secondary handshake before a Startup request was received")
-	}
-	startupResponse := ch.secondaryStartupResponse
-	if startupResponse == nil {
-		return nil, errors.New("can not start secondary handshake before a Startup response was received")
+//
+// The returned channel is buffered so the goroutine doesn't block if the caller stopped waiting for it
+// (e.g. because the client disconnected).
+func (ch *ClientHandler) startSecondaryHandshake(version primitive.ProtocolVersion, asyncConnector bool) (chan error, error) {
+	startupFrame, startupResponse, err := ch.getStartupRequest(version)
+	if err != nil {
+		return nil, err
 	}
 
-	channel := make(chan error)
+	channel := make(chan error, 1)
 	ch.clientHandlerRequestWaitGroup.Add(1)
 	go func() {
 		defer ch.clientHandlerRequestWaitGroup.Done()
@@ -1290,16 +1850,50 @@ func (ch *ClientHandler) handleRequest(f *frame.RawFrame) {
 	}
 }
 
+// Handles a USE request and blocks until the response is sent back to the client (or the client handler is shutting down).
+// The request loop is blocked in the meantime so a slow USE request holds back the requests received after it for up to
+// ZDM_PROXY_REQUEST_TIMEOUT_MS.
+// The current keyspace is updated before the response is sent so requests that are received after this one
+// will use the new keyspace.
+func (ch *ClientHandler) handleUseRequest(f *frame.RawFrame) {
+	responseChan := make(chan *customResponse, 1)
+	err := ch.forwardRequest(f, responseChan)
+	if err != nil {
+		log.Warnf("error sending request with opcode %02x and streamid %d: %s", f.Header.OpCode, f.Header.StreamId, err.Error())
+		return
+	}
+
+	var response *customResponse
+	select {
+	case response = <-responseChan:
+	case <-ch.clientHandlerContext.Done():
+		return
+	}
+
+	if response == nil {
+		// request failed or timed out, the error was already logged
+		return
+	}
+	ch.clientConnector.sendResponseToClient(response.aggregatedResponse)
+}
+
 // Forwards the request, parsing it and enqueuing it to the appropriate cluster connector(s)' write queue(s).
+// Each request is assigned a new correlation id that is added to the log lines of the request.
 func (ch *ClientHandler) forwardRequest(request *frame.RawFrame, customResponseChannel chan *customResponse) error {
-	overallRequestStartTime := time.Now()
+	overallRequestStartTime := nowFunc()
+	correlationId := newCorrelationId()
+	logger := newRequestLogger(correlationId)
 
-	log.Tracef("Request frame: %v", request)
+	request, err := ch.compressionBridge.decompressRequest(request)
+	if err != nil {
+		return err
+	}
+
+	logger.Tracef("Request frame: %v", request)
 
 	currentKeyspace := ch.LoadCurrentKeyspace()
-	context := NewFrameDecodeContext(request)
+	context := ch.newFrameDecodeContext(request)
 	var replacedTerms []*statementReplacedTerms
-	var err error
 	if ch.conf.ReplaceCqlFunctions {
 		context, replacedTerms, err = ch.queryModifier.replaceQueryString(currentKeyspace, context)
 	}
@@ -1307,32 +1901,149 @@ func (ch *ClientHandler) forwardRequest(request *frame.RawFrame, customResponseC
 	if err != nil {
 		return err
 	}
+	context.SetCorrelationId(correlationId)
+	cutoverState := ch.getRequestCutoverState(context)
+	rejected, err := ch.handleLargeBatch(context, customResponseChannel)
+	if rejected || err != nil {
+		return err
+	}
+	rejected, err = ch.handleRegisterLimit(context, customResponseChannel)
+	if rejected || err != nil {
+		return err
+	}
 	requestInfo, err := buildRequestInfo(
-		context, replacedTerms, ch.preparedStatementCache, ch.metricHandler, currentKeyspace, ch.primaryCluster,
-		ch.forwardSystemQueriesToTarget, ch.topologyConfig.VirtualizationEnabled, ch.forwardAuthToTarget, ch.timeUuidGenerator)
+		context, replacedTerms, ch.preparedStatementCache, ch.metricHandler, currentKeyspace, cutoverState.PrimaryCluster,
+		ch.forwardSystemQueriesToTarget, ch.forwardSchemaQueriesToTarget, ch.topologyConfig.VirtualizationEnabled,
+		ch.forwardAuthToTarget, ch.conf.ForwardCountersToOriginOnly, ch.conf.ForwardCounterReadsToOriginOnly,
+		ch.timeUuidGenerator, ch.keyspaceAllowlist, ch.psCacheMissMode)
+	ch.trackPsCacheExecute(request, requestInfo, err)
 	if err != nil {
 		if errVal, ok := err.(*UnpreparedExecuteError); ok {
-			unpreparedFrame, err := createUnpreparedFrame(errVal)
-			if err != nil {
-				return err
-			}
-			log.Debugf(
-				"PS Cache miss, created unprepared response with version %v, streamId %v and preparedId %s",
-				errVal.Header.Version, errVal.Header.StreamId, errVal.preparedId)
-
-			// send it back to client
-			ch.clientConnector.sendResponseToClient(unpreparedFrame)
-			log.Debugf("Unprepared Response sent, exiting handleRequest now")
-			return nil
+			return ch.sendUnpreparedResponse(errVal)
+		}
+		if errVal, ok := err.(*KeyspaceNotAllowedError); ok {
+			return ch.sendKeyspaceNotAllowedResponse(errVal, customResponseChannel)
 		}
 		return err
 	}
+	requestInfo = ch.routeRead(requestInfo, cutoverState)
+	requestInfo = ch.routeReadByKeyspace(context, requestInfo, currentKeyspace)
+	requestInfo = ch.routeByKeyspace(context, requestInfo, currentKeyspace)
+	requestInfo = ch.routeByBindValue(context, requestInfo)
+	requestInfo = ch.routeQuarantined(requestInfo)
+	if customResponseChannel == nil {
+		requestInfo = ch.routeRaceRead(requestInfo)
+	}
+	ch.trackLikelyRetry(context)
+	ch.trackEventRegistration(context)
 
 	requestTimeout := time.Duration(ch.conf.ProxyRequestTimeoutMs) * time.Millisecond
-	err = ch.executeRequest(context, requestInfo, currentKeyspace, overallRequestStartTime, customResponseChannel, requestTimeout)
+	execute := func() error {
+		err := ch.executeRequest(context, requestInfo, currentKeyspace, overallRequestStartTime, customResponseChannel, requestTimeout)
+		if err != nil {
+			if errVal, ok := err.(*UnpreparedExecuteError); ok {
+				return ch.sendUnpreparedResponse(errVal)
+			}
+			return err
+		}
+		return nil
+	}
+	if ch.holdWhileClusterDown(context, requestInfo, customResponseChannel, execute) {
+		return nil
+	}
+	return execute()
+}
+
+// trackLikelyRetry counts the request in the likely retries metric if ZDM_RETRY_DETECTION_ENABLED is set
+// and the same request was received recently on this connection.
+func (ch *ClientHandler) trackLikelyRetry(context *frameDecodeContext) {
+	if ch.retryDetector == nil {
+		return
+	}
+
+	opCode := context.GetRawFrame().Header.OpCode
+	if opCode != primitive.OpCodeQuery && opCode != primitive.OpCodeExecute {
+		return
+	}
+
+	decodedFrame, err := context.GetOrDecodeFrame()
+	if err != nil {
+		log.Debugf("Could not decode request with stream id %v for retry detection: %v", context.GetRawFrame().Header.StreamId, err)
+		return
+	}
+
+	if ch.retryDetector.isLikelyRetry(decodedFrame.Body.Message, nowFunc()) {
+		log.Tracef("Request with stream id %v is likely a retry.", decodedFrame.Header.StreamId)
+		ch.metricHandler.GetProxyMetrics().LikelyRetries.Add(1)
+	}
+}
+
+// sendKeyspaceNotAllowedResponse rejects a request that accesses a keyspace that is not in the allowlist.
+func (ch *ClientHandler) sendKeyspaceNotAllowedResponse(
+	errVal *KeyspaceNotAllowedError, customResponseChannel chan *customResponse) error {
+	ch.metricHandler.GetProxyMetrics().RejectedKeyspaceRequests.Add(1)
+	unauthorizedFrame, err := createKeyspaceNotAllowedFrame(ch.codec.get(), errVal)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Rejecting request with stream id %v: %v", errVal.Header.StreamId, errVal)
+
+	if customResponseChannel != nil {
+		customResponseChannel <- &customResponse{aggregatedResponse: unauthorizedFrame}
+	} else {
+		ch.clientConnector.sendResponseToClient(unauthorizedFrame)
+	}
+	return nil
+}
+
+// sendUnpreparedResponse sends an UNPREPARED response to the client so that it prepares the statement again.
+func (ch *ClientHandler) sendUnpreparedResponse(errVal *UnpreparedExecuteError) error {
+	unpreparedFrame, err := createUnpreparedFrame(ch.codec.get(), errVal)
 	if err != nil {
 		return err
 	}
+	log.Debugf(
+		"PS Cache miss, created unprepared response with version %v, streamId %v and preparedId %s",
+		errVal.Header.Version, errVal.Header.StreamId, errVal.preparedId)
+
+	// send it back to client
+	ch.clientConnector.sendResponseToClient(unpreparedFrame)
+	log.Debugf("Unprepared Response sent, exiting handleRequest now")
+	return nil
+}
+
+// isKnownForwardDecision returns true if executeRequest knows how to forward a request with the given decision,
+// forwardToNone requests are answered by the proxy so they are not included.
+func isKnownForwardDecision(decision forwardDecision) bool {
+	switch decision {
+	case forwardToBoth, forwardToOrigin, forwardToTarget, forwardToAsyncOnly:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendUnknownForwardDecisionResponse answers a request with an unknown forward decision with a SERVER_ERROR, the
+// request is not forwarded to any cluster.
+func (ch *ClientHandler) sendUnknownForwardDecisionResponse(
+	frameContext *frameDecodeContext, decision forwardDecision, customResponseChannel chan *customResponse) error {
+	ch.metricHandler.GetProxyMetrics().UnknownForwardDecisions.Add(1)
+	request := frameContext.GetRawFrame()
+	errorFrame := frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.ServerError{
+		ErrorMessage: fmt.Sprintf("Proxy could not determine where to forward the request (unknown forward decision %v)", decision),
+	})
+	errorRawFrame, err := ch.codec.get().ConvertToRawFrame(errorFrame)
+	if err != nil {
+		return fmt.Errorf("could not convert server error response to raw frame: %w", err)
+	}
+	frameContext.logger().Errorf("Unknown forward decision %v for request with opcode %v and stream id %v, "+
+		"sending SERVER_ERROR to the client.", decision, request.Header.OpCode, request.Header.StreamId)
+
+	if customResponseChannel != nil {
+		customResponseChannel <- &customResponse{aggregatedResponse: errorRawFrame}
+	} else {
+		ch.clientConnector.sendResponseToClient(errorRawFrame)
+	}
 	return nil
 }
 
@@ -1342,7 +2053,9 @@ func (ch *ClientHandler) executeRequest(
 	frameContext *frameDecodeContext, requestInfo RequestInfo, currentKeyspace string,
 	overallRequestStartTime time.Time, customResponseChannel chan *customResponse, requestTimeout time.Duration) error {
 	fwdDecision := requestInfo.GetForwardDecision()
-	log.Tracef("Opcode: %v, Forward decision: %v", frameContext.GetRawFrame().Header.OpCode, fwdDecision)
+	cutoverState := ch.getRequestCutoverState(frameContext)
+	logger := frameContext.logger()
+	logger.Tracef("Opcode: %v, Forward decision: %v", frameContext.GetRawFrame().Header.OpCode, fwdDecision)
 
 	f := frameContext.GetRawFrame()
 	originRequest := f
@@ -1359,12 +2072,18 @@ func (ch *ClientHandler) executeRequest(
 		clientResponse, originRequest, targetRequest, err = ch.handleExecuteRequest(castedRequestInfo, frameContext, currentKeyspace)
 	case *BatchRequestInfo:
 		originRequest, targetRequest, err = ch.handleBatchRequest(castedRequestInfo, frameContext)
+	default:
+		if f.Header.OpCode == primitive.OpCodeStartup {
+			originRequest, targetRequest, err = ch.handleStartupRequest(frameContext)
+		}
 	}
 
 	if err != nil {
 		return err
 	}
 
+	originRequest, targetRequest = ch.removeTracing(cutoverState.PrimaryCluster, originRequest, targetRequest)
+
 	if fwdDecision == forwardToNone {
 		if clientResponse == nil {
 			return fmt.Errorf("forwardDecision is NONE but client response is nil")
@@ -1379,7 +2098,17 @@ func (ch *ClientHandler) executeRequest(
 		return nil
 	}
 
+	if !isKnownForwardDecision(fwdDecision) {
+		return ch.sendUnknownForwardDecisionResponse(frameContext, fwdDecision, customResponseChannel)
+	}
+
 	reqCtx := NewRequestContext(f, requestInfo, overallRequestStartTime, customResponseChannel)
+	reqCtx.correlationId = frameContext.GetCorrelationId()
+	reqCtx.writeConfirmation = ch.getWriteConfirmation(requestInfo)
+	reqCtx.primaryCluster = cutoverState.PrimaryCluster
+	if fwdDecision == forwardToBoth && ch.conf.TargetUnpreparedWriteReprepareEnabled && !reqCtx.isConfirmedEarly() {
+		reqCtx.targetRequest = targetRequest
+	}
 	var contextHoldersMap *sync.Map
 	if fwdDecision == forwardToAsyncOnly {
 		contextHoldersMap = ch.asyncRequestContextHolders // different map because of stream id collision
@@ -1388,12 +2117,34 @@ func (ch *ClientHandler) executeRequest(
 	}
 	holder, err := storeRequestContext(contextHoldersMap, reqCtx)
 	if err != nil {
-		return err
+		deferred := ch.deferRequestAfterRaceRead(contextHoldersMap, f.Header.StreamId, func() {
+			err := ch.executeRequest(
+				frameContext, requestInfo, currentKeyspace, overallRequestStartTime, customResponseChannel, requestTimeout)
+			if err != nil {
+				logger.Warnf("error sending request with opcode %02x and streamid %d: %s", f.Header.OpCode, f.Header.StreamId, err.Error())
+			}
+		})
+		if deferred {
+			logger.Tracef("Stream id %d is still used by a race read, the request is sent once it is released.", f.Header.StreamId)
+			return nil
+		}
+		// the race read that used the stream id may have been released in the meantime
+		holder, err = storeRequestContext(contextHoldersMap, reqCtx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !ch.reserveStreamIds(reqCtx, fwdDecision) {
+		if err = holder.Clear(reqCtx); err != nil {
+			logger.Debugf("Could not free stream id: %v", err)
+		}
+		return ch.sendStreamIdInUseResponse(frameContext, customResponseChannel)
 	}
 
 	if requestInfo.ShouldBeTrackedInMetrics() {
 		proxyMetrics := ch.metricHandler.GetProxyMetrics()
-		switch fwdDecision {
+		switch getMetricsForwardDecision(requestInfo, reqCtx.primaryCluster) {
 		case forwardToBoth:
 			proxyMetrics.InFlightWrites.Add(1)
 		case forwardToOrigin:
@@ -1402,7 +2153,7 @@ func (ch *ClientHandler) executeRequest(
 			proxyMetrics.InFlightReadsTarget.Add(1)
 		case forwardToAsyncOnly:
 		default:
-			log.Errorf("unexpected forwardDecision %v, unable to track proxy level metrics", fwdDecision)
+			logger.Errorf("unexpected forwardDecision %v, unable to track proxy level metrics", fwdDecision)
 		}
 	}
 
@@ -1423,19 +2174,22 @@ func (ch *ClientHandler) executeRequest(
 		reqCtx.SetTimer(timer)
 	}
 
-	sendAlsoToAsync := requestInfo.ShouldAlsoBeSentAsync() && ch.asyncConnector != nil
+	sendAlsoToAsync := requestInfo.ShouldAlsoBeSentAsync() && ch.isAsyncReadEnabled(cutoverState)
+	if sendAlsoToAsync && isPrimaryRead(requestInfo) {
+		sendAlsoToAsync = ch.asyncReadScope.includes(f.Header.OpCode)
+	}
 	switch fwdDecision {
 	case forwardToBoth:
-		log.Tracef("Forwarding request with opcode %v for stream %v to %v and %v",
+		logger.Tracef("Forwarding request with opcode %v for stream %v to %v and %v",
 			f.Header.OpCode, f.Header.StreamId, common.ClusterTypeOrigin, common.ClusterTypeTarget)
 		ch.originCassandraConnector.sendRequestToCluster(originRequest)
 		ch.targetCassandraConnector.sendRequestToCluster(targetRequest)
 	case forwardToOrigin:
-		log.Tracef("Forwarding request with opcode %v for stream %v to %v",
+		logger.Tracef("Forwarding request with opcode %v for stream %v to %v",
 			f.Header.OpCode, f.Header.StreamId, common.ClusterTypeOrigin)
 		ch.originCassandraConnector.sendRequestToCluster(originRequest)
 	case forwardToTarget:
-		log.Tracef("Forwarding request with opcode %v for stream %v to %v",
+		logger.Tracef("Forwarding request with opcode %v for stream %v to %v",
 			f.Header.OpCode, f.Header.StreamId, common.ClusterTypeTarget)
 		ch.targetCassandraConnector.sendRequestToCluster(targetRequest)
 	case forwardToAsyncOnly:
@@ -1489,6 +2243,10 @@ func (ch *ClientHandler) handleInterceptedRequest(
 	if err != nil {
 		return nil, err
 	}
+	if ch.schemaVersionMode == common.SchemaVersionModeSynthetic {
+		virtualHosts = withSchemaVersion(virtualHosts, syntheticSchemaVersion)
+	}
+	virtualHosts, systemLocalColumnData := withSpoofedIdentity(ch.conf, virtualHosts, controlConn.GetSystemLocalColumnData())
 
 	typeCodec := GetDefaultGenericTypeCodec()
 
@@ -1503,7 +2261,7 @@ func (ch *ClientHandler) handleInterceptedRequest(
 			return nil, fmt.Errorf("unable to intercept system.peers query (prepared=%v) because parsed select clause is nil", prepared)
 		}
 		interceptedQueryResponse, err = NewSystemPeersResult(prepareRequestInfo, currentKeyspace,
-			typeCodec, f.Header.Version, controlConn.GetSystemPeersColumnNames(), controlConn.GetSystemLocalColumnData(),
+			typeCodec, f.Header.Version, controlConn.GetSystemPeersColumnNames(), systemLocalColumnData,
 			parsedSelectClause, virtualHosts, controlConn.GetLocalVirtualHostIndex(), ch.conf.ProxyListenPort)
 	case local:
 		parsedSelectClause := interceptedRequestInfo.GetParsedSelectClause()
@@ -1512,7 +2270,7 @@ func (ch *ClientHandler) handleInterceptedRequest(
 		}
 		localVirtualHost := virtualHosts[controlConn.GetLocalVirtualHostIndex()]
 		interceptedQueryResponse, err = NewSystemLocalResult(prepareRequestInfo, currentKeyspace,
-			typeCodec, f.Header.Version, controlConn.GetSystemLocalColumnData(), parsedSelectClause,
+			typeCodec, f.Header.Version, systemLocalColumnData, parsedSelectClause,
 			localVirtualHost, ch.conf.ProxyListenPort)
 	default:
 		return nil, fmt.Errorf("expected intercepted query type: %v", interceptedQueryType)
@@ -1529,7 +2287,7 @@ func (ch *ClientHandler) handleInterceptedRequest(
 	}
 
 	interceptedResponseFrame := frame.NewFrame(f.Header.Version, f.Header.StreamId, interceptedQueryResponse)
-	interceptedResponseRawFrame, err := defaultCodec.ConvertToRawFrame(interceptedResponseFrame)
+	interceptedResponseRawFrame, err := ch.codec.get().ConvertToRawFrame(interceptedResponseFrame)
 	if err != nil {
 		return nil, fmt.Errorf("could not convert intercepted response frame %v: %w", interceptedResponseFrame, err)
 	}
@@ -1588,6 +2346,8 @@ func (ch *ClientHandler) handleExecuteRequest(
 		return clientResponse, nil, nil, err
 	}
 
+	logBindValues(frameContext, preparedData)
+
 	sendToAsyncConnector := (castedRequestInfo.ShouldAlsoBeSentAsync() || fwdDecision == forwardToAsyncOnly) && ch.asyncConnector != nil
 	replacedTerms := prepareRequestInfo.GetReplacedTerms()
 	asyncConnectorIsOrigin := ch.asyncConnector != nil && ch.asyncConnector.clusterType == common.ClusterTypeOrigin
@@ -1606,7 +2366,7 @@ func (ch *ClientHandler) handleExecuteRequest(
 			return nil, nil, nil, fmt.Errorf("could not add values to origin EXECUTE: %w", err)
 		}
 
-		originExecuteRequestRaw, err := defaultCodec.ConvertToRawFrame(newOriginRequest)
+		originExecuteRequestRaw, err := ch.codec.get().ConvertToRawFrame(newOriginRequest)
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("could not convert origin EXECUTE response to raw frame: %w", err)
 		}
@@ -1645,7 +2405,12 @@ func (ch *ClientHandler) handleExecuteRequest(
 		log.Tracef("Replacing prepared ID %s with %s for target cluster.",
 			hex.EncodeToString(originalQueryId), hex.EncodeToString(newTargetExecuteMsg.QueryId))
 
-		newTargetRequestRaw, err := defaultCodec.ConvertToRawFrame(newTargetRequest)
+		if newTargetExecuteMsg.ResultMetadataId != nil {
+			// the result metadata id that the client has is the one returned by origin
+			newTargetExecuteMsg.ResultMetadataId = preparedData.GetTargetResultMetadataId()
+		}
+
+		newTargetRequestRaw, err := ch.codec.get().ConvertToRawFrame(newTargetRequest)
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("could not convert target EXECUTE response to raw frame: %w", err)
 		}
@@ -1677,6 +2442,23 @@ func (ch *ClientHandler) handleBatchRequest(
 	}
 
 	for stmtIdx, preparedData := range castedRequestInfo.GetPreparedDataByStmtIdx() {
+		if stmtIdx >= len(newTargetBatchMsg.Children) {
+			return nil, nil, fmt.Errorf("batch child statement index %v is out of range (%v children)",
+				stmtIdx, len(newTargetBatchMsg.Children))
+		}
+		originalQueryId, ok := newTargetBatchMsg.Children[stmtIdx].QueryOrId.([]byte)
+		if !ok {
+			return nil, nil, fmt.Errorf("expected prepared id in batch child statement %v but got %v instead",
+				stmtIdx, newTargetBatchMsg.Children[stmtIdx].QueryOrId)
+		}
+		if len(preparedData.GetTargetPreparedId()) == 0 {
+			// the statement can not be executed on target, the client has to prepare it again on both clusters
+			log.Warnf("No target prepared id for prepared id %s within a BATCH, sending UNPREPARED to the client.",
+				hex.EncodeToString(originalQueryId))
+			return nil, nil, &UnpreparedExecuteError{
+				Header: decodedFrame.Header, Body: decodedFrame.Body, preparedId: originalQueryId}
+		}
+
 		prepareRequestInfo := preparedData.GetPrepareRequestInfo()
 		if len(prepareRequestInfo.GetReplacedTerms()) > 0 {
 			if newOriginRequest == nil {
@@ -1698,14 +2480,13 @@ func (ch *ClientHandler) handleBatchRequest(
 			}
 		}
 
-		originalQueryId := newTargetBatchMsg.Children[stmtIdx].QueryOrId.([]byte)
 		newTargetBatchMsg.Children[stmtIdx].QueryOrId = preparedData.GetTargetPreparedId()
 		log.Tracef("Replacing prepared ID %s within a BATCH with %s for target cluster.",
 			hex.EncodeToString(originalQueryId), hex.EncodeToString(preparedData.GetTargetPreparedId()))
 	}
 
 	if newOriginRequest != nil {
-		originBatchRequest, err := defaultCodec.ConvertToRawFrame(newOriginRequest)
+		originBatchRequest, err := ch.codec.get().ConvertToRawFrame(newOriginRequest)
 		if err != nil {
 			return nil, nil, fmt.Errorf("could not convert origin BATCH response to raw frame: %w", err)
 		}
@@ -1713,7 +2494,7 @@ func (ch *ClientHandler) handleBatchRequest(
 		originRequest = originBatchRequest
 	}
 
-	targetBatchRequest, err := defaultCodec.ConvertToRawFrame(newTargetRequest)
+	targetBatchRequest, err := ch.codec.get().ConvertToRawFrame(newTargetRequest)
 	if err != nil {
 		return nil, nil, fmt.Errorf("could not convert target BATCH response to raw frame: %w", err)
 	}
@@ -1728,7 +2509,7 @@ func (ch *ClientHandler) sendToAsyncConnector(
 	fwdDecision forwardDecision, reqCtx *requestContextImpl, holder *requestContextHolder, sendAlsoToAsync bool,
 	overallRequestStartTime time.Time, requestTimeout time.Duration) error {
 	var asyncRequest *frame.RawFrame
-	if ch.primaryCluster == common.ClusterTypeTarget {
+	if ch.asyncConnector.clusterType == common.ClusterTypeOrigin {
 		asyncRequest = originRequest
 	} else {
 		asyncRequest = targetRequest
@@ -1756,6 +2537,15 @@ func (ch *ClientHandler) sendToAsyncConnector(
 
 	f := frameContext.GetRawFrame()
 
+	maxWaitExceeded := false
+	if isFireAndForget && ch.conf.AsyncReadsMaxWaitMs > 0 {
+		maxWait := time.Duration(ch.conf.AsyncReadsMaxWaitMs) * time.Millisecond
+		if maxWait < requestTimeout {
+			requestTimeout = maxWait
+			maxWaitExceeded = true
+		}
+	}
+
 	sent := ch.asyncConnector.sendAsyncRequest(
 		reqCtx.GetRequestInfo(), asyncRequest, !isFireAndForget, overallRequestStartTime, requestTimeout, func() {
 			if !isFireAndForget {
@@ -1770,6 +2560,9 @@ func (ch *ClientHandler) sendToAsyncConnector(
 					ch.respChannel <- NewTimeoutResponse(f, true)
 				}
 			} else {
+				if maxWaitExceeded && reqCtx.GetRequestInfo().ShouldBeTrackedInMetrics() {
+					ch.metricHandler.GetProxyMetrics().AsyncReadsMaxWaitExceeded.Add(1)
+				}
 				ch.clientHandlerRequestWaitGroup.Done()
 			}
 		})
@@ -1790,34 +2583,63 @@ func (ch *ClientHandler) sendToAsyncConnector(
 // Aggregates the responses received from the two clusters as follows:
 //   - if both responses are a success OR both responses are a failure: return responseFromOC
 //   - if either response is a failure, the failure "wins": return the failed response
+//   - unless the failure is AlreadyExists and ZDM_TREAT_ALREADY_EXISTS_AS_SUCCESS is enabled: return the successful response
+//
+// Custom payloads are forwarded as part of the returned response. If both responses are a success and the target
+// response is returned (e.g. when target is the primary cluster) then the origin custom payload is preferred,
+// see reconcileCustomPayload. The warnings of a BATCH that succeeded on both clusters are merged into the returned
+// response, see reconcileBatchWarnings.
+//
+// A missing (nil) response, e.g. because the request timed out on that cluster, is handled as a failure of that
+// cluster, see aggregateMissingResponses.
 //
 // Also updates metrics appropriately.
 func (ch *ClientHandler) aggregateAndTrackResponses(
+	logger *log.Entry,
+	primaryCluster common.ClusterType,
 	requestInfo RequestInfo,
 	request *frame.RawFrame,
 	responseFromOriginCassandra *frame.RawFrame,
 	responseFromTargetCassandra *frame.RawFrame) (*frame.RawFrame, common.ClusterType) {
 
+	if responseFromOriginCassandra == nil || responseFromTargetCassandra == nil {
+		return ch.aggregateMissingResponses(logger, requestInfo, request, responseFromOriginCassandra, responseFromTargetCassandra)
+	}
+
 	originOpCode := responseFromOriginCassandra.Header.OpCode
-	log.Tracef("Aggregating responses. %v opcode %d, %v opcode %d",
+	logger.Tracef("Aggregating responses. %v opcode %d, %v opcode %d",
 		common.ClusterTypeOrigin, originOpCode, common.ClusterTypeTarget, responseFromTargetCassandra.Header.OpCode)
 
+	if requestInfo.ShouldBeTrackedInMetrics() {
+		ch.trackDualWriteAgreement(responseFromOriginCassandra, responseFromTargetCassandra)
+		ch.trackTableDivergence(requestInfo, request, responseFromOriginCassandra, responseFromTargetCassandra)
+		ch.reportWriteMismatch(requestInfo, request, responseFromOriginCassandra, responseFromTargetCassandra)
+	}
+
 	// aggregate responses and update relevant aggregate metrics for general failed or successful responses
 	if isResponseSuccessful(responseFromOriginCassandra) && isResponseSuccessful(responseFromTargetCassandra) {
+		if request.Header.OpCode == primitive.OpCodeBatch {
+			if primaryCluster == common.ClusterTypeTarget {
+				response := reconcileCustomPayload(ch.codec.get(), responseFromOriginCassandra, responseFromTargetCassandra)
+				return ch.reconcileBatchWarnings(logger, requestInfo, response, responseFromOriginCassandra), common.ClusterTypeTarget
+			}
+			return ch.reconcileBatchWarnings(logger, requestInfo, responseFromOriginCassandra, responseFromTargetCassandra), common.ClusterTypeOrigin
+		}
 		if originOpCode == primitive.OpCodeSupported {
-			log.Tracef("Aggregated response: both successes, sending back %v response with opcode %d",
+			logger.Tracef("Aggregated response: both successes, sending back %v response with opcode %d",
 				common.ClusterTypeTarget, originOpCode)
-			return responseFromTargetCassandra, common.ClusterTypeTarget
+			ch.trackSupportedCqlVersions(responseFromOriginCassandra, responseFromTargetCassandra)
+			return ch.refreshSupportedCache(responseFromOriginCassandra, responseFromTargetCassandra), common.ClusterTypeTarget
 		} else if request.Header.OpCode == primitive.OpCodePrepare {
 			// special case for PREPARE requests to always return ORIGIN, even though the default handling for "BOTH" requests would be enough
 			return responseFromOriginCassandra, common.ClusterTypeOrigin
 		} else {
-			if ch.primaryCluster == common.ClusterTypeTarget {
-				log.Tracef("Aggregated response: both successes, sending back %v response with opcode %d",
+			if primaryCluster == common.ClusterTypeTarget {
+				logger.Tracef("Aggregated response: both successes, sending back %v response with opcode %d",
 					common.ClusterTypeTarget, responseFromTargetCassandra.Header.OpCode)
-				return responseFromTargetCassandra, common.ClusterTypeTarget
+				return reconcileCustomPayload(ch.codec.get(), responseFromOriginCassandra, responseFromTargetCassandra), common.ClusterTypeTarget
 			} else {
-				log.Tracef("Aggregated response: both successes, sending back %v response with opcode %d",
+				logger.Tracef("Aggregated response: both successes, sending back %v response with opcode %d",
 					common.ClusterTypeOrigin, originOpCode)
 				return responseFromOriginCassandra, common.ClusterTypeOrigin
 			}
@@ -1825,25 +2647,52 @@ func (ch *ClientHandler) aggregateAndTrackResponses(
 	}
 
 	proxyMetrics := ch.metricHandler.GetProxyMetrics()
+	if requestInfo.ShouldBeTrackedInMetrics() &&
+		isUnloggedBatchPartialDivergence(ch.codec.get(), request, responseFromOriginCassandra, responseFromTargetCassandra) {
+		proxyMetrics.UnloggedBatchPartialDivergences.Add(1)
+	}
+
 	if !isResponseSuccessful(responseFromOriginCassandra) && !isResponseSuccessful(responseFromTargetCassandra) {
-		log.Debugf("Aggregated response: both failures, sending back %v response with opcode %d",
+		logger.Debugf("Aggregated response: both failures, sending back %v response with opcode %d",
 			common.ClusterTypeOrigin, originOpCode)
 		if requestInfo.ShouldBeTrackedInMetrics() {
 			proxyMetrics.FailedWritesOnBoth.Add(1)
+			ch.trackMismatchedWriteErrors(responseFromOriginCassandra, responseFromTargetCassandra)
 		}
 		return responseFromOriginCassandra, common.ClusterTypeOrigin
 	}
 
+	if ch.conf.TreatAlreadyExistsAsSuccess {
+		if !isResponseSuccessful(responseFromOriginCassandra) && isAlreadyExistsError(ch.codec.get(), responseFromOriginCassandra) {
+			logger.Debugf("Aggregated response: AlreadyExists on %v is ignored because the request succeeded on %v, "+
+				"sending back %v response with opcode %d", common.ClusterTypeOrigin, common.ClusterTypeTarget,
+				common.ClusterTypeTarget, responseFromTargetCassandra.Header.OpCode)
+			if requestInfo.ShouldBeTrackedInMetrics() {
+				proxyMetrics.ToleratedAlreadyExistsOrigin.Add(1)
+			}
+			return responseFromTargetCassandra, common.ClusterTypeTarget
+		}
+		if !isResponseSuccessful(responseFromTargetCassandra) && isAlreadyExistsError(ch.codec.get(), responseFromTargetCassandra) {
+			logger.Debugf("Aggregated response: AlreadyExists on %v is ignored because the request succeeded on %v, "+
+				"sending back %v response with opcode %d", common.ClusterTypeTarget, common.ClusterTypeOrigin,
+				common.ClusterTypeOrigin, originOpCode)
+			if requestInfo.ShouldBeTrackedInMetrics() {
+				proxyMetrics.ToleratedAlreadyExistsTarget.Add(1)
+			}
+			return responseFromOriginCassandra, common.ClusterTypeOrigin
+		}
+	}
+
 	// if either response is a failure, the failure "wins" --> return the failed response
 	if !isResponseSuccessful(responseFromOriginCassandra) {
-		log.Debugf("Aggregated response: failure only on %v, sending back %v response with opcode %d",
+		logger.Debugf("Aggregated response: failure only on %v, sending back %v response with opcode %d",
 			common.ClusterTypeOrigin, common.ClusterTypeOrigin, originOpCode)
 		if requestInfo.ShouldBeTrackedInMetrics() {
 			proxyMetrics.FailedWritesOnOrigin.Add(1)
 		}
 		return responseFromOriginCassandra, common.ClusterTypeOrigin
 	} else {
-		log.Debugf("Aggregated response: failure only on %v, sending back %v response with opcode %d",
+		logger.Debugf("Aggregated response: failure only on %v, sending back %v response with opcode %d",
 			common.ClusterTypeTarget, common.ClusterTypeTarget, originOpCode)
 		if requestInfo.ShouldBeTrackedInMetrics() {
 			proxyMetrics.FailedWritesOnTarget.Add(1)
@@ -1852,10 +2701,253 @@ func (ch *ClientHandler) aggregateAndTrackResponses(
 	}
 }
 
+// aggregateMissingResponses aggregates the responses of a request that at least one cluster did not respond to. The
+// missing response is tracked as a failure of its cluster. The response of the other cluster is returned if it is a
+// failure, otherwise a SERVER_ERROR is returned because the request was not confirmed by both clusters.
+func (ch *ClientHandler) aggregateMissingResponses(
+	logger *log.Entry,
+	requestInfo RequestInfo,
+	request *frame.RawFrame,
+	responseFromOriginCassandra *frame.RawFrame,
+	responseFromTargetCassandra *frame.RawFrame) (*frame.RawFrame, common.ClusterType) {
+
+	proxyMetrics := ch.metricHandler.GetProxyMetrics()
+	var missingClusterType common.ClusterType
+	var otherResponse *frame.RawFrame
+	var otherClusterType common.ClusterType
+	switch {
+	case responseFromOriginCassandra == nil && responseFromTargetCassandra == nil:
+		logger.Debugf("Aggregated response: no response from %v and %v, sending back an error",
+			common.ClusterTypeOrigin, common.ClusterTypeTarget)
+		if requestInfo.ShouldBeTrackedInMetrics() {
+			proxyMetrics.FailedWritesOnBoth.Add(1)
+		}
+		return ch.buildMissingResponseError(logger, request, common.ClusterTypeOrigin, common.ClusterTypeTarget)
+	case responseFromOriginCassandra == nil:
+		missingClusterType = common.ClusterTypeOrigin
+		otherResponse, otherClusterType = responseFromTargetCassandra, common.ClusterTypeTarget
+		if requestInfo.ShouldBeTrackedInMetrics() {
+			proxyMetrics.FailedWritesOnOrigin.Add(1)
+		}
+	default:
+		missingClusterType = common.ClusterTypeTarget
+		otherResponse, otherClusterType = responseFromOriginCassandra, common.ClusterTypeOrigin
+		if requestInfo.ShouldBeTrackedInMetrics() {
+			proxyMetrics.FailedWritesOnTarget.Add(1)
+		}
+	}
+
+	if !isResponseSuccessful(otherResponse) {
+		logger.Debugf("Aggregated response: no response from %v and failure on %v, sending back %v response with opcode %d",
+			missingClusterType, otherClusterType, otherClusterType, otherResponse.Header.OpCode)
+		return otherResponse, otherClusterType
+	}
+	logger.Debugf("Aggregated response: no response from %v, sending back an error", missingClusterType)
+	return ch.buildMissingResponseError(logger, request, missingClusterType)
+}
+
+// buildMissingResponseError returns a SERVER_ERROR response for a request that the given clusters did not respond to.
+// If the error can not be encoded then nil is returned.
+func (ch *ClientHandler) buildMissingResponseError(
+	logger *log.Entry, request *frame.RawFrame, clusterTypes ...common.ClusterType) (*frame.RawFrame, common.ClusterType) {
+	clusters := make([]string, 0, len(clusterTypes))
+	for _, clusterType := range clusterTypes {
+		clusters = append(clusters, string(clusterType))
+	}
+	errorFrame := frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.ServerError{
+		ErrorMessage: fmt.Sprintf("Proxy did not receive a response from %v", strings.Join(clusters, " and ")),
+	})
+	errorRawFrame, err := ch.codec.get().ConvertToRawFrame(errorFrame)
+	if err != nil {
+		logger.Errorf("Could not convert server error response to raw frame: %v", err)
+		return nil, common.ClusterTypeNone
+	}
+	return errorRawFrame, clusterTypes[0]
+}
+
+// isUnloggedBatchPartialDivergence returns true if the request is an UNLOGGED batch and at least one of the clusters
+// returned a write timeout or a write failure. Unlike logged batches, the mutations of an unlogged batch are applied
+// independently so these errors mean that the batch may have been partially applied on that cluster and the two
+// clusters may now contain different data (the other cluster either applied the whole batch, none of it or
+// a different part of it). Other errors mean that the batch was not applied at all.
+func isUnloggedBatchPartialDivergence(codec frame.RawCodec, request *frame.RawFrame, originResponse *frame.RawFrame, targetResponse *frame.RawFrame) bool {
+	if request.Header.OpCode != primitive.OpCodeBatch {
+		return false
+	}
+
+	originPartial := isPartialWriteError(codec, originResponse)
+	targetPartial := isPartialWriteError(codec, targetResponse)
+	if !originPartial && !targetPartial {
+		return false
+	}
+
+	body, err := codec.DecodeBody(request.Header, bytes.NewReader(request.Body))
+	if err != nil {
+		log.Warnf("Could not decode BATCH request to check for partial divergence: %v", err)
+		return false
+	}
+	batch, ok := body.Message.(*message.Batch)
+	if !ok || batch.Type != primitive.BatchTypeUnlogged {
+		return false
+	}
+
+	log.Debugf("UNLOGGED batch with stream id %v may have been partially applied (%v partial: %v, %v partial: %v), "+
+		"%v response opcode %d, %v response opcode %d.", request.Header.StreamId,
+		common.ClusterTypeOrigin, originPartial, common.ClusterTypeTarget, targetPartial,
+		common.ClusterTypeOrigin, originResponse.Header.OpCode, common.ClusterTypeTarget, targetResponse.Header.OpCode)
+	return true
+}
+
+// isPartialWriteError returns true if the response is a write timeout or a write failure, i.e. an error after which
+// some of the mutations of the request may have been applied.
+func isPartialWriteError(codec frame.RawCodec, response *frame.RawFrame) bool {
+	if isResponseSuccessful(response) {
+		return false
+	}
+	errorResult, err := decodeErrorResult(codec, response)
+	if err != nil {
+		log.Warnf("Could not check if error response is a write timeout or a write failure: %v", err)
+		return false
+	}
+	errorCode := errorResult.GetErrorCode()
+	return errorCode == primitive.ErrorCodeWriteTimeout || errorCode == primitive.ErrorCodeWriteFailure
+}
+
+// reconcileCustomPayload returns the target response with the custom payload of the origin response if they differ.
+// Origin is the source of truth during a migration so its custom payload is the one that is returned to the client.
+// If the target response can not be modified then it is returned as is.
+func reconcileCustomPayload(codec frame.RawCodec, originResponse *frame.RawFrame, targetResponse *frame.RawFrame) *frame.RawFrame {
+	originHasPayload := originResponse.Header.Flags.Contains(primitive.HeaderFlagCustomPayload)
+	targetHasPayload := targetResponse.Header.Flags.Contains(primitive.HeaderFlagCustomPayload)
+	if !originHasPayload && !targetHasPayload {
+		return targetResponse
+	}
+
+	var originPayload map[string][]byte
+	if originHasPayload {
+		originBody, err := codec.DecodeBody(originResponse.Header, bytes.NewReader(originResponse.Body))
+		if err != nil {
+			log.Warnf("Could not decode %v response to reconcile custom payloads, "+
+				"returning %v response as is: %v", common.ClusterTypeOrigin, common.ClusterTypeTarget, err)
+			return targetResponse
+		}
+		originPayload = originBody.CustomPayload
+	}
+
+	decodedTargetResponse, err := codec.ConvertFromRawFrame(targetResponse)
+	if err != nil {
+		log.Warnf("Could not decode %v response to reconcile custom payloads, returning it as is: %v",
+			common.ClusterTypeTarget, err)
+		return targetResponse
+	}
+
+	if customPayloadsEqual(originPayload, decodedTargetResponse.Body.CustomPayload) {
+		return targetResponse
+	}
+
+	log.Debugf("Custom payloads of %v and %v responses differ, returning %v custom payload with %v response.",
+		common.ClusterTypeOrigin, common.ClusterTypeTarget, common.ClusterTypeOrigin, common.ClusterTypeTarget)
+	decodedTargetResponse.SetCustomPayload(originPayload)
+	newTargetResponse, err := codec.ConvertToRawFrame(decodedTargetResponse)
+	if err != nil {
+		log.Warnf("Could not encode %v response after reconciling custom payloads, returning it as is: %v",
+			common.ClusterTypeTarget, err)
+		return targetResponse
+	}
+	return newTargetResponse
+}
+
+func customPayloadsEqual(a map[string][]byte, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		otherValue, ok := b[key]
+		if !ok || !bytes.Equal(value, otherValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// reconcileBatchWarnings returns the response with the warnings of the other response appended if the clusters returned
+// different warnings for a BATCH, e.g. when only one of them warns that the batch exceeds batch_size_warn_threshold,
+// so that the client sees the warnings of both clusters. If the response can not be modified then it is returned as is.
+func (ch *ClientHandler) reconcileBatchWarnings(
+	logger *log.Entry, requestInfo RequestInfo, response *frame.RawFrame, otherResponse *frame.RawFrame) *frame.RawFrame {
+	responseHasWarnings := response.Header.Flags.Contains(primitive.HeaderFlagWarning)
+	otherHasWarnings := otherResponse.Header.Flags.Contains(primitive.HeaderFlagWarning)
+	if !responseHasWarnings && !otherHasWarnings {
+		return response
+	}
+
+	var otherWarnings []string
+	if otherHasWarnings {
+		otherBody, err := ch.codec.get().DecodeBody(otherResponse.Header, bytes.NewReader(otherResponse.Body))
+		if err != nil {
+			logger.Warnf("Could not decode BATCH response to reconcile warnings, returning the other response as is: %v", err)
+			return response
+		}
+		otherWarnings = otherBody.Warnings
+	}
+
+	decodedResponse, err := ch.codec.get().ConvertFromRawFrame(response)
+	if err != nil {
+		logger.Warnf("Could not decode BATCH response to reconcile warnings, returning it as is: %v", err)
+		return response
+	}
+
+	warnings := decodedResponse.Body.Warnings
+	if warningsEqual(warnings, otherWarnings) {
+		return response
+	}
+
+	if requestInfo.ShouldBeTrackedInMetrics() {
+		ch.metricHandler.GetProxyMetrics().BatchWarningDivergences.Add(1)
+	}
+	logger.Debugf("Warnings of %v and %v BATCH responses differ, returning the warnings of both: %v and %v.",
+		common.ClusterTypeOrigin, common.ClusterTypeTarget, warnings, otherWarnings)
+
+	mergedWarnings := append([]string{}, warnings...)
+	existingWarnings := make(map[string]bool, len(warnings))
+	for _, warning := range warnings {
+		existingWarnings[warning] = true
+	}
+	for _, warning := range otherWarnings {
+		if !existingWarnings[warning] {
+			existingWarnings[warning] = true
+			mergedWarnings = append(mergedWarnings, warning)
+		}
+	}
+	if len(mergedWarnings) == len(warnings) {
+		return response
+	}
+
+	decodedResponse.SetWarnings(mergedWarnings)
+	newResponse, err := ch.codec.get().ConvertToRawFrame(decodedResponse)
+	if err != nil {
+		logger.Warnf("Could not encode BATCH response after reconciling warnings, returning it as is: %v", err)
+		return response
+	}
+	return newResponse
+}
+
+func warningsEqual(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // Replaces the credentials in the provided auth frame (which are the Target credentials) with
-// the Origin credentials that are provided to the proxy in the configuration.
+// the Origin credentials that are provided to the proxy in the configuration (or by the CredentialsProvider).
 func (ch *ClientHandler) handleClientCredentials(f *frame.RawFrame) (*frame.RawFrame, error) {
-	parsedAuthFrame, err := defaultCodec.ConvertFromRawFrame(f)
+	parsedAuthFrame, err := ch.codec.get().ConvertFromRawFrame(f)
 	if err != nil {
 		return nil, fmt.Errorf("could not extract auth credentials from frame to start the secondary handshake: %w", err)
 	}
@@ -1879,53 +2971,45 @@ func (ch *ClientHandler) handleClientCredentials(f *frame.RawFrame) (*frame.RawF
 
 	log.Debugf("Successfully extracted credentials from client auth frame: %v", clientCreds)
 
+	originCreds, err := ch.getBackendCredentials(clientCreds.Username, common.ClusterTypeOrigin)
+	if err != nil {
+		return nil, err
+	}
+
+	targetCreds, err := ch.getBackendCredentials(clientCreds.Username, common.ClusterTypeTarget)
+	if err != nil {
+		return nil, err
+	}
+
 	var primaryHandshakeCreds *AuthCredentials
 	if ch.forwardAuthToTarget {
 		// primary handshake is TARGET, secondary is ORIGIN
 
 		if ch.targetCredsOnClientRequest {
-			ch.secondaryHandshakeCreds = &AuthCredentials{
-				Username: ch.originUsername,
-				Password: ch.originPassword,
-			}
+			ch.secondaryHandshakeCreds = originCreds
 		} else {
 			// unreachable code atm, if forwardAuthToTarget is true then targetCredsOnClientRequest is true
 			ch.secondaryHandshakeCreds = clientCreds
-			primaryHandshakeCreds = &AuthCredentials{
-				Username: ch.targetUsername,
-				Password: ch.targetPassword,
-			}
+			primaryHandshakeCreds = targetCreds
 		}
 	} else {
 		// primary handshake is ORIGIN, secondary is TARGET
 
 		if ch.targetCredsOnClientRequest {
 			ch.secondaryHandshakeCreds = clientCreds
-			primaryHandshakeCreds = &AuthCredentials{
-				Username: ch.originUsername,
-				Password: ch.originPassword,
-			}
+			primaryHandshakeCreds = originCreds
 		} else {
-			ch.secondaryHandshakeCreds = &AuthCredentials{
-				Username: ch.targetUsername,
-				Password: ch.targetPassword,
-			}
+			ch.secondaryHandshakeCreds = targetCreds
 		}
 	}
 
 	ch.asyncHandshakeCreds = clientCreds
 	if ch.asyncConnector != nil {
 		if ch.targetCredsOnClientRequest && ch.asyncConnector.clusterType == common.ClusterTypeOrigin {
-			ch.asyncHandshakeCreds = &AuthCredentials{
-				Username: ch.originUsername,
-				Password: ch.originPassword,
-			}
+			ch.asyncHandshakeCreds = originCreds
 		}
 		if !ch.targetCredsOnClientRequest && ch.asyncConnector.clusterType == common.ClusterTypeTarget {
-			ch.asyncHandshakeCreds = &AuthCredentials{
-				Username: ch.targetUsername,
-				Password: ch.targetPassword,
-			}
+			ch.asyncHandshakeCreds = targetCreds
 		}
 	}
 
@@ -1936,7 +3020,7 @@ func (ch *ClientHandler) handleClientCredentials(f *frame.RawFrame) (*frame.RawF
 
 	authResponse.Token = primaryHandshakeCreds.Marshal()
 
-	f, err = defaultCodec.ConvertToRawFrame(parsedAuthFrame)
+	f, err = ch.codec.get().ConvertToRawFrame(parsedAuthFrame)
 	if err != nil {
 		return nil, fmt.Errorf("could not convert new auth response to a raw frame, can not proceed with secondary handshake: %w", err)
 	}
@@ -1944,6 +3028,40 @@ func (ch *ClientHandler) handleClientCredentials(f *frame.RawFrame) (*frame.RawF
 	return f, nil
 }
 
+// Returns the credentials that should replace the client credentials on the provided cluster.
+// The CredentialsProvider is checked first, the credentials provided in the configuration are used if
+// there is no mapping for the client username.
+func (ch *ClientHandler) getBackendCredentials(clientUsername string, clusterType common.ClusterType) (*AuthCredentials, error) {
+	if ch.credentialsProvider != nil {
+		creds, err := ch.credentialsProvider.GetCredentials(clientUsername, clusterType)
+		if err != nil {
+			return nil, fmt.Errorf("could not get %v credentials for client user %v: %w", clusterType, clientUsername, err)
+		}
+		if creds != nil {
+			log.Debugf("Using mapped %v credentials for client user %v: %v", clusterType, clientUsername, creds)
+			return creds, nil
+		}
+	}
+
+	if clusterType == common.ClusterTypeOrigin {
+		return &AuthCredentials{
+			Username: ch.originUsername,
+			Password: ch.originPassword,
+		}, nil
+	}
+	return &AuthCredentials{
+		Username: ch.targetUsername,
+		Password: ch.targetPassword,
+	}, nil
+}
+
+// newFrameDecodeContext creates a frameDecodeContext that decodes the frame with the codec of the client connection.
+func (ch *ClientHandler) newFrameDecodeContext(f *frame.RawFrame) *frameDecodeContext {
+	context := NewFrameDecodeContext(f)
+	context.codec = ch.codec
+	return context
+}
+
 func (ch *ClientHandler) LoadCurrentKeyspace() string {
 	ks := ch.currentKeyspaceName.Load()
 	if ks != nil {
@@ -1957,9 +3075,48 @@ func (ch *ClientHandler) StoreCurrentKeyspace(keyspace string) {
 	ch.currentKeyspaceName.Store(keyspace)
 }
 
-func decodeErrorResult(frame *frame.RawFrame) (message.Error, error) {
-	body, err := defaultCodec.DecodeBody(frame.Header, bytes.NewReader(frame.Body))
+// storeStartupOptions initializes the current keyspace with the keyspace set in the STARTUP options (if any)
+// so that the first requests are routed the same way as if the client had sent a USE request.
+// The options are also retained by the cluster connectors so that new connections to the clusters are initialized
+// with the same STARTUP request as the original ones.
+func (ch *ClientHandler) storeStartupOptions(startupRequest *frame.RawFrame) error {
+	decodedFrame, err := ch.codec.get().ConvertFromRawFrame(startupRequest)
+	if err != nil {
+		return fmt.Errorf("could not decode startup request: %w", err)
+	}
+	startup, ok := decodedFrame.Body.Message.(*message.Startup)
+	if !ok {
+		return fmt.Errorf("expected startup message but got %v", decodedFrame.Body.Message)
+	}
+
+	// a STARTUP request without keyspace resets the keyspace of a previous STARTUP request
+	keyspace := getStartupKeyspace(startup)
+	if keyspace != "" {
+		log.Debugf("Client set keyspace %v in STARTUP options.", keyspace)
+	}
+	ch.StoreCurrentKeyspace(keyspace)
+
+	err = ch.compressionBridge.setCompression(startupRequest.Header.Version, startup.GetCompression())
+	if err != nil {
+		return err
+	}
+
+	ch.originCassandraConnector.setStartupOptions(ch.startupOptionsFilter.filter(common.ClusterTypeOrigin, startup.Options))
+	ch.targetCassandraConnector.setStartupOptions(ch.startupOptionsFilter.filter(common.ClusterTypeTarget, startup.Options))
+	if ch.asyncConnector != nil {
+		ch.asyncConnector.setStartupOptions(ch.startupOptionsFilter.filter(ch.asyncConnector.clusterType, startup.Options))
+	}
+	return nil
+}
+
+// decodeErrorResult decodes the body of an error response, responses with an error code that is not part of the
+// protocol specification are decoded as an unknownError.
+func decodeErrorResult(codec frame.RawCodec, frame *frame.RawFrame) (message.Error, error) {
+	body, err := codec.DecodeBody(frame.Header, bytes.NewReader(frame.Body))
 	if err != nil {
+		if unknownErr := decodeUnknownError(frame); unknownErr != nil {
+			return unknownErr, nil
+		}
 		return nil, fmt.Errorf("could not decode error body: %w", err)
 	}
 
@@ -1971,11 +3128,95 @@ func decodeErrorResult(frame *frame.RawFrame) (message.Error, error) {
 	return errorResult, nil
 }
 
+// trackMismatchedWriteErrors logs and meters the error codes of a write that failed on both clusters if they are
+// different (e.g. WriteTimeout on ORIGIN and Unavailable on TARGET), a recurring combination usually points to
+// a systemic issue on one of the clusters.
+func (ch *ClientHandler) trackMismatchedWriteErrors(originResponse *frame.RawFrame, targetResponse *frame.RawFrame) {
+	originError, err := decodeErrorResult(ch.codec.get(), originResponse)
+	if err != nil {
+		log.Warnf("Could not decode error response from %v: %v", common.ClusterTypeOrigin, err)
+		return
+	}
+	targetError, err := decodeErrorResult(ch.codec.get(), targetResponse)
+	if err != nil {
+		log.Warnf("Could not decode error response from %v: %v", common.ClusterTypeTarget, err)
+		return
+	}
+	if originError.GetErrorCode() == targetError.GetErrorCode() {
+		return
+	}
+
+	log.Debugf("Write failed with different errors, %v: %v, %v: %v.",
+		common.ClusterTypeOrigin, originError, common.ClusterTypeTarget, targetError)
+	originLabel := getErrorCodeLabel(originError.GetErrorCode())
+	targetLabel := getErrorCodeLabel(targetError.GetErrorCode())
+	counter, err := ch.metricHandler.GetMismatchedWriteErrorsCounter(originLabel, targetLabel)
+	if err != nil {
+		log.Errorf("Could not track mismatched write errors %v and %v: %v", originLabel, targetLabel, err)
+		return
+	}
+	counter.Add(1)
+}
+
+// getErrorCodeLabel returns the metric label of the error code, codes that are not defined by the protocol are
+// grouped under "other" so that clusters can't create an unbounded number of label values.
+func getErrorCodeLabel(errorCode primitive.ErrorCode) string {
+	switch errorCode {
+	case primitive.ErrorCodeServerError:
+		return "server_error"
+	case primitive.ErrorCodeProtocolError:
+		return "protocol_error"
+	case primitive.ErrorCodeAuthenticationError:
+		return "authentication_error"
+	case primitive.ErrorCodeUnavailable:
+		return "unavailable"
+	case primitive.ErrorCodeOverloaded:
+		return "overloaded"
+	case primitive.ErrorCodeIsBootstrapping:
+		return "is_bootstrapping"
+	case primitive.ErrorCodeTruncateError:
+		return "truncate_error"
+	case primitive.ErrorCodeWriteTimeout:
+		return "write_timeout"
+	case primitive.ErrorCodeReadTimeout:
+		return "read_timeout"
+	case primitive.ErrorCodeReadFailure:
+		return "read_failure"
+	case primitive.ErrorCodeFunctionFailure:
+		return "function_failure"
+	case primitive.ErrorCodeWriteFailure:
+		return "write_failure"
+	case primitive.ErrorCodeSyntaxError:
+		return "syntax_error"
+	case primitive.ErrorCodeUnauthorized:
+		return "unauthorized"
+	case primitive.ErrorCodeInvalid:
+		return "invalid"
+	case primitive.ErrorCodeConfigError:
+		return "config_error"
+	case primitive.ErrorCodeAlreadyExists:
+		return "already_exists"
+	case primitive.ErrorCodeUnprepared:
+		return "unprepared"
+	default:
+		return "other"
+	}
+}
+
+func isAlreadyExistsError(codec frame.RawCodec, response *frame.RawFrame) bool {
+	errorResult, err := decodeErrorResult(codec, response)
+	if err != nil {
+		log.Warnf("Could not check if error response is AlreadyExists: %v", err)
+		return false
+	}
+	return errorResult.GetErrorCode() == primitive.ErrorCodeAlreadyExists
+}
+
 func isResponseSuccessful(response *frame.RawFrame) bool {
 	return response.Header.OpCode != primitive.OpCodeError
 }
 
-func createUnpreparedFrame(errVal *UnpreparedExecuteError) (*frame.RawFrame, error) {
+func createUnpreparedFrame(codec frame.RawCodec, errVal *UnpreparedExecuteError) (*frame.RawFrame, error) {
 	unpreparedMsg := &message.Unprepared{
 		ErrorMessage: fmt.Sprintf("Prepared query with ID %s not found (either the query was not prepared "+
 			"on this host (maybe the host has been restarted?) or you have prepared too many queries and it has "+
@@ -1985,7 +3226,7 @@ func createUnpreparedFrame(errVal *UnpreparedExecuteError) (*frame.RawFrame, err
 	f := frame.NewFrame(errVal.Header.Version, errVal.Header.StreamId, unpreparedMsg)
 	f.Body.TracingId = errVal.Body.TracingId
 
-	rawFrame, err := defaultCodec.ConvertToRawFrame(f)
+	rawFrame, err := codec.ConvertToRawFrame(f)
 	if err != nil {
 		return nil, fmt.Errorf("could not convert unprepared response frame to rawframe: %w", err)
 	}
@@ -2023,11 +3264,12 @@ func storeRequestContext(contextHoldersMap *sync.Map, reqCtx *requestContextImpl
 
 // Updates cluster level error metrics based on the outcome in the response
 func trackClusterErrorMetrics(
+	codec frame.RawCodec,
 	response *frame.RawFrame,
 	connectorType ClusterConnectorType,
 	nodeMetrics *metrics.NodeMetrics) {
 	if !isResponseSuccessful(response) {
-		errorMsg, err := decodeErrorResult(response)
+		errorMsg, err := decodeErrorResult(codec, response)
 		if err != nil {
 			log.Errorf("could not track read response: %v", err)
 			return
@@ -2063,6 +3305,17 @@ func trackClusterErrorMetricsFromErrorMessage(
 		nodeMetricsInstance.WriteFailures.Add(1)
 	case primitive.ErrorCodeUnavailable:
 		nodeMetricsInstance.UnavailableErrors.Add(1)
+	case primitive.ErrorCodeUnauthorized:
+		// usually permissions that were revoked on the cluster after the client connection was authenticated
+		log.Debugf("Recording %v unauthorized error: %v", connectorType, errorMsg)
+		nodeMetricsInstance.UnauthorizedErrors.Add(1)
+	case primitive.ErrorCodeTruncateError:
+		// operational errors are caused by the request or the schema, not by the capacity of the cluster
+		log.Debugf("Recording %v truncate error: %v", connectorType, errorMsg)
+		nodeMetricsInstance.TruncateErrors.Add(1)
+	case primitive.ErrorCodeFunctionFailure:
+		log.Debugf("Recording %v function failure: %v", connectorType, errorMsg)
+		nodeMetricsInstance.FunctionFailures.Add(1)
 	default:
 		log.Debugf("Recording %v other error: %v", connectorType, errorMsg)
 		nodeMetricsInstance.OtherErrors.Add(1)
@@ -2101,6 +3354,7 @@ func forwardAuthToTarget(
 }
 
 // checkUnsupportedProtocolError handles the case where the protocol library throws an error while decoding the version (maybe the client tries to use v1 or v6)
+// and the case where a v5 segment is invalid (e.g. checksum mismatch)
 func checkUnsupportedProtocolError(err error) *message.ProtocolError {
 	protocolVersionErr := &frame.ProtocolVersionErr{}
 	if errors.As(err, &protocolVersionErr) {
@@ -2117,14 +3371,23 @@ func checkUnsupportedProtocolError(err error) *message.ProtocolError {
 		return protocolErrMsg
 	}
 
+	segmentErr := &segmentError{}
+	if errors.As(err, &segmentErr) {
+		return &message.ProtocolError{ErrorMessage: segmentErr.Error()}
+	}
+
 	return nil
 }
 
-// checkProtocolVersion handles the case where the protocol library does not return an error but the proxy does not support a specific version
-func checkProtocolVersion(version primitive.ProtocolVersion) *message.ProtocolError {
+// checkProtocolVersion handles the case where the protocol library does not return an error but the proxy does not support a specific version,
+// v5 is only supported when it is enabled in the configuration
+func checkProtocolVersion(version primitive.ProtocolVersion, protocolV5Enabled bool) *message.ProtocolError {
 	if version < primitive.ProtocolVersion5 || version.IsDse() {
 		return nil
 	}
+	if version == primitive.ProtocolVersion5 && protocolV5Enabled {
+		return nil
+	}
 
 	protocolErrMsg := &message.ProtocolError{
 		ErrorMessage: fmt.Sprintf("Invalid or unsupported protocol version (%d)", version)}
@@ -2132,6 +3395,27 @@ func checkProtocolVersion(version primitive.ProtocolVersion) *message.ProtocolEr
 	return protocolErrMsg
 }
 
+// Returns the gauge that tracks the client connections that negotiated the provided protocol version
+// or nil if the proxy doesn't support the version.
+func getClientConnectionsByVersionGauge(proxyMetrics *metrics.ProxyMetrics, version primitive.ProtocolVersion) metrics.Gauge {
+	switch version {
+	case primitive.ProtocolVersion2:
+		return proxyMetrics.ClientConnectionsV2
+	case primitive.ProtocolVersion3:
+		return proxyMetrics.ClientConnectionsV3
+	case primitive.ProtocolVersion4:
+		return proxyMetrics.ClientConnectionsV4
+	case primitive.ProtocolVersion5:
+		return proxyMetrics.ClientConnectionsV5
+	case primitive.ProtocolVersionDse1:
+		return proxyMetrics.ClientConnectionsDseV1
+	case primitive.ProtocolVersionDse2:
+		return proxyMetrics.ClientConnectionsDseV2
+	default:
+		return nil
+	}
+}
+
 type customResponse struct {
 	originResponse     *frame.RawFrame
 	targetResponse     *frame.RawFrame
@@ -0,0 +1,1111 @@
+package zdmproxy
+
+import (
+	"context"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/prommetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAggregateAndTrackResponses_AlreadyExists(t *testing.T) {
+	createTable := mustEncodeFrame(t, &message.Query{Query: "CREATE TABLE ks.t (a int PRIMARY KEY)"})
+	schemaChange := mustEncodeFrame(t, &message.SchemaChangeResult{
+		ChangeType: primitive.SchemaChangeTypeCreated,
+		Target:     primitive.SchemaChangeTargetTable,
+		Keyspace:   "ks",
+		Object:     "t",
+	})
+	alreadyExists := mustEncodeFrame(t, &message.AlreadyExists{ErrorMessage: "Table ks.t already exists", Keyspace: "ks", Table: "t"})
+	serverError := mustEncodeFrame(t, &message.ServerError{ErrorMessage: "boom"})
+
+	tests := []struct {
+		name                   string
+		treatAlreadyExists     bool
+		originResponse         *frame.RawFrame
+		targetResponse         *frame.RawFrame
+		expectedResponse       *frame.RawFrame
+		expectedCluster        common.ClusterType
+		expectedToleratedOnOC  int64
+		expectedToleratedOnTC  int64
+		expectedFailedOnTarget int64
+	}{
+		{
+			name:                   "target already exists, disabled",
+			treatAlreadyExists:     false,
+			originResponse:         schemaChange,
+			targetResponse:         alreadyExists,
+			expectedResponse:       alreadyExists,
+			expectedCluster:        common.ClusterTypeTarget,
+			expectedFailedOnTarget: 1,
+		},
+		{
+			name:                  "target already exists, enabled",
+			treatAlreadyExists:    true,
+			originResponse:        schemaChange,
+			targetResponse:        alreadyExists,
+			expectedResponse:      schemaChange,
+			expectedCluster:       common.ClusterTypeOrigin,
+			expectedToleratedOnTC: 1,
+		},
+		{
+			name:                  "origin already exists, enabled",
+			treatAlreadyExists:    true,
+			originResponse:        alreadyExists,
+			targetResponse:        schemaChange,
+			expectedResponse:      schemaChange,
+			expectedCluster:       common.ClusterTypeTarget,
+			expectedToleratedOnOC: 1,
+		},
+		{
+			name:               "both already exist, enabled",
+			treatAlreadyExists: true,
+			originResponse:     alreadyExists,
+			targetResponse:     alreadyExists,
+			expectedResponse:   alreadyExists,
+			expectedCluster:    common.ClusterTypeOrigin,
+		},
+		{
+			name:                   "other error on target, enabled",
+			treatAlreadyExists:     true,
+			originResponse:         schemaChange,
+			targetResponse:         serverError,
+			expectedResponse:       serverError,
+			expectedCluster:        common.ClusterTypeTarget,
+			expectedFailedOnTarget: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyMetrics := newFakeProxyMetrics()
+			toleratedOrigin, toleratedTarget, failedOnTarget := &countingCounter{}, &countingCounter{}, &countingCounter{}
+			proxyMetrics.ToleratedAlreadyExistsOrigin = toleratedOrigin
+			proxyMetrics.ToleratedAlreadyExistsTarget = toleratedTarget
+			proxyMetrics.FailedWritesOnTarget = failedOnTarget
+			conf := config.New()
+			conf.TreatAlreadyExistsAsSuccess = tt.treatAlreadyExists
+			ch := &ClientHandler{
+				conf:           conf,
+				primaryCluster: common.ClusterTypeOrigin,
+				metricHandler: metrics.NewMetricHandler(
+					noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+			}
+
+			response, cluster := ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster,
+				NewGenericRequestInfo(forwardToBoth, false, true), createTable, tt.originResponse, tt.targetResponse)
+			require.Equal(t, tt.expectedResponse, response)
+			require.Equal(t, tt.expectedCluster, cluster)
+			require.Equal(t, tt.expectedToleratedOnOC, toleratedOrigin.get())
+			require.Equal(t, tt.expectedToleratedOnTC, toleratedTarget.get())
+			require.Equal(t, tt.expectedFailedOnTarget, failedOnTarget.get())
+		})
+	}
+}
+
+func TestAggregateAndTrackResponses_UnloggedBatchPartialDivergence(t *testing.T) {
+	newBatch := func(batchType primitive.BatchType) *frame.RawFrame {
+		return mustEncodeFrame(t, &message.Batch{
+			Type: batchType,
+			Children: []*message.BatchChild{
+				{QueryOrId: "INSERT INTO ks.t (a) VALUES (1)"},
+				{QueryOrId: "INSERT INTO ks.t2 (a) VALUES (1)"},
+			},
+		})
+	}
+	void := mustEncodeFrame(t, &message.VoidResult{})
+	writeTimeout := mustEncodeFrame(t, &message.WriteTimeout{
+		ErrorMessage: "timeout", Consistency: primitive.ConsistencyLevelQuorum, Received: 1, BlockFor: 2,
+		WriteType: primitive.WriteTypeUnloggedBatch})
+	writeFailure := mustEncodeFrame(t, &message.WriteFailure{
+		ErrorMessage: "failure", Consistency: primitive.ConsistencyLevelQuorum, Received: 1, BlockFor: 2, NumFailures: 1,
+		WriteType: primitive.WriteTypeUnloggedBatch})
+	unavailable := mustEncodeFrame(t, &message.Unavailable{
+		ErrorMessage: "unavailable", Consistency: primitive.ConsistencyLevelQuorum, Required: 2, Alive: 1})
+
+	tests := []struct {
+		name               string
+		request            *frame.RawFrame
+		originResponse     *frame.RawFrame
+		targetResponse     *frame.RawFrame
+		expectedDivergence int64
+	}{
+		{"both succeeded", newBatch(primitive.BatchTypeUnlogged), void, void, 0},
+		{"write timeout on target", newBatch(primitive.BatchTypeUnlogged), void, writeTimeout, 1},
+		{"write failure on origin", newBatch(primitive.BatchTypeUnlogged), writeFailure, void, 1},
+		{"write timeout on both", newBatch(primitive.BatchTypeUnlogged), writeTimeout, writeTimeout, 1},
+		{"unavailable and write timeout", newBatch(primitive.BatchTypeUnlogged), unavailable, writeTimeout, 1},
+		{"unavailable on target", newBatch(primitive.BatchTypeUnlogged), void, unavailable, 0},
+		{"logged batch", newBatch(primitive.BatchTypeLogged), void, writeTimeout, 0},
+		{"not a batch", mustEncodeFrame(t, &message.Query{Query: "INSERT INTO ks.t (a) VALUES (1)"}), void, writeTimeout, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyMetrics := newFakeProxyMetrics()
+			divergences := &countingCounter{}
+			proxyMetrics.UnloggedBatchPartialDivergences = divergences
+			ch := &ClientHandler{
+				conf:           config.New(),
+				primaryCluster: common.ClusterTypeOrigin,
+				metricHandler: metrics.NewMetricHandler(
+					noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+			}
+
+			ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster, NewBatchRequestInfo(nil), tt.request, tt.originResponse, tt.targetResponse)
+			require.Equal(t, tt.expectedDivergence, divergences.get())
+		})
+	}
+}
+
+func TestAggregateAndTrackResponses_BatchWarnings(t *testing.T) {
+	batch := mustEncodeFrame(t, &message.Batch{
+		Type:     primitive.BatchTypeLogged,
+		Children: []*message.BatchChild{{QueryOrId: "INSERT INTO ks.t (a) VALUES (1)"}},
+	})
+	newVoid := func(warnings ...string) *frame.RawFrame {
+		f := frame.NewFrame(primitive.ProtocolVersion4, 0, &message.VoidResult{})
+		if len(warnings) > 0 {
+			f.SetWarnings(warnings)
+		}
+		rawFrame, err := defaultCodec.ConvertToRawFrame(f)
+		require.Nil(t, err)
+		return rawFrame
+	}
+	batchTooLarge := "Batch for [ks.t] is of size 6.0KiB, exceeding specified threshold of 5.0KiB by 1.0KiB."
+	otherWarning := "Aggregation query used without partition key"
+
+	tests := []struct {
+		name               string
+		primaryCluster     common.ClusterType
+		request            *frame.RawFrame
+		originResponse     *frame.RawFrame
+		targetResponse     *frame.RawFrame
+		expectedWarnings   []string
+		expectedDivergence int64
+	}{
+		{"no warnings", common.ClusterTypeOrigin, batch, newVoid(), newVoid(), nil, 0},
+		{"same warnings", common.ClusterTypeOrigin, batch, newVoid(batchTooLarge), newVoid(batchTooLarge), []string{batchTooLarge}, 0},
+		{"warning only on target", common.ClusterTypeOrigin, batch, newVoid(), newVoid(batchTooLarge), []string{batchTooLarge}, 1},
+		{"warning only on origin", common.ClusterTypeTarget, batch, newVoid(batchTooLarge), newVoid(), []string{batchTooLarge}, 1},
+		{"different warnings", common.ClusterTypeOrigin, batch,
+			newVoid(otherWarning), newVoid(batchTooLarge, otherWarning), []string{otherWarning, batchTooLarge}, 1},
+		{"not a batch", common.ClusterTypeOrigin, mustEncodeFrame(t, &message.Query{Query: "INSERT INTO ks.t (a) VALUES (1)"}),
+			newVoid(), newVoid(batchTooLarge), nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyMetrics := newFakeProxyMetrics()
+			divergences := &countingCounter{}
+			proxyMetrics.BatchWarningDivergences = divergences
+			ch := &ClientHandler{
+				conf:           config.New(),
+				primaryCluster: tt.primaryCluster,
+				metricHandler: metrics.NewMetricHandler(
+					noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+			}
+
+			response, cluster := ch.aggregateAndTrackResponses(
+				newRequestLogger(0), ch.primaryCluster, NewBatchRequestInfo(nil), tt.request, tt.originResponse, tt.targetResponse)
+			require.Equal(t, tt.primaryCluster, cluster)
+			decodedResponse, err := defaultCodec.ConvertFromRawFrame(response)
+			require.Nil(t, err)
+			require.Equal(t, tt.expectedWarnings, decodedResponse.Body.Warnings)
+			require.IsType(t, &message.VoidResult{}, decodedResponse.Body.Message)
+			require.Equal(t, tt.expectedDivergence, divergences.get())
+		})
+	}
+}
+
+func TestAggregateAndTrackResponses_MismatchedWriteErrors(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	proxyMetrics := newFakeProxyMetrics()
+	failedOnBoth := &countingCounter{}
+	proxyMetrics.FailedWritesOnBoth = failedOnBoth
+	ch := &ClientHandler{
+		conf:           config.New(),
+		primaryCluster: common.ClusterTypeOrigin,
+		metricHandler: metrics.NewMetricHandler(
+			prommetrics.NewPrometheusMetricFactory(registry), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+
+	insert := mustEncodeFrame(t, &message.Query{Query: "INSERT INTO ks.t (a) VALUES (1)"})
+	writeTimeout := mustEncodeFrame(t, &message.WriteTimeout{
+		ErrorMessage: "timeout", Consistency: primitive.ConsistencyLevelQuorum, Received: 1, BlockFor: 2,
+		WriteType: primitive.WriteTypeSimple})
+	unavailable := mustEncodeFrame(t, &message.Unavailable{
+		ErrorMessage: "unavailable", Consistency: primitive.ConsistencyLevelQuorum, Required: 2, Alive: 1})
+	overloaded := mustEncodeFrame(t, &message.Overloaded{ErrorMessage: "overloaded"})
+	for _, responses := range [][]*frame.RawFrame{
+		{writeTimeout, unavailable},
+		{writeTimeout, unavailable},
+		{unavailable, overloaded},
+		{overloaded, overloaded},
+		{mustEncodeFrame(t, &message.VoidResult{}), unavailable},
+	} {
+		response, cluster := ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster,
+			NewGenericRequestInfo(forwardToBoth, false, true), insert, responses[0], responses[1])
+		require.Equal(t, responses[0].Header.OpCode == primitive.OpCodeError, cluster == common.ClusterTypeOrigin)
+		require.Equal(t, primitive.OpCodeError, response.Header.OpCode)
+	}
+	require.Equal(t, int64(4), failedOnBoth.get())
+
+	metricFamilies, err := registry.Gather()
+	require.Nil(t, err)
+	require.Len(t, metricFamilies, 1)
+	require.Equal(t, "zdm_proxy_mismatched_write_errors_total", metricFamilies[0].GetName())
+	counts := map[string]float64{}
+	for _, m := range metricFamilies[0].GetMetric() {
+		labels := map[string]string{}
+		for _, label := range m.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		counts[labels["origin_error"]+"/"+labels["target_error"]] = m.GetCounter().GetValue()
+	}
+	require.Equal(t, map[string]float64{
+		"write_timeout/unavailable": 2,
+		"unavailable/overloaded":    1,
+	}, counts)
+
+	require.Equal(t, "other", getErrorCodeLabel(primitive.ErrorCode(0x1234)))
+}
+
+// A dual write that timed out on a cluster is finished without the response of that cluster, the missing response is
+// handled as a failure of that cluster.
+func TestComputeClientResponse_MissingResponse(t *testing.T) {
+	insert := mustEncodeFrame(t, &message.Query{Query: "INSERT INTO ks.t (a) VALUES (1)"})
+	insert.Header.StreamId = 5
+	void := mustEncodeFrame(t, &message.VoidResult{})
+	overloaded := mustEncodeFrame(t, &message.Overloaded{ErrorMessage: "overloaded"})
+
+	tests := []struct {
+		name              string
+		writeConfirmation common.DualWriteConfirmation
+		originResponse    *frame.RawFrame
+		targetResponse    *frame.RawFrame
+		expectedResponse  *frame.RawFrame
+		expectedCluster   common.ClusterType
+		expectedMessage   string
+		expectedOnOrigin  int64
+		expectedOnTarget  int64
+		expectedOnBoth    int64
+	}{
+		{"no response from target", common.DualWriteConfirmationUndefined, void, nil, nil,
+			common.ClusterTypeTarget, "Proxy did not receive a response from TARGET", 0, 1, 0},
+		{"no response from origin", common.DualWriteConfirmationUndefined, nil, void, nil,
+			common.ClusterTypeOrigin, "Proxy did not receive a response from ORIGIN", 1, 0, 0},
+		{"no response from target and failure on origin", common.DualWriteConfirmationUndefined, overloaded, nil,
+			overloaded, common.ClusterTypeOrigin, "", 0, 1, 0},
+		{"no response from both", common.DualWriteConfirmationUndefined, nil, nil, nil,
+			common.ClusterTypeOrigin, "Proxy did not receive a response from ORIGIN and TARGET", 0, 0, 1},
+		{"no response from primary with primary confirmation", common.DualWriteConfirmationPrimary, nil, void, nil,
+			common.ClusterTypeOrigin, "Proxy did not receive a response from ORIGIN", 1, 0, 0},
+		{"no response from target and failure on origin with either confirmation", common.DualWriteConfirmationEither,
+			overloaded, nil, overloaded, common.ClusterTypeOrigin, "", 0, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyMetrics := newFakeProxyMetrics()
+			failedOnOrigin, failedOnTarget, failedOnBoth := &countingCounter{}, &countingCounter{}, &countingCounter{}
+			proxyMetrics.FailedWritesOnOrigin = failedOnOrigin
+			proxyMetrics.FailedWritesOnTarget = failedOnTarget
+			proxyMetrics.FailedWritesOnBoth = failedOnBoth
+			ch := &ClientHandler{
+				conf:           config.New(),
+				primaryCluster: common.ClusterTypeOrigin,
+				metricHandler: metrics.NewMetricHandler(
+					noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+			}
+
+			reqCtx := NewRequestContext(insert, NewGenericRequestInfo(forwardToBoth, false, true), time.Now(), nil)
+			reqCtx.primaryCluster = ch.primaryCluster
+			reqCtx.writeConfirmation = tt.writeConfirmation
+			reqCtx.originResponse = tt.originResponse
+			reqCtx.targetResponse = tt.targetResponse
+
+			response, cluster, err := ch.computeClientResponse(reqCtx)
+			require.Nil(t, err)
+			require.Equal(t, tt.expectedCluster, cluster)
+			if tt.expectedResponse != nil {
+				require.Same(t, tt.expectedResponse, response)
+			} else {
+				require.NotNil(t, response)
+				require.Equal(t, insert.Header.StreamId, response.Header.StreamId)
+				decodedResponse, err := defaultCodec.ConvertFromRawFrame(response)
+				require.Nil(t, err)
+				require.Equal(t, &message.ServerError{ErrorMessage: tt.expectedMessage}, decodedResponse.Body.Message)
+			}
+			require.Equal(t, tt.expectedOnOrigin, failedOnOrigin.get())
+			require.Equal(t, tt.expectedOnTarget, failedOnTarget.get())
+			require.Equal(t, tt.expectedOnBoth, failedOnBoth.get())
+		})
+	}
+}
+
+func TestHandleExecuteRequest_DistinctPreparedIdShapes(t *testing.T) {
+	originId := []byte{143, 7, 36, 50, 225, 104, 157, 89, 199, 177, 239, 231, 82, 201, 142, 253}
+	targetId := []byte{1, 2, 3, 4}
+	preparedData := NewPreparedData(
+		&message.PreparedResult{PreparedQueryId: originId, ResultMetadataId: []byte{1, 1, 1, 1, 1, 1, 1, 1}},
+		&message.PreparedResult{PreparedQueryId: targetId, ResultMetadataId: []byte{2, 2}},
+		NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "INSERT INTO ks.t (a) VALUES (?)", ""))
+
+	tests := []struct {
+		name                     string
+		version                  primitive.ProtocolVersion
+		resultMetadataId         []byte
+		expectedResultMetadataId []byte
+	}{
+		{"v4", primitive.ProtocolVersion4, nil, nil},
+		{"v5", primitive.ProtocolVersion5, []byte{1, 1, 1, 1, 1, 1, 1, 1}, []byte{2, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executeMsg := &message.Execute{
+				QueryId:          originId,
+				ResultMetadataId: tt.resultMetadataId,
+				Options:          &message.QueryOptions{PositionalValues: []*primitive.Value{primitive.NewValue([]byte{0, 0, 0, 1})}},
+			}
+			request, err := defaultCodec.ConvertToRawFrame(frame.NewFrame(tt.version, 0, executeMsg))
+			require.Nil(t, err)
+
+			ch := &ClientHandler{}
+			_, originRequest, targetRequest, err := ch.handleExecuteRequest(
+				NewExecuteRequestInfo(preparedData), NewFrameDecodeContext(request), "")
+			require.Nil(t, err)
+			require.Equal(t, request, originRequest)
+
+			decodedOrigin, err := defaultCodec.ConvertFromRawFrame(originRequest)
+			require.Nil(t, err)
+			require.Equal(t, originId, decodedOrigin.Body.Message.(*message.Execute).QueryId)
+			require.Equal(t, tt.resultMetadataId, decodedOrigin.Body.Message.(*message.Execute).ResultMetadataId)
+
+			decodedTarget, err := defaultCodec.ConvertFromRawFrame(targetRequest)
+			require.Nil(t, err)
+			targetExecute := decodedTarget.Body.Message.(*message.Execute)
+			require.Equal(t, targetId, targetExecute.QueryId)
+			require.Equal(t, tt.expectedResultMetadataId, targetExecute.ResultMetadataId)
+			require.Equal(t, executeMsg.Options, targetExecute.Options)
+		})
+	}
+}
+
+func TestHandleBatchRequest_MixedChildren(t *testing.T) {
+	newPreparedData := func(originId []byte, targetId []byte, query string) PreparedData {
+		return NewPreparedData(
+			&message.PreparedResult{PreparedQueryId: originId},
+			&message.PreparedResult{PreparedQueryId: targetId},
+			NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, query, ""))
+	}
+	firstData := newPreparedData([]byte{1, 1}, []byte{10, 10, 10}, "INSERT INTO ks.t (a) VALUES (?)")
+	secondData := newPreparedData([]byte{2, 2}, []byte{20, 20, 20}, "DELETE FROM ks.t WHERE a = ?")
+	missingTargetData := newPreparedData([]byte{3, 3}, nil, "UPDATE ks.t SET b = 1 WHERE a = ?")
+
+	value := []*primitive.Value{primitive.NewValue([]byte{0, 0, 0, 1})}
+	batchMsg := &message.Batch{
+		Type: primitive.BatchTypeLogged,
+		Children: []*message.BatchChild{
+			{QueryOrId: []byte{1, 1}, Values: value},
+			{QueryOrId: "INSERT INTO ks.t (a) VALUES (2)"},
+			{QueryOrId: []byte{2, 2}, Values: value},
+		},
+	}
+	request := mustEncodeFrame(t, batchMsg)
+
+	t.Run("prepared children are translated for target", func(t *testing.T) {
+		ch := &ClientHandler{}
+		originRequest, targetRequest, err := ch.handleBatchRequest(
+			NewBatchRequestInfo(map[int]PreparedData{0: firstData, 2: secondData}), NewFrameDecodeContext(request))
+		require.Nil(t, err)
+		require.Equal(t, request, originRequest)
+
+		decodedTarget, err := defaultCodec.ConvertFromRawFrame(targetRequest)
+		require.Nil(t, err)
+		targetBatch := decodedTarget.Body.Message.(*message.Batch)
+		require.Equal(t, 3, len(targetBatch.Children))
+		require.Equal(t, []byte{10, 10, 10}, targetBatch.Children[0].QueryOrId)
+		require.Equal(t, "INSERT INTO ks.t (a) VALUES (2)", targetBatch.Children[1].QueryOrId)
+		require.Equal(t, []byte{20, 20, 20}, targetBatch.Children[2].QueryOrId)
+		require.Equal(t, value, targetBatch.Children[2].Values)
+	})
+
+	t.Run("child without target prepared id", func(t *testing.T) {
+		ch := &ClientHandler{}
+		_, _, err := ch.handleBatchRequest(
+			NewBatchRequestInfo(map[int]PreparedData{0: firstData, 2: missingTargetData}), NewFrameDecodeContext(request))
+		unpreparedErr, ok := err.(*UnpreparedExecuteError)
+		require.True(t, ok, "expected UnpreparedExecuteError but got %v", err)
+		require.Equal(t, []byte{2, 2}, unpreparedErr.preparedId)
+	})
+}
+
+func TestHandleUnexpectedResponse(t *testing.T) {
+	unprepared := mustEncodeFrame(t, &message.Unprepared{ErrorMessage: "unprepared", Id: []byte{1, 2, 3, 4}})
+
+	tests := []struct {
+		name             string
+		mode             common.UnexpectedResponseMode
+		expectedResponse message.Message
+	}{
+		{"error", common.UnexpectedResponseModeError, &message.ServerError{}},
+		{"passthrough", common.UnexpectedResponseModePassthrough, &message.Unprepared{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyMetrics := newFakeProxyMetrics()
+			unexpectedResponses := &countingCounter{}
+			proxyMetrics.UnexpectedResponses = unexpectedResponses
+			ch := &ClientHandler{
+				preparedStatementCache: NewPreparedStatementCache(0),
+				unexpectedResponseMode: tt.mode,
+				metricHandler: metrics.NewMetricHandler(
+					noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+			}
+
+			// the prepared id in the target response is not in the cache
+			_, err := ch.processClientResponse(unprepared, common.ClusterTypeTarget, nil)
+			require.NotNil(t, err)
+
+			response, err := ch.handleUnexpectedResponse(unprepared, common.ClusterTypeTarget, err)
+			require.Nil(t, err)
+			require.Equal(t, int64(1), unexpectedResponses.get())
+			require.Equal(t, unprepared.Header.StreamId, response.Header.StreamId)
+			decoded, err := defaultCodec.ConvertFromRawFrame(response)
+			require.Nil(t, err)
+			require.IsType(t, tt.expectedResponse, decoded.Body.Message)
+		})
+	}
+}
+
+func TestExecuteRequest_StreamIdReusedAfterTimeout(t *testing.T) {
+	ch := &ClientHandler{
+		conf:                     config.New(),
+		requestContextHolders:    &sync.Map{},
+		originCassandraConnector: &ClusterConnector{outstandingStreamIds: newOutstandingStreamIds(time.Minute)},
+		targetCassandraConnector: &ClusterConnector{outstandingStreamIds: newOutstandingStreamIds(time.Minute)},
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, newFakeProxyMetrics(), nil, nil, nil),
+	}
+	request := mustEncodeFrame(t, &message.Query{Query: "INSERT INTO ks.t (a) VALUES (1)", Options: &message.QueryOptions{}})
+	request.Header.StreamId = 42
+
+	// a write timed out after ORIGIN responded so only TARGET may still respond to it
+	timedOutReqCtx := NewRequestContext(request, NewGenericRequestInfo(forwardToBoth, false, true), time.Now(), nil)
+	require.True(t, ch.reserveStreamIds(timedOutReqCtx, forwardToBoth))
+	timedOutReqCtx.originResponse = mustEncodeFrame(t, &message.VoidResult{})
+	ch.expireStreamIds(timedOutReqCtx)
+	require.True(t, ch.originCassandraConnector.outstandingStreamIds.remove(42))
+
+	// the client reuses the stream id before TARGET responded to the request that timed out
+	responseChannel := make(chan *customResponse, 1)
+	err := ch.executeRequest(
+		NewFrameDecodeContext(request), NewGenericRequestInfo(forwardToBoth, false, true), "",
+		time.Now(), responseChannel, time.Minute)
+	require.Nil(t, err)
+
+	response := <-responseChannel
+	decodedResponse, err := defaultCodec.ConvertFromRawFrame(response.aggregatedResponse)
+	require.Nil(t, err)
+	require.Equal(t, int16(42), decodedResponse.Header.StreamId)
+	overloaded, ok := decodedResponse.Body.Message.(*message.Overloaded)
+	require.True(t, ok, "expected OVERLOADED but got %v", decodedResponse.Body.Message)
+	require.Equal(t, "The stream id is still used by a request that timed out, please retry.", overloaded.ErrorMessage)
+
+	// the request was not forwarded and nothing is reserved for it
+	require.Nil(t, getOrCreateRequestContextHolder(ch.requestContextHolders, request.Header.StreamId).Get())
+	require.False(t, ch.originCassandraConnector.outstandingStreamIds.remove(42))
+
+	// the late response of TARGET is dropped and the stream id can be used again
+	require.False(t, ch.targetCassandraConnector.outstandingStreamIds.remove(42))
+	reqCtx := NewRequestContext(request, NewGenericRequestInfo(forwardToBoth, false, true), time.Now(), nil)
+	require.True(t, ch.reserveStreamIds(reqCtx, forwardToBoth))
+}
+
+func TestExecuteRequest_UnknownForwardDecision(t *testing.T) {
+	proxyMetrics := newFakeProxyMetrics()
+	unknownForwardDecisions := &countingCounter{}
+	proxyMetrics.UnknownForwardDecisions = unknownForwardDecisions
+	ch := &ClientHandler{
+		conf:                  config.New(),
+		requestContextHolders: &sync.Map{},
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+	request := mustEncodeFrame(t, &message.Query{Query: "SELECT * FROM ks.t", Options: &message.QueryOptions{}})
+	request.Header.StreamId = 42
+
+	responseChannel := make(chan *customResponse, 1)
+	err := ch.executeRequest(
+		NewFrameDecodeContext(request), NewGenericRequestInfo(forwardDecision("invalid"), false, true), "",
+		time.Now(), responseChannel, time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, int64(1), unknownForwardDecisions.get())
+
+	response := <-responseChannel
+	decodedResponse, err := defaultCodec.ConvertFromRawFrame(response.aggregatedResponse)
+	require.Nil(t, err)
+	require.Equal(t, int16(42), decodedResponse.Header.StreamId)
+	serverErr, ok := decodedResponse.Body.Message.(*message.ServerError)
+	require.True(t, ok, "expected SERVER_ERROR but got %v", decodedResponse.Body.Message)
+	require.Equal(t, "Proxy could not determine where to forward the request (unknown forward decision invalid)", serverErr.ErrorMessage)
+
+	// the request was not forwarded so there is no request context waiting for a response
+	_, found := ch.requestContextHolders.Load(request.Header.StreamId)
+	require.False(t, found)
+}
+
+func TestProcessClientResponse_UnpreparedAfterPsCacheMiss(t *testing.T) {
+	// the EXECUTE was forwarded to target with the prepared id that the client sent
+	unprepared := mustEncodeFrame(t, &message.Unprepared{ErrorMessage: "unprepared", Id: []byte{1, 2, 3, 4}})
+
+	for _, psCache := range []*PreparedStatementCache{nil, NewPreparedStatementCache(0)} {
+		ch := &ClientHandler{preparedStatementCache: psCache, psCacheMissMode: common.PsCacheMissModeUnprepared}
+		_, err := ch.processClientResponse(unprepared, common.ClusterTypeTarget, nil)
+		require.NotNil(t, err)
+
+		ch.psCacheMissMode = common.PsCacheMissModeForward
+		response, err := ch.processClientResponse(unprepared, common.ClusterTypeTarget, nil)
+		require.Nil(t, err)
+		decoded, err := defaultCodec.ConvertFromRawFrame(response)
+		require.Nil(t, err)
+		unpreparedMsg, ok := decoded.Body.Message.(*message.Unprepared)
+		require.True(t, ok, decoded.Body.Message)
+		require.Equal(t, []byte{1, 2, 3, 4}, unpreparedMsg.Id)
+	}
+}
+
+func TestTrackClusterErrorMetrics_Unauthorized(t *testing.T) {
+	newNodeMetricsInstance := func() (*metrics.NodeMetricsInstance, *countingCounter, *countingCounter) {
+		unauthorized, other := &countingCounter{}, &countingCounter{}
+		return &metrics.NodeMetricsInstance{UnauthorizedErrors: unauthorized, OtherErrors: other}, unauthorized, other
+	}
+	originMetrics, originUnauthorized, originOther := newNodeMetricsInstance()
+	targetMetrics, targetUnauthorized, targetOther := newNodeMetricsInstance()
+	nodeMetrics := &metrics.NodeMetrics{OriginMetrics: originMetrics, TargetMetrics: targetMetrics}
+
+	unauthorized := mustEncodeFrame(t, &message.Unauthorized{ErrorMessage: "User app has no MODIFY permission on <table ks.t>"})
+	trackClusterErrorMetrics(defaultCodec, unauthorized, ClusterConnectorTypeTarget, nodeMetrics)
+	trackClusterErrorMetrics(defaultCodec, unauthorized, ClusterConnectorTypeTarget, nodeMetrics)
+	trackClusterErrorMetrics(defaultCodec, unauthorized, ClusterConnectorTypeOrigin, nodeMetrics)
+	trackClusterErrorMetrics(defaultCodec, mustEncodeFrame(t, &message.ServerError{ErrorMessage: "boom"}), ClusterConnectorTypeOrigin, nodeMetrics)
+
+	require.Equal(t, int64(1), originUnauthorized.get())
+	require.Equal(t, int64(1), originOther.get())
+	require.Equal(t, int64(2), targetUnauthorized.get())
+	require.Equal(t, int64(0), targetOther.get())
+}
+
+func TestTrackClusterErrorMetrics_OperationalErrors(t *testing.T) {
+	type errorCounters struct {
+		truncate, functionFailure, readFailure, writeFailure, overloaded, other *countingCounter
+	}
+	newNodeMetricsInstance := func() (*metrics.NodeMetricsInstance, *errorCounters) {
+		counters := &errorCounters{&countingCounter{}, &countingCounter{}, &countingCounter{},
+			&countingCounter{}, &countingCounter{}, &countingCounter{}}
+		return &metrics.NodeMetricsInstance{
+			TruncateErrors:   counters.truncate,
+			FunctionFailures: counters.functionFailure,
+			ReadFailures:     counters.readFailure,
+			WriteFailures:    counters.writeFailure,
+			OverloadedErrors: counters.overloaded,
+			OtherErrors:      counters.other,
+		}, counters
+	}
+	originMetrics, originCounters := newNodeMetricsInstance()
+	targetMetrics, targetCounters := newNodeMetricsInstance()
+	asyncMetrics, asyncCounters := newNodeMetricsInstance()
+	nodeMetrics := &metrics.NodeMetrics{OriginMetrics: originMetrics, TargetMetrics: targetMetrics, AsyncMetrics: asyncMetrics}
+
+	truncateError := mustEncodeFrame(t, &message.TruncateError{ErrorMessage: "Error during truncate: timeout"})
+	functionFailure := mustEncodeFrame(t, &message.FunctionFailure{
+		ErrorMessage: "execution of 'ks.fn[int]' failed", Keyspace: "ks", Function: "fn", Arguments: []string{"int"}})
+
+	// reads are sent to a single cluster (or to the async connector) and writes are sent to both clusters
+	trackClusterErrorMetrics(defaultCodec, functionFailure, ClusterConnectorTypeOrigin, nodeMetrics)
+	trackClusterErrorMetrics(defaultCodec, functionFailure, ClusterConnectorTypeAsync, nodeMetrics)
+	trackClusterErrorMetrics(defaultCodec, truncateError, ClusterConnectorTypeOrigin, nodeMetrics)
+	trackClusterErrorMetrics(defaultCodec, truncateError, ClusterConnectorTypeTarget, nodeMetrics)
+	trackClusterErrorMetrics(defaultCodec, functionFailure, ClusterConnectorTypeOrigin, nodeMetrics)
+	trackClusterErrorMetrics(defaultCodec, functionFailure, ClusterConnectorTypeTarget, nodeMetrics)
+
+	// capacity errors are still tracked separately
+	trackClusterErrorMetrics(defaultCodec, mustEncodeFrame(t, &message.Overloaded{ErrorMessage: "overloaded"}), ClusterConnectorTypeTarget, nodeMetrics)
+	trackClusterErrorMetrics(defaultCodec, mustEncodeFrame(t, &message.ReadFailure{
+		ErrorMessage: "read failure", Consistency: primitive.ConsistencyLevelQuorum, Received: 1, BlockFor: 2, NumFailures: 1}),
+		ClusterConnectorTypeOrigin, nodeMetrics)
+	trackClusterErrorMetrics(defaultCodec, mustEncodeFrame(t, &message.WriteFailure{
+		ErrorMessage: "write failure", Consistency: primitive.ConsistencyLevelQuorum, Received: 1, BlockFor: 2, NumFailures: 1,
+		WriteType: primitive.WriteTypeSimple}), ClusterConnectorTypeTarget, nodeMetrics)
+
+	require.Equal(t, int64(1), originCounters.truncate.get())
+	require.Equal(t, int64(2), originCounters.functionFailure.get())
+	require.Equal(t, int64(1), originCounters.readFailure.get())
+	require.Equal(t, int64(0), originCounters.writeFailure.get())
+	require.Equal(t, int64(0), originCounters.overloaded.get())
+	require.Equal(t, int64(0), originCounters.other.get())
+
+	require.Equal(t, int64(1), targetCounters.truncate.get())
+	require.Equal(t, int64(1), targetCounters.functionFailure.get())
+	require.Equal(t, int64(0), targetCounters.readFailure.get())
+	require.Equal(t, int64(1), targetCounters.writeFailure.get())
+	require.Equal(t, int64(1), targetCounters.overloaded.get())
+	require.Equal(t, int64(0), targetCounters.other.get())
+
+	require.Equal(t, int64(0), asyncCounters.truncate.get())
+	require.Equal(t, int64(1), asyncCounters.functionFailure.get())
+	require.Equal(t, int64(0), asyncCounters.other.get())
+}
+
+func TestTrackBackendProtocolError(t *testing.T) {
+	proxyMetrics := newFakeProxyMetrics()
+	originProtocolErrors, targetProtocolErrors := &countingCounter{}, &countingCounter{}
+	proxyMetrics.BackendProtocolErrorsOrigin = originProtocolErrors
+	proxyMetrics.BackendProtocolErrorsTarget = targetProtocolErrors
+	ch := &ClientHandler{
+		requestContextHolders: &sync.Map{},
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+
+	query := mockQueryFrame(t, "INSERT INTO ks.t (a) VALUES (1)")
+	reqCtx := NewRequestContext(query, NewGenericRequestInfo(forwardToBoth, false, true), time.Now(), nil)
+	require.Nil(t, getOrCreateRequestContextHolder(ch.requestContextHolders, query.Header.StreamId).SetIfEmpty(reqCtx))
+
+	protocolError := mustEncodeFrame(t, &message.ProtocolError{ErrorMessage: "Invalid or unsupported protocol version"})
+	protocolError.Header.StreamId = query.Header.StreamId
+	errMsg, err := decodeError(defaultCodec, protocolError)
+	require.Nil(t, err)
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	ch.trackBackendProtocolError(protocolError, common.ClusterTypeTarget, errMsg)
+	require.Equal(t, int64(0), originProtocolErrors.get())
+	require.Equal(t, int64(1), targetProtocolErrors.get())
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	require.Equal(t, log.ErrorLevel, entry.Level)
+	require.Contains(t, entry.Message, "TARGET returned a protocol error for stream id 1 (request: OpCode QUERY [0x07], ProtocolVersion OSS 4, sent to both clusters)")
+	require.Contains(t, entry.Message, "Invalid or unsupported protocol version")
+
+	// the request may have timed out already
+	protocolError.Header.StreamId = query.Header.StreamId + 1
+	ch.trackBackendProtocolError(protocolError, common.ClusterTypeOrigin, errMsg)
+	require.Equal(t, int64(1), originProtocolErrors.get())
+	require.Contains(t, hook.LastEntry().Message, "ORIGIN returned a protocol error for stream id")
+	require.Contains(t, hook.LastEntry().Message, "is no longer in flight")
+}
+
+func TestProcessClientResponse_Unauthorized(t *testing.T) {
+	unauthorized := mustEncodeFrame(t, &message.Unauthorized{ErrorMessage: "User app has no MODIFY permission on <table ks.t>"})
+
+	for _, includeCluster := range []bool{false, true} {
+		conf := config.New()
+		conf.UnauthorizedErrorsIncludeCluster = includeCluster
+		ch := &ClientHandler{conf: conf}
+		response, err := ch.processClientResponse(unauthorized, common.ClusterTypeTarget, nil)
+		require.Nil(t, err)
+		decoded, err := defaultCodec.ConvertFromRawFrame(response)
+		require.Nil(t, err)
+		unauthorizedMsg, ok := decoded.Body.Message.(*message.Unauthorized)
+		require.True(t, ok, decoded.Body.Message)
+		if includeCluster {
+			require.Equal(t, "[TARGET] User app has no MODIFY permission on <table ks.t>", unauthorizedMsg.ErrorMessage)
+		} else {
+			require.Equal(t, unauthorized, response)
+		}
+	}
+}
+
+type countingGauge struct {
+	value int64
+}
+
+func (recv *countingGauge) Add(valueToAdd int) {
+	atomic.AddInt64(&recv.value, int64(valueToAdd))
+}
+
+func (recv *countingGauge) Subtract(valueToSubtract int) {
+	atomic.AddInt64(&recv.value, -int64(valueToSubtract))
+}
+
+func (recv *countingGauge) get() int64 {
+	return atomic.LoadInt64(&recv.value)
+}
+
+func TestGetClientConnectionsByVersionGauge(t *testing.T) {
+	proxyMetrics := newFakeProxyMetrics()
+	v4Gauge := &countingGauge{}
+	proxyMetrics.ClientConnectionsV4 = v4Gauge
+	v5Gauge := &countingGauge{}
+	proxyMetrics.ClientConnectionsV5 = v5Gauge
+
+	getClientConnectionsByVersionGauge(proxyMetrics, primitive.ProtocolVersion5).Add(1)
+	require.Equal(t, int64(1), v5Gauge.get())
+	require.Equal(t, int64(0), v4Gauge.get())
+	getClientConnectionsByVersionGauge(proxyMetrics, primitive.ProtocolVersion4).Add(1)
+	require.Equal(t, int64(1), v4Gauge.get())
+}
+
+func TestStartHandshakeTimer(t *testing.T) {
+	tests := []struct {
+		name             string
+		handshakeDone    bool
+		expectedTimeouts int64
+	}{
+		{"handshake not done", false, 1},
+		{"handshake done", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyMetrics := newFakeProxyMetrics()
+			handshakeTimeouts := &countingCounter{}
+			proxyMetrics.ClientHandshakeTimeouts = handshakeTimeouts
+			conf := config.New()
+			conf.ClientHandshakeTimeoutMs = 50
+			clientConn, otherConn := net.Pipe()
+			defer clientConn.Close()
+			defer otherConn.Close()
+			ctx, cancelFn := context.WithCancel(context.Background())
+			defer cancelFn()
+
+			ch := &ClientHandler{
+				conf:                    conf,
+				clientConnector:         &ClientConnector{connection: clientConn},
+				clientHandlerContext:    ctx,
+				clientHandlerCancelFunc: cancelFn,
+				handshakeDone:           &atomic.Value{},
+				metricHandler: metrics.NewMetricHandler(
+					noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+			}
+			if tt.handshakeDone {
+				ch.handshakeDone.Store(true)
+			}
+
+			ch.startHandshakeTimer()
+			time.Sleep(200 * time.Millisecond)
+			require.Equal(t, tt.expectedTimeouts, handshakeTimeouts.get())
+			require.Equal(t, tt.expectedTimeouts == 1, ctx.Err() != nil)
+		})
+	}
+}
+
+func TestStartAuthIdleTimer(t *testing.T) {
+	tests := []struct {
+		name             string
+		answered         bool
+		expectedTimeouts int64
+	}{
+		{"client stalls after AUTHENTICATE", false, 1},
+		{"client sends AUTH_RESPONSE", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyMetrics := newFakeProxyMetrics()
+			authIdleTimeouts := &countingCounter{}
+			proxyMetrics.ClientAuthIdleTimeouts = authIdleTimeouts
+			conf := config.New()
+			conf.ClientAuthIdleTimeoutMs = 50
+			clientConn, otherConn := net.Pipe()
+			defer clientConn.Close()
+			defer otherConn.Close()
+			ctx, cancelFn := context.WithCancel(context.Background())
+			defer cancelFn()
+
+			ch := &ClientHandler{
+				conf:                    conf,
+				clientConnector:         &ClientConnector{connection: clientConn},
+				clientHandlerContext:    ctx,
+				clientHandlerCancelFunc: cancelFn,
+				handshakeDone:           &atomic.Value{},
+				metricHandler: metrics.NewMetricHandler(
+					noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+			}
+
+			ch.startAuthIdleTimer()
+			if tt.answered {
+				ch.stopAuthIdleTimer()
+			}
+			time.Sleep(200 * time.Millisecond)
+			require.Equal(t, tt.expectedTimeouts, authIdleTimeouts.get())
+			require.Equal(t, tt.expectedTimeouts == 1, ctx.Err() != nil)
+			// the connection is closed by the timer so it is not counted as an aborted handshake
+			require.Equal(t, tt.expectedTimeouts == 1, atomic.LoadInt32(&ch.handshakeTimedOut) == 1)
+		})
+	}
+}
+
+func TestTrackAbortedHandshake(t *testing.T) {
+	tests := []struct {
+		name            string
+		timedOut        bool
+		shuttingDown    bool
+		expectedAborted int64
+	}{
+		{"client disconnected", false, false, 1},
+		{"handshake timed out", true, false, 0},
+		{"proxy shutting down", false, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyMetrics := newFakeProxyMetrics()
+			abortedHandshakes := &countingCounter{}
+			proxyMetrics.AbortedHandshakes = abortedHandshakes
+			clientConn, otherConn := net.Pipe()
+			defer clientConn.Close()
+			defer otherConn.Close()
+			shutdownCtx, shutdownCancelFn := context.WithCancel(context.Background())
+			defer shutdownCancelFn()
+
+			ch := &ClientHandler{
+				clientConnector:                     &ClientConnector{connection: clientConn},
+				clientHandlerShutdownRequestContext: shutdownCtx,
+				metricHandler: metrics.NewMetricHandler(
+					noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+			}
+			if tt.timedOut {
+				ch.handshakeTimedOut = 1
+			}
+			if tt.shuttingDown {
+				shutdownCancelFn()
+			}
+
+			ch.trackAbortedHandshake()
+			require.Equal(t, tt.expectedAborted, abortedHandshakes.get())
+		})
+	}
+}
+
+func TestListenForEventMessages_ClientNotReading(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          common.EventDeliveryMode
+		expectBlocked bool
+	}{
+		{"drop", common.EventDeliveryModeDrop, false},
+		{"block", common.EventDeliveryModeBlock, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the client side of the connection is not read so the write queue fills up
+			proxySide, clientSide := net.Pipe()
+			defer proxySide.Close()
+			defer clientSide.Close()
+			ctx, cancelFn := context.WithCancel(context.Background())
+			defer cancelFn()
+
+			conf := config.New()
+			conf.ResponseWriteQueueSizeFrames = 2
+			conf.ResponseWriteBufferSizeBytes = 1024
+			writeScheduler := NewScheduler(1)
+			defer writeScheduler.Shutdown()
+			writeCoalescer := NewWriteCoalescer(
+				conf, proxySide, &sync.WaitGroup{}, ctx, cancelFn, "ClientConnector", false, false, writeScheduler,
+				newConnectionFraming(true), nil)
+			writeCoalescer.RunWriteQueueLoop()
+
+			proxyMetrics := newFakeProxyMetrics()
+			droppedEvents := &countingCounter{}
+			proxyMetrics.DroppedEvents = droppedEvents
+			eventsDoneChan := make(chan bool)
+			targetEventsChan := make(chan *frame.RawFrame)
+			originEventsChan := make(chan *frame.RawFrame)
+			ch := &ClientHandler{
+				conf:                     conf,
+				clientConnector:          &ClientConnector{connection: proxySide, writeCoalescer: writeCoalescer},
+				originCassandraConnector: &ClusterConnector{clusterConnEventsChan: originEventsChan},
+				targetCassandraConnector: &ClusterConnector{clusterConnEventsChan: targetEventsChan},
+				topologyConfig:           &common.TopologyConfig{VirtualizationEnabled: false},
+				localClientHandlerWg:     &sync.WaitGroup{},
+				eventsDoneChan:           eventsDoneChan,
+				eventDeliveryMode:        tt.mode,
+				metricHandler: metrics.NewMetricHandler(
+					noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+			}
+			ch.listenForEventMessages()
+
+			event := mustEncodeFrame(t, &message.StatusChangeEvent{
+				ChangeType: primitive.StatusChangeTypeUp,
+				Address:    &primitive.Inet{Addr: net.ParseIP("127.0.0.1"), Port: 9042},
+			})
+			totalEvents := 20
+			consumedEvents := 0
+			for i := 0; i < totalEvents; i++ {
+				select {
+				case targetEventsChan <- event:
+					consumedEvents++
+				case <-time.After(200 * time.Millisecond):
+				}
+				if consumedEvents < i+1 {
+					break
+				}
+			}
+
+			if !tt.expectBlocked {
+				require.Equal(t, totalEvents, consumedEvents)
+				require.Greater(t, droppedEvents.get(), int64(0))
+			} else {
+				require.Less(t, consumedEvents, totalEvents)
+				require.Equal(t, int64(0), droppedEvents.get())
+
+				// the event listener resumes once the client catches up
+				go func() {
+					buf := make([]byte, 1024)
+					for {
+						if _, err := clientSide.Read(buf); err != nil {
+							return
+						}
+					}
+				}()
+			}
+
+			close(targetEventsChan)
+			close(originEventsChan)
+			select {
+			case <-eventsDoneChan:
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "event listener did not finish after the event channels were closed")
+			}
+			_ = clientSide.Close()
+			writeCoalescer.Close()
+		})
+	}
+}
+
+func TestListenForEventMessages_Shutdown(t *testing.T) {
+	tests := []struct {
+		name            string
+		clientReading   bool
+		deliveryMode    common.EventDeliveryMode
+		flushTimeoutMs  int
+		expectAllEvents bool
+		expectDropped   bool
+	}{
+		// the events that are received before the listener sees the closed channels are forwarded with the regular
+		// delivery mode so they are only guaranteed to reach the client with BLOCK
+		{"client reading", true, common.EventDeliveryModeBlock, 5000, true, false},
+		{"client not reading", false, common.EventDeliveryModeDrop, 100, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxySide, clientSide := net.Pipe()
+			defer proxySide.Close()
+			defer clientSide.Close()
+			ctx, cancelFn := context.WithCancel(context.Background())
+			defer cancelFn()
+
+			conf := config.New()
+			conf.ResponseWriteQueueSizeFrames = 2
+			conf.ResponseWriteBufferSizeBytes = 1024
+			conf.ShutdownFlushTimeoutMs = tt.flushTimeoutMs
+			writeScheduler := NewScheduler(1)
+			defer writeScheduler.Shutdown()
+			writeCoalescer := NewWriteCoalescer(
+				conf, proxySide, &sync.WaitGroup{}, ctx, cancelFn, "ClientConnector", false, false, writeScheduler,
+				newConnectionFraming(true), nil)
+			writeCoalescer.RunWriteQueueLoop()
+
+			proxyMetrics := newFakeProxyMetrics()
+			droppedEvents := &countingCounter{}
+			droppedEventsOnShutdown := &countingCounter{}
+			proxyMetrics.DroppedEvents = droppedEvents
+			proxyMetrics.DroppedEventsOnShutdown = droppedEventsOnShutdown
+
+			// the cluster connections are already closed but the origin events were not consumed yet
+			event := mustEncodeFrame(t, &message.SchemaChangeEvent{
+				ChangeType: primitive.SchemaChangeTypeCreated,
+				Target:     primitive.SchemaChangeTargetKeyspace,
+				Keyspace:   "ks1",
+			})
+			totalEvents := 20
+			originEventsChan := make(chan *frame.RawFrame, totalEvents)
+			for i := 0; i < totalEvents; i++ {
+				originEventsChan <- event
+			}
+			close(originEventsChan)
+			targetEventsChan := make(chan *frame.RawFrame)
+			close(targetEventsChan)
+
+			receivedBytes := int64(0)
+			if tt.clientReading {
+				go func() {
+					buf := make([]byte, 1024)
+					for {
+						n, err := clientSide.Read(buf)
+						atomic.AddInt64(&receivedBytes, int64(n))
+						if err != nil {
+							return
+						}
+					}
+				}()
+			}
+
+			eventsDoneChan := make(chan bool)
+			ch := &ClientHandler{
+				conf:                     conf,
+				clientConnector:          &ClientConnector{connection: proxySide, writeCoalescer: writeCoalescer},
+				originCassandraConnector: &ClusterConnector{clusterConnEventsChan: originEventsChan},
+				targetCassandraConnector: &ClusterConnector{clusterConnEventsChan: targetEventsChan},
+				topologyConfig:           &common.TopologyConfig{VirtualizationEnabled: false},
+				localClientHandlerWg:     &sync.WaitGroup{},
+				eventsDoneChan:           eventsDoneChan,
+				eventDeliveryMode:        tt.deliveryMode,
+				metricHandler: metrics.NewMetricHandler(
+					noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+			}
+			ch.listenForEventMessages()
+
+			select {
+			case <-eventsDoneChan:
+			case <-time.After(10 * time.Second):
+				require.FailNow(t, "event listener did not finish after the event channels were closed")
+			}
+
+			flushed := writeCoalescer.WaitUntilFlushed(time.Duration(tt.flushTimeoutMs) * time.Millisecond)
+			require.Equal(t, tt.expectAllEvents, flushed)
+			if tt.expectAllEvents {
+				eventLength := int64(primitive.FrameHeaderLengthV3AndHigher + len(event.Body))
+				require.Eventually(t, func() bool {
+					return atomic.LoadInt64(&receivedBytes) == int64(totalEvents)*eventLength
+				}, 5*time.Second, 10*time.Millisecond)
+			}
+			if tt.expectDropped {
+				require.Greater(t, droppedEventsOnShutdown.get(), int64(0))
+			} else {
+				require.Equal(t, int64(0), droppedEventsOnShutdown.get())
+				require.Equal(t, int64(0), droppedEvents.get())
+			}
+
+			_ = clientSide.Close()
+			writeCoalescer.Close()
+		})
+	}
+}
+
+func mustEncodeFrame(t *testing.T, msg message.Message) *frame.RawFrame {
+	f, err := defaultCodec.ConvertToRawFrame(frame.NewFrame(primitive.ProtocolVersion4, 0, msg))
+	require.Nil(t, err)
+	return f
+}
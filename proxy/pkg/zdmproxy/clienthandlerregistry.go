@@ -0,0 +1,127 @@
+package zdmproxy
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// requestWaitGroup is a sync.WaitGroup that also keeps the number of goroutines that it waits for
+// so that the in-flight goroutines of a client handler can be exported as metrics.
+type requestWaitGroup struct {
+	sync.WaitGroup
+	count int32
+}
+
+func (recv *requestWaitGroup) Add(delta int) {
+	atomic.AddInt32(&recv.count, int32(delta))
+	recv.WaitGroup.Add(delta)
+}
+
+func (recv *requestWaitGroup) Done() {
+	recv.Add(-1)
+}
+
+func (recv *requestWaitGroup) getCount() int {
+	return int(atomic.LoadInt32(&recv.count))
+}
+
+// clientHandlerRegistry keeps track of the client handlers that are running so that their in-flight goroutines and
+// the depth of their internal channels can be exported as metrics. A handler is registered until its client
+// connection is released so handlers that do not shut down (e.g. because of a leaked goroutine) are still counted.
+type clientHandlerRegistry struct {
+	lock     *sync.RWMutex
+	handlers map[*ClientHandler]struct{}
+}
+
+func newClientHandlerRegistry() *clientHandlerRegistry {
+	return &clientHandlerRegistry{
+		lock:     &sync.RWMutex{},
+		handlers: make(map[*ClientHandler]struct{}),
+	}
+}
+
+func (recv *clientHandlerRegistry) register(ch *ClientHandler) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	recv.handlers[ch] = struct{}{}
+}
+
+func (recv *clientHandlerRegistry) unregister(ch *ClientHandler) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	delete(recv.handlers, ch)
+}
+
+// getHandlers returns a copy of the handlers that are registered.
+func (recv *clientHandlerRegistry) getHandlers() []*ClientHandler {
+	recv.lock.RLock()
+	defer recv.lock.RUnlock()
+	handlers := make([]*ClientHandler, 0, len(recv.handlers))
+	for ch := range recv.handlers {
+		handlers = append(handlers, ch)
+	}
+	return handlers
+}
+
+func (recv *clientHandlerRegistry) getHandlerCount() float64 {
+	recv.lock.RLock()
+	defer recv.lock.RUnlock()
+	return float64(len(recv.handlers))
+}
+
+// getInFlightGoroutines returns the goroutines that are processing requests and responses on behalf of all handlers.
+func (recv *clientHandlerRegistry) getInFlightGoroutines() float64 {
+	return recv.sum(func(ch *ClientHandler) int {
+		return ch.clientHandlerRequestWaitGroup.getCount()
+	})
+}
+
+// getMaxInFlightGoroutines returns the in-flight goroutines of the busiest handler, the per handler counts are not
+// exported because there is a handler for each client connection.
+func (recv *clientHandlerRegistry) getMaxInFlightGoroutines() float64 {
+	recv.lock.RLock()
+	defer recv.lock.RUnlock()
+	max := 0
+	for ch := range recv.handlers {
+		if count := ch.clientHandlerRequestWaitGroup.getCount(); count > max {
+			max = count
+		}
+	}
+	return float64(max)
+}
+
+// getRequestQueueDepth returns the requests that were read from the client connections and are waiting to be processed.
+func (recv *clientHandlerRegistry) getRequestQueueDepth() float64 {
+	return recv.sum(func(ch *ClientHandler) int {
+		return len(ch.reqChannel)
+	})
+}
+
+// getResponseQueueDepth returns the responses that were read from the cluster connections and are waiting to be processed.
+func (recv *clientHandlerRegistry) getResponseQueueDepth() float64 {
+	return recv.sum(func(ch *ClientHandler) int {
+		return len(ch.respChannel)
+	})
+}
+
+// getEventQueueDepth returns the protocol events that were read from the cluster connections and are waiting to be
+// forwarded to the clients.
+func (recv *clientHandlerRegistry) getEventQueueDepth() float64 {
+	return recv.sum(func(ch *ClientHandler) int {
+		depth := len(ch.originCassandraConnector.clusterConnEventsChan) + len(ch.targetCassandraConnector.clusterConnEventsChan)
+		if ch.asyncConnector != nil {
+			depth += len(ch.asyncConnector.clusterConnEventsChan)
+		}
+		return depth
+	})
+}
+
+func (recv *clientHandlerRegistry) sum(f func(ch *ClientHandler) int) float64 {
+	recv.lock.RLock()
+	defer recv.lock.RUnlock()
+	total := 0
+	for ch := range recv.handlers {
+		total += f(ch)
+	}
+	return float64(total)
+}
@@ -0,0 +1,84 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newRegistryTestHandler(queueSize int) (*ClientHandler, chan *frame.RawFrame) {
+	requestsChannel := make(chan *frame.RawFrame, queueSize)
+	return &ClientHandler{
+		reqChannel:                    requestsChannel,
+		respChannel:                   make(chan *Response, queueSize),
+		clientHandlerRequestWaitGroup: &requestWaitGroup{},
+		originCassandraConnector:      &ClusterConnector{clusterConnEventsChan: make(chan *frame.RawFrame, queueSize)},
+		targetCassandraConnector:      &ClusterConnector{clusterConnEventsChan: make(chan *frame.RawFrame, queueSize)},
+	}, requestsChannel
+}
+
+func TestClientHandlerRegistry_QueueDepth(t *testing.T) {
+	registry := newClientHandlerRegistry()
+	handler1, requests1 := newRegistryTestHandler(10)
+	handler2, requests2 := newRegistryTestHandler(10)
+	registry.register(handler1)
+	registry.register(handler2)
+	require.Equal(t, 2.0, registry.getHandlerCount())
+
+	for i := 0; i < 3; i++ {
+		requests1 <- &frame.RawFrame{}
+	}
+	requests2 <- &frame.RawFrame{}
+	handler2.respChannel <- &Response{}
+	handler2.respChannel <- &Response{}
+	handler1.originCassandraConnector.clusterConnEventsChan <- &frame.RawFrame{}
+	handler2.targetCassandraConnector.clusterConnEventsChan <- &frame.RawFrame{}
+
+	require.Equal(t, 4.0, registry.getRequestQueueDepth())
+	require.Equal(t, 2.0, registry.getResponseQueueDepth())
+	require.Equal(t, 2.0, registry.getEventQueueDepth())
+
+	// frames are no longer queued once they are processed
+	<-handler1.reqChannel
+	<-handler2.respChannel
+	require.Equal(t, 3.0, registry.getRequestQueueDepth())
+	require.Equal(t, 1.0, registry.getResponseQueueDepth())
+
+	registry.unregister(handler1)
+	require.Equal(t, 1.0, registry.getHandlerCount())
+	require.Equal(t, 1.0, registry.getRequestQueueDepth())
+	require.Equal(t, 1.0, registry.getEventQueueDepth())
+}
+
+func TestClientHandlerRegistry_InFlightGoroutines(t *testing.T) {
+	registry := newClientHandlerRegistry()
+	handler1, _ := newRegistryTestHandler(1)
+	handler2, _ := newRegistryTestHandler(1)
+	registry.register(handler1)
+	registry.register(handler2)
+
+	release := make(chan bool)
+	started := make(chan bool)
+	simulateLoad := func(ch *ClientHandler, goroutines int) {
+		for i := 0; i < goroutines; i++ {
+			ch.clientHandlerRequestWaitGroup.Add(1)
+			go func() {
+				defer ch.clientHandlerRequestWaitGroup.Done()
+				started <- true
+				<-release
+			}()
+			<-started
+		}
+	}
+	simulateLoad(handler1, 5)
+	simulateLoad(handler2, 2)
+
+	require.Equal(t, 7.0, registry.getInFlightGoroutines())
+	require.Equal(t, 5.0, registry.getMaxInFlightGoroutines())
+
+	close(release)
+	handler1.clientHandlerRequestWaitGroup.Wait()
+	handler2.clientHandlerRequestWaitGroup.Wait()
+	require.Equal(t, 0.0, registry.getInFlightGoroutines())
+	require.Equal(t, 0.0, registry.getMaxInFlightGoroutines())
+}
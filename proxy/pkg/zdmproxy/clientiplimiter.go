@@ -0,0 +1,70 @@
+package zdmproxy
+
+import (
+	"net"
+	"sync"
+)
+
+// clientIpLimiter limits the number of client connections that are open at the same time from each IP address,
+// see ZDM_PROXY_MAX_CLIENT_CONNECTIONS_PER_IP. A nil clientIpLimiter doesn't limit connections.
+type clientIpLimiter struct {
+	maxPerIp    int
+	lock        *sync.Mutex
+	connections map[string]int
+}
+
+func newClientIpLimiter(maxPerIp int) *clientIpLimiter {
+	if maxPerIp <= 0 {
+		return nil
+	}
+	return &clientIpLimiter{
+		maxPerIp:    maxPerIp,
+		lock:        &sync.Mutex{},
+		connections: make(map[string]int),
+	}
+}
+
+// acquire returns false if the IP address already has the maximum number of open connections.
+func (recv *clientIpLimiter) acquire(ip string) bool {
+	if recv == nil {
+		return true
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	if recv.connections[ip] >= recv.maxPerIp {
+		return false
+	}
+	recv.connections[ip]++
+	return true
+}
+
+// release must be called once for each successful acquire when the connection is closed.
+func (recv *clientIpLimiter) release(ip string) {
+	if recv == nil {
+		return
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	if recv.connections[ip] <= 1 {
+		delete(recv.connections, ip)
+	} else {
+		recv.connections[ip]--
+	}
+}
+
+// getClientIp returns the IP address of a client connection without the port so that all connections from the
+// same host are counted together.
+func getClientIp(addr net.Addr) string {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,40 @@
+package zdmproxy
+
+import (
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+)
+
+func TestClientIpLimiter(t *testing.T) {
+	limiter := newClientIpLimiter(2)
+
+	require.True(t, limiter.acquire("10.0.0.1"))
+	require.True(t, limiter.acquire("10.0.0.1"))
+	require.False(t, limiter.acquire("10.0.0.1"))
+
+	// other IP addresses have their own limit
+	require.True(t, limiter.acquire("10.0.0.2"))
+
+	limiter.release("10.0.0.1")
+	require.True(t, limiter.acquire("10.0.0.1"))
+	require.False(t, limiter.acquire("10.0.0.1"))
+
+	limiter.release("10.0.0.2")
+	require.NotContains(t, limiter.connections, "10.0.0.2")
+}
+
+func TestClientIpLimiter_Disabled(t *testing.T) {
+	limiter := newClientIpLimiter(0)
+	require.Nil(t, limiter)
+	for i := 0; i < 10; i++ {
+		require.True(t, limiter.acquire("10.0.0.1"))
+	}
+	limiter.release("10.0.0.1")
+}
+
+func TestGetClientIp(t *testing.T) {
+	require.Equal(t, "10.0.0.1", getClientIp(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}))
+	require.Equal(t, "::1", getClientIp(&net.TCPAddr{IP: net.ParseIP("::1"), Port: 5000}))
+	require.Equal(t, "10.0.0.1", getClientIp(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}))
+}
@@ -0,0 +1,7 @@
+package zdmproxy
+
+import "time"
+
+// nowFunc returns the current time. The time based logic of the handlers (request start times, retry detection,
+// per connection metrics expiration) uses it instead of time.Now so that tests can replace it with a fake clock.
+var nowFunc = time.Now
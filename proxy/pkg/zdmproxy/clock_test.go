@@ -0,0 +1,113 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock replaces nowFunc until the test finishes, time only moves forward when advance is called.
+type fakeClock struct {
+	lock *sync.Mutex
+	now  time.Time
+}
+
+func newFakeClock(t *testing.T) *fakeClock {
+	clock := &fakeClock{lock: &sync.Mutex{}, now: time.Unix(1000, 0)}
+	previousNowFunc := nowFunc
+	nowFunc = clock.Now
+	t.Cleanup(func() {
+		nowFunc = previousNowFunc
+	})
+	return clock
+}
+
+func (recv *fakeClock) Now() time.Time {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	return recv.now
+}
+
+func (recv *fakeClock) advance(d time.Duration) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	recv.now = recv.now.Add(d)
+}
+
+func TestFakeClock_ConnectionMetrics(t *testing.T) {
+	clock := newFakeClock(t)
+	registry := newConnectionMetricsRegistry()
+	ch := &ClientHandler{clientAddress: "10.0.0.1:5000", connectionMetrics: registry}
+
+	_, err := registry.enable(ch.clientAddress, time.Minute, nowFunc())
+	require.Nil(t, err)
+
+	reqCtx := NewRequestContext(nil, NewGenericRequestInfo(forwardToOrigin, false, true), nowFunc(), nil)
+	clock.advance(25 * time.Millisecond)
+	ch.trackConnectionMetrics(reqCtx, false)
+
+	reports := registry.snapshot(nowFunc())
+	require.Len(t, reports, 1)
+	require.Equal(t, int64(1), reports[0].Requests["reads_origin"].Count)
+	require.Equal(t, 25.0, reports[0].Requests["reads_origin"].AverageLatencyMs)
+
+	// the entry expires exactly when the duration elapses
+	clock.advance(time.Minute - 25*time.Millisecond - time.Nanosecond)
+	require.Len(t, registry.snapshot(nowFunc()), 1)
+	clock.advance(time.Nanosecond)
+	require.Empty(t, registry.snapshot(nowFunc()))
+}
+
+func TestFakeClock_TrackLikelyRetry(t *testing.T) {
+	clock := newFakeClock(t)
+	proxyMetrics := newFakeProxyMetrics()
+	likelyRetries := &countingCounter{}
+	proxyMetrics.LikelyRetries = likelyRetries
+	ch := &ClientHandler{
+		retryDetector: newRetryDetector(true, time.Second, common.QueryNormalizationLevelWhitespace, 100, time.Minute, newFakeGauge(), newFakeCounter()),
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+	query := mustEncodeFrame(t, &message.Query{Query: "INSERT INTO ks.t (a) VALUES (1)"})
+
+	ch.trackLikelyRetry(NewFrameDecodeContext(query))
+	require.Equal(t, int64(0), likelyRetries.get())
+
+	clock.advance(time.Second)
+	ch.trackLikelyRetry(NewFrameDecodeContext(query))
+	require.Equal(t, int64(1), likelyRetries.get())
+
+	clock.advance(time.Second + time.Nanosecond)
+	ch.trackLikelyRetry(NewFrameDecodeContext(query))
+	require.Equal(t, int64(1), likelyRetries.get())
+}
+
+func TestFakeClock_TrackSloBreach(t *testing.T) {
+	tests := []struct {
+		name             string
+		thresholdMs      int
+		latency          time.Duration
+		expectedBreaches int64
+	}{
+		{"below threshold", 50, 49 * time.Millisecond, 0},
+		{"at threshold", 50, 50 * time.Millisecond, 0},
+		{"above threshold", 50, 50*time.Millisecond + time.Nanosecond, 1},
+		{"disabled", 0, time.Minute, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock(t)
+			sloBreaches := &countingCounter{}
+			startTime := nowFunc()
+			clock.advance(tt.latency)
+			trackSloBreach(sloBreaches, tt.thresholdMs, startTime)
+			require.Equal(t, tt.expectedBreaches, sloBreaches.get())
+		})
+	}
+}
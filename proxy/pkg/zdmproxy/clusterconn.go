@@ -52,25 +52,44 @@ type ClusterConnector struct {
 
 	psCache *PreparedStatementCache
 
-	clusterConnEventsChan  chan *frame.RawFrame
-	nodeMetrics            *metrics.NodeMetrics
-	clientHandlerWg        *sync.WaitGroup
-	clientHandlerRequestWg *sync.WaitGroup
-	clusterConnContext     context.Context
-	cancelFunc             context.CancelFunc
-	responseChan           chan<- *Response
+	clusterConnEventsChan    chan *frame.RawFrame
+	nodeMetrics              *metrics.NodeMetrics
+	droppedLateResponses     metrics.Counter
+	unknownStreamIdResponses metrics.Counter
+	unregisteredEvents       metrics.Counter
+	wrongDirectionFrames     metrics.Counter
+	frameTypes               *frameTypeCounters
+	clientHandlerWg          *sync.WaitGroup
+	clientHandlerRequestWg   *requestWaitGroup
+	clusterConnContext       context.Context
+	cancelFunc               context.CancelFunc
+	responseChan             chan<- *Response
 
 	responseReadBufferSizeBytes int
 	writeCoalescer              *writeCoalescer
+	framing                     *connectionFraming
+	codec                       *connectionCodec
 	doneChan                    chan bool
 
 	handshakeDone *atomic.Value
 
+	// options of the client's STARTUP request, see setStartupOptions
+	startupOptions atomic.Value
+
 	asyncConnector       bool
 	asyncConnectorState  ConnectorState
 	asyncPendingRequests *pendingRequests
 
+	// stream ids of the requests that are waiting for a response, only tracked by the origin and target connectors
+	// because the async connector has its own stream ids (see asyncPendingRequests)
+	outstandingStreamIds *outstandingStreamIds
+
+	// set to 1 when a REGISTER request is sent to the cluster, events received before that are dropped
+	eventsRegistered int32
+
 	readScheduler *Scheduler
+
+	injectedLatency *injectedLatency
 }
 
 func NewClusterConnectionInfo(connConfig ConnectionConfig, endpointConfig Endpoint, isOriginCassandra bool) *ClusterConnectionInfo {
@@ -86,8 +105,9 @@ func NewClusterConnector(
 	conf *config.Config,
 	psCache *PreparedStatementCache,
 	nodeMetrics *metrics.NodeMetrics,
+	proxyMetrics *metrics.ProxyMetrics,
 	clientHandlerWg *sync.WaitGroup,
-	clientHandlerRequestWg *sync.WaitGroup,
+	clientHandlerRequestWg *requestWaitGroup,
 	clientHandlerContext context.Context,
 	clientHandlerCancelFunc context.CancelFunc,
 	responseChan chan<- *Response,
@@ -96,7 +116,9 @@ func NewClusterConnector(
 	requestsDoneCtx context.Context,
 	asyncConnector bool,
 	asyncPendingRequests *pendingRequests,
-	handshakeDone *atomic.Value) (*ClusterConnector, error) {
+	handshakeDone *atomic.Value,
+	codec *connectionCodec,
+	shared *clientHandlerShared) (*ClusterConnector, error) {
 
 	var connectorType ClusterConnectorType
 	var clusterType common.ClusterType
@@ -112,7 +134,9 @@ func NewClusterConnector(
 		connectorType = ClusterConnectorTypeAsync
 	}
 
-	conn, timeoutCtx, err := openConnectionToCluster(connInfo, clientHandlerContext, connectorType, nodeMetrics)
+	conn, timeoutCtx, err := openConnectionToCluster(
+		connInfo, clientHandlerContext, clusterConnectTimeout(conf, connInfo), connectorType, nodeMetrics,
+		newClusterSocketOptions(conf))
 	if err != nil {
 		if errors.Is(err, ShutdownErr) {
 			if timeoutCtx.Err() != nil {
@@ -135,23 +159,31 @@ func NewClusterConnector(
 
 	cancelFn := clusterConnCancelFn
 	var clusterConnEventsChan chan *frame.RawFrame
+	var streamIds *outstandingStreamIds
 	if !asyncConnector {
 		cancelFn = clientHandlerCancelFunc
 		clusterConnEventsChan = make(chan *frame.RawFrame, conf.EventQueueSizeFrames)
+		streamIds = newOutstandingStreamIds(time.Duration(conf.ProxyRequestTimeoutMs) * time.Millisecond)
 	}
 
+	framing := newConnectionFraming(false)
 	return &ClusterConnector{
-		conf:                   conf,
-		connection:             conn,
-		clusterType:            clusterType,
-		connectorType:          connectorType,
-		clusterConnEventsChan:  clusterConnEventsChan,
-		psCache:                psCache,
-		nodeMetrics:            nodeMetrics,
-		clientHandlerWg:        clientHandlerWg,
-		clientHandlerRequestWg: clientHandlerRequestWg,
-		clusterConnContext:     clusterConnCtx,
-		cancelFunc:             cancelFn,
+		conf:                     conf,
+		connection:               conn,
+		clusterType:              clusterType,
+		connectorType:            connectorType,
+		clusterConnEventsChan:    clusterConnEventsChan,
+		psCache:                  psCache,
+		nodeMetrics:              nodeMetrics,
+		droppedLateResponses:     proxyMetrics.DroppedLateResponses,
+		unknownStreamIdResponses: proxyMetrics.UnknownStreamIdResponses,
+		unregisteredEvents:       proxyMetrics.UnregisteredEvents,
+		wrongDirectionFrames:     proxyMetrics.WrongDirectionFrames,
+		frameTypes:               newFrameTypeCounters(proxyMetrics, clusterType),
+		clientHandlerWg:          clientHandlerWg,
+		clientHandlerRequestWg:   clientHandlerRequestWg,
+		clusterConnContext:       clusterConnCtx,
+		cancelFunc:               cancelFn,
 		writeCoalescer: NewWriteCoalescer(
 			conf,
 			conn,
@@ -161,7 +193,11 @@ func NewClusterConnector(
 			string(connectorType),
 			true,
 			asyncConnector,
-			writeScheduler),
+			writeScheduler,
+			framing,
+			codec),
+		framing:                     framing,
+		codec:                       codec,
 		responseChan:                responseChan,
 		responseReadBufferSizeBytes: conf.ResponseReadBufferSizeBytes,
 		doneChan:                    make(chan bool),
@@ -169,7 +205,9 @@ func NewClusterConnector(
 		asyncConnector:              asyncConnector,
 		asyncConnectorState:         ConnectorStateHandshake,
 		asyncPendingRequests:        asyncPendingRequests,
+		outstandingStreamIds:        streamIds,
 		handshakeDone:               handshakeDone,
+		injectedLatency:             shared.injectedLatency,
 	}, nil
 }
 
@@ -178,10 +216,25 @@ func (cc *ClusterConnector) run() {
 	cc.writeCoalescer.RunWriteQueueLoop()
 }
 
-func openConnectionToCluster(connInfo *ClusterConnectionInfo, context context.Context, connectorType ClusterConnectorType, nodeMetrics *metrics.NodeMetrics) (net.Conn, context.Context, error) {
+// clusterConnectTimeout returns the timeout of opening a request connection to the cluster, it is distinct from the
+// timeout of the control connections so that an unreachable cluster fails the client connection quickly.
+func clusterConnectTimeout(conf *config.Config, connInfo *ClusterConnectionInfo) time.Duration {
+	timeoutMs := conf.TargetConnectTimeoutMs
+	if connInfo.isOriginCassandra {
+		timeoutMs = conf.OriginConnectTimeoutMs
+	}
+	if timeoutMs <= 0 {
+		timeoutMs = connInfo.connConfig.GetConnectionTimeoutMs()
+	}
+	return time.Duration(timeoutMs) * time.Millisecond
+}
+
+func openConnectionToCluster(
+	connInfo *ClusterConnectionInfo, context context.Context, timeout time.Duration, connectorType ClusterConnectorType,
+	nodeMetrics *metrics.NodeMetrics, opts *socketOptions) (net.Conn, context.Context, error) {
 	clusterType := connInfo.connConfig.GetClusterType()
 	log.Infof("[%s] Opening request connection to %v (%v).", connectorType, clusterType, connInfo.endpoint.GetEndpointIdentifier())
-	conn, timeoutCtx, err := openConnection(connInfo.connConfig, connInfo.endpoint, context, true)
+	conn, timeoutCtx, err := openConnection(connInfo.connConfig, connInfo.endpoint, context, timeout, true, opts)
 	if err != nil {
 		return nil, timeoutCtx, err
 	}
@@ -231,13 +284,16 @@ func (cc *ClusterConnector) runResponseListeningLoop() {
 
 		bufferedReader := bufio.NewReaderSize(cc.connection, cc.responseReadBufferSizeBytes)
 		connectionAddr := cc.connection.RemoteAddr().String()
+		reader := newFrameReader(bufferedReader, connectionAddr, cc.clusterConnContext, cc.framing)
 		wg := &sync.WaitGroup{}
 		defer wg.Wait()
 		protocolErrOccurred := false
 		for {
-			response, err := readRawFrame(bufferedReader, connectionAddr, cc.clusterConnContext)
+			response, err := reader.read()
 
-			protocolErrResponseFrame, err := checkProtocolError(response, err, protocolErrOccurred, string(cc.connectorType))
+			protocolErrResponseFrame, err := checkProtocolError(
+				cc.codec.get(), response, err, protocolErrOccurred, cc.conf.ProtocolV5Enabled, string(cc.connectorType))
+			generatedResponse := protocolErrResponseFrame != nil
 			if err != nil {
 				handleConnectionError(
 					err, cc.clusterConnContext, cc.cancelFunc, string(cc.connectorType), "reading", connectionAddr)
@@ -258,27 +314,117 @@ func (cc *ClusterConnector) runResponseListeningLoop() {
 				log.Tracef("[%s] Received response from %v (%v): %v",
 					cc.connectorType, cc.clusterType, connectionAddr, response.Header)
 
+				if !generatedResponse && cc.isWrongDirectionFrame(response) {
+					return
+				}
+
 				if cc.asyncConnector {
 					response = cc.handleAsyncResponse(response)
 					if response == nil {
 						return
 					}
+				} else if !generatedResponse && (cc.isUnknownStreamIdResponse(response) || cc.isUnregisteredEvent(response)) {
+					return
 				}
 
-				if response.Header.OpCode == primitive.OpCodeEvent {
-					cc.clusterConnEventsChan <- response
-				} else {
-					cc.responseChan <- NewResponse(response, cc.connectorType)
+				if delay := cc.injectedLatency.get(cc.clusterType); delay > 0 && response.Header.OpCode != primitive.OpCodeEvent {
+					// don't block the read scheduler worker, it is shared with other connections
+					wg.Add(1)
+					time.AfterFunc(delay, func() {
+						defer wg.Done()
+						cc.dispatchResponse(response)
+					})
+					return
 				}
-				log.Tracef("[%s] Response sent to response channel: %v", cc.connectorType, response.Header)
+
+				cc.dispatchResponse(response)
 			})
 		}
 		log.Debugf("[%s] Shutting down response listening loop from %v", cc.connectorType, connectionAddr)
 	}()
 }
 
+// dispatchResponse hands the response (or event) over to the client handler. If the client handler is shutting down
+// then nothing is waiting for this response anymore so it is dropped instead of blocking this connector forever.
+func (cc *ClusterConnector) dispatchResponse(response *frame.RawFrame) {
+	if cc.clusterConnContext.Err() != nil {
+		cc.dropLateResponse(response)
+		return
+	}
+
+	if response.Header.OpCode == primitive.OpCodeEvent {
+		select {
+		case cc.clusterConnEventsChan <- response:
+		case <-cc.clusterConnContext.Done():
+			cc.dropLateResponse(response)
+			return
+		}
+	} else {
+		select {
+		case cc.responseChan <- NewResponse(response, cc.connectorType):
+		case <-cc.clusterConnContext.Done():
+			cc.dropLateResponse(response)
+			return
+		}
+	}
+	log.Tracef("[%s] Response sent to response channel: %v", cc.connectorType, response.Header)
+}
+
+func (cc *ClusterConnector) dropLateResponse(response *frame.RawFrame) {
+	log.Debugf("[%s] Dropping response received after shutdown: %v", cc.connectorType, response.Header)
+	if cc.droppedLateResponses != nil {
+		cc.droppedLateResponses.Add(1)
+	}
+}
+
+// isUnknownStreamIdResponse returns true (and drops the response) if the response is not an event and there is
+// no outstanding request on this connection with its stream id, e.g. the late response of a request that timed out.
+func (cc *ClusterConnector) isUnknownStreamIdResponse(response *frame.RawFrame) bool {
+	if response.Header.OpCode == primitive.OpCodeEvent || cc.outstandingStreamIds.remove(response.Header.StreamId) {
+		return false
+	}
+
+	log.Warnf("[%s] Dropping response from %v with stream id %d because there is no outstanding request with this stream id: %v",
+		cc.connectorType, cc.clusterType, response.Header.StreamId, response.Header)
+	if cc.unknownStreamIdResponses != nil {
+		cc.unknownStreamIdResponses.Add(1)
+	}
+	return true
+}
+
+// isWrongDirectionFrame returns true (and drops the frame) if the cluster sent a frame with a request opcode, this
+// means that the cluster or the connection is broken so the frame can not be matched with a request.
+func (cc *ClusterConnector) isWrongDirectionFrame(response *frame.RawFrame) bool {
+	if !response.Header.OpCode.IsRequest() {
+		return false
+	}
+
+	log.Warnf("[%s] Dropping %v frame received from %v because it is not a response: %v",
+		cc.connectorType, response.Header.OpCode, cc.clusterType, response.Header)
+	if cc.wrongDirectionFrames != nil {
+		cc.wrongDirectionFrames.Add(1)
+	}
+	return true
+}
+
+// isUnregisteredEvent returns true (and drops the event) if the response is an event but no REGISTER request was sent
+// to the cluster. Clusters shouldn't send events without a registration but nothing would consume them in that case
+// so they could fill the events channel and stall this connector.
+func (cc *ClusterConnector) isUnregisteredEvent(response *frame.RawFrame) bool {
+	if response.Header.OpCode != primitive.OpCodeEvent || atomic.LoadInt32(&cc.eventsRegistered) == 1 {
+		return false
+	}
+
+	log.Warnf("[%s] Dropping event from %v because no REGISTER request was sent on this connection: %v",
+		cc.connectorType, cc.clusterType, response.Header)
+	if cc.unregisteredEvents != nil {
+		cc.unregisteredEvents.Add(1)
+	}
+	return true
+}
+
 func (cc *ClusterConnector) handleAsyncResponse(response *frame.RawFrame) *frame.RawFrame {
-	errMsg, err := decodeError(response)
+	errMsg, err := decodeError(cc.codec.get(), response)
 	if err != nil {
 		log.Errorf("[%s] Error occured while checking if error is a protocol error: %v.", cc.connectorType, err)
 		cc.Shutdown()
@@ -332,12 +478,12 @@ func (cc *ClusterConnector) handleAsyncResponse(response *frame.RawFrame) *frame
 							Keyspace: preparedData.GetPrepareRequestInfo().GetKeyspace(),
 						}
 						prepareFrame := frame.NewFrame(response.Header.Version, response.Header.StreamId, prepare)
-						prepareRawFrame, err := defaultCodec.ConvertToRawFrame(prepareFrame)
+						prepareRawFrame, err := cc.codec.get().ConvertToRawFrame(prepareFrame)
 						if err != nil {
 							log.Errorf("Could not send async PREPARE because convert raw frame failed: %v.", err.Error())
 						} else {
 							sent := cc.sendAsyncRequest(
-								preparedData.GetPrepareRequestInfo(), prepareRawFrame, false, time.Now(),
+								preparedData.GetPrepareRequestInfo(), prepareRawFrame, false, nowFunc(),
 								time.Duration(cc.conf.ProxyRequestTimeoutMs)*time.Millisecond,
 								func() {
 									cc.clientHandlerRequestWg.Done()
@@ -360,7 +506,17 @@ func (cc *ClusterConnector) handleAsyncResponse(response *frame.RawFrame) *frame
 	return nil
 }
 
+// reserveStreamId has to be called before the request is sent with sendRequestToCluster, it returns the generation of
+// the outstanding request or false if the stream id is still used by a request that timed out on this connection.
+func (cc *ClusterConnector) reserveStreamId(streamId int16) (uint64, bool) {
+	return cc.outstandingStreamIds.tryAdd(streamId)
+}
+
 func (cc *ClusterConnector) sendRequestToCluster(frame *frame.RawFrame) {
+	if frame.Header.OpCode == primitive.OpCodeRegister {
+		atomic.StoreInt32(&cc.eventsRegistered, 1)
+	}
+	cc.frameTypes.track(frame.Header.OpCode)
 	cc.writeCoalescer.Enqueue(frame)
 }
 
@@ -389,7 +545,21 @@ func (cc *ClusterConnector) validateAsyncStateForRequest(frame *frame.RawFrame)
 }
 
 func (cc *ClusterConnector) sendAsyncRequestToCluster(frame *frame.RawFrame) bool {
-	return cc.writeCoalescer.EnqueueAsync(frame)
+	if !cc.writeCoalescer.EnqueueAsync(frame) {
+		return false
+	}
+	cc.frameTypes.track(frame.Header.OpCode)
+	return true
+}
+
+// setStartupOptions retains the options of the client's STARTUP request (CQL version, compression, etc.) so that a new
+// connection to the cluster can be initialized with the same options as the connection that the client negotiated.
+func (cc *ClusterConnector) setStartupOptions(options map[string]string) {
+	startupOptions := make(map[string]string, len(options))
+	for option, value := range options {
+		startupOptions[option] = value
+	}
+	cc.startupOptions.Store(startupOptions)
 }
 
 func (cc *ClusterConnector) SetReady() bool {
@@ -0,0 +1,404 @@
+package zdmproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClusterConnector_DropsResponsesAfterShutdown(t *testing.T) {
+	proxySide, clusterSide := net.Pipe()
+	defer clusterSide.Close()
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	// nothing reads from the response channel, i.e. the client handler is not waiting for responses anymore
+	responseChan := make(chan *Response)
+	droppedLateResponses := &countingCounter{}
+	readScheduler := NewScheduler(1)
+	defer readScheduler.Shutdown()
+
+	cc := &ClusterConnector{
+		conf:                        config.New(),
+		connection:                  proxySide,
+		connectorType:               ClusterConnectorTypeOrigin,
+		droppedLateResponses:        droppedLateResponses,
+		clientHandlerWg:             &sync.WaitGroup{},
+		clusterConnContext:          ctx,
+		cancelFunc:                  cancelFn,
+		responseChan:                responseChan,
+		responseReadBufferSizeBytes: 1024,
+		doneChan:                    make(chan bool),
+		readScheduler:               readScheduler,
+	}
+	cc.runResponseListeningLoop()
+
+	response := mustEncodeFrame(t, &message.VoidResult{})
+	require.Nil(t, writeRawFrame(clusterSide, defaultCodec, "cluster", context.Background(), response))
+
+	// response is stuck waiting for the client handler until the connector is shut down
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, int64(0), droppedLateResponses.get())
+
+	cancelFn()
+	_ = proxySide.Close()
+
+	select {
+	case <-cc.doneChan:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "response listening loop did not finish after shutdown")
+	}
+	require.Equal(t, int64(1), droppedLateResponses.get())
+
+	// responses that are dispatched after shutdown are dropped right away
+	cc.dispatchResponse(mustEncodeFrame(t, &message.VoidResult{}))
+	require.Equal(t, int64(2), droppedLateResponses.get())
+}
+
+func TestClusterConnector_DropsUnknownStreamIdResponses(t *testing.T) {
+	proxySide, clusterSide := net.Pipe()
+	defer clusterSide.Close()
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	responseChan := make(chan *Response, 10)
+	eventsChan := make(chan *frame.RawFrame, 10)
+	unknownStreamIdResponses := &countingCounter{}
+	readScheduler := NewScheduler(1)
+	defer readScheduler.Shutdown()
+
+	cc := &ClusterConnector{
+		conf:                        config.New(),
+		connection:                  proxySide,
+		connectorType:               ClusterConnectorTypeTarget,
+		clusterConnEventsChan:       eventsChan,
+		unknownStreamIdResponses:    unknownStreamIdResponses,
+		clientHandlerWg:             &sync.WaitGroup{},
+		clusterConnContext:          ctx,
+		cancelFunc:                  cancelFn,
+		responseChan:                responseChan,
+		responseReadBufferSizeBytes: 1024,
+		doneChan:                    make(chan bool),
+		readScheduler:               readScheduler,
+		outstandingStreamIds:        newOutstandingStreamIds(time.Minute),
+		eventsRegistered:            1,
+	}
+	cc.runResponseListeningLoop()
+	cc.reserveStreamId(1)
+
+	writeResponse := func(streamId int16, msg message.Message) {
+		response, err := defaultCodec.ConvertToRawFrame(frame.NewFrame(primitive.ProtocolVersion4, streamId, msg))
+		require.Nil(t, err)
+		require.Nil(t, writeRawFrame(clusterSide, defaultCodec, "cluster", context.Background(), response))
+	}
+	writeResponse(1, &message.VoidResult{})
+	writeResponse(2, &message.VoidResult{}) // the proxy never sent a request with this stream id
+	writeResponse(1, &message.VoidResult{}) // the request with this stream id was already responded to
+	writeResponse(-1, &message.SchemaChangeEvent{ChangeType: primitive.SchemaChangeTypeCreated,
+		Target: primitive.SchemaChangeTargetKeyspace, Keyspace: "ks1"})
+
+	select {
+	case event := <-eventsChan:
+		require.Equal(t, primitive.OpCodeEvent, event.Header.OpCode)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "event was not dispatched")
+	}
+	require.Len(t, responseChan, 1)
+	response := <-responseChan
+	require.Equal(t, int16(1), response.GetStreamId())
+	require.Equal(t, int64(2), unknownStreamIdResponses.get())
+}
+
+func TestClusterConnector_StreamIdReusedAfterTimeout(t *testing.T) {
+	clock := newFakeClock(t)
+	proxySide, clusterSide := net.Pipe()
+	defer clusterSide.Close()
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	responseChan := make(chan *Response, 10)
+	unknownStreamIdResponses := &countingCounter{}
+	readScheduler := NewScheduler(1)
+	defer readScheduler.Shutdown()
+
+	cc := &ClusterConnector{
+		conf:                        config.New(),
+		connection:                  proxySide,
+		connectorType:               ClusterConnectorTypeOrigin,
+		unknownStreamIdResponses:    unknownStreamIdResponses,
+		clientHandlerWg:             &sync.WaitGroup{},
+		clusterConnContext:          ctx,
+		cancelFunc:                  cancelFn,
+		responseChan:                responseChan,
+		responseReadBufferSizeBytes: 1024,
+		doneChan:                    make(chan bool),
+		readScheduler:               readScheduler,
+		outstandingStreamIds:        newOutstandingStreamIds(time.Minute),
+	}
+	cc.runResponseListeningLoop()
+
+	writeResponse := func(streamId int16, msg message.Message) {
+		response, err := defaultCodec.ConvertToRawFrame(frame.NewFrame(primitive.ProtocolVersion4, streamId, msg))
+		require.Nil(t, err)
+		require.Nil(t, writeRawFrame(clusterSide, defaultCodec, "cluster", context.Background(), response))
+	}
+
+	// the first request with stream id 1 times out
+	firstGeneration, ok := cc.reserveStreamId(1)
+	require.True(t, ok)
+	cc.outstandingStreamIds.expire(1, firstGeneration)
+
+	// a new request can not reuse the stream id because its response could not be told apart from the late response
+	_, ok = cc.reserveStreamId(1)
+	require.False(t, ok)
+
+	// the late response of the request that timed out is dropped and it releases the stream id
+	writeResponse(1, &message.RowsResult{Metadata: &message.RowsMetadata{}, Data: message.RowSet{}})
+	require.Eventually(t, func() bool {
+		return unknownStreamIdResponses.get() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Len(t, responseChan, 0)
+
+	secondGeneration, ok := cc.reserveStreamId(1)
+	require.True(t, ok)
+	require.NotEqual(t, firstGeneration, secondGeneration)
+
+	// expiring a previous generation doesn't affect the request that reuses the stream id
+	cc.outstandingStreamIds.expire(1, firstGeneration)
+	writeResponse(1, &message.VoidResult{})
+	select {
+	case response := <-responseChan:
+		require.Equal(t, int16(1), response.GetStreamId())
+		require.Equal(t, primitive.OpCodeResult, response.responseFrame.Header.OpCode)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "response was not dispatched")
+	}
+	require.Equal(t, int64(1), unknownStreamIdResponses.get())
+
+	// the stream id is released if the cluster never responds to the request that timed out
+	thirdGeneration, ok := cc.reserveStreamId(1)
+	require.True(t, ok)
+	cc.outstandingStreamIds.expire(1, thirdGeneration)
+	clock.advance(59 * time.Second)
+	_, ok = cc.reserveStreamId(1)
+	require.False(t, ok)
+	clock.advance(time.Second)
+	_, ok = cc.reserveStreamId(1)
+	require.True(t, ok)
+}
+
+func TestClusterConnector_DropsWrongDirectionFrames(t *testing.T) {
+	proxySide, clusterSide := net.Pipe()
+	defer clusterSide.Close()
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	responseChan := make(chan *Response, 10)
+	unknownStreamIdResponses := &countingCounter{}
+	wrongDirectionFrames := &countingCounter{}
+	readScheduler := NewScheduler(1)
+	defer readScheduler.Shutdown()
+
+	cc := &ClusterConnector{
+		conf:                        config.New(),
+		connection:                  proxySide,
+		connectorType:               ClusterConnectorTypeOrigin,
+		unknownStreamIdResponses:    unknownStreamIdResponses,
+		wrongDirectionFrames:        wrongDirectionFrames,
+		clientHandlerWg:             &sync.WaitGroup{},
+		clusterConnContext:          ctx,
+		cancelFunc:                  cancelFn,
+		responseChan:                responseChan,
+		responseReadBufferSizeBytes: 1024,
+		doneChan:                    make(chan bool),
+		readScheduler:               readScheduler,
+		outstandingStreamIds:        newOutstandingStreamIds(time.Minute),
+	}
+	cc.runResponseListeningLoop()
+	cc.reserveStreamId(1)
+
+	writeFrame := func(streamId int16, msg message.Message) {
+		f, err := defaultCodec.ConvertToRawFrame(frame.NewFrame(primitive.ProtocolVersion4, streamId, msg))
+		require.Nil(t, err)
+		require.Nil(t, writeRawFrame(clusterSide, defaultCodec, "cluster", context.Background(), f))
+	}
+	// request frames don't release the stream id of the outstanding request
+	writeFrame(1, &message.Query{Query: "SELECT * FROM ks1.t", Options: &message.QueryOptions{}})
+	writeFrame(1, &message.Options{})
+	writeFrame(1, &message.VoidResult{})
+
+	select {
+	case response := <-responseChan:
+		require.Equal(t, int16(1), response.GetStreamId())
+		require.Equal(t, primitive.OpCodeResult, response.responseFrame.Header.OpCode)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "response was not dispatched")
+	}
+	require.Len(t, responseChan, 0)
+	require.Equal(t, int64(2), wrongDirectionFrames.get())
+	require.Equal(t, int64(0), unknownStreamIdResponses.get())
+}
+
+func TestClusterConnector_DropsUnregisteredEvents(t *testing.T) {
+	proxySide, clusterSide := net.Pipe()
+	defer clusterSide.Close()
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	// nothing consumes the events channel and it has no room for a single event
+	eventsChan := make(chan *frame.RawFrame)
+	responseChan := make(chan *Response, 10)
+	unregisteredEvents := &countingCounter{}
+	readScheduler := NewScheduler(1)
+	defer readScheduler.Shutdown()
+	writeScheduler := NewScheduler(1)
+	defer writeScheduler.Shutdown()
+
+	conf := config.New()
+	conf.RequestWriteQueueSizeFrames = 10
+	conf.RequestWriteBufferSizeBytes = 1024
+	cc := &ClusterConnector{
+		conf:                        conf,
+		connection:                  proxySide,
+		connectorType:               ClusterConnectorTypeOrigin,
+		clusterConnEventsChan:       eventsChan,
+		unregisteredEvents:          unregisteredEvents,
+		clientHandlerWg:             &sync.WaitGroup{},
+		clusterConnContext:          ctx,
+		cancelFunc:                  cancelFn,
+		responseChan:                responseChan,
+		responseReadBufferSizeBytes: 1024,
+		doneChan:                    make(chan bool),
+		readScheduler:               readScheduler,
+		outstandingStreamIds:        newOutstandingStreamIds(time.Minute),
+	}
+	cc.runResponseListeningLoop()
+
+	writeResponse := func(streamId int16, msg message.Message) {
+		response, err := defaultCodec.ConvertToRawFrame(frame.NewFrame(primitive.ProtocolVersion4, streamId, msg))
+		require.Nil(t, err)
+		require.Nil(t, writeRawFrame(clusterSide, defaultCodec, "cluster", context.Background(), response))
+	}
+	event := &message.SchemaChangeEvent{ChangeType: primitive.SchemaChangeTypeCreated,
+		Target: primitive.SchemaChangeTargetKeyspace, Keyspace: "ks1"}
+	writeResponse(-1, event)
+	writeResponse(-1, event)
+
+	// the connector doesn't stall on the events so responses are still dispatched
+	cc.reserveStreamId(1)
+	writeResponse(1, &message.VoidResult{})
+	select {
+	case response := <-responseChan:
+		require.Equal(t, int16(1), response.GetStreamId())
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "response was not dispatched")
+	}
+	require.Equal(t, int64(2), unregisteredEvents.get())
+
+	// events are dispatched once a REGISTER request was sent
+	cc.writeCoalescer = NewWriteCoalescer(conf, proxySide, &sync.WaitGroup{}, ctx, cancelFn, "test", true, false, writeScheduler, newConnectionFraming(false), nil)
+	cc.writeCoalescer.RunWriteQueueLoop()
+	cc.sendRequestToCluster(mustEncodeFrame(t, &message.Register{EventTypes: []primitive.EventType{primitive.EventTypeSchemaChange}}))
+	_, err := readRawFrame(clusterSide, "cluster", context.Background())
+	require.Nil(t, err)
+	writeResponse(-1, event)
+	select {
+	case dispatchedEvent := <-eventsChan:
+		require.Equal(t, primitive.OpCodeEvent, dispatchedEvent.Header.OpCode)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "event was not dispatched")
+	}
+	require.Equal(t, int64(2), unregisteredEvents.get())
+}
+
+func TestClientHandler_StoreStartupOptions(t *testing.T) {
+	ch := &ClientHandler{
+		originCassandraConnector: &ClusterConnector{connectorType: ClusterConnectorTypeOrigin},
+		targetCassandraConnector: &ClusterConnector{connectorType: ClusterConnectorTypeTarget},
+		asyncConnector:           &ClusterConnector{connectorType: ClusterConnectorTypeAsync},
+		currentKeyspaceName:      &atomic.Value{},
+	}
+
+	clientOptions := map[string]string{
+		message.StartupOptionCqlVersion:  "3.0.0",
+		message.StartupOptionCompression: "lz4",
+		message.StartupOptionDriverName:  "test driver",
+		startupOptionKeyspace:            "ks1",
+	}
+	require.Nil(t, ch.storeStartupOptions(mustEncodeFrame(t, &message.Startup{Options: clientOptions})))
+	require.Equal(t, "ks1", ch.LoadCurrentKeyspace())
+
+	for _, connector := range []*ClusterConnector{ch.originCassandraConnector, ch.targetCassandraConnector, ch.asyncConnector} {
+		require.Equal(t, clientOptions, connector.startupOptions.Load())
+	}
+}
+
+func TestClusterConnectTimeout(t *testing.T) {
+	connConfig := newGenericConnectionConfig(nil, 30000, common.ClusterTypeOrigin, "", nil)
+	originConnInfo := NewClusterConnectionInfo(connConfig, NewDefaultEndpoint("127.0.0.1", 9042, nil), true)
+	targetConnInfo := NewClusterConnectionInfo(connConfig, NewDefaultEndpoint("127.0.0.1", 9042, nil), false)
+
+	conf := config.New()
+	require.Equal(t, 30*time.Second, clusterConnectTimeout(conf, originConnInfo))
+	require.Equal(t, 30*time.Second, clusterConnectTimeout(conf, targetConnInfo))
+
+	conf.OriginConnectTimeoutMs = 500
+	require.Equal(t, 500*time.Millisecond, clusterConnectTimeout(conf, originConnInfo))
+	require.Equal(t, 30*time.Second, clusterConnectTimeout(conf, targetConnInfo))
+}
+
+func TestOpenConnectionToCluster_ConnectTimeout(t *testing.T) {
+	// the node accepts TCP connections but never responds to the TLS handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	var acceptedLock sync.Mutex
+	var accepted []net.Conn
+	defer func() {
+		acceptedLock.Lock()
+		defer acceptedLock.Unlock()
+		for _, conn := range accepted {
+			_ = conn.Close()
+		}
+	}()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			acceptedLock.Lock()
+			accepted = append(accepted, conn)
+			acceptedLock.Unlock()
+		}
+	}()
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	addr := l.Addr().(*net.TCPAddr)
+	connConfig := newGenericConnectionConfig(tlsConfig, 30000, common.ClusterTypeTarget, "", nil)
+	connInfo := NewClusterConnectionInfo(
+		connConfig, NewDefaultEndpoint(addr.IP.String(), addr.Port, tlsConfig), false)
+
+	conf := config.New()
+	conf.TargetConnectTimeoutMs = 200
+	start := time.Now()
+	_, _, err = openConnectionToCluster(
+		connInfo, context.Background(), clusterConnectTimeout(conf, connInfo), ClusterConnectorTypeTarget, nil, nil)
+	require.NotNil(t, err)
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+}
@@ -0,0 +1,239 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// clusterDownBuffer bounds the requests that are held back while a cluster that they are forwarded to is DOWN, see
+// ZDM_CLUSTER_DOWN_BUFFER_TIMEOUT_MS. A cluster is DOWN once its control connection reached
+// ZDM_HEARTBEAT_FAILURE_THRESHOLD and ZDM_HEARTBEAT_FAILURE_GRACE_PERIOD_MS (see ControlConn.IsDown) so that requests
+// are not held back because of an isolated heartbeat failure. The connections of the client handler to the clusters
+// are not re-established: if one of them is closed the client connection is closed as usual, so the requests are only
+// held back while these connections are still open. It is shared by every client connection of the proxy instance. A
+// nil clusterDownBuffer doesn't hold back any request.
+type clusterDownBuffer struct {
+	timeout          time.Duration
+	maxRequests      int32
+	requests         int32
+	failureThreshold int
+	gracePeriod      time.Duration
+}
+
+func newClusterDownBuffer(conf *config.Config) *clusterDownBuffer {
+	if conf.ClusterDownBufferTimeoutMs <= 0 {
+		return nil
+	}
+	return &clusterDownBuffer{
+		timeout:          time.Duration(conf.ClusterDownBufferTimeoutMs) * time.Millisecond,
+		maxRequests:      int32(conf.ClusterDownBufferMaxRequests),
+		failureThreshold: conf.HeartbeatFailureThreshold,
+		gracePeriod:      time.Duration(conf.HeartbeatFailureGracePeriodMs) * time.Millisecond,
+	}
+}
+
+// tryAcquire returns false if ZDM_CLUSTER_DOWN_BUFFER_MAX_REQUESTS requests are held back already.
+func (recv *clusterDownBuffer) tryAcquire() bool {
+	requests := atomic.AddInt32(&recv.requests, 1)
+	if recv.maxRequests > 0 && requests > recv.maxRequests {
+		atomic.AddInt32(&recv.requests, -1)
+		return false
+	}
+	return true
+}
+
+func (recv *clusterDownBuffer) release() {
+	atomic.AddInt32(&recv.requests, -1)
+}
+
+// heldRequests is the queue of the requests of a client connection that are held back by the clusterDownBuffer. The
+// requests are forwarded one by one in the order in which they were received so that the requests that were held back
+// are not reordered and that the requests received while some are held back do not overtake them.
+type heldRequests struct {
+	lock     *sync.Mutex
+	requests []*heldRequest
+}
+
+type heldRequest struct {
+	request          *frame.RawFrame
+	reconnectedChans []<-chan struct{}
+	deadline         time.Time
+	execute          func() error
+}
+
+func newHeldRequests() *heldRequests {
+	return &heldRequests{lock: &sync.Mutex{}}
+}
+
+// getReconnectedChans returns the reconnected channels of the control connections of the clusters that the request
+// is forwarded to and that are DOWN, see ControlConn.GetReconnectedChanIfDown.
+func (ch *ClientHandler) getReconnectedChans(decision forwardDecision) []<-chan struct{} {
+	var controlConns []*ControlConn
+	switch decision {
+	case forwardToOrigin:
+		controlConns = []*ControlConn{ch.originControlConn}
+	case forwardToTarget:
+		controlConns = []*ControlConn{ch.targetControlConn}
+	case forwardToBoth:
+		controlConns = []*ControlConn{ch.originControlConn, ch.targetControlConn}
+	}
+
+	var reconnectedChans []<-chan struct{}
+	for _, controlConn := range controlConns {
+		if controlConn == nil {
+			continue
+		}
+		reconnectedChan := controlConn.GetReconnectedChanIfDown(
+			ch.clusterDownBuffer.failureThreshold, ch.clusterDownBuffer.gracePeriod)
+		if reconnectedChan != nil {
+			reconnectedChans = append(reconnectedChans, reconnectedChan)
+		}
+	}
+	return reconnectedChans
+}
+
+// isIdempotentRequest returns true for the requests that can be forwarded later (or again) without changing the
+// outcome, i.e. reads, PREPARE and OPTIONS requests. Writes and batches are not idempotent in general (e.g. counter
+// updates, LWTs or list appends) so they are never held back while a cluster that they are forwarded to is DOWN.
+func (ch *ClientHandler) isIdempotentRequest(context *frameDecodeContext, requestInfo RequestInfo) bool {
+	switch typedRequestInfo := requestInfo.(type) {
+	case *PrepareRequestInfo:
+		return true
+	case *ExecuteRequestInfo:
+		query := typedRequestInfo.GetPreparedData().GetPrepareRequestInfo().GetQuery()
+		return inspectCqlQuery(query, "", ch.timeUuidGenerator).getStatementType() == statementTypeSelect
+	}
+
+	switch context.GetRawFrame().Header.OpCode {
+	case primitive.OpCodeOptions:
+		return true
+	case primitive.OpCodeQuery:
+		stmtQueryData, err := context.GetOrInspectStatement("", ch.timeUuidGenerator)
+		if err != nil {
+			log.Debugf("Could not inspect request with stream id %v, it is not considered idempotent: %v",
+				context.GetRawFrame().Header.StreamId, err)
+			return false
+		}
+		return stmtQueryData.queryData.getStatementType() == statementTypeSelect
+	default:
+		return false
+	}
+}
+
+// holdWhileClusterDown returns true if the request was taken over because a cluster that it is forwarded to is DOWN
+// or because previous requests of this client connection are held back already. Idempotent requests are held back (up
+// to ZDM_CLUSTER_DOWN_BUFFER_MAX_REQUESTS) and forwarded in order with the provided function once the control
+// connection of every cluster that they are forwarded to is reconnected or when ZDM_CLUSTER_DOWN_BUFFER_TIMEOUT_MS
+// expires. Other requests are rejected with OVERLOADED if one of their clusters is DOWN so that the client can decide
+// whether to retry them, they are only held back behind the requests that precede them otherwise. Requests of the
+// proxy itself (customResponseChannel) are not affected.
+func (ch *ClientHandler) holdWhileClusterDown(
+	context *frameDecodeContext, requestInfo RequestInfo, customResponseChannel chan *customResponse,
+	execute func() error) bool {
+	if ch.clusterDownBuffer == nil || ch.heldRequests == nil || customResponseChannel != nil {
+		return false
+	}
+	reconnectedChans := ch.getReconnectedChans(requestInfo.GetForwardDecision())
+
+	ch.heldRequests.lock.Lock()
+	defer ch.heldRequests.lock.Unlock()
+	queueEmpty := len(ch.heldRequests.requests) == 0
+	if len(reconnectedChans) == 0 && queueEmpty {
+		return false
+	}
+
+	request := context.GetRawFrame()
+	rejectReason := ""
+	if len(reconnectedChans) != 0 && !ch.isIdempotentRequest(context, requestInfo) {
+		rejectReason = "it is not safe to forward it later"
+	} else if !ch.clusterDownBuffer.tryAcquire() {
+		rejectReason = "too many requests are held back already"
+	}
+	if rejectReason != "" {
+		ch.metricHandler.GetProxyMetrics().ClusterDownRejectedRequests.Add(1)
+		log.Debugf("Rejecting request with stream id %v because a cluster is DOWN and %v.",
+			request.Header.StreamId, rejectReason)
+		ch.clientConnector.sendOverloadedWithMessageToClient(
+			request, fmt.Sprintf("A cluster is DOWN and %v, please retry.", rejectReason))
+		return true
+	}
+
+	ch.metricHandler.GetProxyMetrics().ClusterDownBufferedRequests.Add(1)
+	log.Debugf("Holding back request with stream id %v until the cluster is UP again.", request.Header.StreamId)
+	ch.heldRequests.requests = append(ch.heldRequests.requests, &heldRequest{
+		request:          request,
+		reconnectedChans: reconnectedChans,
+		deadline:         nowFunc().Add(ch.clusterDownBuffer.timeout),
+		execute:          execute,
+	})
+	if queueEmpty {
+		ch.clientHandlerRequestWaitGroup.Add(1)
+		go ch.forwardHeldRequests()
+	}
+	return true
+}
+
+// forwardHeldRequests forwards the held back requests in order until the queue is empty. A request stays at the head
+// of the queue until it is forwarded so that the requests received in the meantime are queued behind it.
+func (ch *ClientHandler) forwardHeldRequests() {
+	defer ch.clientHandlerRequestWaitGroup.Done()
+	ch.heldRequests.lock.Lock()
+	held := ch.heldRequests.requests[0]
+	ch.heldRequests.lock.Unlock()
+	for {
+		if !ch.waitForClusterUp(held) {
+			ch.heldRequests.lock.Lock()
+			for range ch.heldRequests.requests {
+				ch.clusterDownBuffer.release()
+			}
+			ch.heldRequests.requests = nil
+			ch.heldRequests.lock.Unlock()
+			return
+		}
+
+		if ch.clientHandlerShutdownRequestContext.Err() != nil {
+			ch.clientConnector.sendOverloadedToClient(held.request)
+		} else if err := held.execute(); err != nil {
+			log.Warnf("Could not forward request with stream id %v that was held back while a cluster was DOWN: %v",
+				held.request.Header.StreamId, err)
+		}
+
+		ch.heldRequests.lock.Lock()
+		ch.heldRequests.requests = ch.heldRequests.requests[1:]
+		ch.clusterDownBuffer.release()
+		if len(ch.heldRequests.requests) == 0 {
+			ch.heldRequests.lock.Unlock()
+			return
+		}
+		held = ch.heldRequests.requests[0]
+		ch.heldRequests.lock.Unlock()
+	}
+}
+
+// waitForClusterUp waits until the control connection of every cluster that the request is held back for is
+// reconnected or until its deadline, it returns false if the client connection is closed in the meantime.
+func (ch *ClientHandler) waitForClusterUp(held *heldRequest) bool {
+	if ch.clientHandlerContext.Err() != nil {
+		return false
+	}
+	timer := time.NewTimer(held.deadline.Sub(nowFunc()))
+	defer timer.Stop()
+	for _, reconnectedChan := range held.reconnectedChans {
+		select {
+		case <-reconnectedChan:
+		case <-timer.C:
+			log.Debugf("Cluster was still DOWN after %v, forwarding request with stream id %v anyway.",
+				ch.clusterDownBuffer.timeout, held.request.Header.StreamId)
+			return true
+		case <-ch.clientHandlerContext.Done():
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+package zdmproxy
+
+import (
+	"context"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	"github.com/stretchr/testify/require"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHoldWhileClusterDown(t *testing.T) {
+	clock := newFakeClock(t)
+	proxySide, clientSide := net.Pipe()
+	defer proxySide.Close()
+	defer clientSide.Close()
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	conf := config.New()
+	conf.ClusterDownBufferTimeoutMs = 60000
+	conf.ClusterDownBufferMaxRequests = 2
+	conf.HeartbeatFailureThreshold = 2
+	conf.HeartbeatFailureGracePeriodMs = 1000
+	writeScheduler := NewScheduler(1)
+	defer writeScheduler.Shutdown()
+	writeCoalescer := NewWriteCoalescer(
+		conf, proxySide, &sync.WaitGroup{}, ctx, cancelFn, "ClientConnector", false, false, writeScheduler,
+		newConnectionFraming(true), nil)
+	writeCoalescer.RunWriteQueueLoop()
+	defer writeCoalescer.Close()
+
+	proxyMetrics := newFakeProxyMetrics()
+	bufferedRequests := &countingCounter{}
+	proxyMetrics.ClusterDownBufferedRequests = bufferedRequests
+	rejectedRequests := &countingCounter{}
+	proxyMetrics.ClusterDownRejectedRequests = rejectedRequests
+	ch := &ClientHandler{
+		conf:                                conf,
+		clientConnector:                     &ClientConnector{connection: proxySide, writeCoalescer: writeCoalescer},
+		originControlConn:                   &ControlConn{counterLock: &sync.RWMutex{}},
+		targetControlConn:                   &ControlConn{counterLock: &sync.RWMutex{}},
+		clusterDownBuffer:                   newClusterDownBuffer(conf),
+		heldRequests:                        newHeldRequests(),
+		clientHandlerRequestWaitGroup:       &requestWaitGroup{},
+		clientHandlerContext:                ctx,
+		clientHandlerShutdownRequestContext: context.Background(),
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+	read := NewFrameDecodeContext(mustEncodeFrame(t, &message.Query{Query: "SELECT * FROM ks.tb"}))
+	write := NewFrameDecodeContext(mustEncodeFrame(t, &message.Query{Query: "INSERT INTO ks.tb (a) VALUES (1)"}))
+	forwarded := make(chan int, 2)
+	execute := func(i int) func() error {
+		return func() error {
+			forwarded <- i
+			return nil
+		}
+	}
+	notExecuted := func() error {
+		require.Fail(t, "request should have been taken over")
+		return nil
+	}
+
+	// requests are forwarded right away if the clusters are connected
+	require.False(t, ch.holdWhileClusterDown(read, NewGenericRequestInfo(forwardToOrigin, false, true), nil, notExecuted))
+
+	// ORIGIN is not DOWN until ZDM_HEARTBEAT_FAILURE_THRESHOLD and ZDM_HEARTBEAT_FAILURE_GRACE_PERIOD_MS are reached
+	ch.originControlConn.IncrementFailureCounter()
+	ch.originControlConn.IncrementFailureCounter()
+	require.False(t, ch.holdWhileClusterDown(read, NewGenericRequestInfo(forwardToOrigin, false, true), nil, notExecuted))
+	require.False(t, ch.holdWhileClusterDown(write, NewGenericRequestInfo(forwardToBoth, false, true), nil, notExecuted))
+	clock.advance(time.Second)
+
+	// reads are held back while ORIGIN is DOWN
+	require.True(t, ch.holdWhileClusterDown(read, NewGenericRequestInfo(forwardToOrigin, false, true), nil, execute(1)))
+	require.Equal(t, int64(1), bufferedRequests.get())
+
+	// requests that are only forwarded to TARGET are held back behind the requests that precede them
+	require.True(t, ch.holdWhileClusterDown(read, NewGenericRequestInfo(forwardToTarget, false, true), nil, execute(2)))
+	require.Equal(t, int64(2), bufferedRequests.get())
+
+	// writes are rejected right away
+	require.True(t, ch.holdWhileClusterDown(write, NewGenericRequestInfo(forwardToBoth, false, true), nil, notExecuted))
+	requireOverloadedResponse(t, clientSide, "A cluster is DOWN and it is not safe to forward it later, please retry.")
+
+	// reads are rejected once ZDM_CLUSTER_DOWN_BUFFER_MAX_REQUESTS requests are held back
+	require.True(t, ch.holdWhileClusterDown(read, NewGenericRequestInfo(forwardToBoth, false, true), nil, notExecuted))
+	requireOverloadedResponse(t, clientSide, "A cluster is DOWN and too many requests are held back already, please retry.")
+	require.Equal(t, int64(2), rejectedRequests.get())
+
+	select {
+	case i := <-forwarded:
+		require.Fail(t, "request was forwarded before ORIGIN reconnected", "request %v", i)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the held back requests are forwarded in order once ORIGIN is reconnected so the client doesn't notice the outage
+	ch.originControlConn.ResetFailureCounter()
+	for i := 1; i <= 2; i++ {
+		select {
+		case forwardedRequest := <-forwarded:
+			require.Equal(t, i, forwardedRequest)
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "request was not forwarded after ORIGIN reconnected", "request %v", i)
+		}
+	}
+	ch.clientHandlerRequestWaitGroup.Wait()
+	require.Empty(t, ch.heldRequests.requests)
+	require.True(t, ch.clusterDownBuffer.tryAcquire())
+	require.True(t, ch.clusterDownBuffer.tryAcquire())
+	require.False(t, ch.holdWhileClusterDown(write, NewGenericRequestInfo(forwardToBoth, false, true), nil, notExecuted))
+}
+
+func TestHoldWhileClusterDown_Timeout(t *testing.T) {
+	conf := config.New()
+	conf.ClusterDownBufferTimeoutMs = 20
+	conf.ClusterDownBufferMaxRequests = 0
+	ch := &ClientHandler{
+		originControlConn:                   &ControlConn{counterLock: &sync.RWMutex{}},
+		clusterDownBuffer:                   newClusterDownBuffer(conf),
+		heldRequests:                        newHeldRequests(),
+		clientHandlerRequestWaitGroup:       &requestWaitGroup{},
+		clientHandlerContext:                context.Background(),
+		clientHandlerShutdownRequestContext: context.Background(),
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, newFakeProxyMetrics(), nil, nil, nil),
+	}
+	ch.originControlConn.IncrementFailureCounter()
+	executed := make(chan struct{})
+	prepare := NewFrameDecodeContext(mustEncodeFrame(t, &message.Prepare{Query: "INSERT INTO ks.tb (a) VALUES (?)"}))
+	prepareRequestInfo := NewPrepareRequestInfo(
+		NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "INSERT INTO ks.tb (a) VALUES (?)", "")
+	require.True(t, ch.holdWhileClusterDown(prepare, prepareRequestInfo, nil, func() error {
+		close(executed)
+		return nil
+	}))
+
+	// the request is forwarded anyway once ZDM_CLUSTER_DOWN_BUFFER_TIMEOUT_MS expires
+	select {
+	case <-executed:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "request was not forwarded after the timeout")
+	}
+	ch.clientHandlerRequestWaitGroup.Wait()
+}
+
+func TestHoldWhileClusterDown_ClientHandlerClosed(t *testing.T) {
+	conf := config.New()
+	conf.ClusterDownBufferTimeoutMs = 60000
+	ctx, cancelFn := context.WithCancel(context.Background())
+	ch := &ClientHandler{
+		originControlConn:                   &ControlConn{counterLock: &sync.RWMutex{}},
+		clusterDownBuffer:                   newClusterDownBuffer(conf),
+		heldRequests:                        newHeldRequests(),
+		clientHandlerRequestWaitGroup:       &requestWaitGroup{},
+		clientHandlerContext:                ctx,
+		clientHandlerShutdownRequestContext: context.Background(),
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, newFakeProxyMetrics(), nil, nil, nil),
+	}
+	ch.originControlConn.IncrementFailureCounter()
+	read := NewFrameDecodeContext(mustEncodeFrame(t, &message.Query{Query: "SELECT * FROM ks.tb"}))
+	for i := 0; i < 3; i++ {
+		require.True(t, ch.holdWhileClusterDown(read, NewGenericRequestInfo(forwardToOrigin, false, true), nil,
+			func() error {
+				require.Fail(t, "request was forwarded after the client connection was closed")
+				return nil
+			}))
+	}
+
+	// the held back requests are dropped and their slots are released when the client connection is closed
+	cancelFn()
+	ch.clientHandlerRequestWaitGroup.Wait()
+	require.Empty(t, ch.heldRequests.requests)
+	require.Equal(t, int32(0), ch.clusterDownBuffer.requests)
+}
+
+func TestHoldWhileClusterDown_Disabled(t *testing.T) {
+	require.Nil(t, newClusterDownBuffer(config.New()))
+
+	ch := &ClientHandler{originControlConn: &ControlConn{counterLock: &sync.RWMutex{}}}
+	ch.originControlConn.IncrementFailureCounter()
+	read := NewFrameDecodeContext(mustEncodeFrame(t, &message.Query{Query: "SELECT * FROM ks.tb"}))
+	require.False(t, ch.holdWhileClusterDown(read, NewGenericRequestInfo(forwardToOrigin, false, true), nil,
+		func() error { return nil }))
+}
+
+func requireOverloadedResponse(t *testing.T, clientSide net.Conn, expectedMessage string) {
+	response, err := decodeFrame(clientSide, defaultCodec)
+	require.Nil(t, err)
+	overloaded, ok := response.Body.Message.(*message.Overloaded)
+	require.True(t, ok, "expected OVERLOADED but got %v", response.Body.Message)
+	require.Equal(t, expectedMessage, overloaded.ErrorMessage)
+}
@@ -8,10 +8,14 @@ import (
 	log "github.com/sirupsen/logrus"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	initialBufferSize = 1024
+
+	flushPollInterval = 5 * time.Millisecond
 )
 
 // Coalesces writes using a write buffer
@@ -32,6 +36,12 @@ type writeCoalescer struct {
 	writeBufferSizeBytes int
 
 	scheduler *Scheduler
+
+	framing *connectionFraming
+	codec   *connectionCodec
+
+	// frames that were enqueued but not written (or discarded) yet
+	pendingFrames int64
 }
 
 func NewWriteCoalescer(
@@ -43,7 +53,9 @@ func NewWriteCoalescer(
 	logPrefix string,
 	isRequest bool,
 	isAsync bool,
-	scheduler *Scheduler) *writeCoalescer {
+	scheduler *Scheduler,
+	framing *connectionFraming,
+	codec *connectionCodec) *writeCoalescer {
 
 	writeQueueSizeFrames := conf.RequestWriteQueueSizeFrames
 	if !isRequest {
@@ -71,6 +83,8 @@ func NewWriteCoalescer(
 		waitGroup:              &sync.WaitGroup{},
 		writeBufferSizeBytes:   writeBufferSizeBytes,
 		scheduler:              scheduler,
+		framing:                framing,
+		codec:                  codec,
 	}
 }
 
@@ -105,6 +119,8 @@ func (recv *writeCoalescer) RunWriteQueueLoop() {
 			recv.scheduler.Schedule(func() {
 				defer wg.Done()
 				firstFrameRead := false
+				frames := 0
+				encoder := newSegmentEncoder(recv.codec)
 				for {
 					var f *frame.RawFrame
 					var ok bool
@@ -116,15 +132,18 @@ func (recv *writeCoalescer) RunWriteQueueLoop() {
 						}
 
 						if !ok {
+							tempDraining = recv.flushSegment(tempBuffer, encoder, tempDraining, connectionAddr)
 							t := &coalescerIterationResult{
 								buffer:   tempBuffer,
 								draining: tempDraining,
+								frames:   frames,
 							}
 							resultChannel <- t
 							close(resultChannel)
 							return
 						}
 
+						frames++
 						if tempDraining {
 							// continue draining the write queue without writing on connection until it is closed
 							log.Tracef("[%v] Discarding frame from write queue because shutdown was requested: %v", recv.logPrefix, f.Header)
@@ -132,20 +151,23 @@ func (recv *writeCoalescer) RunWriteQueueLoop() {
 						}
 					} else {
 						firstFrameRead = true
+						frames++
 						f = firstFrame
 						ok = true
 					}
 
 					log.Tracef("[%v] Writing %v on %v", recv.logPrefix, f.Header, connectionAddr)
-					err := writeRawFrame(tempBuffer, connectionAddr, recv.shutdownContext, f)
+					err := recv.writeFrame(tempBuffer, encoder, connectionAddr, f)
 					if err != nil {
 						tempDraining = true
 						handleConnectionError(err, recv.shutdownContext, recv.cancelFunc, recv.logPrefix, "writing", connectionAddr)
 					} else {
-						if tempBuffer.Len() >= recv.writeBufferSizeBytes {
+						if tempBuffer.Len()+encoder.pendingBytes() >= recv.writeBufferSizeBytes {
+							tempDraining = recv.flushSegment(tempBuffer, encoder, tempDraining, connectionAddr)
 							t := &coalescerIterationResult{
 								buffer:   tempBuffer,
 								draining: tempDraining,
+								frames:   frames,
 							}
 							resultChannel <- t
 							close(resultChannel)
@@ -170,28 +192,95 @@ func (recv *writeCoalescer) RunWriteQueueLoop() {
 					draining = true
 				}
 			}
+			atomic.AddInt64(&recv.pendingFrames, -int64(result.frames))
 		}
 	}()
 }
 
+// writeFrame writes the frame to the buffer with the current framing format of the connection, frames in the v5 framing
+// format are only written to the buffer when the current segment is flushed.
+func (recv *writeCoalescer) writeFrame(
+	buffer *bytes.Buffer, encoder *segmentEncoder, connectionAddr string, f *frame.RawFrame) error {
+	if recv.framing.isModern() {
+		return adaptConnErr(connectionAddr, recv.shutdownContext, encoder.writeFrame(f, buffer))
+	}
+
+	err := writeRawFrame(buffer, recv.codec.get(), connectionAddr, recv.shutdownContext, f)
+	if err == nil {
+		recv.framing.frameWritten(f)
+	}
+	return err
+}
+
+// flushSegment writes the pending segment to the buffer and returns whether the write queue should be drained.
+func (recv *writeCoalescer) flushSegment(
+	buffer *bytes.Buffer, encoder *segmentEncoder, draining bool, connectionAddr string) bool {
+	if draining {
+		return draining
+	}
+	err := encoder.flush(buffer)
+	if err != nil {
+		handleConnectionError(err, recv.shutdownContext, recv.cancelFunc, recv.logPrefix, "writing", connectionAddr)
+		return true
+	}
+	return false
+}
+
 func (recv *writeCoalescer) Enqueue(frame *frame.RawFrame) {
 	log.Tracef("[%v] Sending %v to write queue on %v", recv.logPrefix, frame.Header, recv.connection.RemoteAddr())
+	atomic.AddInt64(&recv.pendingFrames, 1)
 	recv.writeQueue <- frame
 	log.Tracef("[%v] Sent %v to write queue on %v", recv.logPrefix, frame.Header, recv.connection.RemoteAddr())
 }
 
 func (recv *writeCoalescer) EnqueueAsync(frame *frame.RawFrame) bool {
 	log.Tracef("[%v] Sending %v to write queue on %v", recv.logPrefix, frame.Header, recv.connection.RemoteAddr())
+	atomic.AddInt64(&recv.pendingFrames, 1)
 	select {
 	case recv.writeQueue <- frame:
 		log.Tracef("[%v] Sent %v to write queue on %v", recv.logPrefix, frame.Header, recv.connection.RemoteAddr())
 		return true
 	default:
+		atomic.AddInt64(&recv.pendingFrames, -1)
 		log.Debugf("[%v] Discarded %v because write queue is full on %v", recv.logPrefix, frame.Header, recv.connection.RemoteAddr())
 		return false
 	}
 }
 
+// EnqueueWithTimeout returns false without sending the frame if the write queue is still full after the timeout.
+func (recv *writeCoalescer) EnqueueWithTimeout(frame *frame.RawFrame, timeout time.Duration) bool {
+	if timeout <= 0 {
+		return recv.EnqueueAsync(frame)
+	}
+	log.Tracef("[%v] Sending %v to write queue on %v", recv.logPrefix, frame.Header, recv.connection.RemoteAddr())
+	atomic.AddInt64(&recv.pendingFrames, 1)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case recv.writeQueue <- frame:
+		log.Tracef("[%v] Sent %v to write queue on %v", recv.logPrefix, frame.Header, recv.connection.RemoteAddr())
+		return true
+	case <-timer.C:
+		atomic.AddInt64(&recv.pendingFrames, -1)
+		log.Debugf("[%v] Discarded %v because write queue is still full after %v on %v",
+			recv.logPrefix, frame.Header, timeout, recv.connection.RemoteAddr())
+		return false
+	}
+}
+
+// WaitUntilFlushed waits until all the frames that were enqueued have been written to the connection and returns
+// false if there are frames still pending after the timeout.
+func (recv *writeCoalescer) WaitUntilFlushed(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt64(&recv.pendingFrames) > 0 {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(flushPollInterval)
+	}
+	return true
+}
+
 func (recv *writeCoalescer) Close() {
 	close(recv.writeQueue)
 	recv.waitGroup.Wait()
@@ -200,4 +289,5 @@ func (recv *writeCoalescer) Close() {
 type coalescerIterationResult struct {
 	buffer   *bytes.Buffer
 	draining bool
+	frames   int
 }
@@ -0,0 +1,133 @@
+package zdmproxy
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/compression/lz4"
+	"github.com/datastax/go-cassandra-native-protocol/compression/snappy"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync/atomic"
+)
+
+// compressionBridge bridges the compression that the client negotiated with the clusters that don't support it
+// (see ZDM_ORIGIN_COMPRESSION_BRIDGE_ENABLED and ZDM_TARGET_COMPRESSION_BRIDGE_ENABLED). The COMPRESSION option is
+// stripped from the STARTUP request that is forwarded to a bridged cluster, the client's requests are decompressed
+// when they are received and the responses that are returned to the client are compressed.
+// Requests are forwarded uncompressed to every cluster, this is valid even for a cluster that negotiated compression
+// because compression is flagged per frame, and it allows the proxy to inspect them.
+// A nil compressionBridge forwards every frame as is.
+type compressionBridge struct {
+	// negotiatedCompressor of the algorithm that the client negotiated, see setCompression
+	compressor atomic.Value
+
+	// responses with a smaller body are not compressed, see ZDM_COMPRESSION_BRIDGE_MIN_BODY_SIZE_BYTES
+	minBodySize int
+}
+
+func newCompressionBridge(originBridged bool, targetBridged bool, minBodySize int) *compressionBridge {
+	if !originBridged && !targetBridged {
+		return nil
+	}
+	return &compressionBridge{minBodySize: minBodySize}
+}
+
+// negotiatedCompressor wraps the frame.BodyCompressor so that atomic.Value always stores the same concrete type, the
+// compressor is nil if the client did not negotiate compression.
+type negotiatedCompressor struct {
+	compressor frame.BodyCompressor
+}
+
+// setCompression stores the compression algorithm of the client's STARTUP request, it has to be called before the
+// STARTUP response is returned to the client because the client starts compressing frames right after it.
+// Every STARTUP request replaces the compression of the previous one. The bridge is never armed with protocol v5 and
+// later because the proxy doesn't compress segments, see rejectUnsupportedStartupCompression.
+func (recv *compressionBridge) setCompression(version primitive.ProtocolVersion, compression primitive.Compression) error {
+	if recv == nil {
+		return nil
+	}
+
+	compression = primitive.Compression(strings.ToUpper(string(compression)))
+	if compression != primitive.CompressionNone && version >= primitive.ProtocolVersion5 {
+		return fmt.Errorf("compression %v is not supported by the proxy with protocol version %v", compression, version)
+	}
+
+	var compressor frame.BodyCompressor
+	switch compression {
+	case primitive.CompressionNone:
+	case primitive.CompressionLz4:
+		compressor = lz4.Compressor{}
+	case primitive.CompressionSnappy:
+		compressor = snappy.Compressor{}
+	default:
+		return fmt.Errorf("compression %v is not supported by the proxy", compression)
+	}
+	if compressor != nil {
+		log.Debugf("Client negotiated %v compression, bridging it with the clusters that don't support it.", compression)
+	}
+	recv.compressor.Store(negotiatedCompressor{compressor: compressor})
+	return nil
+}
+
+func (recv *compressionBridge) getCompressor() frame.BodyCompressor {
+	if recv == nil {
+		return nil
+	}
+	negotiated, ok := recv.compressor.Load().(negotiatedCompressor)
+	if !ok {
+		return nil
+	}
+	return negotiated.compressor
+}
+
+// decompressRequest returns the client's request with an uncompressed body, it is the provided request if it is not
+// compressed.
+func (recv *compressionBridge) decompressRequest(request *frame.RawFrame) (*frame.RawFrame, error) {
+	if recv == nil || !request.Header.Flags.Contains(primitive.HeaderFlagCompressed) {
+		return request, nil
+	}
+
+	compressor := recv.getCompressor()
+	if compressor == nil {
+		return nil, fmt.Errorf("received compressed %v request but the client did not negotiate compression", request.Header.OpCode)
+	}
+
+	body := &bytes.Buffer{}
+	err := compressor.DecompressWithLength(bytes.NewReader(request.Body), body)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress %v request: %w", request.Header.OpCode, err)
+	}
+
+	header := request.Header.Clone()
+	header.Flags = header.Flags.Remove(primitive.HeaderFlagCompressed)
+	header.BodyLength = int32(body.Len())
+	return &frame.RawFrame{Header: header, Body: body.Bytes()}, nil
+}
+
+// compressResponse returns the response that is returned to the client, it is compressed if the client negotiated
+// compression and the cluster that returned it doesn't compress its responses. Frames are never compressed
+// individually with protocol v5 and later and responses with a body smaller than minBodySize are returned uncompressed.
+func (recv *compressionBridge) compressResponse(response *frame.RawFrame) (*frame.RawFrame, error) {
+	if recv == nil || response.Header.Flags.Contains(primitive.HeaderFlagCompressed) ||
+		response.Header.Version >= primitive.ProtocolVersion5 || len(response.Body) < recv.minBodySize {
+		return response, nil
+	}
+
+	compressor := recv.getCompressor()
+	if compressor == nil {
+		return response, nil
+	}
+
+	body := &bytes.Buffer{}
+	err := compressor.CompressWithLength(bytes.NewReader(response.Body), body)
+	if err != nil {
+		return nil, fmt.Errorf("could not compress %v response: %w", response.Header.OpCode, err)
+	}
+
+	header := response.Header.Clone()
+	header.Flags = header.Flags.Add(primitive.HeaderFlagCompressed)
+	header.BodyLength = int32(body.Len())
+	return &frame.RawFrame{Header: header, Body: body.Bytes()}, nil
+}
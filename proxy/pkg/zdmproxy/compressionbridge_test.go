@@ -0,0 +1,180 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/compression/lz4"
+	"github.com/datastax/go-cassandra-native-protocol/compression/snappy"
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCompressionBridge(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression primitive.Compression
+		compressor  frame.BodyCompressor
+	}{
+		{"lz4", "lz4", lz4.Compressor{}},
+		{"snappy", primitive.CompressionSnappy, snappy.Compressor{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientCodec := frame.NewRawCodecWithCompression(tt.compressor)
+			bridge := newCompressionBridge(false, true, 0)
+			require.Nil(t, bridge.setCompression(primitive.ProtocolVersion4, tt.compression))
+
+			// client to cluster
+			query := &message.Query{Query: "INSERT INTO ks.t (a) VALUES (1)", Options: &message.QueryOptions{}}
+			requestFrame := frame.NewFrame(primitive.ProtocolVersion4, 1, query)
+			requestFrame.SetCompress(true)
+			compressedRequest, err := clientCodec.ConvertToRawFrame(requestFrame)
+			require.Nil(t, err)
+			request, err := bridge.decompressRequest(compressedRequest)
+			require.Nil(t, err)
+			require.False(t, request.Header.Flags.Contains(primitive.HeaderFlagCompressed))
+			require.Equal(t, int32(len(request.Body)), request.Header.BodyLength)
+			decodedRequest, err := defaultCodec.ConvertFromRawFrame(request)
+			require.Nil(t, err)
+			require.Equal(t, query, decodedRequest.Body.Message)
+
+			uncompressedRequest := mustEncodeFrame(t, query)
+			request, err = bridge.decompressRequest(uncompressedRequest)
+			require.Nil(t, err)
+			require.Same(t, uncompressedRequest, request)
+
+			// cluster to client
+			uncompressedResponse := mustEncodeFrame(t, &message.SetKeyspaceResult{Keyspace: "ks"})
+			response, err := bridge.compressResponse(uncompressedResponse)
+			require.Nil(t, err)
+			require.True(t, response.Header.Flags.Contains(primitive.HeaderFlagCompressed))
+			require.False(t, uncompressedResponse.Header.Flags.Contains(primitive.HeaderFlagCompressed))
+			decodedResponse, err := clientCodec.ConvertFromRawFrame(response)
+			require.Nil(t, err)
+			require.Equal(t, &message.SetKeyspaceResult{Keyspace: "ks"}, decodedResponse.Body.Message)
+
+			compressedResponse, err := bridge.compressResponse(response)
+			require.Nil(t, err)
+			require.Same(t, response, compressedResponse)
+
+			// frames are not compressed individually with protocol v5
+			v5Response, err := defaultCodec.ConvertToRawFrame(
+				frame.NewFrame(primitive.ProtocolVersion5, 0, &message.SetKeyspaceResult{Keyspace: "ks"}))
+			require.Nil(t, err)
+			response, err = bridge.compressResponse(v5Response)
+			require.Nil(t, err)
+			require.Same(t, v5Response, response)
+		})
+	}
+}
+
+func TestCompressionBridge_NotNegotiated(t *testing.T) {
+	requestFrame := frame.NewFrame(primitive.ProtocolVersion4, 1, &message.Query{Query: "SELECT * FROM ks.t", Options: &message.QueryOptions{}})
+	requestFrame.SetCompress(true)
+	compressedRequest, err := frame.NewRawCodecWithCompression(lz4.Compressor{}).ConvertToRawFrame(requestFrame)
+	require.Nil(t, err)
+	uncompressedResponse := mustEncodeFrame(t, &message.Ready{})
+
+	var disabledBridge *compressionBridge
+	require.Nil(t, newCompressionBridge(false, false, 0))
+	require.Nil(t, disabledBridge.setCompression(primitive.ProtocolVersion4, primitive.CompressionLz4))
+	request, err := disabledBridge.decompressRequest(compressedRequest)
+	require.Nil(t, err)
+	require.Same(t, compressedRequest, request)
+	response, err := disabledBridge.compressResponse(uncompressedResponse)
+	require.Nil(t, err)
+	require.Same(t, uncompressedResponse, response)
+
+	bridge := newCompressionBridge(true, false, 0)
+	require.Nil(t, bridge.setCompression(primitive.ProtocolVersion4, primitive.CompressionNone))
+	_, err = bridge.decompressRequest(compressedRequest)
+	require.NotNil(t, err)
+	response, err = bridge.compressResponse(uncompressedResponse)
+	require.Nil(t, err)
+	require.Same(t, uncompressedResponse, response)
+
+	require.NotNil(t, bridge.setCompression(primitive.ProtocolVersion4, "deflate"))
+
+	// a second STARTUP request replaces the compression of the first one
+	require.Nil(t, bridge.setCompression(primitive.ProtocolVersion4, primitive.CompressionLz4))
+	require.Equal(t, lz4.Compressor{}, bridge.getCompressor())
+	require.Nil(t, bridge.setCompression(primitive.ProtocolVersion4, primitive.CompressionSnappy))
+	require.Equal(t, snappy.Compressor{}, bridge.getCompressor())
+	require.Nil(t, bridge.setCompression(primitive.ProtocolVersion4, primitive.CompressionNone))
+	require.Nil(t, bridge.getCompressor())
+
+	// segments are never compressed so the bridge is not armed with protocol v5
+	require.NotNil(t, bridge.setCompression(primitive.ProtocolVersion5, primitive.CompressionLz4))
+	require.Nil(t, bridge.getCompressor())
+	require.Nil(t, bridge.setCompression(primitive.ProtocolVersion5, primitive.CompressionNone))
+	require.Nil(t, bridge.getCompressor())
+}
+
+func mockRowsResponse(t testing.TB, rowCount int) *frame.RawFrame {
+	data := make(message.RowSet, 0, rowCount)
+	for i := 0; i < rowCount; i++ {
+		data = append(data, message.Row{[]byte(fmt.Sprintf("value %v", i))})
+	}
+	rows := &message.RowsResult{
+		Metadata: &message.RowsMetadata{
+			ColumnCount: 1,
+			Columns: []*message.ColumnMetadata{
+				{Keyspace: "ks", Table: "t", Name: "value", Type: datatype.Varchar},
+			},
+		},
+		Data: data,
+	}
+	f, err := defaultCodec.ConvertToRawFrame(frame.NewFrame(primitive.ProtocolVersion4, 1, rows))
+	require.Nil(t, err)
+	return f
+}
+
+func TestCompressionBridge_MinBodySize(t *testing.T) {
+	bridge := newCompressionBridge(false, true, 256)
+	require.Nil(t, bridge.setCompression(primitive.ProtocolVersion4, primitive.CompressionLz4))
+
+	smallResponse := mockRowsResponse(t, 1)
+	require.Less(t, len(smallResponse.Body), 256)
+	response, err := bridge.compressResponse(smallResponse)
+	require.Nil(t, err)
+	require.Same(t, smallResponse, response)
+
+	largeResponse := mockRowsResponse(t, 100)
+	require.GreaterOrEqual(t, len(largeResponse.Body), 256)
+	response, err = bridge.compressResponse(largeResponse)
+	require.Nil(t, err)
+	require.True(t, response.Header.Flags.Contains(primitive.HeaderFlagCompressed))
+	require.Less(t, len(response.Body), len(largeResponse.Body))
+	decodedResponse, err := frame.NewRawCodecWithCompression(lz4.Compressor{}).ConvertFromRawFrame(response)
+	require.Nil(t, err)
+	require.Len(t, decodedResponse.Body.Message.(*message.RowsResult).Data, 100)
+}
+
+func BenchmarkCompressionBridge_CompressResponse(b *testing.B) {
+	smallResponse := mockRowsResponse(b, 1)
+	benchmarks := []struct {
+		name        string
+		minBodySize int
+	}{
+		{"compress all", 0},
+		{"min body size", 256},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			bridge := newCompressionBridge(false, true, bm.minBodySize)
+			require.Nil(b, bridge.setCompression(primitive.ProtocolVersion4, primitive.CompressionLz4))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := bridge.compressResponse(smallResponse)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -4,22 +4,74 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
 	"github.com/jpillora/backoff"
 	log "github.com/sirupsen/logrus"
 	"net"
 	"time"
 )
 
-func openConnection(cc ConnectionConfig, ec Endpoint, ctx context.Context, useBackoff bool) (net.Conn, context.Context, error) {
+// socketOptions holds the OS level settings that are applied to a TCP connection once it is established.
+// A buffer size of 0 (or less) keeps the OS default, noDelay is always applied.
+type socketOptions struct {
+	readBufferSizeBytes  int
+	writeBufferSizeBytes int
+	noDelay              bool
+}
+
+func newClientSocketOptions(conf *config.Config) *socketOptions {
+	return &socketOptions{
+		readBufferSizeBytes:  conf.ClientSocketReadBufferSizeBytes,
+		writeBufferSizeBytes: conf.ClientSocketWriteBufferSizeBytes,
+		noDelay:              conf.ClientTcpNoDelay,
+	}
+}
+
+func newClusterSocketOptions(conf *config.Config) *socketOptions {
+	return &socketOptions{
+		readBufferSizeBytes:  conf.ClusterSocketReadBufferSizeBytes,
+		writeBufferSizeBytes: conf.ClusterSocketWriteBufferSizeBytes,
+		noDelay:              conf.ClusterTcpNoDelay,
+	}
+}
+
+// applySocketOptions sets the socket options on the provided connection if it is a TCP connection, other connection
+// types (TLS connections included) are left untouched so options must be applied before the TLS handshake.
+func applySocketOptions(conn net.Conn, opts *socketOptions) error {
+	if opts == nil {
+		return nil
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if opts.readBufferSizeBytes > 0 {
+		if err := tcpConn.SetReadBuffer(opts.readBufferSizeBytes); err != nil {
+			return fmt.Errorf("could not set socket read buffer size to %v: %w", opts.readBufferSizeBytes, err)
+		}
+	}
+	if opts.writeBufferSizeBytes > 0 {
+		if err := tcpConn.SetWriteBuffer(opts.writeBufferSizeBytes); err != nil {
+			return fmt.Errorf("could not set socket write buffer size to %v: %w", opts.writeBufferSizeBytes, err)
+		}
+	}
+	if err := tcpConn.SetNoDelay(opts.noDelay); err != nil {
+		return fmt.Errorf("could not set TCP_NODELAY to %v: %w", opts.noDelay, err)
+	}
+	return nil
+}
+
+func openConnection(
+	cc ConnectionConfig, ec Endpoint, ctx context.Context, timeout time.Duration, useBackoff bool,
+	opts *socketOptions) (net.Conn, context.Context, error) {
 	var connection net.Conn
 	var err error
 
-	timeout := time.Duration(cc.GetConnectionTimeoutMs()) * time.Millisecond
 	openConnectionTimeoutCtx, _ := context.WithTimeout(ctx, timeout)
 
 	if cc.GetTlsConfig() != nil {
 		// open connection using TLS
-		connection, err = openTLSConnection(ec, openConnectionTimeoutCtx, useBackoff)
+		connection, err = openTLSConnection(ec, openConnectionTimeoutCtx, useBackoff, opts)
 		if err != nil {
 			return nil, openConnectionTimeoutCtx, err
 		}
@@ -28,15 +80,15 @@ func openConnection(cc ConnectionConfig, ec Endpoint, ctx context.Context, useBa
 
 	// open plain TCP connection using contact points
 	if useBackoff {
-		connection, err = openTCPConnectionWithBackoff(ec.GetSocketEndpoint(), openConnectionTimeoutCtx)
+		connection, err = openTCPConnectionWithBackoff(ec.GetSocketEndpoint(), openConnectionTimeoutCtx, opts)
 	} else {
-		connection, err = openTCPConnection(ec.GetSocketEndpoint(), openConnectionTimeoutCtx)
+		connection, err = openTCPConnection(ec.GetSocketEndpoint(), openConnectionTimeoutCtx, opts)
 	}
 
 	return connection, openConnectionTimeoutCtx, err
 }
 
-func openTCPConnectionWithBackoff(addr string, ctx context.Context) (net.Conn, error) {
+func openTCPConnectionWithBackoff(addr string, ctx context.Context, opts *socketOptions) (net.Conn, error) {
 	b := &backoff.Backoff{
 		Min:    100 * time.Millisecond,
 		Max:    10 * time.Second,
@@ -58,11 +110,15 @@ func openTCPConnectionWithBackoff(addr string, ctx context.Context) (net.Conn, e
 			continue
 		}
 		log.Debugf("[openTCPConnectionWithBackoff] Successfully established connection with %v", conn.RemoteAddr())
+		if err = applySocketOptions(conn, opts); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
 		return conn, nil
 	}
 }
 
-func openTCPConnection(addr string, ctx context.Context) (net.Conn, error) {
+func openTCPConnection(addr string, ctx context.Context, opts *socketOptions) (net.Conn, error) {
 	log.Infof("[openTCPConnection] Opening connection to %v", addr)
 
 	// Wait until the source database is up and ready to accept TCP connections.
@@ -76,17 +132,22 @@ func openTCPConnection(addr string, ctx context.Context) (net.Conn, error) {
 	}
 	log.Infof("[openTCPConnection] Successfully established connection with %v", conn.RemoteAddr())
 
+	if err = applySocketOptions(conn, opts); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
 	return conn, nil
 }
 
-func openTLSConnection(endpoint Endpoint, ctx context.Context, useBackoff bool) (*tls.Conn, error) {
+func openTLSConnection(endpoint Endpoint, ctx context.Context, useBackoff bool, opts *socketOptions) (*tls.Conn, error) {
 
 	var tcpConn net.Conn
 	var err error
 	if useBackoff {
-		tcpConn, err = openTCPConnectionWithBackoff(endpoint.GetSocketEndpoint(), ctx)
+		tcpConn, err = openTCPConnectionWithBackoff(endpoint.GetSocketEndpoint(), ctx, opts)
 	} else {
-		tcpConn, err = openTCPConnection(endpoint.GetSocketEndpoint(), ctx)
+		tcpConn, err = openTCPConnection(endpoint.GetSocketEndpoint(), ctx, opts)
 	}
 	if err != nil {
 		return nil, err
@@ -94,10 +155,16 @@ func openTLSConnection(endpoint Endpoint, ctx context.Context, useBackoff bool)
 
 	log.Infof("[openTLSConnection] Opening TLS connection to %v using underlying TCP connection", endpoint.GetEndpointIdentifier())
 	tlsConn := tls.Client(tcpConn, endpoint.GetTlsConfig())
+	// the handshake is bounded by the connection timeout so that a node that accepts connections but doesn't respond
+	// doesn't block the caller
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = tcpConn.SetDeadline(deadline)
+	}
 	if err := tlsConn.Handshake(); err != nil {
 		tlsConn.Close()
 		return nil, err
 	}
+	_ = tcpConn.SetDeadline(time.Time{})
 	log.Infof("[openTLSConnection] Successfully established connection with %v", endpoint.GetEndpointIdentifier())
 
 	return tlsConn, nil
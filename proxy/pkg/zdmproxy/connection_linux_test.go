@@ -0,0 +1,117 @@
+package zdmproxy
+
+import (
+	"context"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestOpenTCPConnection_SocketBufferSizes(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	defaultConn, err := openTCPConnection(l.Addr().String(), context.Background(), nil)
+	require.Nil(t, err)
+	defer defaultConn.Close()
+	defaultReadBuf, defaultWriteBuf := getSocketBufferSizes(t, defaultConn)
+
+	opts := &socketOptions{
+		readBufferSizeBytes:  defaultReadBuf * 2,
+		writeBufferSizeBytes: defaultWriteBuf * 2,
+	}
+	conn, err := openTCPConnection(l.Addr().String(), context.Background(), opts)
+	require.Nil(t, err)
+	defer conn.Close()
+	readBuf, writeBuf := getSocketBufferSizes(t, conn)
+
+	// linux doubles the requested value to allow space for bookkeeping overhead
+	require.GreaterOrEqual(t, readBuf, opts.readBufferSizeBytes)
+	require.GreaterOrEqual(t, writeBuf, opts.writeBufferSizeBytes)
+	require.Greater(t, readBuf, defaultReadBuf)
+	require.Greater(t, writeBuf, defaultWriteBuf)
+}
+
+func TestApplySocketOptions_DefaultsKeepOsValues(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.Nil(t, err)
+	defer conn.Close()
+
+	readBuf, writeBuf := getSocketBufferSizes(t, conn)
+	err = applySocketOptions(conn, &socketOptions{noDelay: true})
+	require.Nil(t, err)
+	newReadBuf, newWriteBuf := getSocketBufferSizes(t, conn)
+	require.Equal(t, readBuf, newReadBuf)
+	require.Equal(t, writeBuf, newWriteBuf)
+}
+
+func TestApplySocketOptions_NoDelay(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.Nil(t, err)
+	defer conn.Close()
+
+	err = applySocketOptions(conn, &socketOptions{noDelay: false})
+	require.Nil(t, err)
+	require.False(t, getSocketNoDelay(t, conn))
+
+	err = applySocketOptions(conn, newClusterSocketOptions(&config.Config{ClusterTcpNoDelay: true}))
+	require.Nil(t, err)
+	require.True(t, getSocketNoDelay(t, conn))
+}
+
+func getSocketBufferSizes(t *testing.T, conn net.Conn) (int, int) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	require.True(t, ok)
+	rawConn, err := tcpConn.SyscallConn()
+	require.Nil(t, err)
+
+	var readBuf, writeBuf int
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		readBuf, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+		if sockErr != nil {
+			return
+		}
+		writeBuf, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	})
+	require.Nil(t, err)
+	require.Nil(t, sockErr)
+	return readBuf, writeBuf
+}
+
+func getSocketNoDelay(t *testing.T, conn net.Conn) bool {
+	tcpConn, ok := conn.(*net.TCPConn)
+	require.True(t, ok)
+	rawConn, err := tcpConn.SyscallConn()
+	require.Nil(t, err)
+
+	var noDelay int
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		noDelay, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_NODELAY)
+	})
+	require.Nil(t, err)
+	require.Nil(t, sockErr)
+	return noDelay != 0
+}
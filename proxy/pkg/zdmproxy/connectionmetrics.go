@@ -0,0 +1,211 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectionMetricsRequestReport contains the requests of a single request type (see getConnectionMetricsRequestType)
+// that were recorded for a client connection.
+type ConnectionMetricsRequestReport struct {
+	Count            int64
+	Failed           int64
+	AverageLatencyMs float64
+}
+
+// ConnectionMetricsReport contains the requests that were recorded for the client connections that match ClientAddress.
+type ConnectionMetricsReport struct {
+	ClientAddress string
+	ExpiresAt     time.Time
+	Requests      map[string]*ConnectionMetricsRequestReport
+}
+
+type connectionRequestMetrics struct {
+	count         int64
+	failed        int64
+	totalDuration time.Duration
+}
+
+// connectionMetrics records the requests of the client connections with a specific address until it expires.
+// These metrics are kept in memory and are only meant for the diagnosis of a specific client so they are not exported
+// to the metrics backend.
+type connectionMetrics struct {
+	clientAddress string
+	expiresAt     time.Time
+
+	lock     *sync.Mutex
+	requests map[string]*connectionRequestMetrics
+}
+
+func (recv *connectionMetrics) isExpired(now time.Time) bool {
+	return !now.Before(recv.expiresAt)
+}
+
+func (recv *connectionMetrics) track(requestType string, duration time.Duration, failed bool) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	requestMetrics, ok := recv.requests[requestType]
+	if !ok {
+		requestMetrics = &connectionRequestMetrics{}
+		recv.requests[requestType] = requestMetrics
+	}
+	requestMetrics.count++
+	requestMetrics.totalDuration += duration
+	if failed {
+		requestMetrics.failed++
+	}
+}
+
+func (recv *connectionMetrics) report() *ConnectionMetricsReport {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	report := &ConnectionMetricsReport{
+		ClientAddress: recv.clientAddress,
+		ExpiresAt:     recv.expiresAt,
+		Requests:      make(map[string]*ConnectionMetricsRequestReport, len(recv.requests)),
+	}
+	for requestType, requestMetrics := range recv.requests {
+		report.Requests[requestType] = &ConnectionMetricsRequestReport{
+			Count:            requestMetrics.count,
+			Failed:           requestMetrics.failed,
+			AverageLatencyMs: float64(requestMetrics.totalDuration) / float64(requestMetrics.count) / float64(time.Millisecond),
+		}
+	}
+	return report
+}
+
+// connectionMetricsRegistry contains the client addresses for which per connection metrics are enabled. An address
+// can be a host (all connections of that client host) or a host:port pair (a single client connection).
+// A nil connectionMetricsRegistry doesn't record any metrics.
+type connectionMetricsRegistry struct {
+	// number of entries, checked before taking the lock so that requests don't pay for it when nothing is enabled
+	size    int32
+	lock    *sync.RWMutex
+	entries map[string]*connectionMetrics
+}
+
+func newConnectionMetricsRegistry() *connectionMetricsRegistry {
+	return &connectionMetricsRegistry{
+		lock:    &sync.RWMutex{},
+		entries: make(map[string]*connectionMetrics),
+	}
+}
+
+// enable starts recording the requests of the client connections that match clientAddress, existing metrics for the
+// same address are reset.
+func (recv *connectionMetricsRegistry) enable(clientAddress string, duration time.Duration, now time.Time) (*ConnectionMetricsReport, error) {
+	if recv == nil {
+		return nil, fmt.Errorf("per connection metrics are not initialized")
+	}
+	if clientAddress == "" {
+		return nil, fmt.Errorf("client address is required")
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive but was %v", duration)
+	}
+
+	entry := &connectionMetrics{
+		clientAddress: clientAddress,
+		expiresAt:     now.Add(duration),
+		lock:          &sync.Mutex{},
+		requests:      make(map[string]*connectionRequestMetrics),
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	recv.entries[clientAddress] = entry
+	atomic.StoreInt32(&recv.size, int32(len(recv.entries)))
+	return entry.report(), nil
+}
+
+// get returns the metrics that the requests of the client connection with the provided address should be recorded
+// in, nil is returned when per connection metrics are not enabled for this address or have expired.
+func (recv *connectionMetricsRegistry) get(clientAddress string, now time.Time) *connectionMetrics {
+	if recv == nil || atomic.LoadInt32(&recv.size) == 0 {
+		return nil
+	}
+
+	recv.lock.RLock()
+	entry, ok := recv.entries[clientAddress]
+	if !ok {
+		if host, _, err := net.SplitHostPort(clientAddress); err == nil {
+			entry, ok = recv.entries[host]
+		}
+	}
+	recv.lock.RUnlock()
+
+	if !ok || entry.isExpired(now) {
+		return nil
+	}
+	return entry
+}
+
+// snapshot returns the reports of the client addresses that have per connection metrics enabled and removes the
+// expired ones.
+func (recv *connectionMetricsRegistry) snapshot(now time.Time) []*ConnectionMetricsReport {
+	if recv == nil {
+		return []*ConnectionMetricsReport{}
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	reports := make([]*ConnectionMetricsReport, 0, len(recv.entries))
+	for clientAddress, entry := range recv.entries {
+		if entry.isExpired(now) {
+			delete(recv.entries, clientAddress)
+			continue
+		}
+		reports = append(reports, entry.report())
+	}
+	atomic.StoreInt32(&recv.size, int32(len(recv.entries)))
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].ClientAddress < reports[j].ClientAddress
+	})
+	return reports
+}
+
+// EnableConnectionMetrics records the requests of the client connections that match clientAddress (host or host:port)
+// separately from the proxy metrics until the duration elapses. Both existing and new client connections are recorded.
+func (p *ZdmProxy) EnableConnectionMetrics(clientAddress string, duration time.Duration) (*ConnectionMetricsReport, error) {
+	return p.shared.connectionMetrics.enable(clientAddress, duration, nowFunc())
+}
+
+// GetConnectionMetrics returns the requests that were recorded for each client address that has per connection
+// metrics enabled.
+func (p *ZdmProxy) GetConnectionMetrics() []*ConnectionMetricsReport {
+	return p.shared.connectionMetrics.snapshot(nowFunc())
+}
+
+// getConnectionMetricsRequestType returns the per connection metrics request type, these match the proxy level
+// request duration metrics.
+func getConnectionMetricsRequestType(decision forwardDecision) (string, bool) {
+	switch decision {
+	case forwardToBoth:
+		return "writes", true
+	case forwardToOrigin:
+		return "reads_origin", true
+	case forwardToTarget:
+		return "reads_target", true
+	default:
+		return "", false
+	}
+}
+
+// trackConnectionMetrics records the request in the per connection metrics if they are enabled for this client.
+func (ch *ClientHandler) trackConnectionMetrics(reqCtx *requestContextImpl, failed bool) {
+	now := nowFunc()
+	entry := ch.connectionMetrics.get(ch.clientAddress, now)
+	if entry == nil || !reqCtx.requestInfo.ShouldBeTrackedInMetrics() {
+		return
+	}
+
+	requestType, ok := getConnectionMetricsRequestType(getMetricsForwardDecision(reqCtx.requestInfo, reqCtx.primaryCluster))
+	if !ok {
+		return
+	}
+	entry.track(requestType, now.Sub(reqCtx.startTime), failed)
+}
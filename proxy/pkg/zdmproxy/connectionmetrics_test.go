@@ -0,0 +1,78 @@
+package zdmproxy
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestConnectionMetrics_EnabledForOneHandler(t *testing.T) {
+	registry := newConnectionMetricsRegistry()
+	diagnosedHandler := &ClientHandler{clientAddress: "10.0.0.1:5000", connectionMetrics: registry}
+	otherHandler := &ClientHandler{clientAddress: "10.0.0.2:5000", connectionMetrics: registry}
+
+	newRequestContext := func(decision forwardDecision, latency time.Duration) *requestContextImpl {
+		return &requestContextImpl{
+			requestInfo: NewGenericRequestInfo(decision, false, true),
+			startTime:   time.Now().Add(-latency),
+		}
+	}
+
+	// nothing is recorded before per connection metrics are enabled
+	diagnosedHandler.trackConnectionMetrics(newRequestContext(forwardToOrigin, time.Millisecond), false)
+	require.Empty(t, registry.snapshot(time.Now()))
+
+	report, err := registry.enable("10.0.0.1:5000", time.Minute, time.Now())
+	require.Nil(t, err)
+	require.Equal(t, "10.0.0.1:5000", report.ClientAddress)
+	require.Empty(t, report.Requests)
+
+	diagnosedHandler.trackConnectionMetrics(newRequestContext(forwardToOrigin, 10*time.Millisecond), false)
+	diagnosedHandler.trackConnectionMetrics(newRequestContext(forwardToOrigin, 30*time.Millisecond), true)
+	diagnosedHandler.trackConnectionMetrics(newRequestContext(forwardToBoth, 10*time.Millisecond), false)
+	diagnosedHandler.trackConnectionMetrics(&requestContextImpl{
+		requestInfo: NewGenericRequestInfo(forwardToBoth, false, false),
+		startTime:   time.Now(),
+	}, false)
+	otherHandler.trackConnectionMetrics(newRequestContext(forwardToTarget, 10*time.Millisecond), false)
+
+	reports := registry.snapshot(time.Now())
+	require.Len(t, reports, 1)
+	require.Equal(t, "10.0.0.1:5000", reports[0].ClientAddress)
+	require.Len(t, reports[0].Requests, 2)
+	require.Equal(t, int64(2), reports[0].Requests["reads_origin"].Count)
+	require.Equal(t, int64(1), reports[0].Requests["reads_origin"].Failed)
+	require.GreaterOrEqual(t, reports[0].Requests["reads_origin"].AverageLatencyMs, 20.0)
+	require.Equal(t, int64(1), reports[0].Requests["writes"].Count)
+	require.Equal(t, int64(0), reports[0].Requests["writes"].Failed)
+
+	// per connection metrics expire and are removed
+	require.NotNil(t, registry.get("10.0.0.1:5000", time.Now()))
+	require.Nil(t, registry.get("10.0.0.1:5000", time.Now().Add(time.Minute)))
+	require.Empty(t, registry.snapshot(time.Now().Add(time.Minute)))
+	diagnosedHandler.trackConnectionMetrics(newRequestContext(forwardToOrigin, time.Millisecond), false)
+	require.Empty(t, registry.snapshot(time.Now()))
+}
+
+func TestConnectionMetricsRegistry_Enable(t *testing.T) {
+	registry := newConnectionMetricsRegistry()
+	now := time.Now()
+
+	// a host matches every connection of that client host
+	_, err := registry.enable("10.0.0.1", time.Minute, now)
+	require.Nil(t, err)
+	require.NotNil(t, registry.get("10.0.0.1:5000", now))
+	require.NotNil(t, registry.get("10.0.0.1:5001", now))
+	require.Nil(t, registry.get("10.0.0.2:5000", now))
+
+	_, err = registry.enable("", time.Minute, now)
+	require.NotNil(t, err)
+	_, err = registry.enable("10.0.0.1", 0, now)
+	require.NotNil(t, err)
+
+	var disabledRegistry *connectionMetricsRegistry
+	_, err = disabledRegistry.enable("10.0.0.1", time.Minute, now)
+	require.NotNil(t, err)
+	require.Nil(t, disabledRegistry.get("10.0.0.1:5000", now))
+	require.Empty(t, disabledRegistry.snapshot(now))
+}
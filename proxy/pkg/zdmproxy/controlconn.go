@@ -34,8 +34,11 @@ type ControlConn struct {
 	currentContactPoint      Endpoint
 	username                 string
 	password                 string
+	authenticatorProvider    AuthenticatorProvider
 	counterLock              *sync.RWMutex
 	consecutiveFailures      int
+	failingSince             time.Time
+	reconnectedCh            chan struct{}
 	OpenConnectionTimeout    time.Duration
 	cqlConnLock              *sync.Mutex
 	topologyLock             *sync.RWMutex
@@ -52,6 +55,8 @@ type ControlConn struct {
 	reconnectCh              chan bool
 	protocolEventSubscribers map[ProtocolEventObserver]interface{}
 	authEnabled              *atomic.Value
+	establishedConnections   int64
+	connectionEstablishedAt  time.Time
 }
 
 const ProxyVirtualRack = "rack0"
@@ -61,7 +66,7 @@ const ccWriteTimeout = 5 * time.Second
 const ccReadTimeout = 10 * time.Second
 
 func NewControlConn(ctx context.Context, defaultPort int, connConfig ConnectionConfig,
-	username string, password string, conf *config.Config, topologyConfig *common.TopologyConfig, proxyRand *rand.Rand) *ControlConn {
+	username string, password string, authenticatorProvider AuthenticatorProvider, conf *config.Config, topologyConfig *common.TopologyConfig, proxyRand *rand.Rand) *ControlConn {
 	authEnabled := &atomic.Value{}
 	authEnabled.Store(true)
 	return &ControlConn{
@@ -81,6 +86,7 @@ func NewControlConn(ctx context.Context, defaultPort int, connConfig ConnectionC
 		currentContactPoint:      nil,
 		username:                 username,
 		password:                 password,
+		authenticatorProvider:    authenticatorProvider,
 		counterLock:              &sync.RWMutex{},
 		consecutiveFailures:      0,
 		OpenConnectionTimeout:    time.Duration(connConfig.GetConnectionTimeoutMs()) * time.Millisecond,
@@ -228,6 +234,10 @@ func (cc *ControlConn) IsAuthEnabled() (bool, error) {
 func (cc *ControlConn) IncrementFailureCounter() {
 	cc.counterLock.Lock()
 	defer cc.counterLock.Unlock()
+	if cc.consecutiveFailures == 0 {
+		cc.failingSince = nowFunc()
+		cc.reconnectedCh = make(chan struct{})
+	}
 	cc.consecutiveFailures++
 	if cc.consecutiveFailures < 0 {
 		cc.consecutiveFailures = math.MaxInt32
@@ -238,6 +248,22 @@ func (cc *ControlConn) ResetFailureCounter() {
 	cc.counterLock.Lock()
 	defer cc.counterLock.Unlock()
 	cc.consecutiveFailures = 0
+	cc.failingSince = time.Time{}
+	if cc.reconnectedCh != nil {
+		close(cc.reconnectedCh)
+		cc.reconnectedCh = nil
+	}
+}
+
+// GetReconnectedChan returns a channel that is closed once the control connection is connected again after its
+// heartbeats started failing, nil is returned if the heartbeats are not failing.
+func (cc *ControlConn) GetReconnectedChan() <-chan struct{} {
+	cc.counterLock.RLock()
+	defer cc.counterLock.RUnlock()
+	if cc.reconnectedCh == nil {
+		return nil
+	}
+	return cc.reconnectedCh
 }
 
 func (cc *ControlConn) ReadFailureCounter() int {
@@ -246,6 +272,33 @@ func (cc *ControlConn) ReadFailureCounter() int {
 	return cc.consecutiveFailures
 }
 
+// IsDown returns true if the consecutive heartbeat failures reached failureThreshold and the heartbeats have been
+// failing for at least gracePeriod, i.e. isolated failures do not mark the cluster as down.
+func (cc *ControlConn) IsDown(failureThreshold int, gracePeriod time.Duration) bool {
+	cc.counterLock.RLock()
+	defer cc.counterLock.RUnlock()
+	return cc.isDown(failureThreshold, gracePeriod)
+}
+
+// GetReconnectedChanIfDown returns the channel of GetReconnectedChan if the cluster is DOWN (see IsDown), nil is
+// returned if the cluster is connected or if its heartbeats did not fail for long enough yet.
+func (cc *ControlConn) GetReconnectedChanIfDown(failureThreshold int, gracePeriod time.Duration) <-chan struct{} {
+	cc.counterLock.RLock()
+	defer cc.counterLock.RUnlock()
+	if cc.reconnectedCh == nil || !cc.isDown(failureThreshold, gracePeriod) {
+		return nil
+	}
+	return cc.reconnectedCh
+}
+
+// isDown has to be called with counterLock held.
+func (cc *ControlConn) isDown(failureThreshold int, gracePeriod time.Duration) bool {
+	if cc.consecutiveFailures < failureThreshold {
+		return false
+	}
+	return cc.consecutiveFailures == 0 || nowFunc().Sub(cc.failingSince) >= gracePeriod
+}
+
 func (cc *ControlConn) Open(contactPointsOnly bool, ctx context.Context) (CqlConnection, error) {
 	oldConn, _ := cc.getConnAndContactPoint()
 	if oldConn != nil {
@@ -316,14 +369,14 @@ func (cc *ControlConn) openInternal(endpoints []Endpoint, ctx context.Context) (
 
 		currentIndex := (firstEndpointIndex + i) % len(endpoints)
 		endpoint = endpoints[currentIndex]
-		tcpConn, _, err := openConnection(cc.connConfig, endpoint, ctx, false)
+		tcpConn, _, err := openConnection(cc.connConfig, endpoint, ctx, cc.OpenConnectionTimeout, false, nil)
 		if err != nil {
 			log.Warnf("Failed to open control connection to %v using endpoint %v: %v",
 				cc.connConfig.GetClusterType(), endpoint.GetEndpointIdentifier(), err)
 			continue
 		}
 
-		newConn := NewCqlConnection(tcpConn, cc.username, cc.password, ccReadTimeout, ccWriteTimeout)
+		newConn := NewCqlConnection(tcpConn, cc.username, cc.password, cc.authenticatorProvider, ccReadTimeout, ccWriteTimeout)
 		err = newConn.InitializeContext(ccProtocolVersion, ctx)
 		if err == nil {
 			newConn.SetEventHandler(func(f *frame.Frame, c CqlConnection) {
@@ -554,6 +607,46 @@ func (cc *ControlConn) GetAssignedHosts() ([]*Host, error) {
 	return cc.assignedHosts, nil
 }
 
+// OpenAssignedHostConnections opens a new connection to each assigned host. These connections are not managed by
+// the control connection (no events, no reconnection) and the caller is responsible for closing them.
+// Hosts that can't be reached are skipped, an error is only returned if no connection could be opened.
+func (cc *ControlConn) OpenAssignedHostConnections(ctx context.Context) ([]CqlConnection, error) {
+	hosts, err := cc.GetAssignedHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	conns := make([]CqlConnection, 0, len(hosts))
+	for _, host := range hosts {
+		endpoint := cc.connConfig.CreateEndpoint(host)
+		tcpConn, _, err := openConnection(cc.connConfig, endpoint, ctx, cc.OpenConnectionTimeout, false, nil)
+		if err != nil {
+			log.Warnf("Failed to open connection to %v using endpoint %v: %v",
+				cc.connConfig.GetClusterType(), endpoint.GetEndpointIdentifier(), err)
+			continue
+		}
+
+		newConn := NewCqlConnection(tcpConn, cc.username, cc.password, cc.authenticatorProvider, ccReadTimeout, ccWriteTimeout)
+		err = newConn.InitializeContext(ccProtocolVersion, ctx)
+		if err != nil {
+			log.Warnf("Error while initializing a new cql connection to %v using endpoint %v: %v",
+				cc.connConfig.GetClusterType(), endpoint.GetEndpointIdentifier(), err)
+			err2 := newConn.Close()
+			if err2 != nil {
+				log.Errorf("Failed to close cql connection: %v", err2)
+			}
+			continue
+		}
+		conns = append(conns, newConn)
+	}
+
+	if len(conns) == 0 {
+		return nil, fmt.Errorf("could not open a connection to any of the assigned hosts of %v: %v",
+			cc.connConfig.GetClusterType(), hosts)
+	}
+	return conns, nil
+}
+
 func (cc *ControlConn) NextAssignedHost() (*Host, error) {
 	cc.topologyLock.RLock()
 	defer cc.topologyLock.RUnlock()
@@ -610,6 +703,8 @@ func (cc *ControlConn) setConn(oldConn CqlConnection, newConn CqlConnection, new
 	if cc.cqlConn == oldConn || oldConn == nil {
 		cc.cqlConn = newConn
 		cc.currentContactPoint = newContactPoint
+		cc.establishedConnections++
+		cc.connectionEstablishedAt = time.Now()
 		authEnabled, err := newConn.IsAuthEnabled()
 		if err != nil {
 			log.Errorf("Error detected when trying to set whether auth is enabled or not in control connection, "+
@@ -632,6 +727,31 @@ func (cc *ControlConn) setConn(oldConn CqlConnection, newConn CqlConnection, new
 	return cc.cqlConn, cc.currentContactPoint
 }
 
+// GetEstablishedConnectionCount returns the number of times the control connection was established (including
+// reconnections), frequent reconnections usually mean that the cluster or the network is unstable.
+func (cc *ControlConn) GetEstablishedConnectionCount() float64 {
+	if cc == nil {
+		return 0
+	}
+	cc.cqlConnLock.Lock()
+	defer cc.cqlConnLock.Unlock()
+	return float64(cc.establishedConnections)
+}
+
+// GetConnectionAgeSeconds returns how long ago the current control connection was established, 0 if there is no
+// open control connection.
+func (cc *ControlConn) GetConnectionAgeSeconds() float64 {
+	if cc == nil {
+		return 0
+	}
+	cc.cqlConnLock.Lock()
+	defer cc.cqlConnLock.Unlock()
+	if cc.cqlConn == nil {
+		return 0
+	}
+	return time.Since(cc.connectionEstablishedAt).Seconds()
+}
+
 func (cc *ControlConn) getConnAndContactPoint() (CqlConnection, Endpoint) {
 	cc.cqlConnLock.Lock()
 	conn := cc.cqlConn
@@ -794,6 +914,24 @@ type VirtualHost struct {
 	Partitioner string
 }
 
+// syntheticSchemaVersion is the schema version returned by every proxy instance when ZDM_SCHEMA_VERSION_MODE is SYNTHETIC,
+// it is derived from a fixed name so that it is the same on every proxy instance and across restarts.
+var syntheticSchemaVersion = uuid.NewSHA1(uuid.NameSpaceOID, []byte("zdm-proxy-schema-version"))
+
+// withSchemaVersion returns copies of the virtual hosts that return the provided schema version instead of
+// the schema version of the hosts that they are mapped to.
+func withSchemaVersion(virtualHosts []*VirtualHost, schemaVersion uuid.UUID) []*VirtualHost {
+	result := make([]*VirtualHost, len(virtualHosts))
+	for i, virtualHost := range virtualHosts {
+		host := *virtualHost.Host
+		host.SchemaVersion = &schemaVersion
+		virtualHostCopy := *virtualHost
+		virtualHostCopy.Host = &host
+		result[i] = &virtualHostCopy
+	}
+	return result
+}
+
 func (recv *VirtualHost) String() string {
 	return fmt.Sprintf("VirtualHost{addr: %v, host_id: %v, rack: %v, tokens: %v, host: %v, partitioner: %v}",
 		recv.Addr,
@@ -807,3 +945,31 @@ func (recv *VirtualHost) String() string {
 type ProtocolEventObserver interface {
 	OnHostRemoved(host *Host)
 }
+
+// GetKeyspaceNames queries the names of the keyspaces of the cluster using the current control connection.
+func (cc *ControlConn) GetKeyspaceNames(ctx context.Context) ([]string, error) {
+	conn, _ := cc.getConnAndContactPoint()
+	if conn == nil {
+		return nil, fmt.Errorf("could not query keyspaces of %v because the control connection is not open", cc.connConfig.GetClusterType())
+	}
+
+	rs, err := conn.Query("SELECT keyspace_name FROM system_schema.keyspaces", GetDefaultGenericTypeCodec(), ccProtocolVersion, ctx)
+	if err != nil {
+		// clusters older than 3.0 don't have the system_schema keyspace
+		var legacyErr error
+		rs, legacyErr = conn.Query("SELECT keyspace_name FROM system.schema_keyspaces", GetDefaultGenericTypeCodec(), ccProtocolVersion, ctx)
+		if legacyErr != nil {
+			return nil, fmt.Errorf("could not fetch keyspaces of %v: %w", cc.connConfig.GetClusterType(), err)
+		}
+	}
+
+	keyspaces := make([]string, 0, len(rs.Rows))
+	for _, row := range rs.Rows {
+		keyspace, err := parseString(row, "keyspace_name")
+		if err != nil {
+			return nil, err
+		}
+		keyspaces = append(keyspaces, keyspace)
+	}
+	return keyspaces, nil
+}
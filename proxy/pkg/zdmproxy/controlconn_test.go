@@ -0,0 +1,74 @@
+package zdmproxy
+
+import (
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestControlConn_EstablishedConnectionMetrics(t *testing.T) {
+	cc := &ControlConn{cqlConnLock: &sync.Mutex{}, authEnabled: &atomic.Value{}}
+	require.Equal(t, 0.0, cc.GetEstablishedConnectionCount())
+	require.Equal(t, 0.0, cc.GetConnectionAgeSeconds())
+
+	firstConn := newFakeReprepareConn("")
+	cc.setConn(nil, firstConn, nil)
+	require.Equal(t, 1.0, cc.GetEstablishedConnectionCount())
+	cc.connectionEstablishedAt = cc.connectionEstablishedAt.Add(-time.Minute)
+	require.GreaterOrEqual(t, cc.GetConnectionAgeSeconds(), 60.0)
+
+	// reconnection
+	cc.setConn(firstConn, newFakeReprepareConn(""), nil)
+	require.Equal(t, 2.0, cc.GetEstablishedConnectionCount())
+	require.Less(t, cc.GetConnectionAgeSeconds(), 60.0)
+
+	cc.Close()
+	require.Equal(t, 2.0, cc.GetEstablishedConnectionCount())
+	require.Equal(t, 0.0, cc.GetConnectionAgeSeconds())
+
+	var nilControlConn *ControlConn
+	require.Equal(t, 0.0, nilControlConn.GetEstablishedConnectionCount())
+	require.Equal(t, 0.0, nilControlConn.GetConnectionAgeSeconds())
+}
+
+func TestControlConn_IsDown(t *testing.T) {
+	clock := newFakeClock(t)
+	cc := &ControlConn{counterLock: &sync.RWMutex{}}
+	threshold, gracePeriod := 2, 10*time.Second
+	require.False(t, cc.IsDown(threshold, gracePeriod))
+
+	// isolated failures are followed by successful heartbeats
+	for i := 0; i < 5; i++ {
+		cc.IncrementFailureCounter()
+		clock.advance(5 * time.Second)
+		require.False(t, cc.IsDown(threshold, gracePeriod))
+		cc.ResetFailureCounter()
+		clock.advance(5 * time.Second)
+	}
+
+	// the threshold is reached but not for long enough
+	cc.IncrementFailureCounter()
+	cc.IncrementFailureCounter()
+	require.False(t, cc.IsDown(threshold, gracePeriod))
+	clock.advance(9 * time.Second)
+	require.False(t, cc.IsDown(threshold, gracePeriod))
+
+	// sustained failures
+	clock.advance(time.Second)
+	require.True(t, cc.IsDown(threshold, gracePeriod))
+	require.True(t, cc.IsDown(threshold, 0))
+	require.False(t, cc.IsDown(3, gracePeriod))
+
+	cc.ResetFailureCounter()
+	require.False(t, cc.IsDown(threshold, gracePeriod))
+	require.False(t, cc.IsDown(threshold, 0))
+
+	// a failure streak that only reaches the threshold after the grace period
+	cc.IncrementFailureCounter()
+	clock.advance(20 * time.Second)
+	require.False(t, cc.IsDown(threshold, gracePeriod))
+	cc.IncrementFailureCounter()
+	require.True(t, cc.IsDown(threshold, gracePeriod))
+}
@@ -0,0 +1,23 @@
+package zdmproxy
+
+import (
+	log "github.com/sirupsen/logrus"
+	"sync/atomic"
+)
+
+// correlationIdLogField is the log field that contains the correlation id of a client request. Unlike stream ids,
+// which are reused by the client as soon as a response is received, correlation ids are unique for the lifetime of
+// the proxy process so they can be used to follow a request from the moment it is received until the response is
+// sent back to the client.
+const correlationIdLogField = "correlation_id"
+
+var lastCorrelationId uint64
+
+func newCorrelationId() uint64 {
+	return atomic.AddUint64(&lastCorrelationId, 1)
+}
+
+// newRequestLogger returns a logger that adds the correlation id of the request to every log line.
+func newRequestLogger(correlationId uint64) *log.Entry {
+	return log.WithField(correlationIdLogField, correlationId)
+}
@@ -45,6 +45,7 @@ type cqlConn struct {
 	writeTimeout          time.Duration
 	conn                  net.Conn
 	credentials           *AuthCredentials
+	authenticatorProvider AuthenticatorProvider
 	initialized           bool
 	cancelFn              context.CancelFunc
 	ctx                   context.Context
@@ -59,6 +60,7 @@ type cqlConn struct {
 	eventHandler          func(f *frame.Frame, conn CqlConnection)
 	eventHandlerLock      *sync.Mutex
 	authEnabled           bool
+	codec                 *connectionCodec
 }
 
 var (
@@ -71,7 +73,7 @@ func (c *cqlConn) String() string {
 
 func NewCqlConnection(
 	conn net.Conn,
-	username string, password string,
+	username string, password string, authenticatorProvider AuthenticatorProvider,
 	readTimeout time.Duration, writeTimeout time.Duration) CqlConnection {
 	ctx, cFn := context.WithCancel(context.Background())
 	streamIdsQueue := make(chan int16, numberOfStreamIds)
@@ -86,6 +88,7 @@ func NewCqlConnection(
 			Username: username,
 			Password: password,
 		},
+		authenticatorProvider: authenticatorProvider,
 		initialized:           false,
 		ctx:                   ctx,
 		cancelFn:              cFn,
@@ -99,6 +102,7 @@ func NewCqlConnection(
 		closed:                false,
 		eventHandlerLock:      &sync.Mutex{},
 		authEnabled:           true,
+		codec:                 newConnectionCodec(),
 	}
 	cqlConn.StartRequestLoop()
 	cqlConn.StartResponseLoop()
@@ -133,7 +137,7 @@ func (c *cqlConn) StartResponseLoop() {
 		defer close(c.eventsQueue)
 		defer log.Debugf("Shutting down response loop on %v.", c)
 		for c.ctx.Err() == nil {
-			f, err := defaultCodec.DecodeFrame(c.conn)
+			f, err := decodeFrame(c.conn, c.codec.get())
 			if err != nil {
 				if (!errors.Is(err, io.EOF) && !IsClosingErr(err)) || c.ctx.Err() == nil {
 					log.Errorf("Failed to read/decode frame on cql connection %v: %v", c, err)
@@ -188,7 +192,7 @@ func (c *cqlConn) StartRequestLoop() {
 		for c.ctx.Err() == nil {
 			select {
 			case f := <-c.outgoingCh:
-				err := defaultCodec.EncodeFrame(f, c.conn)
+				err := c.codec.get().EncodeFrame(f, c.conn)
 				if err != nil {
 					if (!errors.Is(err, io.EOF) && !IsClosingErr(err)) || c.ctx.Err() == nil {
 						log.Errorf("Failed to write/encode frame on cql connection %v: %v", c, err)
@@ -331,9 +335,13 @@ func (c *cqlConn) SendAndReceive(request *frame.Frame, ctx context.Context) (*fr
 
 func (c *cqlConn) PerformHandshake(version primitive.ProtocolVersion, ctx context.Context) (auth bool, err error) {
 	log.Debug("performing handshake")
+	c.codec.setVersion(version)
 	startup := frame.NewFrame(version, -1, message.NewStartup())
 	var response *frame.Frame
-	authenticator := &DsePlainTextAuthenticator{c.credentials}
+	authenticator, err := newAuthenticator(c.authenticatorProvider, c.credentials)
+	if err != nil {
+		return false, err
+	}
 	authEnabled := false
 	if response, err = c.SendAndReceive(startup, ctx); err == nil {
 		switch response.Body.Message.(type) {
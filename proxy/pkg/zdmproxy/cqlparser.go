@@ -1,6 +1,8 @@
 package zdmproxy
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -32,11 +34,13 @@ const (
 )
 
 const (
-	systemPeersTableName   = "peers"
-	systemPeersV2TableName = "peers_v2"
-	systemLocalTableName   = "local"
-	systemKeyspaceName     = "system"
-	nowFunctionName        = "now"
+	systemPeersTableName            = "peers"
+	systemPeersV2TableName          = "peers_v2"
+	systemLocalTableName            = "local"
+	systemKeyspaceName              = "system"
+	systemSchemaKeyspaceName        = "system_schema"
+	systemVirtualSchemaKeyspaceName = "system_virtual_schema"
+	nowFunctionName                 = "now"
 )
 
 type UnpreparedExecuteError struct {
@@ -67,9 +71,14 @@ func buildRequestInfo(
 	currentKeyspaceName string,
 	primaryCluster common.ClusterType,
 	forwardSystemQueriesToTarget bool,
+	forwardSchemaQueriesToTarget bool,
 	virtualizationEnabled bool,
 	forwardAuthToTarget bool,
-	timeUuidGenerator TimeUuidGenerator) (RequestInfo, error) {
+	forwardCountersToOrigin bool,
+	forwardCounterReadsToOrigin bool,
+	timeUuidGenerator TimeUuidGenerator,
+	keyspaceAllowlist *keyspaceAllowlist,
+	psCacheMissMode common.PsCacheMissMode) (RequestInfo, error) {
 
 	f := frameContext.GetRawFrame()
 	switch f.Header.OpCode {
@@ -78,14 +87,22 @@ func buildRequestInfo(
 		if err != nil {
 			return nil, fmt.Errorf("could not inspect QUERY frame: %w", err)
 		}
+		err = keyspaceAllowlist.checkStatement(f.Header, stmtQueryData.queryData)
+		if err != nil {
+			return nil, err
+		}
 		return getRequestInfoFromQueryInfo(
 			frameContext.GetRawFrame(), primaryCluster,
-			forwardSystemQueriesToTarget, virtualizationEnabled, stmtQueryData.queryData), nil
+			forwardSystemQueriesToTarget, forwardSchemaQueriesToTarget, virtualizationEnabled, stmtQueryData.queryData), nil
 	case primitive.OpCodePrepare:
 		stmtQueryData, err := frameContext.GetOrInspectStatement(currentKeyspaceName, timeUuidGenerator)
 		if err != nil {
 			return nil, fmt.Errorf("could not inspect PREPARE frame: %w", err)
 		}
+		err = keyspaceAllowlist.checkStatement(f.Header, stmtQueryData.queryData)
+		if err != nil {
+			return nil, err
+		}
 		decodedFrame, err := frameContext.GetOrDecodeFrame()
 		if err != nil {
 			return nil, fmt.Errorf("could not decode frame: %w", err)
@@ -96,14 +113,18 @@ func buildRequestInfo(
 		}
 		baseRequestInfo := getRequestInfoFromQueryInfo(
 			frameContext.GetRawFrame(), primaryCluster,
-			forwardSystemQueriesToTarget, virtualizationEnabled, stmtQueryData.queryData)
+			forwardSystemQueriesToTarget, forwardSchemaQueriesToTarget, virtualizationEnabled, stmtQueryData.queryData)
 		replacedTerms := make([]*term, 0)
 		if len(stmtsReplacedTerms) > 1 {
 			return nil, fmt.Errorf("expected single list of replaced terms for prepare message but got %v", len(stmtsReplacedTerms))
 		} else if len(stmtsReplacedTerms) == 1 {
 			replacedTerms = stmtsReplacedTerms[0].replacedTerms
 		}
-		return NewPrepareRequestInfo(baseRequestInfo, replacedTerms, stmtQueryData.queryData.hasPositionalBindMarkers(), prepareMsg.Query, prepareMsg.Keyspace), nil
+		prepareRequestInfo := NewPrepareRequestInfo(baseRequestInfo, replacedTerms, stmtQueryData.queryData.hasPositionalBindMarkers(), prepareMsg.Query, prepareMsg.Keyspace)
+		prepareRequestInfo.requestKeyspace = stmtQueryData.queryData.getRequestKeyspace()
+		prepareRequestInfo.statementKeyspace = stmtQueryData.queryData.getApplicableKeyspace()
+		prepareRequestInfo.routableByKeyspace = isRoutableByKeyspace(stmtQueryData.queryData)
+		return prepareRequestInfo, nil
 	case primitive.OpCodeBatch:
 		decodedFrame, err := frameContext.GetOrDecodeFrame()
 		if err != nil {
@@ -113,12 +134,28 @@ func buildRequestInfo(
 		if !ok {
 			return nil, fmt.Errorf("could not convert message with batch op code to batch type, got %v instead", decodedFrame.Body.Message)
 		}
+		if keyspaceAllowlist != nil {
+			// prepared children were checked when they were prepared
+			stmtsQueryData, err := frameContext.GetOrInspectAllStatements(currentKeyspaceName, timeUuidGenerator)
+			if err != nil {
+				return nil, fmt.Errorf("could not inspect BATCH frame: %w", err)
+			}
+			for _, stmtQueryData := range stmtsQueryData {
+				err = keyspaceAllowlist.checkStatement(f.Header, stmtQueryData.queryData)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
 		preparedDataByStmtIdxMap := make(map[int]PreparedData)
 		for childIdx, child := range batchMsg.Children {
 			switch queryOrId := child.QueryOrId.(type) {
 			case []byte:
 				preparedData, err := getPreparedData(psCache, mh, queryOrId, primitive.OpCodeBatch, decodedFrame)
 				if err != nil {
+					if isForwardedPsCacheMiss(err, psCacheMissMode) {
+						return NewGenericRequestInfo(forwardToBoth, false, true), nil
+					}
 					return nil, err
 				} else {
 					preparedDataByStmtIdxMap[childIdx] = preparedData
@@ -138,7 +175,14 @@ func buildRequestInfo(
 		}
 		preparedData, err := getPreparedData(psCache, mh, executeMsg.QueryId, primitive.OpCodeExecute, decodedFrame)
 		if err != nil {
+			if isForwardedPsCacheMiss(err, psCacheMissMode) {
+				return NewGenericRequestInfo(forwardToBoth, false, true), nil
+			}
 			return nil, err
+		} else if isCounterRoutedToOrigin(preparedData, forwardCountersToOrigin, forwardCounterReadsToOrigin) {
+			log.Tracef("EXECUTE with prepared-id = '%s' targets a counter table, forwarding it to ORIGIN only.",
+				hex.EncodeToString(executeMsg.QueryId))
+			return NewCounterExecuteRequestInfo(preparedData), nil
 		} else {
 			return NewExecuteRequestInfo(preparedData), nil
 		}
@@ -173,10 +217,37 @@ func getPreparedData(
 	}
 }
 
+// isForwardedPsCacheMiss returns true if the error is a prepared statement cache miss and ZDM_PS_CACHE_MISS_MODE is FORWARD.
+// The request is then sent unmodified to both clusters because the proxy doesn't know the target prepared id
+// or whether the statement is a read, the clusters return UNPREPARED if they don't know the prepared id either.
+func isForwardedPsCacheMiss(err error, psCacheMissMode common.PsCacheMissMode) bool {
+	unpreparedErr, ok := err.(*UnpreparedExecuteError)
+	if !ok || psCacheMissMode != common.PsCacheMissModeForward {
+		return false
+	}
+	log.Debugf("Forwarding request with prepared-id = '%s' to both clusters after a PS cache miss.",
+		hex.EncodeToString(unpreparedErr.preparedId))
+	return true
+}
+
+// isCounterRoutedToOrigin returns true if the prepared statement targets a counter table and it has to be forwarded to
+// ORIGIN only: counter writes if ZDM_FORWARD_COUNTERS_TO_ORIGIN_ONLY is true because they are not idempotent and counter
+// reads if ZDM_FORWARD_COUNTER_READS_TO_ORIGIN_ONLY is true, otherwise counter reads are routed like any other read.
+func isCounterRoutedToOrigin(preparedData PreparedData, forwardCountersToOrigin bool, forwardCounterReadsToOrigin bool) bool {
+	if !preparedData.IsCounter() {
+		return false
+	}
+	if isPrimaryRead(preparedData.GetPrepareRequestInfo().GetBaseRequestInfo()) {
+		return forwardCounterReadsToOrigin
+	}
+	return forwardCountersToOrigin
+}
+
 func getRequestInfoFromQueryInfo(
 	f *frame.RawFrame,
 	primaryCluster common.ClusterType,
 	forwardSystemQueriesToTarget bool,
+	forwardSchemaQueriesToTarget bool,
 	virtualizationEnabled bool,
 	queryInfo QueryInfo) RequestInfo {
 
@@ -197,7 +268,15 @@ func getRequestInfoFromQueryInfo(
 			}
 		}
 
-		if isSystemQuery(queryInfo) {
+		if isSchemaQuery(queryInfo) {
+			sendAlsoToAsync = false
+			log.Debugf("Detected schema query: %v with stream id: %v", queryInfo.getQuery(), f.Header.StreamId)
+			if forwardSchemaQueriesToTarget {
+				forwardDecision = forwardToTarget
+			} else {
+				forwardDecision = forwardToOrigin
+			}
+		} else if isSystemQuery(queryInfo) {
 			sendAlsoToAsync = false
 			log.Debugf("Detected system query: %v with stream id: %v", queryInfo.getQuery(), f.Header.StreamId)
 			if forwardSystemQueriesToTarget {
@@ -231,6 +310,14 @@ func isSystemQuery(info QueryInfo) bool {
 		strings.HasPrefix(keyspace, "dse_")
 }
 
+// isSchemaQuery returns true for the tables that drivers read to build their schema metadata.
+func isSchemaQuery(info QueryInfo) bool {
+	keyspace := info.getApplicableKeyspace()
+	return keyspace == systemSchemaKeyspaceName ||
+		keyspace == systemVirtualSchemaKeyspaceName ||
+		(isSystemKeyspace(keyspace) && strings.HasPrefix(info.getTableName(), "schema_"))
+}
+
 func isSystemPeersV1(info QueryInfo) bool {
 	return isSystemKeyspace(info.getApplicableKeyspace()) && isPeersV1Table(info.getTableName())
 }
@@ -259,10 +346,41 @@ func isSystemKeyspace(keyspace string) bool {
 	return keyspace == systemKeyspaceName
 }
 
+// isUseQueryFrame checks if the frame is a QUERY request with a USE statement by looking at the beginning
+// of the query string, it does not decode the whole frame.
+func isUseQueryFrame(f *frame.RawFrame) bool {
+	if f.Header.OpCode != primitive.OpCodeQuery || f.Header.Flags.Contains(primitive.HeaderFlagCompressed) {
+		return false
+	}
+
+	// the body of a QUERY request starts with the query as a [long string]
+	if len(f.Body) < 4 {
+		return false
+	}
+	queryLength := int32(binary.BigEndian.Uint32(f.Body))
+	if queryLength < 0 || int(queryLength) > len(f.Body)-4 {
+		return false
+	}
+
+	query := bytes.TrimLeft(f.Body[4:4+queryLength], " \t\r\n")
+	if len(query) < 4 || !bytes.EqualFold(query[:3], []byte("use")) {
+		return false
+	}
+	switch query[3] {
+	case ' ', '\t', '\r', '\n', '"':
+		return true
+	default:
+		return false
+	}
+}
+
 type frameDecodeContext struct {
 	frame               *frame.RawFrame       // always non nil
+	codec               *connectionCodec      // codec of the client connection, the default codec is used if nil
 	decodedFrame        *frame.Frame          // nil until first decode
 	statementsQueryData []*statementQueryData // nil until first query inspection
+	correlationId       uint64                // 0 if the request is not a client request
+	cutoverState        *CutoverState         // nil until the request is forwarded
 }
 
 var NotInspectableErr = errors.New("only Query and Prepare messages can be inspected")
@@ -282,12 +400,33 @@ func (recv *frameDecodeContext) GetRawFrame() *frame.RawFrame {
 	return recv.frame
 }
 
+func (recv *frameDecodeContext) GetCorrelationId() uint64 {
+	return recv.correlationId
+}
+
+func (recv *frameDecodeContext) SetCorrelationId(correlationId uint64) {
+	recv.correlationId = correlationId
+}
+
+func (recv *frameDecodeContext) GetCutoverState() *CutoverState {
+	return recv.cutoverState
+}
+
+func (recv *frameDecodeContext) SetCutoverState(cutoverState *CutoverState) {
+	recv.cutoverState = cutoverState
+}
+
+// logger returns a logger that adds the correlation id of the request to every log line.
+func (recv *frameDecodeContext) logger() *log.Entry {
+	return newRequestLogger(recv.correlationId)
+}
+
 func (recv *frameDecodeContext) GetOrDecodeFrame() (*frame.Frame, error) {
 	if recv.decodedFrame != nil {
 		return recv.decodedFrame, nil
 	}
 
-	decodedFrame, err := defaultCodec.ConvertFromRawFrame(recv.frame)
+	decodedFrame, err := recv.codec.get().ConvertFromRawFrame(recv.frame)
 	if err != nil {
 		return nil, fmt.Errorf("could not decode raw frame: %w", err)
 	}
@@ -27,7 +27,7 @@ func getGeneralParamsForTests(t *testing.T) params {
 	require.Nil(t, err)
 
 	return params{
-		psCache:                      NewPreparedStatementCache(),
+		psCache:                      NewPreparedStatementCache(0),
 		mh:                           newFakeMetricHandler(),
 		kn:                           "",
 		primaryCluster:               common.ClusterTypeOrigin,
@@ -79,9 +79,12 @@ func parseEncodedRequestForTests(queryRawFrame *frame.RawFrame, t *testing.T) (R
 		generalParams.kn,
 		generalParams.primaryCluster,
 		generalParams.forwardSystemQueriesToTarget,
+		generalParams.forwardSystemQueriesToTarget,
 		generalParams.virtualizationEnabled,
 		generalParams.forwardAuthToTarget,
-		generalParams.timeUuidGenerator)
+		false,
+		false,
+		generalParams.timeUuidGenerator, nil, common.PsCacheMissModeUnprepared)
 }
 
 func checkExpectedForwardDecisionOrErrorForTests(actualRequestInfo RequestInfo, actualError error, expected interface{}, t *testing.T) {
@@ -3,6 +3,7 @@ package zdmproxy
 import (
 	"encoding/hex"
 	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
 	"github.com/datastax/go-cassandra-native-protocol/frame"
 	"github.com/datastax/go-cassandra-native-protocol/message"
 	"github.com/datastax/go-cassandra-native-protocol/primitive"
@@ -57,7 +58,7 @@ func TestInspectFrame(t *testing.T) {
 		targetPreparedId:   []byte("LOCAL"),
 		prepareRequestInfo: NewPrepareRequestInfo(NewInterceptedRequestInfo(local, newStarSelectClause()), nil, false, "SELECT * FROM system.local", ""),
 	}
-	psCache := NewPreparedStatementCache()
+	psCache := NewPreparedStatementCache(0)
 	psCache.cache["BOTH"] = bothCacheEntry
 	psCache.cache["ORIGIN"] = originCacheEntry
 	psCache.cache["TARGET"] = targetCacheEntry
@@ -95,20 +96,20 @@ func TestInspectFrame(t *testing.T) {
 		{"OpCodeQuery UNKNOWN", args{mockQueryFrame(t, "UNKNOWN"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewGenericRequestInfo(forwardToBoth, false, true)},
 
 		// PREPARE
-		{"OpCodePrepare SELECT", args{mockPrepareFrame(t, "SELECT blah FROM ks1.t1"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewPrepareRequestInfo(NewGenericRequestInfo(forwardToOrigin, true, true), []*term{}, false, "SELECT blah FROM ks1.t1", "")},
-		{"OpCodePrepare SELECT system.local forwardSystemQueriesToOrigin", args{mockPrepareFrame(t, "SELECT * FROM system.local"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewPrepareRequestInfo(NewInterceptedRequestInfo(local, newStarSelectClause()), []*term{}, false, "SELECT * FROM system.local", "")},
-		{"OpCodePrepare SELECT system.peers forwardSystemQueriesToOrigin", args{mockPrepareFrame(t, "SELECT * FROM system.peers"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewPrepareRequestInfo(NewInterceptedRequestInfo(peersV1, newStarSelectClause()), []*term{}, false, "SELECT * FROM system.peers", "")},
-		{"OpCodePrepare SELECT system.local", args{mockPrepareFrame(t, "SELECT * FROM system.local"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, NewPrepareRequestInfo(NewInterceptedRequestInfo(local, newStarSelectClause()), []*term{}, false, "SELECT * FROM system.local", "")},
-		{"OpCodePrepare SELECT local", args{mockPrepareFrameWithKeyspace(t, "SELECT * FROM local", "system"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, NewPrepareRequestInfo(NewInterceptedRequestInfo(local, newStarSelectClause()), []*term{}, false, "SELECT * FROM local", "system")},
-		{"OpCodePrepare SELECT system.peers", args{mockPrepareFrame(t, "SELECT * FROM system.peers"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, NewPrepareRequestInfo(NewInterceptedRequestInfo(peersV1, newStarSelectClause()), []*term{}, false, "SELECT * FROM system.peers", "")},
-		{"OpCodePrepare SELECT peers", args{mockPrepareFrameWithKeyspace(t, "SELECT * FROM peers", "system"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, NewPrepareRequestInfo(NewInterceptedRequestInfo(peersV1, newStarSelectClause()), []*term{}, false, "SELECT * FROM peers", "system")},
-		{"OpCodePrepare SELECT system.peers_v2", args{mockPrepareFrame(t, "SELECT * FROM system.peers_v2"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, NewPrepareRequestInfo(NewInterceptedRequestInfo(peersV2, newStarSelectClause()), []*term{}, false, "SELECT * FROM system.peers_v2", "")},
-		{"OpCodePrepare SELECT system.peers_v2 forwardSystemQueriesToOrigin", args{mockPrepareFrame(t, "SELECT * FROM system.peers_v2"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewPrepareRequestInfo(NewInterceptedRequestInfo(peersV2, newStarSelectClause()), []*term{}, false, "SELECT * FROM system.peers_v2", "")},
-		{"OpCodePrepare SELECT system_auth.roles", args{mockPrepareFrame(t, "SELECT * FROM system_auth.roles"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, NewPrepareRequestInfo(NewGenericRequestInfo(forwardToTarget, false, true), []*term{}, false, "SELECT * FROM system_auth.roles", "")},
-		{"OpCodePrepare SELECT dse_insights.tokens", args{mockPrepareFrame(t, "SELECT * FROM dse_insights.tokens"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, NewPrepareRequestInfo(NewGenericRequestInfo(forwardToTarget, false, true), []*term{}, false, "SELECT * FROM dse_insights.tokens", "")},
-		{"OpCodePrepare INSERT INTO asd (a, b) VALUES (1, 2)", args{mockPrepareFrame(t, "INSERT INTO asd (a, b) VALUES (1, 2)"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), []*term{}, false, "INSERT INTO asd (a, b) VALUES (1, 2)", "")},
-		{"OpCodePrepare UPDATE asd SET b = 2 WHERE a = 1", args{mockPrepareFrame(t, "UPDATE asd SET b = 2 WHERE a = 1"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), []*term{}, false, "UPDATE asd SET b = 2 WHERE a = 1", "")},
-		{"OpCodePrepare UNKNOWN", args{mockPrepareFrame(t, "UNKNOWN"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), []*term{}, false, "UNKNOWN", "")},
+		{"OpCodePrepare SELECT", args{mockPrepareFrame(t, "SELECT blah FROM ks1.t1"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, withRoutableByKeyspace(withStatementKeyspace(NewPrepareRequestInfo(NewGenericRequestInfo(forwardToOrigin, true, true), []*term{}, false, "SELECT blah FROM ks1.t1", ""), "ks1"))},
+		{"OpCodePrepare SELECT system.local forwardSystemQueriesToOrigin", args{mockPrepareFrame(t, "SELECT * FROM system.local"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, withStatementKeyspace(NewPrepareRequestInfo(NewInterceptedRequestInfo(local, newStarSelectClause()), []*term{}, false, "SELECT * FROM system.local", ""), "system")},
+		{"OpCodePrepare SELECT system.peers forwardSystemQueriesToOrigin", args{mockPrepareFrame(t, "SELECT * FROM system.peers"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, withStatementKeyspace(NewPrepareRequestInfo(NewInterceptedRequestInfo(peersV1, newStarSelectClause()), []*term{}, false, "SELECT * FROM system.peers", ""), "system")},
+		{"OpCodePrepare SELECT system.local", args{mockPrepareFrame(t, "SELECT * FROM system.local"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, withStatementKeyspace(NewPrepareRequestInfo(NewInterceptedRequestInfo(local, newStarSelectClause()), []*term{}, false, "SELECT * FROM system.local", ""), "system")},
+		{"OpCodePrepare SELECT local", args{mockPrepareFrameWithKeyspace(t, "SELECT * FROM local", "system"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, withStatementKeyspace(NewPrepareRequestInfo(NewInterceptedRequestInfo(local, newStarSelectClause()), []*term{}, false, "SELECT * FROM local", "system"), "system")},
+		{"OpCodePrepare SELECT system.peers", args{mockPrepareFrame(t, "SELECT * FROM system.peers"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, withStatementKeyspace(NewPrepareRequestInfo(NewInterceptedRequestInfo(peersV1, newStarSelectClause()), []*term{}, false, "SELECT * FROM system.peers", ""), "system")},
+		{"OpCodePrepare SELECT peers", args{mockPrepareFrameWithKeyspace(t, "SELECT * FROM peers", "system"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, withStatementKeyspace(NewPrepareRequestInfo(NewInterceptedRequestInfo(peersV1, newStarSelectClause()), []*term{}, false, "SELECT * FROM peers", "system"), "system")},
+		{"OpCodePrepare SELECT system.peers_v2", args{mockPrepareFrame(t, "SELECT * FROM system.peers_v2"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, withStatementKeyspace(NewPrepareRequestInfo(NewInterceptedRequestInfo(peersV2, newStarSelectClause()), []*term{}, false, "SELECT * FROM system.peers_v2", ""), "system")},
+		{"OpCodePrepare SELECT system.peers_v2 forwardSystemQueriesToOrigin", args{mockPrepareFrame(t, "SELECT * FROM system.peers_v2"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, withStatementKeyspace(NewPrepareRequestInfo(NewInterceptedRequestInfo(peersV2, newStarSelectClause()), []*term{}, false, "SELECT * FROM system.peers_v2", ""), "system")},
+		{"OpCodePrepare SELECT system_auth.roles", args{mockPrepareFrame(t, "SELECT * FROM system_auth.roles"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, withStatementKeyspace(NewPrepareRequestInfo(NewGenericRequestInfo(forwardToTarget, false, true), []*term{}, false, "SELECT * FROM system_auth.roles", ""), "system_auth")},
+		{"OpCodePrepare SELECT dse_insights.tokens", args{mockPrepareFrame(t, "SELECT * FROM dse_insights.tokens"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToTarget, forwardAuthToOrigin}, withStatementKeyspace(NewPrepareRequestInfo(NewGenericRequestInfo(forwardToTarget, false, true), []*term{}, false, "SELECT * FROM dse_insights.tokens", ""), "dse_insights")},
+		{"OpCodePrepare INSERT INTO asd (a, b) VALUES (1, 2)", args{mockPrepareFrame(t, "INSERT INTO asd (a, b) VALUES (1, 2)"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, withRoutableByKeyspace(NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), []*term{}, false, "INSERT INTO asd (a, b) VALUES (1, 2)", ""))},
+		{"OpCodePrepare UPDATE asd SET b = 2 WHERE a = 1", args{mockPrepareFrame(t, "UPDATE asd SET b = 2 WHERE a = 1"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, withRoutableByKeyspace(NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), []*term{}, false, "UPDATE asd SET b = 2 WHERE a = 1", ""))},
+		{"OpCodePrepare UNKNOWN", args{mockPrepareFrame(t, "UNKNOWN"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, withRoutableByKeyspace(NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), []*term{}, false, "UNKNOWN", ""))},
 
 		// EXECUTE
 		{"OpCodeExecute origin", args{mockExecuteFrame(t, "ORIGIN"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewExecuteRequestInfo(originCacheEntry)},
@@ -124,6 +125,8 @@ func TestInspectFrame(t *testing.T) {
 		// BATCH
 		{"OpCodeBatch simple", args{mockBatch(t, "simple query"), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewBatchRequestInfo(map[int]PreparedData{})},
 		{"OpCodeBatch prepared", args{mockBatch(t, []byte("BOTH")), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewBatchRequestInfo(map[int]PreparedData{0: bothCacheEntry})},
+		{"OpCodeBatch mixed", args{mockBatchWithChildren(t, []*message.BatchChild{{QueryOrId: "simple query"}, {QueryOrId: []byte("BOTH")}}), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewBatchRequestInfo(map[int]PreparedData{1: bothCacheEntry})},
+		{"OpCodeBatch mixed not cached", args{mockBatchWithChildren(t, []*message.BatchChild{{QueryOrId: "simple query"}, {QueryOrId: []byte("BOTH")}, {QueryOrId: []byte("NOT_CACHED")}}), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, "The preparedID of the statement to be executed (4e4f545f434143484544) does not exist in the proxy cache"},
 		// AUTH_RESPONSE
 		{"OpCodeAuthResponse ForwardAuthToTarget", args{mockAuthResponse(t), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToTarget}, NewGenericRequestInfo(forwardToTarget, false, false)},
 		{"OpCodeAuthResponse ForwardAuthToOrigin", args{mockAuthResponse(t), []*term{}, primaryClusterOrigin, forwardSystemQueriesToOrigin, forwardAuthToOrigin}, NewGenericRequestInfo(forwardToOrigin, false, false)},
@@ -138,7 +141,7 @@ func TestInspectFrame(t *testing.T) {
 			actual, err := buildRequestInfo(&frameDecodeContext{frame: tt.args.f}, []*statementReplacedTerms{{
 				statementIndex: 0,
 				replacedTerms:  tt.args.replacedTerms,
-			}}, psCache, mh, km, tt.args.primaryCluster, tt.args.forwardSystemQueriesToTarget, true, tt.args.forwardAuthToTarget, timeUuidGenerator)
+			}}, psCache, mh, km, tt.args.primaryCluster, tt.args.forwardSystemQueriesToTarget, tt.args.forwardSystemQueriesToTarget, true, tt.args.forwardAuthToTarget, false, false, timeUuidGenerator, nil, common.PsCacheMissModeUnprepared)
 			if err != nil {
 				if !reflect.DeepEqual(err.Error(), tt.expected) {
 					t.Errorf("buildRequestInfo() actual = %v, expected %v", err, tt.expected)
@@ -150,6 +153,140 @@ func TestInspectFrame(t *testing.T) {
 	}
 }
 
+func TestInspectFrame_CounterExecute(t *testing.T) {
+	counterPreparedResult := &message.PreparedResult{
+		PreparedQueryId: []byte("COUNTER"),
+		VariablesMetadata: &message.VariablesMetadata{
+			PkIndices: []uint16{1},
+			Columns: []*message.ColumnMetadata{
+				{Keyspace: "ks1", Table: "counters", Name: "c", Index: 0, Type: datatype.Counter},
+				{Keyspace: "ks1", Table: "counters", Name: "k", Index: 1, Type: datatype.Int},
+			},
+		},
+	}
+	regularPreparedResult := &message.PreparedResult{
+		PreparedQueryId: []byte("REGULAR"),
+		VariablesMetadata: &message.VariablesMetadata{
+			PkIndices: []uint16{0},
+			Columns: []*message.ColumnMetadata{
+				{Keyspace: "ks1", Table: "regular", Name: "k", Index: 0, Type: datatype.Int},
+				{Keyspace: "ks1", Table: "regular", Name: "c", Index: 1, Type: datatype.Bigint},
+			},
+		},
+	}
+	counterSelectPreparedResult := &message.PreparedResult{
+		PreparedQueryId: []byte("COUNTER_SELECT"),
+		VariablesMetadata: &message.VariablesMetadata{
+			PkIndices: []uint16{0},
+			Columns: []*message.ColumnMetadata{
+				{Keyspace: "ks1", Table: "counters", Name: "k", Index: 0, Type: datatype.Int},
+			},
+		},
+		ResultMetadata: &message.RowsMetadata{
+			ColumnCount: 1,
+			Columns: []*message.ColumnMetadata{
+				{Keyspace: "ks1", Table: "counters", Name: "c", Index: 0, Type: datatype.Counter},
+			},
+		},
+	}
+
+	psCache := NewPreparedStatementCache(0)
+	psCache.Store(counterPreparedResult, counterPreparedResult, NewPrepareRequestInfo(
+		NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "UPDATE ks1.counters SET c = c + ? WHERE k = ?", ""))
+	psCache.Store(regularPreparedResult, regularPreparedResult, NewPrepareRequestInfo(
+		NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "UPDATE ks1.regular SET c = ? WHERE k = ?", ""))
+	psCache.Store(counterSelectPreparedResult, counterSelectPreparedResult, NewPrepareRequestInfo(
+		NewGenericRequestInfo(forwardToTarget, true, true), nil, false, "SELECT c FROM ks1.counters WHERE k = ?", ""))
+
+	counterData, ok := psCache.Get([]byte("COUNTER"))
+	require.True(t, ok)
+	require.True(t, counterData.IsCounter())
+	regularData, ok := psCache.Get([]byte("REGULAR"))
+	require.True(t, ok)
+	require.False(t, regularData.IsCounter())
+	counterSelectData, ok := psCache.Get([]byte("COUNTER_SELECT"))
+	require.True(t, ok)
+	require.True(t, counterSelectData.IsCounter())
+
+	tests := []struct {
+		name                        string
+		preparedId                  string
+		forwardCountersToOrigin     bool
+		forwardCounterReadsToOrigin bool
+		expectedDecision            forwardDecision
+		expectedAsync               bool
+	}{
+		{"counter update, disabled", "COUNTER", false, false, forwardToBoth, false},
+		{"counter update, enabled", "COUNTER", true, false, forwardToOrigin, false},
+		{"counter update, reads enabled", "COUNTER", false, true, forwardToBoth, false},
+		{"regular update, enabled", "REGULAR", true, true, forwardToBoth, false},
+		{"counter select, disabled", "COUNTER_SELECT", false, false, forwardToTarget, true},
+		// counter reads follow the read cluster unless counter reads are forwarded to ORIGIN as well
+		{"counter select, enabled", "COUNTER_SELECT", true, false, forwardToTarget, true},
+		{"counter select, reads enabled", "COUNTER_SELECT", true, true, forwardToOrigin, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeUuidGenerator, err := GetDefaultTimeUuidGenerator()
+			require.Nil(t, err)
+			actual, err := buildRequestInfo(
+				&frameDecodeContext{frame: mockExecuteFrame(t, tt.preparedId)}, []*statementReplacedTerms{}, psCache,
+				newFakeMetricHandler(), "", common.ClusterTypeTarget, false, false, true, false, tt.forwardCountersToOrigin, tt.forwardCounterReadsToOrigin, timeUuidGenerator, nil, common.PsCacheMissModeUnprepared)
+			require.Nil(t, err)
+			require.IsType(t, &ExecuteRequestInfo{}, actual)
+			require.Equal(t, tt.expectedDecision, actual.GetForwardDecision())
+			require.Equal(t, tt.expectedAsync, actual.ShouldAlsoBeSentAsync())
+			require.True(t, actual.ShouldBeTrackedInMetrics())
+		})
+	}
+}
+
+func TestInspectFrame_PsCacheMiss(t *testing.T) {
+	// the cache only has an entry for a different prepared id, as if the statement had been evicted (or never stored)
+	cacheWithoutEntry := NewPreparedStatementCache(0)
+	otherPreparedResult := &message.PreparedResult{PreparedQueryId: []byte("OTHER")}
+	cacheWithoutEntry.Store(otherPreparedResult, otherPreparedResult, NewPrepareRequestInfo(
+		NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "UPDATE ks1.t SET c = ? WHERE k = ?", ""))
+
+	caches := []struct {
+		name    string
+		psCache *PreparedStatementCache
+	}{
+		{"nil cache", nil},
+		{"cache without entry", cacheWithoutEntry},
+	}
+	requests := []struct {
+		name string
+		f    *frame.RawFrame
+	}{
+		{"execute", mockExecuteFrame(t, "MISSING")},
+		{"batch", mockBatchWithChildren(t, []*message.BatchChild{
+			{QueryOrId: "INSERT INTO ks1.t (k, c) VALUES (1, 1)"}, {QueryOrId: []byte("MISSING")}})},
+	}
+
+	for _, cache := range caches {
+		for _, request := range requests {
+			t.Run(cache.name+", "+request.name, func(t *testing.T) {
+				timeUuidGenerator, err := GetDefaultTimeUuidGenerator()
+				require.Nil(t, err)
+
+				_, err = buildRequestInfo(
+					NewFrameDecodeContext(request.f), []*statementReplacedTerms{}, cache.psCache, newFakeMetricHandler(),
+					"", common.ClusterTypeOrigin, false, false, true, false, false, false, timeUuidGenerator, nil, common.PsCacheMissModeUnprepared)
+				unpreparedErr, ok := err.(*UnpreparedExecuteError)
+				require.True(t, ok, "expected UnpreparedExecuteError but got %v", err)
+				require.Equal(t, []byte("MISSING"), unpreparedErr.preparedId)
+
+				actual, err := buildRequestInfo(
+					NewFrameDecodeContext(request.f), []*statementReplacedTerms{}, cache.psCache, newFakeMetricHandler(),
+					"", common.ClusterTypeOrigin, false, false, true, false, false, false, timeUuidGenerator, nil, common.PsCacheMissModeForward)
+				require.Nil(t, err)
+				require.Equal(t, NewGenericRequestInfo(forwardToBoth, false, true), actual)
+			})
+		}
+	}
+}
+
 func mockPrepareFrame(t *testing.T, query string) *frame.RawFrame {
 	prepareMsg := &message.Prepare{
 		Query:    query,
@@ -214,20 +351,94 @@ func newFakeMetricHandler() *metrics.MetricHandler {
 
 func newFakeProxyMetrics() *metrics.ProxyMetrics {
 	return &metrics.ProxyMetrics{
-		FailedReadsOrigin:        newFakeCounter(),
-		FailedReadsTarget:        newFakeCounter(),
-		FailedWritesOnOrigin:     newFakeCounter(),
-		FailedWritesOnTarget:     newFakeCounter(),
-		FailedWritesOnBoth:       newFakeCounter(),
-		PSCacheSize:              newFakeGaugeFunc(),
-		PSCacheMissCount:         newFakeCounter(),
-		ProxyReadsOriginDuration: newFakeHistogram(),
-		ProxyReadsTargetDuration: newFakeHistogram(),
-		ProxyWritesDuration:      newFakeHistogram(),
-		InFlightReadsOrigin:      newFakeGauge(),
-		InFlightReadsTarget:      newFakeGauge(),
-		InFlightWrites:           newFakeGauge(),
-		OpenClientConnections:    newFakeGaugeFunc(),
+		FailedReadsOrigin:                   newFakeCounter(),
+		FailedReadsTarget:                   newFakeCounter(),
+		FailedWritesOnOrigin:                newFakeCounter(),
+		FailedWritesOnTarget:                newFakeCounter(),
+		FailedWritesOnBoth:                  newFakeCounter(),
+		ToleratedAlreadyExistsOrigin:        newFakeCounter(),
+		ToleratedAlreadyExistsTarget:        newFakeCounter(),
+		BackendProtocolErrorsOrigin:         newFakeCounter(),
+		BackendProtocolErrorsTarget:         newFakeCounter(),
+		PSCacheSize:                         newFakeGaugeFunc(),
+		PSCacheMissCount:                    newFakeCounter(),
+		ProxyReadsOriginDuration:            newFakeHistogram(),
+		ProxyReadsTargetDuration:            newFakeHistogram(),
+		ProxyWritesDuration:                 newFakeHistogram(),
+		SloBreachesReadsOrigin:              newFakeCounter(),
+		SloBreachesReadsTarget:              newFakeCounter(),
+		SloBreachesWrites:                   newFakeCounter(),
+		InFlightReadsOrigin:                 newFakeGauge(),
+		InFlightReadsTarget:                 newFakeGauge(),
+		InFlightWrites:                      newFakeGauge(),
+		OpenClientConnections:               newFakeGaugeFunc(),
+		ClientConnectionsV2:                 newFakeGauge(),
+		ClientConnectionsV3:                 newFakeGauge(),
+		ClientConnectionsV4:                 newFakeGauge(),
+		ClientConnectionsV5:                 newFakeGauge(),
+		ClientConnectionsDseV1:              newFakeGauge(),
+		ClientConnectionsDseV2:              newFakeGauge(),
+		Cutovers:                            newFakeCounter(),
+		DroppedLateResponses:                newFakeCounter(),
+		UnknownStreamIdResponses:            newFakeCounter(),
+		UnregisteredEvents:                  newFakeCounter(),
+		ClientHandshakeTimeouts:             newFakeCounter(),
+		ClientAuthIdleTimeouts:              newFakeCounter(),
+		AbortedHandshakes:                   newFakeCounter(),
+		UnexpectedResponses:                 newFakeCounter(),
+		UnknownForwardDecisions:             newFakeCounter(),
+		RejectedClientConnections:           newFakeCounter(),
+		RejectedKeyspaceRequests:            newFakeCounter(),
+		MalformedFrames:                     newFakeCounter(),
+		WrongDirectionFrames:                newFakeCounter(),
+		DroppedEvents:                       newFakeCounter(),
+		DroppedEventsOnShutdown:             newFakeCounter(),
+		LikelyRetries:                       newFakeCounter(),
+		AsyncReadsMaxWaitExceeded:           newFakeCounter(),
+		TargetUnpreparedWriteRetries:        newFakeCounter(),
+		ReadFailovers:                       newFakeCounter(),
+		ReadRacesWonBySecondary:             newFakeCounter(),
+		ReadMismatchesTargetExtraRows:       newFakeCounter(),
+		ReadMismatchesOriginExtraRows:       newFakeCounter(),
+		ReadMismatchesValuesDiffer:          newFakeCounter(),
+		ReadMismatchesMetadataOnly:          newFakeCounter(),
+		MismatchReports:                     newFakeCounter(),
+		QuarantinedPreparedStatements:       newFakeCounter(),
+		LargeBatches:                        newFakeCounter(),
+		LargeResponses:                      newFakeCounter(),
+		RejectedRegisterRequests:            newFakeCounter(),
+		ClusterDownBufferedRequests:         newFakeCounter(),
+		ClusterDownRejectedRequests:         newFakeCounter(),
+		CqlVersionMismatches:                newFakeCounter(),
+		UnloggedBatchPartialDivergences:     newFakeCounter(),
+		BatchWarningDivergences:             newFakeCounter(),
+		HandshakesInProgress:                newFakeGauge(),
+		Goroutines:                          newFakeGaugeFunc(),
+		ClientHandlers:                      newFakeGaugeFunc(),
+		ClientHandlerInFlightGoroutines:     newFakeGaugeFunc(),
+		ClientHandlerMaxInFlightGoroutines:  newFakeGaugeFunc(),
+		RequestQueueDepth:                   newFakeGaugeFunc(),
+		ResponseQueueDepth:                  newFakeGaugeFunc(),
+		EventQueueDepth:                     newFakeGaugeFunc(),
+		TrackingMapEntries:                  newFakeGauge(),
+		TrackingMapEvictions:                newFakeCounter(),
+		OriginRequestErrorRate:              newFakeGaugeFunc(),
+		TargetRequestErrorRate:              newFakeGaugeFunc(),
+		ReadRoutingBias:                     newFakeGaugeFunc(),
+		OriginControlConnectionsEstablished: newFakeGaugeFunc(),
+		TargetControlConnectionsEstablished: newFakeGaugeFunc(),
+		OriginControlConnectionAge:          newFakeGaugeFunc(),
+		TargetControlConnectionAge:          newFakeGaugeFunc(),
+		RequestsQuery:                       newFakeCounter(),
+		RequestsExecute:                     newFakeCounter(),
+		RequestsPrepare:                     newFakeCounter(),
+		RequestsBatch:                       newFakeCounter(),
+		RequestsRegister:                    newFakeCounter(),
+		RequestsOther:                       newFakeCounter(),
+		OriginControlFrames:                 newFakeCounter(),
+		OriginDataFrames:                    newFakeCounter(),
+		TargetControlFrames:                 newFakeCounter(),
+		TargetDataFrames:                    newFakeCounter(),
 	}
 }
 
@@ -278,3 +489,125 @@ func (recv *fakeMetric) WithLabels(map[string]string) metrics.Metric {
 func newFakeMetric() metrics.Metric {
 	return &fakeMetric{}
 }
+
+func TestInspectFrame_KeyspaceAllowlist(t *testing.T) {
+	allowlist := newKeyspaceAllowlist([]string{"ks1", "Ks2"})
+	query := func(query string) *frame.RawFrame {
+		return mockQueryFrame(t, query)
+	}
+
+	tests := []struct {
+		name             string
+		f                *frame.RawFrame
+		currentKeyspace  string
+		allowlist        *keyspaceAllowlist
+		expectedKeyspace string
+	}{
+		{"select allowed", query("SELECT * FROM ks1.t"), "", allowlist, ""},
+		{"select disallowed", query("SELECT * FROM ks3.t"), "ks1", allowlist, "ks3"},
+		{"select quoted identifier allowed", query("SELECT * FROM \"Ks2\".t"), "", allowlist, ""},
+		{"select unquoted identifier is lowercased", query("SELECT * FROM Ks2.t"), "", allowlist, "ks2"},
+		{"current keyspace allowed", query("SELECT * FROM t"), "ks1", allowlist, ""},
+		{"current keyspace disallowed", query("INSERT INTO t (a) VALUES (1)"), "ks3", allowlist, "ks3"},
+		{"no keyspace", query("SELECT * FROM t"), "", allowlist, ""},
+		{"system keyspace", query("SELECT * FROM system.local"), "ks3", allowlist, ""},
+		{"system_schema keyspace", query("SELECT * FROM system_schema.tables"), "", allowlist, ""},
+		{"use allowed", query("USE ks1"), "", allowlist, ""},
+		{"use disallowed", query("USE ks3"), "ks1", allowlist, "ks3"},
+		{"batch query with disallowed child", query(
+			"BEGIN BATCH INSERT INTO ks3.t (a) VALUES (1); INSERT INTO ks1.t (a) VALUES (1) APPLY BATCH"), "", allowlist, "ks3"},
+		{"prepare disallowed", mockFrame(t, &message.Prepare{Query: "UPDATE ks3.t SET b = 1 WHERE a = 1"}, primitive.ProtocolVersion4),
+			"", allowlist, "ks3"},
+		{"batch with allowed children", mockBatchWithChildren(t, []*message.BatchChild{
+			{QueryOrId: "INSERT INTO ks1.t (a) VALUES (1)"}, {QueryOrId: "DELETE FROM t WHERE a = 1"}}), "ks1", allowlist, ""},
+		{"batch with disallowed child", mockBatchWithChildren(t, []*message.BatchChild{
+			{QueryOrId: "INSERT INTO ks1.t (a) VALUES (1)"}, {QueryOrId: "DELETE FROM ks3.t WHERE a = 1"}}), "", allowlist, "ks3"},
+		{"no allowlist", query("SELECT * FROM ks3.t"), "", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeUuidGenerator, err := GetDefaultTimeUuidGenerator()
+			require.Nil(t, err)
+			_, err = buildRequestInfo(
+				NewFrameDecodeContext(tt.f), []*statementReplacedTerms{}, NewPreparedStatementCache(0), newFakeMetricHandler(),
+				tt.currentKeyspace, common.ClusterTypeOrigin, false, false, true, false, false, false, timeUuidGenerator, tt.allowlist, common.PsCacheMissModeUnprepared)
+			if tt.expectedKeyspace == "" {
+				require.Nil(t, err)
+			} else {
+				notAllowedErr, ok := err.(*KeyspaceNotAllowedError)
+				require.True(t, ok, "expected KeyspaceNotAllowedError but got %v", err)
+				require.Equal(t, tt.expectedKeyspace, notAllowedErr.keyspace)
+				require.Equal(t, tt.f.Header.StreamId, notAllowedErr.Header.StreamId)
+			}
+		})
+	}
+}
+
+func TestInspectFrame_SchemaQueries(t *testing.T) {
+	query := func(q string) *frame.RawFrame {
+		return mockQueryFrame(t, q)
+	}
+	tests := []struct {
+		name                         string
+		f                            *frame.RawFrame
+		currentKeyspace              string
+		forwardSystemQueriesToTarget bool
+		forwardSchemaQueriesToTarget bool
+		expectedDecision             forwardDecision
+	}{
+		{"system_schema to target", query("SELECT * FROM system_schema.tables"), "", false, true, forwardToTarget},
+		{"system_schema to origin", query("SELECT * FROM system_schema.tables"), "", true, false, forwardToOrigin},
+		{"system_schema current keyspace", query("SELECT * FROM tables"), "system_schema", false, true, forwardToTarget},
+		{"system_virtual_schema", query("SELECT * FROM system_virtual_schema.tables"), "", false, true, forwardToTarget},
+		{"legacy schema table", query("SELECT * FROM system.schema_columnfamilies"), "", false, true, forwardToTarget},
+		{"system table", query("SELECT * FROM system.size_estimates"), "", false, true, forwardToOrigin},
+		{"system_auth", query("SELECT * FROM system_auth.roles"), "", true, false, forwardToTarget},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeUuidGenerator, err := GetDefaultTimeUuidGenerator()
+			require.Nil(t, err)
+			actual, err := buildRequestInfo(
+				NewFrameDecodeContext(tt.f), []*statementReplacedTerms{}, NewPreparedStatementCache(0), newFakeMetricHandler(),
+				tt.currentKeyspace, common.ClusterTypeOrigin, tt.forwardSystemQueriesToTarget, tt.forwardSchemaQueriesToTarget,
+				false, false, false, false, timeUuidGenerator, nil, common.PsCacheMissModeUnprepared)
+			require.Nil(t, err)
+			require.Equal(t, tt.expectedDecision, actual.GetForwardDecision())
+		})
+	}
+}
+
+func TestIsUseQueryFrame(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      message.Message
+		expected bool
+	}{
+		{"use", &message.Query{Query: "USE ks1"}, true},
+		{"lower case", &message.Query{Query: "use ks1"}, true},
+		{"leading whitespace", &message.Query{Query: " \n\tUse ks1"}, true},
+		{"quoted keyspace", &message.Query{Query: "USE\"Ks1\""}, true},
+		{"keyspace prefix", &message.Query{Query: "USERS"}, false},
+		{"select", &message.Query{Query: "SELECT * FROM ks1.users"}, false},
+		{"use only", &message.Query{Query: "USE"}, false},
+		{"prepare", &message.Prepare{Query: "USE ks1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, isUseQueryFrame(mustEncodeFrame(t, tt.msg)))
+		})
+	}
+}
+
+func withStatementKeyspace(prepareRequestInfo *PrepareRequestInfo, keyspace string) *PrepareRequestInfo {
+	prepareRequestInfo.statementKeyspace = keyspace
+	return prepareRequestInfo
+}
+
+func withRoutableByKeyspace(prepareRequestInfo *PrepareRequestInfo) *PrepareRequestInfo {
+	prepareRequestInfo.routableByKeyspace = true
+	return prepareRequestInfo
+}
@@ -0,0 +1,203 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// supportedCqlVersions keeps the CQL versions that each cluster returned in the last SUPPORTED response that was
+// received from both clusters so that the CQL_VERSION of the clients' STARTUP requests can be negotiated with both
+// clusters. It is shared by every client connection of the proxy instance.
+// A nil supportedCqlVersions doesn't keep anything.
+type supportedCqlVersions struct {
+	lock   *sync.RWMutex
+	origin []string
+	target []string
+}
+
+func newSupportedCqlVersions() *supportedCqlVersions {
+	return &supportedCqlVersions{lock: &sync.RWMutex{}}
+}
+
+func (recv *supportedCqlVersions) get() ([]string, []string) {
+	if recv == nil {
+		return nil, nil
+	}
+
+	recv.lock.RLock()
+	defer recv.lock.RUnlock()
+	return recv.origin, recv.target
+}
+
+func (recv *supportedCqlVersions) store(origin []string, target []string) {
+	if recv == nil {
+		return
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	recv.origin = origin
+	recv.target = target
+}
+
+type cqlVersion [3]int
+
+// parseCqlVersion parses versions like 3.4.5, missing minor and patch versions are 0 and qualifiers (e.g. -SNAPSHOT)
+// are ignored.
+func parseCqlVersion(version string) (cqlVersion, bool) {
+	var parsed cqlVersion
+	version = strings.SplitN(strings.TrimSpace(version), "-", 2)[0]
+	parts := strings.Split(version, ".")
+	if len(parts) > len(parsed) {
+		return parsed, false
+	}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return parsed, false
+		}
+		parsed[i] = number
+	}
+	return parsed, true
+}
+
+func (recv cqlVersion) compare(other cqlVersion) int {
+	for i := range recv {
+		if recv[i] != other[i] {
+			if recv[i] < other[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// isCqlVersionSupported returns true if one of the versions of a SUPPORTED response has the same major version and is
+// not older than the provided version, i.e. the cluster accepts a STARTUP request with that version.
+func isCqlVersionSupported(version cqlVersion, supportedVersions []string) bool {
+	for _, supportedVersion := range supportedVersions {
+		parsed, ok := parseCqlVersion(supportedVersion)
+		if ok && parsed[0] == version[0] && parsed.compare(version) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateCqlVersion returns true if the requested version is not supported by both clusters along with the highest
+// version of their SUPPORTED responses that both clusters support, the returned version is empty if there is none.
+func negotiateCqlVersion(requestedVersion string, originVersions []string, targetVersions []string) (string, bool) {
+	requested, ok := parseCqlVersion(requestedVersion)
+	if !ok || isCqlVersionSupported(requested, originVersions) && isCqlVersionSupported(requested, targetVersions) {
+		return "", false
+	}
+
+	agreedVersion := ""
+	var agreed cqlVersion
+	for _, candidateVersion := range append(append([]string{}, originVersions...), targetVersions...) {
+		candidate, ok := parseCqlVersion(candidateVersion)
+		if !ok || !isCqlVersionSupported(candidate, originVersions) || !isCqlVersionSupported(candidate, targetVersions) {
+			continue
+		}
+		if agreedVersion == "" || candidate.compare(agreed) > 0 {
+			agreedVersion, agreed = candidateVersion, candidate
+		}
+	}
+	return agreedVersion, true
+}
+
+// trackSupportedCqlVersions keeps the CQL versions of the SUPPORTED responses that both clusters returned to a client's
+// OPTIONS request, see negotiateStartupCqlVersion.
+func (ch *ClientHandler) trackSupportedCqlVersions(originResponse *frame.RawFrame, targetResponse *frame.RawFrame) {
+	if ch.supportedCqlVersions == nil {
+		return
+	}
+
+	codec := ch.codec.get()
+	originVersions, err := decodeSupportedCqlVersions(codec, originResponse)
+	if err != nil {
+		log.Debugf("Could not decode the CQL versions of the SUPPORTED response of ORIGIN: %v", err)
+		return
+	}
+	targetVersions, err := decodeSupportedCqlVersions(codec, targetResponse)
+	if err != nil {
+		log.Debugf("Could not decode the CQL versions of the SUPPORTED response of TARGET: %v", err)
+		return
+	}
+	ch.supportedCqlVersions.store(originVersions, targetVersions)
+}
+
+func decodeSupportedCqlVersions(codec frame.RawCodec, response *frame.RawFrame) ([]string, error) {
+	decodedFrame, err := codec.ConvertFromRawFrame(response)
+	if err != nil {
+		return nil, err
+	}
+	supported, ok := decodedFrame.Body.Message.(*message.Supported)
+	if !ok {
+		return nil, fmt.Errorf("expected SUPPORTED but got %v", decodedFrame.Body.Message)
+	}
+	return supported.Options[supportedCqlVersionOption], nil
+}
+
+// negotiateStartupCqlVersion returns the client's STARTUP request with a CQL_VERSION that both clusters support if the
+// requested version is not supported by one of them (according to their last SUPPORTED responses) so that the STARTUP
+// requests that are forwarded to both clusters request the same version. The request is returned as is if both
+// clusters support the requested version, if their supported versions are not known yet or if they have no version
+// in common (the mismatch is logged in that case).
+func (ch *ClientHandler) negotiateStartupCqlVersion(request *frame.RawFrame) *frame.RawFrame {
+	if request.Header.OpCode != primitive.OpCodeStartup {
+		return request
+	}
+	originVersions, targetVersions := ch.supportedCqlVersions.get()
+	if len(originVersions) == 0 || len(targetVersions) == 0 {
+		return request
+	}
+
+	decodedFrame, err := ch.codec.get().ConvertFromRawFrame(request)
+	if err != nil {
+		log.Debugf("Could not decode STARTUP request, its CQL_VERSION is not negotiated: %v", err)
+		return request
+	}
+	startup, ok := decodedFrame.Body.Message.(*message.Startup)
+	if !ok {
+		return request
+	}
+	requestedVersion := startup.Options[message.StartupOptionCqlVersion]
+	agreedVersion, mismatch := negotiateCqlVersion(requestedVersion, originVersions, targetVersions)
+	if !mismatch {
+		return request
+	}
+
+	ch.metricHandler.GetProxyMetrics().CqlVersionMismatches.Add(1)
+	if agreedVersion == "" {
+		log.Warnf("The CQL_VERSION %v requested by client %v is not supported by both clusters and they have no "+
+			"CQL version in common (ORIGIN supports %v, TARGET supports %v), forwarding the STARTUP request as is.",
+			requestedVersion, ch.clientConnector.connection.RemoteAddr(), originVersions, targetVersions)
+		return request
+	}
+
+	options := make(map[string]string, len(startup.Options))
+	for option, value := range startup.Options {
+		options[option] = value
+	}
+	options[message.StartupOptionCqlVersion] = agreedVersion
+	negotiatedFrame := decodedFrame.Clone()
+	negotiatedFrame.Body.Message = &message.Startup{Options: options}
+	negotiatedRequest, err := ch.codec.get().ConvertToRawFrame(negotiatedFrame)
+	if err != nil {
+		log.Warnf("Could not encode STARTUP request with CQL_VERSION %v, forwarding the STARTUP request as is: %v",
+			agreedVersion, err)
+		return request
+	}
+	log.Infof("The CQL_VERSION %v requested by client %v is not supported by both clusters (ORIGIN supports %v, "+
+		"TARGET supports %v), forwarding the STARTUP request with CQL_VERSION %v.",
+		requestedVersion, ch.clientConnector.connection.RemoteAddr(), originVersions, targetVersions, agreedVersion)
+	return negotiatedRequest
+}
@@ -0,0 +1,90 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+)
+
+func TestNegotiateCqlVersion(t *testing.T) {
+	tests := []struct {
+		name             string
+		requestedVersion string
+		originVersions   []string
+		targetVersions   []string
+		expectedVersion  string
+		expectedMismatch bool
+	}{
+		{"same versions", "3.4.5", []string{"3.4.5"}, []string{"3.4.5"}, "", false},
+		{"older version supported by both", "3.0.0", []string{"3.4.4"}, []string{"3.4.5"}, "", false},
+		{"origin older", "3.4.5", []string{"3.4.4"}, []string{"3.4.5"}, "3.4.4", true},
+		{"target older", "3.4.5", []string{"3.4.5"}, []string{"3.3.1"}, "3.3.1", true},
+		{"highest common version", "3.4.7", []string{"3.4.4", "3.4.5"}, []string{"3.4.6", "3.4.7"}, "3.4.5", true},
+		{"different major versions", "3.4.5", []string{"4.0.0"}, []string{"3.4.5"}, "", true},
+		{"unparsable version", "latest", []string{"3.4.4"}, []string{"3.4.5"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, mismatch := negotiateCqlVersion(tt.requestedVersion, tt.originVersions, tt.targetVersions)
+			require.Equal(t, tt.expectedVersion, version)
+			require.Equal(t, tt.expectedMismatch, mismatch)
+		})
+	}
+}
+
+func TestNegotiateStartupCqlVersion(t *testing.T) {
+	clientConn, otherConn := net.Pipe()
+	defer clientConn.Close()
+	defer otherConn.Close()
+	proxyMetrics := newFakeProxyMetrics()
+	cqlVersionMismatches := &countingCounter{}
+	proxyMetrics.CqlVersionMismatches = cqlVersionMismatches
+	ch := &ClientHandler{
+		clientConnector:      &ClientConnector{connection: clientConn},
+		supportedCqlVersions: newSupportedCqlVersions(),
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+	startup := mustEncodeFrame(t, &message.Startup{Options: map[string]string{
+		message.StartupOptionCqlVersion: "3.4.5",
+		message.StartupOptionDriverName: "driver",
+	}})
+
+	// the CQL versions of the clusters are not known until an OPTIONS request is forwarded to both clusters
+	require.Same(t, startup, ch.negotiateStartupCqlVersion(startup))
+
+	ch.trackSupportedCqlVersions(
+		mustEncodeFrame(t, &message.Supported{Options: map[string][]string{"CQL_VERSION": {"3.4.4"}}}),
+		mustEncodeFrame(t, &message.Supported{Options: map[string][]string{"CQL_VERSION": {"3.4.5"}}}))
+	negotiatedStartup := ch.negotiateStartupCqlVersion(startup)
+	require.Equal(t, int64(1), cqlVersionMismatches.get())
+	require.Equal(t, startup.Header.StreamId, negotiatedStartup.Header.StreamId)
+	decodedStartup, err := defaultCodec.ConvertFromRawFrame(negotiatedStartup)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{
+		message.StartupOptionCqlVersion: "3.4.4",
+		message.StartupOptionDriverName: "driver",
+	}, decodedStartup.Body.Message.(*message.Startup).Options)
+
+	// the STARTUP request that is forwarded to both clusters requests the agreed version
+	originRequest, targetRequest, err := ch.handleStartupRequest(NewFrameDecodeContext(negotiatedStartup))
+	require.Nil(t, err)
+	require.Same(t, negotiatedStartup, originRequest)
+	require.Same(t, negotiatedStartup, targetRequest)
+
+	// the request is forwarded as is if both clusters support the requested version
+	olderStartup := mustEncodeFrame(t, &message.Startup{Options: map[string]string{message.StartupOptionCqlVersion: "3.0.0"}})
+	require.Same(t, olderStartup, ch.negotiateStartupCqlVersion(olderStartup))
+	require.Equal(t, int64(1), cqlVersionMismatches.get())
+
+	// the mismatch is counted but the request is forwarded as is if the clusters have no version in common
+	ch.trackSupportedCqlVersions(
+		mustEncodeFrame(t, &message.Supported{Options: map[string][]string{"CQL_VERSION": {"4.0.0"}}}),
+		mustEncodeFrame(t, &message.Supported{Options: map[string][]string{"CQL_VERSION": {"3.4.5"}}}))
+	require.Same(t, startup, ch.negotiateStartupCqlVersion(startup))
+	require.Equal(t, int64(2), cqlVersionMismatches.get())
+}
@@ -0,0 +1,159 @@
+package zdmproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"sync"
+	"time"
+)
+
+// CredentialsProvider maps the username that a client authenticated with to the credentials that the proxy
+// should use when it has to replace the client credentials during the handshake with a given cluster.
+//
+// Implementations must be safe for concurrent use, they are called by every new client connection.
+type CredentialsProvider interface {
+	// GetCredentials returns nil (and no error) if there is no mapping for the provided client username
+	// in which case the credentials provided in the configuration are used.
+	GetCredentials(clientUsername string, clusterType common.ClusterType) (*AuthCredentials, error)
+}
+
+type credentialsMapEntry struct {
+	Origin *credentialsFileEntry `json:"origin"`
+	Target *credentialsFileEntry `json:"target"`
+}
+
+type credentialsFileEntry struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// FileCredentialsProvider is a CredentialsProvider backed by a JSON file with the following format:
+//
+//	{
+//	  "client_user": {
+//	    "origin": { "username": "origin_user", "password": "origin_password" },
+//	    "target": { "username": "target_user", "password": "target_password" }
+//	  }
+//	}
+//
+// The file is read when the provider is created and every time Reload is called.
+type FileCredentialsProvider struct {
+	path           string
+	lock           *sync.RWMutex
+	credentialsMap map[string]*credentialsMapEntry
+	lastModTime    time.Time
+}
+
+func NewFileCredentialsProvider(path string) (*FileCredentialsProvider, error) {
+	provider := &FileCredentialsProvider{
+		path: path,
+		lock: &sync.RWMutex{},
+	}
+	err := provider.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+func (recv *FileCredentialsProvider) GetCredentials(
+	clientUsername string, clusterType common.ClusterType) (*AuthCredentials, error) {
+	recv.lock.RLock()
+	entry, ok := recv.credentialsMap[clientUsername]
+	recv.lock.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+
+	var fileEntry *credentialsFileEntry
+	switch clusterType {
+	case common.ClusterTypeOrigin:
+		fileEntry = entry.Origin
+	case common.ClusterTypeTarget:
+		fileEntry = entry.Target
+	default:
+		return nil, fmt.Errorf("unknown cluster type %v", clusterType)
+	}
+
+	if fileEntry == nil {
+		return nil, nil
+	}
+
+	return &AuthCredentials{
+		Username: fileEntry.Username,
+		Password: fileEntry.Password,
+	}, nil
+}
+
+// Reload reads the credentials file again and replaces the current mappings.
+// If the file can not be read or parsed then the current mappings are kept and an error is returned.
+func (recv *FileCredentialsProvider) Reload() error {
+	fileInfo, err := os.Stat(recv.path)
+	if err != nil {
+		return fmt.Errorf("could not read credentials file %v: %w", recv.path, err)
+	}
+
+	data, err := os.ReadFile(recv.path)
+	if err != nil {
+		return fmt.Errorf("could not read credentials file %v: %w", recv.path, err)
+	}
+
+	var credentialsMap map[string]*credentialsMapEntry
+	err = json.Unmarshal(data, &credentialsMap)
+	if err != nil {
+		return fmt.Errorf("could not parse credentials file %v: %w", recv.path, err)
+	}
+
+	for clientUsername, entry := range credentialsMap {
+		if entry == nil {
+			return fmt.Errorf("invalid credentials file %v: mapping for client user %v is empty", recv.path, clientUsername)
+		}
+	}
+
+	recv.lock.Lock()
+	recv.credentialsMap = credentialsMap
+	recv.lastModTime = fileInfo.ModTime()
+	recv.lock.Unlock()
+
+	log.Infof("Loaded %d credential mappings from %v.", len(credentialsMap), recv.path)
+	return nil
+}
+
+func (recv *FileCredentialsProvider) reloadIfModified() error {
+	fileInfo, err := os.Stat(recv.path)
+	if err != nil {
+		return fmt.Errorf("could not read credentials file %v: %w", recv.path, err)
+	}
+
+	recv.lock.RLock()
+	modified := !fileInfo.ModTime().Equal(recv.lastModTime)
+	recv.lock.RUnlock()
+
+	if !modified {
+		return nil
+	}
+	return recv.Reload()
+}
+
+// runReloadLoop periodically checks if the credentials file was modified and reloads it when that's the case.
+func (recv *FileCredentialsProvider) runReloadLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := recv.reloadIfModified()
+				if err != nil {
+					log.Warnf("Could not reload credentials file, keeping the previous credential mappings: %v", err)
+				}
+			}
+		}
+	}()
+}
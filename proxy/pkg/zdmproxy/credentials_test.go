@@ -0,0 +1,88 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileCredentialsProvider_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	writeCredentialsFile(t, path, `{
+  "client1": {
+    "origin": { "username": "origin1", "password": "originpass1" },
+    "target": { "username": "target1", "password": "targetpass1" }
+  },
+  "client2": {
+    "target": { "username": "target2", "password": "targetpass2" }
+  }
+}`)
+
+	provider, err := NewFileCredentialsProvider(path)
+	require.Nil(t, err)
+
+	creds, err := provider.GetCredentials("client1", common.ClusterTypeOrigin)
+	require.Nil(t, err)
+	require.Equal(t, &AuthCredentials{Username: "origin1", Password: "originpass1"}, creds)
+	creds, err = provider.GetCredentials("client1", common.ClusterTypeTarget)
+	require.Nil(t, err)
+	require.Equal(t, &AuthCredentials{Username: "target1", Password: "targetpass1"}, creds)
+	creds, err = provider.GetCredentials("client2", common.ClusterTypeOrigin)
+	require.Nil(t, err)
+	require.Nil(t, creds)
+	creds, err = provider.GetCredentials("unknown", common.ClusterTypeTarget)
+	require.Nil(t, err)
+	require.Nil(t, creds)
+
+	// rotate client1 credentials and remove client2
+	writeCredentialsFile(t, path, `{
+  "client1": {
+    "origin": { "username": "origin1", "password": "rotated" }
+  }
+}`)
+	require.Nil(t, provider.Reload())
+
+	creds, err = provider.GetCredentials("client1", common.ClusterTypeOrigin)
+	require.Nil(t, err)
+	require.Equal(t, &AuthCredentials{Username: "origin1", Password: "rotated"}, creds)
+	creds, err = provider.GetCredentials("client2", common.ClusterTypeTarget)
+	require.Nil(t, err)
+	require.Nil(t, creds)
+
+	// an invalid file doesn't replace the current mappings
+	writeCredentialsFile(t, path, `{ "client1": `)
+	require.NotNil(t, provider.Reload())
+
+	creds, err = provider.GetCredentials("client1", common.ClusterTypeOrigin)
+	require.Nil(t, err)
+	require.Equal(t, &AuthCredentials{Username: "origin1", Password: "rotated"}, creds)
+}
+
+func TestFileCredentialsProvider_ReloadIfModified(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	writeCredentialsFile(t, path, `{ "client1": { "target": { "username": "target1", "password": "old" } } }`)
+
+	provider, err := NewFileCredentialsProvider(path)
+	require.Nil(t, err)
+
+	writeCredentialsFile(t, path, `{ "client1": { "target": { "username": "target1", "password": "new" } } }`)
+	modTime := time.Now().Add(time.Minute)
+	require.Nil(t, os.Chtimes(path, modTime, modTime))
+	require.Nil(t, provider.reloadIfModified())
+
+	creds, err := provider.GetCredentials("client1", common.ClusterTypeTarget)
+	require.Nil(t, err)
+	require.Equal(t, &AuthCredentials{Username: "target1", Password: "new"}, creds)
+}
+
+func TestNewFileCredentialsProvider_MissingFile(t *testing.T) {
+	_, err := NewFileCredentialsProvider(filepath.Join(t.TempDir(), "missing.json"))
+	require.NotNil(t, err)
+}
+
+func writeCredentialsFile(t *testing.T, path string, content string) {
+	require.Nil(t, os.WriteFile(path, []byte(content), 0600))
+}
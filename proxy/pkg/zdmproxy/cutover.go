@@ -0,0 +1,213 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CutoverState contains the routing settings that can be changed at runtime with a cutover.
+// Client connections load the current state once per request so a cutover applies to the next request of every client
+// connection. Reads are only sent to the secondary cluster asynchronously by the client connections that were opened
+// with DUAL_ASYNC_ON_SECONDARY because the async connection is opened along with the client connection.
+type CutoverState struct {
+	PrimaryCluster common.ClusterType
+	ReadMode       common.ReadMode
+}
+
+func (recv *CutoverState) String() string {
+	return fmt.Sprintf("CutoverState{PrimaryCluster: %v, ReadMode: %v}", recv.PrimaryCluster, recv.ReadMode)
+}
+
+// CutoverRequest describes the routing settings to change in a cutover, empty fields are left unchanged.
+// Values are parsed the same way as ZDM_PRIMARY_CLUSTER and ZDM_READ_MODE.
+type CutoverRequest struct {
+	PrimaryCluster string
+	ReadMode       string
+}
+
+// cutoverEventKeyspace is the keyspace of the SCHEMA_CHANGE event that is pushed to the clients when a cutover is
+// applied, drivers refresh its metadata which is harmless because the system keyspace is the same on every cluster.
+const cutoverEventKeyspace = "system"
+
+type cutoverManager struct {
+	lock  *sync.Mutex
+	state *atomic.Value
+
+	// unix time in nanoseconds of the last cutover, 0 if no cutover was applied
+	lastCutover int64
+}
+
+func newCutoverManager(initialState *CutoverState) *cutoverManager {
+	state := &atomic.Value{}
+	state.Store(initialState)
+	return &cutoverManager{
+		lock:  &sync.Mutex{},
+		state: state,
+	}
+}
+
+func (recv *cutoverManager) getState() *CutoverState {
+	return recv.state.Load().(*CutoverState)
+}
+
+// apply parses the request and swaps the state in a single step so readers always see a consistent
+// combination of settings. The request is rejected as a whole if any of its fields is invalid.
+func (recv *cutoverManager) apply(request *CutoverRequest) (previous *CutoverState, current *CutoverState, err error) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	previous = recv.getState()
+	newState := *previous
+
+	if strings.TrimSpace(request.PrimaryCluster) != "" {
+		newState.PrimaryCluster, err = config.ParsePrimaryClusterValue(request.PrimaryCluster)
+		if err != nil {
+			return previous, previous, err
+		}
+	}
+
+	if strings.TrimSpace(request.ReadMode) != "" {
+		newState.ReadMode, err = config.ParseReadModeValue(request.ReadMode)
+		if err != nil {
+			return previous, previous, err
+		}
+	}
+
+	current = &newState
+	recv.state.Store(current)
+	atomic.StoreInt64(&recv.lastCutover, nowFunc().UnixNano())
+	return previous, current, nil
+}
+
+func (recv *cutoverManager) getLastCutoverTimestamp() float64 {
+	return float64(atomic.LoadInt64(&recv.lastCutover)) / float64(time.Second)
+}
+
+// GetCutoverState returns the routing settings that are applied to the requests of every client connection.
+func (p *ZdmProxy) GetCutoverState() *CutoverState {
+	return p.shared.cutoverManager.getState()
+}
+
+// Cutover atomically changes the primary cluster and / or the read mode. The new settings apply to every request that
+// is forwarded after this method returns, requests that are in flight complete with the previous settings.
+func (p *ZdmProxy) Cutover(request *CutoverRequest) (previous *CutoverState, current *CutoverState, err error) {
+	previous, current, err = p.shared.cutoverManager.apply(request)
+	if err != nil {
+		log.Warnf("Rejected cutover request %v: %v", request, err)
+		return previous, current, err
+	}
+
+	log.Infof("Cutover applied: primary cluster %v -> %v, read mode %v -> %v. "+
+		"The new settings apply to requests forwarded from now on.",
+		previous.PrimaryCluster, current.PrimaryCluster, previous.ReadMode, current.ReadMode)
+
+	p.lock.RLock()
+	metricHandler := p.metricHandler
+	p.lock.RUnlock()
+	if metricHandler != nil {
+		metricHandler.GetProxyMetrics().Cutovers.Add(1)
+	}
+
+	if p.Conf.CutoverClientEventEnabled {
+		pushed := 0
+		for _, ch := range p.clientHandlers.getHandlers() {
+			if ch.pushCutoverEvent() {
+				pushed++
+			}
+		}
+		log.Infof("Pushed cutover event to %d client connections.", pushed)
+		if metricHandler != nil {
+			metricHandler.GetProxyMetrics().CutoverClientEvents.Add(pushed)
+		}
+	}
+	return previous, current, nil
+}
+
+// getCutoverState returns the routing settings of the proxy instance, see ZdmProxy.Cutover. Client handlers that
+// were not created by a proxy instance use the settings that they were created with.
+func (ch *ClientHandler) getCutoverState() *CutoverState {
+	if ch.cutoverManager == nil {
+		return &CutoverState{PrimaryCluster: ch.primaryCluster, ReadMode: ch.readMode}
+	}
+	return ch.cutoverManager.getState()
+}
+
+// getRequestCutoverState returns the routing settings that the request is forwarded with. They are loaded once per
+// request so that every step of a request uses the same settings even if a cutover is applied in the meantime.
+func (ch *ClientHandler) getRequestCutoverState(frameContext *frameDecodeContext) *CutoverState {
+	cutoverState := frameContext.GetCutoverState()
+	if cutoverState == nil {
+		cutoverState = ch.getCutoverState()
+		frameContext.SetCutoverState(cutoverState)
+	}
+	return cutoverState
+}
+
+// isAsyncReadEnabled returns true if the reads are also sent to the secondary cluster with the async connector,
+// see ZDM_READ_MODE.
+func (ch *ClientHandler) isAsyncReadEnabled(cutoverState *CutoverState) bool {
+	return ch.asyncConnector != nil && cutoverState.ReadMode == common.ReadModeDualAsyncOnSecondary &&
+		ch.asyncConnector.clusterType != cutoverState.PrimaryCluster
+}
+
+// trackEventRegistration keeps the protocol version of the client's REGISTER request if the client registered for
+// SCHEMA_CHANGE events, the cutover event is only pushed to these clients.
+func (ch *ClientHandler) trackEventRegistration(context *frameDecodeContext) {
+	if context.GetRawFrame().Header.OpCode != primitive.OpCodeRegister {
+		return
+	}
+
+	decodedFrame, err := context.GetOrDecodeFrame()
+	if err != nil {
+		log.Debugf("Could not decode REGISTER request with stream id %v: %v", context.GetRawFrame().Header.StreamId, err)
+		return
+	}
+	register, ok := decodedFrame.Body.Message.(*message.Register)
+	if !ok {
+		return
+	}
+	for _, eventType := range register.EventTypes {
+		if eventType == primitive.EventTypeSchemaChange {
+			atomic.StoreInt32(&ch.schemaEventsVersion, int32(decodedFrame.Header.Version))
+			return
+		}
+	}
+}
+
+// pushCutoverEvent queues a SCHEMA_CHANGE event for the client (see ZDM_CUTOVER_CLIENT_EVENT_ENABLED) and returns false
+// if the client did not register for SCHEMA_CHANGE events. The event is forwarded by the event listener of the client
+// handler so that it is never written to a client connection that is shutting down.
+func (ch *ClientHandler) pushCutoverEvent() bool {
+	version := primitive.ProtocolVersion(atomic.LoadInt32(&ch.schemaEventsVersion))
+	if version == 0 {
+		return false
+	}
+
+	event := frame.NewFrame(version, -1, &message.SchemaChangeEvent{
+		ChangeType: primitive.SchemaChangeTypeUpdated,
+		Target:     primitive.SchemaChangeTargetKeyspace,
+		Keyspace:   cutoverEventKeyspace,
+	})
+	rawEvent, err := ch.codec.get().ConvertToRawFrame(event)
+	if err != nil {
+		log.Errorf("Could not convert cutover event to raw frame: %v", err)
+		return false
+	}
+
+	select {
+	case ch.cutoverEventsChan <- rawEvent:
+		return true
+	default:
+		// the previous cutover event was not forwarded yet
+		return false
+	}
+}
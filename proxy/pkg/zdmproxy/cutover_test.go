@@ -0,0 +1,211 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCutover(t *testing.T) {
+	proxyMetrics := newFakeProxyMetrics()
+	cutovers := &countingCounter{}
+	proxyMetrics.Cutovers = cutovers
+	proxy := &ZdmProxy{
+		Conf: config.New(),
+		lock: &sync.RWMutex{},
+		shared: &clientHandlerShared{cutoverManager: newCutoverManager(&CutoverState{
+			PrimaryCluster: common.ClusterTypeOrigin,
+			ReadMode:       common.ReadModePrimaryOnly,
+		})},
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	previous, current, err := proxy.Cutover(&CutoverRequest{PrimaryCluster: "target", ReadMode: "DUAL_ASYNC_ON_SECONDARY"})
+	require.Nil(t, err)
+	require.Equal(t, &CutoverState{PrimaryCluster: common.ClusterTypeOrigin, ReadMode: common.ReadModePrimaryOnly}, previous)
+	require.Equal(t, &CutoverState{PrimaryCluster: common.ClusterTypeTarget, ReadMode: common.ReadModeDualAsyncOnSecondary}, current)
+	require.Equal(t, current, proxy.GetCutoverState())
+	require.Equal(t, int64(1), cutovers.get())
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	require.Equal(t, log.InfoLevel, entry.Level)
+	require.True(t, strings.Contains(entry.Message, "primary cluster ORIGIN -> TARGET"), entry.Message)
+	require.True(t, strings.Contains(entry.Message, "read mode PRIMARY_ONLY -> DUAL_ASYNC_ON_SECONDARY"), entry.Message)
+
+	// only the read mode is changed
+	previous, current, err = proxy.Cutover(&CutoverRequest{ReadMode: "PRIMARY_ONLY"})
+	require.Nil(t, err)
+	require.Equal(t, &CutoverState{PrimaryCluster: common.ClusterTypeTarget, ReadMode: common.ReadModeDualAsyncOnSecondary}, previous)
+	require.Equal(t, &CutoverState{PrimaryCluster: common.ClusterTypeTarget, ReadMode: common.ReadModePrimaryOnly}, current)
+	require.Equal(t, int64(2), cutovers.get())
+
+	// a request with an invalid field is rejected as a whole
+	_, current, err = proxy.Cutover(&CutoverRequest{PrimaryCluster: "ORIGIN", ReadMode: "INVALID"})
+	require.NotNil(t, err)
+	require.Equal(t, &CutoverState{PrimaryCluster: common.ClusterTypeTarget, ReadMode: common.ReadModePrimaryOnly}, current)
+	require.Equal(t, current, proxy.GetCutoverState())
+	require.Equal(t, int64(2), cutovers.get())
+	require.Equal(t, log.WarnLevel, hook.LastEntry().Level)
+}
+
+func TestCutover_ClientEvent(t *testing.T) {
+	clock := newFakeClock(t)
+	proxyMetrics := newFakeProxyMetrics()
+	cutoverClientEvents := &countingCounter{}
+	proxyMetrics.CutoverClientEvents = cutoverClientEvents
+	conf := config.New()
+	conf.CutoverClientEventEnabled = true
+	proxy := &ZdmProxy{
+		Conf: conf,
+		lock: &sync.RWMutex{},
+		shared: &clientHandlerShared{cutoverManager: newCutoverManager(&CutoverState{
+			PrimaryCluster: common.ClusterTypeOrigin,
+			ReadMode:       common.ReadModePrimaryOnly,
+		})},
+		clientHandlers: newClientHandlerRegistry(),
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+	require.Equal(t, 0.0, proxy.shared.cutoverManager.getLastCutoverTimestamp())
+
+	newHandler := func(eventTypes ...primitive.EventType) *ClientHandler {
+		ch := &ClientHandler{cutoverEventsChan: make(chan *frame.RawFrame, 1)}
+		ch.trackEventRegistration(NewFrameDecodeContext(mustEncodeFrame(t, &message.Register{EventTypes: eventTypes})))
+		proxy.clientHandlers.register(ch)
+		return ch
+	}
+	schemaEventsHandler := newHandler(primitive.EventTypeTopologyChange, primitive.EventTypeSchemaChange)
+	topologyEventsHandler := newHandler(primitive.EventTypeTopologyChange)
+
+	_, _, err := proxy.Cutover(&CutoverRequest{PrimaryCluster: "TARGET"})
+	require.Nil(t, err)
+	require.Equal(t, int64(1), cutoverClientEvents.get())
+	require.Equal(t, 1000.0, proxy.shared.cutoverManager.getLastCutoverTimestamp())
+	require.Len(t, topologyEventsHandler.cutoverEventsChan, 0)
+	require.Len(t, schemaEventsHandler.cutoverEventsChan, 1)
+
+	event, err := defaultCodec.ConvertFromRawFrame(<-schemaEventsHandler.cutoverEventsChan)
+	require.Nil(t, err)
+	require.Equal(t, int16(-1), event.Header.StreamId)
+	require.Equal(t, &message.SchemaChangeEvent{
+		ChangeType: primitive.SchemaChangeTypeUpdated,
+		Target:     primitive.SchemaChangeTargetKeyspace,
+		Keyspace:   cutoverEventKeyspace,
+	}, event.Body.Message)
+
+	// an event that was not forwarded yet is not queued again
+	clock.advance(time.Minute)
+	_, _, err = proxy.Cutover(&CutoverRequest{ReadMode: "DUAL_ASYNC_ON_SECONDARY"})
+	require.Nil(t, err)
+	_, _, err = proxy.Cutover(&CutoverRequest{ReadMode: "PRIMARY_ONLY"})
+	require.Nil(t, err)
+	require.Equal(t, int64(2), cutoverClientEvents.get())
+	require.Equal(t, 1060.0, proxy.shared.cutoverManager.getLastCutoverTimestamp())
+	require.Len(t, schemaEventsHandler.cutoverEventsChan, 1)
+
+	// rejected cutovers don't push events
+	<-schemaEventsHandler.cutoverEventsChan
+	_, _, err = proxy.Cutover(&CutoverRequest{ReadMode: "INVALID"})
+	require.NotNil(t, err)
+	require.Equal(t, int64(2), cutoverClientEvents.get())
+	require.Len(t, schemaEventsHandler.cutoverEventsChan, 0)
+}
+
+func TestCutover_ConcurrentReadersSeeConsistentState(t *testing.T) {
+	stateA := &CutoverState{PrimaryCluster: common.ClusterTypeOrigin, ReadMode: common.ReadModePrimaryOnly}
+	stateB := &CutoverState{PrimaryCluster: common.ClusterTypeTarget, ReadMode: common.ReadModeDualAsyncOnSecondary}
+	manager := newCutoverManager(stateA)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			request := &CutoverRequest{PrimaryCluster: string(stateB.PrimaryCluster), ReadMode: stateB.ReadMode.String()}
+			if i%2 == 1 {
+				request = &CutoverRequest{PrimaryCluster: string(stateA.PrimaryCluster), ReadMode: stateA.ReadMode.String()}
+			}
+			_, _, err := manager.apply(request)
+			require.Nil(t, err)
+		}
+	}()
+
+	errs := make(chan *CutoverState, 4)
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				state := *manager.getState()
+				if state != *stateA && state != *stateB {
+					errs <- &state
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for state := range errs {
+		require.Fail(t, "observed inconsistent cutover state", "%v", state)
+	}
+}
+
+func TestCutover_AppliesToNextRequestOfExistingClientHandlers(t *testing.T) {
+	proxy := &ZdmProxy{
+		Conf: config.New(),
+		lock: &sync.RWMutex{},
+		shared: &clientHandlerShared{cutoverManager: newCutoverManager(&CutoverState{
+			PrimaryCluster: common.ClusterTypeOrigin,
+			ReadMode:       common.ReadModeDualAsyncOnSecondary,
+		})},
+	}
+	// the client handler was opened before the cutover so its async connector is tied to TARGET
+	ch := &ClientHandler{
+		primaryCluster: common.ClusterTypeOrigin,
+		readMode:       common.ReadModeDualAsyncOnSecondary,
+		cutoverManager: proxy.shared.cutoverManager,
+		asyncConnector: &ClusterConnector{clusterType: common.ClusterTypeTarget},
+		tracingMode:    common.TracingModePrimary,
+	}
+	request := mustEncodeFrame(t, &message.Query{Query: "SELECT * FROM ks.tb"})
+	request.Header.Flags = request.Header.Flags.Add(primitive.HeaderFlagTracing)
+
+	inFlightRequest := NewFrameDecodeContext(request)
+	cutoverState := ch.getRequestCutoverState(inFlightRequest)
+	require.Equal(t, common.ClusterTypeOrigin, cutoverState.PrimaryCluster)
+	require.True(t, ch.isAsyncReadEnabled(cutoverState))
+
+	_, _, err := proxy.Cutover(&CutoverRequest{PrimaryCluster: "TARGET"})
+	require.Nil(t, err)
+
+	// the request that is already being forwarded keeps the settings that it was forwarded with
+	require.Same(t, cutoverState, ch.getRequestCutoverState(inFlightRequest))
+
+	// the next request of the same client handler uses the new settings
+	cutoverState = ch.getRequestCutoverState(NewFrameDecodeContext(request))
+	require.Equal(t, common.ClusterTypeTarget, cutoverState.PrimaryCluster)
+	originRequest, targetRequest := ch.removeTracing(cutoverState.PrimaryCluster, request, request)
+	require.False(t, originRequest.Header.Flags.Contains(primitive.HeaderFlagTracing))
+	require.True(t, targetRequest.Header.Flags.Contains(primitive.HeaderFlagTracing))
+
+	// reads are no longer sent asynchronously because the async connector is tied to the new primary cluster
+	require.False(t, ch.isAsyncReadEnabled(cutoverState))
+}
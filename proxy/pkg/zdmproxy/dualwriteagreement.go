@@ -0,0 +1,42 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+)
+
+// DualWriteAgreement is the ratio of dual writes on which both clusters agreed (i.e. the write either succeeded or
+// failed on both clusters) over the last ZDM_METRICS_DUAL_WRITE_AGREEMENT_WINDOW_MS. It can be used by automation
+// to decide whether TARGET can be trusted before a cutover.
+type DualWriteAgreement struct {
+	WindowMs int
+	Writes   int64
+	// Rate is 0 if no dual write was tracked in the window
+	Rate float64
+}
+
+func newDualWriteAgreement(disagreements *metrics.ErrorRateWindow, windowMs int) *DualWriteAgreement {
+	report := &DualWriteAgreement{WindowMs: windowMs}
+	if disagreements == nil {
+		return report
+	}
+	failed, total := disagreements.Counts()
+	report.Writes = total
+	if total > 0 {
+		report.Rate = float64(total-failed) / float64(total)
+	}
+	return report
+}
+
+func (p *ZdmProxy) GetDualWriteAgreement() *DualWriteAgreement {
+	return newDualWriteAgreement(p.shared.dualWriteDisagreements, p.Conf.MetricsDualWriteAgreementWindowMs)
+}
+
+// trackDualWriteAgreement records whether both clusters returned the same outcome for a dual write. Writes that
+// failed on both clusters agree even if the error codes are different (see trackMismatchedWriteErrors).
+func (ch *ClientHandler) trackDualWriteAgreement(originResponse *frame.RawFrame, targetResponse *frame.RawFrame) {
+	if ch.dualWriteDisagreements == nil {
+		return
+	}
+	ch.dualWriteDisagreements.Track(isResponseSuccessful(originResponse) != isResponseSuccessful(targetResponse))
+}
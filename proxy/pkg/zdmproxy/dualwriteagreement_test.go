@@ -0,0 +1,36 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDualWriteAgreement(t *testing.T) {
+	disagreements := metrics.NewErrorRateWindow(time.Minute)
+	ch := &ClientHandler{dualWriteDisagreements: disagreements}
+	require.Equal(t, &DualWriteAgreement{WindowMs: 60000}, newDualWriteAgreement(disagreements, 60000))
+
+	void := mustEncodeFrame(t, &message.VoidResult{})
+	writeTimeout := mustEncodeFrame(t, &message.WriteTimeout{ErrorMessage: "timeout"})
+	invalid := mustEncodeFrame(t, &message.Invalid{ErrorMessage: "invalid"})
+
+	// both successes and both failures (even with different errors) agree
+	ch.trackDualWriteAgreement(void, void)
+	ch.trackDualWriteAgreement(void, void)
+	ch.trackDualWriteAgreement(void, void)
+	ch.trackDualWriteAgreement(invalid, writeTimeout)
+	ch.trackDualWriteAgreement(void, writeTimeout)
+	require.Equal(t, &DualWriteAgreement{WindowMs: 60000, Writes: 5, Rate: 0.8}, newDualWriteAgreement(disagreements, 60000))
+
+	ch.trackDualWriteAgreement(invalid, void)
+	ch.trackDualWriteAgreement(void, void)
+	ch.trackDualWriteAgreement(void, void)
+	require.Equal(t, &DualWriteAgreement{WindowMs: 60000, Writes: 8, Rate: 0.75}, newDualWriteAgreement(disagreements, 60000))
+
+	// nothing is tracked if the window is missing
+	require.Equal(t, &DualWriteAgreement{WindowMs: 60000}, newDualWriteAgreement(nil, 60000))
+	(&ClientHandler{}).trackDualWriteAgreement(void, invalid)
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
 	"io"
+	"sync/atomic"
 )
 
 type shutdownError struct {
@@ -15,8 +17,80 @@ func (e *shutdownError) Error() string {
 	return e.err
 }
 
+// defaultCodec is only used to read raw frames (the header is decoded before the protocol version is known) and by
+// the connections whose protocol version is not known yet, see connectionCodec.
 var defaultCodec = frame.NewRawCodec()
 
+// codecRegistry holds the codec that is used for each protocol version.
+// Codecs are registered when the registry is created, it is read only afterwards.
+type codecRegistry struct {
+	codecs   map[primitive.ProtocolVersion]frame.RawCodec
+	fallback frame.RawCodec
+}
+
+func newCodecRegistry(fallback frame.RawCodec) *codecRegistry {
+	return &codecRegistry{
+		codecs:   map[primitive.ProtocolVersion]frame.RawCodec{},
+		fallback: fallback,
+	}
+}
+
+func newDefaultCodecRegistry() *codecRegistry {
+	registry := newCodecRegistry(defaultCodec)
+	for _, version := range primitive.SupportedProtocolVersions() {
+		registry.register(version, frame.NewRawCodec())
+	}
+	return registry
+}
+
+func (recv *codecRegistry) register(version primitive.ProtocolVersion, codec frame.RawCodec) {
+	recv.codecs[version] = codec
+}
+
+// getCodec returns the codec registered for the provided version or the fallback codec if there is none.
+func (recv *codecRegistry) getCodec(version primitive.ProtocolVersion) frame.RawCodec {
+	codec, ok := recv.codecs[version]
+	if !ok {
+		return recv.fallback
+	}
+	return codec
+}
+
+var defaultCodecRegistry = newDefaultCodecRegistry()
+
+// getCodec returns the codec for the provided protocol version. Code that is tied to a connection should use the
+// connectionCodec of that connection instead.
+func getCodec(version primitive.ProtocolVersion) frame.RawCodec {
+	return defaultCodecRegistry.getCodec(version)
+}
+
+// connectionCodec holds the codec of the protocol version of a connection, it is shared by the client handler and the
+// connectors of a client connection. The default codec is used until the protocol version is set.
+type connectionCodec struct {
+	codec atomic.Value
+}
+
+func newConnectionCodec() *connectionCodec {
+	return &connectionCodec{}
+}
+
+// setVersion selects the codec of the protocol version that was negotiated for the connection.
+func (recv *connectionCodec) setVersion(version primitive.ProtocolVersion) {
+	recv.codec.Store(getCodec(version))
+}
+
+// get returns the codec of the connection, nil connection codecs (e.g. in tests) return the default codec.
+func (recv *connectionCodec) get() frame.RawCodec {
+	if recv == nil {
+		return defaultCodec
+	}
+	codec := recv.codec.Load()
+	if codec == nil {
+		return defaultCodec
+	}
+	return codec.(frame.RawCodec)
+}
+
 var ShutdownErr = &shutdownError{err: "aborted due to shutdown request"}
 
 func adaptConnErr(connectionAddr string, clientHandlerContext context.Context, err error) error {
@@ -32,8 +106,9 @@ func adaptConnErr(connectionAddr string, clientHandlerContext context.Context, e
 }
 
 // Simple function that writes a rawframe with a single call to writeToConnection
-func writeRawFrame(writer io.Writer, connectionAddr string, clientHandlerContext context.Context, frame *frame.RawFrame) error {
-	err := defaultCodec.EncodeRawFrame(frame, writer)
+func writeRawFrame(
+	writer io.Writer, codec frame.RawCodec, connectionAddr string, clientHandlerContext context.Context, frame *frame.RawFrame) error {
+	err := codec.EncodeRawFrame(frame, writer)
 	return adaptConnErr(connectionAddr, clientHandlerContext, err)
 }
 
@@ -46,3 +121,12 @@ func readRawFrame(reader io.Reader, connectionAddr string, clientHandlerContext
 
 	return rawFrame, nil
 }
+
+// decodeFrame reads a raw frame and decodes its body with the provided codec.
+func decodeFrame(reader io.Reader, codec frame.RawCodec) (*frame.Frame, error) {
+	rawFrame, err := defaultCodec.DecodeRawFrame(reader)
+	if err != nil {
+		return nil, err
+	}
+	return codec.ConvertFromRawFrame(rawFrame)
+}
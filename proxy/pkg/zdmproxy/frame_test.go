@@ -0,0 +1,67 @@
+package zdmproxy
+
+import (
+	"bytes"
+	"context"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGetCodec_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		version primitive.ProtocolVersion
+	}{
+		{"v3", primitive.ProtocolVersion3},
+		{"v4", primitive.ProtocolVersion4},
+		{"v5", primitive.ProtocolVersion5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := &message.Query{
+				Query:   "SELECT * FROM ks.t WHERE a = ?",
+				Options: &message.QueryOptions{PositionalValues: []*primitive.Value{primitive.NewValue([]byte{0, 0, 0, 1})}},
+			}
+			codec := getCodec(tt.version)
+			rawFrame, err := codec.ConvertToRawFrame(frame.NewFrame(tt.version, 1, query))
+			require.Nil(t, err)
+			require.Equal(t, tt.version, rawFrame.Header.Version)
+
+			buf := &bytes.Buffer{}
+			require.Nil(t, writeRawFrame(buf, codec, "test", context.Background(), rawFrame))
+			decoded, err := decodeFrame(buf, codec)
+			require.Nil(t, err)
+			require.Equal(t, tt.version, decoded.Header.Version)
+			require.Equal(t, query, decoded.Body.Message)
+		})
+	}
+}
+
+func TestCodecRegistry(t *testing.T) {
+	fallback := frame.NewRawCodec()
+	v4Codec := frame.NewRawCodec()
+	registry := newCodecRegistry(fallback)
+	registry.register(primitive.ProtocolVersion4, v4Codec)
+
+	require.True(t, registry.getCodec(primitive.ProtocolVersion4) == v4Codec)
+	require.True(t, registry.getCodec(primitive.ProtocolVersion3) == fallback)
+
+	overrideCodec := frame.NewRawCodec()
+	registry.register(primitive.ProtocolVersion4, overrideCodec)
+	require.True(t, registry.getCodec(primitive.ProtocolVersion4) == overrideCodec)
+}
+
+func TestConnectionCodec(t *testing.T) {
+	var nilCodec *connectionCodec
+	require.True(t, nilCodec.get() == defaultCodec)
+
+	codec := newConnectionCodec()
+	require.True(t, codec.get() == defaultCodec)
+
+	codec.setVersion(primitive.ProtocolVersion5)
+	require.True(t, codec.get() == getCodec(primitive.ProtocolVersion5))
+}
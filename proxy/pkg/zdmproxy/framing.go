@@ -0,0 +1,269 @@
+package zdmproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/go-cassandra-native-protocol/segment"
+	"io"
+	"net"
+	"sync/atomic"
+)
+
+// segments are never compressed, the proxy doesn't support compression
+var defaultSegmentCodec = segment.NewCodec()
+
+// segmentError is returned when a v5 segment is invalid (e.g. a checksum doesn't match), the rest of the data
+// on the connection can't be trusted after this error.
+type segmentError struct {
+	err error
+}
+
+func (e *segmentError) Error() string {
+	return fmt.Sprintf("invalid segment: %v", e.err)
+}
+
+func (e *segmentError) Unwrap() error {
+	return e.err
+}
+
+// adaptSegmentErr returns a segmentError if the segment could not be decoded because its contents are invalid,
+// connection errors are returned unchanged.
+func adaptSegmentErr(err error) error {
+	var netErr net.Error
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+		return err
+	}
+	return &segmentError{err: err}
+}
+
+// connectionFraming tracks the framing format of a connection. Every connection starts with the legacy framing format
+// and switches to the v5 framing format (frames wrapped in checksummed segments) right after the server sends
+// a READY or AUTHENTICATE response with a protocol version that supports it.
+// A nil connectionFraming always uses the legacy framing format.
+type connectionFraming struct {
+	modern int32
+
+	// true if the proxy is the server on this connection (client connections) so the switch happens when the READY
+	// or AUTHENTICATE response is written, false if it happens when the response is read (cluster connections)
+	isServer bool
+}
+
+func newConnectionFraming(isServer bool) *connectionFraming {
+	return &connectionFraming{isServer: isServer}
+}
+
+func (recv *connectionFraming) isModern() bool {
+	if recv == nil {
+		return false
+	}
+	return atomic.LoadInt32(&recv.modern) == 1
+}
+
+func (recv *connectionFraming) frameWritten(f *frame.RawFrame) {
+	if recv != nil && recv.isServer && isModernFramingSwitch(f) {
+		atomic.StoreInt32(&recv.modern, 1)
+	}
+}
+
+func (recv *connectionFraming) frameRead(f *frame.RawFrame) {
+	if recv != nil && !recv.isServer && isModernFramingSwitch(f) {
+		atomic.StoreInt32(&recv.modern, 1)
+	}
+}
+
+// isModernFramingSwitch returns true if the connection switches to the v5 framing format after this frame.
+func isModernFramingSwitch(f *frame.RawFrame) bool {
+	if !f.Header.IsResponse || !f.Header.Version.SupportsModernFramingLayout() {
+		return false
+	}
+	return f.Header.OpCode == primitive.OpCodeReady || f.Header.OpCode == primitive.OpCodeAuthenticate
+}
+
+// frameReader reads raw frames from a connection with the current framing format of that connection.
+type frameReader struct {
+	reader         *bufio.Reader
+	connectionAddr string
+	ctx            context.Context
+	framing        *connectionFraming
+
+	// frames of the last self-contained segment that were not returned yet
+	pendingFrames []*frame.RawFrame
+
+	// payloads of the segments received so far for a frame that spans multiple segments
+	multiSegmentPayload []byte
+}
+
+func newFrameReader(
+	reader *bufio.Reader, connectionAddr string, ctx context.Context, framing *connectionFraming) *frameReader {
+	return &frameReader{
+		reader:         reader,
+		connectionAddr: connectionAddr,
+		ctx:            ctx,
+		framing:        framing,
+	}
+}
+
+func (recv *frameReader) read() (*frame.RawFrame, error) {
+	if len(recv.pendingFrames) > 0 {
+		f := recv.pendingFrames[0]
+		recv.pendingFrames = recv.pendingFrames[1:]
+		return f, nil
+	}
+
+	if !recv.framing.isModern() {
+		// wait until the next frame starts arriving because the framing format can change in the meantime
+		// (the client only sends the next request after receiving the READY or AUTHENTICATE response)
+		if _, err := recv.reader.Peek(1); err != nil {
+			return nil, adaptConnErr(recv.connectionAddr, recv.ctx, err)
+		}
+	}
+
+	if !recv.framing.isModern() {
+		f, err := readRawFrame(recv.reader, recv.connectionAddr, recv.ctx)
+		if err != nil {
+			return nil, err
+		}
+		recv.framing.frameRead(f)
+		return f, nil
+	}
+
+	for {
+		seg, err := defaultSegmentCodec.DecodeSegment(recv.reader)
+		if err != nil {
+			return nil, adaptConnErr(recv.connectionAddr, recv.ctx, adaptSegmentErr(err))
+		}
+
+		if seg.Header.IsSelfContained {
+			if len(recv.multiSegmentPayload) > 0 {
+				return nil, &segmentError{err: errors.New("self-contained segment received before the end of a multi-segment frame")}
+			}
+			frames, err := decodeSegmentFrames(seg.Payload.UncompressedData)
+			if err != nil {
+				return nil, err
+			}
+			if len(frames) == 0 {
+				continue
+			}
+			recv.pendingFrames = frames[1:]
+			return frames[0], nil
+		}
+
+		recv.multiSegmentPayload = append(recv.multiSegmentPayload, seg.Payload.UncompressedData...)
+		headerLength := int(primitive.FrameHeaderLengthV3AndHigher)
+		if len(recv.multiSegmentPayload) < headerLength {
+			continue
+		}
+		frameLength := headerLength + int(binary.BigEndian.Uint32(recv.multiSegmentPayload[headerLength-4:headerLength]))
+		if len(recv.multiSegmentPayload) < frameLength {
+			continue
+		}
+		if len(recv.multiSegmentPayload) > frameLength {
+			return nil, &segmentError{err: fmt.Errorf(
+				"multi-segment frame has %v bytes but its header declares %v", len(recv.multiSegmentPayload), frameLength)}
+		}
+
+		payload := recv.multiSegmentPayload
+		recv.multiSegmentPayload = nil
+		frames, err := decodeSegmentFrames(payload)
+		if err != nil {
+			return nil, err
+		}
+		return frames[0], nil
+	}
+}
+
+// decodeSegmentFrames decodes the frames of a self-contained segment (or of a reassembled multi-segment frame).
+func decodeSegmentFrames(payload []byte) ([]*frame.RawFrame, error) {
+	payloadReader := bytes.NewReader(payload)
+	frames := make([]*frame.RawFrame, 0, 1)
+	for payloadReader.Len() > 0 {
+		f, err := defaultCodec.DecodeRawFrame(payloadReader)
+		if err != nil {
+			var protocolVersionErr *frame.ProtocolVersionErr
+			if errors.As(err, &protocolVersionErr) {
+				return nil, err
+			}
+			return nil, &segmentError{err: fmt.Errorf("could not decode frame: %w", err)}
+		}
+		frames = append(frames, f)
+	}
+	return frames, nil
+}
+
+// segmentEncoder writes frames to v5 segments. Frames are grouped in self-contained segments until a segment is full
+// and frames that don't fit in a single segment are split across multiple segments.
+type segmentEncoder struct {
+	payload      *bytes.Buffer
+	encodedFrame *bytes.Buffer
+	codec        *connectionCodec
+}
+
+func newSegmentEncoder(codec *connectionCodec) *segmentEncoder {
+	return &segmentEncoder{
+		payload:      &bytes.Buffer{},
+		encodedFrame: &bytes.Buffer{},
+		codec:        codec,
+	}
+}
+
+// pendingBytes returns the number of bytes of the frames that are waiting for the current segment to be flushed.
+func (recv *segmentEncoder) pendingBytes() int {
+	return recv.payload.Len()
+}
+
+func (recv *segmentEncoder) writeFrame(f *frame.RawFrame, dest io.Writer) error {
+	recv.encodedFrame.Reset()
+	err := recv.codec.get().EncodeRawFrame(f, recv.encodedFrame)
+	if err != nil {
+		return err
+	}
+
+	if recv.payload.Len()+recv.encodedFrame.Len() > segment.MaxPayloadLength {
+		err = recv.flush(dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	if recv.encodedFrame.Len() <= segment.MaxPayloadLength {
+		recv.payload.Write(recv.encodedFrame.Bytes())
+		return nil
+	}
+
+	data := recv.encodedFrame.Bytes()
+	for len(data) > 0 {
+		length := len(data)
+		if length > segment.MaxPayloadLength {
+			length = segment.MaxPayloadLength
+		}
+		err = writeSegment(data[:length], false, dest)
+		if err != nil {
+			return err
+		}
+		data = data[length:]
+	}
+	return nil
+}
+
+// flush writes the self-contained segment with the frames that were written since the last flush.
+func (recv *segmentEncoder) flush(dest io.Writer) error {
+	if recv.payload.Len() == 0 {
+		return nil
+	}
+	err := writeSegment(recv.payload.Bytes(), true, dest)
+	recv.payload.Reset()
+	return err
+}
+
+func writeSegment(payload []byte, isSelfContained bool, dest io.Writer) error {
+	return defaultSegmentCodec.EncodeSegment(&segment.Segment{
+		Header:  &segment.Header{IsSelfContained: isSelfContained},
+		Payload: &segment.Payload{UncompressedData: payload},
+	}, dest)
+}
@@ -0,0 +1,115 @@
+package zdmproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/go-cassandra-native-protocol/segment"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func mustEncodeV5Frame(t *testing.T, streamId int16, msg message.Message) *frame.RawFrame {
+	f, err := defaultCodec.ConvertToRawFrame(frame.NewFrame(primitive.ProtocolVersion5, streamId, msg))
+	require.Nil(t, err)
+	return f
+}
+
+func TestFrameReader_RoundTripV5Framing(t *testing.T) {
+	ready := mustEncodeV5Frame(t, 0, &message.Ready{})
+	first := mustEncodeV5Frame(t, 1, &message.Query{Query: "SELECT * FROM ks.t"})
+	second := mustEncodeV5Frame(t, 2, &message.Query{Query: "SELECT * FROM ks.t2"})
+	// doesn't fit in a single segment
+	large := mustEncodeV5Frame(t, 3, &message.Query{Query: "SELECT * FROM ks.t WHERE a = '" + strings.Repeat("a", 300_000) + "'"})
+	last := mustEncodeV5Frame(t, 4, &message.Query{Query: "SELECT * FROM ks.t3"})
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, writeRawFrame(buf, defaultCodec, "cluster", context.Background(), ready))
+	encoder := newSegmentEncoder(nil)
+	for _, f := range []*frame.RawFrame{first, second, large, last} {
+		require.Nil(t, encoder.writeFrame(f, buf))
+	}
+	require.Nil(t, encoder.flush(buf))
+
+	// the first two frames share a self-contained segment, the large frame spans 3 segments
+	legacyFrameLength := int(primitive.FrameHeaderLengthV3AndHigher) + len(ready.Body)
+	segments := bytes.NewReader(append([]byte{}, buf.Bytes()[legacyFrameLength:]...))
+	var selfContained []bool
+	for segments.Len() > 0 {
+		seg, err := defaultSegmentCodec.DecodeSegment(segments)
+		require.Nil(t, err)
+		selfContained = append(selfContained, seg.Header.IsSelfContained)
+	}
+	require.Equal(t, []bool{true, false, false, false, true}, selfContained)
+
+	framing := newConnectionFraming(false)
+	reader := newFrameReader(bufio.NewReader(buf), "cluster", context.Background(), framing)
+	for _, expected := range []*frame.RawFrame{ready, first, second, large, last} {
+		f, err := reader.read()
+		require.Nil(t, err)
+		require.Equal(t, expected.Header, f.Header)
+		require.True(t, bytes.Equal(expected.Body, f.Body))
+	}
+	require.True(t, framing.isModern())
+}
+
+func TestFrameReader_InvalidChecksum(t *testing.T) {
+	encodedFrame := &bytes.Buffer{}
+	require.Nil(t, defaultCodec.EncodeRawFrame(mustEncodeV5Frame(t, 0, &message.Options{}), encodedFrame))
+	buf := &bytes.Buffer{}
+	require.Nil(t, writeSegment(encodedFrame.Bytes(), true, buf))
+	encoded := buf.Bytes()
+	encoded[segment.UncompressedHeaderLength+segment.Crc24Length] ^= 0xFF
+
+	framing := newConnectionFraming(true)
+	framing.modern = 1
+	reader := newFrameReader(bufio.NewReader(buf), "client", context.Background(), framing)
+	_, err := reader.read()
+	require.NotNil(t, err)
+	require.IsType(t, &segmentError{}, err)
+
+	protocolErrResponse, err := checkProtocolError(defaultCodec, nil, err, false, true, ClientConnectorLogPrefix)
+	require.Nil(t, err)
+	require.Equal(t, primitive.ProtocolVersion5, protocolErrResponse.Header.Version)
+	decoded, err := defaultCodec.ConvertFromRawFrame(protocolErrResponse)
+	require.Nil(t, err)
+	require.IsType(t, &message.ProtocolError{}, decoded.Body.Message)
+	require.Contains(t, decoded.Body.Message.(*message.ProtocolError).ErrorMessage, "crc mismatch")
+}
+
+func TestConnectionFraming_Switch(t *testing.T) {
+	tests := []struct {
+		name           string
+		f              *frame.RawFrame
+		expectedSwitch bool
+	}{
+		{"v5 READY", mustEncodeV5Frame(t, 0, &message.Ready{}), true},
+		{"v5 AUTHENTICATE", mustEncodeV5Frame(t, 0, &message.Authenticate{Authenticator: "PasswordAuthenticator"}), true},
+		{"v5 ERROR", mustEncodeV5Frame(t, 0, &message.ProtocolError{ErrorMessage: "error"}), false},
+		{"v5 request", mustEncodeV5Frame(t, 0, message.NewStartup()), false},
+		{"v4 READY", mustEncodeFrame(t, &message.Ready{}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverFraming := newConnectionFraming(true)
+			serverFraming.frameRead(tt.f)
+			require.False(t, serverFraming.isModern())
+			serverFraming.frameWritten(tt.f)
+			require.Equal(t, tt.expectedSwitch, serverFraming.isModern())
+
+			clientFraming := newConnectionFraming(false)
+			clientFraming.frameWritten(tt.f)
+			require.False(t, clientFraming.isModern())
+			clientFraming.frameRead(tt.f)
+			require.Equal(t, tt.expectedSwitch, clientFraming.isModern())
+		})
+	}
+
+	var nilFraming *connectionFraming
+	nilFraming.frameWritten(mustEncodeV5Frame(t, 0, &message.Ready{}))
+	require.False(t, nilFraming.isModern())
+}
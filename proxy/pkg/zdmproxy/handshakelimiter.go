@@ -0,0 +1,99 @@
+package zdmproxy
+
+import (
+	"context"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// handshakeLimiter limits the number of client handshakes that are in progress at the same time across all client
+// connections so that a burst of reconnecting clients doesn't open too many cluster connections at once.
+// A handshake is in progress from the client's STARTUP request until the handshake is done or the client disconnects.
+// A nil handshakeLimiter doesn't limit nor track handshakes.
+type handshakeLimiter struct {
+	// nil if the number of concurrent handshakes is not limited
+	slots      chan struct{}
+	maxWait    time.Duration
+	inProgress metrics.Gauge
+}
+
+func newHandshakeLimiter(maxConcurrentHandshakes int, maxWait time.Duration, inProgress metrics.Gauge) *handshakeLimiter {
+	var slots chan struct{}
+	if maxConcurrentHandshakes > 0 {
+		slots = make(chan struct{}, maxConcurrentHandshakes)
+	}
+	return &handshakeLimiter{
+		slots:      slots,
+		maxWait:    maxWait,
+		inProgress: inProgress,
+	}
+}
+
+// acquire waits until a handshake can start, false is returned if that doesn't happen within the maximum wait time
+// or if the context is done first.
+func (recv *handshakeLimiter) acquire(ctx context.Context) bool {
+	if recv == nil {
+		return true
+	}
+
+	if recv.slots != nil {
+		select {
+		case recv.slots <- struct{}{}:
+		default:
+			if recv.maxWait <= 0 {
+				return false
+			}
+			timer := time.NewTimer(recv.maxWait)
+			defer timer.Stop()
+			select {
+			case recv.slots <- struct{}{}:
+			case <-timer.C:
+				return false
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+	recv.inProgress.Add(1)
+	return true
+}
+
+// release must be called once for each successful acquire.
+func (recv *handshakeLimiter) release() {
+	if recv == nil {
+		return
+	}
+
+	recv.inProgress.Subtract(1)
+	if recv.slots != nil {
+		<-recv.slots
+	}
+}
+
+// acquireHandshakeSlot starts tracking the handshake when the client sends STARTUP. If the proxy is already handling
+// the maximum number of concurrent handshakes then OVERLOADED is returned to the client and this method returns false.
+func (ch *ClientHandler) acquireHandshakeSlot(f *frame.RawFrame) bool {
+	if ch.handshakeSlotAcquired || f.Header.OpCode != primitive.OpCodeStartup {
+		return true
+	}
+
+	if !ch.handshakeLimiter.acquire(ch.clientHandlerContext) {
+		log.Warnf("Too many concurrent handshakes, returning OVERLOADED to client %v. "+
+			"See ZDM_MAX_CONCURRENT_HANDSHAKES.", ch.clientConnector.connection.RemoteAddr())
+		ch.clientConnector.sendOverloadedWithMessageToClient(f, "Too many concurrent handshakes, please retry.")
+		return false
+	}
+	ch.handshakeSlotAcquired = true
+	return true
+}
+
+func (ch *ClientHandler) releaseHandshakeSlot() {
+	if !ch.handshakeSlotAcquired {
+		return
+	}
+	ch.handshakeSlotAcquired = false
+	ch.handshakeLimiter.release()
+}
@@ -0,0 +1,75 @@
+package zdmproxy
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestHandshakeLimiter_Saturated(t *testing.T) {
+	gauge := &countingGauge{}
+	limiter := newHandshakeLimiter(3, 50*time.Millisecond, gauge)
+
+	for i := 0; i < 3; i++ {
+		require.True(t, limiter.acquire(context.Background()))
+	}
+	require.Equal(t, int64(3), gauge.get())
+
+	// the limit is reached so the next handshake waits and times out
+	start := time.Now()
+	require.False(t, limiter.acquire(context.Background()))
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	require.Equal(t, int64(3), gauge.get())
+
+	// a waiting handshake starts as soon as another one is done
+	limiter.maxWait = 5 * time.Second
+	acquired := make(chan bool, 1)
+	go func() {
+		acquired <- limiter.acquire(context.Background())
+	}()
+	time.Sleep(50 * time.Millisecond)
+	limiter.release()
+	select {
+	case ok := <-acquired:
+		require.True(t, ok)
+	case <-time.After(2 * time.Second):
+		t.Fatal("handshake did not start after a slot was released")
+	}
+	require.Equal(t, int64(3), gauge.get())
+
+	// a waiting handshake stops waiting when the client handler shuts down
+	ctx, cancelFn := context.WithCancel(context.Background())
+	go func() {
+		acquired <- limiter.acquire(ctx)
+	}()
+	cancelFn()
+	select {
+	case ok := <-acquired:
+		require.False(t, ok)
+	case <-time.After(2 * time.Second):
+		t.Fatal("handshake kept waiting after the context was canceled")
+	}
+
+	for i := 0; i < 3; i++ {
+		limiter.release()
+	}
+	require.Equal(t, int64(0), gauge.get())
+}
+
+func TestHandshakeLimiter_Unlimited(t *testing.T) {
+	gauge := &countingGauge{}
+	limiter := newHandshakeLimiter(0, 0, gauge)
+	for i := 0; i < 100; i++ {
+		require.True(t, limiter.acquire(context.Background()))
+	}
+	require.Equal(t, int64(100), gauge.get())
+	for i := 0; i < 100; i++ {
+		limiter.release()
+	}
+	require.Equal(t, int64(0), gauge.get())
+
+	var nilLimiter *handshakeLimiter
+	require.True(t, nilLimiter.acquire(context.Background()))
+	nilLimiter.release()
+}
@@ -0,0 +1,95 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"sync/atomic"
+	"time"
+)
+
+// InjectedLatencyReport contains the artificial delay that is currently added to the responses of each cluster.
+type InjectedLatencyReport struct {
+	OriginMs int64
+	TargetMs int64
+}
+
+// injectedLatency contains the artificial delay that is added to every response (events are not delayed) received
+// from each cluster, it is only meant for latency testing. The delay can be changed at runtime and it applies
+// to every client connection including the existing ones.
+// The delay of each cluster is bounded by ZDM_INJECTED_LATENCY_MAX_MS.
+// A nil injectedLatency never delays responses.
+type injectedLatency struct {
+	originDelayNanos int64
+	targetDelayNanos int64
+	maxDelay         time.Duration
+}
+
+func newInjectedLatency(conf *config.Config) *injectedLatency {
+	return &injectedLatency{
+		originDelayNanos: int64(time.Duration(conf.OriginInjectedLatencyMs) * time.Millisecond),
+		targetDelayNanos: int64(time.Duration(conf.TargetInjectedLatencyMs) * time.Millisecond),
+		maxDelay:         time.Duration(conf.InjectedLatencyMaxMs) * time.Millisecond,
+	}
+}
+
+func (recv *injectedLatency) get(clusterType common.ClusterType) time.Duration {
+	if recv == nil {
+		return 0
+	}
+	switch clusterType {
+	case common.ClusterTypeOrigin:
+		return time.Duration(atomic.LoadInt64(&recv.originDelayNanos))
+	case common.ClusterTypeTarget:
+		return time.Duration(atomic.LoadInt64(&recv.targetDelayNanos))
+	default:
+		return 0
+	}
+}
+
+func (recv *injectedLatency) set(clusterType common.ClusterType, delay time.Duration) error {
+	if recv == nil {
+		return fmt.Errorf("injected latency is not initialized")
+	}
+	if delay < 0 {
+		return fmt.Errorf("delay must not be negative but was %v", delay)
+	}
+	if delay > recv.maxDelay {
+		return fmt.Errorf("delay must not be greater than %v (ZDM_INJECTED_LATENCY_MAX_MS) but was %v", recv.maxDelay, delay)
+	}
+	switch clusterType {
+	case common.ClusterTypeOrigin:
+		atomic.StoreInt64(&recv.originDelayNanos, int64(delay))
+	case common.ClusterTypeTarget:
+		atomic.StoreInt64(&recv.targetDelayNanos, int64(delay))
+	default:
+		return fmt.Errorf("unknown cluster %v", clusterType)
+	}
+	return nil
+}
+
+func (recv *injectedLatency) report() *InjectedLatencyReport {
+	return &InjectedLatencyReport{
+		OriginMs: recv.get(common.ClusterTypeOrigin).Milliseconds(),
+		TargetMs: recv.get(common.ClusterTypeTarget).Milliseconds(),
+	}
+}
+
+// GetInjectedLatency returns the artificial delay that is currently added to the responses of each cluster.
+func (p *ZdmProxy) GetInjectedLatency() *InjectedLatencyReport {
+	return p.shared.injectedLatency.report()
+}
+
+// SetInjectedLatency changes the artificial delay that is added to the responses of a cluster (ORIGIN or TARGET),
+// a delay of 0 disables it. The delay counts towards the request latency metrics like any other cluster latency.
+func (p *ZdmProxy) SetInjectedLatency(cluster string, delay time.Duration) (*InjectedLatencyReport, error) {
+	clusterType, err := config.ParsePrimaryClusterValue(cluster)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster %v, it must be ORIGIN or TARGET", cluster)
+	}
+	err = p.shared.injectedLatency.set(clusterType, delay)
+	if err != nil {
+		return nil, err
+	}
+	return p.shared.injectedLatency.report(), nil
+}
@@ -0,0 +1,31 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestInjectedLatency(t *testing.T) {
+	latency := newInjectedLatency(
+		&config.Config{OriginInjectedLatencyMs: 0, TargetInjectedLatencyMs: 250, InjectedLatencyMaxMs: 1000})
+	require.Equal(t, time.Duration(0), latency.get(common.ClusterTypeOrigin))
+	require.Equal(t, 250*time.Millisecond, latency.get(common.ClusterTypeTarget))
+
+	require.Nil(t, latency.set(common.ClusterTypeOrigin, 100*time.Millisecond))
+	require.Equal(t, &InjectedLatencyReport{OriginMs: 100, TargetMs: 250}, latency.report())
+
+	require.NotNil(t, latency.set(common.ClusterTypeOrigin, -time.Millisecond))
+	require.NotNil(t, latency.set(common.ClusterTypeOrigin, 1001*time.Millisecond))
+	require.Nil(t, latency.set(common.ClusterTypeTarget, time.Second))
+	require.Nil(t, latency.set(common.ClusterTypeTarget, 250*time.Millisecond))
+	require.NotNil(t, latency.set(common.ClusterTypeNone, time.Millisecond))
+	require.Equal(t, &InjectedLatencyReport{OriginMs: 100, TargetMs: 250}, latency.report())
+
+	var disabledLatency *injectedLatency
+	require.Equal(t, time.Duration(0), disabledLatency.get(common.ClusterTypeOrigin))
+	require.NotNil(t, disabledLatency.set(common.ClusterTypeOrigin, time.Millisecond))
+	require.Equal(t, &InjectedLatencyReport{}, disabledLatency.report())
+}
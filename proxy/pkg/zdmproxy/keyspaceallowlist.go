@@ -0,0 +1,71 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+)
+
+// alwaysAllowedKeyspaces are queried by drivers to discover the cluster topology and schema.
+var alwaysAllowedKeyspaces = []string{systemKeyspaceName, systemSchemaKeyspaceName, systemVirtualSchemaKeyspaceName}
+
+// keyspaceAllowlist contains the keyspaces that clients can access, a nil allowlist allows every keyspace.
+type keyspaceAllowlist struct {
+	keyspaces map[string]bool
+}
+
+func newKeyspaceAllowlist(keyspaces []string) *keyspaceAllowlist {
+	if len(keyspaces) == 0 {
+		return nil
+	}
+
+	allowlist := &keyspaceAllowlist{keyspaces: make(map[string]bool)}
+	for _, keyspace := range alwaysAllowedKeyspaces {
+		allowlist.keyspaces[keyspace] = true
+	}
+	for _, keyspace := range keyspaces {
+		allowlist.keyspaces[keyspace] = true
+	}
+	return allowlist
+}
+
+// isAllowed returns true if the keyspace is in the allowlist. Requests without a keyspace are allowed,
+// the cluster rejects them if the keyspace is required.
+func (recv *keyspaceAllowlist) isAllowed(keyspace string) bool {
+	if recv == nil || keyspace == "" {
+		return true
+	}
+	return recv.keyspaces[keyspace]
+}
+
+// checkStatement returns a KeyspaceNotAllowedError if the statement accesses a keyspace that is not allowed.
+func (recv *keyspaceAllowlist) checkStatement(header *frame.Header, queryInfo QueryInfo) error {
+	if recv == nil {
+		return nil
+	}
+
+	for _, keyspace := range queryInfo.getApplicableKeyspaces() {
+		if !recv.isAllowed(keyspace) {
+			return &KeyspaceNotAllowedError{Header: header, keyspace: keyspace}
+		}
+	}
+	return nil
+}
+
+type KeyspaceNotAllowedError struct {
+	Header   *frame.Header
+	keyspace string
+}
+
+func (e *KeyspaceNotAllowedError) Error() string {
+	return fmt.Sprintf("Keyspace %v is not allowed by the proxy", e.keyspace)
+}
+
+func createKeyspaceNotAllowedFrame(codec frame.RawCodec, errVal *KeyspaceNotAllowedError) (*frame.RawFrame, error) {
+	f := frame.NewFrame(errVal.Header.Version, errVal.Header.StreamId, &message.Unauthorized{ErrorMessage: errVal.Error()})
+	rawFrame, err := codec.ConvertToRawFrame(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert unauthorized response frame to rawframe: %w", err)
+	}
+	return rawFrame, nil
+}
@@ -0,0 +1,174 @@
+package zdmproxy
+
+import (
+	"encoding/hex"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// keyspaceRouter forwards the requests that access specific keyspaces to a single cluster, e.g. when the target
+// environment is encoded in the keyspace name (see ZDM_KEYSPACE_ROUTING_RULES), or only the reads of those keyspaces
+// when reads are cut over one keyspace at a time (see ZDM_KEYSPACE_READ_ROUTING_RULES).
+// A nil keyspaceRouter doesn't route any requests.
+type keyspaceRouter struct {
+	rules []*common.KeyspaceRoutingRule
+}
+
+func newKeyspaceRouter(rules []*common.KeyspaceRoutingRule) *keyspaceRouter {
+	if len(rules) == 0 {
+		return nil
+	}
+	return &keyspaceRouter{rules: rules}
+}
+
+// getCluster returns the cluster of the first rule that matches the keyspace, false is returned if no rule matches.
+func (recv *keyspaceRouter) getCluster(keyspace string) (common.ClusterType, bool) {
+	if recv == nil || keyspace == "" {
+		return common.ClusterTypeNone, false
+	}
+
+	for _, rule := range recv.rules {
+		var matches bool
+		if strings.HasSuffix(rule.Pattern, "*") {
+			matches = strings.HasPrefix(keyspace, strings.TrimSuffix(rule.Pattern, "*"))
+		} else if strings.HasPrefix(rule.Pattern, "*") {
+			matches = strings.HasSuffix(keyspace, strings.TrimPrefix(rule.Pattern, "*"))
+		} else {
+			matches = keyspace == rule.Pattern
+		}
+		if matches {
+			return rule.Cluster, true
+		}
+	}
+	return common.ClusterTypeNone, false
+}
+
+// isRoutableByKeyspace returns false for USE statements and system or schema queries, they are never routed by
+// keyspace because they are forwarded based on other settings.
+func isRoutableByKeyspace(queryInfo QueryInfo) bool {
+	return queryInfo.getStatementType() != statementTypeUse && !isSystemQuery(queryInfo) && !isSchemaQuery(queryInfo)
+}
+
+// getStatementDecision returns the forward decision of the cluster that every keyspace of the statement is routed to,
+// false is returned if a keyspace is not routed or the keyspaces are routed to different clusters.
+func (recv *keyspaceRouter) getStatementDecision(queryInfo QueryInfo) (forwardDecision, bool) {
+	if recv == nil || !isRoutableByKeyspace(queryInfo) {
+		return forwardToNone, false
+	}
+
+	var routedCluster common.ClusterType
+	for _, keyspace := range queryInfo.getApplicableKeyspaces() {
+		cluster, ok := recv.getCluster(keyspace)
+		if !ok || (routedCluster != common.ClusterTypeNone && routedCluster != cluster) {
+			return forwardToNone, false
+		}
+		routedCluster = cluster
+	}
+
+	return getClusterDecision(routedCluster)
+}
+
+// getPreparedStatementDecision returns the forward decision of the cluster that the keyspace of a prepared statement is
+// routed to. The keyspace is the one the statement was prepared against (see PrepareRequestInfo.GetStatementKeyspace)
+// so that the EXECUTE requests are routed the same way even if the client switched to another keyspace since then.
+func (recv *keyspaceRouter) getPreparedStatementDecision(prepareRequestInfo *PrepareRequestInfo) (forwardDecision, bool) {
+	if recv == nil || prepareRequestInfo == nil || !prepareRequestInfo.routableByKeyspace {
+		return forwardToNone, false
+	}
+	cluster, ok := recv.getCluster(prepareRequestInfo.GetStatementKeyspace())
+	if !ok {
+		return forwardToNone, false
+	}
+	return getClusterDecision(cluster)
+}
+
+func getClusterDecision(cluster common.ClusterType) (forwardDecision, bool) {
+	switch cluster {
+	case common.ClusterTypeOrigin:
+		return forwardToOrigin, true
+	case common.ClusterTypeTarget:
+		return forwardToTarget, true
+	default:
+		return forwardToNone, false
+	}
+}
+
+// routeByKeyspace returns a request info that forwards the request only to the cluster that its keyspace is routed to.
+// EXECUTE requests are routed by the keyspace that their statement was prepared against, PREPARE requests are still
+// forwarded to both clusters. Other requests are returned unchanged.
+func (ch *ClientHandler) routeByKeyspace(
+	context *frameDecodeContext, requestInfo RequestInfo, currentKeyspace string) RequestInfo {
+	if ch.keyspaceRouter == nil {
+		return requestInfo
+	}
+
+	switch castedRequestInfo := requestInfo.(type) {
+	case *GenericRequestInfo:
+		if context.GetRawFrame().Header.OpCode != primitive.OpCodeQuery {
+			return requestInfo
+		}
+		decision, ok := ch.getKeyspaceDecision(ch.keyspaceRouter, context, currentKeyspace)
+		if !ok {
+			return requestInfo
+		}
+		log.Tracef("QUERY with stream id %v is routed to %v by keyspace.", context.GetRawFrame().Header.StreamId, decision)
+		return NewGenericRequestInfo(decision, false, castedRequestInfo.ShouldBeTrackedInMetrics())
+	case *ExecuteRequestInfo:
+		preparedData := castedRequestInfo.GetPreparedData()
+		decision, ok := ch.keyspaceRouter.getPreparedStatementDecision(preparedData.GetPrepareRequestInfo())
+		if castedRequestInfo.counterToOrigin || !ok {
+			return requestInfo
+		}
+		log.Tracef("EXECUTE with prepared-id = '%s' is routed to %v by keyspace.",
+			hex.EncodeToString(preparedData.GetOriginPreparedId()), decision)
+		return NewKeyspaceRoutedExecuteRequestInfo(preparedData, decision)
+	default:
+		return requestInfo
+	}
+}
+
+// routeReadByKeyspace returns a request info that forwards the read to the cluster that its keyspace is routed to by
+// ZDM_KEYSPACE_READ_ROUTING_RULES instead of the primary cluster, like routeRead does for the adaptive read router.
+// Bound reads are routed by the keyspace that their statement was prepared against. Other requests are returned unchanged.
+func (ch *ClientHandler) routeReadByKeyspace(
+	context *frameDecodeContext, requestInfo RequestInfo, currentKeyspace string) RequestInfo {
+	if ch.keyspaceReadRouter == nil {
+		return requestInfo
+	}
+
+	switch castedRequestInfo := requestInfo.(type) {
+	case *GenericRequestInfo:
+		if context.GetRawFrame().Header.OpCode != primitive.OpCodeQuery || !isPrimaryRead(requestInfo) {
+			return requestInfo
+		}
+		decision, ok := ch.getKeyspaceDecision(ch.keyspaceReadRouter, context, currentKeyspace)
+		if !ok || decision == requestInfo.GetForwardDecision() {
+			return requestInfo
+		}
+		log.Tracef("QUERY with stream id %v is a read that is routed to %v by keyspace.", context.GetRawFrame().Header.StreamId, decision)
+		return NewGenericRequestInfo(decision, castedRequestInfo.ShouldAlsoBeSentAsync(), castedRequestInfo.ShouldBeTrackedInMetrics())
+	case *ExecuteRequestInfo:
+		preparedData := castedRequestInfo.GetPreparedData()
+		decision, ok := ch.keyspaceReadRouter.getPreparedStatementDecision(preparedData.GetPrepareRequestInfo())
+		if !ok || !isPrimaryRead(requestInfo) || decision == requestInfo.GetForwardDecision() {
+			return requestInfo
+		}
+		log.Tracef("EXECUTE with prepared-id = '%s' is a read that is routed to %v by keyspace.",
+			hex.EncodeToString(preparedData.GetOriginPreparedId()), decision)
+		return NewRoutedExecuteRequestInfo(preparedData, decision)
+	default:
+		return requestInfo
+	}
+}
+
+func (ch *ClientHandler) getKeyspaceDecision(
+	router *keyspaceRouter, context *frameDecodeContext, currentKeyspace string) (forwardDecision, bool) {
+	stmtQueryData, err := context.GetOrInspectStatement(currentKeyspace, ch.timeUuidGenerator)
+	if err != nil {
+		log.Debugf("Could not inspect request with stream id %v for keyspace routing: %v", context.GetRawFrame().Header.StreamId, err)
+		return forwardToNone, false
+	}
+	return router.getStatementDecision(stmtQueryData.queryData)
+}
@@ -0,0 +1,229 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestKeyspaceRouter_GetCluster(t *testing.T) {
+	router := newKeyspaceRouter([]*common.KeyspaceRoutingRule{
+		{Pattern: "tenantA_prod_new", Cluster: common.ClusterTypeOrigin},
+		{Pattern: "*_new", Cluster: common.ClusterTypeTarget},
+		{Pattern: "tenantA_*", Cluster: common.ClusterTypeOrigin},
+	})
+
+	tests := []struct {
+		name            string
+		keyspace        string
+		expectedCluster common.ClusterType
+		expectedOk      bool
+	}{
+		{"exact", "tenantA_prod_new", common.ClusterTypeOrigin, true},
+		{"suffix", "tenantB_prod_new", common.ClusterTypeTarget, true},
+		{"prefix", "tenantA_prod", common.ClusterTypeOrigin, true},
+		{"first matching rule", "tenantA_staging_new", common.ClusterTypeTarget, true},
+		{"suffix is not a substring", "tenantB_new_prod", common.ClusterTypeNone, false},
+		{"prefix is case sensitive", "TenantA_prod", common.ClusterTypeNone, false},
+		{"no match", "ks", common.ClusterTypeNone, false},
+		{"no keyspace", "", common.ClusterTypeNone, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, ok := router.getCluster(tt.keyspace)
+			require.Equal(t, tt.expectedOk, ok)
+			require.Equal(t, tt.expectedCluster, cluster)
+		})
+	}
+
+	require.Nil(t, newKeyspaceRouter([]*common.KeyspaceRoutingRule{}))
+}
+
+func TestRouteByKeyspace(t *testing.T) {
+	ch := &ClientHandler{
+		keyspaceRouter: newKeyspaceRouter([]*common.KeyspaceRoutingRule{
+			{Pattern: "*_new", Cluster: common.ClusterTypeTarget},
+			{Pattern: "tenantA_*", Cluster: common.ClusterTypeTarget},
+		}),
+	}
+
+	tests := []struct {
+		name             string
+		query            string
+		currentKeyspace  string
+		expectedDecision forwardDecision
+	}{
+		{"write to suffix", "INSERT INTO tenantB_prod_new.t (a) VALUES (1)", "", forwardToTarget},
+		{"read from prefix", "SELECT * FROM \"tenantA_prod\".t", "", forwardToTarget},
+		{"unquoted keyspace is lower case", "SELECT * FROM tenantA_prod.t", "", forwardToOrigin},
+		{"current keyspace", "UPDATE t SET b = 1 WHERE a = 1", "tenantB_prod_new", forwardToTarget},
+		{"not routed", "INSERT INTO ks.t (a) VALUES (1)", "", forwardToBoth},
+		{"use", "USE tenantB_prod_new", "", forwardToBoth},
+		{"system query", "SELECT * FROM system.local", "tenantB_prod_new", forwardToOrigin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			context := NewFrameDecodeContext(mockQueryFrame(t, tt.query))
+			stmtQueryData, err := context.GetOrInspectStatement(tt.currentKeyspace, nil)
+			require.Nil(t, err)
+			requestInfo := getRequestInfoFromQueryInfo(
+				context.GetRawFrame(), common.ClusterTypeOrigin, false, false, false, stmtQueryData.queryData)
+			requestInfo = ch.routeByKeyspace(context, requestInfo, tt.currentKeyspace)
+			require.Equal(t, tt.expectedDecision, requestInfo.GetForwardDecision())
+			if tt.expectedDecision == forwardToTarget {
+				require.False(t, requestInfo.ShouldAlsoBeSentAsync())
+			}
+		})
+	}
+
+	// PREPARE requests are forwarded to both clusters and their EXECUTE requests are routed by keyspace
+	prepare := NewFrameDecodeContext(mockPrepareFrame(t, "INSERT INTO tenantB_prod_new.t (a) VALUES (?)"))
+	preparedData := mustBuildPreparedData(t, prepare, "", common.ClusterTypeOrigin)
+	prepareRequestInfo := preparedData.GetPrepareRequestInfo()
+	require.Same(t, prepareRequestInfo, ch.routeByKeyspace(prepare, prepareRequestInfo, ""))
+	require.Equal(t, forwardToBoth, prepareRequestInfo.GetForwardDecision())
+
+	execute := NewFrameDecodeContext(mustEncodeFrame(t, &message.Execute{QueryId: []byte("origin")}))
+	requestInfo := ch.routeByKeyspace(execute, NewExecuteRequestInfo(preparedData), "")
+	require.Equal(t, forwardToTarget, requestInfo.GetForwardDecision())
+	require.False(t, requestInfo.ShouldAlsoBeSentAsync())
+
+	// counter statements are always forwarded to ORIGIN
+	requestInfo = ch.routeByKeyspace(execute, NewCounterExecuteRequestInfo(preparedData), "")
+	require.Equal(t, forwardToOrigin, requestInfo.GetForwardDecision())
+
+	// requests are not routed when keyspace routing is disabled
+	disabledCh := &ClientHandler{}
+	query := NewFrameDecodeContext(mockQueryFrame(t, "INSERT INTO tenantB_prod_new.t (a) VALUES (1)"))
+	requestInfo = disabledCh.routeByKeyspace(query, NewGenericRequestInfo(forwardToBoth, false, true), "")
+	require.Equal(t, forwardToBoth, requestInfo.GetForwardDecision())
+}
+
+func TestRouteReadByKeyspace(t *testing.T) {
+	ch := &ClientHandler{
+		keyspaceReadRouter: newKeyspaceRouter([]*common.KeyspaceRoutingRule{
+			{Pattern: "ks_a", Cluster: common.ClusterTypeTarget},
+			{Pattern: "ks_b", Cluster: common.ClusterTypeOrigin},
+		}),
+	}
+
+	tests := []struct {
+		name             string
+		query            string
+		currentKeyspace  string
+		primaryCluster   common.ClusterType
+		expectedDecision forwardDecision
+	}{
+		{"read from keyspace routed to target", "SELECT * FROM ks_a.t", "", common.ClusterTypeOrigin, forwardToTarget},
+		{"read from keyspace routed to origin", "SELECT * FROM ks_b.t", "", common.ClusterTypeOrigin, forwardToOrigin},
+		{"read from keyspace routed to origin with target primary", "SELECT * FROM ks_b.t", "", common.ClusterTypeTarget, forwardToOrigin},
+		{"current keyspace", "SELECT * FROM t", "ks_a", common.ClusterTypeOrigin, forwardToTarget},
+		{"read from other keyspace", "SELECT * FROM ks_c.t", "", common.ClusterTypeTarget, forwardToTarget},
+		{"write", "INSERT INTO ks_a.t (a) VALUES (1)", "", common.ClusterTypeOrigin, forwardToBoth},
+		{"system query", "SELECT * FROM system.local", "ks_a", common.ClusterTypeOrigin, forwardToOrigin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			context := NewFrameDecodeContext(mockQueryFrame(t, tt.query))
+			stmtQueryData, err := context.GetOrInspectStatement(tt.currentKeyspace, nil)
+			require.Nil(t, err)
+			requestInfo := getRequestInfoFromQueryInfo(
+				context.GetRawFrame(), tt.primaryCluster, false, false, false, stmtQueryData.queryData)
+			requestInfo = ch.routeReadByKeyspace(context, requestInfo, tt.currentKeyspace)
+			require.Equal(t, tt.expectedDecision, requestInfo.GetForwardDecision())
+		})
+	}
+
+	// bound reads are routed by the keyspace of their prepared statement
+	newPreparedData := func(query string) PreparedData {
+		prepare := NewFrameDecodeContext(mockPrepareFrame(t, query))
+		preparedData := mustBuildPreparedData(t, prepare, "", common.ClusterTypeOrigin)
+		require.Same(t, preparedData.GetPrepareRequestInfo(), ch.routeReadByKeyspace(prepare, preparedData.GetPrepareRequestInfo(), ""))
+		require.Equal(t, forwardToBoth, preparedData.GetPrepareRequestInfo().GetForwardDecision())
+		return preparedData
+	}
+	for _, tt := range []struct {
+		query            string
+		expectedDecision forwardDecision
+	}{
+		{"SELECT * FROM ks_a.t WHERE a = ?", forwardToTarget},
+		{"SELECT * FROM ks_b.t WHERE a = ?", forwardToOrigin},
+		{"SELECT * FROM ks_c.t WHERE a = ?", forwardToOrigin},
+		{"INSERT INTO ks_a.t (a) VALUES (?)", forwardToBoth},
+	} {
+		preparedData := newPreparedData(tt.query)
+		execute := NewFrameDecodeContext(mustEncodeFrame(t, &message.Execute{QueryId: []byte(tt.query)}))
+		requestInfo := ch.routeReadByKeyspace(execute, NewExecuteRequestInfo(preparedData), "")
+		require.Equal(t, tt.expectedDecision, requestInfo.GetForwardDecision(), tt.query)
+	}
+
+	// counter reads that are forwarded to ORIGIN only are not routed
+	preparedData := newPreparedData("SELECT * FROM ks_a.t WHERE a = ?")
+	execute := NewFrameDecodeContext(mustEncodeFrame(t, &message.Execute{QueryId: []byte("SELECT * FROM ks_a.t WHERE a = ?")}))
+	requestInfo := ch.routeReadByKeyspace(execute, NewCounterExecuteRequestInfo(preparedData), "")
+	require.Equal(t, forwardToOrigin, requestInfo.GetForwardDecision())
+
+	// reads are not routed when keyspace read routing is disabled
+	disabledCh := &ClientHandler{}
+	query := NewFrameDecodeContext(mockQueryFrame(t, "SELECT * FROM ks_a.t"))
+	requestInfo = disabledCh.routeReadByKeyspace(query, NewGenericRequestInfo(forwardToOrigin, true, true), "")
+	require.Equal(t, forwardToOrigin, requestInfo.GetForwardDecision())
+}
+
+func TestRouteByKeyspace_PreparedStatementAfterUse(t *testing.T) {
+	ch := &ClientHandler{
+		keyspaceRouter: newKeyspaceRouter([]*common.KeyspaceRoutingRule{
+			{Pattern: "tenantA_*", Cluster: common.ClusterTypeTarget},
+		}),
+		keyspaceReadRouter: newKeyspaceRouter([]*common.KeyspaceRoutingRule{
+			{Pattern: "ks_a", Cluster: common.ClusterTypeTarget},
+		}),
+	}
+
+	tests := []struct {
+		name             string
+		query            string
+		prepareKeyspace  string
+		executeKeyspace  string
+		readRouting      bool
+		expectedDecision forwardDecision
+	}{
+		{"write prepared in routed keyspace", "INSERT INTO t (a) VALUES (?)", "tenantA_prod", "ks", false, forwardToTarget},
+		{"write prepared in other keyspace", "INSERT INTO t (a) VALUES (?)", "ks", "tenantA_prod", false, forwardToBoth},
+		{"read prepared in routed keyspace", "SELECT * FROM t WHERE a = ?", "ks_a", "ks_b", true, forwardToTarget},
+		{"read prepared in other keyspace", "SELECT * FROM t WHERE a = ?", "ks_b", "ks_a", true, forwardToOrigin},
+		{"qualified read", "SELECT * FROM ks_a.t WHERE a = ?", "ks_b", "ks_b", true, forwardToTarget},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preparedData := mustBuildPreparedData(
+				t, NewFrameDecodeContext(mockPrepareFrame(t, tt.query)), tt.prepareKeyspace, common.ClusterTypeOrigin)
+
+			// the client switches to another keyspace before it executes the statement
+			execute := NewFrameDecodeContext(mustEncodeFrame(t, &message.Execute{QueryId: []byte("origin")}))
+			var requestInfo RequestInfo = NewExecuteRequestInfo(preparedData)
+			if tt.readRouting {
+				requestInfo = ch.routeReadByKeyspace(execute, requestInfo, tt.executeKeyspace)
+			} else {
+				requestInfo = ch.routeByKeyspace(execute, requestInfo, tt.executeKeyspace)
+			}
+			require.Equal(t, tt.expectedDecision, requestInfo.GetForwardDecision())
+		})
+	}
+}
+
+// mustBuildPreparedData returns the prepared data of a PREPARE request that was sent while the given keyspace was the
+// current keyspace of the client connection.
+func mustBuildPreparedData(
+	t *testing.T, prepare *frameDecodeContext, currentKeyspace string, primaryCluster common.ClusterType) PreparedData {
+	requestInfo, err := buildRequestInfo(
+		prepare, []*statementReplacedTerms{}, nil, newFakeMetricHandler(), currentKeyspace, primaryCluster,
+		false, false, false, false, false, false, nil, nil, common.PsCacheMissModeUnprepared)
+	require.Nil(t, err)
+	require.IsType(t, &PrepareRequestInfo{}, requestInfo)
+	return NewPreparedData(
+		&message.PreparedResult{PreparedQueryId: []byte("origin")},
+		&message.PreparedResult{PreparedQueryId: []byte("target")},
+		requestInfo.(*PrepareRequestInfo))
+}
@@ -0,0 +1,42 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+)
+
+// checkResponseSize logs a warning and increments the large responses metric if the body of the response exceeds
+// ZDM_LARGE_RESPONSE_THRESHOLD_BYTES. Only the length in the response header is checked so the response is not decoded.
+func (ch *ClientHandler) checkResponseSize(reqCtx *requestContextImpl, response *frame.RawFrame) {
+	threshold := ch.conf.LargeResponseThresholdBytes
+	if threshold <= 0 || response == nil || int(response.Header.BodyLength) <= threshold {
+		return
+	}
+
+	ch.metricHandler.GetProxyMetrics().LargeResponses.Add(1)
+	query := ch.getRequestQuery(reqCtx)
+	if query == "" {
+		reqCtx.logger().Warnf("Response to %v request with stream id %v is %v bytes, the threshold is %v bytes.",
+			reqCtx.request.Header.OpCode, reqCtx.request.Header.StreamId, response.Header.BodyLength, threshold)
+		return
+	}
+	reqCtx.logger().Warnf("Response to %v request with stream id %v is %v bytes, the threshold is %v bytes. Query: %v",
+		reqCtx.request.Header.OpCode, reqCtx.request.Header.StreamId, response.Header.BodyLength, threshold, query)
+}
+
+// getRequestQuery returns the query string of a QUERY request or of the prepared statement of an EXECUTE request,
+// it returns an empty string if the query can't be resolved.
+func (ch *ClientHandler) getRequestQuery(reqCtx *requestContextImpl) string {
+	if executeInfo, ok := reqCtx.requestInfo.(*ExecuteRequestInfo); ok {
+		return executeInfo.GetPreparedData().GetPrepareRequestInfo().GetQuery()
+	}
+
+	decodedFrame, err := ch.newFrameDecodeContext(reqCtx.request).GetOrDecodeFrame()
+	if err != nil {
+		return ""
+	}
+	if queryMsg, ok := decodedFrame.Body.Message.(*message.Query); ok {
+		return queryMsg.Query
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientHandler_CheckResponseSize(t *testing.T) {
+	conf := config.New()
+	conf.LargeResponseThresholdBytes = 1024
+	proxyMetrics := newFakeProxyMetrics()
+	largeResponses := &countingCounter{}
+	proxyMetrics.LargeResponses = largeResponses
+	ch := &ClientHandler{
+		conf: conf,
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+
+	rows := func(count int) *message.RowsResult {
+		data := make(message.RowSet, 0, count)
+		for i := 0; i < count; i++ {
+			data = append(data, message.Row{[]byte(strings.Repeat("a", 100))})
+		}
+		return &message.RowsResult{
+			Metadata: &message.RowsMetadata{
+				ColumnCount: 1,
+				Columns: []*message.ColumnMetadata{
+					{Keyspace: "ks1", Table: "t", Name: "value", Type: datatype.Varchar},
+				},
+			},
+			Data: data,
+		}
+	}
+	smallResponse := mustEncodeFrame(t, rows(1))
+	largeResponse := mustEncodeFrame(t, rows(100))
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	query := mockQueryFrame(t, "SELECT * FROM ks1.t")
+	ch.checkResponseSize(NewRequestContext(query, NewGenericRequestInfo(forwardToOrigin, false, true), time.Now(), nil), smallResponse)
+	require.Equal(t, int64(0), largeResponses.get())
+	require.Nil(t, hook.LastEntry())
+
+	ch.checkResponseSize(NewRequestContext(query, NewGenericRequestInfo(forwardToOrigin, false, true), time.Now(), nil), largeResponse)
+	require.Equal(t, int64(1), largeResponses.get())
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	require.Equal(t, log.WarnLevel, entry.Level)
+	require.Contains(t, entry.Message, "the threshold is 1024 bytes")
+	require.Contains(t, entry.Message, "Query: SELECT * FROM ks1.t")
+
+	// the query of an EXECUTE request is resolved from the prepared statement
+	preparedData := NewPreparedData(
+		&message.PreparedResult{PreparedQueryId: []byte("origin")},
+		&message.PreparedResult{PreparedQueryId: []byte("target")},
+		NewPrepareRequestInfo(NewGenericRequestInfo(forwardToOrigin, false, true), nil, false, "SELECT * FROM ks1.t WHERE a = ?", ""))
+	execute := mustEncodeFrame(t, &message.Execute{QueryId: []byte("origin")})
+	ch.checkResponseSize(NewRequestContext(execute, NewExecuteRequestInfo(preparedData), time.Now(), nil), largeResponse)
+	require.Equal(t, int64(2), largeResponses.get())
+	require.Contains(t, hook.LastEntry().Message, "Query: SELECT * FROM ks1.t WHERE a = ?")
+
+	conf.LargeResponseThresholdBytes = 0
+	ch.checkResponseSize(NewRequestContext(query, NewGenericRequestInfo(forwardToOrigin, false, true), time.Now(), nil), largeResponse)
+	require.Equal(t, int64(2), largeResponses.get())
+}
@@ -0,0 +1,174 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// MismatchReporter receives a report for every request on which the clusters diverged: dual writes that succeeded on
+// one cluster and failed on the other and reads that returned different rows (see ZDM_READ_COMPARISON_ENABLED).
+// It can be replaced with a custom implementation (e.g. that writes the reports to a file or to a queue consumed by
+// a reconciliation service) before Start is called, no report is built if nil. The requests are counted in
+// proxy_mismatch_reports_total either way.
+//
+// Implementations must be safe for concurrent use and must not block, they are called on the request path.
+type MismatchReporter interface {
+	ReportMismatch(report *MismatchReport)
+}
+
+type MismatchCategory string
+
+const (
+	MismatchCategoryWriteFailedOnOrigin = MismatchCategory("WRITE_FAILED_ON_ORIGIN")
+	MismatchCategoryWriteFailedOnTarget = MismatchCategory("WRITE_FAILED_ON_TARGET")
+	MismatchCategoryTargetExtraRows     = MismatchCategory("TARGET_EXTRA_ROWS")
+	MismatchCategoryOriginExtraRows     = MismatchCategory("ORIGIN_EXTRA_ROWS")
+	MismatchCategoryValuesDiffer        = MismatchCategory("VALUES_DIFFER")
+	MismatchCategoryMetadataOnly        = MismatchCategory("METADATA_ONLY")
+)
+
+// MismatchReport describes a request on which the clusters diverged. A request that accesses several tables
+// (e.g. a BATCH) is reported once per table.
+type MismatchReport struct {
+	Category MismatchCategory
+
+	// Cluster on which the write failed or that returned the extra rows,
+	// common.ClusterTypeNone if both clusters returned rows that the other one didn't return (or different metadata).
+	Cluster common.ClusterType
+
+	// Empty if the table could not be resolved.
+	Keyspace string
+	Table    string
+
+	// Values of the partition key columns that were bound to an EXECUTE request by column name,
+	// nil for other requests.
+	PartitionKey map[string]interface{}
+
+	// Query string of the request (of the prepared statement for EXECUTE requests),
+	// the statements of a BATCH are separated by a semicolon.
+	Query string
+
+	// Rows that were only returned by each cluster for read mismatches, they are described by Columns.
+	Columns        []*message.ColumnMetadata
+	OriginOnlyRows message.RowSet
+	TargetOnlyRows message.RowSet
+
+	// Columns returned by TARGET for METADATA_ONLY read mismatches, Columns are the ones returned by ORIGIN.
+	TargetColumns []*message.ColumnMetadata
+}
+
+// reportWriteMismatch reports a dual write that succeeded on one cluster and failed on the other.
+func (ch *ClientHandler) reportWriteMismatch(
+	requestInfo RequestInfo, request *frame.RawFrame, originResponse *frame.RawFrame, targetResponse *frame.RawFrame) {
+	originSuccessful := isResponseSuccessful(originResponse)
+	if originSuccessful == isResponseSuccessful(targetResponse) {
+		return
+	}
+
+	report := MismatchReport{Category: MismatchCategoryWriteFailedOnOrigin, Cluster: common.ClusterTypeOrigin}
+	if originSuccessful {
+		report = MismatchReport{Category: MismatchCategoryWriteFailedOnTarget, Cluster: common.ClusterTypeTarget}
+	}
+	ch.reportMismatch(requestInfo, request, report)
+}
+
+// reportMismatch completes the report with the details of the request and sends it to the mismatch reporter once
+// per table of the request.
+func (ch *ClientHandler) reportMismatch(requestInfo RequestInfo, request *frame.RawFrame, report MismatchReport) {
+	ch.metricHandler.GetProxyMetrics().MismatchReports.Add(1)
+	if ch.mismatchReporter == nil {
+		return
+	}
+
+	decodedFrame, err := ch.codec.get().ConvertFromRawFrame(request)
+	if err != nil {
+		log.Warnf("Could not decode request to report a mismatch: %v", err)
+	} else {
+		report.Query = getMismatchQuery(requestInfo, decodedFrame.Body.Message)
+		report.PartitionKey, err = getMismatchPartitionKey(requestInfo, decodedFrame)
+		if err != nil {
+			log.Debugf("Could not decode the partition key of a mismatch: %v", err)
+		}
+	}
+
+	for _, table := range ch.getDivergenceTables(requestInfo, request) {
+		tableReport := report
+		if table != unknownDivergenceTable {
+			tableReport.Keyspace = table.keyspace
+			tableReport.Table = table.table
+		}
+		ch.mismatchReporter.ReportMismatch(&tableReport)
+	}
+}
+
+func getMismatchQuery(requestInfo RequestInfo, msg message.Message) string {
+	switch typedMsg := msg.(type) {
+	case *message.Query:
+		return typedMsg.Query
+	case *message.Execute:
+		if executeRequestInfo, ok := requestInfo.(*ExecuteRequestInfo); ok {
+			return getPreparedQuery(executeRequestInfo.GetPreparedData())
+		}
+	case *message.Batch:
+		batchRequestInfo, _ := requestInfo.(*BatchRequestInfo)
+		queries := make([]string, 0, len(typedMsg.Children))
+		for idx, child := range typedMsg.Children {
+			if query, ok := child.QueryOrId.(string); ok {
+				queries = append(queries, query)
+			} else if batchRequestInfo != nil {
+				queries = append(queries, getPreparedQuery(batchRequestInfo.preparedDataByStmtIdx[idx]))
+			}
+		}
+		return strings.Join(queries, "; ")
+	}
+	return ""
+}
+
+func getPreparedQuery(preparedData PreparedData) string {
+	if preparedData == nil || preparedData.GetPrepareRequestInfo() == nil {
+		return ""
+	}
+	return preparedData.GetPrepareRequestInfo().GetQuery()
+}
+
+// getMismatchPartitionKey decodes the values of an EXECUTE request that are bound to the partition key columns
+// of the prepared statement.
+func getMismatchPartitionKey(requestInfo RequestInfo, decodedFrame *frame.Frame) (map[string]interface{}, error) {
+	executeRequestInfo, ok := requestInfo.(*ExecuteRequestInfo)
+	if !ok {
+		return nil, nil
+	}
+	execute, ok := decodedFrame.Body.Message.(*message.Execute)
+	if !ok || execute.Options == nil {
+		return nil, nil
+	}
+	variablesMetadata := executeRequestInfo.GetPreparedData().GetOriginVariablesMetadata()
+	if variablesMetadata == nil || len(variablesMetadata.PkIndices) == 0 {
+		return nil, nil
+	}
+
+	partitionKey := make(map[string]interface{}, len(variablesMetadata.PkIndices))
+	for _, pkIdx := range variablesMetadata.PkIndices {
+		if int(pkIdx) >= len(variablesMetadata.Columns) {
+			return nil, fmt.Errorf("partition key index %v is out of range", pkIdx)
+		}
+		column := variablesMetadata.Columns[pkIdx]
+		value := execute.Options.NamedValues[column.Name]
+		if len(execute.Options.NamedValues) == 0 && int(pkIdx) < len(execute.Options.PositionalValues) {
+			value = execute.Options.PositionalValues[pkIdx]
+		}
+		if value == nil {
+			return nil, fmt.Errorf("no value is bound to partition key column %v", column.Name)
+		}
+		decodedValue, err := GetDefaultGenericTypeCodec().Decode(column.Type, value.Contents, decodedFrame.Header.Version)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode value of column %v: %w", column.Name, err)
+		}
+		partitionKey[column.Name] = decodedValue
+	}
+	return partitionKey, nil
+}
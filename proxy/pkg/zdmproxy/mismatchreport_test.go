@@ -0,0 +1,150 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type capturingMismatchReporter struct {
+	lock    sync.Mutex
+	reports []*MismatchReport
+}
+
+func (recv *capturingMismatchReporter) ReportMismatch(report *MismatchReport) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	recv.reports = append(recv.reports, report)
+}
+
+func (recv *capturingMismatchReporter) getReports() []*MismatchReport {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	reports := recv.reports
+	recv.reports = nil
+	return reports
+}
+
+func newMismatchReportTestHandler(reporter MismatchReporter, mismatchReports metrics.Counter) *ClientHandler {
+	proxyMetrics := newFakeProxyMetrics()
+	proxyMetrics.MismatchReports = mismatchReports
+	conf := config.New()
+	conf.ReadComparisonEnabled = true
+	ch := &ClientHandler{
+		conf:                conf,
+		primaryCluster:      common.ClusterTypeOrigin,
+		currentKeyspaceName: &atomic.Value{},
+		mismatchReporter:    reporter,
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+	ch.StoreCurrentKeyspace("ks1")
+	return ch
+}
+
+func TestMismatchReporter_Writes(t *testing.T) {
+	reporter := &capturingMismatchReporter{}
+	mismatchReports := &countingCounter{}
+	ch := newMismatchReportTestHandler(reporter, mismatchReports)
+
+	void := mustEncodeFrame(t, &message.VoidResult{})
+	writeTimeout := mustEncodeFrame(t, &message.WriteTimeout{
+		ErrorMessage: "timeout", Consistency: primitive.ConsistencyLevelQuorum, Received: 1, BlockFor: 2,
+		WriteType: primitive.WriteTypeSimple})
+
+	insert := "INSERT INTO ks2.t (id, v) VALUES (?, ?)"
+	preparedData := NewPreparedData(
+		&message.PreparedResult{
+			PreparedQueryId: []byte("origin"),
+			VariablesMetadata: &message.VariablesMetadata{
+				PkIndices: []uint16{0},
+				Columns: []*message.ColumnMetadata{
+					{Keyspace: "ks2", Table: "t", Name: "id", Index: 0, Type: datatype.Int},
+					{Keyspace: "ks2", Table: "t", Name: "v", Index: 1, Type: datatype.Varchar},
+				}}},
+		&message.PreparedResult{PreparedQueryId: []byte("target")},
+		NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, true, insert, ""))
+	execute := mustEncodeFrame(t, &message.Execute{QueryId: []byte("origin"), Options: &message.QueryOptions{
+		PositionalValues: []*primitive.Value{primitive.NewValue([]byte{0, 0, 0, 42}), primitive.NewValue([]byte("value"))}}})
+
+	ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster, NewExecuteRequestInfo(preparedData), execute, void, writeTimeout)
+	require.Equal(t, []*MismatchReport{{
+		Category:     MismatchCategoryWriteFailedOnTarget,
+		Cluster:      common.ClusterTypeTarget,
+		Keyspace:     "ks2",
+		Table:        "t",
+		PartitionKey: map[string]interface{}{"id": int32(42)},
+		Query:        insert,
+	}}, reporter.getReports())
+
+	// writes that have the same outcome on both clusters are not reported
+	ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster, NewExecuteRequestInfo(preparedData), execute, void, void)
+	ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster, NewExecuteRequestInfo(preparedData), execute, writeTimeout, writeTimeout)
+	require.Empty(t, reporter.getReports())
+
+	// a batch is reported once per table
+	batch := mustEncodeFrame(t, &message.Batch{Children: []*message.BatchChild{
+		{QueryOrId: "INSERT INTO t1 (id) VALUES (1)"},
+		{QueryOrId: []byte("origin")},
+	}})
+	ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster,
+		NewBatchRequestInfo(map[int]PreparedData{1: preparedData}), batch, writeTimeout, void)
+	query := "INSERT INTO t1 (id) VALUES (1); " + insert
+	require.Equal(t, []*MismatchReport{
+		{Category: MismatchCategoryWriteFailedOnOrigin, Cluster: common.ClusterTypeOrigin, Keyspace: "ks2", Table: "t", Query: query},
+		{Category: MismatchCategoryWriteFailedOnOrigin, Cluster: common.ClusterTypeOrigin, Keyspace: "ks1", Table: "t1", Query: query},
+	}, reporter.getReports())
+	require.Equal(t, int64(2), mismatchReports.get())
+}
+
+func TestMismatchReporter_Reads(t *testing.T) {
+	reporter := &capturingMismatchReporter{}
+	mismatchReports := &countingCounter{}
+	ch := newMismatchReportTestHandler(reporter, mismatchReports)
+
+	columns := []*message.ColumnMetadata{{Keyspace: "ks1", Table: "t", Name: "id", Type: datatype.Varchar}}
+	rows := func(values ...string) *message.RowsResult {
+		rowSet := message.RowSet{}
+		for _, value := range values {
+			rowSet = append(rowSet, message.Row{[]byte(value)})
+		}
+		return &message.RowsResult{Metadata: &message.RowsMetadata{ColumnCount: 1, Columns: columns}, Data: rowSet}
+	}
+
+	query := "SELECT id FROM t"
+	reqCtx := NewRequestContext(mockQueryFrame(t, query), NewRaceReadRequestInfo(true), time.Now(), nil)
+	reqCtx.updateInternalState(mustEncodeFrame(t, rows("a", "b")), common.ClusterTypeOrigin)
+	reqCtx.updateInternalState(mustEncodeFrame(t, rows("a", "c", "d")), common.ClusterTypeTarget)
+	ch.compareRaceRead(reqCtx)
+
+	require.Equal(t, []*MismatchReport{{
+		Category:       MismatchCategoryValuesDiffer,
+		Cluster:        common.ClusterTypeNone,
+		Keyspace:       "ks1",
+		Table:          "t",
+		Query:          query,
+		Columns:        columns,
+		OriginOnlyRows: message.RowSet{{[]byte("b")}},
+		TargetOnlyRows: message.RowSet{{[]byte("c")}, {[]byte("d")}},
+	}}, reporter.getReports())
+	require.Equal(t, int64(1), mismatchReports.get())
+}
+
+func TestMismatchReporter_NotConfigured(t *testing.T) {
+	mismatchReports := &countingCounter{}
+	ch := newMismatchReportTestHandler(nil, mismatchReports)
+
+	insert := mustEncodeFrame(t, &message.Query{Query: "INSERT INTO t (id) VALUES (1)"})
+	ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster, NewGenericRequestInfo(forwardToBoth, false, true), insert,
+		mustEncodeFrame(t, &message.VoidResult{}), mustEncodeFrame(t, &message.Overloaded{ErrorMessage: "overloaded"}))
+	require.Equal(t, int64(1), mismatchReports.get())
+}
@@ -0,0 +1,132 @@
+package zdmproxy
+
+import (
+	"context"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	opCodeGroupQuery = iota
+	opCodeGroupExecute
+	opCodeGroupPrepare
+	opCodeGroupBatch
+	opCodeGroupRegister
+	opCodeGroupOther
+	opCodeGroupCount
+)
+
+var opCodeGroupNames = [opCodeGroupCount]string{"QUERY", "EXECUTE", "PREPARE", "BATCH", "REGISTER", "OTHER"}
+
+// opCodeDistribution tracks the request frames received from clients grouped by opcode. Running totals are exposed
+// through the proxy metrics while the counts of the current interval are kept here so that they can be logged
+// periodically. Only the frame header is used so this is cheap enough to do for every request.
+type opCodeDistribution struct {
+	metrics        [opCodeGroupCount]metrics.Counter
+	intervalCounts [opCodeGroupCount]int64
+}
+
+func newOpCodeDistribution(proxyMetrics *metrics.ProxyMetrics) *opCodeDistribution {
+	return &opCodeDistribution{
+		metrics: [opCodeGroupCount]metrics.Counter{
+			proxyMetrics.RequestsQuery,
+			proxyMetrics.RequestsExecute,
+			proxyMetrics.RequestsPrepare,
+			proxyMetrics.RequestsBatch,
+			proxyMetrics.RequestsRegister,
+			proxyMetrics.RequestsOther,
+		},
+	}
+}
+
+func getOpCodeGroup(opCode primitive.OpCode) int {
+	switch opCode {
+	case primitive.OpCodeQuery:
+		return opCodeGroupQuery
+	case primitive.OpCodeExecute:
+		return opCodeGroupExecute
+	case primitive.OpCodePrepare:
+		return opCodeGroupPrepare
+	case primitive.OpCodeBatch:
+		return opCodeGroupBatch
+	case primitive.OpCodeRegister:
+		return opCodeGroupRegister
+	default:
+		return opCodeGroupOther
+	}
+}
+
+func (recv *opCodeDistribution) track(opCode primitive.OpCode) {
+	group := getOpCodeGroup(opCode)
+	recv.metrics[group].Add(1)
+	atomic.AddInt64(&recv.intervalCounts[group], 1)
+}
+
+// resetInterval returns the counts of the current interval, keyed by opcode name, and starts a new interval.
+func (recv *opCodeDistribution) resetInterval() map[string]int64 {
+	counts := make(map[string]int64, opCodeGroupCount)
+	for i := 0; i < opCodeGroupCount; i++ {
+		counts[opCodeGroupNames[i]] = atomic.SwapInt64(&recv.intervalCounts[i], 0)
+	}
+	return counts
+}
+
+// runLogLoop logs the opcode distribution of the previous interval every time the interval elapses
+// until the provided context is canceled.
+func (recv *opCodeDistribution) runLogLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				counts := recv.resetInterval()
+				log.Infof("Request opcode distribution over the last %v: QUERY=%d EXECUTE=%d PREPARE=%d BATCH=%d REGISTER=%d OTHER=%d.",
+					interval, counts["QUERY"], counts["EXECUTE"], counts["PREPARE"], counts["BATCH"], counts["REGISTER"], counts["OTHER"])
+			}
+		}
+	}()
+}
+
+// frameTypeCounters tracks the request frames that a cluster connector sends to its cluster grouped by type so that
+// the handshake and control churn (e.g. during reconnect storms) can be compared with the actual query traffic.
+// A nil frameTypeCounters doesn't track anything.
+type frameTypeCounters struct {
+	control metrics.Counter
+	data    metrics.Counter
+}
+
+func newFrameTypeCounters(proxyMetrics *metrics.ProxyMetrics, clusterType common.ClusterType) *frameTypeCounters {
+	if clusterType == common.ClusterTypeTarget {
+		return &frameTypeCounters{control: proxyMetrics.TargetControlFrames, data: proxyMetrics.TargetDataFrames}
+	}
+	return &frameTypeCounters{control: proxyMetrics.OriginControlFrames, data: proxyMetrics.OriginDataFrames}
+}
+
+// isDataFrame returns true for the opcodes that carry queries, every other request opcode
+// (STARTUP, OPTIONS, REGISTER, AUTH_RESPONSE, etc.) is a control frame.
+func isDataFrame(opCode primitive.OpCode) bool {
+	switch opCode {
+	case primitive.OpCodeQuery, primitive.OpCodeExecute, primitive.OpCodeBatch, primitive.OpCodePrepare:
+		return true
+	default:
+		return false
+	}
+}
+
+func (recv *frameTypeCounters) track(opCode primitive.OpCode) {
+	if recv == nil {
+		return
+	}
+	if isDataFrame(opCode) {
+		recv.data.Add(1)
+	} else {
+		recv.control.Add(1)
+	}
+}
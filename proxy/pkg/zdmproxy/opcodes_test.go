@@ -0,0 +1,110 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+)
+
+type countingCounter struct {
+	value int64
+}
+
+func (recv *countingCounter) Add(valueToAdd int) {
+	atomic.AddInt64(&recv.value, int64(valueToAdd))
+}
+
+func (recv *countingCounter) get() int64 {
+	return atomic.LoadInt64(&recv.value)
+}
+
+func TestOpCodeDistribution(t *testing.T) {
+	proxyMetrics := newFakeProxyMetrics()
+	query, execute, prepare := &countingCounter{}, &countingCounter{}, &countingCounter{}
+	batch, register, other := &countingCounter{}, &countingCounter{}, &countingCounter{}
+	proxyMetrics.RequestsQuery = query
+	proxyMetrics.RequestsExecute = execute
+	proxyMetrics.RequestsPrepare = prepare
+	proxyMetrics.RequestsBatch = batch
+	proxyMetrics.RequestsRegister = register
+	proxyMetrics.RequestsOther = other
+
+	distribution := newOpCodeDistribution(proxyMetrics)
+
+	mix := map[primitive.OpCode]int{
+		primitive.OpCodeQuery:        5,
+		primitive.OpCodeExecute:      7,
+		primitive.OpCodePrepare:      2,
+		primitive.OpCodeBatch:        3,
+		primitive.OpCodeRegister:     1,
+		primitive.OpCodeStartup:      1,
+		primitive.OpCodeOptions:      2,
+		primitive.OpCodeAuthResponse: 1,
+	}
+	for opCode, count := range mix {
+		for i := 0; i < count; i++ {
+			distribution.track(opCode)
+		}
+	}
+
+	require.Equal(t, int64(5), query.get())
+	require.Equal(t, int64(7), execute.get())
+	require.Equal(t, int64(2), prepare.get())
+	require.Equal(t, int64(3), batch.get())
+	require.Equal(t, int64(1), register.get())
+	require.Equal(t, int64(4), other.get())
+
+	require.Equal(t, map[string]int64{
+		"QUERY":    5,
+		"EXECUTE":  7,
+		"PREPARE":  2,
+		"BATCH":    3,
+		"REGISTER": 1,
+		"OTHER":    4,
+	}, distribution.resetInterval())
+
+	// a new interval starts empty but the running totals are kept
+	distribution.track(primitive.OpCodeQuery)
+	require.Equal(t, map[string]int64{
+		"QUERY":    1,
+		"EXECUTE":  0,
+		"PREPARE":  0,
+		"BATCH":    0,
+		"REGISTER": 0,
+		"OTHER":    0,
+	}, distribution.resetInterval())
+	require.Equal(t, int64(6), query.get())
+}
+
+func TestFrameTypeCounters(t *testing.T) {
+	proxyMetrics := newFakeProxyMetrics()
+	originControl, originData := &countingCounter{}, &countingCounter{}
+	targetControl, targetData := &countingCounter{}, &countingCounter{}
+	proxyMetrics.OriginControlFrames = originControl
+	proxyMetrics.OriginDataFrames = originData
+	proxyMetrics.TargetControlFrames = targetControl
+	proxyMetrics.TargetDataFrames = targetData
+
+	originFrameTypes := newFrameTypeCounters(proxyMetrics, common.ClusterTypeOrigin)
+	targetFrameTypes := newFrameTypeCounters(proxyMetrics, common.ClusterTypeTarget)
+
+	for _, opCode := range []primitive.OpCode{
+		primitive.OpCodeOptions, primitive.OpCodeStartup, primitive.OpCodeAuthResponse, primitive.OpCodeRegister,
+		primitive.OpCodeQuery, primitive.OpCodeExecute, primitive.OpCodeBatch, primitive.OpCodePrepare,
+		primitive.OpCodeQuery,
+	} {
+		originFrameTypes.track(opCode)
+	}
+	targetFrameTypes.track(primitive.OpCodeStartup)
+	targetFrameTypes.track(primitive.OpCodeExecute)
+
+	require.Equal(t, int64(4), originControl.get())
+	require.Equal(t, int64(5), originData.get())
+	require.Equal(t, int64(1), targetControl.get())
+	require.Equal(t, int64(1), targetData.get())
+
+	var disabled *frameTypeCounters
+	disabled.track(primitive.OpCodeQuery)
+}
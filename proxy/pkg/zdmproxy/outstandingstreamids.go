@@ -0,0 +1,142 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"sync"
+	"time"
+)
+
+// outstandingStreamIds tracks the requests that were sent on a cluster connection and that the cluster did not respond
+// to yet so that responses for stream ids that the proxy never sent (or that were already responded to) are dropped
+// instead of being dispatched to a new request that reuses the stream id.
+//
+// Each request is identified by its stream id and a generation that is unique on the connection. A request that timed
+// out is not outstanding anymore but its stream id stays reserved (see expire) because the cluster may still respond
+// to it: the late response can not be told apart from the response of a new request with the same stream id so it is
+// dropped and the stream id can not be reused until then (or until the orphan timeout expires).
+// A nil outstandingStreamIds doesn't track anything and accepts every response.
+type outstandingStreamIds struct {
+	lock           *sync.Mutex
+	requests       map[int16]*outstandingRequest
+	lastGeneration uint64
+	orphanTimeout  time.Duration
+}
+
+type outstandingRequest struct {
+	generation uint64
+	timedOutAt time.Time // zero if the request did not time out
+}
+
+func newOutstandingStreamIds(orphanTimeout time.Duration) *outstandingStreamIds {
+	return &outstandingStreamIds{
+		lock:          &sync.Mutex{},
+		requests:      make(map[int16]*outstandingRequest),
+		orphanTimeout: orphanTimeout,
+	}
+}
+
+// tryAdd returns the generation of the new outstanding request, it returns false if the stream id is still used by
+// another request on this connection. It has to be called before the request is written to the connection, otherwise
+// the response could be received before the stream id is tracked.
+func (recv *outstandingStreamIds) tryAdd(streamId int16) (uint64, bool) {
+	if recv == nil {
+		return 0, true
+	}
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	if request, ok := recv.requests[streamId]; ok {
+		if request.timedOutAt.IsZero() || nowFunc().Sub(request.timedOutAt) < recv.orphanTimeout {
+			return 0, false
+		}
+		// the cluster never responded to the request that timed out, the stream id is released
+	}
+	recv.lastGeneration++
+	recv.requests[streamId] = &outstandingRequest{generation: recv.lastGeneration}
+	return recv.lastGeneration, true
+}
+
+// expire is called when the request of the provided generation timed out, the late response of the cluster
+// (if any) is dropped.
+func (recv *outstandingStreamIds) expire(streamId int16, generation uint64) {
+	if recv == nil {
+		return
+	}
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	if request, ok := recv.requests[streamId]; ok && request.generation == generation && request.timedOutAt.IsZero() {
+		request.timedOutAt = nowFunc()
+	}
+}
+
+// remove returns false if there is no outstanding request with the stream id, i.e. the response has to be dropped.
+func (recv *outstandingStreamIds) remove(streamId int16) bool {
+	if recv == nil {
+		return true
+	}
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	request, ok := recv.requests[streamId]
+	if !ok {
+		return false
+	}
+	delete(recv.requests, streamId)
+	return request.timedOutAt.IsZero()
+}
+
+// reserveStreamIds reserves the stream id of the request on the cluster connections that it is forwarded to, it
+// returns false (and reserves nothing) if the stream id is still used by a request that timed out on one of them.
+func (ch *ClientHandler) reserveStreamIds(reqCtx *requestContextImpl, fwdDecision forwardDecision) bool {
+	streamId := reqCtx.request.Header.StreamId
+	ok := true
+	if fwdDecision == forwardToBoth || fwdDecision == forwardToOrigin {
+		reqCtx.originGeneration, ok = ch.originCassandraConnector.reserveStreamId(streamId)
+		if !ok {
+			return false
+		}
+	}
+	if fwdDecision == forwardToBoth || fwdDecision == forwardToTarget {
+		reqCtx.targetGeneration, ok = ch.targetCassandraConnector.reserveStreamId(streamId)
+		if !ok && fwdDecision == forwardToBoth {
+			ch.originCassandraConnector.outstandingStreamIds.remove(streamId)
+		}
+	}
+	return ok
+}
+
+// expireStreamIds is called once the request timed out, the stream id stays reserved on the cluster connections
+// that did not respond until their late response is received, see outstandingStreamIds.
+func (ch *ClientHandler) expireStreamIds(reqCtx *requestContextImpl) {
+	streamId := reqCtx.request.Header.StreamId
+	fwdDecision := reqCtx.requestInfo.GetForwardDecision()
+	if (fwdDecision == forwardToBoth || fwdDecision == forwardToOrigin) && reqCtx.originResponse == nil {
+		ch.originCassandraConnector.outstandingStreamIds.expire(streamId, reqCtx.originGeneration)
+	}
+	if (fwdDecision == forwardToBoth || fwdDecision == forwardToTarget) && reqCtx.targetResponse == nil {
+		ch.targetCassandraConnector.outstandingStreamIds.expire(streamId, reqCtx.targetGeneration)
+	}
+}
+
+// sendStreamIdInUseResponse answers a request that reuses the stream id of a request that timed out before the
+// cluster responded to it with OVERLOADED so that the client retries it, the request is not forwarded.
+func (ch *ClientHandler) sendStreamIdInUseResponse(
+	frameContext *frameDecodeContext, customResponseChannel chan *customResponse) error {
+	request := frameContext.GetRawFrame()
+	overloadedFrame := frame.NewFrame(request.Header.Version, request.Header.StreamId, &message.Overloaded{
+		ErrorMessage: "The stream id is still used by a request that timed out, please retry.",
+	})
+	overloadedRawFrame, err := ch.codec.get().ConvertToRawFrame(overloadedFrame)
+	if err != nil {
+		return fmt.Errorf("could not convert overloaded response to raw frame: %w", err)
+	}
+	frameContext.logger().Warnf("Rejecting request with stream id %v because a cluster did not respond yet to a "+
+		"previous request with this stream id that timed out.", request.Header.StreamId)
+
+	if customResponseChannel != nil {
+		customResponseChannel <- &customResponse{aggregatedResponse: overloadedRawFrame}
+	} else {
+		ch.clientConnector.sendResponseToClient(overloadedRawFrame)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package zdmproxy
+
+import (
+	"context"
+	"fmt"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// clusterPreflightInfo is what the startup preflight (see ZDM_STARTUP_PREFLIGHT_ENABLED) knows about a cluster.
+type clusterPreflightInfo struct {
+	clusterName           string
+	nativeProtocolVersion string
+	keyspaces             []string
+}
+
+// preflightReport contains the problems that the startup preflight found, errors make the proxy startup fail.
+type preflightReport struct {
+	errors   []string
+	warnings []string
+}
+
+func (recv *preflightReport) addError(format string, args ...interface{}) {
+	recv.errors = append(recv.errors, fmt.Sprintf(format, args...))
+}
+
+func (recv *preflightReport) addWarning(format string, args ...interface{}) {
+	recv.warnings = append(recv.warnings, fmt.Sprintf(format, args...))
+}
+
+func (recv *preflightReport) err() error {
+	if len(recv.errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("startup preflight failed: %v", strings.Join(recv.errors, "; "))
+}
+
+// runStartupPreflight collects the information of both clusters using the control connections and checks that
+// they are compatible, see checkPreflight.
+func runStartupPreflight(
+	ctx context.Context, originControlConn *ControlConn, targetControlConn *ControlConn,
+	keyspaces []string, protocolV5Enabled bool) error {
+	origin, err := getClusterPreflightInfo(ctx, originControlConn)
+	if err != nil {
+		return fmt.Errorf("startup preflight failed: %w", err)
+	}
+
+	target, err := getClusterPreflightInfo(ctx, targetControlConn)
+	if err != nil {
+		return fmt.Errorf("startup preflight failed: %w", err)
+	}
+
+	report := checkPreflight(origin, target, keyspaces, protocolV5Enabled)
+	for _, warning := range report.warnings {
+		log.Warnf("Startup preflight: %v", warning)
+	}
+	for _, e := range report.errors {
+		log.Errorf("Startup preflight: %v", e)
+	}
+	if err = report.err(); err != nil {
+		return err
+	}
+
+	log.Infof("Startup preflight successful: ORIGIN (%v) and TARGET (%v) are reachable and compatible.",
+		origin.clusterName, target.clusterName)
+	return nil
+}
+
+func getClusterPreflightInfo(ctx context.Context, controlConn *ControlConn) (*clusterPreflightInfo, error) {
+	keyspaces, err := controlConn.GetKeyspaceNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nativeProtocolVersion := ""
+	if col, ok := controlConn.GetSystemLocalColumnData()[nativeProtocolVersionColumn.Name]; ok && col.column != nil {
+		if value := col.AsNillableString(); value != nil {
+			nativeProtocolVersion = *value
+		}
+	}
+
+	return &clusterPreflightInfo{
+		clusterName:           controlConn.GetClusterName(),
+		nativeProtocolVersion: nativeProtocolVersion,
+		keyspaces:             keyspaces,
+	}, nil
+}
+
+// checkPreflight compares the clusters: the keyspaces must exist on both clusters and the native protocol versions
+// must be compatible with the proxy configuration. When no keyspaces are provided, the keyspaces that only exist
+// on one of the clusters are reported as warnings.
+func checkPreflight(
+	origin *clusterPreflightInfo, target *clusterPreflightInfo, keyspaces []string, protocolV5Enabled bool) *preflightReport {
+	report := &preflightReport{}
+
+	originVersion, originVersionOk := parseNativeProtocolVersion(origin.nativeProtocolVersion)
+	targetVersion, targetVersionOk := parseNativeProtocolVersion(target.nativeProtocolVersion)
+	if !originVersionOk || !targetVersionOk {
+		report.addWarning("could not compare native protocol versions (ORIGIN: %q, TARGET: %q)",
+			origin.nativeProtocolVersion, target.nativeProtocolVersion)
+	} else {
+		if protocolV5Enabled && originVersion < 5 {
+			report.addError("ZDM_PROTOCOL_V5_ENABLED is set but ORIGIN only supports native protocol v%v", originVersion)
+		}
+		if protocolV5Enabled && targetVersion < 5 {
+			report.addError("ZDM_PROTOCOL_V5_ENABLED is set but TARGET only supports native protocol v%v", targetVersion)
+		}
+		if originVersion != targetVersion {
+			minVersion := originVersion
+			if targetVersion < minVersion {
+				minVersion = targetVersion
+			}
+			report.addWarning("ORIGIN supports native protocol v%v and TARGET supports v%v, "+
+				"clients will be downgraded to v%v", originVersion, targetVersion, minVersion)
+		}
+	}
+
+	originKeyspaces := toKeyspaceSet(origin.keyspaces, false)
+	targetKeyspaces := toKeyspaceSet(target.keyspaces, false)
+	if len(keyspaces) > 0 {
+		for _, keyspace := range keyspaces {
+			var missingOn []string
+			if !originKeyspaces[keyspace] {
+				missingOn = append(missingOn, string(common.ClusterTypeOrigin))
+			}
+			if !targetKeyspaces[keyspace] {
+				missingOn = append(missingOn, string(common.ClusterTypeTarget))
+			}
+			if len(missingOn) > 0 {
+				report.addError("keyspace %v does not exist on %v", keyspace, strings.Join(missingOn, " and "))
+			}
+		}
+		return report
+	}
+
+	originKeyspaces = toKeyspaceSet(origin.keyspaces, true)
+	targetKeyspaces = toKeyspaceSet(target.keyspaces, true)
+	if onlyOrigin := keyspaceDiff(originKeyspaces, targetKeyspaces); len(onlyOrigin) > 0 {
+		report.addWarning("keyspaces that only exist on ORIGIN: %v", onlyOrigin)
+	}
+	if onlyTarget := keyspaceDiff(targetKeyspaces, originKeyspaces); len(onlyTarget) > 0 {
+		report.addWarning("keyspaces that only exist on TARGET: %v", onlyTarget)
+	}
+	return report
+}
+
+// parseNativeProtocolVersion parses the native_protocol_version column of system.local, e.g. "4" or "66/v1".
+func parseNativeProtocolVersion(version string) (int, bool) {
+	digits := strings.TrimSpace(version)
+	for i, c := range digits {
+		if c < '0' || c > '9' {
+			digits = digits[:i]
+			break
+		}
+	}
+	parsed, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0, false
+	}
+	return parsed, true
+}
+
+// toKeyspaceSet returns the keyspaces as a set, optionally without the keyspaces that are internal to the cluster
+// because they usually differ between clusters (e.g. DSE keyspaces).
+func toKeyspaceSet(keyspaces []string, skipInternal bool) map[string]bool {
+	set := make(map[string]bool, len(keyspaces))
+	for _, keyspace := range keyspaces {
+		if skipInternal && (strings.HasPrefix(keyspace, "system") || strings.HasPrefix(keyspace, "dse_")) {
+			continue
+		}
+		set[keyspace] = true
+	}
+	return set
+}
+
+func keyspaceDiff(keyspaces map[string]bool, other map[string]bool) []string {
+	diff := make([]string, 0)
+	for keyspace := range keyspaces {
+		if !other[keyspace] {
+			diff = append(diff, keyspace)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
@@ -0,0 +1,65 @@
+package zdmproxy
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCheckPreflight(t *testing.T) {
+	origin := &clusterPreflightInfo{
+		clusterName:           "origin",
+		nativeProtocolVersion: "4",
+		keyspaces:             []string{"system", "system_auth", "ks1", "ks2", "dse_insights"},
+	}
+	target := &clusterPreflightInfo{
+		clusterName:           "target",
+		nativeProtocolVersion: "4",
+		keyspaces:             []string{"system", "system_auth", "ks1", "ks3"},
+	}
+
+	report := checkPreflight(origin, target, nil, false)
+	require.Nil(t, report.err())
+	require.Equal(t, []string{
+		"keyspaces that only exist on ORIGIN: [ks2]",
+		"keyspaces that only exist on TARGET: [ks3]",
+	}, report.warnings)
+
+	report = checkPreflight(origin, target, []string{"ks1", "ks2", "ks4"}, false)
+	require.Equal(t, []string{
+		"keyspace ks2 does not exist on TARGET",
+		"keyspace ks4 does not exist on ORIGIN and TARGET",
+	}, report.errors)
+	require.Empty(t, report.warnings)
+	require.EqualError(t, report.err(), "startup preflight failed: "+
+		"keyspace ks2 does not exist on TARGET; keyspace ks4 does not exist on ORIGIN and TARGET")
+}
+
+func TestCheckPreflight_ProtocolVersions(t *testing.T) {
+	origin := &clusterPreflightInfo{nativeProtocolVersion: "4"}
+	target := &clusterPreflightInfo{nativeProtocolVersion: "5"}
+
+	report := checkPreflight(origin, target, nil, false)
+	require.Nil(t, report.err())
+	require.Equal(t, []string{"ORIGIN supports native protocol v4 and TARGET supports v5, clients will be downgraded to v4"},
+		report.warnings)
+
+	report = checkPreflight(origin, target, nil, true)
+	require.Equal(t, []string{"ZDM_PROTOCOL_V5_ENABLED is set but ORIGIN only supports native protocol v4"}, report.errors)
+
+	report = checkPreflight(&clusterPreflightInfo{nativeProtocolVersion: "66/v1"}, &clusterPreflightInfo{}, nil, true)
+	require.Nil(t, report.err())
+	require.Equal(t, []string{`could not compare native protocol versions (ORIGIN: "66/v1", TARGET: "")`}, report.warnings)
+}
+
+func TestParseNativeProtocolVersion(t *testing.T) {
+	version, ok := parseNativeProtocolVersion("4")
+	require.True(t, ok)
+	require.Equal(t, 4, version)
+
+	version, ok = parseNativeProtocolVersion("66/v1")
+	require.True(t, ok)
+	require.Equal(t, 66, version)
+
+	_, ok = parseNativeProtocolVersion("")
+	require.False(t, ok)
+}
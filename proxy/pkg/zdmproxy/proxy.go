@@ -5,11 +5,13 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/message"
 	"github.com/datastax/zdm-proxy/proxy/pkg/common"
 	"github.com/datastax/zdm-proxy/proxy/pkg/config"
 	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
 	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
 	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/prommetrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/statsdmetrics"
 	"github.com/jpillora/backoff"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
@@ -32,10 +34,11 @@ type ZdmProxy struct {
 
 	timeUuidGenerator TimeUuidGenerator
 
-	primaryCluster    common.ClusterType
-	readMode          common.ReadMode
 	systemQueriesMode common.SystemQueriesMode
 
+	// structures that are shared by every client handler, they are passed to NewClientHandler as a whole
+	shared *clientHandlerShared
+
 	proxyRand *rand.Rand
 
 	lock *sync.RWMutex
@@ -46,6 +49,22 @@ type ZdmProxy struct {
 	listenerClosed bool
 
 	PreparedStatementCache *PreparedStatementCache
+	psRepreparer           *psRepreparer
+
+	// CredentialsProvider is used to look up the credentials that replace the client credentials during the handshake,
+	// it can be replaced with a custom implementation (e.g. backed by a secret store) before Start is called.
+	CredentialsProvider CredentialsProvider
+
+	// OriginAuthenticatorProvider and TargetAuthenticatorProvider create the authenticators of the handshakes that the
+	// proxy performs with each cluster (control connections, secondary and async handshakes). They can be replaced with
+	// custom implementations (e.g. token or SASL based authentication) before Start is called, PLAIN is used if nil.
+	// The handshake with the primary cluster is still performed by the client.
+	OriginAuthenticatorProvider AuthenticatorProvider
+	TargetAuthenticatorProvider AuthenticatorProvider
+
+	// MismatchReporter receives the details of the requests on which the clusters diverged, it can be replaced with
+	// a custom implementation before Start is called. The requests are only counted if nil.
+	MismatchReporter MismatchReporter
 
 	controlConnShutdownCtx     context.Context
 	controlConnCancelFn        context.CancelFunc
@@ -60,7 +79,15 @@ type ZdmProxy struct {
 	targetBuckets []float64
 	asyncBuckets  []float64
 
-	activeClients int32
+	originErrorRate *metrics.ErrorRateWindow
+	targetErrorRate *metrics.ErrorRateWindow
+
+	originLatency *metrics.LatencyEwma
+	targetLatency *metrics.LatencyEwma
+
+	activeClients   int32
+	clientIpLimiter *clientIpLimiter
+	clientHandlers  *clientHandlerRegistry
 
 	requestResponseNumWorkers int
 	readNumWorkers            int
@@ -161,11 +188,34 @@ func (p *ZdmProxy) Start(ctx context.Context) error {
 	log.Infof("Initialized target control connection. Cluster Name: %v, Hosts: %v, Assigned Hosts: %v.",
 		p.targetControlConn.GetClusterName(), targetHosts, targetAssignedHosts)
 
+	if p.Conf.StartupPreflightEnabled {
+		err = runStartupPreflight(ctx, p.originControlConn, p.targetControlConn,
+			p.Conf.ParseStartupPreflightKeyspaces(), p.Conf.ProtocolV5Enabled)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = p.initializeMetricHandler()
 	if err != nil {
 		return err
 	}
 
+	if p.Conf.MetricsOpcodeLogIntervalMs > 0 {
+		p.shared.opCodeDistribution.runLogLoop(
+			p.clientHandlersShutdownRequestCtx, time.Duration(p.Conf.MetricsOpcodeLogIntervalMs)*time.Millisecond)
+	}
+
+	if fileCredentialsProvider, ok := p.CredentialsProvider.(*FileCredentialsProvider); ok && p.Conf.CredentialsMapReloadIntervalMs > 0 {
+		fileCredentialsProvider.runReloadLoop(
+			p.clientHandlersShutdownRequestCtx, time.Duration(p.Conf.CredentialsMapReloadIntervalMs)*time.Millisecond)
+	}
+
+	p.shared.credentialsProvider = p.CredentialsProvider
+	p.shared.originAuthenticatorProvider = p.OriginAuthenticatorProvider
+	p.shared.targetAuthenticatorProvider = p.TargetAuthenticatorProvider
+	p.shared.mismatchReporter = p.MismatchReporter
+
 	err = p.acceptConnectionsFromClients(p.Conf.ProxyListenAddress, p.Conf.ProxyListenPort, serverSideTlsConfig)
 	if err != nil {
 		return err
@@ -249,7 +299,7 @@ func (p *ZdmProxy) initializeControlConnections(ctx context.Context) error {
 
 	originControlConn := NewControlConn(
 		p.controlConnShutdownCtx, p.Conf.OriginPort, p.originConnectionConfig,
-		p.Conf.OriginUsername, p.Conf.OriginPassword, p.Conf, topologyConfig, p.proxyRand)
+		p.Conf.OriginUsername, p.Conf.OriginPassword, p.OriginAuthenticatorProvider, p.Conf, topologyConfig, p.proxyRand)
 
 	if err := originControlConn.Start(p.controlConnShutdownWg, ctx); err != nil {
 		return fmt.Errorf("failed to initialize origin control connection: %w", err)
@@ -261,7 +311,7 @@ func (p *ZdmProxy) initializeControlConnections(ctx context.Context) error {
 
 	targetControlConn := NewControlConn(
 		p.controlConnShutdownCtx, p.Conf.TargetPort, p.targetConnectionConfig,
-		p.Conf.TargetUsername, p.Conf.TargetPassword, p.Conf, topologyConfig, p.proxyRand)
+		p.Conf.TargetUsername, p.Conf.TargetPassword, p.TargetAuthenticatorProvider, p.Conf, topologyConfig, p.proxyRand)
 
 	if err := targetControlConn.Start(p.controlConnShutdownWg, ctx); err != nil {
 		return fmt.Errorf("failed to initialize target control connection: %w", err)
@@ -278,13 +328,23 @@ func (p *ZdmProxy) initializeMetricHandler() error {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
-	// This is the Prometheus-specific implementation of the MetricFactory object that will be provided to the global MetricHandler object
+	// This is the implementation of the MetricFactory object that will be provided to the global MetricHandler object,
+	// metrics are exposed on the Prometheus endpoint unless a StatsD endpoint is configured.
 	// To switch to a different implementation, change the type instantiated here to another one that implements
 	// metrics.MetricFactory.
 	// You will also need to change the HTTP handler, see runner.go.
 
 	var metricFactory metrics.MetricFactory
-	if p.Conf.MetricsEnabled {
+	if p.Conf.MetricsEnabled && p.Conf.MetricsStatsdAddress != "" {
+		tags, err := p.Conf.ParseMetricsStatsdTags()
+		if err != nil {
+			return err
+		}
+		metricFactory, err = statsdmetrics.NewStatsdMetricFactory(p.Conf.MetricsStatsdAddress, tags, p.Conf.MetricsStatsdSampleRate)
+		if err != nil {
+			return err
+		}
+	} else if p.Conf.MetricsEnabled {
 		metricFactory = prommetrics.NewPrometheusMetricFactory(prometheus.DefaultRegisterer)
 	} else {
 		metricFactory = noopmetrics.NewNoopMetricFactory()
@@ -295,6 +355,14 @@ func (p *ZdmProxy) initializeMetricHandler() error {
 		return err
 	}
 
+	p.shared.opCodeDistribution = newOpCodeDistribution(proxyMetrics)
+	p.shared.handshakeLimiter = newHandshakeLimiter(p.Conf.MaxConcurrentHandshakes,
+		time.Duration(p.Conf.HandshakeQueueTimeoutMs)*time.Millisecond, proxyMetrics.HandshakesInProgress)
+	p.shared.psQuarantine = newPreparedStatementQuarantine(
+		p.Conf.PsQuarantineFailureThreshold, time.Duration(p.Conf.PsQuarantineCooldownMs)*time.Millisecond,
+		p.Conf.TrackingMapMaxEntries, time.Duration(p.Conf.TrackingMapMaxAgeMs)*time.Millisecond,
+		proxyMetrics.TrackingMapEntries, proxyMetrics.TrackingMapEvictions)
+
 	p.metricHandler = metrics.NewMetricHandler(
 		metricFactory, p.originBuckets, p.targetBuckets, p.asyncBuckets, proxyMetrics,
 		p.CreateOriginNodeMetrics, p.CreateTargetNodeMetrics, p.CreateAsyncNodeMetrics)
@@ -311,25 +379,151 @@ func (p *ZdmProxy) initializeGlobalStructures() error {
 
 	maxProcs := runtime.GOMAXPROCS(0)
 
-	var err error
-	p.readMode, err = p.Conf.ParseReadMode()
+	readMode, err := p.Conf.ParseReadMode()
 	if err != nil {
 		return err
 	}
 
-	p.primaryCluster, err = p.Conf.ParsePrimaryCluster()
+	primaryCluster, err := p.Conf.ParsePrimaryCluster()
 	if err != nil {
 		return err
 	}
 
+	p.shared = &clientHandlerShared{}
+	p.shared.cutoverManager = newCutoverManager(&CutoverState{
+		PrimaryCluster: primaryCluster,
+		ReadMode:       readMode,
+	})
+
 	p.systemQueriesMode, err = p.Conf.ParseSystemQueriesMode()
 	if err != nil {
 		return err
 	}
 
+	p.shared.schemaQueriesMode, err = p.Conf.ParseSchemaQueriesMode()
+	if err != nil {
+		return err
+	}
+
+	p.shared.unexpectedResponseMode, err = p.Conf.ParseUnexpectedResponseMode()
+	if err != nil {
+		return err
+	}
+
+	p.shared.eventDeliveryMode, err = p.Conf.ParseEventDeliveryMode()
+	if err != nil {
+		return err
+	}
+
+	p.shared.psCacheMissMode, err = p.Conf.ParsePsCacheMissMode()
+	if err != nil {
+		return err
+	}
+
+	p.shared.schemaVersionMode, err = p.Conf.ParseSchemaVersionMode()
+	if err != nil {
+		return err
+	}
+
+	p.shared.keyspaceAllowlist = newKeyspaceAllowlist(p.Conf.ParseKeyspaceAllowlist())
+
+	originStrippedStartupOptions, err := p.Conf.ParseOriginStartupOptionsStripped()
+	if err != nil {
+		return err
+	}
+	targetStrippedStartupOptions, err := p.Conf.ParseTargetStartupOptionsStripped()
+	if err != nil {
+		return err
+	}
+	if p.Conf.OriginCompressionBridgeEnabled {
+		originStrippedStartupOptions = append(originStrippedStartupOptions, message.StartupOptionCompression)
+	}
+	if p.Conf.TargetCompressionBridgeEnabled {
+		targetStrippedStartupOptions = append(targetStrippedStartupOptions, message.StartupOptionCompression)
+	}
+	p.shared.startupOptionsFilter = newStartupOptionsFilter(originStrippedStartupOptions, targetStrippedStartupOptions)
+
+	largeBatchMode, err := p.Conf.ParseLargeBatchMode()
+	if err != nil {
+		return err
+	}
+	p.shared.batchLimit = newBatchLimit(p.Conf.BatchMaxStatements, p.Conf.BatchMaxSizeBytes, largeBatchMode)
+
+	p.shared.targetAheadMode, err = p.Conf.ParseReadComparisonTargetAheadMode()
+	if err != nil {
+		return err
+	}
+
+	p.shared.metadataMode, err = p.Conf.ParseReadComparisonMetadataMode()
+	if err != nil {
+		return err
+	}
+
+	p.shared.writeConfirmation, err = p.Conf.ParseDualWriteConfirmation()
+	if err != nil {
+		return err
+	}
+
+	p.shared.tracingMode, err = p.Conf.ParseTracingMode()
+	if err != nil {
+		return err
+	}
+
+	p.shared.queryNormalizationLevel, err = p.Conf.ParseQueryNormalizationLevel()
+	if err != nil {
+		return err
+	}
+
+	p.originLatency = metrics.NewLatencyEwma(readRoutingLatencyAlpha)
+	p.targetLatency = metrics.NewLatencyEwma(readRoutingLatencyAlpha)
+	if p.Conf.AdaptiveReadRoutingEnabled {
+		p.shared.readRouter = newAdaptiveReadRouter(
+			p.originLatency, p.targetLatency, p.Conf.AdaptiveReadRoutingHysteresisPercent, primaryCluster)
+	}
+
+	bindValueRoutingRules, err := p.Conf.ParseBindValueRoutingRules()
+	if err != nil {
+		return err
+	}
+	p.shared.bindValueRouter = newBindValueRouter(p.Conf.BindValueRoutingColumn, bindValueRoutingRules)
+
+	keyspaceRoutingRules, err := p.Conf.ParseKeyspaceRoutingRules()
+	if err != nil {
+		return err
+	}
+	p.shared.keyspaceRouter = newKeyspaceRouter(keyspaceRoutingRules)
+
+	keyspaceReadRoutingRules, err := p.Conf.ParseKeyspaceReadRoutingRules()
+	if err != nil {
+		return err
+	}
+	p.shared.keyspaceReadRouter = newKeyspaceRouter(keyspaceReadRoutingRules)
+
+	metricsClientGroups, err := p.Conf.ParseMetricsClientGroups()
+	if err != nil {
+		return err
+	}
+	p.shared.clientGroups = newClientGroups(metricsClientGroups)
+
+	asyncReadsOpCodes, err := p.Conf.ParseAsyncReadsOpcodes()
+	if err != nil {
+		return err
+	}
+	p.shared.asyncReadScope = newAsyncReadScope(asyncReadsOpCodes, p.Conf.AsyncReadsSamplePercent, p.proxyRand)
+	p.shared.connectionMetrics = newConnectionMetricsRegistry()
+	p.shared.supportedCache = newSupportedCache(
+		p.Conf.OptionsCacheEnabled, time.Duration(p.Conf.OptionsCacheRefreshIntervalMs)*time.Millisecond)
+	p.shared.supportedCqlVersions = newSupportedCqlVersions()
+	p.shared.clusterDownBuffer = newClusterDownBuffer(p.Conf)
+	p.shared.injectedLatency = newInjectedLatency(p.Conf)
+	if p.Conf.OriginInjectedLatencyMs > 0 || p.Conf.TargetInjectedLatencyMs > 0 {
+		log.Warnf("Responses are artificially delayed by %v ms (ORIGIN) and %v ms (TARGET), this is only meant for testing.",
+			p.Conf.OriginInjectedLatencyMs, p.Conf.TargetInjectedLatencyMs)
+	}
+
 	defaultReadWorkers := maxProcs * 8
 	defaultWriteWorkers := maxProcs * 4
-	if p.readMode == common.ReadModeDualAsyncOnSecondary {
+	if readMode == common.ReadModeDualAsyncOnSecondary {
 		defaultReadWorkers = maxProcs * 12
 		defaultWriteWorkers = maxProcs * 6
 	}
@@ -381,7 +575,15 @@ func (p *ZdmProxy) initializeGlobalStructures() error {
 	p.globalClientHandlersWg = &sync.WaitGroup{}
 	p.clientHandlersShutdownRequestCtx, p.clientHandlersShutdownRequestCancelFn = context.WithCancel(context.Background())
 
-	p.PreparedStatementCache = NewPreparedStatementCache()
+	p.PreparedStatementCache = NewPreparedStatementCache(p.Conf.PsCacheMaxMetadataColumns)
+	p.psRepreparer = newPsRepreparer(p.PreparedStatementCache, p.Conf.PsReprepareStatementsPerSecond)
+
+	if p.Conf.CredentialsMapFile != "" {
+		p.CredentialsProvider, err = NewFileCredentialsProvider(p.Conf.CredentialsMapFile)
+		if err != nil {
+			return fmt.Errorf("failed to initialize credentials provider: %w", err)
+		}
+	}
 
 	p.controlConnShutdownCtx, p.controlConnCancelFn = context.WithCancel(context.Background())
 	p.controlConnShutdownWg = &sync.WaitGroup{}
@@ -410,6 +612,8 @@ func (p *ZdmProxy) initializeGlobalStructures() error {
 	}
 
 	p.activeClients = 0
+	p.clientIpLimiter = newClientIpLimiter(p.Conf.ProxyMaxClientConnectionsPerIp)
+	p.clientHandlers = newClientHandlerRegistry()
 	return nil
 }
 
@@ -420,14 +624,9 @@ func (p *ZdmProxy) acceptConnectionsFromClients(address string, port int, server
 	protocol := "tcp"
 	listenAddr := fmt.Sprintf("%s:%d", address, port)
 
-	var l net.Listener
-	var err error
-	if serverSideTlsConfig == nil {
-		l, err = net.Listen(protocol, listenAddr)
-	} else {
-		l, err = tls.Listen(protocol, listenAddr, serverSideTlsConfig)
-	}
-
+	// the TLS server side of each connection is created after accepting it (instead of using tls.Listen)
+	// so that socket options can be applied to the underlying TCP connection
+	l, err := net.Listen(protocol, listenAddr)
 	if err != nil {
 		return err
 	}
@@ -450,6 +649,7 @@ func (p *ZdmProxy) acceptConnectionsFromClients(address string, port int, server
 		}()
 		wg := &sync.WaitGroup{}
 		defer wg.Wait()
+		clientSocketOptions := newClientSocketOptions(p.Conf)
 		for {
 			conn, err := l.Accept()
 			if err != nil {
@@ -471,13 +671,27 @@ func (p *ZdmProxy) acceptConnectionsFromClients(address string, port int, server
 				log.Warnf(
 					"Refusing client connection from %v because max clients threshold has been hit (%v).",
 					conn.RemoteAddr(), p.Conf.ProxyMaxClientConnections)
-				err = conn.Close()
-				if err != nil {
-					log.Warnf("Error closing client connection from %v: %v", conn.RemoteAddr(), err)
-				}
+				p.rejectClientConnection(conn)
+				continue
+			}
+
+			if !p.clientIpLimiter.acquire(getClientIp(conn.RemoteAddr())) {
+				log.Warnf(
+					"Refusing client connection from %v because max clients threshold per IP has been hit (%v).",
+					conn.RemoteAddr(), p.Conf.ProxyMaxClientConnectionsPerIp)
+				p.rejectClientConnection(conn)
 				continue
 			}
 
+			err = applySocketOptions(conn, clientSocketOptions)
+			if err != nil {
+				log.Warnf("Could not apply socket options to client connection from %v: %v", conn.RemoteAddr(), err)
+			}
+
+			if serverSideTlsConfig != nil {
+				conn = tls.Server(conn, serverSideTlsConfig)
+			}
+
 			atomic.AddInt32(&p.activeClients, 1)
 			log.Infof("Accepted connection from %v", conn.RemoteAddr())
 
@@ -492,13 +706,27 @@ func (p *ZdmProxy) acceptConnectionsFromClients(address string, port int, server
 	return nil
 }
 
+func (p *ZdmProxy) rejectClientConnection(conn net.Conn) {
+	p.metricHandler.GetProxyMetrics().RejectedClientConnections.Add(1)
+	err := conn.Close()
+	if err != nil {
+		log.Warnf("Error closing client connection from %v: %v", conn.RemoteAddr(), err)
+	}
+}
+
 // handleNewConnection creates the client handler and connectors for the new client connection
 func (p *ZdmProxy) handleNewConnection(clientConn net.Conn) {
 
+	clientIp := getClientIp(clientConn.RemoteAddr())
+	releaseClient := func() {
+		atomic.AddInt32(&p.activeClients, -1)
+		p.clientIpLimiter.release(clientIp)
+	}
+
 	errFunc := func(e error) {
 		log.Errorf("Client Handler could not be created: %v", e)
 		clientConn.Close()
-		atomic.AddInt32(&p.activeClients, -1)
+		releaseClient()
 	}
 
 	// there is a ClientHandler for each connection made by a client
@@ -542,6 +770,7 @@ func (p *ZdmProxy) handleNewConnection(clientConn net.Conn) {
 
 	originCassandraConnInfo := NewClusterConnectionInfo(p.originConnectionConfig, originEndpoint, true)
 	targetCassandraConnInfo := NewClusterConnectionInfo(p.targetConnectionConfig, targetEndpoint, false)
+	cutoverState := p.GetCutoverState()
 	clientHandler, err := NewClientHandler(
 		clientConn,
 		originCassandraConnInfo,
@@ -565,9 +794,10 @@ func (p *ZdmProxy) handleNewConnection(clientConn net.Conn) {
 		originHost,
 		targetHost,
 		p.timeUuidGenerator,
-		p.readMode,
-		p.primaryCluster,
-		p.systemQueriesMode)
+		cutoverState.ReadMode,
+		cutoverState.PrimaryCluster,
+		p.systemQueriesMode,
+		p.shared)
 
 	if err != nil {
 		errFunc(err)
@@ -575,7 +805,11 @@ func (p *ZdmProxy) handleNewConnection(clientConn net.Conn) {
 	}
 
 	log.Tracef("ClientHandler created")
-	clientHandler.run(&p.activeClients)
+	p.clientHandlers.register(clientHandler)
+	clientHandler.run(func() {
+		p.clientHandlers.unregister(clientHandler)
+		releaseClient()
+	})
 }
 
 func (p *ZdmProxy) Shutdown() {
@@ -712,6 +946,26 @@ func (p *ZdmProxy) CreateProxyMetrics(metricFactory metrics.MetricFactory) (*met
 		return nil, err
 	}
 
+	toleratedAlreadyExistsOrigin, err := metricFactory.GetOrCreateCounter(metrics.ToleratedAlreadyExistsOrigin)
+	if err != nil {
+		return nil, err
+	}
+
+	toleratedAlreadyExistsTarget, err := metricFactory.GetOrCreateCounter(metrics.ToleratedAlreadyExistsTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	backendProtocolErrorsOrigin, err := metricFactory.GetOrCreateCounter(metrics.BackendProtocolErrorsOrigin)
+	if err != nil {
+		return nil, err
+	}
+
+	backendProtocolErrorsTarget, err := metricFactory.GetOrCreateCounter(metrics.BackendProtocolErrorsTarget)
+	if err != nil {
+		return nil, err
+	}
+
 	psCacheSize, err := metricFactory.GetOrCreateGaugeFunc(metrics.PSCacheSize, p.PreparedStatementCache.GetPreparedStatementCacheSize)
 	if err != nil {
 		return nil, err
@@ -737,6 +991,21 @@ func (p *ZdmProxy) CreateProxyMetrics(metricFactory metrics.MetricFactory) (*met
 		return nil, err
 	}
 
+	sloBreachesReadsOrigin, err := metricFactory.GetOrCreateCounter(metrics.SloBreachesReadsOrigin)
+	if err != nil {
+		return nil, err
+	}
+
+	sloBreachesReadsTarget, err := metricFactory.GetOrCreateCounter(metrics.SloBreachesReadsTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	sloBreachesWrites, err := metricFactory.GetOrCreateCounter(metrics.SloBreachesWrites)
+	if err != nil {
+		return nil, err
+	}
+
 	inFlightReadsOrigin, err := metricFactory.GetOrCreateGauge(metrics.InFlightReadsOrigin)
 	if err != nil {
 		return nil, err
@@ -759,21 +1028,463 @@ func (p *ZdmProxy) CreateProxyMetrics(metricFactory metrics.MetricFactory) (*met
 		return nil, err
 	}
 
+	clientConnectionsV2, err := metricFactory.GetOrCreateGauge(metrics.ClientConnectionsV2)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConnectionsV3, err := metricFactory.GetOrCreateGauge(metrics.ClientConnectionsV3)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConnectionsV4, err := metricFactory.GetOrCreateGauge(metrics.ClientConnectionsV4)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConnectionsV5, err := metricFactory.GetOrCreateGauge(metrics.ClientConnectionsV5)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConnectionsDseV1, err := metricFactory.GetOrCreateGauge(metrics.ClientConnectionsDseV1)
+	if err != nil {
+		return nil, err
+	}
+
+	clientConnectionsDseV2, err := metricFactory.GetOrCreateGauge(metrics.ClientConnectionsDseV2)
+	if err != nil {
+		return nil, err
+	}
+
+	cutovers, err := metricFactory.GetOrCreateCounter(metrics.Cutovers)
+	if err != nil {
+		return nil, err
+	}
+
+	lastCutoverTimestamp, err := metricFactory.GetOrCreateGaugeFunc(
+		metrics.LastCutoverTimestamp, p.shared.cutoverManager.getLastCutoverTimestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoverClientEvents, err := metricFactory.GetOrCreateCounter(metrics.CutoverClientEvents)
+	if err != nil {
+		return nil, err
+	}
+
+	droppedLateResponses, err := metricFactory.GetOrCreateCounter(metrics.DroppedLateResponses)
+	if err != nil {
+		return nil, err
+	}
+
+	unknownStreamIdResponses, err := metricFactory.GetOrCreateCounter(metrics.UnknownStreamIdResponses)
+	if err != nil {
+		return nil, err
+	}
+
+	clientHandshakeTimeouts, err := metricFactory.GetOrCreateCounter(metrics.ClientHandshakeTimeouts)
+	if err != nil {
+		return nil, err
+	}
+
+	clientAuthIdleTimeouts, err := metricFactory.GetOrCreateCounter(metrics.ClientAuthIdleTimeouts)
+	if err != nil {
+		return nil, err
+	}
+
+	abortedHandshakes, err := metricFactory.GetOrCreateCounter(metrics.AbortedHandshakes)
+	if err != nil {
+		return nil, err
+	}
+
+	unregisteredEvents, err := metricFactory.GetOrCreateCounter(metrics.UnregisteredEvents)
+	if err != nil {
+		return nil, err
+	}
+
+	unexpectedResponses, err := metricFactory.GetOrCreateCounter(metrics.UnexpectedResponses)
+	if err != nil {
+		return nil, err
+	}
+
+	unknownForwardDecisions, err := metricFactory.GetOrCreateCounter(metrics.UnknownForwardDecisions)
+	if err != nil {
+		return nil, err
+	}
+
+	rejectedClientConnections, err := metricFactory.GetOrCreateCounter(metrics.RejectedClientConnections)
+	if err != nil {
+		return nil, err
+	}
+
+	rejectedKeyspaceRequests, err := metricFactory.GetOrCreateCounter(metrics.RejectedKeyspaceRequests)
+	if err != nil {
+		return nil, err
+	}
+
+	malformedFrames, err := metricFactory.GetOrCreateCounter(metrics.MalformedFrames)
+	if err != nil {
+		return nil, err
+	}
+
+	wrongDirectionFrames, err := metricFactory.GetOrCreateCounter(metrics.WrongDirectionFrames)
+	if err != nil {
+		return nil, err
+	}
+
+	droppedEvents, err := metricFactory.GetOrCreateCounter(metrics.DroppedEvents)
+	if err != nil {
+		return nil, err
+	}
+
+	droppedEventsOnShutdown, err := metricFactory.GetOrCreateCounter(metrics.DroppedEventsOnShutdown)
+	if err != nil {
+		return nil, err
+	}
+
+	likelyRetries, err := metricFactory.GetOrCreateCounter(metrics.LikelyRetries)
+	if err != nil {
+		return nil, err
+	}
+
+	asyncReadsMaxWaitExceeded, err := metricFactory.GetOrCreateCounter(metrics.AsyncReadsMaxWaitExceeded)
+	if err != nil {
+		return nil, err
+	}
+
+	targetUnpreparedWriteRetries, err := metricFactory.GetOrCreateCounter(metrics.TargetUnpreparedWriteRetries)
+	if err != nil {
+		return nil, err
+	}
+
+	readFailovers, err := metricFactory.GetOrCreateCounter(metrics.ReadFailovers)
+	if err != nil {
+		return nil, err
+	}
+
+	readRacesWonBySecondary, err := metricFactory.GetOrCreateCounter(metrics.ReadRacesWonBySecondary)
+	if err != nil {
+		return nil, err
+	}
+
+	mismatchReports, err := metricFactory.GetOrCreateCounter(metrics.MismatchReports)
+	if err != nil {
+		return nil, err
+	}
+
+	readMismatchesTargetExtraRows, err := metricFactory.GetOrCreateCounter(metrics.ReadMismatchesTargetExtraRows)
+	if err != nil {
+		return nil, err
+	}
+
+	readMismatchesOriginExtraRows, err := metricFactory.GetOrCreateCounter(metrics.ReadMismatchesOriginExtraRows)
+	if err != nil {
+		return nil, err
+	}
+
+	readMismatchesValuesDiffer, err := metricFactory.GetOrCreateCounter(metrics.ReadMismatchesValuesDiffer)
+	if err != nil {
+		return nil, err
+	}
+
+	readMismatchesMetadataOnly, err := metricFactory.GetOrCreateCounter(metrics.ReadMismatchesMetadataOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	unloggedBatchPartialDivergences, err := metricFactory.GetOrCreateCounter(metrics.UnloggedBatchPartialDivergences)
+	if err != nil {
+		return nil, err
+	}
+
+	batchWarningDivergences, err := metricFactory.GetOrCreateCounter(metrics.BatchWarningDivergences)
+	if err != nil {
+		return nil, err
+	}
+
+	quarantinedPreparedStatements, err := metricFactory.GetOrCreateCounter(metrics.QuarantinedPreparedStatements)
+	if err != nil {
+		return nil, err
+	}
+
+	largeBatches, err := metricFactory.GetOrCreateCounter(metrics.LargeBatches)
+	if err != nil {
+		return nil, err
+	}
+
+	largeResponses, err := metricFactory.GetOrCreateCounter(metrics.LargeResponses)
+	if err != nil {
+		return nil, err
+	}
+
+	rejectedRegisterRequests, err := metricFactory.GetOrCreateCounter(metrics.RejectedRegisterRequests)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterDownBufferedRequests, err := metricFactory.GetOrCreateCounter(metrics.ClusterDownBufferedRequests)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterDownRejectedRequests, err := metricFactory.GetOrCreateCounter(metrics.ClusterDownRejectedRequests)
+	if err != nil {
+		return nil, err
+	}
+
+	cqlVersionMismatches, err := metricFactory.GetOrCreateCounter(metrics.CqlVersionMismatches)
+	if err != nil {
+		return nil, err
+	}
+
+	handshakesInProgress, err := metricFactory.GetOrCreateGauge(metrics.HandshakesInProgress)
+	if err != nil {
+		return nil, err
+	}
+
+	trackingMapEntries, err := metricFactory.GetOrCreateGauge(metrics.TrackingMapEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	trackingMapEvictions, err := metricFactory.GetOrCreateCounter(metrics.TrackingMapEvictions)
+	if err != nil {
+		return nil, err
+	}
+
+	errorRateWindow := time.Duration(p.Conf.MetricsErrorRateWindowMs) * time.Millisecond
+	p.originErrorRate = metrics.NewErrorRateWindow(errorRateWindow)
+	p.targetErrorRate = metrics.NewErrorRateWindow(errorRateWindow)
+	p.shared.dualWriteDisagreements = metrics.NewErrorRateWindow(
+		time.Duration(p.Conf.MetricsDualWriteAgreementWindowMs) * time.Millisecond)
+	p.shared.tableDivergence = newBoundedLabelSet(p.Conf.MetricsTableDivergenceMaxTables)
+	p.shared.psCacheExecutes = newPsCacheExecuteTracker(p.Conf.MetricsPsCacheMaxKeyspaces)
+	p.shared.unknownErrorCodes = newBoundedLabelSet(maxUnknownErrorCodeLabels)
+
+	goroutines, err := metricFactory.GetOrCreateGaugeFunc(metrics.Goroutines, func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientHandlers, err := metricFactory.GetOrCreateGaugeFunc(metrics.ClientHandlers, p.clientHandlers.getHandlerCount)
+	if err != nil {
+		return nil, err
+	}
+
+	clientHandlerInFlightGoroutines, err := metricFactory.GetOrCreateGaugeFunc(
+		metrics.ClientHandlerInFlightGoroutines, p.clientHandlers.getInFlightGoroutines)
+	if err != nil {
+		return nil, err
+	}
+
+	clientHandlerMaxInFlightGoroutines, err := metricFactory.GetOrCreateGaugeFunc(
+		metrics.ClientHandlerMaxInFlightGoroutines, p.clientHandlers.getMaxInFlightGoroutines)
+	if err != nil {
+		return nil, err
+	}
+
+	requestQueueDepth, err := metricFactory.GetOrCreateGaugeFunc(
+		metrics.RequestQueueDepth, p.clientHandlers.getRequestQueueDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	responseQueueDepth, err := metricFactory.GetOrCreateGaugeFunc(
+		metrics.ResponseQueueDepth, p.clientHandlers.getResponseQueueDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	eventQueueDepth, err := metricFactory.GetOrCreateGaugeFunc(
+		metrics.EventQueueDepth, p.clientHandlers.getEventQueueDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	originRequestErrorRate, err := metricFactory.GetOrCreateGaugeFunc(metrics.OriginRequestErrorRate, p.originErrorRate.Rate)
+	if err != nil {
+		return nil, err
+	}
+
+	targetRequestErrorRate, err := metricFactory.GetOrCreateGaugeFunc(metrics.TargetRequestErrorRate, p.targetErrorRate.Rate)
+	if err != nil {
+		return nil, err
+	}
+
+	readRoutingBias, err := metricFactory.GetOrCreateGaugeFunc(metrics.ReadRoutingBias, p.shared.readRouter.getBias)
+	if err != nil {
+		return nil, err
+	}
+
+	originControlConnectionsEstablished, err := metricFactory.GetOrCreateGaugeFunc(
+		metrics.OriginControlConnectionsEstablished, p.originControlConn.GetEstablishedConnectionCount)
+	if err != nil {
+		return nil, err
+	}
+
+	targetControlConnectionsEstablished, err := metricFactory.GetOrCreateGaugeFunc(
+		metrics.TargetControlConnectionsEstablished, p.targetControlConn.GetEstablishedConnectionCount)
+	if err != nil {
+		return nil, err
+	}
+
+	originControlConnectionAge, err := metricFactory.GetOrCreateGaugeFunc(
+		metrics.OriginControlConnectionAge, p.originControlConn.GetConnectionAgeSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	targetControlConnectionAge, err := metricFactory.GetOrCreateGaugeFunc(
+		metrics.TargetControlConnectionAge, p.targetControlConn.GetConnectionAgeSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	requestsQuery, err := metricFactory.GetOrCreateCounter(metrics.RequestsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	requestsExecute, err := metricFactory.GetOrCreateCounter(metrics.RequestsExecute)
+	if err != nil {
+		return nil, err
+	}
+
+	requestsPrepare, err := metricFactory.GetOrCreateCounter(metrics.RequestsPrepare)
+	if err != nil {
+		return nil, err
+	}
+
+	requestsBatch, err := metricFactory.GetOrCreateCounter(metrics.RequestsBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	requestsRegister, err := metricFactory.GetOrCreateCounter(metrics.RequestsRegister)
+	if err != nil {
+		return nil, err
+	}
+
+	requestsOther, err := metricFactory.GetOrCreateCounter(metrics.RequestsOther)
+	if err != nil {
+		return nil, err
+	}
+
+	originControlFrames, err := metricFactory.GetOrCreateCounter(metrics.OriginControlFrames)
+	if err != nil {
+		return nil, err
+	}
+
+	originDataFrames, err := metricFactory.GetOrCreateCounter(metrics.OriginDataFrames)
+	if err != nil {
+		return nil, err
+	}
+
+	targetControlFrames, err := metricFactory.GetOrCreateCounter(metrics.TargetControlFrames)
+	if err != nil {
+		return nil, err
+	}
+
+	targetDataFrames, err := metricFactory.GetOrCreateCounter(metrics.TargetDataFrames)
+	if err != nil {
+		return nil, err
+	}
+
 	proxyMetrics := &metrics.ProxyMetrics{
-		FailedReadsOrigin:        failedReadsOrigin,
-		FailedReadsTarget:        failedReadsTarget,
-		FailedWritesOnOrigin:     failedWritesOnOrigin,
-		FailedWritesOnTarget:     failedWritesOnTarget,
-		FailedWritesOnBoth:       failedWritesOnBoth,
-		PSCacheSize:              psCacheSize,
-		PSCacheMissCount:         psCacheMissCount,
-		ProxyReadsOriginDuration: proxyReadsOriginDuration,
-		ProxyReadsTargetDuration: proxyReadsTargetDuration,
-		ProxyWritesDuration:      proxyWritesDuration,
-		InFlightReadsOrigin:      inFlightReadsOrigin,
-		InFlightReadsTarget:      inFlightReadsTarget,
-		InFlightWrites:           inFlightWrites,
-		OpenClientConnections:    openClientConnections,
+		FailedReadsOrigin:                   failedReadsOrigin,
+		FailedReadsTarget:                   failedReadsTarget,
+		FailedWritesOnOrigin:                failedWritesOnOrigin,
+		FailedWritesOnTarget:                failedWritesOnTarget,
+		FailedWritesOnBoth:                  failedWritesOnBoth,
+		ToleratedAlreadyExistsOrigin:        toleratedAlreadyExistsOrigin,
+		ToleratedAlreadyExistsTarget:        toleratedAlreadyExistsTarget,
+		BackendProtocolErrorsOrigin:         backendProtocolErrorsOrigin,
+		BackendProtocolErrorsTarget:         backendProtocolErrorsTarget,
+		PSCacheSize:                         psCacheSize,
+		PSCacheMissCount:                    psCacheMissCount,
+		ProxyReadsOriginDuration:            proxyReadsOriginDuration,
+		ProxyReadsTargetDuration:            proxyReadsTargetDuration,
+		ProxyWritesDuration:                 proxyWritesDuration,
+		SloBreachesReadsOrigin:              sloBreachesReadsOrigin,
+		SloBreachesReadsTarget:              sloBreachesReadsTarget,
+		SloBreachesWrites:                   sloBreachesWrites,
+		InFlightReadsOrigin:                 inFlightReadsOrigin,
+		InFlightReadsTarget:                 inFlightReadsTarget,
+		InFlightWrites:                      inFlightWrites,
+		OpenClientConnections:               openClientConnections,
+		ClientConnectionsV2:                 clientConnectionsV2,
+		ClientConnectionsV3:                 clientConnectionsV3,
+		ClientConnectionsV4:                 clientConnectionsV4,
+		ClientConnectionsV5:                 clientConnectionsV5,
+		ClientConnectionsDseV1:              clientConnectionsDseV1,
+		ClientConnectionsDseV2:              clientConnectionsDseV2,
+		Cutovers:                            cutovers,
+		LastCutoverTimestamp:                lastCutoverTimestamp,
+		CutoverClientEvents:                 cutoverClientEvents,
+		DroppedLateResponses:                droppedLateResponses,
+		UnknownStreamIdResponses:            unknownStreamIdResponses,
+		UnregisteredEvents:                  unregisteredEvents,
+		ClientHandshakeTimeouts:             clientHandshakeTimeouts,
+		ClientAuthIdleTimeouts:              clientAuthIdleTimeouts,
+		AbortedHandshakes:                   abortedHandshakes,
+		UnexpectedResponses:                 unexpectedResponses,
+		UnknownForwardDecisions:             unknownForwardDecisions,
+		RejectedClientConnections:           rejectedClientConnections,
+		RejectedKeyspaceRequests:            rejectedKeyspaceRequests,
+		MalformedFrames:                     malformedFrames,
+		WrongDirectionFrames:                wrongDirectionFrames,
+		DroppedEvents:                       droppedEvents,
+		DroppedEventsOnShutdown:             droppedEventsOnShutdown,
+		LikelyRetries:                       likelyRetries,
+		AsyncReadsMaxWaitExceeded:           asyncReadsMaxWaitExceeded,
+		TargetUnpreparedWriteRetries:        targetUnpreparedWriteRetries,
+		ReadFailovers:                       readFailovers,
+		ReadRacesWonBySecondary:             readRacesWonBySecondary,
+		ReadMismatchesTargetExtraRows:       readMismatchesTargetExtraRows,
+		ReadMismatchesOriginExtraRows:       readMismatchesOriginExtraRows,
+		ReadMismatchesValuesDiffer:          readMismatchesValuesDiffer,
+		ReadMismatchesMetadataOnly:          readMismatchesMetadataOnly,
+		MismatchReports:                     mismatchReports,
+		UnloggedBatchPartialDivergences:     unloggedBatchPartialDivergences,
+		BatchWarningDivergences:             batchWarningDivergences,
+		QuarantinedPreparedStatements:       quarantinedPreparedStatements,
+		LargeBatches:                        largeBatches,
+		LargeResponses:                      largeResponses,
+		RejectedRegisterRequests:            rejectedRegisterRequests,
+		ClusterDownBufferedRequests:         clusterDownBufferedRequests,
+		ClusterDownRejectedRequests:         clusterDownRejectedRequests,
+		CqlVersionMismatches:                cqlVersionMismatches,
+		HandshakesInProgress:                handshakesInProgress,
+		Goroutines:                          goroutines,
+		ClientHandlers:                      clientHandlers,
+		ClientHandlerInFlightGoroutines:     clientHandlerInFlightGoroutines,
+		ClientHandlerMaxInFlightGoroutines:  clientHandlerMaxInFlightGoroutines,
+		RequestQueueDepth:                   requestQueueDepth,
+		ResponseQueueDepth:                  responseQueueDepth,
+		EventQueueDepth:                     eventQueueDepth,
+		TrackingMapEntries:                  trackingMapEntries,
+		TrackingMapEvictions:                trackingMapEvictions,
+		OriginRequestErrorRate:              originRequestErrorRate,
+		TargetRequestErrorRate:              targetRequestErrorRate,
+		ReadRoutingBias:                     readRoutingBias,
+		OriginControlConnectionsEstablished: originControlConnectionsEstablished,
+		TargetControlConnectionsEstablished: targetControlConnectionsEstablished,
+		OriginControlConnectionAge:          originControlConnectionAge,
+		TargetControlConnectionAge:          targetControlConnectionAge,
+		RequestsQuery:                       requestsQuery,
+		RequestsExecute:                     requestsExecute,
+		RequestsPrepare:                     requestsPrepare,
+		RequestsBatch:                       requestsBatch,
+		RequestsRegister:                    requestsRegister,
+		RequestsOther:                       requestsOther,
+		OriginControlFrames:                 originControlFrames,
+		OriginDataFrames:                    originDataFrames,
+		TargetControlFrames:                 targetControlFrames,
+		TargetDataFrames:                    targetDataFrames,
 	}
 
 	return proxyMetrics, nil
@@ -821,6 +1532,21 @@ func (p *ZdmProxy) CreateOriginNodeMetrics(
 		return nil, err
 	}
 
+	originUnauthorizedErrors, err := metrics.CreateCounterNodeMetric(metricFactory, originNodeDescription, metrics.OriginUnauthorizedErrors)
+	if err != nil {
+		return nil, err
+	}
+
+	originTruncateErrors, err := metrics.CreateCounterNodeMetric(metricFactory, originNodeDescription, metrics.OriginTruncateErrors)
+	if err != nil {
+		return nil, err
+	}
+
+	originFunctionFailures, err := metrics.CreateCounterNodeMetric(metricFactory, originNodeDescription, metrics.OriginFunctionFailures)
+	if err != nil {
+		return nil, err
+	}
+
 	originOtherErrors, err := metrics.CreateCounterNodeMetric(metricFactory, originNodeDescription, metrics.OriginOtherErrors)
 	if err != nil {
 		return nil, err
@@ -843,18 +1569,23 @@ func (p *ZdmProxy) CreateOriginNodeMetrics(
 	}
 
 	return &metrics.NodeMetricsInstance{
-		ClientTimeouts:    originClientTimeouts,
-		ReadTimeouts:      originReadTimeouts,
-		ReadFailures:      originReadFailures,
-		WriteTimeouts:     originWriteTimeouts,
-		WriteFailures:     originWriteFailures,
-		UnpreparedErrors:  originUnpreparedErrors,
-		OverloadedErrors:  originOverloadedErrors,
-		UnavailableErrors: originUnavailableErrors,
-		OtherErrors:       originOtherErrors,
-		RequestDuration:   originRequestDuration,
-		OpenConnections:   openOriginConnections,
-		InFlightRequests:  inflightRequests,
+		ClientTimeouts:     originClientTimeouts,
+		ReadTimeouts:       originReadTimeouts,
+		ReadFailures:       originReadFailures,
+		WriteTimeouts:      originWriteTimeouts,
+		WriteFailures:      originWriteFailures,
+		UnpreparedErrors:   originUnpreparedErrors,
+		OverloadedErrors:   originOverloadedErrors,
+		UnavailableErrors:  originUnavailableErrors,
+		UnauthorizedErrors: originUnauthorizedErrors,
+		TruncateErrors:     originTruncateErrors,
+		FunctionFailures:   originFunctionFailures,
+		OtherErrors:        originOtherErrors,
+		RequestDuration:    originRequestDuration,
+		OpenConnections:    openOriginConnections,
+		InFlightRequests:   inflightRequests,
+		ErrorRate:          p.originErrorRate,
+		Latency:            p.originLatency,
 	}, nil
 }
 
@@ -900,6 +1631,21 @@ func (p *ZdmProxy) CreateAsyncNodeMetrics(
 		return nil, err
 	}
 
+	asyncUnauthorizedErrors, err := metrics.CreateCounterNodeMetric(metricFactory, asyncNodeDescription, metrics.AsyncUnauthorizedErrors)
+	if err != nil {
+		return nil, err
+	}
+
+	asyncTruncateErrors, err := metrics.CreateCounterNodeMetric(metricFactory, asyncNodeDescription, metrics.AsyncTruncateErrors)
+	if err != nil {
+		return nil, err
+	}
+
+	asyncFunctionFailures, err := metrics.CreateCounterNodeMetric(metricFactory, asyncNodeDescription, metrics.AsyncFunctionFailures)
+	if err != nil {
+		return nil, err
+	}
+
 	asyncOtherErrors, err := metrics.CreateCounterNodeMetric(metricFactory, asyncNodeDescription, metrics.AsyncOtherErrors)
 	if err != nil {
 		return nil, err
@@ -921,18 +1667,21 @@ func (p *ZdmProxy) CreateAsyncNodeMetrics(
 	}
 
 	return &metrics.NodeMetricsInstance{
-		ClientTimeouts:    asyncClientTimeouts,
-		ReadTimeouts:      asyncReadTimeouts,
-		ReadFailures:      asyncReadFailures,
-		WriteTimeouts:     asyncWriteTimeouts,
-		WriteFailures:     asyncWriteFailures,
-		UnpreparedErrors:  asyncUnpreparedErrors,
-		OverloadedErrors:  asyncOverloadedErrors,
-		UnavailableErrors: asyncUnavailableErrors,
-		OtherErrors:       asyncOtherErrors,
-		RequestDuration:   asyncRequestDuration,
-		OpenConnections:   openAsyncConnections,
-		InFlightRequests:  inflightRequestsAsync,
+		ClientTimeouts:     asyncClientTimeouts,
+		ReadTimeouts:       asyncReadTimeouts,
+		ReadFailures:       asyncReadFailures,
+		WriteTimeouts:      asyncWriteTimeouts,
+		WriteFailures:      asyncWriteFailures,
+		UnpreparedErrors:   asyncUnpreparedErrors,
+		OverloadedErrors:   asyncOverloadedErrors,
+		UnavailableErrors:  asyncUnavailableErrors,
+		UnauthorizedErrors: asyncUnauthorizedErrors,
+		TruncateErrors:     asyncTruncateErrors,
+		FunctionFailures:   asyncFunctionFailures,
+		OtherErrors:        asyncOtherErrors,
+		RequestDuration:    asyncRequestDuration,
+		OpenConnections:    openAsyncConnections,
+		InFlightRequests:   inflightRequestsAsync,
 	}, nil
 }
 
@@ -978,6 +1727,21 @@ func (p *ZdmProxy) CreateTargetNodeMetrics(
 		return nil, err
 	}
 
+	targetUnauthorizedErrors, err := metrics.CreateCounterNodeMetric(metricFactory, targetNodeDescription, metrics.TargetUnauthorizedErrors)
+	if err != nil {
+		return nil, err
+	}
+
+	targetTruncateErrors, err := metrics.CreateCounterNodeMetric(metricFactory, targetNodeDescription, metrics.TargetTruncateErrors)
+	if err != nil {
+		return nil, err
+	}
+
+	targetFunctionFailures, err := metrics.CreateCounterNodeMetric(metricFactory, targetNodeDescription, metrics.TargetFunctionFailures)
+	if err != nil {
+		return nil, err
+	}
+
 	targetOtherErrors, err := metrics.CreateCounterNodeMetric(metricFactory, targetNodeDescription, metrics.TargetOtherErrors)
 	if err != nil {
 		return nil, err
@@ -1000,17 +1764,22 @@ func (p *ZdmProxy) CreateTargetNodeMetrics(
 	}
 
 	return &metrics.NodeMetricsInstance{
-		ClientTimeouts:    targetClientTimeouts,
-		ReadTimeouts:      targetReadTimeouts,
-		ReadFailures:      targetReadFailures,
-		WriteTimeouts:     targetWriteTimeouts,
-		WriteFailures:     targetWriteFailures,
-		UnpreparedErrors:  targetUnpreparedErrors,
-		OverloadedErrors:  targetOverloadedErrors,
-		UnavailableErrors: targetUnavailableErrors,
-		OtherErrors:       targetOtherErrors,
-		RequestDuration:   targetRequestDuration,
-		OpenConnections:   openTargetConnections,
-		InFlightRequests:  inflightRequests,
+		ClientTimeouts:     targetClientTimeouts,
+		ReadTimeouts:       targetReadTimeouts,
+		ReadFailures:       targetReadFailures,
+		WriteTimeouts:      targetWriteTimeouts,
+		WriteFailures:      targetWriteFailures,
+		UnpreparedErrors:   targetUnpreparedErrors,
+		OverloadedErrors:   targetOverloadedErrors,
+		UnavailableErrors:  targetUnavailableErrors,
+		UnauthorizedErrors: targetUnauthorizedErrors,
+		TruncateErrors:     targetTruncateErrors,
+		FunctionFailures:   targetFunctionFailures,
+		OtherErrors:        targetOtherErrors,
+		RequestDuration:    targetRequestDuration,
+		OpenConnections:    openTargetConnections,
+		InFlightRequests:   inflightRequests,
+		ErrorRate:          p.targetErrorRate,
+		Latency:            p.targetLatency,
 	}, nil
 }
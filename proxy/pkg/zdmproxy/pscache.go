@@ -1,13 +1,18 @@
 package zdmproxy
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
 	log "github.com/sirupsen/logrus"
+	"sort"
 	"sync"
 )
 
+// PreparedStatementCache maps the prepared ids returned by ORIGIN to the prepared data of both clusters.
+// A nil cache doesn't store anything so every EXECUTE is handled as a cache miss, see ZDM_PS_CACHE_MISS_MODE.
 type PreparedStatementCache struct {
 	cache map[string]PreparedData // Map containing the prepared queries (raw bytes) keyed on prepareId
 	index map[string]string       // Map that can be used as an index to look up origin prepareIds by target prepareId
@@ -15,18 +20,32 @@ type PreparedStatementCache struct {
 	interceptedCache map[string]PreparedData // Map containing the prepared queries for intercepted requests
 
 	lock *sync.RWMutex
+
+	// PREPARE requests that are in flight to prepare statements on TARGET again, see Reprepare
+	reprepares    map[string]*reprepareCall
+	reprepareLock *sync.Mutex
+
+	// entries with more bound variables are stored without variables metadata, see ZDM_PS_CACHE_MAX_METADATA_COLUMNS
+	maxMetadataColumns int
 }
 
-func NewPreparedStatementCache() *PreparedStatementCache {
+func NewPreparedStatementCache(maxMetadataColumns int) *PreparedStatementCache {
 	return &PreparedStatementCache{
-		cache:            make(map[string]PreparedData),
-		index:            make(map[string]string),
-		interceptedCache: make(map[string]PreparedData),
-		lock:             &sync.RWMutex{},
+		cache:              make(map[string]PreparedData),
+		index:              make(map[string]string),
+		interceptedCache:   make(map[string]PreparedData),
+		lock:               &sync.RWMutex{},
+		reprepares:         make(map[string]*reprepareCall),
+		reprepareLock:      &sync.Mutex{},
+		maxMetadataColumns: maxMetadataColumns,
 	}
 }
 
-func (psc PreparedStatementCache) GetPreparedStatementCacheSize() float64 {
+func (psc *PreparedStatementCache) GetPreparedStatementCacheSize() float64 {
+	if psc == nil {
+		return 0
+	}
+
 	psc.lock.RLock()
 	defer psc.lock.RUnlock()
 
@@ -37,19 +56,65 @@ func (psc *PreparedStatementCache) Store(
 	originPreparedResult *message.PreparedResult, targetPreparedResult *message.PreparedResult,
 	prepareRequestInfo *PrepareRequestInfo) {
 
+	// origin and target prepared ids are opaque and can have different lengths or formats
+	// so they are never compared with each other, the index is the only link between them
+	if psc == nil {
+		log.Debugf("PS cache is not available, not storing entry for OriginPreparedId=%v",
+			hex.EncodeToString(originPreparedResult.PreparedQueryId))
+		return
+	}
+
 	originPrepareIdStr := string(originPreparedResult.PreparedQueryId)
 	targetPrepareIdStr := string(targetPreparedResult.PreparedQueryId)
 	psc.lock.Lock()
 	defer psc.lock.Unlock()
 
-	psc.cache[originPrepareIdStr] = NewPreparedData(originPreparedResult, targetPreparedResult, prepareRequestInfo)
+	if previousData, ok := psc.cache[originPrepareIdStr]; ok {
+		previousTargetPrepareIdStr := string(previousData.GetTargetPreparedId())
+		if previousTargetPrepareIdStr != targetPrepareIdStr && psc.index[previousTargetPrepareIdStr] == originPrepareIdStr {
+			// target returned a different id for the same statement (e.g. it was prepared on a different node)
+			delete(psc.index, previousTargetPrepareIdStr)
+		}
+	}
+
+	preparedData := newPreparedData(originPreparedResult, targetPreparedResult, prepareRequestInfo)
+	psc.limitMetadata(preparedData)
+	psc.cache[originPrepareIdStr] = preparedData
 	psc.index[targetPrepareIdStr] = originPrepareIdStr
 
 	log.Debugf("Storing PS cache entry: {OriginPreparedId=%v, TargetPreparedId: %v, RequestInfo: %v}",
 		hex.EncodeToString(originPreparedResult.PreparedQueryId), hex.EncodeToString(targetPreparedResult.PreparedQueryId), prepareRequestInfo)
 }
 
+// limitMetadata omits the variables metadata of the entry if the statement has more bound variables than
+// ZDM_PS_CACHE_MAX_METADATA_COLUMNS, the metadata of statements with replaced CQL functions is always kept because the
+// generated values can not be added to their EXECUTE requests without it.
+func (psc *PreparedStatementCache) limitMetadata(data *preparedDataImpl) {
+	columns := data.getMetadataColumns()
+	if psc.maxMetadataColumns <= 0 || columns <= psc.maxMetadataColumns {
+		return
+	}
+
+	originPreparedId := hex.EncodeToString(data.originPreparedId)
+	if data.prepareRequestInfo != nil && len(data.prepareRequestInfo.GetReplacedTerms()) > 0 {
+		log.Debugf("Keeping metadata of OriginPreparedId=%v with %d bound variables "+
+			"because the statement has replaced CQL functions.", originPreparedId, columns)
+		return
+	}
+	log.Infof("Storing PS cache entry of OriginPreparedId=%v without metadata because the statement has %d bound variables "+
+		"(ZDM_PS_CACHE_MAX_METADATA_COLUMNS is %d).", originPreparedId, columns, psc.maxMetadataColumns)
+	data.originVariablesMetadata = nil
+	data.targetVariablesMetadata = nil
+	data.metadataOmitted = true
+}
+
 func (psc *PreparedStatementCache) StoreIntercepted(preparedResult *message.PreparedResult, prepareRequestInfo *PrepareRequestInfo) {
+	if psc == nil {
+		log.Debugf("PS cache is not available, not storing intercepted entry for PreparedId=%v",
+			hex.EncodeToString(preparedResult.PreparedQueryId))
+		return
+	}
+
 	prepareIdStr := string(preparedResult.PreparedQueryId)
 	psc.lock.Lock()
 	defer psc.lock.Unlock()
@@ -62,6 +127,10 @@ func (psc *PreparedStatementCache) StoreIntercepted(preparedResult *message.Prep
 }
 
 func (psc *PreparedStatementCache) Get(originPreparedId []byte) (PreparedData, bool) {
+	if psc == nil {
+		return nil, false
+	}
+
 	psc.lock.RLock()
 	defer psc.lock.RUnlock()
 	data, ok := psc.cache[string(originPreparedId)]
@@ -72,6 +141,10 @@ func (psc *PreparedStatementCache) Get(originPreparedId []byte) (PreparedData, b
 }
 
 func (psc *PreparedStatementCache) GetByTargetPreparedId(targetPreparedId []byte) (PreparedData, bool) {
+	if psc == nil {
+		return nil, false
+	}
+
 	psc.lock.RLock()
 	defer psc.lock.RUnlock()
 
@@ -91,12 +164,145 @@ func (psc *PreparedStatementCache) GetByTargetPreparedId(targetPreparedId []byte
 	return data, true
 }
 
+// reprepareCall is a PREPARE request that is in flight to prepare a statement on a TARGET host again, the result is
+// shared with every caller that needs to prepare the same statement on the same host in the meantime.
+type reprepareCall struct {
+	done    chan struct{}
+	waiters int
+	result  *message.PreparedResult
+	err     error
+}
+
+// Reprepare calls prepare to prepare the statement with the provided ORIGIN prepared id on the TARGET host again unless
+// the statement is already being prepared on that host, in which case it waits for the PREPARE request that is in
+// flight and returns its result. This coalesces the PREPARE requests that would otherwise be sent by every client
+// connection that gets UNPREPARED for the same statement at the same time (e.g. after a TARGET node was restarted).
+// The returned boolean is true if the result was shared by another caller.
+func (psc *PreparedStatementCache) Reprepare(
+	ctx context.Context, host string, originPreparedId []byte,
+	prepare func() (*message.PreparedResult, error)) (*message.PreparedResult, bool, error) {
+	if psc == nil {
+		result, err := prepare()
+		return result, false, err
+	}
+
+	key := host + "/" + string(originPreparedId)
+	psc.reprepareLock.Lock()
+	if call, ok := psc.reprepares[key]; ok {
+		call.waiters++
+		psc.reprepareLock.Unlock()
+		log.Debugf("Waiting for the PREPARE request of OriginPreparedId=%v that is already in flight to %v.",
+			hex.EncodeToString(originPreparedId), host)
+		select {
+		case <-call.done:
+			return call.result, true, call.err
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+	}
+	call := &reprepareCall{done: make(chan struct{})}
+	psc.reprepares[key] = call
+	psc.reprepareLock.Unlock()
+
+	defer func() {
+		psc.reprepareLock.Lock()
+		delete(psc.reprepares, key)
+		psc.reprepareLock.Unlock()
+		close(call.done)
+	}()
+	call.result, call.err = prepare()
+	return call.result, false, call.err
+}
+
+// getReprepareWaiters returns the number of callers that are waiting for the PREPARE request of the statement that
+// is in flight to the host.
+func (psc *PreparedStatementCache) getReprepareWaiters(host string, originPreparedId []byte) int {
+	psc.reprepareLock.Lock()
+	defer psc.reprepareLock.Unlock()
+	call, ok := psc.reprepares[host+"/"+string(originPreparedId)]
+	if !ok {
+		return 0
+	}
+	return call.waiters
+}
+
+// getPreparedData returns the prepared data of every entry that was prepared on the clusters,
+// intercepted entries are not included because they are handled by the proxy.
+func (psc *PreparedStatementCache) getPreparedData() []PreparedData {
+	if psc == nil {
+		return []PreparedData{}
+	}
+
+	psc.lock.RLock()
+	defer psc.lock.RUnlock()
+	entries := make([]PreparedData, 0, len(psc.cache))
+	for _, data := range psc.cache {
+		entries = append(entries, data)
+	}
+	return entries
+}
+
+// PreparedStatementCacheEntry is a copy of the data of a prepared statement cache entry,
+// used to inspect the contents of the cache without holding on to its internal state.
+type PreparedStatementCacheEntry struct {
+	OriginPreparedId string
+	TargetPreparedId string
+	Keyspace         string
+	Query            string
+	Intercepted      bool
+	MetadataOmitted  bool
+}
+
+// Snapshot returns a copy of all the entries of the cache sorted by origin prepared id.
+// If redactQueries is true then the CQL text of each entry is omitted because it can contain literal values.
+func (psc *PreparedStatementCache) Snapshot(redactQueries bool) []*PreparedStatementCacheEntry {
+	if psc == nil {
+		return []*PreparedStatementCacheEntry{}
+	}
+
+	psc.lock.RLock()
+	entries := make([]*PreparedStatementCacheEntry, 0, len(psc.cache)+len(psc.interceptedCache))
+	for _, data := range psc.cache {
+		entries = append(entries, newPreparedStatementCacheEntry(data, false, redactQueries))
+	}
+	for _, data := range psc.interceptedCache {
+		entries = append(entries, newPreparedStatementCacheEntry(data, true, redactQueries))
+	}
+	psc.lock.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].OriginPreparedId < entries[j].OriginPreparedId
+	})
+	return entries
+}
+
+func newPreparedStatementCacheEntry(data PreparedData, intercepted bool, redactQuery bool) *PreparedStatementCacheEntry {
+	entry := &PreparedStatementCacheEntry{
+		OriginPreparedId: hex.EncodeToString(data.GetOriginPreparedId()),
+		TargetPreparedId: hex.EncodeToString(data.GetTargetPreparedId()),
+		Intercepted:      intercepted,
+	}
+	if impl, ok := data.(*preparedDataImpl); ok {
+		entry.MetadataOmitted = impl.metadataOmitted
+	}
+	if prepareRequestInfo := data.GetPrepareRequestInfo(); prepareRequestInfo != nil {
+		entry.Keyspace = prepareRequestInfo.GetKeyspace()
+		if !redactQuery {
+			entry.Query = prepareRequestInfo.GetQuery()
+		}
+	}
+	return entry
+}
+
 type PreparedData interface {
 	GetOriginPreparedId() []byte
 	GetTargetPreparedId() []byte
 	GetPrepareRequestInfo() *PrepareRequestInfo
 	GetOriginVariablesMetadata() *message.VariablesMetadata
 	GetTargetVariablesMetadata() *message.VariablesMetadata
+	GetOriginResultMetadataId() []byte
+	GetTargetResultMetadataId() []byte
+	IsCounter() bool
 }
 
 type preparedDataImpl struct {
@@ -105,18 +311,65 @@ type preparedDataImpl struct {
 	prepareRequestInfo      *PrepareRequestInfo
 	originVariablesMetadata *message.VariablesMetadata
 	targetVariablesMetadata *message.VariablesMetadata
+	originResultMetadataId  []byte
+	targetResultMetadataId  []byte
+	counter                 bool
+
+	// true if the variables metadata was omitted, see ZDM_PS_CACHE_MAX_METADATA_COLUMNS
+	metadataOmitted bool
 }
 
 func NewPreparedData(
 	originPreparedResult *message.PreparedResult, targetPreparedResult *message.PreparedResult,
 	prepareRequestInfo *PrepareRequestInfo) PreparedData {
+	return newPreparedData(originPreparedResult, targetPreparedResult, prepareRequestInfo)
+}
+
+func newPreparedData(
+	originPreparedResult *message.PreparedResult, targetPreparedResult *message.PreparedResult,
+	prepareRequestInfo *PrepareRequestInfo) *preparedDataImpl {
 	return &preparedDataImpl{
-		originPreparedId:        originPreparedResult.PreparedQueryId,
-		targetPreparedId:        targetPreparedResult.PreparedQueryId,
+		originPreparedId:        primitive.CloneByteSlice(originPreparedResult.PreparedQueryId),
+		targetPreparedId:        primitive.CloneByteSlice(targetPreparedResult.PreparedQueryId),
 		prepareRequestInfo:      prepareRequestInfo,
 		originVariablesMetadata: originPreparedResult.VariablesMetadata,
 		targetVariablesMetadata: targetPreparedResult.VariablesMetadata,
+		originResultMetadataId:  primitive.CloneByteSlice(originPreparedResult.ResultMetadataId),
+		targetResultMetadataId:  primitive.CloneByteSlice(targetPreparedResult.ResultMetadataId),
+		counter:                 isCounterPreparedResult(originPreparedResult) || isCounterPreparedResult(targetPreparedResult),
+	}
+}
+
+// isCounterPreparedResult returns true if the bound variables or the result columns of the prepared statement
+// have the counter type which means that the statement targets a counter table.
+//
+// Note that a counter UPDATE that doesn't bind the counter value (e.g. SET c = c + 1 WHERE k = ?) can not be
+// detected this way because its metadata only includes the primary key columns.
+func isCounterPreparedResult(preparedResult *message.PreparedResult) bool {
+	if preparedResult.VariablesMetadata != nil && hasCounterColumn(preparedResult.VariablesMetadata.Columns) {
+		return true
+	}
+	return preparedResult.ResultMetadata != nil && hasCounterColumn(preparedResult.ResultMetadata.Columns)
+}
+
+func hasCounterColumn(columns []*message.ColumnMetadata) bool {
+	for _, column := range columns {
+		if column != nil && column.Type != nil && column.Type.GetDataTypeCode() == primitive.DataTypeCodeCounter {
+			return true
+		}
 	}
+	return false
+}
+
+// getMetadataColumns returns the number of bound variables of the statement on the cluster that returned more of them.
+func (recv *preparedDataImpl) getMetadataColumns() int {
+	columns := 0
+	for _, variablesMetadata := range []*message.VariablesMetadata{recv.originVariablesMetadata, recv.targetVariablesMetadata} {
+		if variablesMetadata != nil && len(variablesMetadata.Columns) > columns {
+			columns = len(variablesMetadata.Columns)
+		}
+	}
+	return columns
 }
 
 func (recv *preparedDataImpl) GetOriginPreparedId() []byte {
@@ -139,7 +392,19 @@ func (recv *preparedDataImpl) GetTargetVariablesMetadata() *message.VariablesMet
 	return recv.targetVariablesMetadata
 }
 
+func (recv *preparedDataImpl) GetOriginResultMetadataId() []byte {
+	return recv.originResultMetadataId
+}
+
+func (recv *preparedDataImpl) GetTargetResultMetadataId() []byte {
+	return recv.targetResultMetadataId
+}
+
+func (recv *preparedDataImpl) IsCounter() bool {
+	return recv.counter
+}
+
 func (recv *preparedDataImpl) String() string {
-	return fmt.Sprintf("PreparedData={OriginPreparedId=%s, TargetPreparedId=%s, PrepareRequestInfo=%v}",
-		hex.EncodeToString(recv.originPreparedId), hex.EncodeToString(recv.targetPreparedId), recv.prepareRequestInfo)
+	return fmt.Sprintf("PreparedData={OriginPreparedId=%s, TargetPreparedId=%s, Counter=%v, PrepareRequestInfo=%v}",
+		hex.EncodeToString(recv.originPreparedId), hex.EncodeToString(recv.targetPreparedId), recv.counter, recv.prepareRequestInfo)
 }
@@ -0,0 +1,315 @@
+package zdmproxy
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPreparedStatementCache_Snapshot(t *testing.T) {
+	psCache := NewPreparedStatementCache(0)
+	psCache.Store(
+		&message.PreparedResult{PreparedQueryId: []byte("ORIGIN_1")},
+		&message.PreparedResult{PreparedQueryId: []byte("TARGET_1")},
+		NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "INSERT INTO t (a) VALUES ('secret')", "ks1"))
+	psCache.StoreIntercepted(
+		&message.PreparedResult{PreparedQueryId: []byte("LOCAL")},
+		NewPrepareRequestInfo(NewInterceptedRequestInfo(local, newStarSelectClause()), nil, false, "SELECT * FROM system.local", ""))
+
+	snapshot := psCache.Snapshot(false)
+	require.Equal(t, []*PreparedStatementCacheEntry{
+		{
+			OriginPreparedId: hex.EncodeToString([]byte("LOCAL")),
+			TargetPreparedId: hex.EncodeToString([]byte("LOCAL")),
+			Keyspace:         "",
+			Query:            "SELECT * FROM system.local",
+			Intercepted:      true,
+		},
+		{
+			OriginPreparedId: hex.EncodeToString([]byte("ORIGIN_1")),
+			TargetPreparedId: hex.EncodeToString([]byte("TARGET_1")),
+			Keyspace:         "ks1",
+			Query:            "INSERT INTO t (a) VALUES ('secret')",
+			Intercepted:      false,
+		},
+	}, snapshot)
+
+	for _, entry := range psCache.Snapshot(true) {
+		require.Empty(t, entry.Query)
+		require.NotEmpty(t, entry.OriginPreparedId)
+	}
+}
+
+func TestPreparedStatementCache_SnapshotConcurrentMutation(t *testing.T) {
+	psCache := NewPreparedStatementCache(0)
+	numWriters := 4
+	entriesPerWriter := 500
+
+	wg := &sync.WaitGroup{}
+	for w := 0; w < numWriters; w++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for i := 0; i < entriesPerWriter; i++ {
+				id := fmt.Sprintf("%d_%d", writer, i)
+				psCache.Store(
+					&message.PreparedResult{PreparedQueryId: []byte("ORIGIN_" + id)},
+					&message.PreparedResult{PreparedQueryId: []byte("TARGET_" + id)},
+					NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "SELECT * FROM t", "ks"))
+			}
+		}(w)
+	}
+
+	doneChan := make(chan bool)
+	go func() {
+		wg.Wait()
+		close(doneChan)
+	}()
+
+	previousSize := 0
+	for stop := false; !stop; {
+		select {
+		case <-doneChan:
+			stop = true
+		default:
+		}
+		snapshot := psCache.Snapshot(false)
+		// entries are never removed so a snapshot can not be smaller than the previous one
+		require.GreaterOrEqual(t, len(snapshot), previousSize)
+		previousSize = len(snapshot)
+		for i := 1; i < len(snapshot); i++ {
+			require.Less(t, snapshot[i-1].OriginPreparedId, snapshot[i].OriginPreparedId)
+		}
+	}
+
+	require.Len(t, psCache.Snapshot(false), numWriters*entriesPerWriter)
+}
+
+func TestPreparedStatementCache_DistinctIdShapes(t *testing.T) {
+	psCache := NewPreparedStatementCache(0)
+	originId := []byte{143, 7, 36, 50, 225, 104, 157, 89, 199, 177, 239, 231, 82, 201, 142, 253}
+	targetId := []byte{1, 2, 3, 4}
+	newTargetId := []byte{5, 6, 7, 8, 9, 10, 11, 12}
+	prepareRequestInfo := NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "SELECT * FROM ks.t", "")
+
+	psCache.Store(
+		&message.PreparedResult{PreparedQueryId: originId, ResultMetadataId: []byte{1}},
+		&message.PreparedResult{PreparedQueryId: targetId, ResultMetadataId: []byte{2, 2, 2}},
+		prepareRequestInfo)
+
+	data, ok := psCache.Get(originId)
+	require.True(t, ok)
+	require.Equal(t, originId, data.GetOriginPreparedId())
+	require.Equal(t, targetId, data.GetTargetPreparedId())
+	require.Equal(t, []byte{1}, data.GetOriginResultMetadataId())
+	require.Equal(t, []byte{2, 2, 2}, data.GetTargetResultMetadataId())
+
+	_, ok = psCache.Get(targetId)
+	require.False(t, ok)
+
+	data, ok = psCache.GetByTargetPreparedId(targetId)
+	require.True(t, ok)
+	require.Equal(t, originId, data.GetOriginPreparedId())
+
+	_, ok = psCache.GetByTargetPreparedId(originId)
+	require.False(t, ok)
+
+	// target returns a different id for the same statement, the previous target id is no longer valid
+	psCache.Store(
+		&message.PreparedResult{PreparedQueryId: originId},
+		&message.PreparedResult{PreparedQueryId: newTargetId},
+		prepareRequestInfo)
+
+	data, ok = psCache.Get(originId)
+	require.True(t, ok)
+	require.Equal(t, newTargetId, data.GetTargetPreparedId())
+
+	_, ok = psCache.GetByTargetPreparedId(targetId)
+	require.False(t, ok)
+
+	data, ok = psCache.GetByTargetPreparedId(newTargetId)
+	require.True(t, ok)
+	require.Equal(t, originId, data.GetOriginPreparedId())
+}
+
+func TestPreparedStatementCache_Nil(t *testing.T) {
+	var psCache *PreparedStatementCache
+	preparedResult := &message.PreparedResult{PreparedQueryId: []byte("ID")}
+	prepareRequestInfo := NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "SELECT * FROM ks1.t", "")
+
+	require.NotPanics(t, func() {
+		psCache.Store(preparedResult, preparedResult, prepareRequestInfo)
+		psCache.StoreIntercepted(preparedResult, prepareRequestInfo)
+	})
+	_, ok := psCache.Get([]byte("ID"))
+	require.False(t, ok)
+	_, ok = psCache.GetByTargetPreparedId([]byte("ID"))
+	require.False(t, ok)
+	require.Equal(t, float64(0), psCache.GetPreparedStatementCacheSize())
+	require.Empty(t, psCache.Snapshot(false))
+}
+
+func TestPreparedStatementCache_ReprepareCoalescing(t *testing.T) {
+	psCache := NewPreparedStatementCache(0)
+	originPreparedId := []byte("origin")
+	targetHost := "127.0.0.2:9042"
+
+	var prepares int32
+	release := make(chan bool)
+	prepare := func() (*message.PreparedResult, error) {
+		atomic.AddInt32(&prepares, 1)
+		<-release
+		return &message.PreparedResult{PreparedQueryId: []byte("target2")}, nil
+	}
+
+	// every client connection gets UNPREPARED for the same statement at the same time
+	const clients = 10
+	wg := &sync.WaitGroup{}
+	results := make(chan *message.PreparedResult, clients)
+	sharedResults := int32(0)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, shared, err := psCache.Reprepare(context.Background(), targetHost, originPreparedId, prepare)
+			require.Nil(t, err)
+			if shared {
+				atomic.AddInt32(&sharedResults, 1)
+			}
+			results <- result
+		}()
+	}
+	require.Eventually(t, func() bool {
+		return psCache.getReprepareWaiters(targetHost, originPreparedId) == clients-1
+	}, 5*time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&prepares))
+	require.Equal(t, int32(clients-1), sharedResults)
+	for result := range results {
+		require.Equal(t, []byte("target2"), result.PreparedQueryId)
+	}
+
+	// the statement is prepared again once the previous PREPARE completed and on every host
+	_, shared, err := psCache.Reprepare(context.Background(), targetHost, originPreparedId, prepare)
+	require.Nil(t, err)
+	require.False(t, shared)
+	_, shared, err = psCache.Reprepare(context.Background(), "127.0.0.3:9042", originPreparedId, prepare)
+	require.Nil(t, err)
+	require.False(t, shared)
+	require.Equal(t, int32(3), atomic.LoadInt32(&prepares))
+}
+
+func TestPreparedStatementCache_ReprepareError(t *testing.T) {
+	psCache := NewPreparedStatementCache(0)
+	prepareErr := errors.New("overloaded")
+	started := make(chan bool)
+	release := make(chan bool)
+	go func() {
+		_, _, _ = psCache.Reprepare(context.Background(), "host", []byte("origin"), func() (*message.PreparedResult, error) {
+			started <- true
+			<-release
+			return nil, prepareErr
+		})
+	}()
+	<-started
+
+	// the waiters get the error of the PREPARE request that was in flight
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := psCache.Reprepare(context.Background(), "host", []byte("origin"), func() (*message.PreparedResult, error) {
+			return nil, errors.New("unexpected PREPARE")
+		})
+		errs <- err
+	}()
+	require.Eventually(t, func() bool {
+		return psCache.getReprepareWaiters("host", []byte("origin")) == 1
+	}, 5*time.Second, time.Millisecond)
+	close(release)
+	require.Equal(t, prepareErr, <-errs)
+
+	// a waiter stops waiting when its client connection is closed
+	release = make(chan bool)
+	defer close(release)
+	go func() {
+		_, _, _ = psCache.Reprepare(context.Background(), "host", []byte("origin"), func() (*message.PreparedResult, error) {
+			started <- true
+			<-release
+			return nil, nil
+		})
+	}()
+	<-started
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, shared, err := psCache.Reprepare(ctx, "host", []byte("origin"), func() (*message.PreparedResult, error) {
+		return nil, errors.New("unexpected PREPARE")
+	})
+	require.True(t, shared)
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestPreparedStatementCache_MaxMetadataColumns(t *testing.T) {
+	newPreparedResult := func(id string, columns int, columnType datatype.DataType) *message.PreparedResult {
+		variablesMetadata := &message.VariablesMetadata{PkIndices: []uint16{0}}
+		for i := 0; i < columns; i++ {
+			variablesMetadata.Columns = append(variablesMetadata.Columns, &message.ColumnMetadata{
+				Keyspace: "ks1", Table: "wide", Name: fmt.Sprintf("c%d", i), Index: int32(i), Type: columnType})
+		}
+		return &message.PreparedResult{PreparedQueryId: []byte(id), ResultMetadataId: []byte(id), VariablesMetadata: variablesMetadata}
+	}
+	prepareRequestInfo := NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "UPDATE ks1.wide SET ...", "")
+	psCache := NewPreparedStatementCache(100)
+
+	// statements within the limit keep their metadata
+	psCache.Store(newPreparedResult("origin1", 100, datatype.Int), newPreparedResult("target1", 100, datatype.Int), prepareRequestInfo)
+	data, ok := psCache.Get([]byte("origin1"))
+	require.True(t, ok)
+	require.Len(t, data.GetOriginVariablesMetadata().Columns, 100)
+	require.Len(t, data.GetTargetVariablesMetadata().Columns, 100)
+
+	// the essentials for routing and re-preparing the statement are kept if the metadata is omitted
+	psCache.Store(newPreparedResult("origin2", 100, datatype.Int), newPreparedResult("target2", 5000, datatype.Counter), prepareRequestInfo)
+	data, ok = psCache.Get([]byte("origin2"))
+	require.True(t, ok)
+	require.Nil(t, data.GetOriginVariablesMetadata())
+	require.Nil(t, data.GetTargetVariablesMetadata())
+	require.Equal(t, []byte("origin2"), data.GetOriginPreparedId())
+	require.Equal(t, []byte("target2"), data.GetTargetPreparedId())
+	require.Equal(t, []byte("origin2"), data.GetOriginResultMetadataId())
+	require.Equal(t, []byte("target2"), data.GetTargetResultMetadataId())
+	require.Same(t, prepareRequestInfo, data.GetPrepareRequestInfo())
+	require.True(t, data.IsCounter())
+	data, ok = psCache.GetByTargetPreparedId([]byte("target2"))
+	require.True(t, ok)
+	require.Equal(t, []byte("origin2"), data.GetOriginPreparedId())
+
+	// the generated values of replaced CQL functions can't be added without the metadata
+	replacedTermsRequestInfo := NewPrepareRequestInfo(
+		NewGenericRequestInfo(forwardToBoth, false, true), []*term{{}}, false, "INSERT INTO ks1.wide (...) VALUES (now(), ...)", "")
+	psCache.Store(newPreparedResult("origin3", 5000, datatype.Int), newPreparedResult("target3", 5000, datatype.Int), replacedTermsRequestInfo)
+	data, ok = psCache.Get([]byte("origin3"))
+	require.True(t, ok)
+	require.Len(t, data.GetOriginVariablesMetadata().Columns, 5000)
+
+	snapshot := psCache.Snapshot(true)
+	require.Len(t, snapshot, 3)
+	require.Equal(t, []bool{false, true, false},
+		[]bool{snapshot[0].MetadataOmitted, snapshot[1].MetadataOmitted, snapshot[2].MetadataOmitted})
+
+	// 0 disables the limit
+	psCache = NewPreparedStatementCache(0)
+	psCache.Store(newPreparedResult("origin4", 5000, datatype.Int), newPreparedResult("target4", 5000, datatype.Int), prepareRequestInfo)
+	data, ok = psCache.Get([]byte("origin4"))
+	require.True(t, ok)
+	require.Len(t, data.GetOriginVariablesMetadata().Columns, 5000)
+}
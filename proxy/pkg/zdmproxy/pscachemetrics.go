@@ -0,0 +1,101 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"sync"
+)
+
+const (
+	psCacheExecuteHit  = "hit"
+	psCacheExecuteMiss = "miss"
+
+	psCacheKeyspaceUnknownLabel = "unknown"
+)
+
+type psCacheExecuteLabels struct {
+	keyspace string
+	result   string
+}
+
+// psCacheExecuteTracker bounds the number of keyspaces that proxy_ps_cache_executes_total is labeled with, see
+// ZDM_METRICS_PS_CACHE_MAX_KEYSPACES. The counters are kept so that they are not looked up for every EXECUTE request.
+// It is shared by all client connections. A nil psCacheExecuteTracker doesn't track any request.
+type psCacheExecuteTracker struct {
+	keyspaces *boundedLabelSet
+	lock      *sync.RWMutex
+	counters  map[psCacheExecuteLabels]metrics.Counter
+}
+
+func newPsCacheExecuteTracker(maxKeyspaces int) *psCacheExecuteTracker {
+	keyspaces := newBoundedLabelSet(maxKeyspaces)
+	if keyspaces == nil {
+		return nil
+	}
+	return &psCacheExecuteTracker{
+		keyspaces: keyspaces,
+		lock:      &sync.RWMutex{},
+		counters:  make(map[psCacheExecuteLabels]metrics.Counter),
+	}
+}
+
+// getKeyspaceLabel returns the keyspace label that an EXECUTE request on the given keyspace is counted with,
+// keyspaces that are seen for the first time after the limit was reached are grouped under "other".
+func (recv *psCacheExecuteTracker) getKeyspaceLabel(keyspace string) string {
+	if keyspace == "" {
+		return psCacheKeyspaceUnknownLabel
+	}
+	return recv.keyspaces.getLabel(keyspace)
+}
+
+func (recv *psCacheExecuteTracker) getCounter(mh *metrics.MetricHandler, labels psCacheExecuteLabels) (metrics.Counter, error) {
+	recv.lock.RLock()
+	counter, ok := recv.counters[labels]
+	recv.lock.RUnlock()
+	if ok {
+		return counter, nil
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	if counter, ok = recv.counters[labels]; ok {
+		return counter, nil
+	}
+	counter, err := mh.GetPsCacheExecutesCounter(labels.keyspace, labels.result)
+	if err != nil {
+		return nil, err
+	}
+	recv.counters[labels] = counter
+	return counter, nil
+}
+
+// trackPsCacheExecute counts an EXECUTE request as a hit if its prepared statement was found in the prepared
+// statement cache and as a miss otherwise (whether the client receives UNPREPARED or the request is forwarded, see
+// ZDM_PS_CACHE_MISS_MODE). Hits are counted under the keyspace of the statement, misses under "unknown" because the
+// statement of a prepared id that is not cached is not known.
+func (ch *ClientHandler) trackPsCacheExecute(request *frame.RawFrame, requestInfo RequestInfo, err error) {
+	if ch.psCacheExecutes == nil || request.Header.OpCode != primitive.OpCodeExecute {
+		return
+	}
+
+	labels := psCacheExecuteLabels{keyspace: psCacheKeyspaceUnknownLabel, result: psCacheExecuteMiss}
+	if executeRequestInfo, ok := requestInfo.(*ExecuteRequestInfo); ok && err == nil {
+		labels.result = psCacheExecuteHit
+		prepareRequestInfo := executeRequestInfo.GetPreparedData().GetPrepareRequestInfo()
+		if prepareRequestInfo != nil {
+			labels.keyspace = ch.psCacheExecutes.getKeyspaceLabel(prepareRequestInfo.GetStatementKeyspace())
+		}
+	} else if _, ok := err.(*UnpreparedExecuteError); err != nil && !ok {
+		return
+	}
+
+	counter, err := ch.psCacheExecutes.getCounter(ch.metricHandler, labels)
+	if err != nil {
+		log.Errorf("Could not track EXECUTE request with prepared statement cache %v on keyspace %v: %v",
+			labels.result, labels.keyspace, err)
+		return
+	}
+	counter.Add(1)
+}
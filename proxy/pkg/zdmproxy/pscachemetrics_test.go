@@ -0,0 +1,87 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/prommetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTrackPsCacheExecute(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	ch := &ClientHandler{
+		psCacheExecutes: newPsCacheExecuteTracker(1),
+		metricHandler: metrics.NewMetricHandler(
+			prommetrics.NewPrometheusMetricFactory(registry), nil, nil, nil, newFakeProxyMetrics(), nil, nil, nil),
+	}
+	psCache := NewPreparedStatementCache(0)
+	timeUuidGenerator, err := GetDefaultTimeUuidGenerator()
+	require.Nil(t, err)
+
+	handleRequest := func(request *frame.RawFrame, psCacheMissMode common.PsCacheMissMode) RequestInfo {
+		requestInfo, err := buildRequestInfo(
+			&frameDecodeContext{frame: request}, []*statementReplacedTerms{}, psCache, ch.metricHandler, "",
+			common.ClusterTypeOrigin, false, false, false, false, false, false, timeUuidGenerator, nil, psCacheMissMode)
+		ch.trackPsCacheExecute(request, requestInfo, err)
+		return requestInfo
+	}
+	prepare := func(preparedId string, query string) {
+		requestInfo := handleRequest(mockPrepareFrame(t, query), common.PsCacheMissModeUnprepared)
+		require.IsType(t, &PrepareRequestInfo{}, requestInfo)
+		preparedResult := &message.PreparedResult{PreparedQueryId: []byte(preparedId)}
+		psCache.Store(preparedResult, preparedResult, requestInfo.(*PrepareRequestInfo))
+	}
+
+	prepare("ks1", "SELECT * FROM ks1.t WHERE k = ?")
+	handleRequest(mockExecuteFrame(t, "ks1"), common.PsCacheMissModeUnprepared)
+	handleRequest(mockExecuteFrame(t, "ks1"), common.PsCacheMissModeUnprepared)
+
+	// the limit of keyspaces was reached so the statements of other keyspaces are grouped under "other"
+	prepare("ks2", "UPDATE ks2.t SET v = ? WHERE k = ?")
+	handleRequest(mockExecuteFrame(t, "ks2"), common.PsCacheMissModeUnprepared)
+
+	// misses are counted whether the client receives UNPREPARED or the request is forwarded
+	handleRequest(mockExecuteFrame(t, "evicted"), common.PsCacheMissModeUnprepared)
+	handleRequest(mockExecuteFrame(t, "evicted"), common.PsCacheMissModeForward)
+
+	require.Equal(t, map[string]float64{
+		"ks1/hit":      2,
+		"other/hit":    1,
+		"unknown/miss": 2,
+	}, gatherPsCacheExecutes(t, registry))
+}
+
+func TestTrackPsCacheExecute_Disabled(t *testing.T) {
+	require.Nil(t, newPsCacheExecuteTracker(0))
+
+	registry := prometheus.NewRegistry()
+	ch := &ClientHandler{
+		metricHandler: metrics.NewMetricHandler(
+			prommetrics.NewPrometheusMetricFactory(registry), nil, nil, nil, newFakeProxyMetrics(), nil, nil, nil),
+	}
+	ch.trackPsCacheExecute(mockExecuteFrame(t, "evicted"), nil, &UnpreparedExecuteError{})
+	require.Empty(t, gatherPsCacheExecutes(t, registry))
+}
+
+func gatherPsCacheExecutes(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	metricFamilies, err := registry.Gather()
+	require.Nil(t, err)
+	counts := map[string]float64{}
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() != "zdm_proxy_ps_cache_executes_total" {
+			continue
+		}
+		for _, m := range metricFamily.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			counts[labels["keyspace"]+"/"+labels["result"]] = m.GetCounter().GetValue()
+		}
+	}
+	return counts
+}
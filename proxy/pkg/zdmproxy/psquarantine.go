@@ -0,0 +1,161 @@
+package zdmproxy
+
+import (
+	"encoding/hex"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// preparedStatementQuarantine tracks the consecutive TARGET failures of the prepared statements (by origin prepared id)
+// and quarantines the statements that reach the threshold, see ZDM_PS_QUARANTINE_FAILURE_THRESHOLD.
+// Only the statements that are currently failing are tracked, a successful response removes the statement.
+// A nil preparedStatementQuarantine never quarantines statements.
+type preparedStatementQuarantine struct {
+	failureThreshold int
+	cooldown         time.Duration
+
+	lock       *sync.Mutex
+	statements *trackingMap
+}
+
+type preparedStatementFailures struct {
+	consecutiveFailures int
+	quarantinedUntil    time.Time
+}
+
+// newPreparedStatementQuarantine returns a preparedStatementQuarantine that tracks at most maxEntries statements,
+// statements are tracked for maxAge after their last failure but quarantined statements are kept for their cooldown.
+func newPreparedStatementQuarantine(
+	failureThreshold int, cooldown time.Duration,
+	maxEntries int, maxAge time.Duration, entriesGauge metrics.Gauge, evictions metrics.Counter) *preparedStatementQuarantine {
+	if failureThreshold <= 0 {
+		return nil
+	}
+
+	ttl := maxAge
+	if cooldown > ttl {
+		ttl = cooldown
+	}
+	return &preparedStatementQuarantine{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		lock:             &sync.Mutex{},
+		statements:       newTrackingMap(maxEntries, ttl, entriesGauge, evictions),
+	}
+}
+
+// isQuarantined returns true if the statement is quarantined, the statement is released when its cooldown expired.
+func (recv *preparedStatementQuarantine) isQuarantined(originPreparedId []byte) bool {
+	if recv == nil {
+		return false
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	now := nowFunc()
+	value, ok := recv.statements.get(string(originPreparedId), now)
+	if !ok || value.(*preparedStatementFailures).quarantinedUntil.IsZero() {
+		return false
+	}
+	if now.Before(value.(*preparedStatementFailures).quarantinedUntil) {
+		return true
+	}
+
+	log.Infof("Releasing prepared statement with OriginPreparedId=%v from quarantine, it is forwarded to %v again.",
+		hex.EncodeToString(originPreparedId), common.ClusterTypeTarget)
+	recv.statements.remove(string(originPreparedId))
+	return false
+}
+
+// trackTargetResult records whether the statement failed on TARGET and quarantines it if it reached the threshold,
+// it returns true if the statement was quarantined by this call.
+func (recv *preparedStatementQuarantine) trackTargetResult(originPreparedId []byte, failed bool) bool {
+	if recv == nil {
+		return false
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	if !failed {
+		recv.statements.remove(string(originPreparedId))
+		return false
+	}
+
+	now := nowFunc()
+	failures := &preparedStatementFailures{}
+	if value, ok := recv.statements.get(string(originPreparedId), now); ok {
+		failures = value.(*preparedStatementFailures)
+	}
+	if !failures.quarantinedUntil.IsZero() {
+		// requests that were forwarded before the statement was quarantined
+		return false
+	}
+
+	failures.consecutiveFailures++
+	recv.statements.put(string(originPreparedId), failures, now)
+	if failures.consecutiveFailures < recv.failureThreshold {
+		return false
+	}
+
+	failures.quarantinedUntil = now.Add(recv.cooldown)
+	log.Warnf("Prepared statement with OriginPreparedId=%v failed %v consecutive times on %v, "+
+		"forwarding it to %v only for the next %v.", hex.EncodeToString(originPreparedId),
+		failures.consecutiveFailures, common.ClusterTypeTarget, common.ClusterTypeOrigin, recv.cooldown)
+	return true
+}
+
+// routeQuarantined returns a request info that forwards the bound statement to ORIGIN only if the statement
+// is quarantined, other requests are returned unchanged.
+func (ch *ClientHandler) routeQuarantined(requestInfo RequestInfo) RequestInfo {
+	executeRequestInfo, ok := requestInfo.(*ExecuteRequestInfo)
+	if !ok || ch.psQuarantine == nil || executeRequestInfo.GetForwardDecision() == forwardToOrigin {
+		return requestInfo
+	}
+
+	preparedData := executeRequestInfo.GetPreparedData()
+	if !ch.psQuarantine.isQuarantined(preparedData.GetOriginPreparedId()) {
+		return requestInfo
+	}
+
+	log.Tracef("EXECUTE with OriginPreparedId=%v is quarantined, forwarding it to %v only.",
+		hex.EncodeToString(preparedData.GetOriginPreparedId()), common.ClusterTypeOrigin)
+	return NewQuarantinedExecuteRequestInfo(preparedData)
+}
+
+// trackQuarantine records the TARGET result of a bound statement, failures are only counted when ORIGIN
+// didn't fail as well because then the failure is most likely not specific to TARGET.
+func (ch *ClientHandler) trackQuarantine(reqCtx *requestContextImpl) {
+	if ch.psQuarantine == nil || reqCtx.targetResponse == nil {
+		return
+	}
+
+	executeRequestInfo, ok := reqCtx.requestInfo.(*ExecuteRequestInfo)
+	if !ok {
+		return
+	}
+	if reqCtx.originResponse != nil && !isResponseSuccessful(reqCtx.originResponse) {
+		return
+	}
+
+	failed := !isResponseSuccessful(reqCtx.targetResponse)
+	if failed {
+		errMsg, err := decodeErrorResult(ch.codec.get(), reqCtx.targetResponse)
+		if err != nil {
+			log.Debugf("Could not decode %v error response of stream id %d: %v",
+				common.ClusterTypeTarget, reqCtx.targetResponse.Header.StreamId, err)
+			return
+		}
+		if _, ok = errMsg.(*message.Unprepared); ok {
+			return
+		}
+	}
+	if ch.psQuarantine.trackTargetResult(executeRequestInfo.GetPreparedData().GetOriginPreparedId(), failed) {
+		ch.metricHandler.GetProxyMetrics().QuarantinedPreparedStatements.Add(1)
+	}
+}
@@ -0,0 +1,94 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPreparedStatementQuarantine(t *testing.T) {
+	clock := newFakeClock(t)
+	quarantine := newPreparedStatementQuarantine(3, time.Minute, 100, time.Second, newFakeGauge(), newFakeCounter())
+	id := []byte("origin")
+
+	// a successful response resets the consecutive failures
+	require.False(t, quarantine.trackTargetResult(id, true))
+	require.False(t, quarantine.trackTargetResult(id, true))
+	require.False(t, quarantine.trackTargetResult(id, false))
+	require.False(t, quarantine.isQuarantined(id))
+
+	require.False(t, quarantine.trackTargetResult(id, true))
+	require.False(t, quarantine.trackTargetResult(id, true))
+	require.True(t, quarantine.trackTargetResult(id, true))
+	require.True(t, quarantine.isQuarantined(id))
+	require.False(t, quarantine.isQuarantined([]byte("other")))
+
+	// failures of requests that were forwarded before the statement was quarantined are ignored
+	require.False(t, quarantine.trackTargetResult(id, true))
+
+	clock.advance(30 * time.Second)
+	require.True(t, quarantine.isQuarantined(id))
+
+	// the statement is released after the cooldown and has to reach the threshold again
+	clock.advance(30 * time.Second)
+	require.False(t, quarantine.isQuarantined(id))
+	require.False(t, quarantine.trackTargetResult(id, true))
+	require.False(t, quarantine.isQuarantined(id))
+
+	var disabledQuarantine *preparedStatementQuarantine
+	require.Nil(t, newPreparedStatementQuarantine(0, time.Minute, 100, time.Second, newFakeGauge(), newFakeCounter()))
+	require.False(t, disabledQuarantine.trackTargetResult(id, true))
+	require.False(t, disabledQuarantine.isQuarantined(id))
+}
+
+func TestClientHandler_Quarantine(t *testing.T) {
+	clock := newFakeClock(t)
+	proxyMetrics := newFakeProxyMetrics()
+	quarantined := &countingCounter{}
+	proxyMetrics.QuarantinedPreparedStatements = quarantined
+	ch := &ClientHandler{
+		psQuarantine: newPreparedStatementQuarantine(2, time.Minute, 100, time.Minute, newFakeGauge(), newFakeCounter()),
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+
+	writeData := NewPreparedData(
+		&message.PreparedResult{PreparedQueryId: []byte("origin")},
+		&message.PreparedResult{PreparedQueryId: []byte("target")},
+		NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "INSERT INTO t (a) VALUES (?)", ""))
+	void := mustEncodeFrame(t, &message.VoidResult{})
+	invalid := mustEncodeFrame(t, &message.Invalid{ErrorMessage: "Undefined column name a"})
+	unprepared := mustEncodeFrame(t, &message.Unprepared{ErrorMessage: "unprepared", Id: []byte("target")})
+	execute := mustEncodeFrame(t, &message.Execute{QueryId: []byte("origin")})
+
+	track := func(originResponse *frame.RawFrame, targetResponse *frame.RawFrame) {
+		reqCtx := NewRequestContext(execute, NewExecuteRequestInfo(writeData), time.Now(), nil)
+		reqCtx.originResponse = originResponse
+		reqCtx.targetResponse = targetResponse
+		ch.trackQuarantine(reqCtx)
+	}
+
+	// UNPREPARED and failures on both clusters are not counted
+	track(void, invalid)
+	track(void, unprepared)
+	track(invalid, invalid)
+	require.Equal(t, forwardToBoth, ch.routeQuarantined(NewExecuteRequestInfo(writeData)).GetForwardDecision())
+	require.Equal(t, int64(0), quarantined.get())
+
+	track(void, invalid)
+	routedRequestInfo := ch.routeQuarantined(NewExecuteRequestInfo(writeData))
+	require.Equal(t, forwardToOrigin, routedRequestInfo.GetForwardDecision())
+	require.False(t, routedRequestInfo.ShouldAlsoBeSentAsync())
+	require.Equal(t, int64(1), quarantined.get())
+
+	// other requests are not affected
+	write := NewGenericRequestInfo(forwardToBoth, false, true)
+	require.Equal(t, write, ch.routeQuarantined(write))
+
+	clock.advance(time.Minute)
+	require.Equal(t, forwardToBoth, ch.routeQuarantined(NewExecuteRequestInfo(writeData)).GetForwardDecision())
+}
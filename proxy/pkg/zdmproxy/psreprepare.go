@@ -0,0 +1,261 @@
+package zdmproxy
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxReprepareReportErrors = 20
+
+// PreparedStatementReprepareReport contains the progress of the last re-preparation of the prepared statement cache.
+type PreparedStatementReprepareReport struct {
+	Running    bool
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Total      int
+	Reprepared int
+	Failed     int
+
+	// the most recent errors, at most maxReprepareReportErrors are kept
+	Errors []string
+}
+
+var ReprepareAlreadyRunningErr = errors.New("the prepared statement cache is already being re-prepared")
+
+// psRepreparer prepares the statements of the prepared statement cache again on every assigned host of both clusters
+// so that clients don't get UNPREPARED responses after a node restart or a schema change. Only one re-preparation
+// can run at a time and statements are re-prepared at a limited rate so that the clusters are not flooded.
+type psRepreparer struct {
+	psCache  *PreparedStatementCache
+	interval time.Duration
+
+	lock   *sync.Mutex
+	report *PreparedStatementReprepareReport
+}
+
+func newPsRepreparer(psCache *PreparedStatementCache, statementsPerSecond int) *psRepreparer {
+	return &psRepreparer{
+		psCache:  psCache,
+		interval: time.Second / time.Duration(statementsPerSecond),
+		lock:     &sync.Mutex{},
+	}
+}
+
+// clusterConnections are the connections that statements are re-prepared on for a single cluster, the keyspace of each
+// connection is tracked so that USE is only sent when the keyspace of the next statement is different.
+type clusterConnections struct {
+	clusterType common.ClusterType
+	conns       []CqlConnection
+	keyspaces   []string
+}
+
+func newClusterConnections(clusterType common.ClusterType, conns []CqlConnection) *clusterConnections {
+	return &clusterConnections{
+		clusterType: clusterType,
+		conns:       conns,
+		keyspaces:   make([]string, len(conns)),
+	}
+}
+
+func (recv *clusterConnections) close() {
+	for _, conn := range recv.conns {
+		err := conn.Close()
+		if err != nil {
+			log.Debugf("Failed to close re-prepare connection to %v: %v", recv.clusterType, err)
+		}
+	}
+}
+
+// prepare prepares the statement on every connection and returns the result of the first one.
+func (recv *clusterConnections) prepare(ctx context.Context, query string, keyspace string) (*message.PreparedResult, error) {
+	var firstResult *message.PreparedResult
+	for i, conn := range recv.conns {
+		if keyspace != "" && recv.keyspaces[i] != keyspace {
+			response, err := conn.Execute(
+				&message.Query{Query: fmt.Sprintf("USE \"%v\"", strings.ReplaceAll(keyspace, "\"", "\"\""))}, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("could not set keyspace %v on %v: %w", keyspace, recv.clusterType, err)
+			}
+			if errMsg, ok := response.(message.Error); ok {
+				return nil, fmt.Errorf("could not set keyspace %v on %v: %v", keyspace, recv.clusterType, errMsg)
+			}
+			recv.keyspaces[i] = keyspace
+		}
+
+		response, err := conn.Execute(&message.Prepare{Query: query}, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not prepare on %v: %w", recv.clusterType, err)
+		}
+		preparedResult, ok := response.(*message.PreparedResult)
+		if !ok {
+			return nil, fmt.Errorf("%v returned %v instead of PREPARED", recv.clusterType, response)
+		}
+		if firstResult == nil {
+			firstResult = preparedResult
+		}
+	}
+	return firstResult, nil
+}
+
+// start re-prepares every statement of the cache in the background, ReprepareAlreadyRunningErr is returned if
+// a re-preparation is already running. The connections are closed once it is done.
+func (recv *psRepreparer) start(
+	ctx context.Context, wg *sync.WaitGroup,
+	originConns *clusterConnections, targetConns *clusterConnections) (*PreparedStatementReprepareReport, error) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	if recv.report != nil && recv.report.Running {
+		originConns.close()
+		targetConns.close()
+		return recv.copyReport(), ReprepareAlreadyRunningErr
+	}
+
+	entries := recv.psCache.getPreparedData()
+	recv.report = &PreparedStatementReprepareReport{
+		Running:   true,
+		StartedAt: time.Now(),
+		Total:     len(entries),
+		Errors:    []string{},
+	}
+	log.Infof("Re-preparing %v statements of the prepared statement cache on %v %v hosts and %v %v hosts.",
+		len(entries), len(originConns.conns), common.ClusterTypeOrigin, len(targetConns.conns), common.ClusterTypeTarget)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer originConns.close()
+		defer targetConns.close()
+		recv.run(ctx, entries, originConns, targetConns)
+	}()
+	return recv.copyReport(), nil
+}
+
+func (recv *psRepreparer) run(
+	ctx context.Context, entries []PreparedData, originConns *clusterConnections, targetConns *clusterConnections) {
+	ticker := time.NewTicker(recv.interval)
+	defer ticker.Stop()
+
+	for i, entry := range entries {
+		if i > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			recv.trackFailure(fmt.Errorf("re-preparation was interrupted: %w", ctx.Err()))
+			break
+		}
+
+		err := recv.reprepare(ctx, entry, originConns, targetConns)
+		if err != nil {
+			recv.trackFailure(fmt.Errorf("could not re-prepare OriginPreparedId=%v: %w",
+				hex.EncodeToString(entry.GetOriginPreparedId()), err))
+		} else {
+			recv.trackSuccess()
+		}
+	}
+
+	recv.lock.Lock()
+	recv.report.Running = false
+	recv.report.FinishedAt = time.Now()
+	log.Infof("Re-preparation of the prepared statement cache is done: %v re-prepared, %v failed out of %v statements.",
+		recv.report.Reprepared, recv.report.Failed, recv.report.Total)
+	recv.lock.Unlock()
+}
+
+func (recv *psRepreparer) reprepare(
+	ctx context.Context, entry PreparedData, originConns *clusterConnections, targetConns *clusterConnections) error {
+	prepareRequestInfo := entry.GetPrepareRequestInfo()
+	keyspace := prepareRequestInfo.GetRequestKeyspace()
+
+	originResult, err := originConns.prepare(ctx, prepareRequestInfo.GetQuery(), keyspace)
+	if err != nil {
+		return err
+	}
+	targetResult, err := targetConns.prepare(ctx, prepareRequestInfo.GetQuery(), keyspace)
+	if err != nil {
+		return err
+	}
+
+	if string(originResult.PreparedQueryId) != string(entry.GetOriginPreparedId()) {
+		log.Infof("%v returned a new prepared id for OriginPreparedId=%v: %v, clients will get UNPREPARED "+
+			"for the old prepared id.", common.ClusterTypeOrigin, hex.EncodeToString(entry.GetOriginPreparedId()),
+			hex.EncodeToString(originResult.PreparedQueryId))
+	}
+	recv.psCache.Store(originResult, targetResult, prepareRequestInfo)
+	return nil
+}
+
+func (recv *psRepreparer) trackSuccess() {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	recv.report.Reprepared++
+}
+
+func (recv *psRepreparer) trackFailure(err error) {
+	log.Warnf("%v", err)
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	recv.report.Failed++
+	recv.report.Errors = append(recv.report.Errors, err.Error())
+	if len(recv.report.Errors) > maxReprepareReportErrors {
+		recv.report.Errors = recv.report.Errors[len(recv.report.Errors)-maxReprepareReportErrors:]
+	}
+}
+
+// getReport returns the progress of the current (or last) re-preparation, nil if there wasn't one yet.
+func (recv *psRepreparer) getReport() *PreparedStatementReprepareReport {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	return recv.copyReport()
+}
+
+// should be called with a lock on recv.lock
+func (recv *psRepreparer) copyReport() *PreparedStatementReprepareReport {
+	if recv.report == nil {
+		return nil
+	}
+	report := *recv.report
+	report.Errors = append([]string{}, recv.report.Errors...)
+	return &report
+}
+
+// ReprepareStatements prepares every statement of the prepared statement cache again on each assigned host of both
+// clusters and updates the cache with the new prepared ids. It runs in the background, use
+// GetReprepareStatementsReport to follow its progress.
+func (p *ZdmProxy) ReprepareStatements() (*PreparedStatementReprepareReport, error) {
+	if p.PreparedStatementCache == nil {
+		return nil, errors.New("the prepared statement cache is disabled")
+	}
+
+	ctx := p.controlConnShutdownCtx
+	originConns, err := p.originControlConn.OpenAssignedHostConnections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	targetConns, err := p.targetControlConn.OpenAssignedHostConnections(ctx)
+	if err != nil {
+		newClusterConnections(common.ClusterTypeOrigin, originConns).close()
+		return nil, err
+	}
+
+	return p.psRepreparer.start(ctx, p.controlConnShutdownWg,
+		newClusterConnections(common.ClusterTypeOrigin, originConns),
+		newClusterConnections(common.ClusterTypeTarget, targetConns))
+}
+
+// GetReprepareStatementsReport returns the progress of the current (or last) re-preparation of the prepared statement
+// cache, nil if ReprepareStatements was never called.
+func (p *ZdmProxy) GetReprepareStatementsReport() *PreparedStatementReprepareReport {
+	return p.psRepreparer.getReport()
+}
@@ -0,0 +1,194 @@
+package zdmproxy
+
+import (
+	"context"
+	"errors"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+// fakeReprepareConn returns a PREPARED result with the configured prepared id for every PREPARE
+// and records the requests that it received.
+type fakeReprepareConn struct {
+	preparedId []byte
+	err        error
+	release    chan bool
+
+	lock     *sync.Mutex
+	requests []string
+	closed   bool
+}
+
+func newFakeReprepareConn(preparedId string) *fakeReprepareConn {
+	return &fakeReprepareConn{preparedId: []byte(preparedId), lock: &sync.Mutex{}}
+}
+
+func (recv *fakeReprepareConn) Execute(msg message.Message, _ context.Context) (message.Message, error) {
+	if recv.release != nil {
+		<-recv.release
+	}
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	switch typedMsg := msg.(type) {
+	case *message.Query:
+		recv.requests = append(recv.requests, typedMsg.Query)
+		return &message.SetKeyspaceResult{}, nil
+	case *message.Prepare:
+		recv.requests = append(recv.requests, "PREPARE "+typedMsg.Query)
+		if recv.err != nil {
+			return &message.ServerError{ErrorMessage: recv.err.Error()}, nil
+		}
+		return &message.PreparedResult{PreparedQueryId: recv.preparedId}, nil
+	default:
+		return nil, errors.New("unexpected request")
+	}
+}
+
+func (recv *fakeReprepareConn) getRequests() []string {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	return append([]string{}, recv.requests...)
+}
+
+func (recv *fakeReprepareConn) Close() error {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	recv.closed = true
+	return nil
+}
+
+func (recv *fakeReprepareConn) isClosed() bool {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	return recv.closed
+}
+
+func (recv *fakeReprepareConn) IsInitialized() bool {
+	return true
+}
+
+func (recv *fakeReprepareConn) InitializeContext(primitive.ProtocolVersion, context.Context) error {
+	return nil
+}
+
+func (recv *fakeReprepareConn) SendAndReceive(*frame.Frame, context.Context) (*frame.Frame, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (recv *fakeReprepareConn) Query(string, *GenericTypeCodec, primitive.ProtocolVersion, context.Context) (*ParsedRowSet, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (recv *fakeReprepareConn) SendHeartbeat(context.Context) error {
+	return nil
+}
+
+func (recv *fakeReprepareConn) SetEventHandler(func(f *frame.Frame, conn CqlConnection)) {
+}
+
+func (recv *fakeReprepareConn) SubscribeToProtocolEvents(context.Context, []primitive.EventType) error {
+	return nil
+}
+
+func (recv *fakeReprepareConn) IsAuthEnabled() (bool, error) {
+	return false, nil
+}
+
+func newReprepareTestCache() *PreparedStatementCache {
+	psCache := NewPreparedStatementCache(0)
+	prepareRequestInfo := NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "SELECT * FROM t", "")
+	prepareRequestInfo.requestKeyspace = "ks1"
+	psCache.Store(
+		&message.PreparedResult{PreparedQueryId: []byte("origin")},
+		&message.PreparedResult{PreparedQueryId: []byte("target-old")},
+		prepareRequestInfo)
+	return psCache
+}
+
+func TestPsRepreparer_UpdatesCache(t *testing.T) {
+	psCache := newReprepareTestCache()
+	originConn := newFakeReprepareConn("origin")
+	targetConn1, targetConn2 := newFakeReprepareConn("target-new"), newFakeReprepareConn("target-new")
+
+	repreparer := newPsRepreparer(psCache, 1000)
+	require.Nil(t, repreparer.getReport())
+	wg := &sync.WaitGroup{}
+	report, err := repreparer.start(context.Background(), wg,
+		newClusterConnections(common.ClusterTypeOrigin, []CqlConnection{originConn}),
+		newClusterConnections(common.ClusterTypeTarget, []CqlConnection{targetConn1, targetConn2}))
+	require.Nil(t, err)
+	require.Equal(t, 1, report.Total)
+	wg.Wait()
+
+	report = repreparer.getReport()
+	require.False(t, report.Running)
+	require.Equal(t, 1, report.Reprepared)
+	require.Equal(t, 0, report.Failed)
+
+	// the statement is prepared on every host in the keyspace it was originally prepared in
+	for _, conn := range []*fakeReprepareConn{originConn, targetConn1, targetConn2} {
+		require.Equal(t, []string{"USE \"ks1\"", "PREPARE SELECT * FROM t"}, conn.getRequests())
+		require.True(t, conn.isClosed())
+	}
+
+	data, ok := psCache.GetByTargetPreparedId([]byte("target-new"))
+	require.True(t, ok)
+	require.Equal(t, []byte("origin"), data.GetOriginPreparedId())
+	require.Equal(t, "SELECT * FROM t", data.GetPrepareRequestInfo().GetQuery())
+	_, ok = psCache.GetByTargetPreparedId([]byte("target-old"))
+	require.False(t, ok)
+}
+
+func TestPsRepreparer_Failure(t *testing.T) {
+	psCache := newReprepareTestCache()
+	targetConn := newFakeReprepareConn("target-new")
+	targetConn.err = errors.New("keyspace ks1 does not exist")
+
+	repreparer := newPsRepreparer(psCache, 1000)
+	wg := &sync.WaitGroup{}
+	_, err := repreparer.start(context.Background(), wg,
+		newClusterConnections(common.ClusterTypeOrigin, []CqlConnection{newFakeReprepareConn("origin")}),
+		newClusterConnections(common.ClusterTypeTarget, []CqlConnection{targetConn}))
+	require.Nil(t, err)
+	wg.Wait()
+
+	report := repreparer.getReport()
+	require.Equal(t, 0, report.Reprepared)
+	require.Equal(t, 1, report.Failed)
+	require.Len(t, report.Errors, 1)
+	require.Contains(t, report.Errors[0], "keyspace ks1 does not exist")
+
+	data, ok := psCache.GetByTargetPreparedId([]byte("target-old"))
+	require.True(t, ok)
+	require.Equal(t, []byte("origin"), data.GetOriginPreparedId())
+}
+
+func TestPsRepreparer_AlreadyRunning(t *testing.T) {
+	psCache := newReprepareTestCache()
+	originConn := newFakeReprepareConn("origin")
+	originConn.release = make(chan bool)
+
+	repreparer := newPsRepreparer(psCache, 1000)
+	wg := &sync.WaitGroup{}
+	_, err := repreparer.start(context.Background(), wg,
+		newClusterConnections(common.ClusterTypeOrigin, []CqlConnection{originConn}),
+		newClusterConnections(common.ClusterTypeTarget, []CqlConnection{newFakeReprepareConn("target")}))
+	require.Nil(t, err)
+
+	otherConn := newFakeReprepareConn("origin")
+	report, err := repreparer.start(context.Background(), wg,
+		newClusterConnections(common.ClusterTypeOrigin, []CqlConnection{otherConn}),
+		newClusterConnections(common.ClusterTypeTarget, []CqlConnection{}))
+	require.True(t, errors.Is(err, ReprepareAlreadyRunningErr))
+	require.True(t, report.Running)
+	require.True(t, otherConn.isClosed())
+
+	close(originConn.release)
+	wg.Wait()
+	require.False(t, repreparer.getReport().Running)
+}
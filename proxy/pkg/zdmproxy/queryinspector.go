@@ -60,6 +60,10 @@ type QueryInfo interface {
 	// when this request was parsed (getRequestKeyspace()).
 	getApplicableKeyspace() string
 
+	// Returns the applicable keyspace of every table in the query (e.g. all child statements of a BATCH)
+	// or the keyspace of a USE statement. If there are no tables, it returns getApplicableKeyspace() only.
+	getApplicableKeyspaces() []string
+
 	// Below methods are only relevant for INSERT statements,
 	// or BATCH statements containing INSERT statements.
 
@@ -306,6 +310,9 @@ type cqlListener struct {
 	keyspaceName  string
 	tableName     string
 
+	// applicable keyspaces of all the tables in the statement (and the keyspace of USE statements)
+	applicableKeyspaces []string
+
 	// Only filled in for SELECT statements on system.local or system.peers tables
 	parsedSelectClause *selectClause
 
@@ -352,6 +359,13 @@ func (l *cqlListener) getApplicableKeyspace() string {
 	return l.getRequestKeyspace()
 }
 
+func (l *cqlListener) getApplicableKeyspaces() []string {
+	if len(l.applicableKeyspaces) == 0 {
+		return []string{l.getApplicableKeyspace()}
+	}
+	return l.applicableKeyspaces
+}
+
 func (l *cqlListener) getParsedStatements() []*parsedStatement {
 	return l.parsedStatements
 }
@@ -518,6 +532,7 @@ func (l *cqlListener) EnterBatchStatement(ctx *parser.BatchStatementContext) {
 
 func (l *cqlListener) EnterUseStatement(ctx *parser.UseStatementContext) {
 	l.keyspaceName = extractIdentifier(ctx.KeyspaceName().(*parser.KeyspaceNameContext).Identifier().(*parser.IdentifierContext))
+	l.applicableKeyspaces = append(l.applicableKeyspaces, l.keyspaceName)
 }
 
 func (l *cqlListener) EnterTableName(ctx *parser.TableNameContext) {
@@ -526,12 +541,14 @@ func (l *cqlListener) EnterTableName(ctx *parser.TableNameContext) {
 	if qualifiedId.GetChildCount() == 1 {
 		identifierContext := qualifiedId.GetChild(0).(*parser.IdentifierContext)
 		l.tableName = extractIdentifier(identifierContext)
+		l.applicableKeyspaces = append(l.applicableKeyspaces, l.requestKeyspace)
 	} else {
 		// 3 children: keyspaceName, token DOT, identifier
 		keyspaceNameContext := qualifiedId.GetChild(0)
 		l.keyspaceName = extractIdentifier(keyspaceNameContext.GetChild(0).(*parser.IdentifierContext))
 		identifierContext := qualifiedId.GetChild(2).(*parser.IdentifierContext)
 		l.tableName = extractIdentifier(identifierContext)
+		l.applicableKeyspaces = append(l.applicableKeyspaces, l.keyspaceName)
 	}
 }
 
@@ -892,6 +909,7 @@ func (l *cqlListener) shallowClone() *cqlListener {
 		statementType:             l.statementType,
 		keyspaceName:              l.keyspaceName,
 		tableName:                 l.tableName,
+		applicableKeyspaces:       l.applicableKeyspaces,
 		parsedStatements:          l.parsedStatements,
 		positionalBindMarkers:     l.positionalBindMarkers,
 		namedBindMarkers:          l.namedBindMarkers,
@@ -51,11 +51,13 @@ func (recv *QueryModifier) replaceQueryString(currentKeyspace string, context *f
 		return nil, nil, fmt.Errorf("could not replace query string in request '%v': %w", requestType, err)
 	}
 
-	newRawFrame, err := defaultCodec.ConvertToRawFrame(newFrame)
+	newRawFrame, err := context.codec.get().ConvertToRawFrame(newFrame)
 	if err != nil {
 		return nil, nil, fmt.Errorf("could not convert modified frame to raw frame: %w", err)
 	}
-	return NewInitializedFrameDecodeContext(newRawFrame, newFrame, newStatementsQueryData), replacedTerms, nil
+	newContext := NewInitializedFrameDecodeContext(newRawFrame, newFrame, newStatementsQueryData)
+	newContext.codec = context.codec
+	return newContext, replacedTerms, nil
 }
 
 func (recv *QueryModifier) replaceQueryInBatchMessage(
@@ -0,0 +1,78 @@
+package zdmproxy
+
+import (
+	"github.com/antlr/antlr4/runtime/Go/antlr"
+	parser "github.com/datastax/zdm-proxy/antlr"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"strings"
+	"sync"
+)
+
+var normalizerLexerPool = sync.Pool{New: func() interface{} {
+	lexer := parser.NewSimplifiedCqlLexer(nil)
+	lexer.RemoveErrorListeners()
+	return lexer
+}}
+
+// normalizeQuery returns a representation of the query that can be used to compare or deduplicate queries that only
+// differ in ways that don't matter to the given level:
+//
+//   - WHITESPACE removes comments and collapses whitespace
+//   - CASE also lower cases keywords and unquoted identifiers
+//   - LITERALS also replaces literal values (strings, numbers, booleans, uuids, etc.) with ?
+//
+// String literals and quoted identifiers are never modified by the first two levels so keywords or whitespace
+// inside of them are preserved. The result is only meant to be compared, it is not always a valid query.
+func normalizeQuery(query string, level common.QueryNormalizationLevel) string {
+	lexer := normalizerLexerPool.Get().(*parser.SimplifiedCqlLexer)
+	defer normalizerLexerPool.Put(lexer)
+	// a comment that starts with -- or // is only terminated by a line break
+	input := []rune(query + "\n")
+	lexer.SetInputStream(antlr.NewInputStream(string(input)))
+
+	sb := strings.Builder{}
+	pendingSpace := false
+	write := func(s string) {
+		if pendingSpace && sb.Len() > 0 {
+			sb.WriteString(" ")
+		}
+		pendingSpace = false
+		sb.WriteString(s)
+	}
+
+	next := 0
+	for token := lexer.NextToken(); token.GetTokenType() != antlr.TokenEOF; token = lexer.NextToken() {
+		if token.GetStart() > next {
+			// characters that the lexer doesn't recognize are skipped so they are copied as is
+			write(string(input[next:token.GetStart()]))
+		}
+		next = token.GetStop() + 1
+
+		switch token.GetTokenType() {
+		case parser.SimplifiedCqlLexerWS, parser.SimplifiedCqlLexerCOMMENT, parser.SimplifiedCqlLexerMULTILINE_COMMENT:
+			pendingSpace = true
+		case parser.SimplifiedCqlLexerQUOTED_IDENTIFIER:
+			write(token.GetText())
+		case parser.SimplifiedCqlLexerSTRING_LITERAL, parser.SimplifiedCqlLexerINTEGER, parser.SimplifiedCqlLexerFLOAT,
+			parser.SimplifiedCqlLexerBOOLEAN, parser.SimplifiedCqlLexerDURATION, parser.SimplifiedCqlLexerUUID,
+			parser.SimplifiedCqlLexerHEXNUMBER:
+			if level == common.QueryNormalizationLevelLiterals {
+				write("?")
+			} else if level == common.QueryNormalizationLevelCase && token.GetTokenType() != parser.SimplifiedCqlLexerSTRING_LITERAL {
+				write(strings.ToLower(token.GetText()))
+			} else {
+				write(token.GetText())
+			}
+		default:
+			if level == common.QueryNormalizationLevelWhitespace || level == common.QueryNormalizationLevelUndefined {
+				write(token.GetText())
+			} else {
+				write(strings.ToLower(token.GetText()))
+			}
+		}
+	}
+	if next < len(input) {
+		write(string(input[next:]))
+	}
+	return strings.TrimSpace(sb.String())
+}
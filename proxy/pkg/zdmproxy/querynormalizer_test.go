@@ -0,0 +1,67 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		whitespace string
+		lowerCase  string
+		literals   string
+	}{
+		{"whitespace",
+			"  SELECT *\n\tFROM ks.t   WHERE a = ?  ",
+			"SELECT * FROM ks.t WHERE a = ?",
+			"select * from ks.t where a = ?",
+			"select * from ks.t where a = ?"},
+		{"comments",
+			"SELECT * /* all\ncolumns */ FROM ks.t -- trailing\nWHERE a = ? // trailing",
+			"SELECT * FROM ks.t WHERE a = ?",
+			"select * from ks.t where a = ?",
+			"select * from ks.t where a = ?"},
+		{"comment between tokens",
+			"SELECT a/**/FROM ks.t",
+			"SELECT a FROM ks.t",
+			"select a from ks.t",
+			"select a from ks.t"},
+		{"string literal containing keywords and whitespace",
+			"INSERT INTO ks.t (a, b) VALUES (1, 'SELECT  *  FROM -- not a comment')",
+			"INSERT INTO ks.t (a, b) VALUES (1, 'SELECT  *  FROM -- not a comment')",
+			"insert into ks.t (a, b) values (1, 'SELECT  *  FROM -- not a comment')",
+			"insert into ks.t (a, b) values (?, ?)"},
+		{"string literal containing a comment",
+			"SELECT * FROM ks.t WHERE a = '/* X */'",
+			"SELECT * FROM ks.t WHERE a = '/* X */'",
+			"select * from ks.t where a = '/* X */'",
+			"select * from ks.t where a = ?"},
+		{"quoted identifier",
+			"SELECT \"MyColumn\"  FROM \"MyKs\".\"Select\"",
+			"SELECT \"MyColumn\" FROM \"MyKs\".\"Select\"",
+			"select \"MyColumn\" from \"MyKs\".\"Select\"",
+			"select \"MyColumn\" from \"MyKs\".\"Select\""},
+		{"other literals",
+			"UPDATE ks.t USING TTL 100 SET b = 1.5, c = TRUE, d = 1h30m, e = 0xCAFE WHERE id = 50554D6E-29BB-11E5-B345-FEFF819CDC9F",
+			"UPDATE ks.t USING TTL 100 SET b = 1.5, c = TRUE, d = 1h30m, e = 0xCAFE WHERE id = 50554D6E-29BB-11E5-B345-FEFF819CDC9F",
+			"update ks.t using ttl 100 set b = 1.5, c = true, d = 1h30m, e = 0xcafe where id = 50554d6e-29bb-11e5-b345-feff819cdc9f",
+			"update ks.t using ttl ? set b = ?, c = ?, d = ?, e = ? where id = ?"},
+		{"unrecognized characters",
+			"SELECT  ~ FROM ks.t",
+			"SELECT ~ FROM ks.t",
+			"select ~ from ks.t",
+			"select ~ from ks.t"},
+		{"empty", "  ", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.whitespace, normalizeQuery(tt.query, common.QueryNormalizationLevelWhitespace))
+			require.Equal(t, tt.lowerCase, normalizeQuery(tt.query, common.QueryNormalizationLevelCase))
+			require.Equal(t, tt.literals, normalizeQuery(tt.query, common.QueryNormalizationLevelLiterals))
+		})
+	}
+}
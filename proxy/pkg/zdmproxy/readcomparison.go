@@ -0,0 +1,342 @@
+package zdmproxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"strings"
+)
+
+type readMismatch int
+
+const (
+	readMatch = readMismatch(iota)
+	readMismatchTargetExtraRows
+	readMismatchOriginExtraRows
+	readMismatchValuesDiffer
+)
+
+func (m readMismatch) String() string {
+	switch m {
+	case readMatch:
+		return "MATCH"
+	case readMismatchTargetExtraRows:
+		return "TARGET_EXTRA_ROWS"
+	case readMismatchOriginExtraRows:
+		return "ORIGIN_EXTRA_ROWS"
+	case readMismatchValuesDiffer:
+		return "VALUES_DIFFER"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// compareRaceRead compares the rows that both clusters returned for a race read once the slower cluster responded,
+// see ZDM_READ_COMPARISON_ENABLED. Reads that failed or timed out on a cluster are not compared.
+func (ch *ClientHandler) compareRaceRead(reqCtx *requestContextImpl) {
+	if !ch.conf.ReadComparisonEnabled || !isRaceRead(reqCtx.requestInfo) || !reqCtx.requestInfo.ShouldBeTrackedInMetrics() {
+		return
+	}
+
+	originResponse, targetResponse, _ := reqCtx.getRaceResponses()
+	originRows := ch.decodeComparableRows(reqCtx, originResponse, common.ClusterTypeOrigin)
+	if originRows == nil {
+		return
+	}
+	targetRows := ch.decodeComparableRows(reqCtx, targetResponse, common.ClusterTypeTarget)
+	if targetRows == nil {
+		return
+	}
+
+	mismatch, originOnlyRows, targetOnlyRows := compareRows(originRows.Data, targetRows.Data)
+	if mismatch == readMatch {
+		ch.compareRaceReadMetadata(reqCtx, originRows.Metadata, targetRows.Metadata)
+		return
+	}
+
+	report := MismatchReport{
+		Columns:        originRows.Metadata.Columns,
+		OriginOnlyRows: originOnlyRows,
+		TargetOnlyRows: targetOnlyRows,
+	}
+	proxyMetrics := ch.metricHandler.GetProxyMetrics()
+	switch mismatch {
+	case readMismatchTargetExtraRows:
+		proxyMetrics.ReadMismatchesTargetExtraRows.Add(1)
+		report.Category, report.Cluster = MismatchCategoryTargetExtraRows, common.ClusterTypeTarget
+	case readMismatchOriginExtraRows:
+		proxyMetrics.ReadMismatchesOriginExtraRows.Add(1)
+		report.Category, report.Cluster = MismatchCategoryOriginExtraRows, common.ClusterTypeOrigin
+	case readMismatchValuesDiffer:
+		proxyMetrics.ReadMismatchesValuesDiffer.Add(1)
+		report.Category, report.Cluster = MismatchCategoryValuesDiffer, common.ClusterTypeNone
+	}
+	ch.reportMismatch(reqCtx.requestInfo, reqCtx.request, report)
+
+	logger := reqCtx.logger()
+	if mismatch == readMismatchTargetExtraRows && ch.targetAheadMode == common.ReadComparisonTargetAheadModeExpected {
+		logger.Debugf("%v returned %d rows that %v did not return, this is expected while %v is ahead.",
+			common.ClusterTypeTarget, len(targetOnlyRows), common.ClusterTypeOrigin, common.ClusterTypeTarget)
+		return
+	}
+	logger.Warnf("Read mismatch (%v): %d rows were only returned by %v and %d rows were only returned by %v.",
+		mismatch, len(originOnlyRows), common.ClusterTypeOrigin, len(targetOnlyRows), common.ClusterTypeTarget)
+}
+
+// compareRaceReadMetadata compares the column metadata of results whose rows are equal so that metadata differences
+// are counted separately from data differences, see ZDM_READ_COMPARISON_METADATA_MODE.
+func (ch *ClientHandler) compareRaceReadMetadata(
+	reqCtx *requestContextImpl, originMetadata *message.RowsMetadata, targetMetadata *message.RowsMetadata) {
+	if ch.metadataMode == common.ReadComparisonMetadataModeIgnore {
+		return
+	}
+	difference := getMetadataDifference(
+		originMetadata.Columns, targetMetadata.Columns, ch.metadataMode != common.ReadComparisonMetadataModeStrict)
+	if difference == "" {
+		return
+	}
+
+	ch.metricHandler.GetProxyMetrics().ReadMismatchesMetadataOnly.Add(1)
+	ch.reportMismatch(reqCtx.requestInfo, reqCtx.request, MismatchReport{
+		Category:      MismatchCategoryMetadataOnly,
+		Cluster:       common.ClusterTypeNone,
+		Columns:       originMetadata.Columns,
+		TargetColumns: targetMetadata.Columns,
+	})
+	reqCtx.logger().Debugf("Read mismatch (%v): both clusters returned the same rows but %v.",
+		MismatchCategoryMetadataOnly, difference)
+}
+
+// decodeComparableRows returns the rows of a successful ROWS result that fits in a single page, nil otherwise.
+func (ch *ClientHandler) decodeComparableRows(
+	reqCtx *requestContextImpl, response *frame.RawFrame, cluster common.ClusterType) *message.RowsResult {
+	if response == nil || response.Header.OpCode != primitive.OpCodeResult {
+		return nil
+	}
+
+	decodedFrame, err := ch.codec.get().ConvertFromRawFrame(response)
+	if err != nil {
+		reqCtx.logger().Warnf("Could not decode the response of %v to compare it: %v", cluster, err)
+		return nil
+	}
+	rowsResult, ok := decodedFrame.Body.Message.(*message.RowsResult)
+	if !ok || rowsResult.Metadata == nil || rowsResult.Metadata.PagingState != nil {
+		return nil
+	}
+	return rowsResult
+}
+
+// compareRows compares the rows returned by both clusters regardless of their order and returns the category of the
+// mismatch with the rows that were only returned by each cluster. Rows are compared as a whole because the primary
+// key columns are not known, a row that has a different value on each cluster is a row that only ORIGIN returned and
+// another row that only TARGET returned.
+func compareRows(
+	originRows message.RowSet, targetRows message.RowSet) (mismatch readMismatch, originOnlyRows message.RowSet, targetOnlyRows message.RowSet) {
+	counts := make(map[string]int, len(originRows))
+	for _, row := range originRows {
+		counts[getRowKey(row)]++
+	}
+	for _, row := range targetRows {
+		key := getRowKey(row)
+		if counts[key] > 0 {
+			counts[key]--
+		} else {
+			targetOnlyRows = append(targetOnlyRows, row)
+		}
+	}
+	for _, row := range originRows {
+		key := getRowKey(row)
+		if counts[key] > 0 {
+			counts[key]--
+			originOnlyRows = append(originOnlyRows, row)
+		}
+	}
+
+	switch {
+	case len(originOnlyRows) == 0 && len(targetOnlyRows) == 0:
+		return readMatch, nil, nil
+	case len(originOnlyRows) == 0:
+		return readMismatchTargetExtraRows, originOnlyRows, targetOnlyRows
+	case len(targetOnlyRows) == 0:
+		return readMismatchOriginExtraRows, originOnlyRows, targetOnlyRows
+	default:
+		return readMismatchValuesDiffer, originOnlyRows, targetOnlyRows
+	}
+}
+
+// getRowKey returns the encoded values of the row, each value is prefixed with its length (-1 for null values) so
+// that different rows never have the same key.
+func getRowKey(row message.Row) string {
+	sb := strings.Builder{}
+	lengthBuf := make([]byte, 4)
+	for _, column := range row {
+		length := int32(-1)
+		if column != nil {
+			length = int32(len(column))
+		}
+		binary.BigEndian.PutUint32(lengthBuf, uint32(length))
+		sb.Write(lengthBuf)
+		sb.Write(column)
+	}
+	return sb.String()
+}
+
+// getMetadataDifference describes the first difference between the columns returned by both clusters, an empty string
+// is returned if they are equivalent. Results without metadata (see the SKIP_METADATA flag) are not compared. If
+// normalize is true, the differences that don't change how the values are encoded are ignored, see normalizeDataType.
+func getMetadataDifference(
+	originColumns []*message.ColumnMetadata, targetColumns []*message.ColumnMetadata, normalize bool) string {
+	if originColumns == nil || targetColumns == nil {
+		return ""
+	}
+	if len(originColumns) != len(targetColumns) {
+		return fmt.Sprintf("%v returned %d columns and %v returned %d columns",
+			common.ClusterTypeOrigin, len(originColumns), common.ClusterTypeTarget, len(targetColumns))
+	}
+	for i, originColumn := range originColumns {
+		targetColumn := targetColumns[i]
+		if originColumn.Name != targetColumn.Name {
+			return fmt.Sprintf("column %d is named %v on %v and %v on %v",
+				i, originColumn.Name, common.ClusterTypeOrigin, targetColumn.Name, common.ClusterTypeTarget)
+		}
+		if !normalize && (originColumn.Keyspace != targetColumn.Keyspace || originColumn.Table != targetColumn.Table) {
+			return fmt.Sprintf("column %v belongs to %v.%v on %v and to %v.%v on %v",
+				originColumn.Name, originColumn.Keyspace, originColumn.Table, common.ClusterTypeOrigin,
+				targetColumn.Keyspace, targetColumn.Table, common.ClusterTypeTarget)
+		}
+		if getDataTypeKey(originColumn.Type, normalize) != getDataTypeKey(targetColumn.Type, normalize) {
+			return fmt.Sprintf("column %v is a %v on %v and a %v on %v",
+				originColumn.Name, originColumn.Type, common.ClusterTypeOrigin, targetColumn.Type, common.ClusterTypeTarget)
+		}
+	}
+	return ""
+}
+
+func getDataTypeKey(dataType datatype.DataType, normalize bool) string {
+	if dataType == nil {
+		return ""
+	}
+	if !normalize {
+		return dataType.String()
+	}
+	return normalizeDataType(dataType)
+}
+
+const marshalTypePrefix = "org.apache.cassandra.db.marshal."
+
+// marshalTypes maps the Cassandra class names of the native types (as returned in custom types) to the native types.
+var marshalTypes = map[string]datatype.DataType{
+	"AsciiType":         datatype.Ascii,
+	"LongType":          datatype.Bigint,
+	"BytesType":         datatype.Blob,
+	"BooleanType":       datatype.Boolean,
+	"CounterColumnType": datatype.Counter,
+	"SimpleDateType":    datatype.Date,
+	"DecimalType":       datatype.Decimal,
+	"DoubleType":        datatype.Double,
+	"DurationType":      datatype.Duration,
+	"FloatType":         datatype.Float,
+	"InetAddressType":   datatype.Inet,
+	"Int32Type":         datatype.Int,
+	"ShortType":         datatype.Smallint,
+	"TimeType":          datatype.Time,
+	"TimestampType":     datatype.Timestamp,
+	"TimeUUIDType":      datatype.Timeuuid,
+	"ByteType":          datatype.Tinyint,
+	"UUIDType":          datatype.Uuid,
+	"UTF8Type":          datatype.Varchar,
+	"IntegerType":       datatype.Varint,
+}
+
+// normalizeDataType returns a description of the data type that is the same for the types whose values are encoded
+// the same way: the native types and collections that are described by their Cassandra class name in a custom type,
+// frozen and reversed types, and user defined types of different keyspaces.
+func normalizeDataType(dataType datatype.DataType) string {
+	switch dataType.GetDataTypeCode() {
+	case primitive.DataTypeCodeCustom:
+		if customType, ok := dataType.(datatype.CustomType); ok {
+			return normalizeMarshalType(customType.GetClassName())
+		}
+	case primitive.DataTypeCodeList:
+		if listType, ok := dataType.(datatype.ListType); ok {
+			return fmt.Sprintf("list<%v>", normalizeDataType(listType.GetElementType()))
+		}
+	case primitive.DataTypeCodeSet:
+		if setType, ok := dataType.(datatype.SetType); ok {
+			return fmt.Sprintf("set<%v>", normalizeDataType(setType.GetElementType()))
+		}
+	case primitive.DataTypeCodeMap:
+		if mapType, ok := dataType.(datatype.MapType); ok {
+			return fmt.Sprintf("map<%v,%v>", normalizeDataType(mapType.GetKeyType()), normalizeDataType(mapType.GetValueType()))
+		}
+	case primitive.DataTypeCodeTuple:
+		if tupleType, ok := dataType.(datatype.TupleType); ok {
+			fieldTypes := make([]string, 0, len(tupleType.GetFieldTypes()))
+			for _, fieldType := range tupleType.GetFieldTypes() {
+				fieldTypes = append(fieldTypes, normalizeDataType(fieldType))
+			}
+			return fmt.Sprintf("tuple<%v>", strings.Join(fieldTypes, ","))
+		}
+	case primitive.DataTypeCodeUdt:
+		if udtType, ok := dataType.(datatype.UserDefinedType); ok {
+			fields := make([]string, 0, len(udtType.GetFieldTypes()))
+			for i, fieldType := range udtType.GetFieldTypes() {
+				fields = append(fields, fmt.Sprintf("%v:%v", udtType.GetFieldNames()[i], normalizeDataType(fieldType)))
+			}
+			return fmt.Sprintf("%v{%v}", udtType.GetName(), strings.Join(fields, ","))
+		}
+	}
+	return dataType.String()
+}
+
+// normalizeMarshalType returns the description of normalizeDataType for a Cassandra class name, e.g.
+// org.apache.cassandra.db.marshal.ListType(org.apache.cassandra.db.marshal.Int32Type) is list<int>. Class names that
+// are not known are returned as they are.
+func normalizeMarshalType(className string) string {
+	name, parameters := parseMarshalType(className)
+	switch {
+	case (name == "FrozenType" || name == "ReversedType") && len(parameters) == 1:
+		return normalizeMarshalType(parameters[0])
+	case name == "ListType" && len(parameters) == 1:
+		return fmt.Sprintf("list<%v>", normalizeMarshalType(parameters[0]))
+	case name == "SetType" && len(parameters) == 1:
+		return fmt.Sprintf("set<%v>", normalizeMarshalType(parameters[0]))
+	case name == "MapType" && len(parameters) == 2:
+		return fmt.Sprintf("map<%v,%v>", normalizeMarshalType(parameters[0]), normalizeMarshalType(parameters[1]))
+	}
+	if nativeType, ok := marshalTypes[name]; ok && len(parameters) == 0 {
+		return nativeType.String()
+	}
+	return className
+}
+
+// parseMarshalType splits a Cassandra class name into the simple name of the class and its type parameters.
+func parseMarshalType(className string) (string, []string) {
+	className = strings.TrimPrefix(strings.TrimSpace(className), marshalTypePrefix)
+	start := strings.Index(className, "(")
+	if start < 0 || !strings.HasSuffix(className, ")") {
+		return className, nil
+	}
+
+	var parameters []string
+	depth, parameterStart := 0, start+1
+	for i := start + 1; i < len(className)-1; i++ {
+		switch className[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parameters = append(parameters, className[parameterStart:i])
+				parameterStart = i + 1
+			}
+		}
+	}
+	parameters = append(parameters, className[parameterStart:len(className)-1])
+	return className[:start], parameters
+}
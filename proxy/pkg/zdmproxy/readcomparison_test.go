@@ -0,0 +1,362 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/datatype"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCompareRows(t *testing.T) {
+	row := func(values ...string) message.Row {
+		r := make(message.Row, 0, len(values))
+		for _, value := range values {
+			if value == "null" {
+				r = append(r, nil)
+			} else {
+				r = append(r, []byte(value))
+			}
+		}
+		return r
+	}
+
+	tests := []struct {
+		name                   string
+		originRows             message.RowSet
+		targetRows             message.RowSet
+		expectedMismatch       readMismatch
+		expectedOriginOnlyRows int
+		expectedTargetOnlyRows int
+	}{
+		{
+			name:             "same rows in a different order",
+			originRows:       message.RowSet{row("1", "a"), row("2", "b")},
+			targetRows:       message.RowSet{row("2", "b"), row("1", "a")},
+			expectedMismatch: readMatch,
+		},
+		{
+			name:             "no rows",
+			expectedMismatch: readMatch,
+		},
+		{
+			name:                   "target has extra rows",
+			originRows:             message.RowSet{row("1", "a")},
+			targetRows:             message.RowSet{row("1", "a"), row("2", "b"), row("3", "c")},
+			expectedMismatch:       readMismatchTargetExtraRows,
+			expectedTargetOnlyRows: 2,
+		},
+		{
+			name:                   "origin has extra rows",
+			originRows:             message.RowSet{row("1", "a"), row("1", "a")},
+			targetRows:             message.RowSet{row("1", "a")},
+			expectedMismatch:       readMismatchOriginExtraRows,
+			expectedOriginOnlyRows: 1,
+		},
+		{
+			name:                   "values differ",
+			originRows:             message.RowSet{row("1", "a"), row("2", "b")},
+			targetRows:             message.RowSet{row("1", "a"), row("2", "c")},
+			expectedMismatch:       readMismatchValuesDiffer,
+			expectedOriginOnlyRows: 1,
+			expectedTargetOnlyRows: 1,
+		},
+		{
+			name:                   "null and empty values differ",
+			originRows:             message.RowSet{row("1", "null")},
+			targetRows:             message.RowSet{row("1", "")},
+			expectedMismatch:       readMismatchValuesDiffer,
+			expectedOriginOnlyRows: 1,
+			expectedTargetOnlyRows: 1,
+		},
+		{
+			name:                   "values are not concatenated",
+			originRows:             message.RowSet{row("ab", "c")},
+			targetRows:             message.RowSet{row("a", "bc")},
+			expectedMismatch:       readMismatchValuesDiffer,
+			expectedOriginOnlyRows: 1,
+			expectedTargetOnlyRows: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mismatch, originOnlyRows, targetOnlyRows := compareRows(tt.originRows, tt.targetRows)
+			require.Equal(t, tt.expectedMismatch, mismatch)
+			require.Len(t, originOnlyRows, tt.expectedOriginOnlyRows)
+			require.Len(t, targetOnlyRows, tt.expectedTargetOnlyRows)
+		})
+	}
+}
+
+func TestCompareRaceRead(t *testing.T) {
+	rows := func(values ...string) *frame.RawFrame {
+		rowSet := message.RowSet{}
+		for _, value := range values {
+			rowSet = append(rowSet, message.Row{[]byte(value)})
+		}
+		return mustEncodeFrame(t, &message.RowsResult{Metadata: &message.RowsMetadata{ColumnCount: 1}, Data: rowSet})
+	}
+	rowsWithColumn := func(column *message.ColumnMetadata, values ...string) *frame.RawFrame {
+		rowSet := message.RowSet{}
+		for _, value := range values {
+			rowSet = append(rowSet, message.Row{[]byte(value)})
+		}
+		return mustEncodeFrame(t, &message.RowsResult{
+			Metadata: &message.RowsMetadata{ColumnCount: 1, Columns: []*message.ColumnMetadata{column}},
+			Data:     rowSet})
+	}
+	pagedRows := mustEncodeFrame(t, &message.RowsResult{
+		Metadata: &message.RowsMetadata{ColumnCount: 1, PagingState: []byte{1}},
+		Data:     message.RowSet{{[]byte("a")}}})
+	unavailable := mustEncodeFrame(t, &message.Unavailable{
+		ErrorMessage: "unavailable", Consistency: primitive.ConsistencyLevelLocalQuorum})
+
+	tests := []struct {
+		name                    string
+		targetAheadMode         common.ReadComparisonTargetAheadMode
+		metadataMode            common.ReadComparisonMetadataMode
+		originResponse          *frame.RawFrame
+		targetResponse          *frame.RawFrame
+		expectedTargetExtraRows int64
+		expectedOriginExtraRows int64
+		expectedValuesDiffer    int64
+		expectedMetadataOnly    int64
+		expectedWarning         bool
+	}{
+		{
+			name:           "match",
+			originResponse: rows("a", "b"),
+			targetResponse: rows("b", "a"),
+		},
+		{
+			name:                    "target ahead is a mismatch",
+			targetAheadMode:         common.ReadComparisonTargetAheadModeMismatch,
+			originResponse:          rows("a"),
+			targetResponse:          rows("a", "b"),
+			expectedTargetExtraRows: 1,
+			expectedWarning:         true,
+		},
+		{
+			name:                    "target ahead is expected",
+			targetAheadMode:         common.ReadComparisonTargetAheadModeExpected,
+			originResponse:          rows("a"),
+			targetResponse:          rows("a", "b"),
+			expectedTargetExtraRows: 1,
+		},
+		{
+			name:                    "origin ahead",
+			targetAheadMode:         common.ReadComparisonTargetAheadModeExpected,
+			originResponse:          rows("a", "b"),
+			targetResponse:          rows("a"),
+			expectedOriginExtraRows: 1,
+			expectedWarning:         true,
+		},
+		{
+			name:                 "values differ",
+			targetAheadMode:      common.ReadComparisonTargetAheadModeExpected,
+			originResponse:       rows("a", "b"),
+			targetResponse:       rows("a", "c"),
+			expectedValuesDiffer: 1,
+			expectedWarning:      true,
+		},
+		{
+			name:           "equivalent metadata is normalized",
+			metadataMode:   common.ReadComparisonMetadataModeNormalize,
+			originResponse: rowsWithColumn(&message.ColumnMetadata{Keyspace: "ks", Table: "t", Name: "a", Type: datatype.Varchar}, "a"),
+			targetResponse: rowsWithColumn(&message.ColumnMetadata{Keyspace: "ks", Table: "t", Name: "a",
+				Type: datatype.NewCustomType("org.apache.cassandra.db.marshal.UTF8Type")}, "a"),
+		},
+		{
+			name:           "equivalent metadata is a mismatch in strict mode",
+			metadataMode:   common.ReadComparisonMetadataModeStrict,
+			originResponse: rowsWithColumn(&message.ColumnMetadata{Keyspace: "ks", Table: "t", Name: "a", Type: datatype.Varchar}, "a"),
+			targetResponse: rowsWithColumn(&message.ColumnMetadata{Keyspace: "ks", Table: "t", Name: "a",
+				Type: datatype.NewCustomType("org.apache.cassandra.db.marshal.UTF8Type")}, "a"),
+			expectedMetadataOnly: 1,
+		},
+		{
+			name:                 "only metadata differs",
+			metadataMode:         common.ReadComparisonMetadataModeNormalize,
+			originResponse:       rowsWithColumn(&message.ColumnMetadata{Keyspace: "ks", Table: "t", Name: "a", Type: datatype.Varchar}, "a"),
+			targetResponse:       rowsWithColumn(&message.ColumnMetadata{Keyspace: "ks", Table: "t", Name: "b", Type: datatype.Varchar}, "a"),
+			expectedMetadataOnly: 1,
+		},
+		{
+			name:           "metadata is not compared in ignore mode",
+			metadataMode:   common.ReadComparisonMetadataModeIgnore,
+			originResponse: rowsWithColumn(&message.ColumnMetadata{Keyspace: "ks", Table: "t", Name: "a", Type: datatype.Varchar}, "a"),
+			targetResponse: rowsWithColumn(&message.ColumnMetadata{Keyspace: "ks", Table: "t", Name: "b", Type: datatype.Varchar}, "a"),
+		},
+		{
+			name:                 "values and metadata differ",
+			metadataMode:         common.ReadComparisonMetadataModeNormalize,
+			originResponse:       rowsWithColumn(&message.ColumnMetadata{Keyspace: "ks", Table: "t", Name: "a", Type: datatype.Varchar}, "a"),
+			targetResponse:       rowsWithColumn(&message.ColumnMetadata{Keyspace: "ks", Table: "t", Name: "b", Type: datatype.Varchar}, "b"),
+			expectedValuesDiffer: 1,
+			expectedWarning:      true,
+		},
+		{
+			name:           "failed reads are not compared",
+			originResponse: unavailable,
+			targetResponse: rows("a"),
+		},
+		{
+			name:           "results with more pages are not compared",
+			originResponse: pagedRows,
+			targetResponse: rows("a", "b"),
+		},
+		{
+			name:           "timed out reads are not compared",
+			originResponse: rows("a"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := test.NewGlobal()
+			defer hook.Reset()
+			log.SetLevel(log.InfoLevel)
+
+			proxyMetrics := newFakeProxyMetrics()
+			targetExtraRows, originExtraRows, valuesDiffer := &countingCounter{}, &countingCounter{}, &countingCounter{}
+			proxyMetrics.ReadMismatchesTargetExtraRows = targetExtraRows
+			proxyMetrics.ReadMismatchesOriginExtraRows = originExtraRows
+			proxyMetrics.ReadMismatchesValuesDiffer = valuesDiffer
+			metadataOnly := &countingCounter{}
+			proxyMetrics.ReadMismatchesMetadataOnly = metadataOnly
+			conf := config.New()
+			conf.ReadComparisonEnabled = true
+			ch := &ClientHandler{
+				conf:            conf,
+				primaryCluster:  common.ClusterTypeOrigin,
+				targetAheadMode: tt.targetAheadMode,
+				metadataMode:    tt.metadataMode,
+				metricHandler: metrics.NewMetricHandler(
+					noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+			}
+
+			reqCtx := NewRequestContext(mockQueryFrame(t, "SELECT * FROM t"), NewRaceReadRequestInfo(true), time.Now(), nil)
+			if tt.originResponse != nil {
+				reqCtx.updateInternalState(tt.originResponse, common.ClusterTypeOrigin)
+			}
+			if tt.targetResponse != nil {
+				reqCtx.updateInternalState(tt.targetResponse, common.ClusterTypeTarget)
+			}
+			ch.compareRaceRead(reqCtx)
+
+			require.Equal(t, tt.expectedTargetExtraRows, targetExtraRows.get())
+			require.Equal(t, tt.expectedOriginExtraRows, originExtraRows.get())
+			require.Equal(t, tt.expectedValuesDiffer, valuesDiffer.get())
+			require.Equal(t, tt.expectedMetadataOnly, metadataOnly.get())
+			warnings := 0
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == log.WarnLevel {
+					warnings++
+				}
+			}
+			require.Equal(t, tt.expectedWarning, warnings > 0)
+		})
+	}
+}
+
+func TestGetMetadataDifference(t *testing.T) {
+	column := func(name string, dataType datatype.DataType) *message.ColumnMetadata {
+		return &message.ColumnMetadata{Keyspace: "ks", Table: "t", Name: name, Type: dataType}
+	}
+	udt := func(keyspace string) datatype.DataType {
+		udtType, err := datatype.NewUserDefinedType(keyspace, "address", []string{"street", "zip"},
+			[]datatype.DataType{datatype.Varchar, datatype.Int})
+		require.Nil(t, err)
+		return udtType
+	}
+
+	tests := []struct {
+		name                string
+		originColumns       []*message.ColumnMetadata
+		targetColumns       []*message.ColumnMetadata
+		expectedNormalized  bool
+		expectedStrictEqual bool
+	}{
+		{
+			name:                "same metadata",
+			originColumns:       []*message.ColumnMetadata{column("a", datatype.Int), column("b", datatype.NewListType(datatype.Varchar))},
+			targetColumns:       []*message.ColumnMetadata{column("a", datatype.Int), column("b", datatype.NewListType(datatype.Varchar))},
+			expectedNormalized:  true,
+			expectedStrictEqual: true,
+		},
+		{
+			name:               "native type described by its class name",
+			originColumns:      []*message.ColumnMetadata{column("a", datatype.Int)},
+			targetColumns:      []*message.ColumnMetadata{column("a", datatype.NewCustomType("org.apache.cassandra.db.marshal.Int32Type"))},
+			expectedNormalized: true,
+		},
+		{
+			name:          "collection described by its class name",
+			originColumns: []*message.ColumnMetadata{column("a", datatype.NewMapType(datatype.Varchar, datatype.NewSetType(datatype.Uuid)))},
+			targetColumns: []*message.ColumnMetadata{column("a", datatype.NewCustomType(
+				"org.apache.cassandra.db.marshal.MapType(org.apache.cassandra.db.marshal.UTF8Type,"+
+					"org.apache.cassandra.db.marshal.FrozenType(org.apache.cassandra.db.marshal.SetType(org.apache.cassandra.db.marshal.UUIDType)))"))},
+			expectedNormalized: true,
+		},
+		{
+			name:               "reversed type",
+			originColumns:      []*message.ColumnMetadata{column("a", datatype.NewListType(datatype.Timestamp))},
+			targetColumns:      []*message.ColumnMetadata{column("a", datatype.NewListType(datatype.NewCustomType("org.apache.cassandra.db.marshal.ReversedType(org.apache.cassandra.db.marshal.TimestampType)")))},
+			expectedNormalized: true,
+		},
+		{
+			name:               "keyspace and table names",
+			originColumns:      []*message.ColumnMetadata{column("a", datatype.Int)},
+			targetColumns:      []*message.ColumnMetadata{{Keyspace: "ks_target", Table: "t_target", Name: "a", Type: datatype.Int}},
+			expectedNormalized: true,
+		},
+		{
+			name:               "user defined types of different keyspaces",
+			originColumns:      []*message.ColumnMetadata{column("a", udt("ks"))},
+			targetColumns:      []*message.ColumnMetadata{column("a", udt("ks_target"))},
+			expectedNormalized: true,
+		},
+		{
+			name:          "unknown class name",
+			originColumns: []*message.ColumnMetadata{column("a", datatype.Varchar)},
+			targetColumns: []*message.ColumnMetadata{column("a", datatype.NewCustomType("com.example.CustomType"))},
+		},
+		{
+			name:          "different types",
+			originColumns: []*message.ColumnMetadata{column("a", datatype.Int)},
+			targetColumns: []*message.ColumnMetadata{column("a", datatype.Bigint)},
+		},
+		{
+			name:          "different names",
+			originColumns: []*message.ColumnMetadata{column("a", datatype.Int)},
+			targetColumns: []*message.ColumnMetadata{column("b", datatype.Int)},
+		},
+		{
+			name:          "different columns",
+			originColumns: []*message.ColumnMetadata{column("a", datatype.Int)},
+			targetColumns: []*message.ColumnMetadata{column("a", datatype.Int), column("b", datatype.Int)},
+		},
+		{
+			name:                "results without metadata are not compared",
+			originColumns:       []*message.ColumnMetadata{column("a", datatype.Int)},
+			expectedNormalized:  true,
+			expectedStrictEqual: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expectedNormalized, getMetadataDifference(tt.originColumns, tt.targetColumns, true) == "")
+			require.Equal(t, tt.expectedStrictEqual, getMetadataDifference(tt.originColumns, tt.targetColumns, false) == "")
+		})
+	}
+}
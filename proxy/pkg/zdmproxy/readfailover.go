@@ -0,0 +1,130 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// shouldFailoverRead returns the forward decision of the other cluster if the request is a read that failed with an
+// availability error on the cluster it was forwarded to and ZDM_READ_FAILOVER_ENABLED is true.
+func (ch *ClientHandler) shouldFailoverRead(reqCtx *requestContextImpl) (forwardDecision, bool) {
+	if !ch.conf.ReadFailoverEnabled || reqCtx.customResponseChannel != nil || !isPrimaryRead(reqCtx.requestInfo) {
+		return forwardToNone, false
+	}
+
+	var response *frame.RawFrame
+	var failoverDecision forwardDecision
+	var clusterType common.ClusterType
+	switch reqCtx.requestInfo.GetForwardDecision() {
+	case forwardToOrigin:
+		response = reqCtx.originResponse
+		failoverDecision = forwardToTarget
+		clusterType = common.ClusterTypeOrigin
+	case forwardToTarget:
+		response = reqCtx.targetResponse
+		failoverDecision = forwardToOrigin
+		clusterType = common.ClusterTypeTarget
+	default:
+		return forwardToNone, false
+	}
+
+	if response == nil || isResponseSuccessful(response) {
+		return forwardToNone, false
+	}
+	errMsg, err := decodeErrorResult(ch.codec.get(), response)
+	if err != nil {
+		log.Debugf("Could not decode %v error response of stream id %d: %v", clusterType, response.Header.StreamId, err)
+		return forwardToNone, false
+	}
+	if !isReadFailoverError(errMsg) {
+		return forwardToNone, false
+	}
+	return failoverDecision, true
+}
+
+// isReadFailoverError returns true if the error is caused by the availability of the cluster, other errors
+// (e.g. syntax or authorization errors) would most likely be returned by the other cluster as well.
+func isReadFailoverError(errMsg message.Error) bool {
+	switch errMsg.(type) {
+	case *message.ReadTimeout, *message.ReadFailure, *message.Unavailable,
+		*message.Overloaded, *message.IsBootstrapping, *message.ServerError:
+		return true
+	default:
+		return false
+	}
+}
+
+// failoverRead retries the read on the other cluster and sends its response to the client if it succeeds,
+// if anything fails the original error response is sent to the client.
+func (ch *ClientHandler) failoverRead(reqCtx *requestContextImpl, failoverDecision forwardDecision) {
+	response, err := ch.retryRead(reqCtx, failoverDecision)
+	if err != nil {
+		reqCtx.logger().Warnf("Could not fail over read to %v, returning the original error to the client: %v",
+			failoverDecision, err)
+		ch.sendClientResponse(reqCtx)
+		return
+	}
+	if !isResponseSuccessful(response) {
+		reqCtx.logger().Debugf("Read failed on %v as well, returning the original error to the client.", failoverDecision)
+		ch.sendClientResponse(reqCtx)
+		return
+	}
+
+	reqCtx.logger().Debugf("Read failed on %v, returning the response of %v.",
+		reqCtx.requestInfo.GetForwardDecision(), failoverDecision)
+	if reqCtx.requestInfo.ShouldBeTrackedInMetrics() {
+		ch.metricHandler.GetProxyMetrics().ReadFailovers.Add(1)
+	}
+
+	response, err = ch.compressionBridge.compressResponse(response)
+	if err != nil {
+		reqCtx.logger().Errorf("Error handling request (%v): %v", reqCtx.request.Header, err)
+		return
+	}
+	ch.clientConnector.sendResponseToClient(response)
+}
+
+// retryRead sends the read to the cluster of the provided forward decision and waits for the response that would be
+// returned to the client.
+func (ch *ClientHandler) retryRead(reqCtx *requestContextImpl, failoverDecision forwardDecision) (*frame.RawFrame, error) {
+	var requestInfo RequestInfo
+	switch castedRequestInfo := reqCtx.requestInfo.(type) {
+	case *GenericRequestInfo:
+		requestInfo = NewGenericRequestInfo(failoverDecision, false, castedRequestInfo.ShouldBeTrackedInMetrics())
+	case *ExecuteRequestInfo:
+		requestInfo = NewReadFailoverExecuteRequestInfo(castedRequestInfo.GetPreparedData(), failoverDecision)
+	default:
+		return nil, fmt.Errorf("unexpected request info %v", reqCtx.requestInfo)
+	}
+
+	channel := make(chan *customResponse, 1)
+	frameContext := ch.newFrameDecodeContext(reqCtx.request)
+	frameContext.SetCorrelationId(reqCtx.correlationId)
+	err := ch.executeRequest(
+		frameContext,
+		requestInfo,
+		ch.LoadCurrentKeyspace(),
+		nowFunc(),
+		channel,
+		time.Duration(ch.conf.ProxyRequestTimeoutMs)*time.Millisecond)
+	if err != nil {
+		return nil, fmt.Errorf("could not send %v request: %w", reqCtx.request.Header.OpCode, err)
+	}
+
+	select {
+	case response, ok := <-channel:
+		if !ok || response == nil || response.aggregatedResponse == nil {
+			if ch.clientHandlerContext.Err() != nil {
+				return nil, ShutdownErr
+			}
+			return nil, fmt.Errorf("no response received for %v request", reqCtx.request.Header.OpCode)
+		}
+		return response.aggregatedResponse, nil
+	case <-ch.clientHandlerContext.Done():
+		return nil, ShutdownErr
+	}
+}
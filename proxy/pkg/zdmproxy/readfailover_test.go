@@ -0,0 +1,65 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestShouldFailoverRead(t *testing.T) {
+	readData := NewPreparedData(
+		&message.PreparedResult{PreparedQueryId: []byte("origin")},
+		&message.PreparedResult{PreparedQueryId: []byte("target")},
+		NewPrepareRequestInfo(NewGenericRequestInfo(forwardToOrigin, true, true), nil, false, "SELECT * FROM t", ""))
+
+	rows := mustEncodeFrame(t, &message.RowsResult{Metadata: &message.RowsMetadata{}, Data: message.RowSet{}})
+	readTimeout := mustEncodeFrame(t, &message.ReadTimeout{
+		ErrorMessage: "read timeout", Consistency: primitive.ConsistencyLevelLocalQuorum})
+	unavailable := mustEncodeFrame(t, &message.Unavailable{
+		ErrorMessage: "unavailable", Consistency: primitive.ConsistencyLevelLocalQuorum})
+	invalid := mustEncodeFrame(t, &message.Invalid{ErrorMessage: "invalid"})
+	query := mockQueryFrame(t, "SELECT * FROM t")
+
+	tests := []struct {
+		name             string
+		enabled          bool
+		requestInfo      RequestInfo
+		originResponse   *frame.RawFrame
+		targetResponse   *frame.RawFrame
+		expectedDecision forwardDecision
+		expectedFailover bool
+	}{
+		{"read timeout on origin", true, NewGenericRequestInfo(forwardToOrigin, true, true), readTimeout, nil, forwardToTarget, true},
+		{"unavailable on target", true, NewGenericRequestInfo(forwardToTarget, true, true), nil, unavailable, forwardToOrigin, true},
+		{"bound read", true, NewExecuteRequestInfo(readData), readTimeout, nil, forwardToTarget, true},
+		{"disabled", false, NewGenericRequestInfo(forwardToOrigin, true, true), readTimeout, nil, forwardToNone, false},
+		{"success", true, NewGenericRequestInfo(forwardToOrigin, true, true), rows, nil, forwardToNone, false},
+		{"not an availability error", true, NewGenericRequestInfo(forwardToOrigin, true, true), invalid, nil, forwardToNone, false},
+		{"no response", true, NewGenericRequestInfo(forwardToOrigin, true, true), nil, nil, forwardToNone, false},
+		{"write", true, NewGenericRequestInfo(forwardToBoth, false, true), readTimeout, readTimeout, forwardToNone, false},
+		{"system query", true, NewGenericRequestInfo(forwardToOrigin, false, true), readTimeout, nil, forwardToNone, false},
+		{"keyspace routed read", true, NewKeyspaceRoutedExecuteRequestInfo(readData, forwardToOrigin), readTimeout, nil, forwardToNone, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := config.New()
+			conf.ReadFailoverEnabled = tt.enabled
+			ch := &ClientHandler{conf: conf}
+
+			reqCtx := NewRequestContext(query, tt.requestInfo, time.Now(), nil)
+			reqCtx.originResponse = tt.originResponse
+			reqCtx.targetResponse = tt.targetResponse
+			decision, ok := ch.shouldFailoverRead(reqCtx)
+			require.Equal(t, tt.expectedFailover, ok)
+			require.Equal(t, tt.expectedDecision, decision)
+		})
+	}
+
+	failoverRequestInfo := NewReadFailoverExecuteRequestInfo(readData, forwardToTarget)
+	require.Equal(t, forwardToTarget, failoverRequestInfo.GetForwardDecision())
+	require.False(t, failoverRequestInfo.ShouldAlsoBeSentAsync())
+}
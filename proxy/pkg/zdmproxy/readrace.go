@@ -0,0 +1,181 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"sync"
+)
+
+// isRaceRead returns true if the read is sent to both clusters so that the first successful response is returned
+// to the client, see ZDM_READ_RACE_ENABLED.
+func isRaceRead(requestInfo RequestInfo) bool {
+	switch castedRequestInfo := requestInfo.(type) {
+	case *RaceReadRequestInfo:
+		return true
+	case *ExecuteRequestInfo:
+		return castedRequestInfo.raceRead
+	default:
+		return false
+	}
+}
+
+// routeRaceRead returns a request info that sends the read to both clusters if ZDM_READ_RACE_ENABLED is true,
+// other requests are returned unchanged.
+func (ch *ClientHandler) routeRaceRead(requestInfo RequestInfo) RequestInfo {
+	if !ch.conf.ReadRaceEnabled || !isPrimaryRead(requestInfo) {
+		return requestInfo
+	}
+
+	switch castedRequestInfo := requestInfo.(type) {
+	case *GenericRequestInfo:
+		return NewRaceReadRequestInfo(castedRequestInfo.ShouldBeTrackedInMetrics())
+	case *ExecuteRequestInfo:
+		return NewRaceReadExecuteRequestInfo(castedRequestInfo.GetPreparedData())
+	default:
+		return requestInfo
+	}
+}
+
+// getMetricsForwardDecision returns the forward decision that the request is tracked with in the proxy metrics,
+// race reads are sent to both clusters but they are tracked as reads on the primary cluster.
+func getMetricsForwardDecision(requestInfo RequestInfo, primaryCluster common.ClusterType) forwardDecision {
+	if !isRaceRead(requestInfo) {
+		return requestInfo.GetForwardDecision()
+	}
+	if primaryCluster == common.ClusterTypeTarget {
+		return forwardToTarget
+	}
+	return forwardToOrigin
+}
+
+// setRaceWinner returns true if the response that was just received from the cluster is the first successful
+// response of a race read that is still waiting for the other cluster, this response has to be sent to the client
+// right away. The request context is only released once the other cluster responded or the request timed out.
+// Dual writes that are confirmed by EITHER cluster are handled the same way, dual writes that are confirmed by the
+// PRIMARY cluster return its response right away even if it is an error.
+func (recv *requestContextImpl) setRaceWinner(cluster common.ClusterType) bool {
+	if !recv.isConfirmedEarly() {
+		return false
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	if recv.state != RequestPending || recv.raceWinner != common.ClusterTypeNone {
+		return false
+	}
+
+	var response *frame.RawFrame
+	switch cluster {
+	case common.ClusterTypeOrigin:
+		response = recv.originResponse
+	case common.ClusterTypeTarget:
+		response = recv.targetResponse
+	}
+	if response == nil {
+		return false
+	}
+	if recv.writeConfirmation == common.DualWriteConfirmationPrimary {
+		if cluster != recv.primaryCluster {
+			return false
+		}
+	} else if !isResponseSuccessful(response) {
+		return false
+	}
+	recv.raceWinner = cluster
+	return true
+}
+
+// getRaceResponses returns the responses that were received so far and the cluster that won the race (if any),
+// the response of the slower cluster can be set concurrently.
+func (recv *requestContextImpl) getRaceResponses() (originResponse *frame.RawFrame, targetResponse *frame.RawFrame, winner common.ClusterType) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	return recv.originResponse, recv.targetResponse, recv.raceWinner
+}
+
+// deferUntilRaceReleased stores a request that reuses the stream id of this race read, the client already received
+// the response of this read but the slower cluster didn't respond yet so the stream id is still in use on its
+// connection. The request is sent when this request context is released, see releaseRace.
+func (recv *requestContextImpl) deferUntilRaceReleased(sendRequest func()) bool {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	if recv.raceWinner == common.ClusterTypeNone || recv.raceReleased || recv.raceDeferredRequest != nil {
+		return false
+	}
+	recv.raceDeferredRequest = sendRequest
+	return true
+}
+
+// releaseRace is called after the request context was removed from its holder, it returns the request that was
+// deferred until then (if any) and whether the response was already sent to the client.
+func (recv *requestContextImpl) releaseRace() (deferredRequest func(), responseSent bool) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	recv.raceReleased = true
+	deferredRequest = recv.raceDeferredRequest
+	recv.raceDeferredRequest = nil
+	return deferredRequest, recv.raceWinner != common.ClusterTypeNone
+}
+
+// deferRequestAfterRaceRead returns true if the stream id of the request is used by a race read that already
+// responded to the client, the request is sent once the race read is released.
+func (ch *ClientHandler) deferRequestAfterRaceRead(contextHoldersMap *sync.Map, streamId int16, sendRequest func()) bool {
+	reqCtx, ok := getOrCreateRequestContextHolder(contextHoldersMap, streamId).Get().(*requestContextImpl)
+	if !ok {
+		return false
+	}
+	return reqCtx.deferUntilRaceReleased(sendRequest)
+}
+
+// computeRaceResponse returns the response of a race read: the response that was already chosen by setRaceWinner,
+// otherwise a successful response or the error of the primary cluster if both clusters failed.
+func (ch *ClientHandler) computeRaceResponse(reqCtx *requestContextImpl) (*frame.RawFrame, common.ClusterType, error) {
+	primaryResponse, secondaryResponse, responseCluster := reqCtx.getRaceResponses()
+	primaryCluster := reqCtx.primaryCluster
+	secondaryCluster := common.ClusterTypeTarget
+	if primaryCluster == common.ClusterTypeTarget {
+		secondaryCluster = common.ClusterTypeOrigin
+		primaryResponse, secondaryResponse = secondaryResponse, primaryResponse
+	}
+
+	if responseCluster == common.ClusterTypeNone {
+		switch {
+		case primaryResponse != nil && isResponseSuccessful(primaryResponse):
+			responseCluster = primaryCluster
+		case secondaryResponse != nil && isResponseSuccessful(secondaryResponse):
+			responseCluster = secondaryCluster
+		case primaryResponse != nil:
+			responseCluster = primaryCluster
+		case secondaryResponse != nil:
+			responseCluster = secondaryCluster
+		default:
+			return nil, common.ClusterTypeNone, fmt.Errorf(
+				"did not receive response from %v or %v cassandra channel, stream: %d",
+				common.ClusterTypeOrigin, common.ClusterTypeTarget, reqCtx.request.Header.StreamId)
+		}
+	}
+
+	response := primaryResponse
+	if responseCluster == secondaryCluster {
+		response = secondaryResponse
+	}
+	reqCtx.logger().Tracef("Race read: returning the response received from %v: %d", responseCluster, response.Header.OpCode)
+
+	if reqCtx.requestInfo.ShouldBeTrackedInMetrics() {
+		proxyMetrics := ch.metricHandler.GetProxyMetrics()
+		if !isResponseSuccessful(response) {
+			if primaryCluster == common.ClusterTypeTarget {
+				proxyMetrics.FailedReadsTarget.Add(1)
+			} else {
+				proxyMetrics.FailedReadsOrigin.Add(1)
+			}
+		} else if responseCluster == secondaryCluster {
+			proxyMetrics.ReadRacesWonBySecondary.Add(1)
+		}
+	}
+	return response, responseCluster, nil
+}
@@ -0,0 +1,141 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRouteRaceRead(t *testing.T) {
+	readData := NewPreparedData(
+		&message.PreparedResult{PreparedQueryId: []byte("origin")},
+		&message.PreparedResult{PreparedQueryId: []byte("target")},
+		NewPrepareRequestInfo(NewGenericRequestInfo(forwardToOrigin, true, true), nil, false, "SELECT * FROM t", ""))
+
+	conf := config.New()
+	ch := &ClientHandler{conf: conf, primaryCluster: common.ClusterTypeTarget}
+
+	read := NewGenericRequestInfo(forwardToOrigin, true, true)
+	require.Equal(t, read, ch.routeRaceRead(read))
+
+	conf.ReadRaceEnabled = true
+	raceRead := ch.routeRaceRead(read)
+	require.True(t, isRaceRead(raceRead))
+	require.Equal(t, forwardToBoth, raceRead.GetForwardDecision())
+	require.False(t, raceRead.ShouldAlsoBeSentAsync())
+	require.Equal(t, forwardToTarget, getMetricsForwardDecision(raceRead, ch.primaryCluster))
+
+	boundRaceRead := ch.routeRaceRead(NewExecuteRequestInfo(readData))
+	require.True(t, isRaceRead(boundRaceRead))
+	require.Equal(t, forwardToBoth, boundRaceRead.GetForwardDecision())
+
+	// writes and system queries are not raced
+	write := NewGenericRequestInfo(forwardToBoth, false, true)
+	require.Equal(t, write, ch.routeRaceRead(write))
+	require.Equal(t, forwardToBoth, getMetricsForwardDecision(write, ch.primaryCluster))
+	systemQuery := NewGenericRequestInfo(forwardToOrigin, false, true)
+	require.Equal(t, systemQuery, ch.routeRaceRead(systemQuery))
+}
+
+func TestReadRace_FasterClusterFails(t *testing.T) {
+	proxyMetrics := newFakeProxyMetrics()
+	failedReadsOrigin, racesWonBySecondary := &countingCounter{}, &countingCounter{}
+	proxyMetrics.FailedReadsOrigin = failedReadsOrigin
+	proxyMetrics.ReadRacesWonBySecondary = racesWonBySecondary
+	ch := &ClientHandler{
+		conf:           config.New(),
+		primaryCluster: common.ClusterTypeOrigin,
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+
+	rows := mustEncodeFrame(t, &message.RowsResult{Metadata: &message.RowsMetadata{}, Data: message.RowSet{}})
+	unavailable := mustEncodeFrame(t, &message.Unavailable{
+		ErrorMessage: "unavailable", Consistency: primitive.ConsistencyLevelLocalQuorum})
+	query := mockQueryFrame(t, "SELECT * FROM t")
+
+	// the primary cluster responds first with an error so the proxy waits for the secondary cluster
+	reqCtx := NewRequestContext(query, NewRaceReadRequestInfo(true), time.Now(), nil)
+	reqCtx.primaryCluster = common.ClusterTypeOrigin
+	state, updated := reqCtx.updateInternalState(unavailable, common.ClusterTypeOrigin)
+	require.True(t, updated)
+	require.Equal(t, RequestPending, state)
+	require.False(t, reqCtx.setRaceWinner(common.ClusterTypeOrigin))
+
+	state, updated = reqCtx.updateInternalState(rows, common.ClusterTypeTarget)
+	require.True(t, updated)
+	require.Equal(t, RequestDone, state)
+	require.False(t, reqCtx.setRaceWinner(common.ClusterTypeTarget))
+
+	response, cluster, err := ch.computeClientResponse(reqCtx)
+	require.Nil(t, err)
+	require.Equal(t, common.ClusterTypeTarget, cluster)
+	require.Equal(t, rows, response)
+	require.Equal(t, int64(1), racesWonBySecondary.get())
+	require.Equal(t, int64(0), failedReadsOrigin.get())
+
+	// both clusters failed, the error of the primary cluster is returned
+	reqCtx = NewRequestContext(query, NewRaceReadRequestInfo(true), time.Now(), nil)
+	reqCtx.primaryCluster = common.ClusterTypeOrigin
+	reqCtx.updateInternalState(unavailable, common.ClusterTypeTarget)
+	reqCtx.updateInternalState(unavailable, common.ClusterTypeOrigin)
+	_, cluster, err = ch.computeClientResponse(reqCtx)
+	require.Nil(t, err)
+	require.Equal(t, common.ClusterTypeOrigin, cluster)
+	require.Equal(t, int64(1), racesWonBySecondary.get())
+	require.Equal(t, int64(1), failedReadsOrigin.get())
+}
+
+func TestReadRace_FasterClusterWins(t *testing.T) {
+	ch := &ClientHandler{
+		conf:           config.New(),
+		primaryCluster: common.ClusterTypeOrigin,
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, newFakeProxyMetrics(), nil, nil, nil),
+	}
+
+	rows := mustEncodeFrame(t, &message.RowsResult{Metadata: &message.RowsMetadata{}, Data: message.RowSet{}})
+	query := mockQueryFrame(t, "SELECT * FROM t")
+	reqCtx := NewRequestContext(query, NewRaceReadRequestInfo(true), time.Now(), nil)
+	reqCtx.primaryCluster = common.ClusterTypeOrigin
+	contextHolders := &sync.Map{}
+	holder := getOrCreateRequestContextHolder(contextHolders, query.Header.StreamId)
+	require.Nil(t, holder.SetIfEmpty(reqCtx))
+
+	// the stream id can not be reused until the race read has a winner
+	require.False(t, ch.deferRequestAfterRaceRead(contextHolders, query.Header.StreamId, func() {}))
+
+	reqCtx.updateInternalState(rows, common.ClusterTypeTarget)
+	require.True(t, reqCtx.setRaceWinner(common.ClusterTypeTarget))
+	require.False(t, reqCtx.setRaceWinner(common.ClusterTypeTarget))
+
+	// a request that reuses the stream id is deferred until the slower cluster responded
+	deferredRequestSent := false
+	require.True(t, ch.deferRequestAfterRaceRead(contextHolders, query.Header.StreamId, func() {
+		deferredRequestSent = true
+	}))
+
+	// the slower response doesn't replace the response that was already sent to the client
+	reqCtx.updateInternalState(rows, common.ClusterTypeOrigin)
+	_, cluster, err := ch.computeClientResponse(reqCtx)
+	require.Nil(t, err)
+	require.Equal(t, common.ClusterTypeTarget, cluster)
+
+	require.Nil(t, holder.Clear(reqCtx))
+	deferredRequest, responseSent := reqCtx.releaseRace()
+	require.True(t, responseSent)
+	require.NotNil(t, deferredRequest)
+	deferredRequest()
+	require.True(t, deferredRequestSent)
+
+	deferredRequest, _ = reqCtx.releaseRace()
+	require.Nil(t, deferredRequest)
+	require.False(t, reqCtx.deferUntilRaceReleased(func() {}))
+}
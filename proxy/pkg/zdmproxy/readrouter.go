@@ -0,0 +1,130 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"sync"
+)
+
+// weight of each new latency sample in the averages used by the adaptive read router
+const readRoutingLatencyAlpha = 0.1
+
+// adaptiveReadRouter routes reads to the cluster with the lowest average latency. Reads only switch to the other
+// cluster when its latency is lower than the latency of the current cluster by more than the hysteresis so that
+// reads don't keep flapping between clusters with similar latencies.
+// A nil adaptiveReadRouter routes reads to the primary cluster.
+type adaptiveReadRouter struct {
+	originLatency *metrics.LatencyEwma
+	targetLatency *metrics.LatencyEwma
+	hysteresis    float64
+
+	lock             *sync.Mutex
+	preferredCluster common.ClusterType
+}
+
+func newAdaptiveReadRouter(
+	originLatency *metrics.LatencyEwma, targetLatency *metrics.LatencyEwma,
+	hysteresisPercent int, primaryCluster common.ClusterType) *adaptiveReadRouter {
+	return &adaptiveReadRouter{
+		originLatency:    originLatency,
+		targetLatency:    targetLatency,
+		hysteresis:       float64(hysteresisPercent) / 100,
+		lock:             &sync.Mutex{},
+		preferredCluster: primaryCluster,
+	}
+}
+
+// getReadCluster returns the cluster that reads should be forwarded to, the primary cluster is returned
+// until there are latency samples for both clusters.
+func (recv *adaptiveReadRouter) getReadCluster(primaryCluster common.ClusterType) common.ClusterType {
+	if recv == nil {
+		return primaryCluster
+	}
+
+	originLatency, originOk := recv.originLatency.Value()
+	targetLatency, targetOk := recv.targetLatency.Value()
+	if !originOk || !targetOk {
+		return primaryCluster
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	switch recv.preferredCluster {
+	case common.ClusterTypeTarget:
+		if float64(originLatency) < float64(targetLatency)*(1-recv.hysteresis) {
+			log.Infof("Adaptive read routing: routing reads to %v (latency %v) instead of %v (latency %v).",
+				common.ClusterTypeOrigin, originLatency, common.ClusterTypeTarget, targetLatency)
+			recv.preferredCluster = common.ClusterTypeOrigin
+		}
+	default:
+		if float64(targetLatency) < float64(originLatency)*(1-recv.hysteresis) {
+			log.Infof("Adaptive read routing: routing reads to %v (latency %v) instead of %v (latency %v).",
+				common.ClusterTypeTarget, targetLatency, common.ClusterTypeOrigin, originLatency)
+			recv.preferredCluster = common.ClusterTypeTarget
+		}
+	}
+	return recv.preferredCluster
+}
+
+// getBias returns 1 if reads are routed to TARGET, -1 if they are routed to ORIGIN and 0 if the router is disabled.
+func (recv *adaptiveReadRouter) getBias() float64 {
+	if recv == nil {
+		return 0
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	if recv.preferredCluster == common.ClusterTypeTarget {
+		return 1
+	}
+	return -1
+}
+
+// isPrimaryRead returns true for reads that are forwarded to the primary cluster, i.e. SELECT statements (or their
+// bound statements) that don't target system tables. System queries are never sent to the async connector
+// (see getRequestInfoFromQueryInfo).
+func isPrimaryRead(requestInfo RequestInfo) bool {
+	fwdDecision := requestInfo.GetForwardDecision()
+	if fwdDecision != forwardToOrigin && fwdDecision != forwardToTarget {
+		return false
+	}
+
+	switch requestInfo.(type) {
+	case *GenericRequestInfo, *ExecuteRequestInfo:
+		return requestInfo.ShouldAlsoBeSentAsync()
+	default:
+		return false
+	}
+}
+
+// routeRead returns a request info that forwards the read to the cluster chosen by the adaptive read router,
+// requests that are not routable reads are returned unchanged.
+func (ch *ClientHandler) routeRead(requestInfo RequestInfo, cutoverState *CutoverState) RequestInfo {
+	if ch.readRouter == nil || !isPrimaryRead(requestInfo) {
+		return requestInfo
+	}
+	if cutoverState.ReadMode != common.ReadModePrimaryOnly {
+		// the async connector is tied to the secondary cluster so reads must stay on the primary cluster
+		return requestInfo
+	}
+
+	readDecision := forwardToOrigin
+	if ch.readRouter.getReadCluster(cutoverState.PrimaryCluster) == common.ClusterTypeTarget {
+		readDecision = forwardToTarget
+	}
+	if readDecision == requestInfo.GetForwardDecision() {
+		return requestInfo
+	}
+
+	switch castedRequestInfo := requestInfo.(type) {
+	case *GenericRequestInfo:
+		return NewGenericRequestInfo(
+			readDecision, castedRequestInfo.ShouldAlsoBeSentAsync(), castedRequestInfo.ShouldBeTrackedInMetrics())
+	case *ExecuteRequestInfo:
+		return NewRoutedExecuteRequestInfo(castedRequestInfo.GetPreparedData(), readDecision)
+	default:
+		return requestInfo
+	}
+}
@@ -0,0 +1,100 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveReadRouter_GetReadCluster(t *testing.T) {
+	originLatency := metrics.NewLatencyEwma(1) // only the latest sample counts
+	targetLatency := metrics.NewLatencyEwma(1)
+	router := newAdaptiveReadRouter(originLatency, targetLatency, 20, common.ClusterTypeOrigin)
+
+	// primary cluster is used until both clusters have latency samples
+	require.Equal(t, common.ClusterTypeOrigin, router.getReadCluster(common.ClusterTypeOrigin))
+	originLatency.Update(100 * time.Millisecond)
+	require.Equal(t, common.ClusterTypeTarget, router.getReadCluster(common.ClusterTypeTarget))
+	require.Equal(t, -1.0, router.getBias())
+
+	// target is faster but not by more than the hysteresis
+	targetLatency.Update(85 * time.Millisecond)
+	require.Equal(t, common.ClusterTypeOrigin, router.getReadCluster(common.ClusterTypeOrigin))
+	require.Equal(t, -1.0, router.getBias())
+
+	// origin is consistently slower
+	targetLatency.Update(50 * time.Millisecond)
+	require.Equal(t, common.ClusterTypeTarget, router.getReadCluster(common.ClusterTypeOrigin))
+	require.Equal(t, 1.0, router.getBias())
+
+	// reads stay on target while origin is not faster by more than the hysteresis
+	targetLatency.Update(110 * time.Millisecond)
+	require.Equal(t, common.ClusterTypeTarget, router.getReadCluster(common.ClusterTypeOrigin))
+	targetLatency.Update(90 * time.Millisecond)
+	originLatency.Update(80 * time.Millisecond)
+	require.Equal(t, common.ClusterTypeTarget, router.getReadCluster(common.ClusterTypeOrigin))
+
+	// target is now consistently slower
+	targetLatency.Update(200 * time.Millisecond)
+	require.Equal(t, common.ClusterTypeOrigin, router.getReadCluster(common.ClusterTypeTarget))
+	require.Equal(t, -1.0, router.getBias())
+
+	var disabledRouter *adaptiveReadRouter
+	require.Equal(t, common.ClusterTypeTarget, disabledRouter.getReadCluster(common.ClusterTypeTarget))
+	require.Equal(t, 0.0, disabledRouter.getBias())
+}
+
+func TestClientHandler_RouteRead(t *testing.T) {
+	originLatency := metrics.NewLatencyEwma(1)
+	targetLatency := metrics.NewLatencyEwma(1)
+	originLatency.Update(100 * time.Millisecond)
+	targetLatency.Update(10 * time.Millisecond)
+	ch := &ClientHandler{
+		primaryCluster: common.ClusterTypeOrigin,
+		readMode:       common.ReadModePrimaryOnly,
+		readRouter:     newAdaptiveReadRouter(originLatency, targetLatency, 20, common.ClusterTypeOrigin),
+	}
+	cutoverState := ch.getCutoverState()
+
+	read := NewGenericRequestInfo(forwardToOrigin, true, true)
+	systemRead := NewGenericRequestInfo(forwardToOrigin, false, true)
+	write := NewGenericRequestInfo(forwardToBoth, false, true)
+	readCacheEntry := &preparedDataImpl{
+		prepareRequestInfo: NewPrepareRequestInfo(read, nil, false, "SELECT * FROM ks1.t", ""),
+	}
+	systemReadCacheEntry := &preparedDataImpl{
+		prepareRequestInfo: NewPrepareRequestInfo(systemRead, nil, false, "SELECT * FROM system.local", ""),
+	}
+
+	tests := []struct {
+		name             string
+		requestInfo      RequestInfo
+		expectedDecision forwardDecision
+	}{
+		{"read", read, forwardToTarget},
+		{"system read", systemRead, forwardToOrigin},
+		{"write", write, forwardToBoth},
+		{"bound read", NewExecuteRequestInfo(readCacheEntry), forwardToTarget},
+		{"bound system read", NewExecuteRequestInfo(systemReadCacheEntry), forwardToOrigin},
+		{"bound counter", NewCounterExecuteRequestInfo(readCacheEntry), forwardToOrigin},
+		{"batch", NewBatchRequestInfo(nil), forwardToBoth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routedRequestInfo := ch.routeRead(tt.requestInfo, cutoverState)
+			require.Equal(t, tt.expectedDecision, routedRequestInfo.GetForwardDecision())
+			require.Equal(t, tt.requestInfo.ShouldAlsoBeSentAsync(), routedRequestInfo.ShouldAlsoBeSentAsync())
+			require.Equal(t, tt.requestInfo.ShouldBeTrackedInMetrics(), routedRequestInfo.ShouldBeTrackedInMetrics())
+		})
+	}
+
+	// reads stay on the primary cluster when they are also sent to the secondary cluster asynchronously
+	asyncCutoverState := &CutoverState{PrimaryCluster: common.ClusterTypeOrigin, ReadMode: common.ReadModeDualAsyncOnSecondary}
+	require.Equal(t, read, ch.routeRead(read, asyncCutoverState))
+
+	// requests are not routed when adaptive read routing is disabled
+	ch.readRouter = nil
+	require.Equal(t, read, ch.routeRead(read, cutoverState))
+}
@@ -0,0 +1,54 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"sync/atomic"
+)
+
+// handleRegisterLimit returns true if the request is a REGISTER that was rejected, i.e. it must not be forwarded.
+// The event types of every REGISTER request of the client connection are counted (registering for the same event type
+// again counts again) and a request that would exceed ZDM_MAX_REGISTERED_EVENT_TYPES is rejected with a PROTOCOL_ERROR.
+func (ch *ClientHandler) handleRegisterLimit(frameContext *frameDecodeContext, customResponseChannel chan *customResponse) (bool, error) {
+	maxEventTypes := ch.conf.MaxRegisteredEventTypes
+	header := frameContext.GetRawFrame().Header
+	if maxEventTypes <= 0 || header.OpCode != primitive.OpCodeRegister {
+		return false, nil
+	}
+
+	decodedFrame, err := frameContext.GetOrDecodeFrame()
+	if err != nil {
+		return false, fmt.Errorf("could not decode REGISTER request: %w", err)
+	}
+	register, ok := decodedFrame.Body.Message.(*message.Register)
+	if !ok {
+		return false, fmt.Errorf("expected REGISTER but got %v", decodedFrame.Body.Message)
+	}
+
+	eventTypes := int32(len(register.EventTypes))
+	registeredEventTypes := atomic.AddInt32(&ch.registeredEventTypes, eventTypes)
+	if registeredEventTypes <= int32(maxEventTypes) {
+		return false, nil
+	}
+	atomic.AddInt32(&ch.registeredEventTypes, -eventTypes)
+
+	ch.metricHandler.GetProxyMetrics().RejectedRegisterRequests.Add(1)
+	errMsg := fmt.Sprintf("Too many event registrations on this connection (%v event types were registered already, "+
+		"%v more were requested, the limit is %v)", registeredEventTypes-eventTypes, eventTypes, maxEventTypes)
+	protocolErrFrame, err := ch.codec.get().ConvertToRawFrame(
+		frame.NewFrame(header.Version, header.StreamId, &message.ProtocolError{ErrorMessage: errMsg}))
+	if err != nil {
+		return false, fmt.Errorf("could not convert protocol error response frame to rawframe: %w", err)
+	}
+	frameContext.logger().Warnf("Rejecting REGISTER with stream id %v from %v: %v.",
+		header.StreamId, ch.clientConnector.connection.RemoteAddr(), errMsg)
+
+	if customResponseChannel != nil {
+		customResponseChannel <- &customResponse{aggregatedResponse: protocolErrFrame}
+	} else {
+		ch.clientConnector.sendResponseToClient(protocolErrFrame)
+	}
+	return true, nil
+}
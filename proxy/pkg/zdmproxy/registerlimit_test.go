@@ -0,0 +1,79 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+)
+
+func TestClientHandler_HandleRegisterLimit(t *testing.T) {
+	clientConn, otherConn := net.Pipe()
+	defer clientConn.Close()
+	defer otherConn.Close()
+	conf := config.New()
+	conf.MaxRegisteredEventTypes = 3
+	proxyMetrics := newFakeProxyMetrics()
+	rejectedRegisterRequests := &countingCounter{}
+	proxyMetrics.RejectedRegisterRequests = rejectedRegisterRequests
+	ch := &ClientHandler{
+		conf:            conf,
+		clientConnector: &ClientConnector{connection: clientConn},
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+	responseChannel := make(chan *customResponse, 1)
+
+	rejected, err := ch.handleRegisterLimit(NewFrameDecodeContext(mustEncodeFrame(t, &message.Register{
+		EventTypes: []primitive.EventType{primitive.EventTypeSchemaChange, primitive.EventTypeStatusChange},
+	})), responseChannel)
+	require.Nil(t, err)
+	require.False(t, rejected)
+
+	// registering for the same event types again counts against the limit as well
+	register := mustEncodeFrame(t, &message.Register{
+		EventTypes: []primitive.EventType{primitive.EventTypeSchemaChange, primitive.EventTypeStatusChange},
+	})
+	rejected, err = ch.handleRegisterLimit(NewFrameDecodeContext(register), responseChannel)
+	require.Nil(t, err)
+	require.True(t, rejected)
+	require.Equal(t, int64(1), rejectedRegisterRequests.get())
+
+	response := <-responseChannel
+	decodedResponse, err := defaultCodec.ConvertFromRawFrame(response.aggregatedResponse)
+	require.Nil(t, err)
+	require.Equal(t, register.Header.StreamId, decodedResponse.Header.StreamId)
+	protocolErr, ok := decodedResponse.Body.Message.(*message.ProtocolError)
+	require.True(t, ok, "expected PROTOCOL_ERROR but got %v", decodedResponse.Body.Message)
+	require.Equal(t, "Too many event registrations on this connection (2 event types were registered already, "+
+		"2 more were requested, the limit is 3)", protocolErr.ErrorMessage)
+
+	// rejected registrations are not counted so the connection can still register up to the limit
+	rejected, err = ch.handleRegisterLimit(NewFrameDecodeContext(mustEncodeFrame(t, &message.Register{
+		EventTypes: []primitive.EventType{primitive.EventTypeTopologyChange},
+	})), responseChannel)
+	require.Nil(t, err)
+	require.False(t, rejected)
+	require.Equal(t, int64(1), rejectedRegisterRequests.get())
+
+	// other requests are not affected by the limit
+	rejected, err = ch.handleRegisterLimit(NewFrameDecodeContext(mustEncodeFrame(t, &message.Options{})), responseChannel)
+	require.Nil(t, err)
+	require.False(t, rejected)
+	require.Len(t, responseChannel, 0)
+}
+
+func TestClientHandler_HandleRegisterLimit_Disabled(t *testing.T) {
+	ch := &ClientHandler{conf: config.New()}
+	for i := 0; i < 10; i++ {
+		rejected, err := ch.handleRegisterLimit(NewFrameDecodeContext(mustEncodeFrame(t, &message.Register{
+			EventTypes: []primitive.EventType{primitive.EventTypeSchemaChange},
+		})), nil)
+		require.Nil(t, err)
+		require.False(t, rejected)
+	}
+}
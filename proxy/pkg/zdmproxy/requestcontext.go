@@ -94,11 +94,28 @@ type requestContextImpl struct {
 	requestInfo           RequestInfo
 	originResponse        *frame.RawFrame
 	targetResponse        *frame.RawFrame
+	targetRequest         *frame.RawFrame // only set if the request may be retried on TARGET, see reprepareTargetWrite
 	state                 int
 	timer                 *time.Timer
 	lock                  *sync.Mutex
 	startTime             time.Time
 	customResponseChannel chan *customResponse
+	correlationId         uint64
+
+	// only used by race reads and by dual writes that are not confirmed by both clusters, see setRaceWinner
+	raceWinner          common.ClusterType
+	raceReleased        bool
+	raceDeferredRequest func()
+
+	// only set for dual writes that are not confirmed by both clusters, see ZDM_DUAL_WRITE_CONFIRMATION
+	writeConfirmation common.DualWriteConfirmation
+
+	// primary cluster of the cutover state that the request was forwarded with
+	primaryCluster common.ClusterType
+
+	// generations of the outstanding requests on the cluster connections, see outstandingStreamIds
+	originGeneration uint64
+	targetGeneration uint64
 }
 
 func NewRequestContext(req *frame.RawFrame, requestInfo RequestInfo, startTime time.Time, customResponseChannel chan *customResponse) *requestContextImpl {
@@ -115,6 +132,11 @@ func NewRequestContext(req *frame.RawFrame, requestInfo RequestInfo, startTime t
 	}
 }
 
+// logger returns a logger that adds the correlation id of the request to every log line.
+func (recv *requestContextImpl) logger() *log.Entry {
+	return newRequestLogger(recv.correlationId)
+}
+
 func (recv *requestContextImpl) GetRequestInfo() RequestInfo {
 	return recv.requestInfo
 }
@@ -149,9 +171,13 @@ func (recv *requestContextImpl) SetTimeout(nodeMetrics *metrics.NodeMetrics, req
 			}
 			if sentOrigin && recv.originResponse == nil {
 				nodeMetrics.OriginMetrics.ClientTimeouts.Add(1)
+				nodeMetrics.OriginMetrics.ErrorRate.Track(true)
+				nodeMetrics.OriginMetrics.Latency.Track(recv.startTime)
 			}
 			if sentTarget && recv.targetResponse == nil {
 				nodeMetrics.TargetMetrics.ClientTimeouts.Add(1)
+				nodeMetrics.TargetMetrics.ErrorRate.Track(true)
+				nodeMetrics.TargetMetrics.Latency.Track(recv.startTime)
 			}
 		}
 		return true
@@ -194,8 +220,12 @@ func (recv *requestContextImpl) SetResponse(nodeMetrics *metrics.NodeMetrics, f
 		switch connectorType {
 		case ClusterConnectorTypeOrigin:
 			nodeMetrics.OriginMetrics.RequestDuration.Track(recv.startTime)
+			nodeMetrics.OriginMetrics.ErrorRate.Track(!isResponseSuccessful(f))
+			nodeMetrics.OriginMetrics.Latency.Track(recv.startTime)
 		case ClusterConnectorTypeTarget:
 			nodeMetrics.TargetMetrics.RequestDuration.Track(recv.startTime)
+			nodeMetrics.TargetMetrics.ErrorRate.Track(!isResponseSuccessful(f))
+			nodeMetrics.TargetMetrics.Latency.Track(recv.startTime)
 		case ClusterConnectorTypeAsync:
 		default:
 			log.Errorf("could not recognize connector type %v", connectorType)
@@ -43,12 +43,52 @@ func (recv *GenericRequestInfo) String() string {
 		recv.forwardDecision, recv.shouldAlsoBeSentAsync, recv.trackMetrics)
 }
 
+// TargetReprepareRequestInfo is used for the requests that the proxy sends to TARGET on its own to prepare a statement
+// again and retry a write after TARGET returned UNPREPARED (see ZDM_TARGET_UNPREPARED_WRITE_REPREPARE_ENABLED),
+// their responses are handled by the proxy instead of being processed like client responses.
+type TargetReprepareRequestInfo struct {
+	*baseRequestInfo
+}
+
+func NewTargetReprepareRequestInfo() *TargetReprepareRequestInfo {
+	return &TargetReprepareRequestInfo{baseRequestInfo: newBaseRequestInfo(forwardToTarget, false, false)}
+}
+
+func (recv *TargetReprepareRequestInfo) String() string {
+	return "TargetReprepareRequestInfo{}"
+}
+
+// RaceReadRequestInfo is used for the reads that are sent to both clusters so that the first successful response
+// is returned to the client (see ZDM_READ_RACE_ENABLED), bound reads use NewRaceReadExecuteRequestInfo instead.
+type RaceReadRequestInfo struct {
+	*baseRequestInfo
+}
+
+func NewRaceReadRequestInfo(trackMetrics bool) *RaceReadRequestInfo {
+	return &RaceReadRequestInfo{baseRequestInfo: newBaseRequestInfo(forwardToBoth, false, trackMetrics)}
+}
+
+func (recv *RaceReadRequestInfo) String() string {
+	return fmt.Sprintf("RaceReadRequestInfo{trackMetrics=%v}", recv.trackMetrics)
+}
+
 type PrepareRequestInfo struct {
 	baseRequestInfo           RequestInfo
 	replacedTerms             []*term
 	containsPositionalMarkers bool
 	query                     string
 	keyspace                  string
+
+	// keyspace of the client connection (USE or the v5 keyspace flag) when the statement was prepared,
+	// it is required to prepare the statement again if the query doesn't include the keyspace
+	requestKeyspace string
+
+	// keyspace of the table that the statement accesses (explicit or the keyspace of the client connection)
+	statementKeyspace string
+
+	// false for USE statements and system or schema queries, the EXECUTE requests of the other statements are routed
+	// by statementKeyspace, see routeByKeyspace and routeReadByKeyspace
+	routableByKeyspace bool
 }
 
 func NewPrepareRequestInfo(
@@ -62,7 +102,8 @@ func NewPrepareRequestInfo(
 		replacedTerms:             replacedTerms,
 		containsPositionalMarkers: containsPositionalMarkers,
 		query:                     query,
-		keyspace:                  keyspace}
+		keyspace:                  keyspace,
+		requestKeyspace:           keyspace}
 }
 
 func (recv *PrepareRequestInfo) String() string {
@@ -86,6 +127,14 @@ func (recv *PrepareRequestInfo) GetKeyspace() string {
 	return recv.keyspace
 }
 
+func (recv *PrepareRequestInfo) GetRequestKeyspace() string {
+	return recv.requestKeyspace
+}
+
+func (recv *PrepareRequestInfo) GetStatementKeyspace() string {
+	return recv.statementKeyspace
+}
+
 func (recv *PrepareRequestInfo) GetForwardDecision() forwardDecision {
 	if recv.GetBaseRequestInfo().GetForwardDecision() == forwardToNone {
 		return forwardToNone // intercepted queries
@@ -106,18 +155,88 @@ func (recv *PrepareRequestInfo) ContainsPositionalMarkers() bool {
 }
 
 type ExecuteRequestInfo struct {
-	preparedData PreparedData
+	preparedData      PreparedData
+	counterToOrigin   bool
+	quarantined       bool
+	readDecision      forwardDecision
+	bindValueDecision forwardDecision
+	keyspaceDecision  forwardDecision
+	failoverDecision  forwardDecision
+	raceRead          bool
 }
 
 func NewExecuteRequestInfo(preparedData PreparedData) *ExecuteRequestInfo {
 	return &ExecuteRequestInfo{preparedData: preparedData}
 }
 
+// NewCounterExecuteRequestInfo creates an ExecuteRequestInfo for a statement that targets a counter table,
+// these are only forwarded to ORIGIN because counter updates are not idempotent.
+func NewCounterExecuteRequestInfo(preparedData PreparedData) *ExecuteRequestInfo {
+	return &ExecuteRequestInfo{preparedData: preparedData, counterToOrigin: true}
+}
+
+// NewQuarantinedExecuteRequestInfo creates an ExecuteRequestInfo for a statement that is only forwarded to ORIGIN
+// because it kept failing on TARGET, see ZDM_PS_QUARANTINE_FAILURE_THRESHOLD.
+func NewQuarantinedExecuteRequestInfo(preparedData PreparedData) *ExecuteRequestInfo {
+	return &ExecuteRequestInfo{preparedData: preparedData, quarantined: true}
+}
+
+// NewRoutedExecuteRequestInfo creates an ExecuteRequestInfo for a bound read that is forwarded to the cluster chosen by
+// the adaptive read router instead of the cluster that was chosen when the statement was prepared.
+func NewRoutedExecuteRequestInfo(preparedData PreparedData, readDecision forwardDecision) *ExecuteRequestInfo {
+	return &ExecuteRequestInfo{preparedData: preparedData, readDecision: readDecision}
+}
+
+// NewBindValueRoutedExecuteRequestInfo creates an ExecuteRequestInfo for a bound statement that is only forwarded to
+// the cluster that the bind value router assigned to its bound value, it is never sent to the async connector.
+func NewBindValueRoutedExecuteRequestInfo(preparedData PreparedData, bindValueDecision forwardDecision) *ExecuteRequestInfo {
+	return &ExecuteRequestInfo{preparedData: preparedData, bindValueDecision: bindValueDecision}
+}
+
+// NewKeyspaceRoutedExecuteRequestInfo creates an ExecuteRequestInfo for a bound statement that is only forwarded to
+// the cluster that the keyspace router assigned to its keyspace when it was prepared, it is never sent to the async connector.
+func NewKeyspaceRoutedExecuteRequestInfo(preparedData PreparedData, keyspaceDecision forwardDecision) *ExecuteRequestInfo {
+	return &ExecuteRequestInfo{preparedData: preparedData, keyspaceDecision: keyspaceDecision}
+}
+
+// NewReadFailoverExecuteRequestInfo creates an ExecuteRequestInfo for a bound read that is retried on the other cluster
+// after it failed on the cluster it was forwarded to (see ZDM_READ_FAILOVER_ENABLED), it is never sent to the async connector.
+func NewReadFailoverExecuteRequestInfo(preparedData PreparedData, failoverDecision forwardDecision) *ExecuteRequestInfo {
+	return &ExecuteRequestInfo{preparedData: preparedData, failoverDecision: failoverDecision}
+}
+
+// NewRaceReadExecuteRequestInfo creates an ExecuteRequestInfo for a bound read that is sent to both clusters so that
+// the first successful response is returned to the client (see ZDM_READ_RACE_ENABLED), it is never sent to the async connector.
+func NewRaceReadExecuteRequestInfo(preparedData PreparedData) *ExecuteRequestInfo {
+	return &ExecuteRequestInfo{preparedData: preparedData, raceRead: true}
+}
+
 func (recv *ExecuteRequestInfo) String() string {
-	return fmt.Sprintf("ExecuteRequestInfo{PreparedData: %v}", recv.preparedData)
+	return fmt.Sprintf("ExecuteRequestInfo{PreparedData: %v, CounterToOrigin: %v, Quarantined: %v, ReadDecision: %v, "+
+		"BindValueDecision: %v, KeyspaceDecision: %v, FailoverDecision: %v, RaceRead: %v}",
+		recv.preparedData, recv.counterToOrigin, recv.quarantined, recv.readDecision, recv.bindValueDecision,
+		recv.keyspaceDecision, recv.failoverDecision, recv.raceRead)
 }
 
 func (recv *ExecuteRequestInfo) GetForwardDecision() forwardDecision {
+	if recv.counterToOrigin || recv.quarantined {
+		return forwardToOrigin
+	}
+	if recv.raceRead {
+		return forwardToBoth
+	}
+	if recv.failoverDecision != "" {
+		return recv.failoverDecision
+	}
+	if recv.bindValueDecision != "" {
+		return recv.bindValueDecision
+	}
+	if recv.keyspaceDecision != "" {
+		return recv.keyspaceDecision
+	}
+	if recv.readDecision != "" {
+		return recv.readDecision
+	}
 	return recv.preparedData.GetPrepareRequestInfo().GetBaseRequestInfo().GetForwardDecision()
 }
 
@@ -126,6 +245,10 @@ func (recv *ExecuteRequestInfo) GetPreparedData() PreparedData {
 }
 
 func (recv *ExecuteRequestInfo) ShouldAlsoBeSentAsync() bool {
+	if recv.counterToOrigin || recv.quarantined || recv.bindValueDecision != "" || recv.keyspaceDecision != "" ||
+		recv.failoverDecision != "" || recv.raceRead {
+		return false
+	}
 	return recv.preparedData.GetPrepareRequestInfo().GetBaseRequestInfo().ShouldAlsoBeSentAsync()
 }
 
@@ -0,0 +1,121 @@
+package zdmproxy
+
+import (
+	"encoding/binary"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"hash"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// retryDetector detects requests that are likely client retries. The protocol doesn't mark retries so a QUERY or
+// EXECUTE is considered a retry if a request with the same normalized query (or prepared id), bound values and paging
+// state was received on the same connection within the detection window.
+// A nil retryDetector doesn't detect any retries.
+type retryDetector struct {
+	normalizationLevel common.QueryNormalizationLevel
+
+	lastSeen *trackingMap
+}
+
+// newRetryDetector returns a retryDetector that keeps at most maxEntries fingerprints, each for the shorter of
+// the window and maxAge. The retryDetector must be closed when the connection is closed.
+func newRetryDetector(
+	enabled bool, window time.Duration, normalizationLevel common.QueryNormalizationLevel,
+	maxEntries int, maxAge time.Duration, entriesGauge metrics.Gauge, evictions metrics.Counter) *retryDetector {
+	if !enabled {
+		return nil
+	}
+
+	ttl := window
+	if maxAge < ttl {
+		ttl = maxAge
+	}
+	return &retryDetector{
+		normalizationLevel: normalizationLevel,
+		lastSeen:           newTrackingMap(maxEntries, ttl, entriesGauge, evictions),
+	}
+}
+
+// isLikelyRetry records the request and returns true if the same request was already received within the window.
+func (recv *retryDetector) isLikelyRetry(msg message.Message, now time.Time) bool {
+	if recv == nil {
+		return false
+	}
+
+	fingerprint, ok := getRetryFingerprint(msg, recv.normalizationLevel)
+	if !ok {
+		return false
+	}
+
+	_, exists := recv.lastSeen.get(fingerprint, now)
+	recv.lastSeen.put(fingerprint, nil, now)
+	return exists
+}
+
+// close removes every fingerprint, it is called when the connection is closed.
+func (recv *retryDetector) close() {
+	if recv == nil {
+		return
+	}
+	recv.lastSeen.close()
+}
+
+// getRetryFingerprint returns a hash of the parts of the request that a client retry would not change,
+// false is returned for requests that are not QUERY or EXECUTE.
+// The query is normalized (see normalizeQuery) so that formatting differences don't matter.
+func getRetryFingerprint(msg message.Message, normalizationLevel common.QueryNormalizationLevel) (uint64, bool) {
+	h := fnv.New64a()
+	var options *message.QueryOptions
+	switch typedMsg := msg.(type) {
+	case *message.Query:
+		writeRetryFingerprintBytes(h, []byte{byte(primitive.OpCodeQuery)})
+		writeRetryFingerprintBytes(h, []byte(normalizeQuery(typedMsg.Query, normalizationLevel)))
+		options = typedMsg.Options
+	case *message.Execute:
+		writeRetryFingerprintBytes(h, []byte{byte(primitive.OpCodeExecute)})
+		writeRetryFingerprintBytes(h, typedMsg.QueryId)
+		options = typedMsg.Options
+	default:
+		return 0, false
+	}
+
+	if options != nil {
+		// the paging state is part of the fingerprint so that fetching the next page is not a retry
+		writeRetryFingerprintBytes(h, options.PagingState)
+		for _, value := range options.PositionalValues {
+			writeRetryFingerprintValue(h, value)
+		}
+		names := make([]string, 0, len(options.NamedValues))
+		for name := range options.NamedValues {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			writeRetryFingerprintBytes(h, []byte(name))
+			writeRetryFingerprintValue(h, options.NamedValues[name])
+		}
+	}
+	return h.Sum64(), true
+}
+
+func writeRetryFingerprintValue(h hash.Hash64, value *primitive.Value) {
+	if value == nil {
+		writeRetryFingerprintBytes(h, nil)
+		return
+	}
+	writeRetryFingerprintBytes(h, []byte{byte(value.Type)})
+	writeRetryFingerprintBytes(h, value.Contents)
+}
+
+// writeRetryFingerprintBytes writes the length before the bytes so that adjacent fields can't be confused.
+func writeRetryFingerprintBytes(h hash.Hash64, b []byte) {
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(b)))
+	_, _ = h.Write(length)
+	_, _ = h.Write(b)
+}
@@ -0,0 +1,88 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRetryDetector_IsLikelyRetry(t *testing.T) {
+	query := func(cql string, values ...string) *message.Query {
+		options := &message.QueryOptions{}
+		for _, value := range values {
+			options.PositionalValues = append(options.PositionalValues, primitive.NewValue([]byte(value)))
+		}
+		return &message.Query{Query: cql, Options: options}
+	}
+	execute := func(queryId string, values ...string) *message.Execute {
+		options := &message.QueryOptions{}
+		for _, value := range values {
+			options.PositionalValues = append(options.PositionalValues, primitive.NewValue([]byte(value)))
+		}
+		return &message.Execute{QueryId: []byte(queryId), Options: options}
+	}
+	withPagingState := func(msg *message.Query, pagingState string) *message.Query {
+		msg.Options.PagingState = []byte(pagingState)
+		return msg
+	}
+
+	tests := []struct {
+		name          string
+		first         message.Message
+		second        message.Message
+		elapsed       time.Duration
+		expectedRetry bool
+	}{
+		{"same query", query("SELECT * FROM ks.t WHERE a = ?", "1"), query("SELECT * FROM ks.t WHERE a = ?", "1"), 100 * time.Millisecond, true},
+		{"same query with different whitespace", query("SELECT * FROM ks.t WHERE a = ?", "1"), query(" SELECT *\n FROM ks.t  WHERE a = ?", "1"), 100 * time.Millisecond, true},
+		{"same query with a comment", query("SELECT * FROM ks.t WHERE a = ?", "1"), query("SELECT * FROM ks.t /* retry */ WHERE a = ? -- app", "1"), 100 * time.Millisecond, true},
+		{"same query with different case", query("SELECT * FROM ks.t WHERE a = ?", "1"), query("select * from ks.t where a = ?", "1"), 100 * time.Millisecond, false},
+		{"same query outside of the window", query("SELECT * FROM ks.t WHERE a = ?", "1"), query("SELECT * FROM ks.t WHERE a = ?", "1"), 2 * time.Second, false},
+		{"different bound values", query("SELECT * FROM ks.t WHERE a = ?", "1"), query("SELECT * FROM ks.t WHERE a = ?", "2"), 100 * time.Millisecond, false},
+		{"values moved between fields", query("SELECT * FROM ks.t WHERE a = ? AND b = ?", "12", "3"), query("SELECT * FROM ks.t WHERE a = ? AND b = ?", "1", "23"), 100 * time.Millisecond, false},
+		{"different query", query("SELECT * FROM ks.t WHERE a = ?", "1"), query("SELECT * FROM ks.t2 WHERE a = ?", "1"), 100 * time.Millisecond, false},
+		{"next page", query("SELECT * FROM ks.t"), withPagingState(query("SELECT * FROM ks.t"), "page2"), 100 * time.Millisecond, false},
+		{"same execute", execute("id1", "1"), execute("id1", "1"), 100 * time.Millisecond, true},
+		{"different prepared id", execute("id1", "1"), execute("id2", "1"), 100 * time.Millisecond, false},
+		{"execute after query", query("id1", "1"), execute("id1", "1"), 100 * time.Millisecond, false},
+		{"not a query or execute", &message.Prepare{Query: "SELECT * FROM ks.t"}, &message.Prepare{Query: "SELECT * FROM ks.t"}, 100 * time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector := newRetryDetector(true, time.Second, common.QueryNormalizationLevelWhitespace, 100, time.Minute, newFakeGauge(), newFakeCounter())
+			now := time.Now()
+			require.False(t, detector.isLikelyRetry(tt.first, now))
+			require.Equal(t, tt.expectedRetry, detector.isLikelyRetry(tt.second, now.Add(tt.elapsed)))
+		})
+	}
+}
+
+func TestRetryDetector_PrunesExpiredRequests(t *testing.T) {
+	detector := newRetryDetector(true, time.Second, common.QueryNormalizationLevelWhitespace, 100, time.Minute, newFakeGauge(), newFakeCounter())
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		require.False(t, detector.isLikelyRetry(&message.Query{Query: "SELECT * FROM ks.t", Options: &message.QueryOptions{
+			PositionalValues: []*primitive.Value{primitive.NewValue([]byte{byte(i)})},
+		}}, now))
+	}
+	require.Equal(t, 10, detector.lastSeen.len())
+
+	// a retry refreshes the last time the request was seen
+	retried := &message.Query{Query: "SELECT * FROM ks.t2"}
+	require.False(t, detector.isLikelyRetry(retried, now))
+	require.True(t, detector.isLikelyRetry(retried, now.Add(900*time.Millisecond)))
+	require.True(t, detector.isLikelyRetry(retried, now.Add(1800*time.Millisecond)))
+	require.Equal(t, 1, detector.lastSeen.len())
+}
+
+func TestRetryDetector_Disabled(t *testing.T) {
+	detector := newRetryDetector(false, time.Second, common.QueryNormalizationLevelWhitespace, 100, time.Minute, newFakeGauge(), newFakeCounter())
+	require.Nil(t, detector)
+	msg := &message.Query{Query: "SELECT * FROM ks.t"}
+	require.False(t, detector.isLikelyRetry(msg, time.Now()))
+	require.False(t, detector.isLikelyRetry(msg, time.Now()))
+}
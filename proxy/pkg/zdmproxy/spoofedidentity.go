@@ -0,0 +1,91 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+)
+
+const (
+	supportedCqlVersionOption  = "CQL_VERSION"
+	supportedProductTypeOption = "PRODUCT_TYPE"
+)
+
+// getSpoofedSystemColumns returns the system.local and system.peers column values that replace the values of the
+// clusters, see ZDM_SPOOFED_CLUSTER_NAME and the other ZDM_SPOOFED_* settings.
+func getSpoofedSystemColumns(conf *config.Config) map[string]string {
+	spoofedColumns := make(map[string]string)
+	for column, value := range map[string]string{
+		clusterNameColumn.Name:    conf.SpoofedClusterName,
+		releaseVersionColumn.Name: conf.SpoofedReleaseVersion,
+		dseVersionColumn.Name:     conf.SpoofedDseVersion,
+		cqlVersionColumn.Name:     conf.SpoofedCqlVersion,
+	} {
+		if value != "" {
+			spoofedColumns[column] = value
+		}
+	}
+	return spoofedColumns
+}
+
+// withSpoofedIdentity returns copies of the virtual hosts and of the system.local column data with the spoofed
+// column values, they are returned as is if nothing is spoofed.
+func withSpoofedIdentity(
+	conf *config.Config, virtualHosts []*VirtualHost,
+	systemLocalColumnData map[string]*optionalColumn) ([]*VirtualHost, map[string]*optionalColumn) {
+	spoofedColumns := getSpoofedSystemColumns(conf)
+	if len(spoofedColumns) == 0 {
+		return virtualHosts, systemLocalColumnData
+	}
+
+	result := make([]*VirtualHost, len(virtualHosts))
+	for i, virtualHost := range virtualHosts {
+		host := *virtualHost.Host
+		host.ColumnData = withSpoofedColumns(host.ColumnData, spoofedColumns)
+		virtualHostCopy := *virtualHost
+		virtualHostCopy.Host = &host
+		result[i] = &virtualHostCopy
+	}
+	return result, withSpoofedColumns(systemLocalColumnData, spoofedColumns)
+}
+
+// withSpoofedColumns returns a copy of the column data with the spoofed values, the host column data only contains
+// the columns of system.peers (e.g. release_version) and the system.local column data the other columns of system.local
+// (e.g. cluster_name) so the spoofed columns that the column data doesn't contain are not added.
+func withSpoofedColumns(
+	columnData map[string]*optionalColumn, spoofedColumns map[string]string) map[string]*optionalColumn {
+	result := make(map[string]*optionalColumn, len(columnData))
+	for column, value := range columnData {
+		result[column] = value
+	}
+	for column, value := range spoofedColumns {
+		if _, ok := result[column]; ok {
+			spoofedValue := value
+			result[column] = NewOptionalColumn(&spoofedValue, true)
+		}
+	}
+	return result
+}
+
+// spoofSupportedOptions returns a copy of the SUPPORTED message with the spoofed CQL_VERSION and PRODUCT_TYPE
+// options, nil is returned if nothing is spoofed.
+func spoofSupportedOptions(conf *config.Config, supported *message.Supported) *message.Supported {
+	spoofedOptions := make(map[string][]string)
+	if conf.SpoofedCqlVersion != "" {
+		spoofedOptions[supportedCqlVersionOption] = []string{conf.SpoofedCqlVersion}
+	}
+	if conf.SpoofedProductType != "" {
+		spoofedOptions[supportedProductTypeOption] = []string{conf.SpoofedProductType}
+	}
+	if len(spoofedOptions) == 0 {
+		return nil
+	}
+
+	result := &message.Supported{Options: make(map[string][]string, len(supported.Options)+len(spoofedOptions))}
+	for option, values := range supported.Options {
+		result.Options[option] = values
+	}
+	for option, values := range spoofedOptions {
+		result.Options[option] = values
+	}
+	return result
+}
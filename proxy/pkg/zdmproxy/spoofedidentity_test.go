@@ -0,0 +1,72 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestWithSpoofedIdentity(t *testing.T) {
+	releaseVersion, clusterName, cqlVersion := "3.11.2", "origin", "3.4.4"
+	virtualHosts := []*VirtualHost{{
+		Host: &Host{ColumnData: map[string]*optionalColumn{
+			releaseVersionColumn.Name: NewOptionalColumn(&releaseVersion, true),
+			dseVersionColumn.Name:     NewOptionalColumn(nil, false),
+		}},
+	}}
+	systemLocalColumnData := map[string]*optionalColumn{
+		clusterNameColumn.Name: NewOptionalColumn(&clusterName, true),
+		cqlVersionColumn.Name:  NewOptionalColumn(&cqlVersion, true),
+	}
+
+	// nothing is copied if nothing is spoofed
+	conf := config.New()
+	spoofedHosts, spoofedLocalColumnData := withSpoofedIdentity(conf, virtualHosts, systemLocalColumnData)
+	require.Equal(t, virtualHosts, spoofedHosts)
+	require.Equal(t, systemLocalColumnData, spoofedLocalColumnData)
+
+	conf.SpoofedClusterName = "virtual"
+	conf.SpoofedReleaseVersion = "4.0.11"
+	conf.SpoofedDseVersion = "6.8.40"
+	spoofedHosts, spoofedLocalColumnData = withSpoofedIdentity(conf, virtualHosts, systemLocalColumnData)
+	require.Equal(t, "4.0.11", *spoofedHosts[0].Host.ColumnData[releaseVersionColumn.Name].AsNillableString())
+	require.Equal(t, "6.8.40", *spoofedHosts[0].Host.ColumnData[dseVersionColumn.Name].AsNillableString())
+	require.True(t, spoofedHosts[0].Host.ColumnData[dseVersionColumn.Name].exists)
+	require.NotContains(t, spoofedHosts[0].Host.ColumnData, clusterNameColumn.Name)
+	require.Equal(t, "virtual", *spoofedLocalColumnData[clusterNameColumn.Name].AsNillableString())
+	require.Equal(t, "3.4.4", *spoofedLocalColumnData[cqlVersionColumn.Name].AsNillableString())
+	require.NotContains(t, spoofedLocalColumnData, releaseVersionColumn.Name)
+
+	// the topology of the control connection is not modified
+	require.Equal(t, "3.11.2", *virtualHosts[0].Host.ColumnData[releaseVersionColumn.Name].AsNillableString())
+	require.Equal(t, "origin", *systemLocalColumnData[clusterNameColumn.Name].AsNillableString())
+}
+
+func TestSpoofSupportedOptions(t *testing.T) {
+	supported := &message.Supported{Options: map[string][]string{
+		"COMPRESSION": {"lz4"},
+		"CQL_VERSION": {"3.4.5"},
+	}}
+
+	conf := config.New()
+	require.Nil(t, spoofSupportedOptions(conf, supported))
+
+	conf.SpoofedCqlVersion = "3.4.4"
+	conf.SpoofedProductType = "DATASTAX_APOLLO"
+	require.Equal(t, map[string][]string{
+		"COMPRESSION":  {"lz4"},
+		"CQL_VERSION":  {"3.4.4"},
+		"PRODUCT_TYPE": {"DATASTAX_APOLLO"},
+	}, spoofSupportedOptions(conf, supported).Options)
+	require.Equal(t, []string{"3.4.5"}, supported.Options["CQL_VERSION"])
+
+	// forwarded SUPPORTED responses are spoofed before they are returned to the client
+	ch := &ClientHandler{conf: conf}
+	response, err := ch.processClientResponse(mustEncodeFrame(t, supported), common.ClusterTypeTarget, nil)
+	require.Nil(t, err)
+	decodedResponse, err := defaultCodec.ConvertFromRawFrame(response)
+	require.Nil(t, err)
+	require.Equal(t, []string{"DATASTAX_APOLLO"}, decodedResponse.Body.Message.(*message.Supported).Options["PRODUCT_TYPE"])
+}
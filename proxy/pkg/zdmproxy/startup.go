@@ -1,6 +1,7 @@
 package zdmproxy
 
 import (
+	"errors"
 	"fmt"
 	"github.com/datastax/go-cassandra-native-protocol/frame"
 	"github.com/datastax/go-cassandra-native-protocol/message"
@@ -8,11 +9,16 @@ import (
 	"github.com/datastax/zdm-proxy/proxy/pkg/common"
 	log "github.com/sirupsen/logrus"
 	"net"
+	"strings"
 	"time"
 )
 
 const (
 	maxAuthRetries = 5
+
+	// startupOptionKeyspace is not part of the protocol spec but some drivers use it
+	// to set the initial keyspace of a connection instead of sending a USE request
+	startupOptionKeyspace = "KEYSPACE"
 )
 
 type AuthError struct {
@@ -55,16 +61,24 @@ func (ch *ClientHandler) handleSecondaryHandshakeStartup(
 	phase := 1
 	attempts := 0
 
-	var authenticator *DsePlainTextAuthenticator
+	var authenticator Authenticator
+	var credentials *AuthCredentials
+	var secondaryCluster common.ClusterType
 	if asyncConnector {
-		if ch.asyncHandshakeCreds != nil {
-			authenticator = &DsePlainTextAuthenticator{
-				Credentials: ch.asyncHandshakeCreds,
-			}
-		}
-	} else if ch.secondaryHandshakeCreds != nil {
-		authenticator = &DsePlainTextAuthenticator{
-			Credentials: ch.secondaryHandshakeCreds,
+		credentials = ch.asyncHandshakeCreds
+		secondaryCluster = ch.asyncConnector.clusterType
+	} else if ch.forwardAuthToTarget {
+		credentials = ch.secondaryHandshakeCreds
+		secondaryCluster = common.ClusterTypeOrigin
+	} else {
+		credentials = ch.secondaryHandshakeCreds
+		secondaryCluster = common.ClusterTypeTarget
+	}
+	if credentials != nil {
+		var err error
+		authenticator, err = newAuthenticator(ch.getAuthenticatorProvider(secondaryCluster), credentials)
+		if err != nil {
+			return fmt.Errorf("secondary (%v) handshake failed: %w", logIdentifier, err)
 		}
 	}
 
@@ -100,7 +114,7 @@ func (ch *ClientHandler) handleSecondaryHandshakeStartup(
 				return fmt.Errorf("could not perform handshake step: %w", err)
 			}
 
-			request, err = defaultCodec.ConvertToRawFrame(parsedRequest)
+			request, err = ch.codec.get().ConvertToRawFrame(parsedRequest)
 			if err != nil {
 				return fmt.Errorf("could not convert auth response frame to raw frame: %w", err)
 			}
@@ -108,10 +122,10 @@ func (ch *ClientHandler) handleSecondaryHandshakeStartup(
 		}
 
 		if !requestSent {
-			overallRequestStartTime := time.Now()
+			overallRequestStartTime := nowFunc()
 			channel := make(chan *customResponse, 1)
 			err := ch.executeRequest(
-				NewFrameDecodeContext(request),
+				ch.newFrameDecodeContext(request),
 				NewGenericRequestInfo(forwardToSecondary, asyncConnector, false),
 				ch.LoadCurrentKeyspace(),
 				overallRequestStartTime,
@@ -139,7 +153,7 @@ func (ch *ClientHandler) handleSecondaryHandshakeStartup(
 		}
 
 		newPhase, parsedFrame, done, err := handleSecondaryHandshakeResponse(
-			phase, response, clientIPAddress, clusterAddress, logIdentifier)
+			ch.codec.get(), phase, response, clientIPAddress, clusterAddress, logIdentifier)
 		if err != nil {
 			return err
 		}
@@ -161,9 +175,9 @@ func (ch *ClientHandler) handleSecondaryHandshakeStartup(
 }
 
 func handleSecondaryHandshakeResponse(
-	phase int, f *frame.RawFrame, clientIPAddress net.Addr,
+	codec frame.RawCodec, phase int, f *frame.RawFrame, clientIPAddress net.Addr,
 	clusterAddress net.Addr, logIdentifier string) (int, *frame.Frame, bool, error) {
-	parsedFrame, err := defaultCodec.ConvertFromRawFrame(f)
+	parsedFrame, err := codec.ConvertFromRawFrame(f)
 	if err != nil {
 		return phase, nil, false, fmt.Errorf("could not decode frame from %v: %w", clusterAddress, err)
 	}
@@ -193,6 +207,103 @@ func handleSecondaryHandshakeResponse(
 	return phase, parsedFrame, done, nil
 }
 
+// setStartupRequest caches the client's STARTUP request and the secondary cluster's response to it for the secondary
+// handshake. A client can send another STARTUP request if the handshake did not complete (e.g. with other options after
+// a failed attempt) so the options of every STARTUP request are applied before it replaces the cached one, the cached
+// request is cleared if they can not be applied to make sure that the secondary handshake is never started with a
+// STARTUP request that doesn't match the session.
+func (ch *ClientHandler) setStartupRequest(startupRequest *frame.RawFrame, secondaryResponse *frame.RawFrame) error {
+	replaced := ch.startupRequest != nil
+	ch.clearStartupRequest()
+	if startupRequest.Header.Version != secondaryResponse.Header.Version {
+		return fmt.Errorf("startup response version %v does not match startup request version %v",
+			secondaryResponse.Header.Version, startupRequest.Header.Version)
+	}
+
+	err := ch.storeStartupOptions(startupRequest)
+	if err != nil {
+		return err
+	}
+
+	if replaced {
+		log.Debugf("Client sent another STARTUP request, replacing the cached one.")
+	}
+	ch.startupRequest = startupRequest
+	ch.secondaryStartupResponse = secondaryResponse
+	return nil
+}
+
+func (ch *ClientHandler) clearStartupRequest() {
+	ch.startupRequest = nil
+	ch.secondaryStartupResponse = nil
+}
+
+// getStartupRequest returns the cached STARTUP request and the secondary cluster's response to it, it returns an error
+// if they were not negotiated with the protocol version of the request that completed the handshake with the client.
+func (ch *ClientHandler) getStartupRequest(version primitive.ProtocolVersion) (*frame.RawFrame, *frame.RawFrame, error) {
+	if ch.startupRequest == nil {
+		return nil, nil, errors.New("can not start secondary handshake before a Startup request was received")
+	}
+	if ch.secondaryStartupResponse == nil {
+		return nil, nil, errors.New("can not start secondary handshake before a Startup response was received")
+	}
+	if ch.startupRequest.Header.Version != version {
+		return nil, nil, fmt.Errorf("can not start secondary handshake with Startup request version %v, "+
+			"the client negotiated version %v", ch.startupRequest.Header.Version, version)
+	}
+	return ch.startupRequest, ch.secondaryStartupResponse, nil
+}
+
+// sendDuplicateStartupErrorToClient rejects a STARTUP request that is received after the handshake completed like the
+// clusters do. It is not forwarded and the cached STARTUP request is kept so that the options of the session (keyspace,
+// compression, etc.) and the STARTUP request that new cluster connections are initialized with do not change.
+func (ch *ClientHandler) sendDuplicateStartupErrorToClient(requestFrame *frame.RawFrame) error {
+	log.Warnf("Client %v sent STARTUP after the handshake completed, returning a protocol error.",
+		ch.clientConnector.connection.RemoteAddr())
+	f := frame.NewFrame(requestFrame.Header.Version, requestFrame.Header.StreamId, &message.ProtocolError{
+		ErrorMessage: "Unexpected message STARTUP, the connection is already initialized"})
+	protocolErrorResponse, err := ch.codec.get().ConvertToRawFrame(f)
+	if err != nil {
+		return fmt.Errorf("could not create protocol error response for duplicate STARTUP: %w", err)
+	}
+	ch.clientConnector.sendResponseToClient(protocolErrorResponse)
+	return nil
+}
+
+// rejectUnsupportedStartupCompression returns true if the STARTUP request negotiates compression with protocol v5 or
+// later, it is rejected with a protocol error instead of being forwarded because the proxy doesn't compress segments:
+// the client would expect compressed segments after the handshake.
+func (ch *ClientHandler) rejectUnsupportedStartupCompression(requestFrame *frame.RawFrame) (bool, error) {
+	if requestFrame.Header.OpCode != primitive.OpCodeStartup || requestFrame.Header.Version < primitive.ProtocolVersion5 {
+		return false, nil
+	}
+	decodedFrame, err := ch.codec.get().ConvertFromRawFrame(requestFrame)
+	if err != nil {
+		return false, fmt.Errorf("could not decode startup request: %w", err)
+	}
+	startup, ok := decodedFrame.Body.Message.(*message.Startup)
+	if !ok {
+		return false, fmt.Errorf("expected startup message but got %v", decodedFrame.Body.Message)
+	}
+	compression := startup.GetCompression()
+	if compression == "" || primitive.Compression(strings.ToUpper(string(compression))) == primitive.CompressionNone {
+		return false, nil
+	}
+
+	log.Warnf("Client %v negotiated %v compression with protocol version %v, returning a protocol error "+
+		"because segment compression is not supported.", ch.clientConnector.connection.RemoteAddr(), compression,
+		requestFrame.Header.Version)
+	f := frame.NewFrame(requestFrame.Header.Version, requestFrame.Header.StreamId, &message.ProtocolError{
+		ErrorMessage: fmt.Sprintf("Compression %v is not supported by the proxy with protocol version %v, "+
+			"please disable compression", compression, requestFrame.Header.Version)})
+	protocolErrorResponse, err := ch.codec.get().ConvertToRawFrame(f)
+	if err != nil {
+		return false, fmt.Errorf("could not create protocol error response for unsupported compression: %w", err)
+	}
+	ch.clientConnector.sendResponseToClient(protocolErrorResponse)
+	return true, nil
+}
+
 func validateSecondaryStartupResponse(f *frame.RawFrame, clusterType common.ClusterType) error {
 	switch f.Header.OpCode {
 	case primitive.OpCodeAuthenticate:
@@ -207,3 +318,60 @@ func validateSecondaryStartupResponse(f *frame.RawFrame, clusterType common.Clus
 
 	return nil
 }
+
+func (ch *ClientHandler) getAuthenticatorProvider(clusterType common.ClusterType) AuthenticatorProvider {
+	if clusterType == common.ClusterTypeOrigin {
+		return ch.originAuthenticatorProvider
+	}
+	return ch.targetAuthenticatorProvider
+}
+
+// trackClusterAuthenticator logs and meters the authenticator class that the cluster advertised if the STARTUP response
+// is AUTHENTICATE, authenticators that don't match between clusters are a common cause of confusing handshake failures.
+func (ch *ClientHandler) trackClusterAuthenticator(startupResponse *frame.RawFrame, clusterType common.ClusterType) {
+	if startupResponse == nil || startupResponse.Header.OpCode != primitive.OpCodeAuthenticate {
+		return
+	}
+
+	parsedFrame, err := ch.codec.get().ConvertFromRawFrame(startupResponse)
+	if err != nil {
+		log.Warnf("Could not decode AUTHENTICATE response from %v: %v", clusterType, err)
+		return
+	}
+	authenticate, ok := parsedFrame.Body.Message.(*message.Authenticate)
+	if !ok {
+		return
+	}
+
+	authenticator := authenticate.Authenticator
+	switch clusterType {
+	case common.ClusterTypeOrigin:
+		ch.originAuthenticator = authenticator
+	case common.ClusterTypeTarget:
+		ch.targetAuthenticator = authenticator
+	}
+	log.Debugf("%v requested authentication with authenticator %v.", clusterType, authenticator)
+
+	counter, err := ch.metricHandler.GetClusterAuthenticatorCounter(strings.ToLower(string(clusterType)), authenticator)
+	if err != nil {
+		log.Errorf("Could not track authenticator %v of %v: %v", authenticator, clusterType, err)
+		return
+	}
+	counter.Add(1)
+}
+
+// getStartupKeyspace returns the keyspace set in the STARTUP options or an empty string if there is none.
+// The value is handled like an identifier in a USE statement: quoted names are case sensitive, unquoted names are not.
+func getStartupKeyspace(startup *message.Startup) string {
+	for option, value := range startup.Options {
+		if !strings.EqualFold(option, startupOptionKeyspace) {
+			continue
+		}
+		keyspace := strings.TrimSpace(value)
+		if len(keyspace) >= 2 && strings.HasPrefix(keyspace, "\"") && strings.HasSuffix(keyspace, "\"") {
+			return strings.ReplaceAll(keyspace[1:len(keyspace)-1], "\"\"", "\"")
+		}
+		return strings.ToLower(keyspace)
+	}
+	return ""
+}
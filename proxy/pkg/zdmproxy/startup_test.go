@@ -0,0 +1,188 @@
+package zdmproxy
+
+import (
+	"context"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/prommetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetStartupKeyspace(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  map[string]string
+		expected string
+	}{
+		{"no options", nil, ""},
+		{"no keyspace", map[string]string{message.StartupOptionCqlVersion: "3.0.0"}, ""},
+		{"keyspace", map[string]string{message.StartupOptionCqlVersion: "3.0.0", "KEYSPACE": "ks1"}, "ks1"},
+		{"lower case option", map[string]string{"keyspace": "ks1"}, "ks1"},
+		{"unquoted keyspace is case insensitive", map[string]string{"KEYSPACE": "MyKs"}, "myks"},
+		{"quoted keyspace is case sensitive", map[string]string{"KEYSPACE": "\"MyKs\""}, "MyKs"},
+		{"empty keyspace", map[string]string{"KEYSPACE": " "}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, getStartupKeyspace(&message.Startup{Options: tt.options}))
+		})
+	}
+}
+
+func TestTrackClusterAuthenticator(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	ch := &ClientHandler{
+		metricHandler: metrics.NewMetricHandler(
+			prommetrics.NewPrometheusMetricFactory(registry), nil, nil, nil, newFakeProxyMetrics(), nil, nil, nil),
+	}
+
+	passwordAuthenticator := "org.apache.cassandra.auth.PasswordAuthenticator"
+	customAuthenticator := "com.example.auth.CustomAuthenticator"
+	ch.trackClusterAuthenticator(mustEncodeFrame(t, &message.Authenticate{Authenticator: passwordAuthenticator}), common.ClusterTypeOrigin)
+	ch.trackClusterAuthenticator(mustEncodeFrame(t, &message.Authenticate{Authenticator: customAuthenticator}), common.ClusterTypeTarget)
+	ch.trackClusterAuthenticator(mustEncodeFrame(t, &message.Authenticate{Authenticator: customAuthenticator}), common.ClusterTypeTarget)
+	require.Equal(t, passwordAuthenticator, ch.originAuthenticator)
+	require.Equal(t, customAuthenticator, ch.targetAuthenticator)
+
+	// READY means that the cluster did not request authentication
+	ch.trackClusterAuthenticator(mustEncodeFrame(t, &message.Ready{}), common.ClusterTypeOrigin)
+	require.Equal(t, passwordAuthenticator, ch.originAuthenticator)
+
+	metricFamilies, err := registry.Gather()
+	require.Nil(t, err)
+	require.Len(t, metricFamilies, 1)
+	require.Equal(t, "zdm_proxy_cluster_authenticators_total", metricFamilies[0].GetName())
+	counts := map[string]float64{}
+	for _, m := range metricFamilies[0].GetMetric() {
+		labels := map[string]string{}
+		for _, label := range m.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		counts[labels["cluster"]+"/"+labels["authenticator"]] = m.GetCounter().GetValue()
+	}
+	require.Equal(t, map[string]float64{
+		"origin/" + passwordAuthenticator: 1,
+		"target/" + customAuthenticator:   2,
+	}, counts)
+}
+
+func TestSetStartupRequest(t *testing.T) {
+	ch := &ClientHandler{
+		originCassandraConnector: &ClusterConnector{connectorType: ClusterConnectorTypeOrigin},
+		targetCassandraConnector: &ClusterConnector{connectorType: ClusterConnectorTypeTarget},
+		currentKeyspaceName:      &atomic.Value{},
+		compressionBridge:        newCompressionBridge(false, true, 0),
+	}
+
+	_, _, err := ch.getStartupRequest(primitive.ProtocolVersion4)
+	require.NotNil(t, err)
+
+	firstStartup := mustEncodeFrame(t, &message.Startup{Options: map[string]string{
+		message.StartupOptionCqlVersion:  "3.0.0",
+		message.StartupOptionCompression: "lz4",
+		startupOptionKeyspace:            "ks1",
+	}})
+	firstResponse := mustEncodeFrame(t, &message.Ready{})
+	require.Nil(t, ch.setStartupRequest(firstStartup, firstResponse))
+	startupRequest, startupResponse, err := ch.getStartupRequest(primitive.ProtocolVersion4)
+	require.Nil(t, err)
+	require.Same(t, firstStartup, startupRequest)
+	require.Same(t, firstResponse, startupResponse)
+	require.Equal(t, "ks1", ch.LoadCurrentKeyspace())
+	require.NotNil(t, ch.compressionBridge.getCompressor())
+
+	// the options of a second STARTUP request replace the ones of the first request
+	secondStartup := mustEncodeFrame(t, &message.Startup{Options: map[string]string{
+		message.StartupOptionCqlVersion: "3.0.0",
+	}})
+	secondResponse := mustEncodeFrame(t, &message.Authenticate{Authenticator: "org.apache.cassandra.auth.PasswordAuthenticator"})
+	require.Nil(t, ch.setStartupRequest(secondStartup, secondResponse))
+	startupRequest, startupResponse, err = ch.getStartupRequest(primitive.ProtocolVersion4)
+	require.Nil(t, err)
+	require.Same(t, secondStartup, startupRequest)
+	require.Same(t, secondResponse, startupResponse)
+	require.Equal(t, "", ch.LoadCurrentKeyspace())
+	require.Nil(t, ch.compressionBridge.getCompressor())
+	for _, connector := range []*ClusterConnector{ch.originCassandraConnector, ch.targetCassandraConnector} {
+		require.Equal(t, map[string]string{message.StartupOptionCqlVersion: "3.0.0"}, connector.startupOptions.Load())
+	}
+
+	// the client negotiated another protocol version after the STARTUP request
+	_, _, err = ch.getStartupRequest(primitive.ProtocolVersion3)
+	require.NotNil(t, err)
+
+	// a STARTUP request that can not be applied does not leave the previous one cached
+	invalidStartup := mustEncodeFrame(t, &message.Startup{Options: map[string]string{message.StartupOptionCompression: "deflate"}})
+	require.NotNil(t, ch.setStartupRequest(invalidStartup, mustEncodeFrame(t, &message.Ready{})))
+	_, _, err = ch.getStartupRequest(primitive.ProtocolVersion4)
+	require.NotNil(t, err)
+
+	mismatchedResponse, err := defaultCodec.ConvertToRawFrame(frame.NewFrame(primitive.ProtocolVersion3, 0, &message.Ready{}))
+	require.Nil(t, err)
+	require.NotNil(t, ch.setStartupRequest(firstStartup, mismatchedResponse))
+	_, _, err = ch.getStartupRequest(primitive.ProtocolVersion4)
+	require.NotNil(t, err)
+}
+
+func TestSendDuplicateStartupErrorToClient(t *testing.T) {
+	proxySide, clientSide := net.Pipe()
+	defer proxySide.Close()
+	defer clientSide.Close()
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	conf := config.New()
+	writeScheduler := NewScheduler(1)
+	defer writeScheduler.Shutdown()
+	writeCoalescer := NewWriteCoalescer(
+		conf, proxySide, &sync.WaitGroup{}, ctx, cancelFn, "ClientConnector", false, false, writeScheduler,
+		newConnectionFraming(true), nil)
+	writeCoalescer.RunWriteQueueLoop()
+	defer writeCoalescer.Close()
+
+	ch := &ClientHandler{
+		conf:                     conf,
+		clientConnector:          &ClientConnector{connection: proxySide, writeCoalescer: writeCoalescer},
+		originCassandraConnector: &ClusterConnector{connectorType: ClusterConnectorTypeOrigin},
+		targetCassandraConnector: &ClusterConnector{connectorType: ClusterConnectorTypeTarget},
+		currentKeyspaceName:      &atomic.Value{},
+		compressionBridge:        newCompressionBridge(false, false, 0),
+	}
+	startup := mustEncodeFrame(t, &message.Startup{Options: map[string]string{
+		message.StartupOptionCqlVersion: "3.0.0",
+		startupOptionKeyspace:           "ks1",
+	}})
+	startupResponse := mustEncodeFrame(t, &message.Ready{})
+	require.Nil(t, ch.setStartupRequest(startup, startupResponse))
+	ch.StoreCurrentKeyspace("ks2")
+
+	// the client sends STARTUP again after the handshake completed
+	duplicateStartup, err := defaultCodec.ConvertToRawFrame(frame.NewFrame(primitive.ProtocolVersion4, 5, &message.Startup{
+		Options: map[string]string{message.StartupOptionCqlVersion: "3.0.0", startupOptionKeyspace: "ks3"}}))
+	require.Nil(t, err)
+	require.Nil(t, ch.sendDuplicateStartupErrorToClient(duplicateStartup))
+
+	response, err := decodeFrame(clientSide, defaultCodec)
+	require.Nil(t, err)
+	require.Equal(t, int16(5), response.Header.StreamId)
+	protocolErr, ok := response.Body.Message.(*message.ProtocolError)
+	require.True(t, ok, response.Body.Message)
+	require.Contains(t, protocolErr.ErrorMessage, "the connection is already initialized")
+
+	// the session is not modified by the duplicate STARTUP request
+	cachedStartup, cachedResponse, err := ch.getStartupRequest(primitive.ProtocolVersion4)
+	require.Nil(t, err)
+	require.Same(t, startup, cachedStartup)
+	require.Same(t, startupResponse, cachedResponse)
+	require.Equal(t, "ks2", ch.LoadCurrentKeyspace())
+}
@@ -0,0 +1,100 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// startupOptionsFilter removes the configured options from the client's STARTUP request before it is forwarded to
+// each cluster (see ZDM_ORIGIN_STARTUP_OPTIONS_STRIPPED and ZDM_TARGET_STARTUP_OPTIONS_STRIPPED).
+// A nil startupOptionsFilter forwards every option.
+type startupOptionsFilter struct {
+	strippedOptions map[common.ClusterType]map[string]bool
+}
+
+func newStartupOptionsFilter(originStrippedOptions []string, targetStrippedOptions []string) *startupOptionsFilter {
+	if len(originStrippedOptions) == 0 && len(targetStrippedOptions) == 0 {
+		return nil
+	}
+
+	filter := &startupOptionsFilter{strippedOptions: make(map[common.ClusterType]map[string]bool)}
+	for clusterType, options := range map[common.ClusterType][]string{
+		common.ClusterTypeOrigin: originStrippedOptions,
+		common.ClusterTypeTarget: targetStrippedOptions,
+	} {
+		filter.strippedOptions[clusterType] = make(map[string]bool)
+		for _, option := range options {
+			filter.strippedOptions[clusterType][strings.ToUpper(option)] = true
+		}
+	}
+	return filter
+}
+
+// filter returns the options that are forwarded to the cluster, the returned map is the same as the provided one
+// if no option is stripped.
+func (recv *startupOptionsFilter) filter(clusterType common.ClusterType, options map[string]string) map[string]string {
+	if recv == nil || len(recv.strippedOptions[clusterType]) == 0 {
+		return options
+	}
+
+	filteredOptions := make(map[string]string, len(options))
+	for option, value := range options {
+		if recv.strippedOptions[clusterType][strings.ToUpper(option)] {
+			log.Debugf("Stripping STARTUP option %v from the request that is forwarded to %v.", option, clusterType)
+			continue
+		}
+		filteredOptions[option] = value
+	}
+	if len(filteredOptions) == len(options) {
+		return options
+	}
+	return filteredOptions
+}
+
+// handleStartupRequest returns the STARTUP requests that are forwarded to ORIGIN and TARGET,
+// they are the client's request if no option is stripped.
+func (ch *ClientHandler) handleStartupRequest(frameContext *frameDecodeContext) (*frame.RawFrame, *frame.RawFrame, error) {
+	f := frameContext.GetRawFrame()
+	if ch.startupOptionsFilter == nil {
+		return f, f, nil
+	}
+
+	decodedFrame, err := frameContext.GetOrDecodeFrame()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not decode startup request: %w", err)
+	}
+	startup, ok := decodedFrame.Body.Message.(*message.Startup)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected startup message but got %v", decodedFrame.Body.Message)
+	}
+
+	originRequest, err := ch.newFilteredStartupRequest(common.ClusterTypeOrigin, f, decodedFrame, startup)
+	if err != nil {
+		return nil, nil, err
+	}
+	targetRequest, err := ch.newFilteredStartupRequest(common.ClusterTypeTarget, f, decodedFrame, startup)
+	if err != nil {
+		return nil, nil, err
+	}
+	return originRequest, targetRequest, nil
+}
+
+func (ch *ClientHandler) newFilteredStartupRequest(
+	clusterType common.ClusterType, rawFrame *frame.RawFrame, decodedFrame *frame.Frame, startup *message.Startup) (*frame.RawFrame, error) {
+	options := ch.startupOptionsFilter.filter(clusterType, startup.Options)
+	if len(options) == len(startup.Options) {
+		return rawFrame, nil
+	}
+
+	filteredFrame := decodedFrame.Clone()
+	filteredFrame.Body.Message = &message.Startup{Options: options}
+	filteredRequest, err := ch.codec.get().ConvertToRawFrame(filteredFrame)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert startup request for %v to raw frame: %w", clusterType, err)
+	}
+	return filteredRequest, nil
+}
@@ -0,0 +1,59 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestHandleStartupRequest(t *testing.T) {
+	clientOptions := map[string]string{
+		"CQL_VERSION":      "3.0.0",
+		"DRIVER_NAME":      "driver",
+		"DRIVER_VERSION":   "1.0.0",
+		"application_name": "app",
+	}
+	decodeOptions := func(t *testing.T, ch *ClientHandler, request *frameDecodeContext) map[string]string {
+		decodedFrame, err := ch.codec.get().ConvertFromRawFrame(request.GetRawFrame())
+		require.Nil(t, err)
+		return decodedFrame.Body.Message.(*message.Startup).Options
+	}
+
+	ch := &ClientHandler{startupOptionsFilter: newStartupOptionsFilter(
+		[]string{"DRIVER_NAME", "DRIVER_VERSION"}, []string{"APPLICATION_NAME"})}
+	f := mustEncodeFrame(t, &message.Startup{Options: clientOptions})
+	originRequest, targetRequest, err := ch.handleStartupRequest(NewFrameDecodeContext(f))
+	require.Nil(t, err)
+	require.Equal(t, f.Header.StreamId, originRequest.Header.StreamId)
+	require.Equal(t, map[string]string{
+		"CQL_VERSION":      "3.0.0",
+		"application_name": "app",
+	}, decodeOptions(t, ch, NewFrameDecodeContext(originRequest)))
+	require.Equal(t, map[string]string{
+		"CQL_VERSION":    "3.0.0",
+		"DRIVER_NAME":    "driver",
+		"DRIVER_VERSION": "1.0.0",
+	}, decodeOptions(t, ch, NewFrameDecodeContext(targetRequest)))
+
+	// the options that are retained by the cluster connectors for new connections are filtered as well
+	require.Equal(t, map[string]string{
+		"CQL_VERSION":      "3.0.0",
+		"application_name": "app",
+	}, ch.startupOptionsFilter.filter(common.ClusterTypeOrigin, clientOptions))
+
+	// the client's request is forwarded as is when no option is stripped
+	ch = &ClientHandler{startupOptionsFilter: newStartupOptionsFilter(nil, []string{"KEYSPACE_NAME"})}
+	originRequest, targetRequest, err = ch.handleStartupRequest(NewFrameDecodeContext(f))
+	require.Nil(t, err)
+	require.Same(t, f, originRequest)
+	require.Same(t, f, targetRequest)
+
+	require.Nil(t, newStartupOptionsFilter(nil, []string{}))
+	ch = &ClientHandler{}
+	originRequest, targetRequest, err = ch.handleStartupRequest(NewFrameDecodeContext(f))
+	require.Nil(t, err)
+	require.Same(t, f, originRequest)
+	require.Same(t, f, targetRequest)
+	require.Equal(t, clientOptions, ch.startupOptionsFilter.filter(common.ClusterTypeTarget, clientOptions))
+}
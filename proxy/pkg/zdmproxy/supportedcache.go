@@ -0,0 +1,153 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// supportedCache caches the SUPPORTED response that is returned to the client's OPTIONS requests
+// (see ZDM_OPTIONS_CACHE_ENABLED) so that the OPTIONS requests that clients send during the handshake are not forwarded
+// to both clusters every time. The cache is shared by every client connection of the proxy instance and it is
+// refreshed with the responses of both clusters when an OPTIONS request is forwarded after it expires.
+// A nil supportedCache doesn't cache anything.
+type supportedCache struct {
+	refreshInterval time.Duration
+
+	lock      *sync.RWMutex
+	supported *message.Supported
+	expiresAt time.Time
+}
+
+func newSupportedCache(enabled bool, refreshInterval time.Duration) *supportedCache {
+	if !enabled {
+		return nil
+	}
+
+	return &supportedCache{
+		refreshInterval: refreshInterval,
+		lock:            &sync.RWMutex{},
+	}
+}
+
+// get returns the cached SUPPORTED message or nil if it is empty or expired.
+func (recv *supportedCache) get(now time.Time) *message.Supported {
+	if recv == nil {
+		return nil
+	}
+
+	recv.lock.RLock()
+	defer recv.lock.RUnlock()
+	if recv.supported == nil || !now.Before(recv.expiresAt) {
+		return nil
+	}
+	return recv.supported
+}
+
+func (recv *supportedCache) store(supported *message.Supported, now time.Time) {
+	if recv == nil {
+		return
+	}
+
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	recv.supported = supported
+	recv.expiresAt = now.Add(recv.refreshInterval)
+}
+
+// mergeSupportedOptions returns the TARGET options restricted to the values that ORIGIN supports as well (e.g.
+// compression algorithms or protocol versions) so that whatever the client picks works on both clusters. The TARGET
+// values of an option are kept if the clusters have no value in common (e.g. different CQL versions) or if ORIGIN
+// doesn't return that option.
+func mergeSupportedOptions(origin *message.Supported, target *message.Supported) *message.Supported {
+	merged := &message.Supported{Options: make(map[string][]string, len(target.Options))}
+	for option, targetValues := range target.Options {
+		originValues, ok := origin.Options[option]
+		if !ok {
+			merged.Options[option] = targetValues
+			continue
+		}
+
+		commonValues := make([]string, 0, len(targetValues))
+		for _, targetValue := range targetValues {
+			for _, originValue := range originValues {
+				if targetValue == originValue {
+					commonValues = append(commonValues, targetValue)
+					break
+				}
+			}
+		}
+		if len(commonValues) == 0 {
+			commonValues = targetValues
+		}
+		merged.Options[option] = commonValues
+	}
+	return merged
+}
+
+// getCachedSupportedResponse returns the cached SUPPORTED response for the OPTIONS request or nil if the cache is
+// disabled, empty or expired.
+func (ch *ClientHandler) getCachedSupportedResponse(request *frame.RawFrame) *frame.RawFrame {
+	if request.Header.OpCode != primitive.OpCodeOptions {
+		return nil
+	}
+
+	supported := ch.supportedCache.get(nowFunc())
+	if supported == nil {
+		return nil
+	}
+	if spoofedSupported := spoofSupportedOptions(ch.conf, supported); spoofedSupported != nil {
+		supported = spoofedSupported
+	}
+
+	response, err := ch.codec.get().ConvertToRawFrame(
+		frame.NewFrame(request.Header.Version, request.Header.StreamId, supported))
+	if err != nil {
+		log.Warnf("Could not encode cached SUPPORTED response, forwarding OPTIONS request: %v", err)
+		return nil
+	}
+	log.Tracef("Returning cached SUPPORTED response to OPTIONS request with stream id %v.", request.Header.StreamId)
+	return response
+}
+
+// refreshSupportedCache stores the SUPPORTED response that is built from the responses of both clusters and returns
+// it, the TARGET response is returned as is if the cache is disabled.
+func (ch *ClientHandler) refreshSupportedCache(originResponse *frame.RawFrame, targetResponse *frame.RawFrame) *frame.RawFrame {
+	if ch.supportedCache == nil {
+		return targetResponse
+	}
+
+	codec := ch.codec.get()
+	decodedOrigin, err := codec.ConvertFromRawFrame(originResponse)
+	if err != nil {
+		log.Warnf("Could not decode SUPPORTED response of ORIGIN, the SUPPORTED cache is not refreshed: %v", err)
+		return targetResponse
+	}
+	decodedTarget, err := codec.ConvertFromRawFrame(targetResponse)
+	if err != nil {
+		log.Warnf("Could not decode SUPPORTED response of TARGET, the SUPPORTED cache is not refreshed: %v", err)
+		return targetResponse
+	}
+	originSupported, ok := decodedOrigin.Body.Message.(*message.Supported)
+	if !ok {
+		return targetResponse
+	}
+	targetSupported, ok := decodedTarget.Body.Message.(*message.Supported)
+	if !ok {
+		return targetResponse
+	}
+
+	supported := mergeSupportedOptions(originSupported, targetSupported)
+	response, err := codec.ConvertToRawFrame(
+		frame.NewFrame(targetResponse.Header.Version, targetResponse.Header.StreamId, supported))
+	if err != nil {
+		log.Warnf("Could not encode SUPPORTED response, the SUPPORTED cache is not refreshed: %v", err)
+		return targetResponse
+	}
+	ch.supportedCache.store(supported, nowFunc())
+	log.Debugf("SUPPORTED cache refreshed: %v", supported.Options)
+	return response
+}
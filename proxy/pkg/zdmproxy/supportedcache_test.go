@@ -0,0 +1,62 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMergeSupportedOptions(t *testing.T) {
+	origin := &message.Supported{Options: map[string][]string{
+		"COMPRESSION":       {"lz4"},
+		"CQL_VERSION":       {"3.4.4"},
+		"PROTOCOL_VERSIONS": {"3/v3", "4/v4"},
+	}}
+	target := &message.Supported{Options: map[string][]string{
+		"COMPRESSION":       {"lz4", "snappy"},
+		"CQL_VERSION":       {"3.4.5"},
+		"PROTOCOL_VERSIONS": {"3/v3", "4/v4", "5/v5"},
+		"PAGE_UNIT":         {"bytes", "rows"},
+	}}
+
+	require.Equal(t, map[string][]string{
+		"COMPRESSION":       {"lz4"},
+		"CQL_VERSION":       {"3.4.5"},
+		"PROTOCOL_VERSIONS": {"3/v3", "4/v4"},
+		"PAGE_UNIT":         {"bytes", "rows"},
+	}, mergeSupportedOptions(origin, target).Options)
+}
+
+func TestSupportedCache(t *testing.T) {
+	clock := newFakeClock(t)
+	ch := &ClientHandler{conf: config.New(), supportedCache: newSupportedCache(true, time.Minute)}
+	options := mustEncodeFrame(t, &message.Options{})
+	require.Nil(t, ch.getCachedSupportedResponse(options))
+
+	originResponse := mustEncodeFrame(t, &message.Supported{Options: map[string][]string{"COMPRESSION": {"lz4"}}})
+	targetResponse := mustEncodeFrame(t, &message.Supported{Options: map[string][]string{"COMPRESSION": {"lz4", "snappy"}}})
+	response := ch.refreshSupportedCache(originResponse, targetResponse)
+	decodedResponse, err := defaultCodec.ConvertFromRawFrame(response)
+	require.Nil(t, err)
+	require.Equal(t, &message.Supported{Options: map[string][]string{"COMPRESSION": {"lz4"}}}, decodedResponse.Body.Message)
+
+	// the cached response has the stream id of the request
+	options.Header.StreamId = 10
+	cachedResponse := ch.getCachedSupportedResponse(options)
+	require.NotNil(t, cachedResponse)
+	require.Equal(t, int16(10), cachedResponse.Header.StreamId)
+	require.Equal(t, response.Body, cachedResponse.Body)
+	require.Nil(t, ch.getCachedSupportedResponse(mustEncodeFrame(t, &message.Startup{Options: map[string]string{}})))
+
+	clock.advance(time.Minute - time.Nanosecond)
+	require.NotNil(t, ch.getCachedSupportedResponse(options))
+	clock.advance(time.Nanosecond)
+	require.Nil(t, ch.getCachedSupportedResponse(options))
+
+	// the TARGET response is returned as is when the cache is disabled
+	ch = &ClientHandler{}
+	require.Same(t, targetResponse, ch.refreshSupportedCache(originResponse, targetResponse))
+	require.Nil(t, ch.getCachedSupportedResponse(options))
+}
@@ -0,0 +1,123 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+const tableDivergenceUnknownLabel = "unknown"
+
+type divergenceTable struct {
+	keyspace string
+	table    string
+}
+
+var unknownDivergenceTable = divergenceTable{keyspace: tableDivergenceUnknownLabel, table: tableDivergenceUnknownLabel}
+
+// getDivergenceTableLabels returns the labels that a divergent write on the given table is counted with, tables that
+// are seen for the first time after the limit of ZDM_METRICS_TABLE_DIVERGENCE_MAX_TABLES was reached are grouped under
+// "other".
+func getDivergenceTableLabels(tables *boundedLabelSet, table divergenceTable) divergenceTable {
+	if table == unknownDivergenceTable || tables.track(table.keyspace+"."+table.table) {
+		return table
+	}
+	return divergenceTable{keyspace: boundedLabelOther, table: boundedLabelOther}
+}
+
+// trackTableDivergence counts a write that succeeded on one cluster and failed on the other under every table that
+// the write was applied to so that operators can find the tables that have issues on one of the clusters.
+func (ch *ClientHandler) trackTableDivergence(
+	requestInfo RequestInfo, request *frame.RawFrame, originResponse *frame.RawFrame, targetResponse *frame.RawFrame) {
+	if ch.tableDivergence == nil {
+		return
+	}
+
+	originSuccessful := isResponseSuccessful(originResponse)
+	if originSuccessful == isResponseSuccessful(targetResponse) {
+		return
+	}
+	failedOn := common.ClusterTypeOrigin
+	if originSuccessful {
+		failedOn = common.ClusterTypeTarget
+	}
+
+	for _, table := range ch.getDivergenceTables(requestInfo, request) {
+		labels := getDivergenceTableLabels(ch.tableDivergence, table)
+		counter, err := ch.metricHandler.GetDualWriteDivergenceCounter(
+			labels.keyspace, labels.table, strings.ToLower(string(failedOn)))
+		if err != nil {
+			log.Errorf("Could not track divergent write on table %v.%v: %v", labels.keyspace, labels.table, err)
+			continue
+		}
+		counter.Add(1)
+	}
+}
+
+// getDivergenceTables returns the tables of a write. Prepared statements use the metadata of their bound variables
+// and queries are parsed again with the current keyspace of the connection. The table is "unknown" if it could not
+// be resolved.
+func (ch *ClientHandler) getDivergenceTables(requestInfo RequestInfo, request *frame.RawFrame) []divergenceTable {
+	tables := make([]divergenceTable, 0, 1)
+	switch typedRequestInfo := requestInfo.(type) {
+	case *ExecuteRequestInfo:
+		tables = appendDivergenceTable(tables, ch.getPreparedStatementTable(typedRequestInfo.GetPreparedData()))
+	case *BatchRequestInfo:
+		for _, preparedData := range typedRequestInfo.preparedDataByStmtIdx {
+			tables = appendDivergenceTable(tables, ch.getPreparedStatementTable(preparedData))
+		}
+	}
+
+	if request.Header.OpCode == primitive.OpCodeQuery || request.Header.OpCode == primitive.OpCodeBatch {
+		stmtsQueryData, err := ch.newFrameDecodeContext(request).GetOrInspectAllStatements(
+			ch.LoadCurrentKeyspace(), ch.timeUuidGenerator)
+		if err != nil {
+			log.Debugf("Could not resolve the tables of a divergent write: %v", err)
+		}
+		for _, stmtQueryData := range stmtsQueryData {
+			tables = appendDivergenceTable(tables, getQueryTable(stmtQueryData.queryData))
+		}
+	}
+
+	if len(tables) == 0 {
+		tables = append(tables, unknownDivergenceTable)
+	}
+	return tables
+}
+
+func (ch *ClientHandler) getPreparedStatementTable(preparedData PreparedData) divergenceTable {
+	variablesMetadata := preparedData.GetOriginVariablesMetadata()
+	if variablesMetadata != nil && len(variablesMetadata.Columns) > 0 {
+		column := variablesMetadata.Columns[0]
+		return divergenceTable{keyspace: column.Keyspace, table: column.Table}
+	}
+
+	// statements without bound variables don't have column metadata
+	prepareRequestInfo := preparedData.GetPrepareRequestInfo()
+	if prepareRequestInfo == nil {
+		return divergenceTable{}
+	}
+	return getQueryTable(
+		inspectCqlQuery(prepareRequestInfo.GetQuery(), prepareRequestInfo.GetRequestKeyspace(), ch.timeUuidGenerator))
+}
+
+func getQueryTable(queryInfo QueryInfo) divergenceTable {
+	return divergenceTable{keyspace: queryInfo.getApplicableKeyspace(), table: queryInfo.getTableName()}
+}
+
+func appendDivergenceTable(tables []divergenceTable, table divergenceTable) []divergenceTable {
+	if table.table == "" {
+		return tables
+	}
+	if table.keyspace == "" {
+		table.keyspace = tableDivergenceUnknownLabel
+	}
+	for _, existingTable := range tables {
+		if existingTable == table {
+			return tables
+		}
+	}
+	return append(tables, table)
+}
@@ -0,0 +1,139 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/prommetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAggregateAndTrackResponses_TableDivergence(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	ch := &ClientHandler{
+		conf:                config.New(),
+		primaryCluster:      common.ClusterTypeOrigin,
+		currentKeyspaceName: &atomic.Value{},
+		tableDivergence:     newBoundedLabelSet(2),
+		metricHandler: metrics.NewMetricHandler(
+			prommetrics.NewPrometheusMetricFactory(registry), nil, nil, nil, newFakeProxyMetrics(), nil, nil, nil),
+	}
+	ch.StoreCurrentKeyspace("ks1")
+
+	void := mustEncodeFrame(t, &message.VoidResult{})
+	writeTimeout := mustEncodeFrame(t, &message.WriteTimeout{
+		ErrorMessage: "timeout", Consistency: primitive.ConsistencyLevelQuorum, Received: 1, BlockFor: 2,
+		WriteType: primitive.WriteTypeSimple})
+	write := NewGenericRequestInfo(forwardToBoth, false, true)
+
+	// the writes on one table consistently fail on TARGET
+	failingInsert := mustEncodeFrame(t, &message.Query{Query: "INSERT INTO failing (a) VALUES (1)"})
+	for i := 0; i < 3; i++ {
+		ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster, write, failingInsert, void, writeTimeout)
+	}
+	healthyInsert := mustEncodeFrame(t, &message.Query{Query: "INSERT INTO ks1.healthy (a) VALUES (1)"})
+	ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster, write, healthyInsert, void, void)
+	ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster, write, healthyInsert, writeTimeout, writeTimeout)
+
+	// the table of a prepared statement is resolved from its variables metadata
+	preparedData := NewPreparedData(
+		&message.PreparedResult{
+			PreparedQueryId: []byte("origin"),
+			VariablesMetadata: &message.VariablesMetadata{
+				Columns: []*message.ColumnMetadata{{Keyspace: "ks2", Table: "prepared", Name: "a"}}}},
+		&message.PreparedResult{PreparedQueryId: []byte("target")},
+		NewPrepareRequestInfo(write, nil, true, "INSERT INTO ks2.prepared (a) VALUES (?)", ""))
+	execute := mustEncodeFrame(t, &message.Execute{QueryId: []byte("origin"), Options: &message.QueryOptions{}})
+	ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster, NewExecuteRequestInfo(preparedData), execute, writeTimeout, void)
+
+	// the limit of tables was reached so the tables of this batch are grouped under "other"
+	batch := mustEncodeFrame(t, &message.Batch{Children: []*message.BatchChild{
+		{QueryOrId: "INSERT INTO ks3.t1 (a) VALUES (1)"},
+		{QueryOrId: "INSERT INTO ks3.t2 (a) VALUES (1)"},
+	}})
+	ch.aggregateAndTrackResponses(newRequestLogger(0), ch.primaryCluster, NewBatchRequestInfo(nil), batch, void, writeTimeout)
+
+	require.Equal(t, map[string]float64{
+		"ks1/failing/target":  3,
+		"ks2/prepared/origin": 1,
+		"other/other/target":  2,
+	}, gatherTableDivergences(t, registry))
+}
+
+func TestGetDivergenceTables(t *testing.T) {
+	ch := &ClientHandler{currentKeyspaceName: &atomic.Value{}}
+	ch.StoreCurrentKeyspace("ks1")
+
+	withoutVariables := NewPreparedData(
+		&message.PreparedResult{PreparedQueryId: []byte("origin")},
+		&message.PreparedResult{PreparedQueryId: []byte("target")},
+		NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "DELETE FROM ks2.t WHERE a = 1", ""))
+	batch := mustEncodeFrame(t, &message.Batch{Children: []*message.BatchChild{
+		{QueryOrId: "INSERT INTO t (a) VALUES (1)"},
+		{QueryOrId: []byte("origin")},
+		{QueryOrId: "UPDATE t SET b = 1 WHERE a = 1"},
+	}})
+
+	tests := []struct {
+		name           string
+		requestInfo    RequestInfo
+		request        *frame.RawFrame
+		expectedTables []divergenceTable
+	}{
+		{
+			name:           "query with current keyspace",
+			requestInfo:    NewGenericRequestInfo(forwardToBoth, false, true),
+			request:        mustEncodeFrame(t, &message.Query{Query: "UPDATE t SET b = 1 WHERE a = 1"}),
+			expectedTables: []divergenceTable{{keyspace: "ks1", table: "t"}},
+		},
+		{
+			name:           "prepared statement without variables",
+			requestInfo:    NewExecuteRequestInfo(withoutVariables),
+			request:        mustEncodeFrame(t, &message.Execute{QueryId: []byte("origin"), Options: &message.QueryOptions{}}),
+			expectedTables: []divergenceTable{{keyspace: "ks2", table: "t"}},
+		},
+		{
+			name:           "batch",
+			requestInfo:    NewBatchRequestInfo(map[int]PreparedData{1: withoutVariables}),
+			request:        batch,
+			expectedTables: []divergenceTable{{keyspace: "ks2", table: "t"}, {keyspace: "ks1", table: "t"}},
+		},
+		{
+			name:           "unparseable query",
+			requestInfo:    NewGenericRequestInfo(forwardToBoth, false, true),
+			request:        mustEncodeFrame(t, &message.Query{Query: "not a query"}),
+			expectedTables: []divergenceTable{unknownDivergenceTable},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expectedTables, ch.getDivergenceTables(tt.requestInfo, tt.request))
+		})
+	}
+}
+
+func gatherTableDivergences(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	metricFamilies, err := registry.Gather()
+	require.Nil(t, err)
+	counts := map[string]float64{}
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() != "zdm_proxy_dual_write_divergences_total" {
+			continue
+		}
+		for _, m := range metricFamily.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			counts[labels["keyspace"]+"/"+labels["table"]+"/"+labels["failed_on"]] = m.GetCounter().GetValue()
+		}
+	}
+	return counts
+}
@@ -0,0 +1,170 @@
+package zdmproxy
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// shouldReprepareTargetWrite returns the prepared data of the statement if the request is a bound write that succeeded
+// on ORIGIN but returned UNPREPARED on TARGET and ZDM_TARGET_UNPREPARED_WRITE_REPREPARE_ENABLED is true.
+func (ch *ClientHandler) shouldReprepareTargetWrite(reqCtx *requestContextImpl) (PreparedData, bool) {
+	if !ch.conf.TargetUnpreparedWriteReprepareEnabled || reqCtx.targetRequest == nil {
+		return nil, false
+	}
+
+	executeRequestInfo, ok := reqCtx.requestInfo.(*ExecuteRequestInfo)
+	if !ok || executeRequestInfo.GetForwardDecision() != forwardToBoth {
+		return nil, false
+	}
+
+	if reqCtx.originResponse == nil || !isResponseSuccessful(reqCtx.originResponse) ||
+		reqCtx.targetResponse == nil || isResponseSuccessful(reqCtx.targetResponse) {
+		return nil, false
+	}
+	errMsg, err := decodeErrorResult(ch.codec.get(), reqCtx.targetResponse)
+	if err != nil {
+		log.Debugf("Could not decode %v error response of stream id %d: %v", common.ClusterTypeTarget, reqCtx.request.Header.StreamId, err)
+		return nil, false
+	}
+	if _, ok = errMsg.(*message.Unprepared); !ok {
+		return nil, false
+	}
+
+	preparedData := executeRequestInfo.GetPreparedData()
+	prepareRequestInfo := preparedData.GetPrepareRequestInfo()
+	if prepareRequestInfo.GetKeyspace() == "" && prepareRequestInfo.GetRequestKeyspace() != ch.LoadCurrentKeyspace() {
+		// the statement could be prepared in the wrong keyspace if the query doesn't include it
+		log.Debugf("Not preparing OriginPreparedId=%v on %v again because the keyspace of the connection changed.",
+			hex.EncodeToString(preparedData.GetOriginPreparedId()), common.ClusterTypeTarget)
+		return nil, false
+	}
+	return preparedData, true
+}
+
+// reprepareTargetWrite prepares the statement on TARGET again and retries the write on TARGET only, ORIGIN is not
+// involved because the write already succeeded there. The response of the retry replaces the UNPREPARED response,
+// if anything fails the UNPREPARED response is kept so the client prepares the statement again.
+func (ch *ClientHandler) reprepareTargetWrite(reqCtx *requestContextImpl, preparedData PreparedData) {
+	originPreparedId := hex.EncodeToString(preparedData.GetOriginPreparedId())
+	log.Debugf("Write with OriginPreparedId=%v returned UNPREPARED on %v only, preparing it on %v again.",
+		originPreparedId, common.ClusterTypeTarget, common.ClusterTypeTarget)
+
+	response, err := ch.retryTargetWrite(reqCtx, preparedData)
+	if err != nil {
+		log.Warnf("Could not retry write with OriginPreparedId=%v on %v after preparing it again, "+
+			"returning UNPREPARED to the client: %v", originPreparedId, common.ClusterTypeTarget, err)
+		return
+	}
+
+	reqCtx.targetResponse = response
+	if reqCtx.requestInfo.ShouldBeTrackedInMetrics() {
+		ch.metricHandler.GetProxyMetrics().TargetUnpreparedWriteRetries.Add(1)
+	}
+}
+
+func (ch *ClientHandler) retryTargetWrite(reqCtx *requestContextImpl, preparedData PreparedData) (*frame.RawFrame, error) {
+	// client connections that get UNPREPARED for the same statement on the same TARGET host share a single PREPARE
+	targetPreparedResult, shared, err := ch.preparedStatementCache.Reprepare(
+		ch.clientHandlerContext, ch.targetCassandraConnector.connection.RemoteAddr().String(), preparedData.GetOriginPreparedId(),
+		func() (*message.PreparedResult, error) {
+			return ch.prepareTargetWrite(reqCtx, preparedData)
+		})
+	if err != nil {
+		if ch.clientHandlerContext.Err() != nil {
+			return nil, ShutdownErr
+		}
+		return nil, err
+	}
+	if shared {
+		log.Debugf("Retrying write with OriginPreparedId=%v with the result of a PREPARE request of another client connection.",
+			hex.EncodeToString(preparedData.GetOriginPreparedId()))
+	}
+
+	// the request that was sent to TARGET is retried so that generated values (e.g. now()) match the ones on ORIGIN
+	decodedRequest, err := ch.codec.get().ConvertFromRawFrame(reqCtx.targetRequest)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode EXECUTE: %w", err)
+	}
+	executeMsg, ok := decodedRequest.Body.Message.(*message.Execute)
+	if !ok {
+		return nil, fmt.Errorf("expected EXECUTE but got %v", decodedRequest.Body.Message)
+	}
+	executeMsg.QueryId = targetPreparedResult.PreparedQueryId
+	if len(executeMsg.ResultMetadataId) > 0 {
+		executeMsg.ResultMetadataId = targetPreparedResult.ResultMetadataId
+	}
+	retriedRequest, err := ch.codec.get().ConvertToRawFrame(decodedRequest)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert EXECUTE to raw frame: %w", err)
+	}
+
+	return ch.executeTargetReprepareRequest(retriedRequest)
+}
+
+// prepareTargetWrite prepares the statement on TARGET again and stores the new TARGET prepared id in the cache.
+func (ch *ClientHandler) prepareTargetWrite(reqCtx *requestContextImpl, preparedData PreparedData) (*message.PreparedResult, error) {
+	version := reqCtx.targetRequest.Header.Version
+	streamId := reqCtx.targetRequest.Header.StreamId
+	prepareRequestInfo := preparedData.GetPrepareRequestInfo()
+	prepareFrame := frame.NewFrame(version, streamId, &message.Prepare{
+		Query:    prepareRequestInfo.GetQuery(),
+		Keyspace: prepareRequestInfo.GetKeyspace(),
+	})
+	prepareRequest, err := ch.codec.get().ConvertToRawFrame(prepareFrame)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert PREPARE to raw frame: %w", err)
+	}
+
+	prepareResponse, err := ch.executeTargetReprepareRequest(prepareRequest)
+	if err != nil {
+		return nil, err
+	}
+	decodedPrepareResponse, err := ch.codec.get().ConvertFromRawFrame(prepareResponse)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode PREPARE response: %w", err)
+	}
+	targetPreparedResult, ok := decodedPrepareResponse.Body.Message.(*message.PreparedResult)
+	if !ok {
+		return nil, fmt.Errorf("expected PREPARED but got %v", decodedPrepareResponse.Body.Message)
+	}
+
+	ch.preparedStatementCache.Store(&message.PreparedResult{
+		PreparedQueryId:   preparedData.GetOriginPreparedId(),
+		ResultMetadataId:  preparedData.GetOriginResultMetadataId(),
+		VariablesMetadata: preparedData.GetOriginVariablesMetadata(),
+	}, targetPreparedResult, prepareRequestInfo)
+	return targetPreparedResult, nil
+}
+
+// executeTargetReprepareRequest sends the request to TARGET and waits for its response.
+func (ch *ClientHandler) executeTargetReprepareRequest(request *frame.RawFrame) (*frame.RawFrame, error) {
+	channel := make(chan *customResponse, 1)
+	err := ch.executeRequest(
+		ch.newFrameDecodeContext(request),
+		NewTargetReprepareRequestInfo(),
+		ch.LoadCurrentKeyspace(),
+		nowFunc(),
+		channel,
+		time.Duration(ch.conf.ProxyRequestTimeoutMs)*time.Millisecond)
+	if err != nil {
+		return nil, fmt.Errorf("could not send %v request: %w", request.Header.OpCode, err)
+	}
+
+	select {
+	case response, ok := <-channel:
+		if !ok || response == nil || response.targetResponse == nil {
+			if ch.clientHandlerContext.Err() != nil {
+				return nil, ShutdownErr
+			}
+			return nil, fmt.Errorf("no response received for %v request", request.Header.OpCode)
+		}
+		return response.targetResponse, nil
+	case <-ch.clientHandlerContext.Done():
+		return nil, ShutdownErr
+	}
+}
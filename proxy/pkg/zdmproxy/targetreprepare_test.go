@@ -0,0 +1,62 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShouldReprepareTargetWrite(t *testing.T) {
+	writePrepareRequestInfo := NewPrepareRequestInfo(
+		NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "INSERT INTO t (a) VALUES (?)", "")
+	writePrepareRequestInfo.requestKeyspace = "ks1"
+	writeData := NewPreparedData(
+		&message.PreparedResult{PreparedQueryId: []byte("origin")},
+		&message.PreparedResult{PreparedQueryId: []byte("target")},
+		writePrepareRequestInfo)
+	readData := NewPreparedData(
+		&message.PreparedResult{PreparedQueryId: []byte("origin")},
+		&message.PreparedResult{PreparedQueryId: []byte("target")},
+		NewPrepareRequestInfo(NewGenericRequestInfo(forwardToOrigin, false, true), nil, false, "SELECT * FROM t", ""))
+
+	void := mustEncodeFrame(t, &message.VoidResult{})
+	unprepared := mustEncodeFrame(t, &message.Unprepared{ErrorMessage: "unprepared", Id: []byte("target")})
+	overloaded := mustEncodeFrame(t, &message.Overloaded{ErrorMessage: "overloaded"})
+	execute := mustEncodeFrame(t, &message.Execute{QueryId: []byte("origin")})
+
+	tests := []struct {
+		name            string
+		enabled         bool
+		requestInfo     RequestInfo
+		keyspace        string
+		originResponse  *frame.RawFrame
+		targetResponse  *frame.RawFrame
+		expectReprepare bool
+	}{
+		{"unprepared on target", true, NewExecuteRequestInfo(writeData), "ks1", void, unprepared, true},
+		{"disabled", false, NewExecuteRequestInfo(writeData), "ks1", void, unprepared, false},
+		{"unprepared on both", true, NewExecuteRequestInfo(writeData), "ks1", unprepared, unprepared, false},
+		{"other error on target", true, NewExecuteRequestInfo(writeData), "ks1", void, overloaded, false},
+		{"read", true, NewExecuteRequestInfo(readData), "ks1", void, unprepared, false},
+		{"keyspace changed", true, NewExecuteRequestInfo(writeData), "ks2", void, unprepared, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := config.New()
+			conf.TargetUnpreparedWriteReprepareEnabled = tt.enabled
+			ch := &ClientHandler{conf: conf, currentKeyspaceName: &atomic.Value{}}
+			ch.StoreCurrentKeyspace(tt.keyspace)
+
+			reqCtx := NewRequestContext(execute, tt.requestInfo, time.Now(), nil)
+			reqCtx.targetRequest = execute
+			reqCtx.originResponse = tt.originResponse
+			reqCtx.targetResponse = tt.targetResponse
+			_, ok := ch.shouldReprepareTargetWrite(reqCtx)
+			require.Equal(t, tt.expectReprepare, ok)
+		})
+	}
+}
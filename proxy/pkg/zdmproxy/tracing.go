@@ -0,0 +1,46 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+)
+
+// isTraced returns true if the requests that the client sends with the tracing flag are traced on the cluster,
+// see ZDM_TRACING_MODE.
+func (ch *ClientHandler) isTraced(clusterType common.ClusterType, primaryCluster common.ClusterType) bool {
+	switch ch.tracingMode {
+	case common.TracingModePrimary:
+		return clusterType == primaryCluster
+	case common.TracingModeOrigin:
+		return clusterType == common.ClusterTypeOrigin
+	case common.TracingModeTarget:
+		return clusterType == common.ClusterTypeTarget
+	default:
+		return true
+	}
+}
+
+// removeTracing returns the requests that are forwarded to each cluster, the tracing flag is removed from the
+// requests of the clusters that are not traced. The requests of the async connector are the requests of its cluster.
+func (ch *ClientHandler) removeTracing(primaryCluster common.ClusterType,
+	originRequest *frame.RawFrame, targetRequest *frame.RawFrame) (*frame.RawFrame, *frame.RawFrame) {
+	if !ch.isTraced(common.ClusterTypeOrigin, primaryCluster) {
+		originRequest = removeTracingFlag(originRequest)
+	}
+	if !ch.isTraced(common.ClusterTypeTarget, primaryCluster) {
+		targetRequest = removeTracingFlag(targetRequest)
+	}
+	return originRequest, targetRequest
+}
+
+// removeTracingFlag returns a copy of the request without the tracing flag, the body of a request doesn't depend on
+// the flag so it is shared with the provided request.
+func removeTracingFlag(request *frame.RawFrame) *frame.RawFrame {
+	if request == nil || !request.Header.Flags.Contains(primitive.HeaderFlagTracing) {
+		return request
+	}
+	header := request.Header.Clone()
+	header.Flags = header.Flags.Remove(primitive.HeaderFlagTracing)
+	return &frame.RawFrame{Header: header, Body: request.Body}
+}
@@ -0,0 +1,55 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRemoveTracing(t *testing.T) {
+	tests := []struct {
+		name           string
+		tracingMode    common.TracingMode
+		primaryCluster common.ClusterType
+		originTraced   bool
+		targetTraced   bool
+	}{
+		{"both", common.TracingModeBoth, common.ClusterTypeOrigin, true, true},
+		{"primary origin", common.TracingModePrimary, common.ClusterTypeOrigin, true, false},
+		{"primary target", common.TracingModePrimary, common.ClusterTypeTarget, false, true},
+		{"origin", common.TracingModeOrigin, common.ClusterTypeTarget, true, false},
+		{"target", common.TracingModeTarget, common.ClusterTypeOrigin, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &ClientHandler{tracingMode: tt.tracingMode, primaryCluster: tt.primaryCluster}
+			request := mustEncodeFrame(t, &message.Query{Query: "INSERT INTO ks.t (a) VALUES (1)", Options: &message.QueryOptions{}})
+			request.Header.Flags = request.Header.Flags.Add(primitive.HeaderFlagTracing)
+
+			originRequest, targetRequest := ch.removeTracing(ch.primaryCluster, request, request)
+			require.Equal(t, tt.originTraced, originRequest.Header.Flags.Contains(primitive.HeaderFlagTracing))
+			require.Equal(t, tt.targetTraced, targetRequest.Header.Flags.Contains(primitive.HeaderFlagTracing))
+			require.Equal(t, request.Body, originRequest.Body)
+			require.Equal(t, request.Body, targetRequest.Body)
+
+			// the client's request is shared with the other cluster so it must not be modified
+			require.True(t, request.Header.Flags.Contains(primitive.HeaderFlagTracing))
+		})
+	}
+}
+
+func TestRemoveTracing_NotRequested(t *testing.T) {
+	ch := &ClientHandler{tracingMode: common.TracingModePrimary, primaryCluster: common.ClusterTypeOrigin}
+	request := mustEncodeFrame(t, &message.Query{Query: "SELECT * FROM ks.t", Options: &message.QueryOptions{}})
+
+	originRequest, targetRequest := ch.removeTracing(ch.primaryCluster, request, request)
+	require.Same(t, request, originRequest)
+	require.Same(t, request, targetRequest)
+
+	originRequest, targetRequest = ch.removeTracing(ch.primaryCluster, request, nil)
+	require.Same(t, request, originRequest)
+	require.Nil(t, targetRequest)
+}
@@ -0,0 +1,128 @@
+package zdmproxy
+
+import (
+	"container/list"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"sync"
+	"time"
+)
+
+// trackingMap is a bounded map for the features that track recent requests in memory (e.g. the retry detection),
+// it keeps the memory of the proxy bounded when the tracked keys keep changing.
+// Entries expire when they were not updated within the ttl and the least recently updated entry is evicted when the
+// map is full, see ZDM_TRACKING_MAP_MAX_ENTRIES and ZDM_TRACKING_MAP_MAX_AGE_MS.
+//
+// The size of every tracking map is added to the entries gauge so close must be called when the map is discarded.
+type trackingMap struct {
+	maxEntries int
+	ttl        time.Duration
+
+	entriesGauge metrics.Gauge
+	evictions    metrics.Counter
+
+	lock    *sync.Mutex
+	entries map[interface{}]*list.Element
+	order   *list.List // least recently updated entry first
+	closed  bool
+}
+
+type trackingMapEntry struct {
+	key     interface{}
+	value   interface{}
+	updated time.Time
+}
+
+func newTrackingMap(
+	maxEntries int, ttl time.Duration, entriesGauge metrics.Gauge, evictions metrics.Counter) *trackingMap {
+	return &trackingMap{
+		maxEntries:   maxEntries,
+		ttl:          ttl,
+		entriesGauge: entriesGauge,
+		evictions:    evictions,
+		lock:         &sync.Mutex{},
+		entries:      make(map[interface{}]*list.Element),
+		order:        list.New(),
+	}
+}
+
+// get returns the value of the key, false is returned if there is no entry or if it expired.
+func (recv *trackingMap) get(key interface{}, now time.Time) (interface{}, bool) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	recv.evictExpired(now)
+	element, ok := recv.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return element.Value.(*trackingMapEntry).value, true
+}
+
+// put adds or updates the entry of the key, updating an entry resets its age.
+func (recv *trackingMap) put(key interface{}, value interface{}, now time.Time) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	if recv.closed {
+		return
+	}
+
+	recv.evictExpired(now)
+	if element, ok := recv.entries[key]; ok {
+		entry := element.Value.(*trackingMapEntry)
+		entry.value = value
+		entry.updated = now
+		recv.order.MoveToBack(element)
+		return
+	}
+
+	for len(recv.entries) >= recv.maxEntries && recv.order.Len() > 0 {
+		recv.removeElement(recv.order.Front())
+		recv.evictions.Add(1)
+	}
+	recv.entries[key] = recv.order.PushBack(&trackingMapEntry{key: key, value: value, updated: now})
+	recv.entriesGauge.Add(1)
+}
+
+func (recv *trackingMap) remove(key interface{}) {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	if element, ok := recv.entries[key]; ok {
+		recv.removeElement(element)
+	}
+}
+
+func (recv *trackingMap) len() int {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+	return len(recv.entries)
+}
+
+// close removes every entry without counting them as evictions, entries that are put afterwards are ignored.
+func (recv *trackingMap) close() {
+	recv.lock.Lock()
+	defer recv.lock.Unlock()
+
+	recv.entriesGauge.Subtract(len(recv.entries))
+	recv.entries = make(map[interface{}]*list.Element)
+	recv.order.Init()
+	recv.closed = true
+}
+
+// evictExpired removes the entries that were not updated within the ttl, they are at the front of the list.
+func (recv *trackingMap) evictExpired(now time.Time) {
+	for element := recv.order.Front(); element != nil; element = recv.order.Front() {
+		if now.Sub(element.Value.(*trackingMapEntry).updated) <= recv.ttl {
+			return
+		}
+		recv.removeElement(element)
+		recv.evictions.Add(1)
+	}
+}
+
+func (recv *trackingMap) removeElement(element *list.Element) {
+	recv.order.Remove(element)
+	delete(recv.entries, element.Value.(*trackingMapEntry).key)
+	recv.entriesGauge.Subtract(1)
+}
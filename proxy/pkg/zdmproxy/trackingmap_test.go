@@ -0,0 +1,94 @@
+package zdmproxy
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTrackingMap_ExpiresEntries(t *testing.T) {
+	entries := &countingGauge{}
+	evictions := &countingCounter{}
+	m := newTrackingMap(10, time.Second, entries, evictions)
+	now := time.Now()
+
+	m.put("a", 1, now)
+	m.put("b", 2, now.Add(500*time.Millisecond))
+	require.Equal(t, int64(2), entries.get())
+
+	value, ok := m.get("a", now.Add(time.Second))
+	require.True(t, ok)
+	require.Equal(t, 1, value)
+
+	// updating an entry resets its age
+	m.put("b", 3, now.Add(1400*time.Millisecond))
+
+	_, ok = m.get("a", now.Add(time.Second+time.Nanosecond))
+	require.False(t, ok)
+	require.Equal(t, 1, m.len())
+	require.Equal(t, int64(1), entries.get())
+	require.Equal(t, int64(1), evictions.get())
+
+	value, ok = m.get("b", now.Add(2400*time.Millisecond))
+	require.True(t, ok)
+	require.Equal(t, 3, value)
+
+	_, ok = m.get("b", now.Add(2400*time.Millisecond+time.Nanosecond))
+	require.False(t, ok)
+	require.Equal(t, 0, m.len())
+	require.Equal(t, int64(0), entries.get())
+	require.Equal(t, int64(2), evictions.get())
+}
+
+func TestTrackingMap_EvictsLeastRecentlyUpdated(t *testing.T) {
+	entries := &countingGauge{}
+	evictions := &countingCounter{}
+	m := newTrackingMap(3, time.Minute, entries, evictions)
+	now := time.Now()
+
+	m.put("a", 1, now)
+	m.put("b", 2, now)
+	m.put("c", 3, now)
+	m.put("a", 4, now)
+	m.put("d", 5, now)
+	require.Equal(t, 3, m.len())
+	require.Equal(t, int64(3), entries.get())
+	require.Equal(t, int64(1), evictions.get())
+
+	_, ok := m.get("b", now)
+	require.False(t, ok)
+	for _, key := range []string{"a", "c", "d"} {
+		_, ok = m.get(key, now)
+		require.True(t, ok, key)
+	}
+
+	// removed entries are not evictions
+	m.remove("c")
+	m.remove("unknown")
+	require.Equal(t, 2, m.len())
+	require.Equal(t, int64(2), entries.get())
+	require.Equal(t, int64(1), evictions.get())
+}
+
+func TestTrackingMap_Close(t *testing.T) {
+	entries := &countingGauge{}
+	evictions := &countingCounter{}
+	first := newTrackingMap(10, time.Minute, entries, evictions)
+	second := newTrackingMap(10, time.Minute, entries, evictions)
+	now := time.Now()
+
+	first.put("a", 1, now)
+	first.put("b", 2, now)
+	second.put("a", 1, now)
+	require.Equal(t, int64(3), entries.get())
+
+	first.close()
+	require.Equal(t, 0, first.len())
+	require.Equal(t, int64(1), entries.get())
+	require.Equal(t, int64(0), evictions.get())
+
+	// entries put after the map was closed are ignored so that the gauge stays accurate
+	first.put("c", 3, now)
+	require.Equal(t, 0, first.len())
+	require.Equal(t, int64(1), entries.get())
+}
@@ -0,0 +1,137 @@
+package zdmproxy
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"strings"
+)
+
+// maxUnknownErrorCodeLabels is the maximum number of error codes that get their own label in
+// proxy_unknown_error_codes_total, the error codes of a misbehaving cluster are arbitrary 32-bit values.
+const maxUnknownErrorCodeLabels = 32
+
+// unknownError is an error response with an error code that is not part of the protocol specification, e.g. a vendor
+// specific error code. The codec of the protocol library fails to decode these responses so only the error code and
+// the error message are decoded, the rest of the body is ignored.
+type unknownError struct {
+	ErrorCode    primitive.ErrorCode
+	ErrorMessage string
+}
+
+func (m *unknownError) IsResponse() bool {
+	return true
+}
+
+func (m *unknownError) GetOpCode() primitive.OpCode {
+	return primitive.OpCodeError
+}
+
+func (m *unknownError) Clone() message.Message {
+	newObj := *m
+	return &newObj
+}
+
+func (m *unknownError) GetErrorCode() primitive.ErrorCode {
+	return m.ErrorCode
+}
+
+func (m *unknownError) GetErrorMessage() string {
+	return m.ErrorMessage
+}
+
+func (m *unknownError) String() string {
+	return fmt.Sprintf("ERROR UNKNOWN (code=%v, msg=%v)", getUnknownErrorCodeLabel(m.ErrorCode), m.ErrorMessage)
+}
+
+// unknownErrorCodec only reads the error code and the error message of an error response.
+type unknownErrorCodec struct{}
+
+func (c *unknownErrorCodec) Encode(msg message.Message, dest io.Writer, _ primitive.ProtocolVersion) error {
+	errMsg, ok := msg.(message.Error)
+	if !ok {
+		return fmt.Errorf("expected message.Error, got %T", msg)
+	}
+	if err := primitive.WriteInt(int32(errMsg.GetErrorCode()), dest); err != nil {
+		return fmt.Errorf("cannot write ERROR code: %w", err)
+	}
+	if err := primitive.WriteString(errMsg.GetErrorMessage(), dest); err != nil {
+		return fmt.Errorf("cannot write ERROR message: %w", err)
+	}
+	return nil
+}
+
+func (c *unknownErrorCodec) EncodedLength(msg message.Message, _ primitive.ProtocolVersion) (int, error) {
+	errMsg, ok := msg.(message.Error)
+	if !ok {
+		return -1, fmt.Errorf("expected message.Error, got %T", msg)
+	}
+	return primitive.LengthOfInt + primitive.LengthOfString(errMsg.GetErrorMessage()), nil
+}
+
+func (c *unknownErrorCodec) Decode(source io.Reader, _ primitive.ProtocolVersion) (message.Message, error) {
+	code, err := primitive.ReadInt(source)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ERROR code: %w", err)
+	}
+	errorMsg, err := primitive.ReadString(source)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ERROR message: %w", err)
+	}
+	return &unknownError{ErrorCode: primitive.ErrorCode(code), ErrorMessage: errorMsg}, nil
+}
+
+func (c *unknownErrorCodec) GetOpCode() primitive.OpCode {
+	return primitive.OpCodeError
+}
+
+var unknownErrorRawCodec = frame.NewRawCodec(&unknownErrorCodec{})
+
+// decodeUnknownError returns the error response as an unknownError if its error code is not part of the protocol
+// specification, nil otherwise.
+func decodeUnknownError(response *frame.RawFrame) *unknownError {
+	if response.Header.OpCode != primitive.OpCodeError {
+		return nil
+	}
+	body, err := unknownErrorRawCodec.DecodeBody(response.Header, bytes.NewReader(response.Body))
+	if err != nil {
+		return nil
+	}
+	unknownErr, ok := body.Message.(*unknownError)
+	if !ok || unknownErr.ErrorCode.IsValid() {
+		return nil
+	}
+	return unknownErr
+}
+
+// getUnknownErrorCodeLabel formats the error code like the protocol specification does, e.g. 0x1001.
+func getUnknownErrorCodeLabel(errorCode primitive.ErrorCode) string {
+	return fmt.Sprintf("0x%04X", uint32(errorCode))
+}
+
+// trackUnknownErrorCode logs and meters a response from the given cluster with an error code that is not part of the
+// protocol specification so that new backend behaviors are visible. The error response is only logged if
+// unknownErrorCodes is nil.
+func (ch *ClientHandler) trackUnknownErrorCode(response *frame.RawFrame, clusterType common.ClusterType) {
+	unknownErr := decodeUnknownError(response)
+	if unknownErr == nil {
+		return
+	}
+
+	log.Debugf("Received error response with unknown error code from %v: %v", clusterType, unknownErr)
+	if ch.unknownErrorCodes == nil {
+		return
+	}
+	errorCode := ch.unknownErrorCodes.getLabel(getUnknownErrorCodeLabel(unknownErr.ErrorCode))
+	counter, err := ch.metricHandler.GetUnknownErrorCodesCounter(strings.ToLower(string(clusterType)), errorCode)
+	if err != nil {
+		log.Errorf("Could not track unknown error code %v of %v: %v", errorCode, clusterType, err)
+		return
+	}
+	counter.Add(1)
+}
@@ -0,0 +1,99 @@
+package zdmproxy
+
+import (
+	"encoding/binary"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/prommetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// mustEncodeUnknownError returns an error response with the given error code followed by vendor specific fields.
+func mustEncodeUnknownError(t *testing.T, errorCode uint32) *frame.RawFrame {
+	response := mustEncodeFrame(t, &message.ServerError{ErrorMessage: "vendor specific error"})
+	binary.BigEndian.PutUint32(response.Body, errorCode)
+	response.Body = append(response.Body, 0xCA, 0xFE)
+	response.Header.BodyLength = int32(len(response.Body))
+	return response
+}
+
+func TestDecodeErrorResult_UnknownErrorCode(t *testing.T) {
+	response := mustEncodeUnknownError(t, 0x7001)
+	_, err := defaultCodec.ConvertFromRawFrame(response)
+	require.NotNil(t, err)
+
+	errorResult, err := decodeErrorResult(defaultCodec, response)
+	require.Nil(t, err)
+	require.Equal(t, primitive.ErrorCode(0x7001), errorResult.GetErrorCode())
+	require.Equal(t, "vendor specific error", errorResult.GetErrorMessage())
+	require.Equal(t, "other", getErrorCodeLabel(errorResult.GetErrorCode()))
+
+	// error codes of the protocol specification are decoded as usual
+	require.Nil(t, decodeUnknownError(mustEncodeFrame(t, &message.ServerError{ErrorMessage: "boom"})))
+	errorResult, err = decodeErrorResult(defaultCodec, mustEncodeFrame(t, &message.ServerError{ErrorMessage: "boom"}))
+	require.Nil(t, err)
+	require.IsType(t, &message.ServerError{}, errorResult)
+}
+
+func TestProcessClientResponse_UnknownErrorCode(t *testing.T) {
+	for _, forward := range []bool{false, true} {
+		conf := config.New()
+		conf.ForwardUnknownErrorCodes = forward
+		ch := &ClientHandler{conf: conf}
+		response := mustEncodeUnknownError(t, 0x7001)
+		processedResponse, err := ch.processClientResponse(response, common.ClusterTypeTarget, nil)
+		if forward {
+			require.Nil(t, err)
+			require.Same(t, response, processedResponse)
+		} else {
+			require.NotNil(t, err)
+			require.Nil(t, processedResponse)
+		}
+	}
+}
+
+func TestTrackUnknownErrorCode(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	ch := &ClientHandler{
+		unknownErrorCodes: newBoundedLabelSet(2),
+		metricHandler: metrics.NewMetricHandler(
+			prommetrics.NewPrometheusMetricFactory(registry), nil, nil, nil, newFakeProxyMetrics(), nil, nil, nil),
+	}
+
+	ch.trackUnknownErrorCode(mustEncodeUnknownError(t, 0x7001), common.ClusterTypeTarget)
+	ch.trackUnknownErrorCode(mustEncodeUnknownError(t, 0x7001), common.ClusterTypeTarget)
+	ch.trackUnknownErrorCode(mustEncodeUnknownError(t, 0xAB0002), common.ClusterTypeOrigin)
+	// the limit of error codes was reached so new error codes are grouped under "other"
+	ch.trackUnknownErrorCode(mustEncodeUnknownError(t, 0xAB0003), common.ClusterTypeOrigin)
+	ch.trackUnknownErrorCode(mustEncodeUnknownError(t, 0x7001), common.ClusterTypeOrigin)
+	ch.trackUnknownErrorCode(mustEncodeFrame(t, &message.Overloaded{ErrorMessage: "overloaded"}), common.ClusterTypeOrigin)
+	ch.trackUnknownErrorCode(mustEncodeFrame(t, &message.VoidResult{}), common.ClusterTypeOrigin)
+
+	metricFamilies, err := registry.Gather()
+	require.Nil(t, err)
+	counts := map[string]float64{}
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() != "zdm_proxy_unknown_error_codes_total" {
+			continue
+		}
+		for _, m := range metricFamily.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			counts[labels["cluster"]+"/"+labels["error_code"]] = m.GetCounter().GetValue()
+		}
+	}
+	require.Equal(t, map[string]float64{
+		"target/0x7001":   2,
+		"origin/0xAB0002": 1,
+		"origin/other":    1,
+		"origin/0x7001":   1,
+	}, counts)
+}
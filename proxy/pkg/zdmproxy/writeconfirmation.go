@@ -0,0 +1,91 @@
+package zdmproxy
+
+import (
+	"fmt"
+	"github.com/datastax/go-cassandra-native-protocol/frame"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+)
+
+// isDualWrite returns true for the statements that are sent to both clusters to change data or schema. USE
+// statements are also sent to both clusters but the keyspace has to be set on both cluster connections.
+func isDualWrite(requestInfo RequestInfo) bool {
+	if requestInfo.GetForwardDecision() != forwardToBoth || !requestInfo.ShouldBeTrackedInMetrics() || isRaceRead(requestInfo) {
+		return false
+	}
+
+	switch requestInfo.(type) {
+	case *GenericRequestInfo:
+		return !requestInfo.ShouldAlsoBeSentAsync()
+	case *ExecuteRequestInfo, *BatchRequestInfo:
+		return true
+	default:
+		return false
+	}
+}
+
+// getWriteConfirmation returns the confirmation policy of the request if it is a dual write that can be returned to
+// the client before both clusters responded (see ZDM_DUAL_WRITE_CONFIRMATION), DualWriteConfirmationUndefined otherwise.
+func (ch *ClientHandler) getWriteConfirmation(requestInfo RequestInfo) common.DualWriteConfirmation {
+	if ch.writeConfirmation == common.DualWriteConfirmationBoth || !isDualWrite(requestInfo) {
+		return common.DualWriteConfirmationUndefined
+	}
+	return ch.writeConfirmation
+}
+
+// isConfirmedEarly returns true if the response of the request may be sent to the client before both clusters
+// responded, i.e. race reads and dual writes that are not confirmed by both clusters. The request context keeps the
+// request and the responses until it is released.
+func (recv *requestContextImpl) isConfirmedEarly() bool {
+	return isRaceRead(recv.requestInfo) || recv.writeConfirmation != common.DualWriteConfirmationUndefined
+}
+
+// computeConfirmedWriteResponse returns the response of a dual write that is not confirmed by both clusters: the
+// response that was already chosen by setRaceWinner, otherwise the response that the confirmation policy returns once
+// both clusters responded or the request timed out. A cluster that did not respond is handled as a failure of that
+// cluster, see aggregateMissingResponses.
+func (ch *ClientHandler) computeConfirmedWriteResponse(reqCtx *requestContextImpl) (*frame.RawFrame, common.ClusterType, error) {
+	originResponse, targetResponse, winner := reqCtx.getRaceResponses()
+	switch winner {
+	case common.ClusterTypeOrigin:
+		return originResponse, common.ClusterTypeOrigin, nil
+	case common.ClusterTypeTarget:
+		return targetResponse, common.ClusterTypeTarget, nil
+	}
+
+	aggregatedResponse, responseCluster := ch.aggregateAndTrackResponses(
+		reqCtx.logger(), reqCtx.primaryCluster, reqCtx.requestInfo, reqCtx.request, originResponse, targetResponse)
+	if aggregatedResponse == nil {
+		return nil, common.ClusterTypeNone, fmt.Errorf(
+			"could not aggregate responses from %v and %v cassandra channels, stream: %d",
+			common.ClusterTypeOrigin, common.ClusterTypeTarget, reqCtx.request.Header.StreamId)
+	}
+	switch reqCtx.writeConfirmation {
+	case common.DualWriteConfirmationPrimary:
+		if reqCtx.primaryCluster == common.ClusterTypeTarget && targetResponse != nil {
+			return targetResponse, common.ClusterTypeTarget, nil
+		}
+		if reqCtx.primaryCluster != common.ClusterTypeTarget && originResponse != nil {
+			return originResponse, common.ClusterTypeOrigin, nil
+		}
+	case common.DualWriteConfirmationEither:
+		switch {
+		case isResponseSuccessful(aggregatedResponse):
+		case originResponse != nil && isResponseSuccessful(originResponse):
+			return originResponse, common.ClusterTypeOrigin, nil
+		case targetResponse != nil && isResponseSuccessful(targetResponse):
+			return targetResponse, common.ClusterTypeTarget, nil
+		}
+	}
+	return aggregatedResponse, responseCluster, nil
+}
+
+// trackConfirmedWrite tracks the outcome of a dual write that was already returned to the client once the other
+// cluster responded, a write that timed out on the other cluster is tracked as a failure of that cluster.
+func (ch *ClientHandler) trackConfirmedWrite(reqCtx *requestContextImpl) {
+	if reqCtx.writeConfirmation == common.DualWriteConfirmationUndefined {
+		return
+	}
+
+	originResponse, targetResponse, _ := reqCtx.getRaceResponses()
+	ch.aggregateAndTrackResponses(reqCtx.logger(), reqCtx.primaryCluster, reqCtx.requestInfo, reqCtx.request, originResponse, targetResponse)
+}
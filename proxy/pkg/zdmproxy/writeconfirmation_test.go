@@ -0,0 +1,97 @@
+package zdmproxy
+
+import (
+	"github.com/datastax/go-cassandra-native-protocol/message"
+	"github.com/datastax/go-cassandra-native-protocol/primitive"
+	"github.com/datastax/zdm-proxy/proxy/pkg/common"
+	"github.com/datastax/zdm-proxy/proxy/pkg/config"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics"
+	"github.com/datastax/zdm-proxy/proxy/pkg/metrics/noopmetrics"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGetWriteConfirmation(t *testing.T) {
+	preparedData := NewPreparedData(
+		&message.PreparedResult{PreparedQueryId: []byte("origin")},
+		&message.PreparedResult{PreparedQueryId: []byte("target")},
+		NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "INSERT INTO t (a) VALUES (?)", ""))
+
+	ch := &ClientHandler{writeConfirmation: common.DualWriteConfirmationBoth}
+	write := NewGenericRequestInfo(forwardToBoth, false, true)
+	require.Equal(t, common.DualWriteConfirmationUndefined, ch.getWriteConfirmation(write))
+
+	ch.writeConfirmation = common.DualWriteConfirmationEither
+	require.Equal(t, common.DualWriteConfirmationEither, ch.getWriteConfirmation(write))
+	require.Equal(t, common.DualWriteConfirmationEither, ch.getWriteConfirmation(NewExecuteRequestInfo(preparedData)))
+	require.Equal(t, common.DualWriteConfirmationEither, ch.getWriteConfirmation(NewBatchRequestInfo(map[int]PreparedData{})))
+
+	// USE statements, PREPARE requests, reads and requests that are not tracked always wait for both clusters
+	for _, requestInfo := range []RequestInfo{
+		NewGenericRequestInfo(forwardToBoth, true, true),
+		NewPrepareRequestInfo(NewGenericRequestInfo(forwardToBoth, false, true), nil, false, "INSERT INTO t (a) VALUES (?)", ""),
+		NewGenericRequestInfo(forwardToOrigin, true, true),
+		NewRaceReadRequestInfo(true),
+		NewGenericRequestInfo(forwardToBoth, false, false),
+	} {
+		require.Equal(t, common.DualWriteConfirmationUndefined, ch.getWriteConfirmation(requestInfo), requestInfo)
+	}
+}
+
+func TestSetRaceWinner_DualWrite(t *testing.T) {
+	void := mustEncodeFrame(t, &message.VoidResult{})
+	writeTimeout := mustEncodeFrame(t, &message.WriteTimeout{
+		ErrorMessage: "timeout", Consistency: primitive.ConsistencyLevelQuorum, WriteType: primitive.WriteTypeSimple})
+	newReqCtx := func(confirmation common.DualWriteConfirmation) *requestContextImpl {
+		reqCtx := NewRequestContext(
+			mockQueryFrame(t, "INSERT INTO t (a) VALUES (1)"), NewGenericRequestInfo(forwardToBoth, false, true), time.Now(), nil)
+		reqCtx.writeConfirmation = confirmation
+		reqCtx.primaryCluster = common.ClusterTypeOrigin
+		return reqCtx
+	}
+
+	// writes that are confirmed by both clusters are never answered early
+	reqCtx := newReqCtx(common.DualWriteConfirmationUndefined)
+	reqCtx.updateInternalState(void, common.ClusterTypeOrigin)
+	require.False(t, reqCtx.setRaceWinner(common.ClusterTypeOrigin))
+
+	// the primary cluster answers the write even if it failed, the other cluster never does
+	reqCtx = newReqCtx(common.DualWriteConfirmationPrimary)
+	reqCtx.updateInternalState(void, common.ClusterTypeTarget)
+	require.False(t, reqCtx.setRaceWinner(common.ClusterTypeTarget))
+	reqCtx = newReqCtx(common.DualWriteConfirmationPrimary)
+	reqCtx.updateInternalState(writeTimeout, common.ClusterTypeOrigin)
+	require.True(t, reqCtx.setRaceWinner(common.ClusterTypeOrigin))
+
+	// the first successful response answers the write
+	reqCtx = newReqCtx(common.DualWriteConfirmationEither)
+	reqCtx.updateInternalState(writeTimeout, common.ClusterTypeOrigin)
+	require.False(t, reqCtx.setRaceWinner(common.ClusterTypeOrigin))
+	reqCtx = newReqCtx(common.DualWriteConfirmationEither)
+	reqCtx.updateInternalState(void, common.ClusterTypeTarget)
+	require.True(t, reqCtx.setRaceWinner(common.ClusterTypeTarget))
+}
+
+// A write that was answered early by one cluster and that timed out on the other cluster is tracked as a failure of
+// the cluster that did not respond.
+func TestTrackConfirmedWrite_MissingResponse(t *testing.T) {
+	proxyMetrics := newFakeProxyMetrics()
+	failedOnTarget := &countingCounter{}
+	proxyMetrics.FailedWritesOnTarget = failedOnTarget
+	ch := &ClientHandler{
+		conf: config.New(),
+		metricHandler: metrics.NewMetricHandler(
+			noopmetrics.NewNoopMetricFactory(), nil, nil, nil, proxyMetrics, nil, nil, nil),
+	}
+
+	reqCtx := NewRequestContext(
+		mockQueryFrame(t, "INSERT INTO t (a) VALUES (1)"), NewGenericRequestInfo(forwardToBoth, false, true), time.Now(), nil)
+	reqCtx.writeConfirmation = common.DualWriteConfirmationEither
+	reqCtx.primaryCluster = common.ClusterTypeOrigin
+	reqCtx.updateInternalState(mustEncodeFrame(t, &message.VoidResult{}), common.ClusterTypeOrigin)
+	require.True(t, reqCtx.setRaceWinner(common.ClusterTypeOrigin))
+
+	ch.trackConfirmedWrite(reqCtx)
+	require.Equal(t, int64(1), failedOnTarget.get())
+}